@@ -74,7 +74,7 @@ export default function AnalyticsPage() {
 
   // Calculate derived metrics
   const successRate = metrics?.requests ? 
-    ((metrics.requests.by_status['200'] || 0) / metrics.requests.total * 100) : 0
+    ((metrics.requests.by_status['2xx'] || 0) / metrics.requests.total * 100) : 0
   
   const errorRate = metrics?.errors ? 
     (metrics.errors.total / (metrics?.requests?.total || 1) * 100) : 0
@@ -182,7 +182,7 @@ export default function AnalyticsPage() {
               {successRate.toFixed(1)}%
             </div>
             <p className="text-xs text-slate-400">
-              {metrics?.requests?.by_status['200'] || 0} successful requests
+              {metrics?.requests?.by_status['2xx'] || 0} successful requests
             </p>
           </CardContent>
         </Card>
@@ -51,7 +51,7 @@ export default function DashboardPage() {
     {
       title: "Success Rate",
       value: gatewayMetrics?.requests ? 
-        `${((gatewayMetrics.requests.by_status['200'] || 0) / gatewayMetrics.requests.total * 100).toFixed(1)}%` : 
+        `${((gatewayMetrics.requests.by_status['2xx'] || 0) / gatewayMetrics.requests.total * 100).toFixed(1)}%` : 
         "0%",
       change: "Current",
       icon: CheckCircle,
@@ -297,11 +297,18 @@ class ApiClient {
   // ============================================================================
 
   async getGatewayMetrics(): Promise<any> {
-    return this.makeRequest('/metrics', {
+    // The gateway serves Prometheus text on /metrics; this is its JSON summary
+    return this.makeRequest('/metrics?format=json', {
       requireAuth: false, // Metrics endpoint is public
     })
   }
 
+  async getTenantUsage(tenantId: string, month?: string): Promise<any> {
+    // Usage and remaining quota for a month (YYYY-MM), the current one by default
+    const query = month ? `?month=${encodeURIComponent(month)}` : ''
+    return this.makeRequest(`/_gateway/usage/${encodeURIComponent(tenantId)}${query}`)
+  }
+
   // ============================================================================
   // TENANT MANAGEMENT API
   // ============================================================================
@@ -2,10 +2,14 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
+	"github.com/backsaas/platform/api/pkg/functest"
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
@@ -49,10 +53,24 @@ var schemaDiffCmd = &cobra.Command{
 	RunE:  runSchemaDiff,
 }
 
+var schemaTestCmd = &cobra.Command{
+	Use:   "test [schema-file]",
+	Short: "Run a schema's platform function tests",
+	Long: `Run the test cases declared under each platform function's tests key
+against the function registry, with in-memory data, event, email and logging
+services. Exits non-zero when any case fails.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSchemaTest,
+}
+
 var (
 	schemaTenant string
 	schemaForce  bool
 	schemaDryRun bool
+
+	schemaTestFunction string
+	schemaTestFormat   string
+	schemaTestOutput   string
 )
 
 func init() {
@@ -60,6 +78,7 @@ func init() {
 	schemaCmd.AddCommand(schemaDeployCmd)
 	schemaCmd.AddCommand(schemaListCmd)
 	schemaCmd.AddCommand(schemaDiffCmd)
+	schemaCmd.AddCommand(schemaTestCmd)
 
 	// Deploy flags
 	schemaDeployCmd.Flags().StringVar(&schemaTenant, "tenant", "", "Target tenant ID (required for deploy)")
@@ -70,6 +89,11 @@ func init() {
 	// List flags
 	schemaListCmd.Flags().StringVar(&schemaTenant, "tenant", "", "Tenant ID to list schemas for")
 	schemaListCmd.MarkFlagRequired("tenant")
+
+	// Test flags
+	schemaTestCmd.Flags().StringVar(&schemaTestFunction, "function", "", "Only run this platform function's tests")
+	schemaTestCmd.Flags().StringVar(&schemaTestFormat, "format", "text", "Report format (text, json, junit)")
+	schemaTestCmd.Flags().StringVarP(&schemaTestOutput, "output", "o", "", "Write the report to a file instead of stdout")
 }
 
 type Schema struct {
@@ -345,6 +369,70 @@ type ValidationStep struct {
 	Function func(*Schema) error
 }
 
+func runSchemaTest(cmd *cobra.Command, args []string) error {
+	if schemaTestFormat != "text" && schemaTestFormat != "json" && schemaTestFormat != "junit" {
+		return fmt.Errorf("invalid format %q: must be text, json or junit", schemaTestFormat)
+	}
+
+	testSchema, err := functest.LoadFile(args[0])
+	if err != nil {
+		return err
+	}
+	report, err := functest.NewRunner().Run(cmd.Context(), testSchema, schemaTestFunction)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if schemaTestOutput != "" {
+		file, err := os.Create(schemaTestOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch schemaTestFormat {
+	case "json":
+		err = report.WriteJSON(out)
+	case "junit":
+		err = report.WriteJUnit(out)
+	default:
+		writeTestReport(out, report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("%d of %d function tests failed", report.Failed+report.Errors, report.Total)
+	}
+	return nil
+}
+
+// writeTestReport prints a report for the terminal
+func writeTestReport(w io.Writer, report *functest.Report) {
+	function := ""
+	for _, result := range report.Results {
+		if result.Function != function {
+			function = result.Function
+			fmt.Fprintf(w, "\n%s\n", color.CyanString(function))
+		}
+		switch result.Status {
+		case functest.StatusPassed:
+			fmt.Fprintf(w, "  %s %s\n", color.GreenString("✅"), result.Case)
+		case functest.StatusFailed:
+			fmt.Fprintf(w, "  %s %s\n     %s\n", color.RedString("❌"), result.Case, result.Message)
+		default:
+			fmt.Fprintf(w, "  %s %s\n     %s\n", color.YellowString("⚠️"), result.Case, result.Message)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d tests: %d passed, %d failed, %d errors (%dms)\n",
+		report.Total, report.Passed, report.Failed, report.Errors, report.DurationMS)
+}
+
 func loadSchemaFile(filename string) (*Schema, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -391,22 +479,56 @@ func validateEntities(schema *Schema) error {
 	return nil
 }
 
+// fieldTypeSchemas maps CLI field types to the JSON Schema types the
+// platform API validates payloads with
+var fieldTypeSchemas = map[string]jsonschema.Schema{
+	"string":   {Type: "string"},
+	"text":     {Type: "string"},
+	"integer":  {Type: "integer"},
+	"float":    {Type: "number"},
+	"boolean":  {Type: "boolean"},
+	"date":     {Type: "string", Format: "date"},
+	"datetime": {Type: "string", Format: "date-time"},
+	"json":     {},
+	"uuid":     {Type: "string", Format: "uuid"},
+	"email":    {Type: "string", Format: "email"},
+	"url":      {Type: "string", Format: "uri"},
+}
+
+// validateFieldTypes checks field types and defaults with the platform's
+// JSON Schema validator, reporting every problem at once
 func validateFieldTypes(schema *Schema) error {
-	validTypes := map[string]bool{
-		"string": true, "text": true, "integer": true, "float": true,
-		"boolean": true, "date": true, "datetime": true, "json": true,
-		"uuid": true, "email": true, "url": true,
-	}
+	var violations []jsonschema.Violation
 
 	for entityName, entity := range schema.Entities {
 		for fieldName, field := range entity.Fields {
-			if !validTypes[field.Type] {
-				return fmt.Errorf("entity '%s', field '%s': invalid type '%s'", 
-					entityName, fieldName, field.Type)
+			path := jsonschema.Pointer(jsonschema.Pointer(jsonschema.Pointer("/entities", entityName), "fields"), fieldName)
+
+			fieldSchema, ok := fieldTypeSchemas[field.Type]
+			if !ok {
+				violations = append(violations, jsonschema.Violation{
+					Path:    jsonschema.Pointer(path, "type"),
+					Message: fmt.Sprintf("invalid type '%s'", field.Type),
+				})
+				continue
+			}
+
+			if err := fieldSchema.Validate(field.Default); err != nil {
+				for _, violation := range err.(*jsonschema.ValidationError).Violations {
+					violations = append(violations, jsonschema.Violation{
+						Path:    jsonschema.Pointer(path, "default") + violation.Path,
+						Message: violation.Message,
+					})
+				}
 			}
 		}
 	}
-	return nil
+
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	return &jsonschema.ValidationError{Violations: violations}
 }
 
 func validateRelationships(schema *Schema) error {
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateFieldTypes(t *testing.T) {
+	tests := []struct {
+		name          string
+		schemaYAML    string
+		expectedPaths []string
+	}{
+		{
+			name: "ValidFields",
+			schemaYAML: `
+entities:
+  users:
+    fields:
+      id: { type: uuid, required: true }
+      email: { type: email }
+      age: { type: integer, default: 18 }
+      active: { type: boolean, default: true }
+      joined: { type: date, default: "2024-01-01" }
+`,
+		},
+		{
+			name: "InvalidTypeAndDefaults",
+			schemaYAML: `
+entities:
+  users:
+    fields:
+      id: { type: guid }
+      age: { type: integer, default: "eighteen" }
+      website: { type: url, default: "not a url" }
+`,
+			expectedPaths: []string{
+				"/entities/users/fields/age/default",
+				"/entities/users/fields/id/type",
+				"/entities/users/fields/website/default",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema Schema
+			if err := yaml.Unmarshal([]byte(tt.schemaYAML), &schema); err != nil {
+				t.Fatalf("Failed to parse schema: %v", err)
+			}
+
+			err := validateFieldTypes(&schema)
+			if len(tt.expectedPaths) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Expected validation error")
+			}
+			for _, path := range tt.expectedPaths {
+				if !strings.Contains(err.Error(), path) {
+					t.Errorf("Expected error to mention %s, got %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunSchemaTest(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "schema.yaml")
+	schemaYAML := `
+platform_functions:
+  check_birth_date:
+    entity: people
+    type: validation
+    field: birth_date
+    function: calculate_age
+    tests:
+      - name: future date
+        record: { birth_date: "2999-01-01" }
+        expect: { error: "in the future" }
+      - name: missing date
+        record: {}
+        expect: {}
+`
+	if err := os.WriteFile(schemaFile, []byte(schemaYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { schemaTestFunction, schemaTestFormat, schemaTestOutput = "", "text", "" }()
+
+	tests := []struct {
+		name     string
+		format   string
+		wantErr  string
+		contains string
+	}{
+		{"Text", "text", "1 of 2 function tests failed", "2 tests: 1 passed, 1 failed, 0 errors"},
+		{"JSON", "json", "1 of 2 function tests failed", `"passed": 1`},
+		{"JUnit", "junit", "1 of 2 function tests failed", `<testsuite name="check_birth_date" tests="2" failures="1"`},
+		{"InvalidFormat", "html", "invalid format", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaTestFormat = tt.format
+			var out bytes.Buffer
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.SetOut(&out)
+
+			err := runSchemaTest(cmd, []string{schemaFile})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if !strings.Contains(out.String(), tt.contains) {
+				t.Errorf("Expected output to contain %q, got %s", tt.contains, out.String())
+			}
+		})
+	}
+}
@@ -1,23 +1,205 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/backsaas/platform/api/internal/email"
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/functions/communication"
+	"github.com/backsaas/platform/api/internal/jobs"
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/webhooks"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorker()
+		return
+	}
+
 	addr := getenv("API_ADDR", ":8080")
+	ctx := context.Background()
+
+	events := loadEvents()
+	bus := openBus(ctx, events)
+	defer bus.Close()
+	stores := openStores(ctx)
+
+	// Deliver events to tenants' webhook subscriptions
+	dispatcher := webhooks.NewDispatcher(stores.webhooks, webhooks.NewSender(nil), webhooks.Config{})
+	go func() {
+		opts := pubsub.SubscribeOptions{Group: "webhooks", Consumer: getenv("HOSTNAME", "api")}
+		if err := bus.Subscribe(ctx, opts, dispatcher.HandleEvent); err != nil {
+			log.Printf("webhook subscriber stopped: %v", err)
+		}
+	}()
+	go dispatcher.Run(ctx)
+
+	// Send queued email, publishing email.sent and email.failed
+	mailer := openMailer(ctx, stores.email, bus)
+	communication.SetEmailService(mailer)
+	go mailer.Run(ctx)
+
+	// Record every function execution, and refuse to start when the
+	// declared go_function_registry has drifted from the compiled functions
+	registry := functions.InitializeRegistry()
+	registry.SetExecutionStore(stores.executions)
+	validateFunctions(registry)
+
+	// Run scheduled jobs in process unless dedicated workers
+	// ("backsaas-api worker") share a Postgres job store
+	scheduler := jobs.NewScheduler(stores.jobs)
+	if getenv("JOB_WORKER", "on") != "off" {
+		worker := newWorker(stores.jobs, bus, events, scheduler, registry)
+		go worker.Run(ctx)
+	}
+
 	r := chi.NewRouter()
 	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"name":"backsaas-api","status":"up"}`))
 	})
+	r.Mount("/webhooks", webhooks.NewHandler(stores.webhooks, dispatcher, events).Routes())
+	r.Mount("/email", email.NewHandler(stores.email, mailer).Routes())
+	r.Mount("/functions", functions.NewHistoryHandler(stores.executions).Routes())
+	r.Mount("/jobs", jobs.NewHandler(stores.jobs, scheduler).Routes())
 	log.Printf("listening on %s", addr)
 	log.Fatal(http.ListenAndServe(addr, r))
 }
 
+// openBus connects to the Redis event bus, falling back to an in-process
+// bus when REDIS_URL is not set
+func openBus(ctx context.Context, events map[string][]string) pubsub.Bus {
+	config := pubsub.Config{Events: events}
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		log.Printf("REDIS_URL not set, using in-memory event bus")
+		return pubsub.NewMemoryBus(config)
+	}
+	bus, err := pubsub.NewRedisBusFromURL(ctx, redisURL, config)
+	if err != nil {
+		log.Fatalf("failed to open event bus: %v", err)
+	}
+	return bus
+}
+
+// stores are where the API keeps webhooks, email, function executions and
+// jobs
+type stores struct {
+	webhooks   webhooks.Store
+	email      email.Store
+	executions functions.ExecutionStore
+	jobs       jobs.Store
+}
+
+// openStores opens every store in the Postgres database at DATABASE_URL,
+// sharing one connection pool and creating their tables if needed. When it
+// is not set, the stores are kept in process.
+func openStores(ctx context.Context) stores {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		log.Printf("DATABASE_URL not set, using in-memory stores")
+		return stores{
+			webhooks:   webhooks.NewMemoryStore(),
+			email:      email.NewMemoryStore(),
+			executions: functions.NewMemoryExecutionStore(0),
+			jobs:       jobs.NewMemoryStore(),
+		}
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	webhookStore := webhooks.NewPostgresStore(db)
+	emailStore := email.NewPostgresStore(db)
+	executionStore := functions.NewPostgresExecutionStore(db)
+	jobStore := jobs.NewPostgresStore(db)
+	for _, store := range []interface{ Migrate(context.Context) error }{webhookStore, emailStore, executionStore, jobStore} {
+		if err := store.Migrate(ctx); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+	}
+	return stores{webhooks: webhookStore, email: emailStore, executions: executionStore, jobs: jobStore}
+}
+
+// openMailer creates the mailer with the platform's default templates. Mail
+// goes to the SMTP server in SMTP_URL, or is written to EMAIL_DIR as .eml
+// files when SMTP_URL is not set.
+func openMailer(ctx context.Context, store email.Store, bus pubsub.Bus) *email.Mailer {
+	var transport email.Transport
+	if smtpURL := os.Getenv("SMTP_URL"); smtpURL != "" {
+		config, err := email.ParseSMTPURL(smtpURL)
+		if err != nil {
+			log.Fatalf("failed to configure email: %v", err)
+		}
+		transport = email.NewSMTPTransport(config)
+	} else {
+		dir := getenv("EMAIL_DIR", "mail")
+		log.Printf("SMTP_URL not set, writing email to %s", dir)
+		fileTransport, err := email.NewFileTransport(dir)
+		if err != nil {
+			log.Fatalf("failed to configure email: %v", err)
+		}
+		transport = fileTransport
+	}
+
+	mailer, err := email.NewMailer(store, transport, bus, email.Config{
+		From: getenv("EMAIL_FROM", "BackSaas <no-reply@backsaas.com>"),
+	})
+	if err != nil {
+		log.Fatalf("failed to configure email: %v", err)
+	}
+
+	templates, err := email.LoadTemplates(getenv("EMAIL_TEMPLATES_PATH", "system/email/templates.yaml"))
+	if err != nil {
+		log.Printf("default email templates disabled: %v", err)
+		return mailer
+	}
+	if err := mailer.InstallDefaults(ctx, templates); err != nil {
+		log.Fatalf("failed to install email templates: %v", err)
+	}
+	return mailer
+}
+
+// validateFunctions checks the system schema's go_function_registry against
+// the registered functions
+func validateFunctions(registry *functions.FunctionRegistry) {
+	entries, err := functions.LoadRegistryEntries(getenv("SYSTEM_SCHEMA_PATH", "system/schema/platform.yaml"))
+	if err != nil {
+		log.Printf("function registry validation disabled: %v", err)
+		return
+	}
+	if err := registry.ValidateEntries(entries); err != nil {
+		log.Fatalf("go_function_registry does not match the compiled functions:\n%v", err)
+	}
+}
+
+// loadEvents reads the declared events from the system schema. Without the
+// schema file events aren't validated; a schema whose hooks publish events
+// it doesn't declare is fatal.
+func loadEvents() map[string][]string {
+	events, err := pubsub.LoadEvents(getenv("SYSTEM_SCHEMA_PATH", "system/schema/platform.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("event validation disabled: %v", err)
+		return nil
+	}
+	if err != nil {
+		log.Fatalf("invalid system schema events: %v", err)
+	}
+	return events
+}
+
 func getenv(k, d string) string { if v := os.Getenv(k); v != "" { return v }; return d }
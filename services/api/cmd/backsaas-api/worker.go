@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/functions/communication"
+	"github.com/backsaas/platform/api/internal/jobs"
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+// runWorker runs scheduled jobs from the Postgres job store until it is
+// interrupted, then lets running jobs finish
+func runWorker() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if os.Getenv("DATABASE_URL") == "" {
+		log.Fatalf("the job worker needs DATABASE_URL, so it shares jobs with the API")
+	}
+	stores := openStores(ctx)
+
+	events := loadEvents()
+	bus := openBus(ctx, events)
+	defer bus.Close()
+
+	// Functions run by jobs queue email in the store the API sends from
+	mailer := openMailer(ctx, stores.email, bus)
+	communication.SetEmailService(mailer)
+	go mailer.Run(ctx)
+
+	// Executions run by jobs are recorded in the history the API serves
+	registry := functions.InitializeRegistry()
+	registry.SetExecutionStore(stores.executions)
+	validateFunctions(registry)
+
+	worker := newWorker(stores.jobs, bus, events, jobs.NewScheduler(stores.jobs), registry)
+	log.Printf("job worker started")
+	if err := worker.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("job worker stopped: %v", err)
+	}
+	log.Printf("job worker stopped")
+}
+
+// newWorker creates a job worker that publishes scheduled events and runs
+// functions and async hooks with the tenant's event service
+func newWorker(store jobs.Store, bus pubsub.Bus, events map[string][]string, scheduler *jobs.Scheduler, registry *functions.FunctionRegistry) *jobs.Worker {
+	worker := jobs.NewWorker(store, jobs.Config{
+		Concurrency:       intEnv("JOB_CONCURRENCY"),
+		TenantConcurrency: intEnv("JOB_TENANT_CONCURRENCY"),
+	})
+	worker.Handle(jobs.KindEvent, jobs.EventHandler(bus))
+	// Tenant data lives in the platform API, so job functions run without a
+	// DataService and their data operations fail with ErrNoDataService
+	execCtx := func(job *jobs.Job) *types.ExecutionContext {
+		return &types.ExecutionContext{
+			TenantID:     job.TenantID,
+			RequestID:    job.ID,
+			Operation:    "job",
+			Logger:       functions.StdLogger{TenantID: job.TenantID, RequestID: job.ID},
+			EventService: jobs.NewEventService(bus, scheduler, job.TenantID),
+		}
+	}
+	worker.Handle(jobs.KindFunction, jobs.FunctionHandler(registry, execCtx))
+	worker.Handle(jobs.KindHook, jobs.HookHandler(registry, events, execCtx))
+	return worker
+}
+
+// intEnv reads an integer setting; unset is zero, which leaves the default
+// in place
+func intEnv(k string) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s must be an integer", k)
+	}
+	return n
+}
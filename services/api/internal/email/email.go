@@ -0,0 +1,296 @@
+// Package email sends templated email on behalf of tenants. Templates are
+// versioned per tenant, with platform defaults used when a tenant has not
+// defined its own. Sending renders the template and queues a delivery; a
+// Mailer worker hands queued deliveries to a Transport (SMTP in production,
+// a directory of .eml files or an in-memory mailbox for local development
+// and tests), retrying failures with backoff and publishing email.sent or
+// email.failed once the outcome is known.
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown templates and deliveries
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicate is returned when creating a delivery that already exists
+	ErrDuplicate = errors.New("already exists")
+)
+
+// DeliveryStatus is the state of a delivery
+type DeliveryStatus string
+
+// Delivery states
+const (
+	DeliveryQueued DeliveryStatus = "queued"
+	DeliverySent   DeliveryStatus = "sent"
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is one rendered email and the outcome of sending it. The body is
+// rendered when the email is queued, so retries send exactly the same
+// message even if the template changes in between.
+type Delivery struct {
+	ID              string         `json:"id"`
+	TenantID        string         `json:"tenant_id"`
+	Template        string         `json:"template"`
+	TemplateVersion int            `json:"template_version"`
+	From            string         `json:"from"`
+	To              string         `json:"to"`
+	Subject         string         `json:"subject"`
+	Status          DeliveryStatus `json:"status"`
+	Attempts        int            `json:"attempts"`
+	LastError       string         `json:"last_error,omitempty"`
+	NextAttemptAt   *time.Time     `json:"next_attempt_at,omitempty"`
+	SentAt          *time.Time     `json:"sent_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+
+	// Bodies can carry secrets such as reset links, so they are kept out of
+	// the delivery log
+	Text string `json:"-"`
+	HTML string `json:"-"`
+}
+
+// message returns the email a delivery sends
+func (d *Delivery) message() *Message {
+	return &Message{
+		ID:      d.ID,
+		From:    d.From,
+		To:      d.To,
+		Subject: d.Subject,
+		Text:    d.Text,
+		HTML:    d.HTML,
+	}
+}
+
+// Store persists templates and the delivery log
+type Store interface {
+	// CreateTemplate stores a new version of a template, setting its
+	// Version to one past the latest
+	CreateTemplate(ctx context.Context, tmpl *Template) error
+
+	// GetTemplate returns a version of a tenant's template; version 0
+	// returns the latest. Platform defaults have an empty tenant ID.
+	GetTemplate(ctx context.Context, tenantID, name string, version int) (*Template, error)
+
+	// ListTemplates returns the latest version of each of a tenant's
+	// templates, by name
+	ListTemplates(ctx context.Context, tenantID string) ([]*Template, error)
+
+	// ListTemplateVersions returns every version of a template, newest first
+	ListTemplateVersions(ctx context.Context, tenantID, name string) ([]*Template, error)
+
+	// CreateDelivery returns ErrDuplicate if the delivery ID exists
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+
+	// ListDeliveries returns a tenant's deliveries, newest first
+	ListDeliveries(ctx context.Context, tenantID string, limit int) ([]*Delivery, error)
+
+	// ClaimDueDeliveries returns queued deliveries due by now and pushes
+	// their next attempt back by lease, so concurrent workers skip them
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+}
+
+// MemoryStore is an in-memory Store. Records are copied in and out, so
+// callers never share state with the store.
+type MemoryStore struct {
+	mu         sync.Mutex
+	templates  map[templateKey][]*Template // oldest version first
+	deliveries map[string]*Delivery
+}
+
+type templateKey struct {
+	tenantID string
+	name     string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		templates:  make(map[templateKey][]*Template),
+		deliveries: make(map[string]*Delivery),
+	}
+}
+
+func copyTemplate(tmpl *Template) *Template {
+	copied := *tmpl
+	return &copied
+}
+
+func copyDelivery(delivery *Delivery) *Delivery {
+	copied := *delivery
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		copied.NextAttemptAt = &next
+	}
+	if delivery.SentAt != nil {
+		sentAt := *delivery.SentAt
+		copied.SentAt = &sentAt
+	}
+	return &copied
+}
+
+// CreateTemplate stores a new version of a template
+func (m *MemoryStore) CreateTemplate(ctx context.Context, tmpl *Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := templateKey{tmpl.TenantID, tmpl.Name}
+	tmpl.Version = len(m.templates[key]) + 1
+	m.templates[key] = append(m.templates[key], copyTemplate(tmpl))
+	return nil
+}
+
+// GetTemplate returns a version of a tenant's template
+func (m *MemoryStore) GetTemplate(ctx context.Context, tenantID, name string, version int) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := m.templates[templateKey{tenantID, name}]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, ErrNotFound
+	}
+	return copyTemplate(versions[version-1]), nil
+}
+
+// ListTemplates returns the latest version of each of a tenant's templates
+func (m *MemoryStore) ListTemplates(ctx context.Context, tenantID string) ([]*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var templates []*Template
+	for key, versions := range m.templates {
+		if key.tenantID == tenantID {
+			templates = append(templates, copyTemplate(versions[len(versions)-1]))
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// ListTemplateVersions returns every version of a template, newest first
+func (m *MemoryStore) ListTemplateVersions(ctx context.Context, tenantID, name string) ([]*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := m.templates[templateKey{tenantID, name}]
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	templates := make([]*Template, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		templates = append(templates, copyTemplate(versions[i]))
+	}
+	return templates, nil
+}
+
+// CreateDelivery stores a new delivery
+func (m *MemoryStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.deliveries[delivery.ID]; exists {
+		return ErrDuplicate
+	}
+	m.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// GetDelivery returns a tenant's delivery
+func (m *MemoryStore) GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, exists := m.deliveries[id]
+	if !exists || delivery.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	return copyDelivery(delivery), nil
+}
+
+// UpdateDelivery replaces a stored delivery
+func (m *MemoryStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.deliveries[delivery.ID]
+	if !exists || existing.TenantID != delivery.TenantID {
+		return ErrNotFound
+	}
+	m.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// ListDeliveries returns a tenant's deliveries, newest first
+func (m *MemoryStore) ListDeliveries(ctx context.Context, tenantID string, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []*Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.TenantID == tenantID {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].ID > deliveries[j].ID
+		}
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// ClaimDueDeliveries returns queued deliveries due by now, oldest first
+func (m *MemoryStore) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == DeliveryQueued && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Delivery, 0, len(due))
+	leaseUntil := now.Add(lease)
+	for _, delivery := range due {
+		delivery.NextAttemptAt = &leaseUntil
+		claimed = append(claimed, copyDelivery(delivery))
+	}
+	return claimed, nil
+}
+
+// validateName checks a template name
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	for _, c := range name {
+		if !(c == '_' || c == '-' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return fmt.Errorf("template name %q may only contain letters, digits, '_', '-' and '.'", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+)
+
+// Handler serves the email management API
+type Handler struct {
+	store  Store
+	mailer *Mailer
+}
+
+// NewHandler creates the management API
+func NewHandler(store Store, mailer *Mailer) *Handler {
+	return &Handler{store: store, mailer: mailer}
+}
+
+// Routes returns the API's routes, to be mounted under /email:
+//
+//	GET    /templates                            tenant's templates, latest versions
+//	POST   /templates                            create a template or a new version
+//	GET    /templates/{name}                     template in effect, tenant's or default
+//	GET    /templates/{name}/versions            tenant's versions, newest first
+//	GET    /templates/{name}/versions/{version}  one version
+//	POST   /templates/{name}/preview             render the template in effect
+//	GET    /deliveries                           delivery log, newest first
+//	GET    /deliveries/{id}                      get a delivery
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(httputil.RequireTenant)
+
+	r.Get("/templates", h.listTemplates)
+	r.Post("/templates", h.createTemplate)
+	r.Get("/templates/{name}", h.getTemplate)
+	r.Get("/templates/{name}/versions", h.listTemplateVersions)
+	r.Get("/templates/{name}/versions/{version}", h.getTemplateVersion)
+	r.Post("/templates/{name}/preview", h.previewTemplate)
+	r.Get("/deliveries", h.listDeliveries)
+	r.Get("/deliveries/{id}", h.getDelivery)
+
+	return r
+}
+
+// writeStoreError maps store errors to responses
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		httputil.WriteError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	httputil.WriteError(w, http.StatusInternalServerError, "Email store failed")
+}
+
+type templateRequest struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+func (h *Handler) listTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.store.ListTemplates(r.Context(), r.Header.Get(httputil.TenantHeader))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if templates == nil {
+		templates = []*Template{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": templates})
+}
+
+func (h *Handler) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, "Invalid JSON: name, subject and text or html are required")
+		return
+	}
+
+	tmpl := &Template{
+		TenantID:  r.Header.Get(httputil.TenantHeader),
+		Name:      req.Name,
+		Subject:   req.Subject,
+		Text:      req.Text,
+		HTML:      req.HTML,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := tmpl.Validate(); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.store.CreateTemplate(r.Context(), tmpl); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusCreated, map[string]interface{}{"data": tmpl})
+}
+
+func (h *Handler) getTemplate(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := h.mailer.Template(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "name"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": tmpl})
+}
+
+func (h *Handler) listTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.store.ListTemplateVersions(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "name"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": templates})
+}
+
+func (h *Handler) getTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version <= 0 {
+		httputil.WriteError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	tmpl, err := h.store.GetTemplate(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "name"), version)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": tmpl})
+}
+
+func (h *Handler) previewTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	tmpl, err := h.mailer.Template(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "name"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	rendered, err := tmpl.Render(req.Data)
+	if err != nil {
+		httputil.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": rendered, "version": tmpl.Version})
+}
+
+func (h *Handler) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			httputil.WriteError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if parsed > 1000 {
+			parsed = 1000
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.store.ListDeliveries(r.Context(), r.Header.Get(httputil.TenantHeader), limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*Delivery{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": deliveries})
+}
+
+func (h *Handler) getDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.store.GetDelivery(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": delivery})
+}
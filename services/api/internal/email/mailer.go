@@ -0,0 +1,301 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/retry"
+)
+
+// DefaultRetryPolicy retries for about a day before giving up
+var DefaultRetryPolicy = retry.Policy{
+	MaxAttempts:    8,
+	InitialBackoff: time.Minute,
+	MaxBackoff:     6 * time.Hour,
+}
+
+// Config configures a Mailer
+type Config struct {
+	// From is the sender of every email, e.g. "BackSaas <no-reply@backsaas.com>"
+	From string
+
+	// Retry spaces out attempts for each delivery; defaults to
+	// DefaultRetryPolicy
+	Retry retry.Policy
+
+	// SendTimeout bounds each attempt; defaults to 30s
+	SendTimeout time.Duration
+
+	// PollInterval is how often due deliveries are checked; defaults to 1s
+	PollInterval time.Duration
+
+	// BatchSize is how many due deliveries are attempted per poll;
+	// defaults to 50
+	BatchSize int
+
+	// Lease is how long a claimed delivery is hidden from other workers
+	// while it is attempted; defaults to 2m
+	Lease time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry = DefaultRetryPolicy
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = 30 * time.Second
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 50
+	}
+	if c.Lease <= 0 {
+		c.Lease = 2 * time.Minute
+	}
+	return c
+}
+
+// Mailer queues templated email and delivers it through a transport
+type Mailer struct {
+	store     Store
+	transport Transport
+	bus       pubsub.Bus
+	config    Config
+	now       func() time.Time
+}
+
+// NewMailer creates a mailer. Outcomes are published on bus as email.sent
+// and email.failed; bus may be nil.
+func NewMailer(store Store, transport Transport, bus pubsub.Bus, config Config) (*Mailer, error) {
+	config = config.withDefaults()
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+	return &Mailer{
+		store:     store,
+		transport: transport,
+		bus:       bus,
+		config:    config,
+		now:       time.Now,
+	}, nil
+}
+
+// InstallDefaults stores platform default templates. A default is only
+// stored when it differs from the latest stored version, so loading the
+// same file at every start does not pile up versions.
+func (m *Mailer) InstallDefaults(ctx context.Context, templates []*Template) error {
+	for _, tmpl := range templates {
+		latest, err := m.store.GetTemplate(ctx, "", tmpl.Name, 0)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if latest != nil && latest.Subject == tmpl.Subject && latest.Text == tmpl.Text && latest.HTML == tmpl.HTML {
+			continue
+		}
+
+		installed := *tmpl
+		installed.TenantID = ""
+		installed.CreatedAt = m.now().UTC()
+		if err := m.store.CreateTemplate(ctx, &installed); err != nil {
+			return fmt.Errorf("failed to install email template %s: %w", tmpl.Name, err)
+		}
+	}
+	return nil
+}
+
+// Template returns the template a tenant's sends use: the latest version of
+// the tenant's own template, or else the platform default
+func (m *Mailer) Template(ctx context.Context, tenantID, name string) (*Template, error) {
+	tmpl, err := m.store.GetTemplate(ctx, tenantID, name, 0)
+	if errors.Is(err, ErrNotFound) && tenantID != "" {
+		tmpl, err = m.store.GetTemplate(ctx, "", name, 0)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("email template %s: %w", name, ErrNotFound)
+	}
+	return tmpl, err
+}
+
+// Enqueue renders a template for a recipient and queues it for delivery.
+// Rendering errors, such as a missing variable, are returned here rather
+// than discovered by the worker.
+func (m *Mailer) Enqueue(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (*Delivery, error) {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+
+	tmpl, err := m.Template(ctx, tenantID, template)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := tmpl.Render(data)
+	if err != nil {
+		return nil, fmt.Errorf("email template %s v%d: %w", tmpl.Name, tmpl.Version, err)
+	}
+
+	now := m.now().UTC()
+	delivery := &Delivery{
+		ID:              newID(),
+		TenantID:        tenantID,
+		Template:        tmpl.Name,
+		TemplateVersion: tmpl.Version,
+		From:            m.config.From,
+		To:              recipient.String(),
+		Subject:         rendered.Subject,
+		Text:            rendered.Text,
+		HTML:            rendered.HTML,
+		Status:          DeliveryQueued,
+		NextAttemptAt:   &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := m.store.CreateDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to queue email: %w", err)
+	}
+	return delivery, nil
+}
+
+// SendTemplatedEmail queues an email and returns its delivery ID. It
+// implements communication.EmailService.
+func (m *Mailer) SendTemplatedEmail(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (string, error) {
+	delivery, err := m.Enqueue(ctx, tenantID, template, to, data)
+	if err != nil {
+		return "", err
+	}
+	return delivery.ID, nil
+}
+
+// Run attempts due deliveries until ctx is cancelled
+func (m *Mailer) Run(ctx context.Context) error {
+	for {
+		attempted, err := m.DeliverDue(ctx)
+		if err != nil {
+			log.Printf("Mailer failed: %v", err)
+		}
+
+		// Keep going while full batches are due
+		if err == nil && attempted == m.config.BatchSize {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(m.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// DeliverDue attempts one batch of due deliveries and returns how many were
+// attempted
+func (m *Mailer) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := m.store.ClaimDueDeliveries(ctx, m.now(), m.config.Lease, m.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, delivery := range deliveries {
+		if err := m.attempt(ctx, delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// attempt makes one delivery attempt, records its outcome and, once the
+// outcome is final, publishes it
+func (m *Mailer) attempt(ctx context.Context, delivery *Delivery) error {
+	sendCtx, cancel := context.WithTimeout(ctx, m.config.SendTimeout)
+	sendErr := m.transport.Send(sendCtx, delivery.message())
+	cancel()
+
+	now := m.now().UTC()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+
+	switch {
+	case sendErr == nil:
+		delivery.Status = DeliverySent
+		delivery.SentAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+	case IsPermanent(sendErr) || delivery.Attempts >= m.config.Retry.MaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.LastError = sendErr.Error()
+	default:
+		next := now.Add(m.config.Retry.Backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.LastError = sendErr.Error()
+	}
+
+	if err := m.store.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	switch delivery.Status {
+	case DeliverySent:
+		m.publish(ctx, delivery, "email.sent", map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"template":    delivery.Template,
+			"version":     delivery.TemplateVersion,
+			"to":          delivery.To,
+			"tenant_id":   delivery.TenantID,
+			"attempts":    delivery.Attempts,
+			"sent_at":     now,
+		})
+	case DeliveryFailed:
+		log.Printf("Email %s to %s failed after %d attempts: %s", delivery.ID, delivery.To, delivery.Attempts, delivery.LastError)
+		m.publish(ctx, delivery, "email.failed", map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"template":    delivery.Template,
+			"version":     delivery.TemplateVersion,
+			"to":          delivery.To,
+			"tenant_id":   delivery.TenantID,
+			"attempts":    delivery.Attempts,
+			"error":       delivery.LastError,
+			"failed_at":   now,
+		})
+	}
+	return nil
+}
+
+// publish reports a delivery's outcome on the bus. The delivery log already
+// holds the outcome, so a publish failure is only logged.
+func (m *Mailer) publish(ctx context.Context, delivery *Delivery, name string, data map[string]interface{}) {
+	if m.bus == nil {
+		return
+	}
+	err := m.bus.Publish(ctx, &pubsub.Event{
+		Name:     name,
+		TenantID: delivery.TenantID,
+		Data:     data,
+	})
+	if err != nil {
+		log.Printf("Failed to publish %s for email %s: %v", name, delivery.ID, err)
+	}
+}
+
+// newID returns a random identifier
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
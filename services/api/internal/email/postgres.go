@@ -0,0 +1,318 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresSchema creates the template and delivery tables. Template
+// versions are keyed by tenant, name and version, with platform defaults
+// under an empty tenant ID. Due deliveries are found through a partial index
+// on next_attempt_at.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS email_templates (
+	tenant_id  TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	version    INTEGER NOT NULL,
+	subject    TEXT NOT NULL,
+	text_body  TEXT NOT NULL DEFAULT '',
+	html_body  TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant_id, name, version)
+);
+
+CREATE TABLE IF NOT EXISTS email_deliveries (
+	id               TEXT PRIMARY KEY,
+	tenant_id        TEXT NOT NULL,
+	template         TEXT NOT NULL,
+	template_version INTEGER NOT NULL,
+	from_address     TEXT NOT NULL,
+	to_address       TEXT NOT NULL,
+	subject          TEXT NOT NULL,
+	text_body        TEXT NOT NULL DEFAULT '',
+	html_body        TEXT NOT NULL DEFAULT '',
+	status           TEXT NOT NULL,
+	attempts         INTEGER NOT NULL DEFAULT 0,
+	last_error       TEXT,
+	next_attempt_at  TIMESTAMPTZ,
+	sent_at          TIMESTAMPTZ,
+	created_at       TIMESTAMPTZ NOT NULL,
+	updated_at       TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS email_deliveries_due ON email_deliveries (next_attempt_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS email_deliveries_log ON email_deliveries (tenant_id, created_at DESC);
+`
+
+const templateColumns = `tenant_id, name, version, subject, text_body, html_body, created_at`
+
+const deliveryColumns = `id, tenant_id, template, template_version, from_address, to_address, subject,
+	text_body, html_body, status, attempts, last_error, next_attempt_at, sent_at, created_at, updated_at`
+
+// PostgresStore is a Store in Postgres tables, so templates and queued mail
+// survive restarts and are shared by the API and job workers. Workers claim
+// due deliveries with SELECT ... FOR UPDATE SKIP LOCKED, so they never send
+// the same delivery at once.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store over db. Call Migrate to create the
+// tables.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// OpenPostgresStore connects to the database at url and creates the email
+// tables if needed
+func OpenPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open email database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to email database: %w", err)
+	}
+	store := NewPostgresStore(db)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Migrate creates the email tables and their indexes
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("failed to create email tables: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTemplate(row scanner) (*Template, error) {
+	var tmpl Template
+	err := row.Scan(&tmpl.TenantID, &tmpl.Name, &tmpl.Version, &tmpl.Subject, &tmpl.Text, &tmpl.HTML, &tmpl.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl.CreatedAt = tmpl.CreatedAt.UTC()
+	return &tmpl, nil
+}
+
+func scanTemplates(rows *sql.Rows) ([]*Template, error) {
+	defer rows.Close()
+	var templates []*Template
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+func scanDelivery(row scanner) (*Delivery, error) {
+	var (
+		delivery      Delivery
+		lastError     sql.NullString
+		nextAttemptAt sql.NullTime
+		sentAt        sql.NullTime
+	)
+	err := row.Scan(&delivery.ID, &delivery.TenantID, &delivery.Template, &delivery.TemplateVersion,
+		&delivery.From, &delivery.To, &delivery.Subject, &delivery.Text, &delivery.HTML, &delivery.Status,
+		&delivery.Attempts, &lastError, &nextAttemptAt, &sentAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	delivery.LastError = lastError.String
+	delivery.CreatedAt, delivery.UpdatedAt = delivery.CreatedAt.UTC(), delivery.UpdatedAt.UTC()
+	if nextAttemptAt.Valid {
+		t := nextAttemptAt.Time.UTC()
+		delivery.NextAttemptAt = &t
+	}
+	if sentAt.Valid {
+		t := sentAt.Time.UTC()
+		delivery.SentAt = &t
+	}
+	return &delivery, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*Delivery, error) {
+	defer rows.Close()
+	var deliveries []*Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// isUniqueViolation reports whether err is a primary key conflict
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// CreateTemplate stores a new version of a template. Two writers can pick
+// the same next version, so the loser tries again with the one after.
+func (s *PostgresStore) CreateTemplate(ctx context.Context, tmpl *Template) error {
+	for attempt := 1; ; attempt++ {
+		err := s.db.QueryRowContext(ctx, `INSERT INTO email_templates (`+templateColumns+`)
+			SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+			FROM email_templates WHERE tenant_id = $1 AND name = $2
+			RETURNING version`,
+			tmpl.TenantID, tmpl.Name, tmpl.Subject, tmpl.Text, tmpl.HTML, tmpl.CreatedAt).Scan(&tmpl.Version)
+		if isUniqueViolation(err) && attempt < 5 {
+			continue
+		}
+		return err
+	}
+}
+
+// GetTemplate returns a version of a tenant's template
+func (s *PostgresStore) GetTemplate(ctx context.Context, tenantID, name string, version int) (*Template, error) {
+	if version == 0 {
+		return scanTemplate(s.db.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM email_templates
+			WHERE tenant_id = $1 AND name = $2 ORDER BY version DESC LIMIT 1`, tenantID, name))
+	}
+	return scanTemplate(s.db.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM email_templates
+		WHERE tenant_id = $1 AND name = $2 AND version = $3`, tenantID, name, version))
+}
+
+// ListTemplates returns the latest version of each of a tenant's templates
+func (s *PostgresStore) ListTemplates(ctx context.Context, tenantID string) ([]*Template, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT ON (name) `+templateColumns+`
+		FROM email_templates WHERE tenant_id = $1 ORDER BY name, version DESC`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTemplates(rows)
+}
+
+// ListTemplateVersions returns every version of a template, newest first
+func (s *PostgresStore) ListTemplateVersions(ctx context.Context, tenantID, name string) ([]*Template, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+templateColumns+` FROM email_templates
+		WHERE tenant_id = $1 AND name = $2 ORDER BY version DESC`, tenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := scanTemplates(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrNotFound
+	}
+	return templates, nil
+}
+
+// CreateDelivery stores a new delivery
+func (s *PostgresStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO email_deliveries (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		delivery.ID, delivery.TenantID, delivery.Template, delivery.TemplateVersion, delivery.From,
+		delivery.To, delivery.Subject, delivery.Text, delivery.HTML, delivery.Status, delivery.Attempts,
+		nullString(delivery.LastError), delivery.NextAttemptAt, delivery.SentAt, delivery.CreatedAt, delivery.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// GetDelivery returns a tenant's delivery
+func (s *PostgresStore) GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error) {
+	return scanDelivery(s.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+`
+		FROM email_deliveries WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+}
+
+// UpdateDelivery replaces a stored delivery's outcome. The rendered message
+// never changes once queued.
+func (s *PostgresStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE email_deliveries
+		SET status = $3, attempts = $4, last_error = $5, next_attempt_at = $6, sent_at = $7, updated_at = $8
+		WHERE tenant_id = $1 AND id = $2`,
+		delivery.TenantID, delivery.ID, delivery.Status, delivery.Attempts, nullString(delivery.LastError),
+		delivery.NextAttemptAt, delivery.SentAt, delivery.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns a tenant's deliveries, newest first
+func (s *PostgresStore) ListDeliveries(ctx context.Context, tenantID string, limit int) ([]*Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM email_deliveries
+		WHERE tenant_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		tenantID, sql.NullInt64{Int64: int64(limit), Valid: limit > 0})
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// ClaimDueDeliveries returns queued deliveries due by now, oldest first.
+// Candidates are locked with SKIP LOCKED, so deliveries another worker is
+// claiming are passed over.
+func (s *PostgresStore) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `UPDATE email_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM email_deliveries
+			WHERE status = 'queued' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns, now, now.Add(lease), sql.NullInt64{Int64: int64(limit), Valid: limit > 0})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	claimed, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the subquery's order, and the due times it
+	// ordered by were replaced by the lease, so order by creation instead
+	sort.Slice(claimed, func(i, j int) bool {
+		if claimed[i].CreatedAt.Equal(claimed[j].CreatedAt) {
+			return claimed[i].ID < claimed[j].ID
+		}
+		return claimed[i].CreatedAt.Before(claimed[j].CreatedAt)
+	})
+	return claimed, nil
+}
@@ -0,0 +1,154 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is one version of a named email. Subject, Text and HTML use Go
+// template syntax with the send's data as the dot:
+//
+//	subject: "Welcome to {{.tenant_name}}"
+//	html: "<p>Hi {{.name}}, <a href=\"{{.login_url}}\">sign in</a></p>"
+//
+// Values are escaped for their context in the HTML body, and every variable
+// a template uses must be supplied. At least one of Text and HTML is
+// required.
+type Template struct {
+	TenantID  string    `json:"tenant_id,omitempty" yaml:"-"` // empty for platform defaults
+	Name      string    `json:"name" yaml:"-"`
+	Version   int       `json:"version" yaml:"-"`
+	Subject   string    `json:"subject" yaml:"subject"`
+	Text      string    `json:"text,omitempty" yaml:"text"`
+	HTML      string    `json:"html,omitempty" yaml:"html"`
+	CreatedAt time.Time `json:"created_at" yaml:"-"`
+}
+
+// Rendered is a template filled in with data
+type Rendered struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text,omitempty"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Validate checks a template's name and that its parts parse
+func (t *Template) Validate() error {
+	if err := validateName(t.Name); err != nil {
+		return err
+	}
+	if strings.TrimSpace(t.Subject) == "" {
+		return fmt.Errorf("subject is required")
+	}
+	if t.Text == "" && t.HTML == "" {
+		return fmt.Errorf("a text or html body is required")
+	}
+	_, err := t.parse()
+	return err
+}
+
+// parsedTemplate holds a template's compiled parts
+type parsedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+func (t *Template) parse() (*parsedTemplate, error) {
+	parsed := &parsedTemplate{}
+	var err error
+	if parsed.subject, err = texttemplate.New("subject").Option("missingkey=error").Parse(t.Subject); err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+	if t.Text != "" {
+		if parsed.text, err = texttemplate.New("text").Option("missingkey=error").Parse(t.Text); err != nil {
+			return nil, fmt.Errorf("invalid text body: %w", err)
+		}
+	}
+	if t.HTML != "" {
+		if parsed.html, err = htmltemplate.New("html").Option("missingkey=error").Parse(t.HTML); err != nil {
+			return nil, fmt.Errorf("invalid html body: %w", err)
+		}
+	}
+	return parsed, nil
+}
+
+// Render fills in the template. The subject is collapsed onto one line.
+func (t *Template) Render(data map[string]interface{}) (*Rendered, error) {
+	parsed, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	var subject bytes.Buffer
+	if err := parsed.subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+	rendered := &Rendered{Subject: strings.Join(strings.Fields(subject.String()), " ")}
+
+	if parsed.text != nil {
+		var text bytes.Buffer
+		if err := parsed.text.Execute(&text, data); err != nil {
+			return nil, fmt.Errorf("failed to render text body: %w", err)
+		}
+		rendered.Text = text.String()
+	}
+	if parsed.html != nil {
+		var html bytes.Buffer
+		if err := parsed.html.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("failed to render html body: %w", err)
+		}
+		rendered.HTML = html.String()
+	}
+	return rendered, nil
+}
+
+// templateFile is the layout of a templates file
+type templateFile struct {
+	Templates map[string]*Template `yaml:"templates"`
+}
+
+// LoadTemplates reads platform default templates from a YAML file:
+//
+//	templates:
+//	  user_welcome:
+//	    subject: "Welcome, {{.name}}"
+//	    text: "..."
+//	    html: "..."
+//
+// The returned templates are validated and sorted by name.
+func LoadTemplates(path string) ([]*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email templates: %w", err)
+	}
+
+	var file templateFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse email templates: %w", err)
+	}
+
+	templates := make([]*Template, 0, len(file.Templates))
+	for name, tmpl := range file.Templates {
+		if tmpl == nil {
+			return nil, fmt.Errorf("email template %s is empty", name)
+		}
+		tmpl.Name = name
+		if err := tmpl.Validate(); err != nil {
+			return nil, fmt.Errorf("email template %s: %w", name, err)
+		}
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
@@ -3,17 +3,27 @@ package communication
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"time"
-	"bytes"
 	"encoding/json"
 	
+	"github.com/backsaas/platform/api/internal/retry"
 	"github.com/backsaas/platform/api/internal/types"
+	"github.com/backsaas/platform/api/internal/webhooks"
 )
 
-// EmailService interface for sending emails
+// EmailService queues templated emails; see email.Mailer
 type EmailService interface {
-	SendTemplatedEmail(template, to string, data map[string]interface{}) error
+	// SendTemplatedEmail renders a tenant's template and queues it,
+	// returning the delivery ID
+	SendTemplatedEmail(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (string, error)
+}
+
+// emailService delivers SendEmail's emails; set at startup
+var emailService EmailService
+
+// SetEmailService sets the service SendEmail queues emails with
+func SetEmailService(service EmailService) {
+	emailService = service
 }
 
 // WebhookClient interface for HTTP requests
@@ -21,7 +31,9 @@ type WebhookClient interface {
 	Post(url string, payload interface{}, timeout time.Duration) error
 }
 
-// SendEmail sends a templated email
+// SendEmail queues a templated email. The email is sent in the background
+// and retried if needed; email.sent or email.failed is published once the
+// outcome is known.
 func SendEmail(ctx context.Context, execCtx *types.ExecutionContext, template, to string, data map[string]interface{}) error {
 	// Validate email address
 	if to == "" {
@@ -33,6 +45,14 @@ func SendEmail(ctx context.Context, execCtx *types.ExecutionContext, template, t
 		return fmt.Errorf("email template is required")
 	}
 	
+	var service EmailService = emailService
+	if execCtx.EmailService != nil {
+		service = execCtx.EmailService
+	}
+	if service == nil {
+		return fmt.Errorf("email delivery is not configured")
+	}
+	
 	// Add tenant context to email data
 	emailData := make(map[string]interface{})
 	for k, v := range data {
@@ -40,33 +60,59 @@ func SendEmail(ctx context.Context, execCtx *types.ExecutionContext, template, t
 	}
 	emailData["tenant_id"] = execCtx.TenantID
 	
-	// TODO: Integrate with actual email service (SendGrid, AWS SES, etc.)
-	execCtx.Logger.Info("Email sent", map[string]interface{}{
-		"template":  template,
-		"to":        to,
-		"tenant_id": execCtx.TenantID,
-		"data":      emailData,
-	})
-	
-	// Publish email sent event
-	err := execCtx.EventService.Publish("email.sent", map[string]interface{}{
-		"template":  template,
-		"to":        to,
-		"tenant_id": execCtx.TenantID,
-		"sent_at":   time.Now().UTC(),
-	})
+	deliveryID, err := service.SendTemplatedEmail(ctx, execCtx.TenantID, template, to, emailData)
 	if err != nil {
-		execCtx.Logger.Error("Failed to publish email.sent event", err, map[string]interface{}{
-			"template": template,
-			"to":       to,
+		execCtx.Logger.Error("Failed to queue email", err, map[string]interface{}{
+			"template":  template,
+			"to":        to,
+			"tenant_id": execCtx.TenantID,
 		})
+		return fmt.Errorf("failed to queue email: %w", err)
 	}
 	
+	execCtx.Logger.Info("Email queued", map[string]interface{}{
+		"template":    template,
+		"to":          to,
+		"tenant_id":   execCtx.TenantID,
+		"delivery_id": deliveryID,
+	})
+	
 	return nil
 }
 
-// SendWebhook sends an HTTP webhook
-func SendWebhook(ctx context.Context, execCtx *types.ExecutionContext, url string, payload map[string]interface{}, timeout time.Duration) error {
+// webhookRetryPolicy bounds the retries SendWebhook makes within its timeout
+var webhookRetryPolicy = retry.Policy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// webhookSender posts SendWebhook requests. It refuses receivers on
+// loopback, private and link-local addresses; replaced in tests.
+var webhookSender = webhooks.NewSender(nil)
+
+// senderService is the process-wide WebhookService: webhookSender, retried
+// with webhookRetryPolicy
+type senderService struct{}
+
+// SendWebhook sends a signed webhook, returning the last attempt's status
+func (senderService) SendWebhook(ctx context.Context, url, secret, id string, body []byte) (int, error) {
+	attempts, err := webhookSender.SendWithRetry(ctx, webhooks.Message{
+		URL:    url,
+		Secret: secret,
+		ID:     id,
+		Body:   body,
+	}, webhookRetryPolicy)
+	if len(attempts) == 0 {
+		return 0, err
+	}
+	return attempts[len(attempts)-1].StatusCode, err
+}
+
+// SendWebhook sends an HTTP webhook, signed with secret when one is given
+// (see webhooks.Verify). Failed attempts are retried with backoff until
+// timeout, which bounds the whole call.
+func SendWebhook(ctx context.Context, execCtx *types.ExecutionContext, url string, payload map[string]interface{}, timeout time.Duration, secret string) error {
 	// Validate URL
 	if url == "" {
 		return fmt.Errorf("webhook URL is required")
@@ -84,11 +130,8 @@ func SendWebhook(ctx context.Context, execCtx *types.ExecutionContext, url strin
 	if timeout == 0 {
 		timeout = 30 * time.Second
 	}
-	
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
-	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 	
 	// Marshal payload to JSON
 	jsonPayload, err := json.Marshal(webhookPayload)
@@ -96,46 +139,31 @@ func SendWebhook(ctx context.Context, execCtx *types.ExecutionContext, url strin
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
 	
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return fmt.Errorf("failed to create webhook request: %w", err)
+	// Send, retrying failures
+	var service types.WebhookService = senderService{}
+	if execCtx.WebhookService != nil {
+		service = execCtx.WebhookService
 	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "BackSaas-Webhook/1.0")
-	
-	// Send request
-	resp, err := client.Do(req)
+	statusCode, err := service.SendWebhook(ctx, url, secret, execCtx.RequestID, jsonPayload)
 	if err != nil {
-		execCtx.Logger.Error("Webhook request failed", err, map[string]interface{}{
-			"url":       url,
-			"tenant_id": execCtx.TenantID,
-		})
-		return fmt.Errorf("webhook request failed: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	// Check response status
-	if resp.StatusCode >= 400 {
-		execCtx.Logger.Error("Webhook returned error status", nil, map[string]interface{}{
+		execCtx.Logger.Error("Webhook delivery failed", err, map[string]interface{}{
 			"url":         url,
-			"status_code": resp.StatusCode,
+			"status_code": statusCode,
 			"tenant_id":   execCtx.TenantID,
 		})
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		return err
 	}
 	
 	execCtx.Logger.Info("Webhook sent successfully", map[string]interface{}{
 		"url":         url,
-		"status_code": resp.StatusCode,
+		"status_code": statusCode,
 		"tenant_id":   execCtx.TenantID,
 	})
 	
 	// Publish webhook sent event
-	err = execCtx.EventService.Publish("webhook.sent", map[string]interface{}{
+	err = execCtx.EventService.Publish(ctx, "webhook.sent", map[string]interface{}{
 		"url":         url,
-		"status_code": resp.StatusCode,
+		"status_code": statusCode,
 		"tenant_id":   execCtx.TenantID,
 		"sent_at":     time.Now().UTC(),
 	})
@@ -2,10 +2,17 @@ package communication
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/backsaas/platform/api/internal/retry"
 	"github.com/backsaas/platform/api/internal/types"
+	"github.com/backsaas/platform/api/internal/webhooks"
 )
 
 // Mock logger for testing
@@ -105,11 +112,15 @@ func TestSendEmail(t *testing.T) {
 		},
 	}
 
+	defer SetEmailService(nil)
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create mock logger and event service
+			// Create mock logger, event and email services
 			mockLogger := &MockLogger{}
 			mockEventService := &MockEventService{}
+			mockEmailService := &MockEmailService{}
+			SetEmailService(mockEmailService)
 			
 			// Create execution context
 			execCtx := &types.ExecutionContext{
@@ -138,8 +149,8 @@ func TestSendEmail(t *testing.T) {
 					if log.Level != "info" {
 						t.Errorf("%s: expected info log level, got %s", tt.description, log.Level)
 					}
-					if log.Message != "Email sent" {
-						t.Errorf("%s: expected 'Email sent' message, got %s", tt.description, log.Message)
+					if log.Message != "Email queued" {
+						t.Errorf("%s: expected 'Email queued' message, got %s", tt.description, log.Message)
 					}
 					
 					// Verify log data contains expected fields
@@ -152,31 +163,88 @@ func TestSendEmail(t *testing.T) {
 					if log.Data["tenant_id"] != "test-tenant-123" {
 						t.Errorf("%s: expected tenant_id in log", tt.description)
 					}
+					if log.Data["delivery_id"] != "delivery-1" {
+						t.Errorf("%s: expected delivery_id in log, got %v", tt.description, log.Data["delivery_id"])
+					}
+				}
+				
+				// The email is queued with the tenant added to its data
+				if len(mockEmailService.sentEmails) != 1 || mockEmailService.sentEmails[0].Data["tenant_id"] != "test-tenant-123" {
+					t.Errorf("%s: expected one queued email with tenant_id, got %v", tt.description, mockEmailService.sentEmails)
+				}
+				
+				// email.sent is published by the mailer once the email is actually sent
+				if len(mockEventService.events) != 0 {
+					t.Errorf("%s: expected no events when queueing, got %v", tt.description, mockEventService.events)
 				}
 			}
 		})
 	}
+	
+	t.Run("NotConfigured", func(t *testing.T) {
+		SetEmailService(nil)
+		execCtx := &types.ExecutionContext{TenantID: "test-tenant-123", Logger: &MockLogger{}, EventService: &MockEventService{}}
+		if err := SendEmail(context.Background(), execCtx, "welcome", "test@example.com", nil); err == nil {
+			t.Error("Expected an error when email delivery is not configured")
+		}
+	})
 }
 
 func TestSendWebhook(t *testing.T) {
+	const secret = "whsec_test"
+
+	// The receiver verifies every signature and fails the first request to
+	// /flaky, so that case succeeds on retry
+	var flakyCalls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/unsigned" {
+			if err := webhooks.Verify(secret, r.Header, body, 0); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&flakyCalls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	retryPolicy := webhookRetryPolicy
+	webhookRetryPolicy = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer func() { webhookRetryPolicy = retryPolicy }()
+
+	// The receiver listens on loopback, which the default sender refuses
+	sender := webhookSender
+	webhookSender = webhooks.NewSender(http.DefaultClient)
+	defer func() { webhookSender = sender }()
+
 	tests := []struct {
 		name        string
 		url         string
 		payload     map[string]interface{}
 		timeout     time.Duration
+		secret      string
 		expectError bool
 		description string
 	}{
 		{
 			name: "ValidWebhook",
-			url:  "https://example.com/webhook",
+			url:  receiver.URL + "/webhook",
 			payload: map[string]interface{}{
 				"event": "user.created",
 				"data":  "test data",
 			},
 			timeout:     30 * time.Second,
+			secret:      secret,
 			expectError: false,
-			description: "Should send webhook successfully with valid parameters",
+			description: "Should send a signed webhook successfully with valid parameters",
 		},
 		{
 			name:        "EmptyURL",
@@ -188,14 +256,50 @@ func TestSendWebhook(t *testing.T) {
 		},
 		{
 			name: "ValidWebhookWithDefaultTimeout",
-			url:  "https://example.com/webhook",
+			url:  receiver.URL + "/webhook",
 			payload: map[string]interface{}{
 				"event": "user.updated",
 			},
 			timeout:     0, // Should use default timeout
+			secret:      secret,
 			expectError: false,
 			description: "Should use default timeout when timeout is 0",
 		},
+		{
+			name:        "UnsignedWebhook",
+			url:         receiver.URL + "/unsigned",
+			payload:     map[string]interface{}{},
+			timeout:     30 * time.Second,
+			expectError: false,
+			description: "Should send unsigned webhooks when no secret is given",
+		},
+		{
+			name:        "WrongSecret",
+			url:         receiver.URL + "/webhook",
+			payload:     map[string]interface{}{},
+			timeout:     30 * time.Second,
+			secret:      "whsec_other",
+			expectError: true,
+			description: "Should fail when the receiver rejects the signature",
+		},
+		{
+			name:        "RetriedWebhook",
+			url:         receiver.URL + "/flaky",
+			payload:     map[string]interface{}{},
+			timeout:     30 * time.Second,
+			secret:      secret,
+			expectError: false,
+			description: "Should retry a failed delivery",
+		},
+		{
+			name:        "FailingWebhook",
+			url:         receiver.URL + "/broken",
+			payload:     map[string]interface{}{},
+			timeout:     30 * time.Second,
+			secret:      secret,
+			expectError: true,
+			description: "Should fail once retries are exhausted",
+		},
 	}
 
 	for _, tt := range tests {
@@ -212,7 +316,7 @@ func TestSendWebhook(t *testing.T) {
 			}
 
 			// Execute SendWebhook
-			err := SendWebhook(context.Background(), execCtx, tt.url, tt.payload, tt.timeout)
+			err := SendWebhook(context.Background(), execCtx, tt.url, tt.payload, tt.timeout, tt.secret)
 
 			// Check error expectation
 			if tt.expectError && err == nil {
@@ -222,9 +326,10 @@ func TestSendWebhook(t *testing.T) {
 				t.Errorf("%s: unexpected error: %v", tt.description, err)
 			}
 
-			// Note: Since SendWebhook creates its own HTTP client and makes real requests,
-			// we can't easily test the actual HTTP call without more complex mocking.
-			// In a production environment, we'd inject the HTTP client as a dependency.
+			// Successful deliveries publish webhook.sent
+			if !tt.expectError && (len(mockEventService.events) != 1 || mockEventService.events[0].Event != "webhook.sent") {
+				t.Errorf("%s: expected a webhook.sent event, got %v", tt.description, mockEventService.events)
+			}
 		})
 	}
 }
@@ -256,13 +361,13 @@ type MockEmail struct {
 	Data     map[string]interface{}
 }
 
-func (m *MockEmailService) SendTemplatedEmail(template, to string, data map[string]interface{}) error {
+func (m *MockEmailService) SendTemplatedEmail(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (string, error) {
 	m.sentEmails = append(m.sentEmails, MockEmail{
 		Template: template,
 		To:       to,
 		Data:     data,
 	})
-	return nil
+	return fmt.Sprintf("delivery-%d", len(m.sentEmails)), nil
 }
 
 type MockWebhookClient struct {
@@ -293,7 +398,7 @@ type MockEvent struct {
 	Data  map[string]interface{}
 }
 
-func (m *MockEventService) Publish(event string, data map[string]interface{}) error {
+func (m *MockEventService) Publish(ctx context.Context, event string, data map[string]interface{}) error {
 	m.events = append(m.events, MockEvent{
 		Event: event,
 		Data:  data,
@@ -301,6 +406,10 @@ func (m *MockEventService) Publish(event string, data map[string]interface{}) er
 	return nil
 }
 
+func (m *MockEventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error {
+	return nil
+}
+
 // Benchmark tests
 func BenchmarkSendEmail(b *testing.B) {
 	mockLogger := &MockLogger{}
@@ -309,6 +418,9 @@ func BenchmarkSendEmail(b *testing.B) {
 		Logger:   mockLogger,
 	}
 
+	SetEmailService(&MockEmailService{})
+	defer SetEmailService(nil)
+
 	template := "welcome"
 	to := "benchmark@example.com"
 	data := map[string]interface{}{
@@ -322,13 +434,17 @@ func BenchmarkSendEmail(b *testing.B) {
 }
 
 func BenchmarkSendWebhook(b *testing.B) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
 	mockLogger := &MockLogger{}
 	execCtx := &types.ExecutionContext{
-		TenantID: "benchmark-tenant",
-		Logger:   mockLogger,
+		TenantID:     "benchmark-tenant",
+		Logger:       mockLogger,
+		EventService: &MockEventService{},
 	}
 
-	url := "https://example.com/webhook"
+	url := receiver.URL + "/webhook"
 	payload := map[string]interface{}{
 		"event": "benchmark.test",
 		"data":  "benchmark data",
@@ -337,8 +453,6 @@ func BenchmarkSendWebhook(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		// Note: This will make actual HTTP requests in benchmarks
-		// In production, we'd want to mock the HTTP client
-		SendWebhook(context.Background(), execCtx, url, payload, timeout)
+		SendWebhook(context.Background(), execCtx, url, payload, timeout, "whsec_benchmark")
 	}
 }
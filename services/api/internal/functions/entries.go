@@ -0,0 +1,154 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RegistryEntry is a function as declared in the system schema's
+// go_function_registry
+type RegistryEntry struct {
+	Package     string                   `yaml:"package"`
+	Function    string                   `yaml:"function"`
+	Description string                   `yaml:"description"`
+	Params      map[string]RegistryParam `yaml:"params"`
+	Returns     struct {
+		Type string `yaml:"type"`
+	} `yaml:"returns"`
+}
+
+// RegistryParam is a declared function param
+type RegistryParam struct {
+	Type     string      `yaml:"type"`
+	Required bool        `yaml:"required"`
+	Default  interface{} `yaml:"default"`
+}
+
+// LoadRegistryEntries reads the go_function_registry section of a schema
+// file
+func LoadRegistryEntries(path string) (map[string]*RegistryEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	var schema struct {
+		Registry map[string]*RegistryEntry `yaml:"go_function_registry"`
+	}
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return schema.Registry, nil
+}
+
+// ValidateEntries checks declared functions against the compiled ones: every
+// function must be declared and registered, with the same params, types,
+// required flags and defaults, and the same return type. All mismatches are
+// returned together.
+func (r *FunctionRegistry) ValidateEntries(entries map[string]*RegistryEntry) error {
+	registered := r.List()
+	names := make(map[string]bool, len(entries)+len(registered))
+	for name := range entries {
+		names[name] = true
+	}
+	for name := range registered {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var problems []error
+	for _, name := range sorted {
+		entry, def := entries[name], registered[name]
+		switch {
+		case entry == nil:
+			problems = append(problems, fmt.Errorf("%s: registered but not declared in go_function_registry", name))
+		case def == nil:
+			problems = append(problems, fmt.Errorf("%s: declared but not registered", name))
+		default:
+			for _, problem := range validateEntry(entry, def) {
+				problems = append(problems, fmt.Errorf("%s: %s", name, problem))
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// validateEntry returns how a declared function differs from the compiled one
+func validateEntry(entry *RegistryEntry, def *FunctionDefinition) []string {
+	var problems []string
+	if entry.Package != "" && entry.Package != def.Package {
+		problems = append(problems, fmt.Sprintf("package is %s, not %s", def.Package, entry.Package))
+	}
+	if entry.Function != "" && entry.Function != def.Function {
+		problems = append(problems, fmt.Sprintf("function is %s, not %s", def.Function, entry.Function))
+	}
+	if entry.Returns.Type != def.Returns.Type {
+		problems = append(problems, fmt.Sprintf("returns %s, not %s", def.Returns.Type, entry.Returns.Type))
+	}
+
+	declared := make(map[string]bool, len(entry.Params))
+	for _, field := range def.fields {
+		declared[field.name] = true
+		param, exists := entry.Params[field.name]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("param %s is not declared", field.name))
+			continue
+		}
+		if param.Type != field.definition.Type {
+			problems = append(problems, fmt.Sprintf("param %s is %s, not %s", field.name, field.definition.Type, param.Type))
+			continue
+		}
+		if param.Required != field.definition.Required {
+			problems = append(problems, fmt.Sprintf("param %s required is %t, not %t", field.name, field.definition.Required, param.Required))
+		}
+		defaultValue, err := coerce(param.Default, field.goType)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("param %s default: %v", field.name, err))
+			continue
+		}
+		if !sameDefault(defaultValue, field.definition.Default) {
+			problems = append(problems, fmt.Sprintf("param %s default is %v, not %v", field.name, field.definition.Default, param.Default))
+		}
+	}
+
+	var undeclared []string
+	for name := range entry.Params {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		problems = append(problems, fmt.Sprintf("param %s does not exist", name))
+	}
+	return problems
+}
+
+// sameDefault compares a declared default with a compiled one, treating
+// missing and empty defaults alike
+func sameDefault(declared reflect.Value, compiled interface{}) bool {
+	if compiled == nil {
+		return isEmpty(declared)
+	}
+	if isEmpty(declared) && isEmpty(reflect.ValueOf(compiled)) {
+		return true
+	}
+	return reflect.DeepEqual(declared.Interface(), compiled)
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
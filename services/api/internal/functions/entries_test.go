@@ -0,0 +1,80 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateEntries(t *testing.T) {
+	t.Run("SystemSchema", func(t *testing.T) {
+		entries, err := LoadRegistryEntries("../../system/schema/platform.yaml")
+		if err != nil {
+			t.Fatalf("Failed to load go_function_registry: %v", err)
+		}
+		if err := InitializeRegistry().ValidateEntries(entries); err != nil {
+			t.Errorf("Expected the system schema to match the registry:\n%v", err)
+		}
+	})
+
+	t.Run("Mismatches", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schema.yaml")
+		schema := `
+go_function_registry:
+  validate_email:
+    package: "validation"
+    function: "ValidateEmail"
+    params:
+      email: { type: "string", required: true }
+      allowed_domains: { type: "[]string" }
+    returns: { type: "bool" }
+  send_webhook:
+    package: "communication"
+    function: "PostWebhook"
+    params:
+      url: { type: "string", required: false }
+      payload: { type: "map[string]interface{}", required: true }
+      timeout: { type: "time.Duration", default: "10s" }
+      secret: { type: "int" }
+      retries: { type: "int" }
+    returns: { type: "error" }
+  calculate_age:
+    params:
+      birth_date: { type: "time.Time", required: true }
+    returns: { type: "string" }
+  send_sms:
+    params: {}
+    returns: { type: "error" }
+`
+		if err := os.WriteFile(path, []byte(schema), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := LoadRegistryEntries(path)
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+
+		err = InitializeRegistry().ValidateEntries(entries)
+		if err == nil {
+			t.Fatal("Expected mismatches")
+		}
+		for _, expected := range []string{
+			"calculate_age: returns int, not string",
+			"send_sms: declared but not registered",
+			"send_webhook: function is SendWebhook, not PostWebhook",
+			"send_webhook: param url required is true, not false",
+			"send_webhook: param timeout default is 30s, not 10s",
+			"send_webhook: param secret is string, not int",
+			"send_webhook: param retries does not exist",
+			"hash_password: registered but not declared in go_function_registry",
+		} {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected %q in:\n%v", expected, err)
+			}
+		}
+		if strings.Contains(err.Error(), "validate_email") {
+			t.Errorf("Expected validate_email to match, got:\n%v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package functions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+)
+
+// HistoryHandler serves a tenant's function execution history
+type HistoryHandler struct {
+	store ExecutionStore
+}
+
+// NewHistoryHandler creates the execution history API
+func NewHistoryHandler(store ExecutionStore) *HistoryHandler {
+	return &HistoryHandler{store: store}
+}
+
+// Routes returns the API's routes, to be mounted under /functions:
+//
+//	GET /executions         executions, newest first; filter with ?function=,
+//	                        ?entity=, ?status=, ?since= (RFC 3339) and ?limit=
+//	GET /executions/{id}    get an execution
+func (h *HistoryHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(httputil.RequireTenant)
+
+	r.Get("/executions", h.listExecutions)
+	r.Get("/executions/{id}", h.getExecution)
+
+	return r
+}
+
+func (h *HistoryHandler) listExecutions(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	query := ExecutionQuery{
+		FunctionName: values.Get("function"),
+		Entity:       values.Get("entity"),
+		Status:       ExecutionStatus(values.Get("status")),
+		Limit:        50,
+	}
+
+	switch query.Status {
+	case "", ExecutionRunning, ExecutionCompleted, ExecutionFailed, ExecutionTimeout:
+	default:
+		httputil.WriteError(w, http.StatusBadRequest, "status must be running, completed, failed or timeout")
+		return
+	}
+	if value := values.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			httputil.WriteError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		query.Since = since
+	}
+	if value := values.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			httputil.WriteError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if parsed > 1000 {
+			parsed = 1000
+		}
+		query.Limit = parsed
+	}
+
+	executions, err := h.store.ListExecutions(r.Context(), r.Header.Get(httputil.TenantHeader), query)
+	if err != nil {
+		httputil.WriteError(w, http.StatusInternalServerError, "Execution history failed")
+		return
+	}
+	if executions == nil {
+		executions = []*Execution{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": executions})
+}
+
+func (h *HistoryHandler) getExecution(w http.ResponseWriter, r *http.Request) {
+	execution, err := h.store.GetExecution(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrExecutionNotFound) {
+		httputil.WriteError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		httputil.WriteError(w, http.StatusInternalServerError, "Execution history failed")
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": execution})
+}
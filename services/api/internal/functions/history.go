@@ -0,0 +1,250 @@
+package functions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExecutionNotFound is returned for unknown executions
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// ExecutionStatus is the state of a function execution
+type ExecutionStatus string
+
+// Execution states, as declared by the function_executions entity
+const (
+	ExecutionRunning   ExecutionStatus = "running"
+	ExecutionCompleted ExecutionStatus = "completed"
+	ExecutionFailed    ExecutionStatus = "failed"
+	ExecutionTimeout   ExecutionStatus = "timeout"
+)
+
+// Execution is one run of a function, as kept in function_executions.
+// Params and results are redacted before they are recorded.
+type Execution struct {
+	ID              string                 `json:"id"`
+	TenantID        string                 `json:"tenant_id"`
+	FunctionName    string                 `json:"function_name"`
+	Entity          string                 `json:"entity,omitempty"`
+	Trigger         string                 `json:"trigger_event,omitempty"`
+	RequestID       string                 `json:"request_id,omitempty"`
+	UserID          string                 `json:"user_id,omitempty"`
+	Params          map[string]interface{} `json:"input_data"`
+	Result          interface{}            `json:"output_data,omitempty"`
+	Status          ExecutionStatus        `json:"status"`
+	Error           string                 `json:"error_message,omitempty"`
+	ExecutionTimeMS int64                  `json:"execution_time_ms"`
+	StartedAt       time.Time              `json:"started_at"`
+	CompletedAt     *time.Time             `json:"completed_at,omitempty"`
+}
+
+// ExecutionQuery filters a tenant's execution history
+type ExecutionQuery struct {
+	FunctionName string
+	Entity       string
+	Status       ExecutionStatus
+	Since        time.Time // zero for no lower bound
+	Limit        int       // zero for no limit
+}
+
+// matches reports whether an execution passes the query's filters
+func (q ExecutionQuery) matches(execution *Execution) bool {
+	return (q.FunctionName == "" || execution.FunctionName == q.FunctionName) &&
+		(q.Entity == "" || execution.Entity == q.Entity) &&
+		(q.Status == "" || execution.Status == q.Status) &&
+		(q.Since.IsZero() || !execution.StartedAt.Before(q.Since))
+}
+
+// ExecutionStore persists function execution history
+type ExecutionStore interface {
+	// CreateExecution records an execution as it starts
+	CreateExecution(ctx context.Context, execution *Execution) error
+
+	// UpdateExecution records an execution's outcome
+	UpdateExecution(ctx context.Context, execution *Execution) error
+
+	GetExecution(ctx context.Context, tenantID, id string) (*Execution, error)
+
+	// ListExecutions returns a tenant's executions matching query, newest
+	// first
+	ListExecutions(ctx context.Context, tenantID string, query ExecutionQuery) ([]*Execution, error)
+}
+
+// MemoryExecutionStore is an in-memory ExecutionStore that keeps the most
+// recent executions. Records are copied in and out, so callers never share
+// state with the store.
+type MemoryExecutionStore struct {
+	mu         sync.Mutex
+	executions map[string]*Execution
+	order      []string // IDs, oldest first
+	capacity   int
+}
+
+// NewMemoryExecutionStore creates a store keeping up to capacity
+// executions; zero keeps 10000
+func NewMemoryExecutionStore(capacity int) *MemoryExecutionStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryExecutionStore{
+		executions: make(map[string]*Execution),
+		capacity:   capacity,
+	}
+}
+
+func copyExecution(execution *Execution) *Execution {
+	copied := *execution
+	if execution.CompletedAt != nil {
+		completedAt := *execution.CompletedAt
+		copied.CompletedAt = &completedAt
+	}
+	// Params are redacted copies already, and never modified afterwards
+	return &copied
+}
+
+// CreateExecution stores a new execution, evicting the oldest when full
+func (m *MemoryExecutionStore) CreateExecution(ctx context.Context, execution *Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.executions[execution.ID]; exists {
+		return fmt.Errorf("execution %s already exists", execution.ID)
+	}
+	m.executions[execution.ID] = copyExecution(execution)
+	m.order = append(m.order, execution.ID)
+	for len(m.order) > m.capacity {
+		delete(m.executions, m.order[0])
+		m.order = m.order[1:]
+	}
+	return nil
+}
+
+// UpdateExecution replaces a stored execution
+func (m *MemoryExecutionStore) UpdateExecution(ctx context.Context, execution *Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.executions[execution.ID]
+	if !exists || existing.TenantID != execution.TenantID {
+		return ErrExecutionNotFound
+	}
+	m.executions[execution.ID] = copyExecution(execution)
+	return nil
+}
+
+// GetExecution returns a tenant's execution
+func (m *MemoryExecutionStore) GetExecution(ctx context.Context, tenantID, id string) (*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	execution, exists := m.executions[id]
+	if !exists || execution.TenantID != tenantID {
+		return nil, ErrExecutionNotFound
+	}
+	return copyExecution(execution), nil
+}
+
+// ListExecutions returns a tenant's executions matching query, newest first
+func (m *MemoryExecutionStore) ListExecutions(ctx context.Context, tenantID string, query ExecutionQuery) ([]*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var executions []*Execution
+	for _, execution := range m.executions {
+		if execution.TenantID == tenantID && query.matches(execution) {
+			executions = append(executions, copyExecution(execution))
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		if executions[i].StartedAt.Equal(executions[j].StartedAt) {
+			return executions[i].ID > executions[j].ID
+		}
+		return executions[i].StartedAt.After(executions[j].StartedAt)
+	})
+	if query.Limit > 0 && len(executions) > query.Limit {
+		executions = executions[:query.Limit]
+	}
+	return executions, nil
+}
+
+// redactedValue replaces secrets in recorded params and results
+const redactedValue = "[REDACTED]"
+
+// secretNames are parts of param and field names whose values are redacted
+// wherever they appear
+var secretNames = []string{"password", "secret", "token", "api_key", "apikey", "authorization", "credential", "private_key"}
+
+// isSecretName reports whether a name suggests its value is a secret
+func isSecretName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, secret := range secretNames {
+		if strings.Contains(lower, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactParams copies params for the execution history, replacing the values
+// of params the definition marks secret and of any field, at any depth,
+// whose name suggests a secret
+func redactParams(def *FunctionDefinition, params map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		if def.Params[name].Secret || isSecretName(name) {
+			redacted[name] = redactedValue
+			continue
+		}
+		redacted[name] = redactValue(value)
+	}
+	return redacted
+}
+
+// redactValue copies a value, redacting secret-named fields of nested maps
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			if isSecretName(name) {
+				redacted[name] = redactedValue
+				continue
+			}
+			redacted[name] = redactValue(field)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	case []map[string]interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// newExecutionID returns a random UUID, as function_executions keys are
+func newExecutionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,82 @@
+package functions
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CallParams builds a call's params from its config, as schemas write it for
+// hooks and validations: "<param>_field" keys take the param from that field
+// of the record, and {{...}} templates in string values are expanded against
+// the record
+func CallParams(def *FunctionDefinition, config, record map[string]interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		if param := strings.TrimSuffix(key, "_field"); param != key {
+			if _, declared := def.Params[key]; !declared {
+				if _, declared := def.Params[param]; declared {
+					field, ok := value.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s must name a field", key)
+					}
+					params[param] = record[field]
+					continue
+				}
+			}
+		}
+		params[key] = ExpandTemplates(value, record)
+	}
+	return params, nil
+}
+
+// templatePattern matches {{a || b || 'literal'}} placeholders
+var templatePattern = regexp.MustCompile(`\{\{\s*([^}]*?)\s*\}\}`)
+
+// ExpandTemplates replaces templates in a config value with record fields.
+// A string that is a single template takes the field's value as is;
+// templates within longer strings are interpolated.
+func ExpandTemplates(value interface{}, record map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if match := templatePattern.FindStringSubmatchIndex(v); match != nil && match[0] == 0 && match[1] == len(v) {
+			return lookup(v[match[2]:match[3]], record)
+		}
+		return templatePattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+			value := lookup(templatePattern.FindStringSubmatch(placeholder)[1], record)
+			if value == nil {
+				return ""
+			}
+			return fmt.Sprint(value)
+		})
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for k, field := range v {
+			expanded[k] = ExpandTemplates(field, record)
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded[i] = ExpandTemplates(item, record)
+		}
+		return expanded
+	default:
+		return value
+	}
+}
+
+// lookup evaluates "a || b || 'literal'", returning the first field that is
+// set and not empty
+func lookup(expression string, record map[string]interface{}) interface{} {
+	for _, alternative := range strings.Split(expression, "||") {
+		alternative = strings.TrimSpace(alternative)
+		if len(alternative) >= 2 && (alternative[0] == '\'' || alternative[0] == '"') && alternative[len(alternative)-1] == alternative[0] {
+			return alternative[1 : len(alternative)-1]
+		}
+		if value, exists := record[alternative]; exists && value != nil && value != "" {
+			return value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package functions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	record := map[string]interface{}{"name": "Ada", "email": "ada@example.com", "age": 36, "empty": ""}
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"Plain", "hello", "hello"},
+		{"WholeTemplateKeepsType", "{{age}}", 36},
+		{"Interpolated", "{{name}} is {{age}}", "Ada is 36"},
+		{"Fallback", "{{empty || email}}", "ada@example.com"},
+		{"Literal", "{{missing || 'nobody'}}", "nobody"},
+		{"Missing", "{{missing}}", nil},
+		{"Nested", map[string]interface{}{"to": []interface{}{"{{email}}"}}, map[string]interface{}{"to": []interface{}{"ada@example.com"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExpandTemplates(tc.value, record); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCallParams(t *testing.T) {
+	def := &FunctionDefinition{
+		Name: "send_email",
+		Params: map[string]ParamDefinition{
+			"to":       {Type: "string", Required: true},
+			"template": {Type: "string", Required: true},
+			"data":     {Type: "object"},
+		},
+	}
+	record := map[string]interface{}{"email": "ada@example.com", "name": "Ada"}
+	config := map[string]interface{}{
+		"template": "user_welcome",
+		"to_field": "email",
+		"data":     map[string]interface{}{"name": "{{name || email}}"},
+	}
+
+	params, err := CallParams(def, config, record)
+	if err != nil {
+		t.Fatalf("CallParams failed: %v", err)
+	}
+	expected := map[string]interface{}{
+		"template": "user_welcome",
+		"to":       "ada@example.com",
+		"data":     map[string]interface{}{"name": "Ada"},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %v, got %v", expected, params)
+	}
+
+	if _, err := CallParams(def, map[string]interface{}{"to_field": 1}, record); err == nil {
+		t.Error("Expected an error for a field param that isn't a field name")
+	}
+}
@@ -1,255 +1,224 @@
 package functions
 
 import (
-	"reflect"
+	"context"
 	"time"
 
-	"github.com/backsaas/platform/api/internal/functions/validation"
-	"github.com/backsaas/platform/api/internal/functions/security"
 	"github.com/backsaas/platform/api/internal/functions/communication"
+	"github.com/backsaas/platform/api/internal/functions/security"
+	"github.com/backsaas/platform/api/internal/functions/utils"
+	"github.com/backsaas/platform/api/internal/functions/validation"
+	"github.com/backsaas/platform/api/internal/types"
 )
 
 // InitializeRegistry creates and populates the function registry with all available functions
 func InitializeRegistry() *FunctionRegistry {
 	registry := NewFunctionRegistry()
-	
+
 	// Register validation functions
 	registerValidationFunctions(registry)
-	
+
 	// Register security functions
 	registerSecurityFunctions(registry)
-	
+
 	// Register communication functions
 	registerCommunicationFunctions(registry)
-	
+
 	// Register utility functions
 	registerUtilityFunctions(registry)
-	
+
 	return registry
 }
 
+// mustRegister panics when a built-in function can't be registered, which
+// only happens when its param struct is malformed
+func mustRegister(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+type validateEmailParams struct {
+	Email          string   `param:"email,required"`
+	AllowedDomains []string `param:"allowed_domains"`
+}
+
+type validatePasswordParams struct {
+	Password         string `param:"password,required,secret"`
+	MinLength        int    `param:"min_length" default:"8"`
+	RequireUppercase bool   `param:"require_uppercase" default:"true"`
+	RequireNumbers   bool   `param:"require_numbers" default:"true"`
+	RequireSymbols   bool   `param:"require_symbols" default:"false"`
+}
+
+type validatePhoneParams struct {
+	Phone       string `param:"phone,required"`
+	CountryCode string `param:"country_code"`
+}
+
 // registerValidationFunctions registers all validation functions
 func registerValidationFunctions(registry *FunctionRegistry) {
 	// validate_email
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "validate_email",
 		Package:     "validation",
 		Function:    "ValidateEmail",
 		Description: "Validate email format and domain restrictions",
-		Params: map[string]ParamDefinition{
-			"email": {
-				Type:     "string",
-				Required: true,
-			},
-			"allowed_domains": {
-				Type:     "[]string",
-				Required: false,
-				Default:  []string{},
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "bool",
-		},
-		Handler: reflect.ValueOf(validation.ValidateEmail),
-	})
-	
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p validateEmailParams) (bool, error) {
+		return validation.ValidateEmail(ctx, execCtx, p.Email, p.AllowedDomains)
+	}))
+
 	// validate_password
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "validate_password",
 		Package:     "validation",
 		Function:    "ValidatePassword",
 		Description: "Validate password strength requirements",
-		Params: map[string]ParamDefinition{
-			"password": {
-				Type:     "string",
-				Required: true,
-			},
-			"min_length": {
-				Type:     "int",
-				Required: false,
-				Default:  8,
-			},
-			"require_uppercase": {
-				Type:     "bool",
-				Required: false,
-				Default:  true,
-			},
-			"require_numbers": {
-				Type:     "bool",
-				Required: false,
-				Default:  true,
-			},
-			"require_symbols": {
-				Type:     "bool",
-				Required: false,
-				Default:  false,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "bool",
-		},
-		Handler: reflect.ValueOf(validation.ValidatePassword),
-	})
-	
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p validatePasswordParams) (bool, error) {
+		return validation.ValidatePassword(ctx, execCtx, p.Password, p.MinLength, p.RequireUppercase, p.RequireNumbers, p.RequireSymbols)
+	}))
+
 	// validate_phone
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "validate_phone",
 		Package:     "validation",
 		Function:    "ValidatePhone",
 		Description: "Validate phone number format",
-		Params: map[string]ParamDefinition{
-			"phone": {
-				Type:     "string",
-				Required: true,
-			},
-			"country_code": {
-				Type:     "string",
-				Required: false,
-				Default:  "",
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "bool",
-		},
-		Handler: reflect.ValueOf(validation.ValidatePhone),
-	})
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p validatePhoneParams) (bool, error) {
+		return validation.ValidatePhone(ctx, execCtx, p.Phone, p.CountryCode)
+	}))
+}
+
+type hashPasswordParams struct {
+	Password string `param:"password,required,secret"`
+}
+
+type generateAPIKeyParams struct {
+	Prefix string `param:"prefix" default:"bks"`
+	Length int    `param:"length" default:"32"`
+}
+
+type generateSlugParams struct {
+	Text            string   `param:"text,required"`
+	MaxLength       int      `param:"max_length" default:"50"`
+	ReservedWords   []string `param:"reserved_words"`
+	CheckUniqueness bool     `param:"check_uniqueness" default:"false"`
 }
 
 // registerSecurityFunctions registers all security functions
 func registerSecurityFunctions(registry *FunctionRegistry) {
 	// hash_password
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "hash_password",
 		Package:     "security",
 		Function:    "HashPassword",
 		Description: "Hash password using bcrypt",
-		Params: map[string]ParamDefinition{
-			"password": {
-				Type:     "string",
-				Required: true,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "string",
-		},
-		Handler: reflect.ValueOf(security.HashPassword),
-	})
-	
+		Returns:     ReturnDefinition{Secret: true},
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p hashPasswordParams) (string, error) {
+		return security.HashPassword(ctx, execCtx, p.Password)
+	}))
+
 	// generate_api_key
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "generate_api_key",
 		Package:     "security",
 		Function:    "GenerateAPIKey",
 		Description: "Generate cryptographically secure API key",
-		Params: map[string]ParamDefinition{
-			"prefix": {
-				Type:     "string",
-				Required: false,
-				Default:  "bks",
-			},
-			"length": {
-				Type:     "int",
-				Required: false,
-				Default:  32,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "string",
-		},
-		Handler: reflect.ValueOf(security.GenerateAPIKey),
-	})
-	
+		Returns:     ReturnDefinition{Secret: true},
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p generateAPIKeyParams) (string, error) {
+		return security.GenerateAPIKey(ctx, execCtx, p.Prefix, p.Length)
+	}))
+
 	// generate_slug
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
 		Name:        "generate_slug",
 		Package:     "security",
 		Function:    "GenerateSlug",
 		Description: "Generate URL-safe slug from text",
-		Params: map[string]ParamDefinition{
-			"text": {
-				Type:     "string",
-				Required: true,
-			},
-			"max_length": {
-				Type:     "int",
-				Required: false,
-				Default:  50,
-			},
-			"reserved_words": {
-				Type:     "[]string",
-				Required: false,
-				Default:  []string{},
-			},
-			"check_uniqueness": {
-				Type:     "bool",
-				Required: false,
-				Default:  false,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "string",
-		},
-		Handler: reflect.ValueOf(security.GenerateSlug),
-	})
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p generateSlugParams) (string, error) {
+		return security.GenerateSlug(ctx, execCtx, p.Text, p.MaxLength, p.ReservedWords, p.CheckUniqueness)
+	}))
+}
+
+type sendEmailParams struct {
+	Template string                 `param:"template,required"`
+	To       string                 `param:"to,required"`
+	Data     map[string]interface{} `param:"data,required"`
+}
+
+type sendWebhookParams struct {
+	URL     string                 `param:"url,required"`
+	Payload map[string]interface{} `param:"payload,required"`
+	Timeout time.Duration          `param:"timeout" default:"30s"`
+	Secret  string                 `param:"secret,secret"`
 }
 
 // registerCommunicationFunctions registers all communication functions
 func registerCommunicationFunctions(registry *FunctionRegistry) {
 	// send_email
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterAction(registry, FunctionDefinition{
 		Name:        "send_email",
 		Package:     "communication",
 		Function:    "SendEmail",
 		Description: "Send templated email",
-		Params: map[string]ParamDefinition{
-			"template": {
-				Type:     "string",
-				Required: true,
-			},
-			"to": {
-				Type:     "string",
-				Required: true,
-			},
-			"data": {
-				Type:     "map[string]interface{}",
-				Required: true,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "error",
-		},
-		Handler: reflect.ValueOf(communication.SendEmail),
-	})
-	
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p sendEmailParams) error {
+		return communication.SendEmail(ctx, execCtx, p.Template, p.To, p.Data)
+	}))
+
 	// send_webhook
-	registry.Register(&FunctionDefinition{
+	mustRegister(RegisterAction(registry, FunctionDefinition{
 		Name:        "send_webhook",
 		Package:     "communication",
 		Function:    "SendWebhook",
-		Description: "Send HTTP webhook",
-		Params: map[string]ParamDefinition{
-			"url": {
-				Type:     "string",
-				Required: true,
-			},
-			"payload": {
-				Type:     "map[string]interface{}",
-				Required: true,
-			},
-			"timeout": {
-				Type:     "time.Duration",
-				Required: false,
-				Default:  30 * time.Second,
-			},
-		},
-		Returns: ReturnDefinition{
-			Type: "error",
-		},
-		Handler: reflect.ValueOf(communication.SendWebhook),
-	})
+		Description: "Send HTTP webhook, signed when a secret is given",
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p sendWebhookParams) error {
+		return communication.SendWebhook(ctx, execCtx, p.URL, p.Payload, p.Timeout, p.Secret)
+	}))
+}
+
+type formatCurrencyParams struct {
+	Amount   float64 `param:"amount,required"`
+	Currency string  `param:"currency,required"`
+}
+
+type parseDateParams struct {
+	DateString string `param:"date_string,required"`
+	Format     string `param:"format" default:"2006-01-02"`
+}
+
+type calculateAgeParams struct {
+	BirthDate time.Time `param:"birth_date,required"`
 }
 
 // registerUtilityFunctions registers all utility functions
 func registerUtilityFunctions(registry *FunctionRegistry) {
-	// TODO: Add utility functions like format_currency, parse_date, calculate_age
+	// format_currency
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
+		Name:        "format_currency",
+		Package:     "utils",
+		Function:    "FormatCurrency",
+		Description: "Format amount as currency",
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p formatCurrencyParams) (string, error) {
+		return utils.FormatCurrency(ctx, execCtx, p.Amount, p.Currency)
+	}))
+
+	// parse_date
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
+		Name:        "parse_date",
+		Package:     "utils",
+		Function:    "ParseDate",
+		Description: "Parse date string safely",
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p parseDateParams) (time.Time, error) {
+		return utils.ParseDate(ctx, execCtx, p.DateString, p.Format)
+	}))
+
+	// calculate_age
+	mustRegister(RegisterFunc(registry, FunctionDefinition{
+		Name:        "calculate_age",
+		Package:     "utils",
+		Function:    "CalculateAge",
+		Description: "Calculate age from birth date",
+	}, func(ctx context.Context, execCtx *types.ExecutionContext, p calculateAgeParams) (int, error) {
+		return utils.CalculateAge(ctx, execCtx, p.BirthDate)
+	}))
 }
@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// StdLogger writes function logs through the standard logger, tagged with
+// the tenant and request they came from. It implements types.Logger.
+type StdLogger struct {
+	TenantID  string
+	RequestID string
+}
+
+// Info logs an informational message
+func (l StdLogger) Info(msg string, fields map[string]interface{}) {
+	l.log("INFO", msg, nil, fields)
+}
+
+// Warn logs a warning
+func (l StdLogger) Warn(msg string, fields map[string]interface{}) {
+	l.log("WARN", msg, nil, fields)
+}
+
+// Error logs a failure
+func (l StdLogger) Error(msg string, err error, fields map[string]interface{}) {
+	l.log("ERROR", msg, err, fields)
+}
+
+func (l StdLogger) log(level, msg string, err error, fields map[string]interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [tenant=%s request=%s] %s", level, l.TenantID, l.RequestID, msg)
+	if err != nil {
+		fmt.Fprintf(&b, ": %v", err)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%v", name, fields[name])
+	}
+	log.Print(b.String())
+}
@@ -0,0 +1,361 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+// RegisterFunc registers fn under def.Name. The function's params are the
+// fields of its param struct P, named by `param` tags:
+//
+//	type sendWebhookParams struct {
+//		URL     string                 `param:"url,required"`
+//		Payload map[string]interface{} `param:"payload,required"`
+//		Timeout time.Duration          `param:"timeout" default:"30s"`
+//		Secret  string                 `param:"secret,secret"`
+//	}
+//
+// The `required` option rejects calls without the param and `secret`
+// redacts it from execution history. A `default` tag is parsed as YAML,
+// except for string params, which take it as is.
+// def.Params and def.Returns.Type are derived from P and R; the rest of def
+// is kept.
+func RegisterFunc[P, R any](
+	registry *FunctionRegistry,
+	def FunctionDefinition,
+	fn func(ctx context.Context, execCtx *types.ExecutionContext, params P) (R, error),
+) error {
+	return register(registry, def, typeName(reflect.TypeOf((*R)(nil)).Elem()), func(ctx context.Context, execCtx *types.ExecutionContext, params P) (interface{}, error) {
+		result, err := fn(ctx, execCtx, params)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+}
+
+// RegisterAction registers a function that returns only an error, such as
+// send_email; see RegisterFunc
+func RegisterAction[P any](
+	registry *FunctionRegistry,
+	def FunctionDefinition,
+	fn func(ctx context.Context, execCtx *types.ExecutionContext, params P) error,
+) error {
+	return register(registry, def, "error", func(ctx context.Context, execCtx *types.ExecutionContext, params P) (interface{}, error) {
+		return nil, fn(ctx, execCtx, params)
+	})
+}
+
+func register[P any](
+	registry *FunctionRegistry,
+	def FunctionDefinition,
+	returnType string,
+	fn func(ctx context.Context, execCtx *types.ExecutionContext, params P) (interface{}, error),
+) error {
+	fields, err := paramFields[P]()
+	if err != nil {
+		return fmt.Errorf("function %s: %w", def.Name, err)
+	}
+	def.fields = fields
+	def.Params = paramDefinitions(fields)
+	def.Returns.Type = returnType
+	def.bind = func(params map[string]interface{}) (boundCall, error) {
+		p, err := decodeParams[P](fields, params)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, execCtx *types.ExecutionContext) (interface{}, error) {
+			return fn(ctx, execCtx, p)
+		}, nil
+	}
+	return registry.Register(&def)
+}
+
+// boundCall is a function call with its params decoded
+type boundCall func(ctx context.Context, execCtx *types.ExecutionContext) (interface{}, error)
+
+// paramField is a param and the param struct field it is decoded into
+type paramField struct {
+	name       string
+	index      int
+	goType     reflect.Type
+	definition ParamDefinition
+}
+
+// paramFields derives a param struct's params from its tags, in field order
+func paramFields[P any]() ([]paramField, error) {
+	t := reflect.TypeOf((*P)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params must be a struct, not %s", t)
+	}
+
+	var fields []paramField
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag, tagged := structField.Tag.Lookup("param")
+		if tag == "-" {
+			continue
+		}
+		if !tagged || !structField.IsExported() {
+			return nil, fmt.Errorf("field %s needs a param tag and must be exported", structField.Name)
+		}
+
+		options := strings.Split(tag, ",")
+		field := paramField{
+			name:       options[0],
+			index:      i,
+			goType:     structField.Type,
+			definition: ParamDefinition{Type: typeName(structField.Type)},
+		}
+		if field.name == "" || seen[field.name] {
+			return nil, fmt.Errorf("field %s has a missing or duplicate param name", structField.Name)
+		}
+		seen[field.name] = true
+		for _, option := range options[1:] {
+			switch option {
+			case "required":
+				field.definition.Required = true
+			case "secret":
+				field.definition.Secret = true
+			default:
+				return nil, fmt.Errorf("param %s: unknown option %q", field.name, option)
+			}
+		}
+
+		if value, hasDefault := structField.Tag.Lookup("default"); hasDefault {
+			if field.definition.Required {
+				return nil, fmt.Errorf("param %s: required params can't have a default", field.name)
+			}
+			var parsed interface{} = value
+			if structField.Type.Kind() != reflect.String {
+				if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+					return nil, fmt.Errorf("param %s: invalid default: %w", field.name, err)
+				}
+			}
+			converted, err := coerce(parsed, field.goType)
+			if err != nil {
+				return nil, fmt.Errorf("param %s: invalid default: %w", field.name, err)
+			}
+			field.definition.Default = converted.Interface()
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func paramDefinitions(fields []paramField) map[string]ParamDefinition {
+	definitions := make(map[string]ParamDefinition, len(fields))
+	for _, field := range fields {
+		definitions[field.name] = field.definition
+	}
+	return definitions
+}
+
+// decodeParams builds a param struct from JSON-like params, applying
+// defaults and converting values to the fields' types
+func decodeParams[P any](fields []paramField, params map[string]interface{}) (P, error) {
+	var p P
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.name] = true
+	}
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return p, fmt.Errorf("unknown parameter %s", strings.Join(unknown, ", "))
+	}
+
+	v := reflect.ValueOf(&p).Elem()
+	for _, field := range fields {
+		value := params[field.name]
+		if value == nil {
+			if field.definition.Required {
+				return p, fmt.Errorf("required parameter %s missing", field.name)
+			}
+			value = field.definition.Default
+		}
+		converted, err := coerce(value, field.goType)
+		if err != nil {
+			return p, fmt.Errorf("parameter %s: %w", field.name, err)
+		}
+		v.Field(field.index).Set(converted)
+	}
+	return p, nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// coerce converts a value decoded from JSON or YAML to t. Numbers convert
+// between numeric types when no precision is lost, durations are parsed
+// from strings such as "30s" (numbers are seconds), times from RFC 3339
+// timestamps or dates, and slices and maps element by element. Anything
+// else must already be assignable to t.
+func coerce(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid number %s", number)
+		}
+		return coerce(f, t)
+	}
+
+	switch t {
+	case durationType:
+		switch {
+		case v.Kind() == reflect.String:
+			d, err := time.ParseDuration(v.String())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("invalid duration %q", v.String())
+			}
+			return reflect.ValueOf(d), nil
+		case isNumber(v):
+			return reflect.ValueOf(time.Duration(toFloat(v) * float64(time.Second))), nil
+		}
+	case timeType:
+		if v.Kind() == reflect.String {
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+				if parsed, err := time.Parse(layout, v.String()); err == nil {
+					return reflect.ValueOf(parsed), nil
+				}
+			}
+			return reflect.Value{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", v.String())
+		}
+	}
+
+	converted := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		if v.Kind() == reflect.String {
+			converted.SetString(v.String())
+			return converted, nil
+		}
+	case reflect.Bool:
+		if v.Kind() == reflect.Bool {
+			converted.SetBool(v.Bool())
+			return converted, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isNumber(v) {
+			f := toFloat(v)
+			if f != math.Trunc(f) || converted.OverflowInt(int64(f)) {
+				return reflect.Value{}, fmt.Errorf("%v is not a valid %s", value, t)
+			}
+			converted.SetInt(int64(f))
+			return converted, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isNumber(v) {
+			f := toFloat(v)
+			if f != math.Trunc(f) || f < 0 || converted.OverflowUint(uint64(f)) {
+				return reflect.Value{}, fmt.Errorf("%v is not a valid %s", value, t)
+			}
+			converted.SetUint(uint64(f))
+			return converted, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if isNumber(v) {
+			converted.SetFloat(toFloat(v))
+			return converted, nil
+		}
+	case reflect.Slice:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			converted = reflect.MakeSlice(t, v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				item, err := coerce(v.Index(i).Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+				}
+				converted.Index(i).Set(item)
+			}
+			return converted, nil
+		}
+	case reflect.Map:
+		if v.Kind() == reflect.Map && t.Key().Kind() == reflect.String && v.Type().Key().Kind() == reflect.String {
+			converted = reflect.MakeMapWithSize(t, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				item, err := coerce(iter.Value().Interface(), t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("%s: %w", iter.Key().String(), err)
+				}
+				converted.SetMapIndex(iter.Key().Convert(t.Key()), item)
+			}
+			return converted, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", describe(value), typeName(t))
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// describe names a value's JSON type for error messages
+func describe(value interface{}) string {
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("string %q", value)
+	case isNumber(v):
+		return fmt.Sprintf("number %v", value)
+	case v.Kind() == reflect.Bool:
+		return fmt.Sprintf("boolean %v", value)
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		return "array"
+	case v.Kind() == reflect.Map:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// typeName is how go_function_registry spells a Go type
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return "interface{}"
+	}
+	return strings.ReplaceAll(t.String(), "interface {}", "interface{}")
+}
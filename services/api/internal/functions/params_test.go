@@ -0,0 +1,178 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+type typedParams struct {
+	Name     string            `param:"name,required"`
+	Count    int               `param:"count" default:"3"`
+	Ratio    float64           `param:"ratio"`
+	Enabled  bool              `param:"enabled" default:"true"`
+	Tags     []string          `param:"tags"`
+	Limits   map[string]int    `param:"limits"`
+	Timeout  time.Duration     `param:"timeout" default:"30s"`
+	At       time.Time         `param:"at"`
+	Format   string            `param:"format" default:"2006-01-02"`
+	Settings map[string]string `param:"-"`
+}
+
+func TestRegisterFunc(t *testing.T) {
+	registry := NewFunctionRegistry()
+	err := RegisterFunc(registry, FunctionDefinition{Name: "typed"}, func(ctx context.Context, execCtx *types.ExecutionContext, p typedParams) (typedParams, error) {
+		return p, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	def, _ := registry.Get("typed")
+	expectedParams := map[string]ParamDefinition{
+		"name":    {Type: "string", Required: true},
+		"count":   {Type: "int", Default: 3},
+		"ratio":   {Type: "float64"},
+		"enabled": {Type: "bool", Default: true},
+		"tags":    {Type: "[]string"},
+		"limits":  {Type: "map[string]int"},
+		"timeout": {Type: "time.Duration", Default: 30 * time.Second},
+		"at":      {Type: "time.Time"},
+		"format":  {Type: "string", Default: "2006-01-02"},
+	}
+	if !reflect.DeepEqual(def.Params, expectedParams) || def.Returns.Type != "functions.typedParams" {
+		t.Errorf("Expected params derived from the struct, got %+v returning %s", def.Params, def.Returns.Type)
+	}
+
+	execute := func(input string) (typedParams, error) {
+		var params map[string]interface{}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			t.Fatalf("Invalid input: %v", err)
+		}
+		result, err := registry.Execute(context.Background(), "typed", params, &types.ExecutionContext{})
+		if err != nil {
+			return typedParams{}, err
+		}
+		return result.(typedParams), nil
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		p, err := execute(`{"name": "a"}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if p.Count != 3 || !p.Enabled || p.Timeout != 30*time.Second || p.Format != "2006-01-02" || p.Tags != nil {
+			t.Errorf("Expected defaults, got %+v", p)
+		}
+	})
+
+	t.Run("JSONCoercion", func(t *testing.T) {
+		p, err := execute(`{"name": "a", "count": 7, "ratio": 2, "enabled": false, "tags": ["x", "y"],
+			"limits": {"daily": 10}, "timeout": "1m30s", "at": "2024-05-01T10:00:00Z"}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := typedParams{
+			Name: "a", Count: 7, Ratio: 2, Enabled: false, Tags: []string{"x", "y"},
+			Limits: map[string]int{"daily": 10}, Timeout: 90 * time.Second,
+			At: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Format: "2006-01-02",
+		}
+		if !reflect.DeepEqual(p, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, p)
+		}
+	})
+
+	t.Run("NumericDurationIsSeconds", func(t *testing.T) {
+		if p, err := execute(`{"name": "a", "timeout": 1.5, "at": "2024-05-01"}`); err != nil || p.Timeout != 1500*time.Millisecond || p.At.Day() != 1 {
+			t.Errorf("Expected 1.5s on a date, got %+v, %v", p, err)
+		}
+	})
+
+	errorCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"MissingRequired", `{}`, "required parameter name missing"},
+		{"NullRequired", `{"name": null}`, "required parameter name missing"},
+		{"Unknown", `{"name": "a", "nmae": "b", "extra": 1}`, "unknown parameter extra, nmae"},
+		{"FractionalInt", `{"name": "a", "count": 1.5}`, "parameter count: 1.5 is not a valid int"},
+		{"StringForInt", `{"name": "a", "count": "7"}`, `parameter count: cannot use string "7" as int`},
+		{"NumberForString", `{"name": 5}`, "parameter name: cannot use number 5 as string"},
+		{"BadDuration", `{"name": "a", "timeout": "soon"}`, `invalid duration "soon"`},
+		{"BadTime", `{"name": "a", "at": "May 1st"}`, `invalid time "May 1st"`},
+		{"BadElement", `{"name": "a", "tags": ["x", 2]}`, "parameter tags: [1]: cannot use number 2 as string"},
+		{"ObjectForArray", `{"name": "a", "tags": {}}`, "cannot use object as []string"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := execute(tc.input)
+			if err == nil || !strings.Contains(err.Error(), "parameter validation failed") || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestRegisterFuncInvalidParams(t *testing.T) {
+	testCases := []struct {
+		name     string
+		register func(registry *FunctionRegistry) error
+		expected string
+	}{
+		{
+			name: "NotAStruct",
+			register: func(registry *FunctionRegistry) error {
+				return RegisterFunc(registry, FunctionDefinition{Name: "f"}, func(ctx context.Context, execCtx *types.ExecutionContext, p string) (string, error) { return p, nil })
+			},
+			expected: "params must be a struct",
+		},
+		{
+			name: "Untagged",
+			register: func(registry *FunctionRegistry) error {
+				type params struct{ Name string }
+				return RegisterAction(registry, FunctionDefinition{Name: "f"}, func(ctx context.Context, execCtx *types.ExecutionContext, p params) error { return nil })
+			},
+			expected: "field Name needs a param tag",
+		},
+		{
+			name: "RequiredWithDefault",
+			register: func(registry *FunctionRegistry) error {
+				type params struct {
+					Count int `param:"count,required" default:"1"`
+				}
+				return RegisterAction(registry, FunctionDefinition{Name: "f"}, func(ctx context.Context, execCtx *types.ExecutionContext, p params) error { return nil })
+			},
+			expected: "required params can't have a default",
+		},
+		{
+			name: "InvalidDefault",
+			register: func(registry *FunctionRegistry) error {
+				type params struct {
+					Timeout time.Duration `param:"timeout" default:"soon"`
+				}
+				return RegisterAction(registry, FunctionDefinition{Name: "f"}, func(ctx context.Context, execCtx *types.ExecutionContext, p params) error { return nil })
+			},
+			expected: `invalid default: invalid duration "soon"`,
+		},
+		{
+			name: "WithoutHandler",
+			register: func(registry *FunctionRegistry) error {
+				return registry.Register(&FunctionDefinition{Name: "f"})
+			},
+			expected: "has no handler",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.register(NewFunctionRegistry()); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
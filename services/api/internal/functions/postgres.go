@@ -0,0 +1,239 @@
+package functions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresExecutionSchema creates the function_executions table with the
+// columns and indexes the system schema declares for it
+const postgresExecutionSchema = `
+CREATE TABLE IF NOT EXISTS function_executions (
+	id                TEXT PRIMARY KEY,
+	function_id       TEXT,
+	function_name     TEXT NOT NULL,
+	tenant_id         TEXT NOT NULL,
+	entity            TEXT,
+	trigger_event     TEXT,
+	request_id        TEXT,
+	user_id           TEXT,
+	input_data        JSONB NOT NULL DEFAULT '{}',
+	output_data       JSONB,
+	status            TEXT NOT NULL,
+	error_message     TEXT,
+	execution_time_ms BIGINT NOT NULL DEFAULT 0,
+	memory_used_mb    DOUBLE PRECISION,
+	started_at        TIMESTAMPTZ NOT NULL,
+	completed_at      TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS function_executions_function ON function_executions (function_id, started_at);
+CREATE INDEX IF NOT EXISTS function_executions_name ON function_executions (tenant_id, function_name, started_at);
+CREATE INDEX IF NOT EXISTS function_executions_tenant_status ON function_executions (tenant_id, status);
+CREATE INDEX IF NOT EXISTS function_executions_status ON function_executions (status, started_at);
+`
+
+const executionColumns = `id, tenant_id, function_name, entity, trigger_event, request_id, user_id,
+	input_data, output_data, status, error_message, execution_time_ms, started_at, completed_at`
+
+// PostgresExecutionStore is an ExecutionStore in the function_executions
+// table, so history survives restarts and is shared by the API and job
+// workers. Unlike MemoryExecutionStore it keeps every execution.
+type PostgresExecutionStore struct {
+	db *sql.DB
+}
+
+// NewPostgresExecutionStore creates a store over db. Call Migrate to create
+// the table.
+func NewPostgresExecutionStore(db *sql.DB) *PostgresExecutionStore {
+	return &PostgresExecutionStore{db: db}
+}
+
+// OpenPostgresExecutionStore connects to the database at url and creates
+// the function_executions table if needed
+func OpenPostgresExecutionStore(ctx context.Context, url string) (*PostgresExecutionStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open execution database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to execution database: %w", err)
+	}
+	store := NewPostgresExecutionStore(db)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Migrate creates the function_executions table and its indexes
+func (s *PostgresExecutionStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresExecutionSchema); err != nil {
+		return fmt.Errorf("failed to create function_executions table: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *PostgresExecutionStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExecution(row scanner) (*Execution, error) {
+	var (
+		execution   Execution
+		entity      sql.NullString
+		trigger     sql.NullString
+		requestID   sql.NullString
+		userID      sql.NullString
+		params      []byte
+		result      []byte
+		errorText   sql.NullString
+		completedAt sql.NullTime
+	)
+	err := row.Scan(&execution.ID, &execution.TenantID, &execution.FunctionName, &entity, &trigger,
+		&requestID, &userID, &params, &result, &execution.Status, &errorText,
+		&execution.ExecutionTimeMS, &execution.StartedAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &execution.Params); err != nil {
+		return nil, fmt.Errorf("invalid input_data for execution %s: %w", execution.ID, err)
+	}
+	if result != nil {
+		if err := json.Unmarshal(result, &execution.Result); err != nil {
+			return nil, fmt.Errorf("invalid output_data for execution %s: %w", execution.ID, err)
+		}
+	}
+	execution.Entity = entity.String
+	execution.Trigger = trigger.String
+	execution.RequestID = requestID.String
+	execution.UserID = userID.String
+	execution.Error = errorText.String
+	execution.StartedAt = execution.StartedAt.UTC()
+	if completedAt.Valid {
+		t := completedAt.Time.UTC()
+		execution.CompletedAt = &t
+	}
+	return &execution, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// marshalResult encodes a result for output_data, leaving it NULL when the
+// function returned nothing
+func marshalResult(result interface{}) ([]byte, error) {
+	if result == nil {
+		return nil, nil
+	}
+	return json.Marshal(result)
+}
+
+// CreateExecution records an execution as it starts
+func (s *PostgresExecutionStore) CreateExecution(ctx context.Context, execution *Execution) error {
+	params, err := json.Marshal(execution.Params)
+	if err != nil {
+		return fmt.Errorf("failed to encode params: %w", err)
+	}
+	if execution.Params == nil {
+		params = []byte("{}")
+	}
+	result, err := marshalResult(execution.Result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO function_executions (`+executionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		execution.ID, execution.TenantID, execution.FunctionName, nullString(execution.Entity),
+		nullString(execution.Trigger), nullString(execution.RequestID), nullString(execution.UserID),
+		params, result, execution.Status, nullString(execution.Error), execution.ExecutionTimeMS,
+		execution.StartedAt, execution.CompletedAt)
+	return err
+}
+
+// UpdateExecution records an execution's outcome
+func (s *PostgresExecutionStore) UpdateExecution(ctx context.Context, execution *Execution) error {
+	result, err := marshalResult(execution.Result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	updated, err := s.db.ExecContext(ctx, `UPDATE function_executions
+		SET output_data = $3, status = $4, error_message = $5, execution_time_ms = $6, completed_at = $7
+		WHERE tenant_id = $1 AND id = $2`,
+		execution.TenantID, execution.ID, result, execution.Status, nullString(execution.Error),
+		execution.ExecutionTimeMS, execution.CompletedAt)
+	if err != nil {
+		return err
+	}
+	affected, err := updated.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrExecutionNotFound
+	}
+	return nil
+}
+
+// GetExecution returns a tenant's execution
+func (s *PostgresExecutionStore) GetExecution(ctx context.Context, tenantID, id string) (*Execution, error) {
+	return scanExecution(s.db.QueryRowContext(ctx, `SELECT `+executionColumns+`
+		FROM function_executions WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+}
+
+// ListExecutions returns a tenant's executions matching query, newest first
+func (s *PostgresExecutionStore) ListExecutions(ctx context.Context, tenantID string, query ExecutionQuery) ([]*Execution, error) {
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{tenantID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if query.FunctionName != "" {
+		add("function_name = $%d", query.FunctionName)
+	}
+	if query.Entity != "" {
+		add("entity = $%d", query.Entity)
+	}
+	if query.Status != "" {
+		add("status = $%d", query.Status)
+	}
+	if !query.Since.IsZero() {
+		add("started_at >= $%d", query.Since)
+	}
+	args = append(args, sql.NullInt64{Int64: int64(query.Limit), Valid: query.Limit > 0})
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT `+executionColumns+` FROM function_executions
+		WHERE %s ORDER BY started_at DESC, id DESC LIMIT $%d`, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions []*Execution
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+	return executions, rows.Err()
+}
@@ -2,20 +2,47 @@ package functions
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"reflect"
+	"log"
+	"runtime/debug"
 	"sync"
+	"time"
+	
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	
 	"github.com/backsaas/platform/api/internal/types"
 )
 
+// tracerName is the instrumentation scope of the registry's spans
+const tracerName = "github.com/backsaas/platform/api/internal/functions"
+
+// DefaultTimeout bounds executions whose context has no deadline and whose
+// definition sets no timeout
+const DefaultTimeout = 30 * time.Second
+
+var (
+	// ErrExecutionTimeout is returned when a function outlives its deadline
+	ErrExecutionTimeout = errors.New("function execution timed out")
+
+	// ErrFunctionPanicked is returned when a function panics
+	ErrFunctionPanicked = errors.New("function panicked")
+)
+
 // FunctionRegistry manages all available Go functions
 type FunctionRegistry struct {
 	functions map[string]*FunctionDefinition
 	mu        sync.RWMutex
+	
+	// executions records every execution when set
+	executions ExecutionStore
 }
 
-// FunctionDefinition describes a registered Go function
+// FunctionDefinition describes a registered Go function. Definitions are
+// built by RegisterFunc and RegisterAction, which derive Params and Returns
+// from the function's signature.
 type FunctionDefinition struct {
 	Name        string
 	Package     string
@@ -23,14 +50,25 @@ type FunctionDefinition struct {
 	Description string
 	Params      map[string]ParamDefinition
 	Returns     ReturnDefinition
-	Handler     reflect.Value
+	
+	// Timeout bounds each execution; zero uses DefaultTimeout. A shorter
+	// deadline on the caller's context wins.
+	Timeout time.Duration
+	
+	// fields are the params in declaration order, and bind decodes params
+	// into the function's param struct
+	fields []paramField
+	bind   func(params map[string]interface{}) (boundCall, error)
 }
 
 // ParamDefinition describes function parameters
 type ParamDefinition struct {
-	Type     string
+	Type     string // the Go type, as go_function_registry spells it
 	Required bool
 	Default  interface{}
+	
+	// Secret params are redacted from execution history
+	Secret bool
 }
 
 // ReturnDefinition describes function return type
@@ -38,30 +76,9 @@ type ReturnDefinition struct {
 	Type string
 	// Add a new field to ReturnDefinition
 	Nullable bool
-}
-
-
-// DataService provides secure, tenant-scoped data operations
-type DataService interface {
-	FindByID(ctx context.Context, entity, id string) (map[string]interface{}, error)
-	FindMany(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error)
-	Create(ctx context.Context, entity string, data map[string]interface{}) (map[string]interface{}, error)
-	Update(ctx context.Context, entity, id string, data map[string]interface{}) (map[string]interface{}, error)
-	Delete(ctx context.Context, entity, id string) error
-	Count(ctx context.Context, entity string, filters map[string]interface{}) (int64, error)
-}
-
-// EventService handles event publishing
-type EventService interface {
-	Publish(ctx context.Context, event string, data map[string]interface{}) error
-	Schedule(ctx context.Context, event string, data map[string]interface{}, delay string) error
-}
-
-// Logger provides structured logging
-type Logger interface {
-	Info(msg string, fields map[string]interface{})
-	Warn(msg string, fields map[string]interface{})
-	Error(msg string, err error, fields map[string]interface{})
+	
+	// Secret results are redacted from execution history
+	Secret bool
 }
 
 // NewFunctionRegistry creates a new function registry
@@ -71,8 +88,20 @@ func NewFunctionRegistry() *FunctionRegistry {
 	}
 }
 
-// Register adds a function to the registry
+// SetExecutionStore makes the registry record every execution in store
+func (r *FunctionRegistry) SetExecutionStore(store ExecutionStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executions = store
+}
+
+// Register adds a function to the registry. Use RegisterFunc or
+// RegisterAction, which build the definition from a typed function.
 func (r *FunctionRegistry) Register(def *FunctionDefinition) error {
+	if def.bind == nil {
+		return fmt.Errorf("function %s has no handler; register it with RegisterFunc or RegisterAction", def.Name)
+	}
+	
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	
@@ -105,7 +134,11 @@ func (r *FunctionRegistry) List() map[string]*FunctionDefinition {
 	return result
 }
 
-// Execute runs a function with the given parameters
+// Execute runs a function with the given parameters. The function is
+// bounded by ctx's deadline, or by its timeout when ctx has none, and a
+// panic is returned as ErrFunctionPanicked. When an execution store is set,
+// the execution is recorded with its params and result redacted. When ctx
+// holds a span, the execution is traced as its child.
 func (r *FunctionRegistry) Execute(
 	ctx context.Context,
 	functionName string,
@@ -119,102 +152,167 @@ func (r *FunctionRegistry) Execute(
 		return nil, fmt.Errorf("function %s not found", functionName)
 	}
 	
-	// Validate parameters
-	if err := r.validateParams(def, params); err != nil {
-		return nil, fmt.Errorf("parameter validation failed: %w", err)
+	// Traced as a child of the caller's span with the caller's provider;
+	// without one the span is a no-op
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "function "+def.Name, trace.WithSpanKind(trace.SpanKindInternal))
+	defer span.End()
+	span.SetAttributes(attribute.String("function.name", def.Name))
+	if execCtx != nil {
+		span.SetAttributes(
+			attribute.String("tenant.id", execCtx.TenantID),
+			attribute.String("function.trigger", execCtx.Operation),
+		)
 	}
 	
-	// Prepare function arguments
-	args, err := r.prepareArgs(def, params, execCtx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare arguments: %w", err)
+	// Functions run without a DataService get one whose operations fail
+	// with ErrNoDataService, rather than a nil interface
+	if execCtx != nil && execCtx.DataService == nil {
+		withoutData := *execCtx
+		withoutData.DataService = types.NoDataService{}
+		execCtx = &withoutData
 	}
 	
-	// Execute function
-	results := def.Handler.Call(args)
+	execution := r.startExecution(ctx, def, params, execCtx)
+	result, err := r.execute(ctx, def, params, execCtx)
+	r.finishExecution(ctx, def, execution, result, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 	
-	// Handle results
-	return r.handleResults(results)
+	return result, err
 }
 
-// validateParams validates function parameters against definition
-func (r *FunctionRegistry) validateParams(def *FunctionDefinition, params map[string]interface{}) error {
-	// Check required parameters
-	for paramName, paramDef := range def.Params {
-		if paramDef.Required {
-			if _, exists := params[paramName]; !exists {
-				return fmt.Errorf("required parameter %s missing", paramName)
-			}
+// execute validates params and calls the function under its deadline
+func (r *FunctionRegistry) execute(
+	ctx context.Context,
+	def *FunctionDefinition,
+	params map[string]interface{},
+	execCtx *types.ExecutionContext,
+) (interface{}, error) {
+	
+	// Decode and validate parameters
+	call, err := def.bind(params)
+	if err != nil {
+		return nil, fmt.Errorf("parameter validation failed: %w", err)
+	}
+	
+	// Apply the function's timeout unless the caller set a deadline
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		timeout := def.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
 		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 	
-	// TODO: Add type validation
-	return nil
+	// Execute function. Go functions can't be stopped, so one that ignores
+	// its context keeps running after the deadline, but its result is
+	// discarded.
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Function %s panicked: %v\n%s", def.Name, recovered, debug.Stack())
+				done <- outcome{err: fmt.Errorf("%w: %v", ErrFunctionPanicked, recovered)}
+			}
+		}()
+		result, err := call(ctx, execCtx)
+		done <- outcome{result, err}
+	}()
+	
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %s: %v", ErrExecutionTimeout, def.Name, ctx.Err())
+	}
 }
 
-// prepareArgs converts parameters to function arguments
-func (r *FunctionRegistry) prepareArgs(
+// startExecution records a running execution, returning nil when no store
+// is set or recording fails
+func (r *FunctionRegistry) startExecution(
+	ctx context.Context,
 	def *FunctionDefinition,
 	params map[string]interface{},
 	execCtx *types.ExecutionContext,
-) ([]reflect.Value, error) {
-	
-	funcType := def.Handler.Type()
-	numArgs := funcType.NumIn()
-	args := make([]reflect.Value, numArgs)
-	
-	// First argument is always context
-	args[0] = reflect.ValueOf(context.Background())
+) *Execution {
 	
-	// Second argument is execution context
-	if numArgs > 1 {
-		args[1] = reflect.ValueOf(execCtx)
+	r.mu.RLock()
+	store := r.executions
+	r.mu.RUnlock()
+	if store == nil {
+		return nil
 	}
 	
-	// Remaining arguments are function parameters
-	argIndex := 2
-	for paramName, paramDef := range def.Params {
-		if argIndex >= numArgs {
-			break
-		}
-		
-		value, exists := params[paramName]
-		if !exists {
-			// Use default value
-			value = paramDef.Default
-		}
-		
-		if value != nil {
-			args[argIndex] = reflect.ValueOf(value)
-		} else {
-			// Use zero value for the type
-			args[argIndex] = reflect.Zero(funcType.In(argIndex))
-		}
-		argIndex++
+	execution := &Execution{
+		ID:           newExecutionID(),
+		FunctionName: def.Name,
+		Params:       redactParams(def, params),
+		Status:       ExecutionRunning,
+		StartedAt:    time.Now().UTC(),
+	}
+	if execCtx != nil {
+		execution.TenantID = execCtx.TenantID
+		execution.Entity = execCtx.Entity
+		execution.Trigger = execCtx.Operation
+		execution.RequestID = execCtx.RequestID
+		execution.UserID = execCtx.UserID
 	}
 	
-	return args, nil
+	// History must not fail or outlive the function, so it is written with
+	// the caller's values but not its cancellation
+	if err := store.CreateExecution(context.WithoutCancel(ctx), execution); err != nil {
+		log.Printf("Failed to record execution of %s: %v", def.Name, err)
+		return nil
+	}
+	return execution
 }
 
-// handleResults processes function return values
-func (r *FunctionRegistry) handleResults(results []reflect.Value) (interface{}, error) {
-	if len(results) == 0 {
-		return nil, nil
+// finishExecution records an execution's outcome
+func (r *FunctionRegistry) finishExecution(
+	ctx context.Context,
+	def *FunctionDefinition,
+	execution *Execution,
+	result interface{},
+	err error,
+) {
+	
+	if execution == nil {
+		return
 	}
 	
-	// Last result is always error (if present)
-	if len(results) > 1 {
-		if errVal := results[len(results)-1]; !errVal.IsNil() {
-			if err, ok := errVal.Interface().(error); ok {
-				return nil, err
-			}
+	completedAt := time.Now().UTC()
+	execution.CompletedAt = &completedAt
+	execution.ExecutionTimeMS = completedAt.Sub(execution.StartedAt).Milliseconds()
+	
+	switch {
+	case errors.Is(err, ErrExecutionTimeout):
+		execution.Status = ExecutionTimeout
+		execution.Error = err.Error()
+	case err != nil:
+		execution.Status = ExecutionFailed
+		execution.Error = err.Error()
+	default:
+		execution.Status = ExecutionCompleted
+		if def.Returns.Secret {
+			execution.Result = redactedValue
+		} else {
+			execution.Result = redactValue(result)
 		}
 	}
 	
-	// First result is the return value
-	if results[0].IsValid() {
-		return results[0].Interface(), nil
+	r.mu.RLock()
+	store := r.executions
+	r.mu.RUnlock()
+	if err := store.UpdateExecution(context.WithoutCancel(ctx), execution); err != nil {
+		log.Printf("Failed to record outcome of %s execution %s: %v", def.Name, execution.ID, err)
 	}
-	
-	return nil, nil
 }
@@ -0,0 +1,434 @@
+package functions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string, map[string]interface{})        {}
+func (nopLogger) Warn(string, map[string]interface{})        {}
+func (nopLogger) Error(string, error, map[string]interface{}) {}
+
+// newTestRegistry returns the standard registry plus test functions that
+// sleep, panic and echo their input
+func newTestRegistry(t *testing.T) (*FunctionRegistry, *MemoryExecutionStore) {
+	registry := InitializeRegistry()
+	store := NewMemoryExecutionStore(0)
+	registry.SetExecutionStore(store)
+
+	type sleepParams struct {
+		Duration time.Duration `param:"duration,required"`
+	}
+	type messageParams struct {
+		Message string `param:"message,required"`
+	}
+	type configParams struct {
+		Config map[string]interface{} `param:"config,required"`
+	}
+	errs := []error{
+		RegisterAction(registry, FunctionDefinition{Name: "sleep", Timeout: 20 * time.Millisecond}, func(ctx context.Context, execCtx *types.ExecutionContext, p sleepParams) error {
+			select {
+			case <-time.After(p.Duration):
+			case <-ctx.Done():
+			}
+			return nil
+		}),
+		RegisterFunc(registry, FunctionDefinition{Name: "explode"}, func(ctx context.Context, execCtx *types.ExecutionContext, p messageParams) (string, error) {
+			panic(p.Message)
+		}),
+		RegisterFunc(registry, FunctionDefinition{Name: "echo"}, func(ctx context.Context, execCtx *types.ExecutionContext, p configParams) (map[string]interface{}, error) {
+			return p.Config, nil
+		}),
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to register test function: %v", err)
+		}
+	}
+	return registry, store
+}
+
+func TestExecuteRecordsHistory(t *testing.T) {
+	registry, store := newTestRegistry(t)
+	ctx := context.Background()
+	execCtx := &types.ExecutionContext{
+		TenantID:  "tenant-1",
+		UserID:    "user-1",
+		RequestID: "req-1",
+		Entity:    "users",
+		Operation: "after_create",
+		Logger:    nopLogger{},
+	}
+
+	testCases := []struct {
+		name           string
+		function       string
+		params         map[string]interface{}
+		expectedStatus ExecutionStatus
+		expectedErr    error
+		check          func(t *testing.T, execution *Execution)
+	}{
+		{
+			name:           "SecretParamsAndResultsRedacted",
+			function:       "hash_password",
+			params:         map[string]interface{}{"password": "hunter2hunter2"},
+			expectedStatus: ExecutionCompleted,
+			check: func(t *testing.T, execution *Execution) {
+				if execution.Params["password"] != redactedValue || execution.Result != redactedValue {
+					t.Errorf("Expected password and hash redacted, got %v and %v", execution.Params, execution.Result)
+				}
+			},
+		},
+		{
+			name:     "NestedSecretsRedacted",
+			function: "echo",
+			params: map[string]interface{}{"config": map[string]interface{}{
+				"url":     "https://example.com",
+				"headers": map[string]interface{}{"Authorization": "Bearer abc"},
+				"items":   []interface{}{map[string]interface{}{"api_key": "k", "name": "n"}},
+			}},
+			expectedStatus: ExecutionCompleted,
+			check: func(t *testing.T, execution *Execution) {
+				encoded, _ := json.Marshal(execution.Params)
+				expected := `{"config":{"headers":{"Authorization":"[REDACTED]"},"items":[{"api_key":"[REDACTED]","name":"n"}],"url":"https://example.com"}}`
+				if string(encoded) != expected {
+					t.Errorf("Expected %s, got %s", expected, encoded)
+				}
+				if result, _ := json.Marshal(execution.Result); string(result) != `{"headers":{"Authorization":"[REDACTED]"},"items":[{"api_key":"[REDACTED]","name":"n"}],"url":"https://example.com"}` {
+					t.Errorf("Expected the result redacted too, got %s", result)
+				}
+			},
+		},
+		{
+			name:           "MissingParamFails",
+			function:       "hash_password",
+			params:         map[string]interface{}{},
+			expectedStatus: ExecutionFailed,
+		},
+		{
+			name:           "ErrorOnlyResultFails",
+			function:       "send_email",
+			params:         map[string]interface{}{"template": "user_welcome", "to": "a@example.com", "data": map[string]interface{}{}},
+			expectedStatus: ExecutionFailed,
+		},
+		{
+			name:           "Timeout",
+			function:       "sleep",
+			params:         map[string]interface{}{"duration": time.Second},
+			expectedStatus: ExecutionTimeout,
+			expectedErr:    ErrExecutionTimeout,
+		},
+		{
+			name:           "Panic",
+			function:       "explode",
+			params:         map[string]interface{}{"message": "boom"},
+			expectedStatus: ExecutionFailed,
+			expectedErr:    ErrFunctionPanicked,
+			check: func(t *testing.T, execution *Execution) {
+				if execution.Error != "function panicked: boom" {
+					t.Errorf("Expected the panic in the error, got %q", execution.Error)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := registry.Execute(ctx, tc.function, tc.params, execCtx)
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+			if (tc.expectedStatus == ExecutionCompleted) != (err == nil) {
+				t.Errorf("Expected status %s, got error %v", tc.expectedStatus, err)
+			}
+
+			executions, _ := store.ListExecutions(ctx, "tenant-1", ExecutionQuery{FunctionName: tc.function, Limit: 1})
+			if len(executions) != 1 {
+				t.Fatalf("Expected the execution to be recorded")
+			}
+			execution := executions[0]
+			if execution.Status != tc.expectedStatus || execution.CompletedAt == nil {
+				t.Errorf("Expected a finished %s execution, got %+v", tc.expectedStatus, execution)
+			}
+			if execution.Entity != "users" || execution.Trigger != "after_create" || execution.RequestID != "req-1" {
+				t.Errorf("Expected the execution context recorded, got %+v", execution)
+			}
+			if (execution.Error == "") != (err == nil) {
+				t.Errorf("Expected error_message to match %v, got %q", err, execution.Error)
+			}
+			if tc.check != nil {
+				tc.check(t, execution)
+			}
+		})
+	}
+
+	t.Run("CallerDeadlineWins", func(t *testing.T) {
+		deadlineCtx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		if _, err := registry.Execute(deadlineCtx, "sleep", map[string]interface{}{"duration": time.Second}, execCtx); !errors.Is(err, ErrExecutionTimeout) {
+			t.Errorf("Expected a timeout, got %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected the execution to stop at the deadline, took %v", elapsed)
+		}
+	})
+}
+
+func TestHistoryHandler(t *testing.T) {
+	registry, store := newTestRegistry(t)
+	ctx := context.Background()
+	for _, tenantID := range []string{"tenant-1", "tenant-1", "tenant-2"} {
+		registry.Execute(ctx, "hash_password", map[string]interface{}{}, &types.ExecutionContext{TenantID: tenantID, Entity: "users"})
+	}
+	registry.Execute(ctx, "echo", map[string]interface{}{"config": map[string]interface{}{}}, &types.ExecutionContext{TenantID: "tenant-1", Entity: "tenants"})
+
+	api := NewHistoryHandler(store).Routes()
+	call := func(tenantID, path string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", path, nil)
+		if tenantID != "" {
+			req.Header.Set(httputil.TenantHeader, tenantID)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		var response map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+
+	testCases := []struct {
+		name     string
+		tenantID string
+		path     string
+		status   int
+		count    int
+	}{
+		{"All", "tenant-1", "/executions", http.StatusOK, 3},
+		{"ByStatus", "tenant-1", "/executions?status=failed", http.StatusOK, 2},
+		{"ByFunctionAndEntity", "tenant-1", "/executions?function=echo&entity=tenants", http.StatusOK, 1},
+		{"Limit", "tenant-1", "/executions?limit=1", http.StatusOK, 1},
+		{"Since", "tenant-1", "/executions?since=" + time.Now().Add(time.Hour).Format(time.RFC3339), http.StatusOK, 0},
+		{"OtherTenant", "tenant-2", "/executions", http.StatusOK, 1},
+		{"InvalidStatus", "tenant-1", "/executions?status=bogus", http.StatusBadRequest, -1},
+		{"NoTenant", "", "/executions", http.StatusUnauthorized, -1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, response := call(tc.tenantID, tc.path)
+			if status != tc.status {
+				t.Fatalf("Expected %d, got %d %v", tc.status, status, response)
+			}
+			if tc.count >= 0 && len(response["data"].([]interface{})) != tc.count {
+				t.Errorf("Expected %d executions, got %v", tc.count, response["data"])
+			}
+		})
+	}
+
+	t.Run("GetByID", func(t *testing.T) {
+		executions, _ := store.ListExecutions(ctx, "tenant-1", ExecutionQuery{Limit: 1})
+		if status, response := call("tenant-1", "/executions/"+executions[0].ID); status != http.StatusOK || response["data"].(map[string]interface{})["function_name"] != "echo" {
+			t.Errorf("Expected the echo execution, got %d %v", status, response)
+		}
+		if status, _ := call("tenant-2", "/executions/"+executions[0].ID); status != http.StatusNotFound {
+			t.Errorf("Expected another tenant to get 404, got %d", status)
+		}
+	})
+}
+
+func TestExecuteWithoutDataService(t *testing.T) {
+	registry := InitializeRegistry()
+	execCtx := &types.ExecutionContext{TenantID: "tenant-1", RequestID: "job-1", Entity: "projects", Operation: "job", Logger: nopLogger{}}
+
+	testCases := []struct {
+		function string
+		params   map[string]interface{}
+	}{
+		{"generate_slug", map[string]interface{}{"text": "My Project", "check_uniqueness": true}},
+		{"validate_email", map[string]interface{}{"email": "ada@example.com"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.function, func(t *testing.T) {
+			if _, err := registry.Execute(context.Background(), tc.function, tc.params, execCtx); !errors.Is(err, types.ErrNoDataService) {
+				t.Errorf("Expected ErrNoDataService, got %v", err)
+			}
+		})
+	}
+	if execCtx.DataService != nil {
+		t.Errorf("Expected the caller's context to be left unchanged")
+	}
+
+	// Functions that don't touch data are unaffected
+	if slug, err := registry.Execute(context.Background(), "generate_slug", map[string]interface{}{"text": "My Project"}, execCtx); err != nil || slug != "my-project" {
+		t.Errorf("Expected my-project, got %v (%v)", slug, err)
+	}
+}
+
+func TestMemoryExecutionStoreCapacity(t *testing.T) {
+	store := NewMemoryExecutionStore(2)
+	ctx := context.Background()
+	for _, id := range []string{"e1", "e2", "e3"} {
+		store.CreateExecution(ctx, &Execution{ID: id, TenantID: "tenant-1", StartedAt: time.Now()})
+	}
+	if _, err := store.GetExecution(ctx, "tenant-1", "e1"); !errors.Is(err, ErrExecutionNotFound) {
+		t.Errorf("Expected the oldest execution evicted, got %v", err)
+	}
+	if executions, _ := store.ListExecutions(ctx, "tenant-1", ExecutionQuery{}); len(executions) != 2 {
+		t.Errorf("Expected 2 executions kept, got %d", len(executions))
+	}
+}
+
+// executionStoreFactories returns the stores to run the execution store
+// contract against. Postgres is included when TEST_DATABASE_URL is set.
+func executionStoreFactories(t *testing.T) map[string]func(t *testing.T) ExecutionStore {
+	factories := map[string]func(t *testing.T) ExecutionStore{
+		"memory": func(t *testing.T) ExecutionStore { return NewMemoryExecutionStore(0) },
+	}
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		factories["postgres"] = func(t *testing.T) ExecutionStore {
+			db, err := sql.Open("postgres", url)
+			if err != nil || db.Ping() != nil {
+				t.Skip("Database not accessible for testing")
+			}
+			// One connection, so the test schema stays on the search path
+			db.SetMaxOpenConns(1)
+			schema := fmt.Sprintf("functions_test_%d", time.Now().UnixNano())
+			if _, err := db.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema); err != nil {
+				t.Fatalf("Failed to create test schema: %v", err)
+			}
+			t.Cleanup(func() {
+				db.Exec("DROP SCHEMA " + schema + " CASCADE")
+				db.Close()
+			})
+			store := NewPostgresExecutionStore(db)
+			if err := store.Migrate(context.Background()); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+			return store
+		}
+	}
+	return factories
+}
+
+func TestExecutionStore(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for name, factory := range executionStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory(t)
+
+			for i, fn := range []string{"send_email", "send_email", "validate_email"} {
+				execution := &Execution{ID: fmt.Sprintf("e%d", i+1), TenantID: "tenant-1", FunctionName: fn, Entity: "users",
+					Trigger: "after_create", Params: map[string]interface{}{"to": "ada@example.com"},
+					Status: ExecutionRunning, StartedAt: start.Add(time.Duration(i) * time.Minute)}
+				if err := store.CreateExecution(ctx, execution); err != nil {
+					t.Fatalf("Failed to create execution: %v", err)
+				}
+			}
+
+			completedAt := start.Add(time.Second)
+			finished := &Execution{ID: "e1", TenantID: "tenant-1", FunctionName: "send_email", Status: ExecutionFailed,
+				Error: "smtp down", Result: map[string]interface{}{"sent": false}, ExecutionTimeMS: 1000, CompletedAt: &completedAt}
+			if err := store.UpdateExecution(ctx, finished); err != nil {
+				t.Fatalf("Failed to update execution: %v", err)
+			}
+			if err := store.UpdateExecution(ctx, &Execution{ID: "e1", TenantID: "tenant-2"}); !errors.Is(err, ErrExecutionNotFound) {
+				t.Errorf("Expected another tenant's update to get ErrExecutionNotFound, got %v", err)
+			}
+
+			got, err := store.GetExecution(ctx, "tenant-1", "e1")
+			if err != nil || got.Status != ExecutionFailed || got.Error != "smtp down" || got.ExecutionTimeMS != 1000 ||
+				got.CompletedAt == nil || !got.CompletedAt.Equal(completedAt) {
+				t.Errorf("Unexpected stored execution %+v (%v)", got, err)
+			}
+			if result, ok := got.Result.(map[string]interface{}); !ok || result["sent"] != false {
+				t.Errorf("Expected the result to be kept, got %#v", got.Result)
+			}
+			if _, err := store.GetExecution(ctx, "tenant-2", "e1"); !errors.Is(err, ErrExecutionNotFound) {
+				t.Errorf("Expected another tenant to get ErrExecutionNotFound, got %v", err)
+			}
+
+			testCases := []struct {
+				query    ExecutionQuery
+				expected []string
+			}{
+				{ExecutionQuery{}, []string{"e3", "e2", "e1"}},
+				{ExecutionQuery{FunctionName: "send_email"}, []string{"e2", "e1"}},
+				{ExecutionQuery{Status: ExecutionRunning, Entity: "users"}, []string{"e3", "e2"}},
+				{ExecutionQuery{Since: start.Add(time.Minute)}, []string{"e3", "e2"}},
+				{ExecutionQuery{Limit: 1}, []string{"e3"}},
+			}
+			for _, tc := range testCases {
+				executions, err := store.ListExecutions(ctx, "tenant-1", tc.query)
+				if err != nil {
+					t.Fatalf("Failed to list executions: %v", err)
+				}
+				var ids []string
+				for _, execution := range executions {
+					ids = append(ids, execution.ID)
+				}
+				if !reflect.DeepEqual(ids, tc.expected) {
+					t.Errorf("Query %+v: expected %v, got %v", tc.query, tc.expected, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteTracesSpans(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request", trace.WithSpanKind(trace.SpanKindServer))
+	execCtx := &types.ExecutionContext{TenantID: "tenant-1", Operation: "before_create", Logger: nopLogger{}}
+
+	registry.Execute(ctx, "echo", map[string]interface{}{"config": map[string]interface{}{}}, execCtx)
+	registry.Execute(ctx, "explode", map[string]interface{}{"message": "boom"}, execCtx)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	for _, span := range spans[:2] {
+		attributes := attribute.NewSet(span.Attributes...)
+		tenant, _ := attributes.Value("tenant.id")
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() || tenant.AsString() != "tenant-1" {
+			t.Errorf("Expected a child span of the request for tenant-1, got %+v", span)
+		}
+	}
+	if spans[0].Name != "function echo" || spans[0].Status.Code == codes.Error {
+		t.Errorf("Expected a successful echo span, got %+v", spans[0])
+	}
+	if spans[1].Name != "function explode" || spans[1].Status.Code != codes.Error {
+		t.Errorf("Expected a failed explode span, got %+v", spans[1])
+	}
+
+	// Untraced callers get no spans
+	exporter.Reset()
+	registry.Execute(context.Background(), "echo", map[string]interface{}{"config": map[string]interface{}{}}, execCtx)
+	if len(exporter.GetSpans()) != 0 {
+		t.Error("Expected no spans without a parent span")
+	}
+}
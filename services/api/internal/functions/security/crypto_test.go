@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"github.com/backsaas/platform/api/internal/types"
@@ -47,18 +48,14 @@ func (m *MockDataService) Count(ctx context.Context, entity string, filters map[
 	return 0, nil
 }
 
-func (m *MockDataService) List(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error) {
-	return []map[string]interface{}{}, nil
-}
-
 // MockEventService for testing
 type MockEventService struct{}
 
-func (m *MockEventService) Publish(event string, data map[string]interface{}) error {
+func (m *MockEventService) Publish(ctx context.Context, event string, data map[string]interface{}) error {
 	return nil
 }
 
-func (m *MockEventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay string) error {
+func (m *MockEventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error {
 	return nil
 }
 
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+// currency describes how amounts in a currency are displayed
+type currency struct {
+	symbol   string
+	decimals int
+}
+
+// currencies lists the currencies with a known symbol; other ISO 4217 codes
+// are formatted with two decimals followed by the code
+var currencies = map[string]currency{
+	"USD": {"$", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"JPY": {"¥", 0},
+	"CNY": {"¥", 2},
+	"INR": {"₹", 2},
+	"KRW": {"₩", 0},
+	"CAD": {"CA$", 2},
+	"AUD": {"A$", 2},
+}
+
+// now is replaced in tests
+var now = time.Now
+
+// FormatCurrency formats an amount in the given ISO 4217 currency, for
+// example 1234.5 USD as "$1,234.50"
+func FormatCurrency(ctx context.Context, execCtx *types.ExecutionContext, amount float64, currencyCode string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(currencyCode))
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid currency code %q", currencyCode)
+	}
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return "", fmt.Errorf("invalid amount %v", amount)
+	}
+
+	cur, known := currencies[code]
+	if !known {
+		cur = currency{decimals: 2}
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	formatted := strconv.FormatFloat(amount, 'f', cur.decimals, 64)
+	whole, fraction := formatted, ""
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		whole, fraction = formatted[:i], formatted[i:]
+	}
+	formatted = groupThousands(whole) + fraction
+
+	if !known {
+		return sign + formatted + " " + code, nil
+	}
+	return sign + cur.symbol + formatted, nil
+}
+
+// groupThousands inserts commas between groups of three digits
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// ParseDate parses a date string with a Go layout, defaulting to
+// "2006-01-02". Dates without a zone are interpreted as UTC.
+func ParseDate(ctx context.Context, execCtx *types.ExecutionContext, dateString string, format string) (time.Time, error) {
+	if format == "" {
+		format = "2006-01-02"
+	}
+
+	value := strings.TrimSpace(dateString)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("date string is empty")
+	}
+
+	parsed, err := time.ParseInLocation(format, value, time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q for format %q", dateString, format)
+	}
+
+	return parsed, nil
+}
+
+// CalculateAge returns the number of whole years since a birth date
+func CalculateAge(ctx context.Context, execCtx *types.ExecutionContext, birthDate time.Time) (int, error) {
+	if birthDate.IsZero() {
+		return 0, fmt.Errorf("birth date is required")
+	}
+
+	today := now().In(birthDate.Location())
+	if birthDate.After(today) {
+		return 0, fmt.Errorf("birth date %s is in the future", birthDate.Format("2006-01-02"))
+	}
+
+	age := today.Year() - birthDate.Year()
+
+	// Subtract a year if this year's birthday has not happened yet
+	if today.Month() < birthDate.Month() ||
+		(today.Month() == birthDate.Month() && today.Day() < birthDate.Day()) {
+		age--
+	}
+
+	return age, nil
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFormatCurrency(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		expected string
+		wantErr  bool
+	}{
+		{1234.5, "USD", "$1,234.50", false},
+		{0, "EUR", "€0.00", false},
+		{-987654.321, "GBP", "-£987,654.32", false},
+		{1234567, "JPY", "¥1,234,567", false},
+		{99.999, "usd", "$100.00", false},
+		{1500, "CHF", "1,500.00 CHF", false},
+		{10, "DOLLARS", "", true},
+		{10, "U$D", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			result, err := FormatCurrency(context.Background(), nil, tt.amount, tt.currency)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	parsed, err := ParseDate(context.Background(), nil, "2024-02-29", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !parsed.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 2024-02-29 UTC, got %v", parsed)
+	}
+
+	parsed, err = ParseDate(context.Background(), nil, "01/03/2024", "02/01/2006")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed.Month() != time.March || parsed.Day() != 1 {
+		t.Errorf("Expected 1 March 2024, got %v", parsed)
+	}
+
+	for _, invalid := range []string{"", "2023-02-29", "yesterday"} {
+		if _, err := ParseDate(context.Background(), nil, invalid, ""); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCalculateAge(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name      string
+		birthDate time.Time
+		expected  int
+		wantErr   bool
+	}{
+		{"BirthdayPassed", time.Date(1990, 3, 1, 0, 0, 0, 0, time.UTC), 34, false},
+		{"BirthdayToday", time.Date(2000, 6, 15, 0, 0, 0, 0, time.UTC), 24, false},
+		{"BirthdayTomorrow", time.Date(2000, 6, 16, 0, 0, 0, 0, time.UTC), 23, false},
+		{"FutureDate", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), 0, true},
+		{"ZeroDate", time.Time{}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age, err := CalculateAge(context.Background(), nil, tt.birthDate)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %d", age)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if age != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, age)
+			}
+		})
+	}
+}
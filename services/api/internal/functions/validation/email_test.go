@@ -3,6 +3,7 @@ package validation
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/backsaas/platform/api/internal/types"
 )
@@ -47,21 +48,17 @@ func (m *MockDataService) Count(ctx context.Context, entity string, filters map[
 	return 0, nil
 }
 
-func (m *MockDataService) List(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error) {
-	return []map[string]interface{}{}, nil
-}
-
 // MockEventService for testing
 type MockEventService struct {
 	publishedEvents []string
 }
 
-func (m *MockEventService) Publish(event string, data map[string]interface{}) error {
+func (m *MockEventService) Publish(ctx context.Context, event string, data map[string]interface{}) error {
 	m.publishedEvents = append(m.publishedEvents, event)
 	return nil
 }
 
-func (m *MockEventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay string) error {
+func (m *MockEventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error {
 	return nil
 }
 
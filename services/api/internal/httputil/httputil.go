@@ -0,0 +1,37 @@
+// Package httputil holds the request and response helpers the API's
+// tenant-scoped management endpoints share.
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TenantHeader carries the caller's tenant. It is trusted as sent: these
+// endpoints are internal-only, for other platform services, and must never
+// be routed publicly, since the gateway forwards a client's X-Tenant-ID on
+// routes without authentication.
+const TenantHeader = "X-Tenant-ID"
+
+// RequireTenant rejects requests without a tenant
+func RequireTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(TenantHeader) == "" {
+			WriteError(w, http.StatusUnauthorized, TenantHeader+" header is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteJSON writes body as a JSON response with status
+func WriteJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// WriteError writes an {"error": message} response with status
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+)
+
+// Handler serves the job admin API
+type Handler struct {
+	store     Store
+	scheduler *Scheduler
+}
+
+// NewHandler creates the admin API
+func NewHandler(store Store, scheduler *Scheduler) *Handler {
+	return &Handler{store: store, scheduler: scheduler}
+}
+
+// Routes returns the API's routes, to be mounted under /jobs:
+//
+//	GET    /              jobs, newest first; filter with ?status=, ?kind=
+//	                      and ?limit=
+//	POST   /              schedule an event, function or hook job
+//	GET    /{id}          get a job
+//	POST   /{id}/cancel   cancel a scheduled or running job
+//	POST   /{id}/retry    run a failed or cancelled job again
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(httputil.RequireTenant)
+
+	r.Get("/", h.listJobs)
+	r.Post("/", h.createJob)
+	r.Get("/{id}", h.getJob)
+	r.Post("/{id}/cancel", h.cancelJob)
+	r.Post("/{id}/retry", h.retryJob)
+
+	return r
+}
+
+// writeStoreError maps store errors to responses
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httputil.WriteError(w, http.StatusNotFound, "Job not found")
+	case errors.Is(err, ErrConflict):
+		httputil.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		httputil.WriteError(w, http.StatusInternalServerError, "Job store failed")
+	}
+}
+
+type jobRequest struct {
+	Kind        string                 `json:"kind"`
+	Payload     map[string]interface{} `json:"payload"`
+	RunAt       *time.Time             `json:"run_at"`
+	Delay       string                 `json:"delay"`
+	Cron        string                 `json:"cron"`
+	UniqueKey   string                 `json:"unique_key"`
+	MaxAttempts int                    `json:"max_attempts"`
+}
+
+func (h *Handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	query := Query{
+		Status: Status(values.Get("status")),
+		Kind:   values.Get("kind"),
+		Limit:  50,
+	}
+
+	switch query.Status {
+	case "", StatusScheduled, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled:
+	default:
+		httputil.WriteError(w, http.StatusBadRequest, "status must be scheduled, running, succeeded, failed or cancelled")
+		return
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			httputil.WriteError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		query.Limit = limit
+	}
+
+	jobs, err := h.store.List(r.Context(), r.Header.Get(httputil.TenantHeader), query)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": jobs})
+}
+
+func (h *Handler) createJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	switch req.Kind {
+	case KindEvent, KindFunction, KindHook:
+	default:
+		httputil.WriteError(w, http.StatusBadRequest, "kind must be event, function or hook")
+		return
+	}
+
+	opts := Options{Cron: req.Cron, UniqueKey: req.UniqueKey, MaxAttempts: req.MaxAttempts}
+	if req.RunAt != nil {
+		opts.RunAt = *req.RunAt
+	}
+	if req.Delay != "" {
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil {
+			httputil.WriteError(w, http.StatusBadRequest, "delay must be a duration such as 30s or 2h")
+			return
+		}
+		opts.Delay = delay
+	}
+
+	job, err := h.scheduler.Enqueue(r.Context(), r.Header.Get(httputil.TenantHeader), req.Kind, req.Payload, opts)
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		httputil.WriteJSON(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "data": job})
+	case errors.Is(err, ErrInvalid):
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeStoreError(w, err)
+	default:
+		httputil.WriteJSON(w, http.StatusCreated, map[string]interface{}{"data": job})
+	}
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Get(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": job})
+}
+
+func (h *Handler) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Cancel(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"), time.Now().UTC())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": job})
+}
+
+func (h *Handler) retryJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Retry(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"), time.Now().UTC())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": job})
+}
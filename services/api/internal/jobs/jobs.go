@@ -0,0 +1,341 @@
+// Package jobs runs deferred and recurring work for tenants. A Scheduler
+// stores jobs to run after a delay, at a time or on a cron schedule; a
+// Worker claims due jobs from the Store, runs them through the handler
+// registered for their kind and retries failures with backoff. Jobs are
+// durable in the Postgres store, which lets any number of workers share the
+// queue with SELECT ... FOR UPDATE SKIP LOCKED; the in-memory store serves
+// development and tests.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown jobs
+	ErrNotFound = errors.New("job not found")
+
+	// ErrDuplicate is returned, along with the existing job, when a job is
+	// created with the unique key of a job that is still scheduled
+	ErrDuplicate = errors.New("a job with this unique key is already scheduled")
+
+	// ErrInvalid is returned when scheduling a job with invalid options
+	ErrInvalid = errors.New("invalid job")
+
+	// ErrConflict is returned for transitions a job's status doesn't allow,
+	// such as cancelling a finished job, and when a worker finishes a job
+	// it no longer holds
+	ErrConflict = errors.New("job status does not allow this")
+)
+
+// Status is the state of a job
+type Status string
+
+// Job states
+const (
+	StatusScheduled Status = "scheduled"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Job is a unit of deferred work
+type Job struct {
+	ID       string                 `json:"id"`
+	TenantID string                 `json:"tenant_id"`
+	Kind     string                 `json:"kind"`
+	Payload  map[string]interface{} `json:"payload"`
+	Status   Status                 `json:"status"`
+
+	// UniqueKey, when set, keeps a second job with the same key from being
+	// scheduled for the tenant until this one starts running
+	UniqueKey string `json:"unique_key,omitempty"`
+
+	// Cron makes the job recurring: once an occurrence finishes, the next
+	// one is scheduled for the following match
+	Cron string `json:"cron,omitempty"`
+
+	RunAt       time.Time  `json:"run_at"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+
+	// claim identifies the worker's claim on a running job, so a worker
+	// whose lease expired can't record an outcome over another's
+	claim string
+}
+
+// finished reports whether a job has reached a final state
+func (j *Job) finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Query filters a tenant's jobs
+type Query struct {
+	Status Status
+	Kind   string
+	Limit  int // zero for no limit
+}
+
+// matches reports whether a job passes the query's filters
+func (q Query) matches(job *Job) bool {
+	return (q.Status == "" || job.Status == q.Status) && (q.Kind == "" || job.Kind == q.Kind)
+}
+
+// Store persists jobs
+type Store interface {
+	// Create stores a new scheduled job. When the job has a unique key that
+	// a scheduled job of the tenant already has, it returns that job and
+	// ErrDuplicate instead.
+	Create(ctx context.Context, job *Job) (*Job, error)
+
+	Get(ctx context.Context, tenantID, id string) (*Job, error)
+
+	// List returns a tenant's jobs matching query, newest first
+	List(ctx context.Context, tenantID string, query Query) ([]*Job, error)
+
+	// Claim marks up to limit jobs running until now plus lease, counts the
+	// attempt and returns them, earliest first. Scheduled jobs due by now
+	// are claimed, as are running jobs whose lease expired. No more than
+	// perTenant jobs of a tenant run at once; zero means no limit.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit, perTenant int) ([]*Job, error)
+
+	// Finish records the outcome of a claimed job: its status, last error
+	// and, when it is scheduled again, its run time. When next is not nil,
+	// it is created along with the outcome, in the same transaction, unless
+	// a scheduled job of the tenant already has its unique key. It returns
+	// ErrConflict when the claim is no longer held, such as after the job
+	// was cancelled, and then creates nothing.
+	Finish(ctx context.Context, job *Job, next *Job) error
+
+	// Cancel cancels a scheduled or running job
+	Cancel(ctx context.Context, tenantID, id string, now time.Time) (*Job, error)
+
+	// Retry schedules a failed or cancelled job to run again at now, with
+	// its attempts reset
+	Retry(ctx context.Context, tenantID, id string, now time.Time) (*Job, error)
+}
+
+// MemoryStore is an in-memory Store. Jobs are copied in and out, so callers
+// never share state with the store.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]*Job)}
+}
+
+func copyJob(job *Job) *Job {
+	copied := *job
+	if job.Payload != nil {
+		copied.Payload = make(map[string]interface{}, len(job.Payload))
+		for k, v := range job.Payload {
+			copied.Payload[k] = v
+		}
+	}
+	if job.LockedUntil != nil {
+		lockedUntil := *job.LockedUntil
+		copied.LockedUntil = &lockedUntil
+	}
+	if job.FinishedAt != nil {
+		finishedAt := *job.FinishedAt
+		copied.FinishedAt = &finishedAt
+	}
+	return &copied
+}
+
+// Create stores a new job
+func (m *MemoryStore) Create(ctx context.Context, job *Job) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.create(job)
+}
+
+// create stores a new job; the caller holds the lock
+func (m *MemoryStore) create(job *Job) (*Job, error) {
+	if job.UniqueKey != "" {
+		for _, existing := range m.jobs {
+			if existing.TenantID == job.TenantID && existing.UniqueKey == job.UniqueKey && existing.Status == StatusScheduled {
+				return copyJob(existing), ErrDuplicate
+			}
+		}
+	}
+	if _, exists := m.jobs[job.ID]; exists {
+		return nil, fmt.Errorf("job %s already exists", job.ID)
+	}
+	m.jobs[job.ID] = copyJob(job)
+	return copyJob(job), nil
+}
+
+// Get returns a tenant's job
+func (m *MemoryStore) Get(ctx context.Context, tenantID, id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists || job.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	return copyJob(job), nil
+}
+
+// List returns a tenant's jobs matching query, newest first
+func (m *MemoryStore) List(ctx context.Context, tenantID string, query Query) ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range m.jobs {
+		if job.TenantID == tenantID && query.matches(job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].ID > jobs[j].ID
+		}
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	if query.Limit > 0 && len(jobs) > query.Limit {
+		jobs = jobs[:query.Limit]
+	}
+	return jobs, nil
+}
+
+// Claim marks due jobs running, earliest first
+func (m *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit, perTenant int) ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := make(map[string]int)
+	var due []*Job
+	for _, job := range m.jobs {
+		switch {
+		case job.Status == StatusScheduled && !job.RunAt.After(now):
+			due = append(due, job)
+		case job.Status == StatusRunning && job.LockedUntil.Before(now):
+			due = append(due, job)
+		case job.Status == StatusRunning:
+			running[job.TenantID]++
+		}
+	}
+	sortByRunAt(due)
+
+	var claimed []*Job
+	lockedUntil := now.Add(lease)
+	for _, job := range due {
+		if limit > 0 && len(claimed) >= limit {
+			break
+		}
+		if perTenant > 0 && running[job.TenantID] >= perTenant {
+			continue
+		}
+		running[job.TenantID]++
+		job.Status = StatusRunning
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		job.UpdatedAt = now
+		job.claim = newID()
+		claimed = append(claimed, copyJob(job))
+	}
+	return claimed, nil
+}
+
+// Finish records the outcome of a claimed job and creates next
+func (m *MemoryStore) Finish(ctx context.Context, job *Job, next *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.jobs[job.ID]
+	if !exists || existing.TenantID != job.TenantID {
+		return ErrNotFound
+	}
+	if existing.Status != StatusRunning || existing.claim != job.claim {
+		return ErrConflict
+	}
+	if next != nil {
+		if _, err := m.create(next); err != nil && !errors.Is(err, ErrDuplicate) {
+			return err
+		}
+	}
+	finished := copyJob(job)
+	finished.LockedUntil = nil
+	finished.claim = ""
+	m.jobs[job.ID] = finished
+	return nil
+}
+
+// Cancel cancels a scheduled or running job
+func (m *MemoryStore) Cancel(ctx context.Context, tenantID, id string, now time.Time) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists || job.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	if job.finished() {
+		return nil, ErrConflict
+	}
+	job.Status = StatusCancelled
+	job.LockedUntil = nil
+	job.FinishedAt = &now
+	job.UpdatedAt = now
+	job.claim = ""
+	return copyJob(job), nil
+}
+
+// Retry schedules a failed or cancelled job to run again
+func (m *MemoryStore) Retry(ctx context.Context, tenantID, id string, now time.Time) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists || job.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	if job.Status != StatusFailed && job.Status != StatusCancelled {
+		return nil, ErrConflict
+	}
+	job.Status = StatusScheduled
+	job.RunAt = now
+	job.Attempts = 0
+	job.LastError = ""
+	job.FinishedAt = nil
+	job.UpdatedAt = now
+	return copyJob(job), nil
+}
+
+// sortByRunAt orders jobs earliest first
+func sortByRunAt(jobs []*Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].RunAt.Equal(jobs[j].RunAt) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].RunAt.Before(jobs[j].RunAt)
+	})
+}
+
+// newID returns a random identifier
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
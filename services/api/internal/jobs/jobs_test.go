@@ -0,0 +1,709 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/httputil"
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+var start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// storeFactories returns a constructor for every backend available in this
+// environment
+func storeFactories(t *testing.T) map[string]func(t *testing.T) Store {
+	factories := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+	}
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		factories["postgres"] = func(t *testing.T) Store {
+			db, err := sql.Open("postgres", url)
+			if err != nil || db.Ping() != nil {
+				t.Skip("Database not accessible for testing")
+			}
+			// One connection, so the test schema stays on the search path
+			db.SetMaxOpenConns(1)
+			schema := fmt.Sprintf("jobs_test_%d", time.Now().UnixNano())
+			if _, err := db.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema); err != nil {
+				t.Fatalf("Failed to create test schema: %v", err)
+			}
+			t.Cleanup(func() {
+				db.Exec("DROP SCHEMA " + schema + " CASCADE")
+				db.Close()
+			})
+			store := NewPostgresStore(db)
+			if err := store.Migrate(context.Background()); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+			return store
+		}
+	}
+	return factories
+}
+
+// newJob returns a scheduled job due at runAt
+func newJob(tenantID, kind string, runAt time.Time) *Job {
+	return &Job{
+		ID:          newID(),
+		TenantID:    tenantID,
+		Kind:        kind,
+		Payload:     map[string]interface{}{"n": 1.0},
+		Status:      StatusScheduled,
+		RunAt:       runAt,
+		MaxAttempts: 3,
+		CreatedAt:   start,
+		UpdatedAt:   start,
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	testCases := []struct {
+		expression string
+		from       time.Time
+		expected   time.Time
+	}{
+		{"* * * * *", start, start.Add(time.Minute)},
+		{"*/15 * * * *", start.Add(time.Minute), start.Add(15 * time.Minute)},
+		{"30 9 * * *", start, time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", start, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC), time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", start, time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", start, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", start, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"5,10 1-2/1 * JAN *", start, time.Date(2025, 1, 1, 1, 5, 0, 0, time.UTC)},
+		{"@hourly", start.Add(time.Second), start.Add(time.Hour)},
+		{"@weekly", start, time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", start, time.Time{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expression, func(t *testing.T) {
+			schedule, err := ParseCron(tc.expression)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if next := schedule.Next(tc.from); !next.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, next)
+			}
+		})
+	}
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@sometimes"} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("Expected %q to be rejected", expression)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("UniqueKey", func(t *testing.T) {
+				store := factory(t)
+				first := newJob("t1", "event", start)
+				first.UniqueKey = "digest"
+				if _, err := store.Create(ctx, first); err != nil {
+					t.Fatalf("Create failed: %v", err)
+				}
+
+				second := newJob("t1", "event", start)
+				second.UniqueKey = "digest"
+				existing, err := store.Create(ctx, second)
+				if !errors.Is(err, ErrDuplicate) || existing == nil || existing.ID != first.ID {
+					t.Fatalf("Expected the first job as a duplicate, got %+v, %v", existing, err)
+				}
+
+				other := newJob("t2", "event", start)
+				other.UniqueKey = "digest"
+				if _, err := store.Create(ctx, other); err != nil {
+					t.Errorf("Expected keys to be scoped to the tenant, got %v", err)
+				}
+
+				// Once the first job runs, the key is free again
+				if _, err := store.Claim(ctx, start, time.Minute, 10, 0); err != nil {
+					t.Fatalf("Claim failed: %v", err)
+				}
+				if _, err := store.Create(ctx, second); err != nil {
+					t.Errorf("Expected the key to be free once the job runs, got %v", err)
+				}
+			})
+
+			t.Run("Claim", func(t *testing.T) {
+				store := factory(t)
+				for i := 0; i < 3; i++ {
+					store.Create(ctx, newJob("busy", "event", start.Add(time.Duration(i)*time.Second)))
+				}
+				store.Create(ctx, newJob("quiet", "event", start.Add(5*time.Second)))
+				store.Create(ctx, newJob("quiet", "event", start.Add(time.Hour)))
+
+				claimed, err := store.Claim(ctx, start.Add(10*time.Second), time.Minute, 10, 2)
+				if err != nil {
+					t.Fatalf("Claim failed: %v", err)
+				}
+				byTenant := map[string]int{}
+				for _, job := range claimed {
+					byTenant[job.TenantID]++
+					if job.Status != StatusRunning || job.Attempts != 1 || job.LockedUntil == nil {
+						t.Errorf("Expected a running first attempt, got %+v", job)
+					}
+				}
+				if byTenant["busy"] != 2 || byTenant["quiet"] != 1 {
+					t.Errorf("Expected 2 busy and 1 quiet job, got %v", byTenant)
+				}
+
+				// The busy tenant is at its limit until a lease expires
+				if again, _ := store.Claim(ctx, start.Add(20*time.Second), time.Minute, 10, 2); len(again) != 0 {
+					t.Errorf("Expected no jobs while the tenant is at its limit, got %d", len(again))
+				}
+				reclaimed, err := store.Claim(ctx, start.Add(2*time.Minute), time.Minute, 10, 2)
+				if err != nil || len(reclaimed) != 3 {
+					t.Fatalf("Expected expired leases reclaimed, got %d, %v", len(reclaimed), err)
+				}
+
+				// The original claims are no longer held
+				claimed[0].Status = StatusSucceeded
+				if err := store.Finish(ctx, claimed[0], nil); !errors.Is(err, ErrConflict) {
+					t.Errorf("Expected a lost claim to conflict, got %v", err)
+				}
+			})
+
+			t.Run("Lifecycle", func(t *testing.T) {
+				store := factory(t)
+				job := newJob("t1", "event", start)
+				store.Create(ctx, job)
+				claimed, _ := store.Claim(ctx, start, time.Minute, 1, 0)
+				if len(claimed) != 1 {
+					t.Fatalf("Expected the job claimed")
+				}
+
+				// Cancelling a running job drops the worker's outcome
+				cancelled, err := store.Cancel(ctx, "t1", job.ID, start)
+				if err != nil || cancelled.Status != StatusCancelled {
+					t.Fatalf("Expected the job cancelled, got %+v, %v", cancelled, err)
+				}
+				claimed[0].Status = StatusSucceeded
+				if err := store.Finish(ctx, claimed[0], nil); !errors.Is(err, ErrConflict) {
+					t.Errorf("Expected finishing a cancelled job to conflict, got %v", err)
+				}
+				if _, err := store.Cancel(ctx, "t1", job.ID, start); !errors.Is(err, ErrConflict) {
+					t.Errorf("Expected cancelling twice to conflict, got %v", err)
+				}
+
+				retried, err := store.Retry(ctx, "t1", job.ID, start.Add(time.Minute))
+				if err != nil || retried.Status != StatusScheduled || retried.Attempts != 0 || !retried.RunAt.Equal(start.Add(time.Minute)) {
+					t.Fatalf("Expected the job scheduled again, got %+v, %v", retried, err)
+				}
+				if _, err := store.Retry(ctx, "t1", job.ID, start); !errors.Is(err, ErrConflict) {
+					t.Errorf("Expected retrying a scheduled job to conflict, got %v", err)
+				}
+
+				claimed, _ = store.Claim(ctx, start.Add(time.Minute), time.Minute, 1, 0)
+				claimed[0].Status = StatusFailed
+				claimed[0].LastError = "boom"
+				finishedAt := start.Add(time.Minute)
+				claimed[0].FinishedAt = &finishedAt
+				if err := store.Finish(ctx, claimed[0], nil); err != nil {
+					t.Fatalf("Finish failed: %v", err)
+				}
+				stored, err := store.Get(ctx, "t1", job.ID)
+				if err != nil || stored.Status != StatusFailed || stored.LastError != "boom" || stored.LockedUntil != nil || stored.Payload["n"] != 1.0 {
+					t.Errorf("Expected the failure recorded, got %+v, %v", stored, err)
+				}
+
+				if _, err := store.Get(ctx, "t2", job.ID); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Expected another tenant's job to be not found, got %v", err)
+				}
+				if _, err := store.Cancel(ctx, "t1", "missing", start); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Expected an unknown job to be not found, got %v", err)
+				}
+				failed, _ := store.List(ctx, "t1", Query{Status: StatusFailed})
+				if len(failed) != 1 {
+					t.Errorf("Expected 1 failed job, got %d", len(failed))
+				}
+			})
+
+			t.Run("FinishCreatesNext", func(t *testing.T) {
+				store := factory(t)
+				store.Create(ctx, newJob("t1", "report", start))
+				claimed, _ := store.Claim(ctx, start, time.Minute, 1, 0)
+				if len(claimed) != 1 {
+					t.Fatalf("Expected the job claimed")
+				}
+
+				// A lost claim records nothing, not even the next occurrence
+				store.Cancel(ctx, "t1", claimed[0].ID, start)
+				claimed[0].Status = StatusSucceeded
+				lost := newJob("t1", "report", start.Add(time.Hour))
+				if err := store.Finish(ctx, claimed[0], lost); !errors.Is(err, ErrConflict) {
+					t.Fatalf("Expected a lost claim to conflict, got %v", err)
+				}
+				if _, err := store.Get(ctx, "t1", lost.ID); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Expected no next occurrence after a conflict, got %v", err)
+				}
+
+				store.Retry(ctx, "t1", claimed[0].ID, start)
+				claimed, _ = store.Claim(ctx, start, time.Minute, 1, 0)
+				claimed[0].Status = StatusSucceeded
+				finishedAt := start
+				claimed[0].FinishedAt = &finishedAt
+				next := newJob("t1", "report", start.Add(time.Hour))
+				next.UniqueKey = "hourly"
+				if err := store.Finish(ctx, claimed[0], next); err != nil {
+					t.Fatalf("Finish failed: %v", err)
+				}
+				if stored, err := store.Get(ctx, "t1", next.ID); err != nil || stored.Status != StatusScheduled || !stored.RunAt.Equal(start.Add(time.Hour)) {
+					t.Errorf("Expected the next occurrence scheduled, got %+v, %v", stored, err)
+				}
+
+				// A next occurrence whose unique key is taken is skipped
+				store.Create(ctx, newJob("t1", "report", start))
+				claimed, _ = store.Claim(ctx, start, time.Minute, 1, 0)
+				claimed[0].Status = StatusSucceeded
+				claimed[0].FinishedAt = &finishedAt
+				duplicate := newJob("t1", "report", start.Add(time.Hour))
+				duplicate.UniqueKey = "hourly"
+				if err := store.Finish(ctx, claimed[0], duplicate); err != nil {
+					t.Fatalf("Expected a duplicate next occurrence to be skipped, got %v", err)
+				}
+				if _, err := store.Get(ctx, "t1", duplicate.ID); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Expected the duplicate not created, got %v", err)
+				}
+				if stored, _ := store.Get(ctx, "t1", claimed[0].ID); stored.Status != StatusSucceeded {
+					t.Errorf("Expected the outcome recorded, got %+v", stored)
+				}
+			})
+		})
+	}
+}
+
+// testWorker returns a worker over a memory store whose clock reads now
+func testWorker(now *time.Time) (*Worker, *Scheduler, *MemoryStore) {
+	store := NewMemoryStore()
+	worker := NewWorker(store, Config{InitialBackoff: time.Second, MaxBackoff: time.Minute, Timeout: time.Second})
+	worker.now = func() time.Time { return *now }
+	scheduler := NewScheduler(store)
+	scheduler.now = func() time.Time { return *now }
+	return worker, scheduler, store
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RetriesWithBackoff", func(t *testing.T) {
+		now := start
+		worker, scheduler, store := testWorker(&now)
+		var calls int32
+		worker.Handle("flaky", func(ctx context.Context, job *Job) error {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return fmt.Errorf("try again")
+			}
+			return nil
+		})
+		job, _ := scheduler.Enqueue(ctx, "t1", "flaky", nil, Options{})
+
+		for attempt := 1; attempt <= 3; attempt++ {
+			if ran, err := worker.RunDue(ctx); err != nil || ran != 1 {
+				t.Fatalf("Attempt %d: expected the job to run, got %d, %v", attempt, ran, err)
+			}
+			stored, _ := store.Get(ctx, "t1", job.ID)
+			if attempt < 3 {
+				if stored.Status != StatusScheduled || stored.LastError != "try again" || !stored.RunAt.After(now) {
+					t.Fatalf("Attempt %d: expected a retry later, got %+v", attempt, stored)
+				}
+				if ran, _ := worker.RunDue(ctx); ran != 0 {
+					t.Fatalf("Expected the retry to wait for its backoff")
+				}
+				now = stored.RunAt
+				continue
+			}
+			if stored.Status != StatusSucceeded || stored.Attempts != 3 || stored.FinishedAt == nil {
+				t.Errorf("Expected success on the third attempt, got %+v", stored)
+			}
+		}
+	})
+
+	failures := []struct {
+		name     string
+		kind     string
+		handler  HandlerFunc
+		attempts int
+		expected string
+	}{
+		{"Permanent", "bad", func(ctx context.Context, job *Job) error { return Permanent(fmt.Errorf("malformed")) }, 1, "malformed"},
+		{"OutOfAttempts", "bad", func(ctx context.Context, job *Job) error { return fmt.Errorf("down") }, 2, "down"},
+		{"Panic", "bad", func(ctx context.Context, job *Job) error { panic("oops") }, 1, "job panicked: oops"},
+		{"Timeout", "bad", func(ctx context.Context, job *Job) error { <-ctx.Done(); return Permanent(ctx.Err()) }, 1, "deadline exceeded"},
+		{"NoHandler", "unknown", nil, 1, "no handler for job kind unknown"},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			now := start
+			worker, scheduler, store := testWorker(&now)
+			if tc.handler != nil {
+				worker.Handle(tc.kind, tc.handler)
+			}
+			job, _ := scheduler.Enqueue(ctx, "t1", tc.kind, nil, Options{MaxAttempts: 2})
+			for i := 0; i < tc.attempts; i++ {
+				worker.RunDue(ctx)
+				now = now.Add(time.Hour)
+			}
+			stored, _ := store.Get(ctx, "t1", job.ID)
+			if stored.Status != StatusFailed || stored.Attempts != tc.attempts || !strings.Contains(stored.LastError, tc.expected) {
+				t.Errorf("Expected failure %q after %d attempts, got %+v", tc.expected, tc.attempts, stored)
+			}
+		})
+	}
+
+	t.Run("Cron", func(t *testing.T) {
+		now := start
+		worker, scheduler, store := testWorker(&now)
+		worker.Handle("report", func(ctx context.Context, job *Job) error { return nil })
+		job, err := scheduler.Enqueue(ctx, "t1", "report", nil, Options{Cron: "0 * * * *"})
+		if err != nil || !job.RunAt.Equal(start.Add(time.Hour)) {
+			t.Fatalf("Expected the first occurrence at the next hour, got %+v, %v", job, err)
+		}
+		if _, err := scheduler.Enqueue(ctx, "t1", "report", nil, Options{Cron: "0 * * * *", UniqueKey: job.UniqueKey}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Expected occurrences to share a unique key, got %v", err)
+		}
+
+		now = start.Add(time.Hour)
+		worker.RunDue(ctx)
+		scheduled, _ := store.List(ctx, "t1", Query{Status: StatusScheduled})
+		if len(scheduled) != 1 || !scheduled[0].RunAt.Equal(start.Add(2*time.Hour)) || scheduled[0].Cron != job.Cron {
+			t.Fatalf("Expected the next occurrence at the following hour, got %+v", scheduled)
+		}
+
+		// Cancelling the scheduled occurrence ends the series
+		store.Cancel(ctx, "t1", scheduled[0].ID, now)
+		now = start.Add(2 * time.Hour)
+		if ran, _ := worker.RunDue(ctx); ran != 0 {
+			t.Errorf("Expected a cancelled series to stop")
+		}
+	})
+
+	t.Run("TenantConcurrency", func(t *testing.T) {
+		now := start
+		worker, scheduler, _ := testWorker(&now)
+		var mu sync.Mutex
+		running, peak := map[string]int{}, map[string]int{}
+		release := make(chan struct{})
+		worker.Handle("slow", func(ctx context.Context, job *Job) error {
+			mu.Lock()
+			running[job.TenantID]++
+			if running[job.TenantID] > peak[job.TenantID] {
+				peak[job.TenantID] = running[job.TenantID]
+			}
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running[job.TenantID]--
+			mu.Unlock()
+			return nil
+		})
+		for i := 0; i < 5; i++ {
+			scheduler.Enqueue(ctx, "busy", "slow", nil, Options{})
+		}
+		scheduler.Enqueue(ctx, "quiet", "slow", nil, Options{})
+
+		done := make(chan int)
+		go func() {
+			ran, _ := worker.RunDue(ctx)
+			done <- ran
+		}()
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		if ran := <-done; ran != 3 {
+			t.Errorf("Expected 2 busy jobs and 1 quiet job to run, got %d", ran)
+		}
+		if peak["busy"] != 2 {
+			t.Errorf("Expected at most 2 busy jobs at once, got %d", peak["busy"])
+		}
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		store := NewMemoryStore()
+		worker := NewWorker(store, Config{PollInterval: 10 * time.Millisecond})
+		finished := make(chan struct{})
+		worker.Handle("slow", func(ctx context.Context, job *Job) error {
+			time.Sleep(50 * time.Millisecond)
+			close(finished)
+			return nil
+		})
+		job, _ := NewScheduler(store).Enqueue(ctx, "t1", "slow", nil, Options{})
+
+		runCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			worker.Run(runCtx)
+			close(stopped)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-stopped
+
+		// Run waits for running jobs, which finish despite the shutdown
+		select {
+		case <-finished:
+		default:
+			t.Fatal("Expected Run to wait for the running job")
+		}
+		if stored, _ := store.Get(ctx, "t1", job.ID); stored.Status != StatusSucceeded {
+			t.Errorf("Expected the job to succeed, got %+v", stored)
+		}
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	now := start
+	_, scheduler, _ := testWorker(&now)
+
+	job, err := scheduler.Enqueue(ctx, "t1", KindEvent, nil, Options{Delay: time.Minute})
+	if err != nil || !job.RunAt.Equal(start.Add(time.Minute)) || job.MaxAttempts != DefaultMaxAttempts || job.Payload == nil {
+		t.Errorf("Expected a delayed job with defaults, got %+v, %v", job, err)
+	}
+
+	invalid := []Options{
+		{Delay: time.Minute, Cron: "@daily"},
+		{Delay: -time.Minute},
+		{Cron: "every day"},
+		{Cron: "0 0 30 2 *"},
+		{MaxAttempts: -1},
+	}
+	for _, opts := range invalid {
+		if _, err := scheduler.Enqueue(ctx, "t1", KindEvent, nil, opts); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", opts, err)
+		}
+	}
+	if _, err := scheduler.Enqueue(ctx, "", KindEvent, nil, Options{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a job without a tenant to be invalid, got %v", err)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	ctx := context.Background()
+	bus := pubsub.NewMemoryBus(pubsub.Config{Events: map[string][]string{"report.due": {"report"}}})
+	defer bus.Close()
+
+	now := start
+	worker, scheduler, store := testWorker(&now)
+	worker.Handle(KindEvent, EventHandler(bus))
+
+	registry := functions.NewFunctionRegistry()
+	type greetParams struct {
+		Name string `param:"name,required"`
+	}
+	var greeted []string
+	err := functions.RegisterAction(registry, functions.FunctionDefinition{Name: "greet"}, func(ctx context.Context, execCtx *types.ExecutionContext, p greetParams) error {
+		greeted = append(greeted, execCtx.TenantID+":"+p.Name)
+		return execCtx.EventService.Schedule(ctx, "report.due", map[string]interface{}{"report": p.Name}, time.Hour)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.Handle(KindFunction, FunctionHandler(registry, func(job *Job) *types.ExecutionContext {
+		return &types.ExecutionContext{TenantID: job.TenantID, EventService: NewEventService(bus, scheduler, job.TenantID)}
+	}))
+
+	greet, _ := scheduler.Enqueue(ctx, "t1", KindFunction, map[string]interface{}{"function": "greet", "params": map[string]interface{}{"name": "ada"}}, Options{})
+	missing, _ := scheduler.Enqueue(ctx, "t1", KindFunction, map[string]interface{}{"function": "missing"}, Options{})
+	undeclared, _ := scheduler.Enqueue(ctx, "t1", KindEvent, map[string]interface{}{"event": "nobody.cares"}, Options{})
+	// Two jobs per tenant run at once by default
+	worker.RunDue(ctx)
+	worker.RunDue(ctx)
+
+	if len(greeted) != 1 || greeted[0] != "t1:ada" {
+		t.Errorf("Expected the function to run for the tenant, got %v", greeted)
+	}
+	for id, expected := range map[string]Status{greet.ID: StatusSucceeded, missing.ID: StatusFailed, undeclared.ID: StatusFailed} {
+		if stored, _ := store.Get(ctx, "t1", id); stored.Status != expected {
+			t.Errorf("Expected %s, got %+v", expected, stored)
+		}
+	}
+
+	// The function scheduled an event for an hour later
+	events, _ := store.List(ctx, "t1", Query{Kind: KindEvent, Status: StatusScheduled})
+	if len(events) != 1 || !events[0].RunAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Expected a scheduled event, got %+v", events)
+	}
+	received := make(chan *pubsub.Event, 1)
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go bus.Subscribe(subCtx, pubsub.SubscribeOptions{Group: "test", Consumer: "test", FromStart: true}, func(ctx context.Context, event *pubsub.Event) error {
+		received <- event
+		return nil
+	})
+	now = start.Add(time.Hour)
+	worker.RunDue(ctx)
+	select {
+	case event := <-received:
+		if event.Name != "report.due" || event.TenantID != "t1" || event.Data["report"] != "ada" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the scheduled event to be published")
+	}
+}
+
+func TestHookHandler(t *testing.T) {
+	ctx := context.Background()
+	events := map[string][]string{"user.created": {"user_id"}}
+	bus := pubsub.NewMemoryBus(pubsub.Config{Events: events})
+	defer bus.Close()
+
+	now := start
+	worker, scheduler, store := testWorker(&now)
+
+	registry := functions.NewFunctionRegistry()
+	type greetParams struct {
+		Name     string `param:"name,required"`
+		Greeting string `param:"greeting"`
+	}
+	var greeted []string
+	err := functions.RegisterAction(registry, functions.FunctionDefinition{Name: "greet"}, func(ctx context.Context, execCtx *types.ExecutionContext, p greetParams) error {
+		greeted = append(greeted, execCtx.TenantID+":"+p.Greeting+" "+p.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.Handle(KindHook, HookHandler(registry, events, func(job *Job) *types.ExecutionContext {
+		return &types.ExecutionContext{TenantID: job.TenantID, EventService: NewEventService(bus, scheduler, job.TenantID)}
+	}))
+
+	received := make(chan *pubsub.Event, 1)
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go bus.Subscribe(subCtx, pubsub.SubscribeOptions{Group: "test", Consumer: "test", FromStart: true}, func(ctx context.Context, event *pubsub.Event) error {
+		received <- event
+		return nil
+	})
+
+	hook, _ := scheduler.Enqueue(ctx, "t1", KindHook, map[string]interface{}{
+		"hook": "setup_new_user",
+		"functions": []interface{}{
+			map[string]interface{}{"function": "greet", "config": map[string]interface{}{"name_field": "email", "greeting": "Hi {{name || 'there'}}"}},
+		},
+		"events": []interface{}{
+			map[string]interface{}{"event": "user.created", "data": map[string]interface{}{"user_id": "{{id}}"}},
+		},
+		"record": map[string]interface{}{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+	}, Options{})
+	code, _ := scheduler.Enqueue(ctx, "t1", KindHook, map[string]interface{}{"hook": "provision", "code": "async function provision() {}"}, Options{})
+	missing, _ := scheduler.Enqueue(ctx, "t2", KindHook, map[string]interface{}{
+		"hook":      "setup_new_user",
+		"functions": []interface{}{map[string]interface{}{"function": "missing"}},
+	}, Options{})
+	invalid, _ := scheduler.Enqueue(ctx, "t2", KindHook, map[string]interface{}{
+		"hook": "setup_new_user",
+		"functions": []interface{}{
+			map[string]interface{}{"function": "greet", "config": map[string]interface{}{"name_field": "email"}},
+		},
+		"events": []interface{}{
+			map[string]interface{}{"event": "user.created", "data": map[string]interface{}{"id": "{{id}}"}},
+		},
+		"record": map[string]interface{}{"id": "u2", "email": "bob@example.com"},
+	}, Options{})
+	worker.RunDue(ctx)
+	worker.RunDue(ctx)
+
+	// The hook with an undeclared event field fails before greeting anyone
+	if len(greeted) != 1 || greeted[0] != "t1:Hi Ada ada@example.com" {
+		t.Errorf("Expected the hook's function to run with params from the record, got %v", greeted)
+	}
+	for _, job := range []struct {
+		tenant   string
+		id       string
+		expected Status
+	}{{"t1", hook.ID, StatusSucceeded}, {"t1", code.ID, StatusFailed}, {"t2", missing.ID, StatusFailed}, {"t2", invalid.ID, StatusFailed}} {
+		if stored, _ := store.Get(ctx, job.tenant, job.id); stored.Status != job.expected {
+			t.Errorf("Expected %s, got %+v", job.expected, stored)
+		}
+	}
+	select {
+	case event := <-received:
+		if event.Name != "user.created" || event.TenantID != "t1" || event.Data["user_id"] != "u1" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the hook's event to be published")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := NewMemoryStore()
+	server := httptest.NewServer(NewHandler(store, NewScheduler(store)).Routes())
+	defer server.Close()
+
+	request := func(method, path, tenant, body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		if tenant != "" {
+			req.Header.Set(httputil.TenantHeader, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var decoded map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+
+	status, body := request("POST", "/", "t1", `{"kind": "event", "payload": {"event": "report.due"}, "delay": "1h", "unique_key": "report"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %v", status, body)
+	}
+	id := body["data"].(map[string]interface{})["id"].(string)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		tenant   string
+		body     string
+		expected int
+	}{
+		{"NoTenant", "GET", "/", "", "", http.StatusUnauthorized},
+		{"Duplicate", "POST", "/", "t1", `{"kind": "event", "payload": {}, "unique_key": "report"}`, http.StatusConflict},
+		{"UnknownKind", "POST", "/", "t1", `{"kind": "shell"}`, http.StatusBadRequest},
+		{"InvalidCron", "POST", "/", "t1", `{"kind": "event", "cron": "daily"}`, http.StatusBadRequest},
+		{"InvalidDelay", "POST", "/", "t1", `{"kind": "event", "delay": "soon"}`, http.StatusBadRequest},
+		{"InvalidStatus", "GET", "/?status=done", "t1", "", http.StatusBadRequest},
+		{"List", "GET", "/?status=scheduled", "t1", "", http.StatusOK},
+		{"Get", "GET", "/" + id, "t1", "", http.StatusOK},
+		{"OtherTenant", "GET", "/" + id, "t2", "", http.StatusNotFound},
+		{"RetryScheduled", "POST", "/" + id + "/retry", "t1", "", http.StatusConflict},
+		{"Cancel", "POST", "/" + id + "/cancel", "t1", "", http.StatusOK},
+		{"CancelAgain", "POST", "/" + id + "/cancel", "t1", "", http.StatusConflict},
+		{"Retry", "POST", "/" + id + "/retry", "t1", "", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, body := request(tc.method, tc.path, tc.tenant, tc.body); status != tc.expected {
+				t.Errorf("Expected %d, got %d: %v", tc.expected, status, body)
+			}
+		})
+	}
+
+	_, body = request("GET", "/", "t1", "")
+	if jobs := body["data"].([]interface{}); len(jobs) != 1 || jobs[0].(map[string]interface{})["status"] != "scheduled" {
+		t.Errorf("Expected the retried job scheduled, got %v", jobs)
+	}
+}
@@ -0,0 +1,391 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresSchema creates the jobs table. Due jobs are found through a
+// partial index on run_at, and running jobs are counted per tenant through
+// another.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id           TEXT PRIMARY KEY,
+	tenant_id    TEXT NOT NULL,
+	kind         TEXT NOT NULL,
+	payload      JSONB NOT NULL DEFAULT '{}',
+	status       TEXT NOT NULL,
+	unique_key   TEXT,
+	cron         TEXT,
+	run_at       TIMESTAMPTZ NOT NULL,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	last_error   TEXT,
+	locked_until TIMESTAMPTZ,
+	claim        TEXT,
+	created_at   TIMESTAMPTZ NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL,
+	finished_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS jobs_due ON jobs (run_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS jobs_running ON jobs (tenant_id, locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_tenant ON jobs (tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS jobs_unique ON jobs (tenant_id, unique_key) WHERE status = 'scheduled';
+`
+
+const jobColumns = `id, tenant_id, kind, payload, status, unique_key, cron, run_at, attempts,
+	max_attempts, last_error, locked_until, claim, created_at, updated_at, finished_at`
+
+// PostgresStore is a Store in a Postgres table. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so they never wait on each other's
+// claims, and take a transaction-scoped advisory lock per tenant while
+// counting the tenant's running jobs, so concurrent claims can't exceed the
+// tenant's limit.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store over db. Call Migrate to create the
+// table.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// OpenPostgresStore connects to the database at url and creates the jobs
+// table if needed
+func OpenPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to job database: %w", err)
+	}
+	store := NewPostgresStore(db)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Migrate creates the jobs table and its indexes
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("failed to create jobs table: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// withTx runs fn in a transaction, committing when it returns nil
+func (s *PostgresStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var (
+		job                             Job
+		payload                         []byte
+		uniqueKey, cron, lastErr, claim sql.NullString
+		lockedUntil, finishedAt         sql.NullTime
+	)
+	err := row.Scan(&job.ID, &job.TenantID, &job.Kind, &payload, &job.Status, &uniqueKey, &cron,
+		&job.RunAt, &job.Attempts, &job.MaxAttempts, &lastErr, &lockedUntil, &claim,
+		&job.CreatedAt, &job.UpdatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, &job.Payload); err != nil {
+		return nil, fmt.Errorf("invalid payload for job %s: %w", job.ID, err)
+	}
+	job.UniqueKey, job.Cron, job.LastError, job.claim = uniqueKey.String, cron.String, lastErr.String, claim.String
+	job.RunAt, job.CreatedAt, job.UpdatedAt = job.RunAt.UTC(), job.CreatedAt.UTC(), job.UpdatedAt.UTC()
+	if lockedUntil.Valid {
+		t := lockedUntil.Time.UTC()
+		job.LockedUntil = &t
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time.UTC()
+		job.FinishedAt = &t
+	}
+	return &job, nil
+}
+
+func scanJobs(rows *sql.Rows) ([]*Job, error) {
+	defer rows.Close()
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// Create stores a new job. Creating jobs with the same unique key is
+// serialized by an advisory lock on the key.
+func (s *PostgresStore) Create(ctx context.Context, job *Job) (*Job, error) {
+	var existing *Job
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		existing, err = s.create(ctx, tx, job)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	if existing != nil {
+		return existing, ErrDuplicate
+	}
+	return copyJob(job), nil
+}
+
+// create inserts a job in tx, unless a scheduled job of the tenant has its
+// unique key, which it returns instead
+func (s *PostgresStore) create(ctx context.Context, tx *sql.Tx, job *Job) (*Job, error) {
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	if job.UniqueKey != "" {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`,
+			"jobs:"+job.TenantID+":"+job.UniqueKey); err != nil {
+			return nil, err
+		}
+		found, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs
+			WHERE tenant_id = $1 AND unique_key = $2 AND status = 'scheduled' LIMIT 1`,
+			job.TenantID, job.UniqueKey))
+		if err == nil {
+			return found, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO jobs (id, tenant_id, kind, payload, status, unique_key,
+		cron, run_at, attempts, max_attempts, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		job.ID, job.TenantID, job.Kind, payload, job.Status, nullString(job.UniqueKey),
+		nullString(job.Cron), job.RunAt, job.Attempts, job.MaxAttempts, nullString(job.LastError),
+		job.CreatedAt, job.UpdatedAt)
+	return nil, err
+}
+
+// Get returns a tenant's job
+func (s *PostgresStore) Get(ctx context.Context, tenantID, id string) (*Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs
+		WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// List returns a tenant's jobs matching query, newest first
+func (s *PostgresStore) List(ctx context.Context, tenantID string, query Query) ([]*Job, error) {
+	limit := sql.NullInt64{Int64: int64(query.Limit), Valid: query.Limit > 0}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs
+		WHERE tenant_id = $1 AND ($2 = '' OR status = $2) AND ($3 = '' OR kind = $3)
+		ORDER BY created_at DESC, id DESC LIMIT $4`,
+		tenantID, string(query.Status), query.Kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// Claim marks due jobs running, earliest first. Candidates are locked with
+// SKIP LOCKED, so jobs another worker is claiming are passed over; tenants
+// another worker is claiming for are passed over until the next poll.
+func (s *PostgresStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit, perTenant int) ([]*Job, error) {
+	var claimed []*Job
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Look past the limit, as some candidates may belong to tenants
+		// that are at theirs
+		candidates := limit
+		if perTenant > 0 {
+			candidates = limit * 4
+		}
+		rows, err := tx.QueryContext(ctx, `SELECT id, tenant_id FROM jobs
+			WHERE (status = 'scheduled' AND run_at <= $1) OR (status = 'running' AND locked_until < $1)
+			ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED`, now, candidates)
+		if err != nil {
+			return err
+		}
+		type candidate struct{ id, tenantID string }
+		var due []candidate
+		for rows.Next() {
+			var c candidate
+			if err := rows.Scan(&c.id, &c.tenantID); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Free slots by tenant; -1 marks tenants being claimed elsewhere
+		slots := make(map[string]int)
+		var ids []string
+		for _, c := range due {
+			if len(ids) >= limit {
+				break
+			}
+			if perTenant > 0 {
+				free, known := slots[c.tenantID]
+				if !known {
+					if free, err = s.tenantSlots(ctx, tx, c.tenantID, now, perTenant); err != nil {
+						return err
+					}
+				}
+				if free <= 0 {
+					slots[c.tenantID] = free
+					continue
+				}
+				slots[c.tenantID] = free - 1
+			}
+			ids = append(ids, c.id)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		rows, err = tx.QueryContext(ctx, `UPDATE jobs
+			SET status = 'running', attempts = attempts + 1, locked_until = $2,
+				claim = md5(random()::text || id), updated_at = $3
+			WHERE id = ANY($1)
+			RETURNING `+jobColumns, pq.Array(ids), now.Add(lease), now)
+		if err != nil {
+			return err
+		}
+		claimed, err = scanJobs(rows)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %w", err)
+	}
+	sortByRunAt(claimed)
+	return claimed, nil
+}
+
+// tenantSlots returns how many more of a tenant's jobs may run, or -1 when
+// another worker holds the tenant's lock
+func (s *PostgresStore) tenantSlots(ctx context.Context, tx *sql.Tx, tenantID string, now time.Time, perTenant int) (int, error) {
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock(hashtextextended($1, 0))`,
+		"jobs:"+tenantID).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return -1, nil
+	}
+	var running int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM jobs
+		WHERE tenant_id = $1 AND status = 'running' AND locked_until >= $2`, tenantID, now).Scan(&running); err != nil {
+		return 0, err
+	}
+	return perTenant - running, nil
+}
+
+// Finish records the outcome of a claimed job and creates next in the same
+// transaction, so a recurring job's series can't end between the two
+func (s *PostgresStore) Finish(ctx context.Context, job *Job, next *Job) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE jobs
+			SET status = $3, run_at = $4, last_error = $5, finished_at = $6, updated_at = $7,
+				locked_until = NULL, claim = NULL
+			WHERE tenant_id = $1 AND id = $2 AND status = 'running' AND claim = $8`,
+			job.TenantID, job.ID, job.Status, job.RunAt, nullString(job.LastError), job.FinishedAt,
+			job.UpdatedAt, job.claim)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrConflict
+		}
+		if next != nil {
+			_, err = s.create(ctx, tx, next)
+		}
+		return err
+	})
+	if errors.Is(err, ErrConflict) {
+		if _, err := s.Get(ctx, job.TenantID, job.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+// Cancel cancels a scheduled or running job
+func (s *PostgresStore) Cancel(ctx context.Context, tenantID, id string, now time.Time) (*Job, error) {
+	return s.transition(ctx, tenantID, id, `UPDATE jobs
+		SET status = 'cancelled', finished_at = $3, updated_at = $3, locked_until = NULL, claim = NULL
+		WHERE tenant_id = $1 AND id = $2 AND status IN ('scheduled', 'running')
+		RETURNING `+jobColumns, now)
+}
+
+// Retry schedules a failed or cancelled job to run again
+func (s *PostgresStore) Retry(ctx context.Context, tenantID, id string, now time.Time) (*Job, error) {
+	return s.transition(ctx, tenantID, id, `UPDATE jobs
+		SET status = 'scheduled', run_at = $3, updated_at = $3, attempts = 0, last_error = NULL,
+			finished_at = NULL
+		WHERE tenant_id = $1 AND id = $2 AND status IN ('failed', 'cancelled')
+		RETURNING `+jobColumns, now)
+}
+
+// transition runs an update guarded by the job's status, telling a missing
+// job apart from one in the wrong status
+func (s *PostgresStore) transition(ctx context.Context, tenantID, id, query string, now time.Time) (*Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, tenantID, id, now))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return job, err
+	}
+	if _, err := s.Get(ctx, tenantID, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrConflict
+}
@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/pubsub"
+)
+
+// Job kinds run by the handlers this package provides
+const (
+	// KindEvent publishes payload.event with payload.data
+	KindEvent = "event"
+
+	// KindFunction executes payload.function with payload.params
+	KindFunction = "function"
+
+	// KindHook runs an async hook for payload.record: each of
+	// payload.functions is called in turn, then each of payload.events is
+	// published
+	KindHook = "hook"
+)
+
+// DefaultMaxAttempts is how many times a job runs before it fails, unless
+// it sets its own limit
+const DefaultMaxAttempts = 5
+
+// Options say when and how a job runs. At most one of RunAt, Delay and Cron
+// may be set; without any of them the job runs as soon as a worker is free.
+type Options struct {
+	RunAt time.Time
+	Delay time.Duration
+
+	// Cron runs the job on a cron schedule; see ParseCron
+	Cron string
+
+	// UniqueKey keeps the job from being scheduled twice; see Job.UniqueKey
+	UniqueKey string
+
+	// MaxAttempts defaults to DefaultMaxAttempts
+	MaxAttempts int
+}
+
+// Scheduler schedules jobs
+type Scheduler struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewScheduler creates a scheduler over store
+func NewScheduler(store Store) *Scheduler {
+	return &Scheduler{store: store, now: time.Now}
+}
+
+// Enqueue schedules a job of kind for a tenant. When opts.UniqueKey matches
+// a job that is still scheduled, that job is returned instead, along with
+// ErrDuplicate.
+func (s *Scheduler) Enqueue(ctx context.Context, tenantID, kind string, payload map[string]interface{}, opts Options) (*Job, error) {
+	if tenantID == "" {
+		return nil, invalid("tenant ID is required")
+	}
+	if kind == "" {
+		return nil, invalid("job kind is required")
+	}
+
+	set := 0
+	for _, isSet := range []bool{!opts.RunAt.IsZero(), opts.Delay != 0, opts.Cron != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, invalid("only one of run_at, delay and cron may be set")
+	}
+	if opts.Delay < 0 {
+		return nil, invalid("delay must not be negative")
+	}
+	if opts.MaxAttempts < 0 {
+		return nil, invalid("max attempts must not be negative")
+	}
+
+	now := s.now().UTC()
+	job := &Job{
+		ID:          newID(),
+		TenantID:    tenantID,
+		Kind:        kind,
+		Payload:     payload,
+		Status:      StatusScheduled,
+		UniqueKey:   opts.UniqueKey,
+		Cron:        opts.Cron,
+		RunAt:       now.Add(opts.Delay),
+		MaxAttempts: opts.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if job.Payload == nil {
+		job.Payload = map[string]interface{}{}
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	if !opts.RunAt.IsZero() {
+		job.RunAt = opts.RunAt.UTC()
+	}
+	if opts.Cron != "" {
+		schedule, err := ParseCron(opts.Cron)
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		if job.RunAt = schedule.Next(now); job.RunAt.IsZero() {
+			return nil, invalid("cron expression %q never matches", opts.Cron)
+		}
+		// Occurrences share a key, so a recurring job never has two
+		// scheduled at once
+		if job.UniqueKey == "" {
+			job.UniqueKey = "cron:" + job.ID
+		}
+	}
+
+	return s.store.Create(ctx, job)
+}
+
+// invalid returns an ErrInvalid error
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// EventService publishes a tenant's events now through the bus, or later
+// through the scheduler. It implements types.EventService for function
+// execution contexts.
+type EventService struct {
+	*pubsub.EventService
+	scheduler *Scheduler
+	tenantID  string
+}
+
+// NewEventService creates an event service scoped to a tenant
+func NewEventService(bus pubsub.Bus, scheduler *Scheduler, tenantID string) *EventService {
+	return &EventService{
+		EventService: pubsub.NewEventService(bus, tenantID),
+		scheduler:    scheduler,
+		tenantID:     tenantID,
+	}
+}
+
+// Schedule publishes an event once delay has passed
+func (s *EventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error {
+	_, err := s.scheduler.Enqueue(ctx, s.tenantID, KindEvent, map[string]interface{}{
+		"event": event,
+		"data":  data,
+	}, Options{Delay: delay})
+	if err != nil {
+		return fmt.Errorf("failed to schedule %s: %w", event, err)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/retry"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+// HandlerFunc runs a job. Returning an error retries the job with backoff
+// until it runs out of attempts; errors wrapped with Permanent fail it at
+// once.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// PermanentError marks a job failure that retrying cannot fix, such as a
+// malformed payload
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so the job is not retried
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether a job failure should not be retried
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Config configures a Worker
+type Config struct {
+	// Concurrency is how many jobs run at once; defaults to 10
+	Concurrency int
+
+	// TenantConcurrency is how many of a tenant's jobs run at once across
+	// all workers sharing the store; defaults to 2
+	TenantConcurrency int
+
+	// Timeout bounds each attempt; defaults to 5m
+	Timeout time.Duration
+
+	// Lease is how long a claimed job is hidden from other workers. It
+	// must outlast Timeout; defaults to Timeout plus a minute.
+	Lease time.Duration
+
+	// InitialBackoff is the delay before the first retry; each later retry
+	// waits twice as long, up to MaxBackoff. They default to 10s and 1h.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// PollInterval is how often due jobs are checked; defaults to 1s
+	PollInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Concurrency <= 0 {
+		c.Concurrency = 10
+	}
+	if c.TenantConcurrency <= 0 {
+		c.TenantConcurrency = 2
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Minute
+	}
+	if c.Lease <= c.Timeout {
+		c.Lease = c.Timeout + time.Minute
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 10 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Hour
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	return c
+}
+
+// Worker claims due jobs and runs them
+type Worker struct {
+	store  Store
+	config Config
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// NewWorker creates a worker over store. Register handlers with Handle
+// before running it.
+func NewWorker(store Store, config Config) *Worker {
+	return &Worker{
+		store:    store,
+		config:   config.withDefaults(),
+		now:      time.Now,
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers the handler for a job kind
+func (w *Worker) Handle(kind string, handler HandlerFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[kind] = handler
+}
+
+func (w *Worker) handler(kind string) HandlerFunc {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.handlers[kind]
+}
+
+// Run runs due jobs until ctx is cancelled. It then stops claiming jobs and
+// returns once the jobs it is running have finished.
+func (w *Worker) Run(ctx context.Context) error {
+	slots := make(chan struct{}, w.config.Concurrency)
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	for {
+		free := cap(slots) - len(slots)
+		claimed := 0
+		if free > 0 {
+			jobs, err := w.claim(ctx, free)
+			if err != nil {
+				log.Printf("Job worker failed to claim jobs: %v", err)
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				running.Add(1)
+				go func(job *Job) {
+					defer func() {
+						<-slots
+						running.Done()
+					}()
+					w.run(ctx, job)
+				}(job)
+			}
+			claimed = len(jobs)
+		}
+
+		// Keep claiming while jobs are due and slots are free
+		if claimed > 0 && claimed == free {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(w.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RunDue claims as many due jobs as the worker runs at once, runs them and
+// returns how many ran
+func (w *Worker) RunDue(ctx context.Context) (int, error) {
+	jobs, err := w.claim(ctx, w.config.Concurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	var running sync.WaitGroup
+	for _, job := range jobs {
+		running.Add(1)
+		go func(job *Job) {
+			defer running.Done()
+			w.run(ctx, job)
+		}(job)
+	}
+	running.Wait()
+	return len(jobs), nil
+}
+
+func (w *Worker) claim(ctx context.Context, limit int) ([]*Job, error) {
+	return w.store.Claim(ctx, w.now().UTC(), w.config.Lease, limit, w.config.TenantConcurrency)
+}
+
+// run runs one claimed job and records the outcome. Jobs run to completion
+// when ctx is cancelled, bounded by the worker's timeout.
+func (w *Worker) run(ctx context.Context, job *Job) {
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	switch handler := w.handler(job.Kind); {
+	case job.Attempts > job.MaxAttempts:
+		// Only a worker that stopped mid-job leaves it to be claimed again
+		// past its last attempt
+		err = Permanent(fmt.Errorf("gave up after %d attempts", job.MaxAttempts))
+	case handler == nil:
+		err = Permanent(fmt.Errorf("no handler for job kind %s", job.Kind))
+	default:
+		runCtx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+		err = call(runCtx, handler, job)
+		cancel()
+	}
+	w.finish(ctx, job, err)
+}
+
+// call runs a handler, returning a panic as a permanent failure
+func call(ctx context.Context, handler HandlerFunc, job *Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Job %s (%s) panicked: %v\n%s", job.ID, job.Kind, recovered, debug.Stack())
+			err = Permanent(fmt.Errorf("job panicked: %v", recovered))
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// finish records a job's outcome and, once a recurring job's occurrence is
+// final, schedules the next one along with it
+func (w *Worker) finish(ctx context.Context, job *Job, runErr error) {
+	now := w.now().UTC()
+	job.UpdatedAt = now
+
+	switch {
+	case runErr == nil:
+		job.Status = StatusSucceeded
+		job.LastError = ""
+		job.FinishedAt = &now
+	case IsPermanent(runErr) || job.Attempts >= job.MaxAttempts:
+		job.Status = StatusFailed
+		job.LastError = runErr.Error()
+		job.FinishedAt = &now
+	default:
+		backoff := retry.Policy{InitialBackoff: w.config.InitialBackoff, MaxBackoff: w.config.MaxBackoff}
+		job.Status = StatusScheduled
+		job.LastError = runErr.Error()
+		job.RunAt = now.Add(backoff.Backoff(job.Attempts))
+	}
+
+	var next *Job
+	if job.finished() && job.Cron != "" {
+		next = nextOccurrence(job, now)
+	}
+
+	if err := w.store.Finish(ctx, job, next); err != nil {
+		if errors.Is(err, ErrConflict) {
+			log.Printf("Job %s was cancelled or reclaimed while running; its outcome is dropped", job.ID)
+		} else {
+			log.Printf("Failed to record outcome of job %s: %v", job.ID, err)
+		}
+		return
+	}
+	if job.Status == StatusFailed {
+		log.Printf("Job %s (%s) failed after %d attempts: %s", job.ID, job.Kind, job.Attempts, job.LastError)
+	}
+}
+
+// nextOccurrence returns the occurrence of a recurring job following now,
+// or nil when its schedule has no more
+func nextOccurrence(job *Job, now time.Time) *Job {
+	schedule, err := ParseCron(job.Cron)
+	if err != nil {
+		log.Printf("Recurring job %s stopped: %v", job.ID, err)
+		return nil
+	}
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return nil
+	}
+
+	return &Job{
+		ID:          newID(),
+		TenantID:    job.TenantID,
+		Kind:        job.Kind,
+		Payload:     job.Payload,
+		Status:      StatusScheduled,
+		UniqueKey:   job.UniqueKey,
+		Cron:        job.Cron,
+		RunAt:       next,
+		MaxAttempts: job.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// EventHandler publishes KindEvent jobs' events on bus
+func EventHandler(bus pubsub.Bus) HandlerFunc {
+	return func(ctx context.Context, job *Job) error {
+		name, _ := job.Payload["event"].(string)
+		if name == "" {
+			return Permanent(fmt.Errorf("payload.event is required"))
+		}
+		data, _ := job.Payload["data"].(map[string]interface{})
+		err := bus.Publish(ctx, &pubsub.Event{Name: name, TenantID: job.TenantID, Data: data})
+		if errors.Is(err, pubsub.ErrInvalidEvent) {
+			return Permanent(err)
+		}
+		return err
+	}
+}
+
+// FunctionHandler executes KindFunction jobs' functions. execCtx provides
+// the services each job's function runs with.
+func FunctionHandler(registry *functions.FunctionRegistry, execCtx func(job *Job) *types.ExecutionContext) HandlerFunc {
+	return func(ctx context.Context, job *Job) error {
+		name, _ := job.Payload["function"].(string)
+		if name == "" {
+			return Permanent(fmt.Errorf("payload.function is required"))
+		}
+		if _, exists := registry.Get(name); !exists {
+			return Permanent(fmt.Errorf("function %s not found", name))
+		}
+		params, _ := job.Payload["params"].(map[string]interface{})
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		_, err := registry.Execute(ctx, name, params, execCtx(job))
+		return err
+	}
+}
+
+// hookPayload is a KindHook job's payload: the hook as its schema declares
+// it, and the record it runs for
+type hookPayload struct {
+	Hook      string `json:"hook"`
+	Functions []struct {
+		Function string                 `json:"function"`
+		Config   map[string]interface{} `json:"config"`
+	} `json:"functions"`
+	Events []struct {
+		Event string                 `json:"event"`
+		Data  map[string]interface{} `json:"data"`
+	} `json:"events"`
+	Code   string                 `json:"code"`
+	Record map[string]interface{} `json:"record"`
+}
+
+// HookHandler runs KindHook jobs' hooks. Each function's params are built
+// from its config and the record, as functions.CallParams describes. A
+// retried job runs every function again, so hooks should tolerate repeats.
+// execCtx provides the services each job's functions run with, and its
+// EventService publishes the hook's events. The events are checked against
+// events, the schema's declared events, before any function runs, so a hook
+// that can't publish them fails without side effects.
+func HookHandler(registry *functions.FunctionRegistry, events map[string][]string, execCtx func(job *Job) *types.ExecutionContext) HandlerFunc {
+	return func(ctx context.Context, job *Job) error {
+		encoded, err := json.Marshal(job.Payload)
+		if err != nil {
+			return Permanent(err)
+		}
+		var hook hookPayload
+		if err := json.Unmarshal(encoded, &hook); err != nil {
+			return Permanent(fmt.Errorf("invalid hook payload: %w", err))
+		}
+		switch {
+		case hook.Hook == "":
+			return Permanent(fmt.Errorf("payload.hook is required"))
+		case hook.Code != "":
+			return Permanent(fmt.Errorf("hook %s is inline code, which can't be run", hook.Hook))
+		}
+
+		defs := make([]*functions.FunctionDefinition, len(hook.Functions))
+		for i, call := range hook.Functions {
+			def, exists := registry.Get(call.Function)
+			if !exists {
+				return Permanent(fmt.Errorf("function %s not found", call.Function))
+			}
+			defs[i] = def
+		}
+		published := make([]*pubsub.Event, len(hook.Events))
+		for i, call := range hook.Events {
+			data, _ := functions.ExpandTemplates(call.Data, hook.Record).(map[string]interface{})
+			published[i] = &pubsub.Event{Name: call.Event, Data: data}
+			if err := pubsub.ValidateEvent(events, published[i]); err != nil {
+				return Permanent(err)
+			}
+		}
+
+		ec := execCtx(job)
+		for i, call := range hook.Functions {
+			params, err := functions.CallParams(defs[i], call.Config, hook.Record)
+			if err != nil {
+				return Permanent(fmt.Errorf("%s: %w", call.Function, err))
+			}
+			if _, err := registry.Execute(ctx, call.Function, params, ec); err != nil {
+				return fmt.Errorf("%s: %w", call.Function, err)
+			}
+		}
+		for _, event := range published {
+			err := ec.EventService.Publish(ctx, event.Name, event.Data)
+			if errors.Is(err, pubsub.ErrInvalidEvent) {
+				return Permanent(err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package pubsub
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaEvents is the part of a schema file declaring its events, and the
+// events its hooks publish
+type schemaEvents struct {
+	Events map[string]struct {
+		Fields []string `yaml:"fields"`
+	} `yaml:"events"`
+	Functions map[string]struct {
+		Events []struct {
+			Event string                 `yaml:"event"`
+			Data  map[string]interface{} `yaml:"data"`
+		} `yaml:"events"`
+	} `yaml:"platform_functions"`
+}
+
+// ParseEvents reads the events section of a schema document and returns each
+// event's declared fields, for use as Config.Events. Every event a hook in
+// platform_functions publishes must pass ValidateEvent, so a hook can't be
+// declared with data its events would be rejected for.
+func ParseEvents(data []byte) (map[string][]string, error) {
+	var doc schemaEvents
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse schema events: %w", err)
+	}
+
+	events := make(map[string][]string, len(doc.Events))
+	for name, event := range doc.Events {
+		events[name] = event.Fields
+	}
+
+	hooks := make([]string, 0, len(doc.Functions))
+	for name := range doc.Functions {
+		hooks = append(hooks, name)
+	}
+	sort.Strings(hooks)
+	for _, hook := range hooks {
+		for _, call := range doc.Functions[hook].Events {
+			if err := ValidateEvent(events, &Event{Name: call.Event, Data: call.Data}); err != nil {
+				return nil, fmt.Errorf("platform function %s: %w", hook, err)
+			}
+		}
+	}
+	return events, nil
+}
+
+// LoadEvents reads the events section of a schema file
+func LoadEvents(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+	}
+	return ParseEvents(data)
+}
@@ -0,0 +1,185 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBus is an in-process Bus for tests. It keeps the Redis backend's
+// semantics: events are stored encoded, groups track their own position, and
+// unacknowledged events are redelivered after the redelivery timeout.
+type MemoryBus struct {
+	config Config
+
+	mu          sync.Mutex
+	stream      [][]byte
+	groups      map[string]*memoryGroup
+	deadLetters []*Event
+	notify      chan struct{}
+	closed      chan struct{}
+}
+
+// memoryGroup is a consumer group's position and pending events
+type memoryGroup struct {
+	next    int
+	pending map[int]*memoryPending // by stream index
+}
+
+type memoryPending struct {
+	deliveries  int
+	deliveredAt time.Time
+}
+
+// NewMemoryBus creates an in-memory bus
+func NewMemoryBus(config Config) *MemoryBus {
+	return &MemoryBus{
+		config: config.withDefaults(),
+		groups: make(map[string]*memoryGroup),
+		notify: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// Publish validates an event and appends it to the stream
+func (b *MemoryBus) Publish(ctx context.Context, event *Event) error {
+	payload, err := prepareEvent(b.config, event)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+		return ErrClosed
+	default:
+	}
+
+	b.stream = append(b.stream, payload)
+
+	// Wake every waiting subscriber
+	close(b.notify)
+	b.notify = make(chan struct{})
+	return nil
+}
+
+// Subscribe delivers events to handler until ctx is cancelled
+func (b *MemoryBus) Subscribe(ctx context.Context, opts SubscribeOptions, handler Handler) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if _, exists := b.groups[opts.Group]; !exists {
+		group := &memoryGroup{pending: make(map[int]*memoryPending)}
+		if !opts.FromStart {
+			group.next = len(b.stream)
+		}
+		b.groups[opts.Group] = group
+	}
+	b.mu.Unlock()
+
+	for {
+		index, payload, attempt, wait := b.claim(opts.Group)
+		if payload == nil {
+			timer := time.NewTimer(b.config.PollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-b.closed:
+				timer.Stop()
+				return ErrClosed
+			case <-wait:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		event, err := decodeEvent(payload, attempt)
+		if err != nil || !opts.wants(event.Name) {
+			b.ack(opts.Group, index)
+			continue
+		}
+
+		if err := handler(ctx, event); err != nil {
+			if attempt >= b.config.MaxDeliveries {
+				b.deadLetter(opts.Group, index, event)
+			}
+			continue
+		}
+		b.ack(opts.Group, index)
+	}
+}
+
+// claim returns the next event for a group: an expired pending event first,
+// then the next new one. When there is none it returns a channel closed on
+// the next publish.
+func (b *MemoryBus) claim(groupName string) (int, []byte, int, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group := b.groups[groupName]
+	now := time.Now()
+
+	// Redeliver the oldest event whose delivery timed out
+	oldest := -1
+	for index, pending := range group.pending {
+		if now.Sub(pending.deliveredAt) >= b.config.RedeliveryTimeout && (oldest < 0 || index < oldest) {
+			oldest = index
+		}
+	}
+	if oldest >= 0 {
+		pending := group.pending[oldest]
+		pending.deliveries++
+		pending.deliveredAt = now
+		return oldest, b.stream[oldest], pending.deliveries, nil
+	}
+
+	if group.next < len(b.stream) {
+		index := group.next
+		group.next++
+		group.pending[index] = &memoryPending{deliveries: 1, deliveredAt: now}
+		return index, b.stream[index], 1, nil
+	}
+
+	return 0, nil, 0, b.notify
+}
+
+// ack acknowledges an event for a group
+func (b *MemoryBus) ack(groupName string, index int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.groups[groupName].pending, index)
+}
+
+// deadLetter records an event that exhausted its deliveries and acknowledges it
+func (b *MemoryBus) deadLetter(groupName string, index int, event *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.groups[groupName].pending, index)
+	b.deadLetters = append(b.deadLetters, event)
+}
+
+// DeadLetters returns the events that exhausted their deliveries
+func (b *MemoryBus) DeadLetters() []*Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Event(nil), b.deadLetters...)
+}
+
+// Close stops every subscriber
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+	return nil
+}
@@ -1,3 +1,238 @@
+// Package pubsub delivers platform events between services. Events are
+// appended to a durable stream and delivered to consumer groups: every group
+// receives every event, and within a group each event goes to one consumer.
+// Delivery is at least once: an event is redelivered until a handler
+// acknowledges it by returning nil, and is moved to a dead-letter stream
+// after too many failed deliveries.
 package pubsub
 
-// Placeholder for Redis/Kafka/SNS pubsub clients
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEvent is returned when an event does not match the schema's
+// events section
+var ErrInvalidEvent = errors.New("invalid event")
+
+// ErrClosed is returned when using a bus after Close
+var ErrClosed = errors.New("bus is closed")
+
+// Event is a message published on the bus
+type Event struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	TenantID  string                 `json:"tenant_id,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+	Timestamp time.Time              `json:"timestamp"`
+
+	// Attempt is the delivery attempt, starting at 1; it is set on delivery
+	Attempt int `json:"-"`
+}
+
+// Handler processes a delivered event. Returning nil acknowledges the event;
+// returning an error leaves it pending so it is delivered again.
+type Handler func(ctx context.Context, event *Event) error
+
+// Bus publishes events and delivers them to consumer groups
+type Bus interface {
+	// Publish validates an event and appends it to the stream
+	Publish(ctx context.Context, event *Event) error
+
+	// Subscribe delivers events to handler as a member of a consumer group.
+	// It blocks until ctx is cancelled or the bus is closed.
+	Subscribe(ctx context.Context, opts SubscribeOptions, handler Handler) error
+
+	// Close releases the bus; blocked subscribers return
+	Close() error
+}
+
+// SubscribeOptions configure a subscription
+type SubscribeOptions struct {
+	// Group is the consumer group; each group receives every event once
+	Group string
+
+	// Consumer names this subscriber within the group
+	Consumer string
+
+	// Events limits delivery to these event names; other events are
+	// acknowledged without calling the handler. Empty means all events.
+	Events []string
+
+	// FromStart makes a new group start with the oldest retained event
+	// instead of only events published after it was created
+	FromStart bool
+}
+
+func (o SubscribeOptions) validate() error {
+	if o.Group == "" {
+		return fmt.Errorf("consumer group is required")
+	}
+	if o.Consumer == "" {
+		return fmt.Errorf("consumer name is required")
+	}
+	return nil
+}
+
+// wants reports whether the subscription handles an event
+func (o SubscribeOptions) wants(name string) bool {
+	if len(o.Events) == 0 {
+		return true
+	}
+	for _, event := range o.Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds the options shared by every backend
+type Config struct {
+	// Stream names the event stream; defaults to "backsaas:events"
+	Stream string
+
+	// Events maps each declared event name to its fields, as in the
+	// schema's events section. Nil disables validation.
+	Events map[string][]string
+
+	// MaxDeliveries is how many times an event is delivered before it is
+	// dead-lettered; defaults to 5
+	MaxDeliveries int
+
+	// RedeliveryTimeout is how long an unacknowledged event waits before it
+	// is delivered again; defaults to 30s
+	RedeliveryTimeout time.Duration
+
+	// PollInterval bounds how long a subscriber waits for new events before
+	// checking for redeliveries; defaults to 1s
+	PollInterval time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Stream == "" {
+		c.Stream = "backsaas:events"
+	}
+	if c.MaxDeliveries <= 0 {
+		c.MaxDeliveries = 5
+	}
+	if c.RedeliveryTimeout <= 0 {
+		c.RedeliveryTimeout = 30 * time.Second
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	return c
+}
+
+// deadLetterStream names the stream holding events that exhausted their deliveries
+func (c Config) deadLetterStream() string {
+	return c.Stream + ":dead"
+}
+
+// ValidateEvent checks an event against the schema's events section: the
+// event must be declared and its data must carry exactly the declared fields
+func ValidateEvent(events map[string][]string, event *Event) error {
+	if event.Name == "" {
+		return fmt.Errorf("%w: event name is required", ErrInvalidEvent)
+	}
+	if events == nil {
+		return nil
+	}
+
+	fields, declared := events[event.Name]
+	if !declared {
+		return fmt.Errorf("%w: event %s is not declared in the schema", ErrInvalidEvent, event.Name)
+	}
+
+	allowed := make(map[string]bool, len(fields))
+	var missing []string
+	for _, field := range fields {
+		allowed[field] = true
+		if _, exists := event.Data[field]; !exists {
+			missing = append(missing, field)
+		}
+	}
+
+	var unknown []string
+	for field := range event.Data {
+		if !allowed[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing fields "+strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, "undeclared fields "+strings.Join(unknown, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidEvent, event.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// prepareEvent validates an event, fills in its ID and timestamp and returns
+// its wire encoding
+func prepareEvent(config Config, event *Event) ([]byte, error) {
+	if err := ValidateEvent(config.Events, event); err != nil {
+		return nil, err
+	}
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	return json.Marshal(event)
+}
+
+// decodeEvent decodes an event from its wire encoding
+func decodeEvent(payload []byte, attempt int) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	event.Attempt = attempt
+	return &event, nil
+}
+
+// newEventID returns a random event identifier
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// EventService publishes a tenant's events through a Bus. jobs.EventService
+// adds scheduling to it for function execution contexts.
+type EventService struct {
+	bus      Bus
+	tenantID string
+}
+
+// NewEventService creates an event service scoped to a tenant
+func NewEventService(bus Bus, tenantID string) *EventService {
+	return &EventService{bus: bus, tenantID: tenantID}
+}
+
+// Publish publishes an event for the tenant
+func (s *EventService) Publish(ctx context.Context, event string, data map[string]interface{}) error {
+	return s.bus.Publish(ctx, &Event{
+		Name:     event,
+		TenantID: s.tenantID,
+		Data:     data,
+	})
+}
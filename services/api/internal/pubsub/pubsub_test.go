@@ -0,0 +1,271 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var testEvents = map[string][]string{
+	"user.created":   {"id", "email"},
+	"tenant.updated": {"id", "status"},
+}
+
+// busFactories returns a constructor for every backend available in this
+// environment
+func busFactories(t *testing.T) map[string]func(t *testing.T, config Config) Bus {
+	factories := map[string]func(t *testing.T, config Config) Bus{
+		"memory": func(t *testing.T, config Config) Bus {
+			return NewMemoryBus(config)
+		},
+	}
+
+	if redisURL := os.Getenv("TEST_REDIS_URL"); redisURL != "" {
+		factories["redis"] = func(t *testing.T, config Config) Bus {
+			opts, err := redis.ParseURL(redisURL)
+			if err != nil {
+				t.Fatalf("Invalid TEST_REDIS_URL: %v", err)
+			}
+			client := redis.NewClient(opts)
+			if err := client.Ping(context.Background()).Err(); err != nil {
+				t.Skip("Redis not accessible for testing")
+			}
+			config.Stream = fmt.Sprintf("test:%s:%d", t.Name(), time.Now().UnixNano())
+			t.Cleanup(func() {
+				client.Del(context.Background(), config.Stream, config.Stream+":dead")
+				client.Close()
+			})
+			return NewRedisBus(client, config)
+		}
+	}
+
+	return factories
+}
+
+// collector records delivered events and fails the first deliveries of
+// events listed in failures
+type collector struct {
+	mu       sync.Mutex
+	events   []*Event
+	failures map[string]int
+	received chan *Event
+}
+
+func newCollector() *collector {
+	return &collector{failures: make(map[string]int), received: make(chan *Event, 100)}
+}
+
+func (c *collector) handle(ctx context.Context, event *Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.events = append(c.events, event)
+	c.received <- event
+	if c.failures[event.ID] > 0 {
+		c.failures[event.ID]--
+		return errors.New("handler failed")
+	}
+	return nil
+}
+
+func (c *collector) next(t *testing.T) *Event {
+	t.Helper()
+	select {
+	case event := <-c.received:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+		return nil
+	}
+}
+
+func subscribe(t *testing.T, bus Bus, opts SubscribeOptions, handler Handler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Subscribe(ctx, opts, handler)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestBusContract(t *testing.T) {
+	config := Config{
+		Events:            testEvents,
+		MaxDeliveries:     3,
+		RedeliveryTimeout: 50 * time.Millisecond,
+		PollInterval:      20 * time.Millisecond,
+	}
+
+	for name, factory := range busFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("RejectsEventsNotInSchema", func(t *testing.T) {
+				bus := factory(t, config)
+				defer bus.Close()
+
+				invalid := []*Event{
+					{Name: "user.deleted", Data: map[string]interface{}{"id": "1"}},
+					{Name: "user.created", Data: map[string]interface{}{"id": "1"}},
+					{Name: "user.created", Data: map[string]interface{}{"id": "1", "email": "a@b.c", "password": "x"}},
+				}
+				for _, event := range invalid {
+					if err := bus.Publish(context.Background(), event); !errors.Is(err, ErrInvalidEvent) {
+						t.Errorf("Expected ErrInvalidEvent for %s %v, got %v", event.Name, event.Data, err)
+					}
+				}
+			})
+
+			t.Run("DeliversToEveryGroup", func(t *testing.T) {
+				bus := factory(t, config)
+				defer bus.Close()
+
+				audit, mailer := newCollector(), newCollector()
+				subscribe(t, bus, SubscribeOptions{Group: "audit", Consumer: "audit-1", FromStart: true}, audit.handle)
+				subscribe(t, bus, SubscribeOptions{Group: "mailer", Consumer: "mailer-1", FromStart: true, Events: []string{"user.created"}}, mailer.handle)
+
+				bus.Publish(context.Background(), &Event{Name: "tenant.updated", TenantID: "t1", Data: map[string]interface{}{"id": "t1", "status": "active"}})
+				bus.Publish(context.Background(), &Event{Name: "user.created", TenantID: "t1", Data: map[string]interface{}{"id": "u1", "email": "a@example.com"}})
+
+				first, second := audit.next(t), audit.next(t)
+				if first.Name != "tenant.updated" || second.Name != "user.created" {
+					t.Errorf("Expected audit to receive both events in order, got %s and %s", first.Name, second.Name)
+				}
+				if second.TenantID != "t1" || second.Data["email"] != "a@example.com" || second.ID == "" || second.Timestamp.IsZero() {
+					t.Errorf("Unexpected delivered event: %+v", second)
+				}
+
+				if event := mailer.next(t); event.Name != "user.created" {
+					t.Errorf("Expected mailer to receive only user.created, got %s", event.Name)
+				}
+			})
+
+			t.Run("RedeliversUntilAcknowledged", func(t *testing.T) {
+				bus := factory(t, config)
+				defer bus.Close()
+
+				event := &Event{ID: "retry-me", Name: "user.created", Data: map[string]interface{}{"id": "u2", "email": "b@example.com"}}
+				handler := newCollector()
+				handler.failures["retry-me"] = 1
+				subscribe(t, bus, SubscribeOptions{Group: "workers", Consumer: "worker-1", FromStart: true}, handler.handle)
+
+				if err := bus.Publish(context.Background(), event); err != nil {
+					t.Fatalf("Failed to publish: %v", err)
+				}
+
+				if first := handler.next(t); first.Attempt != 1 {
+					t.Errorf("Expected first attempt to be 1, got %d", first.Attempt)
+				}
+				if second := handler.next(t); second.ID != "retry-me" || second.Attempt != 2 {
+					t.Errorf("Expected redelivery as attempt 2, got %s attempt %d", second.ID, second.Attempt)
+				}
+
+				select {
+				case extra := <-handler.received:
+					t.Errorf("Expected no delivery after acknowledgement, got attempt %d", extra.Attempt)
+				case <-time.After(200 * time.Millisecond):
+				}
+			})
+
+			t.Run("DeadLettersAfterMaxDeliveries", func(t *testing.T) {
+				bus := factory(t, config)
+				defer bus.Close()
+
+				handler := newCollector()
+				handler.failures["poison"] = 100
+				subscribe(t, bus, SubscribeOptions{Group: "workers", Consumer: "worker-1", FromStart: true}, handler.handle)
+
+				bus.Publish(context.Background(), &Event{ID: "poison", Name: "user.created", Data: map[string]interface{}{"id": "u3", "email": "c@example.com"}})
+
+				for attempt := 1; attempt <= config.MaxDeliveries; attempt++ {
+					if event := handler.next(t); event.Attempt != attempt {
+						t.Errorf("Expected attempt %d, got %d", attempt, event.Attempt)
+					}
+				}
+				select {
+				case extra := <-handler.received:
+					t.Errorf("Expected no delivery after dead-lettering, got attempt %d", extra.Attempt)
+				case <-time.After(200 * time.Millisecond):
+				}
+
+				if memoryBus, ok := bus.(*MemoryBus); ok {
+					if dead := memoryBus.DeadLetters(); len(dead) != 1 || dead[0].ID != "poison" {
+						t.Errorf("Expected poison event to be dead-lettered, got %v", dead)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestEventService(t *testing.T) {
+	bus := NewMemoryBus(Config{Events: map[string][]string{"email.sent": {"to"}}})
+	defer bus.Close()
+
+	handler := newCollector()
+	subscribe(t, bus, SubscribeOptions{Group: "g", Consumer: "c", FromStart: true}, handler.handle)
+
+	service := NewEventService(bus, "tenant-1")
+	if err := service.Publish(context.Background(), "email.sent", map[string]interface{}{"to": "a@example.com"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if event := handler.next(t); event.TenantID != "tenant-1" {
+		t.Errorf("Expected tenant-1, got %s", event.TenantID)
+	}
+
+	if err := service.Publish(context.Background(), "email.bounced", nil); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Expected ErrInvalidEvent for undeclared event, got %v", err)
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	events, err := LoadEvents("../../system/schema/platform.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load platform events: %v", err)
+	}
+
+	// Events published by functions and schema hooks must be declared
+	published := map[string]map[string]interface{}{
+		"email.sent":                {"delivery_id": "d1", "template": "welcome", "version": 1, "to": "a@example.com", "tenant_id": "t1", "attempts": 1, "sent_at": time.Now()},
+		"email.failed":              {"delivery_id": "d1", "template": "welcome", "version": 1, "to": "a@example.com", "tenant_id": "t1", "attempts": 8, "error": "mailbox unavailable", "failed_at": time.Now()},
+		"webhook.sent":              {"url": "https://example.com", "status_code": 200, "tenant_id": "t1", "sent_at": time.Now()},
+		"tenant.provisioned":        {"tenant_id": "t1", "slug": "acme", "owner_id": "u1", "schema_id": "s1"},
+		"schema.migration.required": {"migration_id": "m1", "tenant_id": "t1", "schema_id": "s1", "breaking_changes": []string{}},
+		"user.created":              {"id": "u1", "email": "a@example.com", "name": "Ada", "status": "active"},
+	}
+	for name, data := range published {
+		if err := ValidateEvent(events, &Event{Name: name, Data: data}); err != nil {
+			t.Errorf("Expected %s to be valid: %v", name, err)
+		}
+	}
+}
+
+func TestParseEventsChecksHooks(t *testing.T) {
+	schema := `
+events:
+  user.created:
+    fields: [id, email]
+platform_functions:
+  welcome:
+    events:
+      - event: user.created
+        data: { user_id: "{{id}}", email: "{{email}}" }
+`
+	if _, err := ParseEvents([]byte(schema)); !errors.Is(err, ErrInvalidEvent) || !strings.Contains(err.Error(), "welcome") {
+		t.Errorf("Expected the hook's event data to be rejected, got %v", err)
+	}
+
+	schema = strings.Replace(schema, "user_id:", "id:", 1)
+	if _, err := ParseEvents([]byte(schema)); err != nil {
+		t.Errorf("Expected matching hook event data to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// payloadField is the stream entry field holding the encoded event
+const payloadField = "event"
+
+// RedisBus is a Bus backed by a Redis stream. Consumer groups, pending
+// entry lists and XCLAIM provide acknowledgement and redelivery.
+type RedisBus struct {
+	client    *redis.Client
+	config    Config
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRedisBus creates a bus using an existing Redis client, which the caller
+// keeps ownership of
+func NewRedisBus(client *redis.Client, config Config) *RedisBus {
+	return &RedisBus{
+		client: client,
+		config: config.withDefaults(),
+		closed: make(chan struct{}),
+	}
+}
+
+// NewRedisBusFromURL connects to Redis and creates a bus
+func NewRedisBusFromURL(ctx context.Context, redisURL string, config Config) (*RedisBus, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return NewRedisBus(client, config), nil
+}
+
+// Publish validates an event and appends it to the stream
+func (b *RedisBus) Publish(ctx context.Context, event *Event) error {
+	payload, err := prepareEvent(b.config, event)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-b.closed:
+		return ErrClosed
+	default:
+	}
+
+	err = b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.config.Stream,
+		Values: map[string]interface{}{payloadField: payload},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish %s: %w", event.Name, err)
+	}
+	return nil
+}
+
+// Subscribe delivers events to handler until ctx is cancelled
+func (b *RedisBus) Subscribe(ctx context.Context, opts SubscribeOptions, handler Handler) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// Stop blocking reads when the bus is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := b.ensureGroup(ctx, opts); err != nil {
+		return err
+	}
+
+	for {
+		if err := b.redeliver(ctx, opts, handler); err != nil {
+			return b.stopped(ctx, err)
+		}
+
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    opts.Group,
+			Consumer: opts.Consumer,
+			Streams:  []string{b.config.Stream, ">"},
+			Count:    10,
+			Block:    b.config.PollInterval,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return b.stopped(ctx, fmt.Errorf("failed to read events: %w", err))
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				if err := b.deliver(ctx, opts, handler, message, 1); err != nil {
+					return b.stopped(ctx, err)
+				}
+			}
+		}
+	}
+}
+
+// stopped returns the reason a subscriber loop ended
+func (b *RedisBus) stopped(ctx context.Context, err error) error {
+	select {
+	case <-b.closed:
+		return ErrClosed
+	default:
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// ensureGroup creates the consumer group, and the stream if needed
+func (b *RedisBus) ensureGroup(ctx context.Context, opts SubscribeOptions) error {
+	start := "$"
+	if opts.FromStart {
+		start = "0"
+	}
+
+	err := b.client.XGroupCreateMkStream(ctx, b.config.Stream, opts.Group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s: %w", opts.Group, err)
+	}
+	return nil
+}
+
+// redeliver claims events whose delivery timed out, dead-lettering those
+// that have been delivered too often
+func (b *RedisBus) redeliver(ctx context.Context, opts SubscribeOptions, handler Handler) error {
+	pending, err := b.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: b.config.Stream,
+		Group:  opts.Group,
+		Idle:   b.config.RedeliveryTimeout,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list pending events: %w", err)
+	}
+
+	for _, entry := range pending {
+		// Claiming only succeeds if no other consumer claimed it first
+		messages, err := b.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   b.config.Stream,
+			Group:    opts.Group,
+			Consumer: opts.Consumer,
+			MinIdle:  b.config.RedeliveryTimeout,
+			Messages: []string{entry.ID},
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim event %s: %w", entry.ID, err)
+		}
+
+		for _, message := range messages {
+			if err := b.deliver(ctx, opts, handler, message, int(entry.RetryCount)+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deliver hands one stream entry to the handler and acknowledges it on
+// success, or dead-letters it after its last allowed delivery
+func (b *RedisBus) deliver(ctx context.Context, opts SubscribeOptions, handler Handler, message redis.XMessage, attempt int) error {
+	payload, _ := message.Values[payloadField].(string)
+	event, err := decodeEvent([]byte(payload), attempt)
+	if err != nil || !opts.wants(event.Name) {
+		return b.ack(ctx, opts, message.ID)
+	}
+
+	if err := handler(ctx, event); err != nil {
+		if attempt < b.config.MaxDeliveries {
+			return nil
+		}
+		err := b.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: b.config.deadLetterStream(),
+			Values: map[string]interface{}{
+				payloadField: payload,
+				"group":      opts.Group,
+				"error":      err.Error(),
+				"failed_at":  time.Now().UTC().Format(time.RFC3339),
+			},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to dead-letter event %s: %w", event.ID, err)
+		}
+	}
+
+	return b.ack(ctx, opts, message.ID)
+}
+
+func (b *RedisBus) ack(ctx context.Context, opts SubscribeOptions, id string) error {
+	if err := b.client.XAck(ctx, b.config.Stream, opts.Group, id).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge event %s: %w", id, err)
+	}
+	return nil
+}
+
+// Close stops every subscriber. The Redis client is left open.
+func (b *RedisBus) Close() error {
+	b.closeOnce.Do(func() { close(b.closed) })
+	return nil
+}
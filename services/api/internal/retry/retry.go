@@ -0,0 +1,42 @@
+// Package retry spaces out repeated attempts at work that can fail
+// transiently, such as webhook deliveries, email and scheduled jobs.
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Policy spaces out retries with exponential backoff and jitter
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry; each later retry
+	// waits twice as long, up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// jitter returns a random duration in [0, n); replaced in tests
+var jitter = func(n int64) time.Duration {
+	return time.Duration(rand.Int63n(n))
+}
+
+// Backoff returns the delay before the attempt following attempt number
+// attempt (starting at 1). The delay is drawn from the upper half of the
+// exponential step, so retries from many callers spread out.
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + jitter(int64(delay-half))
+}
@@ -0,0 +1,20 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	original := jitter
+	jitter = func(n int64) time.Duration { return 0 }
+	defer func() { jitter = original }()
+
+	policy := Policy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	expected := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Backoff(%d): expected %v, got %v", i+1, want, got)
+		}
+	}
+}
@@ -2,8 +2,18 @@ package types
 
 import (
 	"context"
+	"errors"
+	"time"
 )
 
+// ErrAccessDenied is returned by a DataService for operations the caller's
+// access rules don't allow
+var ErrAccessDenied = errors.New("access denied")
+
+// ErrNoDataService is returned by data operations of functions run where no
+// DataService was provided, such as by the job worker
+var ErrNoDataService = errors.New("data access is not available to this function")
+
 // ExecutionContext provides secure context for function execution
 type ExecutionContext struct {
 	TenantID     string
@@ -14,7 +24,11 @@ type ExecutionContext struct {
 	Logger       Logger
 	DataService  DataService
 	EventService EventService
+	EmailService EmailService // overrides the process-wide email service when set
 	Data         map[string]interface{}
+
+	// WebhookService overrides the process-wide webhook sender when set
+	WebhookService WebhookService
 }
 
 // Logger interface for structured logging
@@ -24,17 +38,61 @@ type Logger interface {
 	Error(msg string, err error, fields map[string]interface{})
 }
 
-// EventService interface for publishing events
+// EventService interface for publishing events, now or after a delay
 type EventService interface {
-	Publish(event string, data map[string]interface{}) error
+	Publish(ctx context.Context, event string, data map[string]interface{}) error
+	Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error
+}
+
+// EmailService interface for queueing templated email
+type EmailService interface {
+	SendTemplatedEmail(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (string, error)
 }
 
-// DataService interface for data operations
+// WebhookService interface for sending signed webhooks. SendWebhook
+// retries failures until ctx is done and returns the receiver's last status
+// code.
+type WebhookService interface {
+	SendWebhook(ctx context.Context, url, secret, id string, body []byte) (int, error)
+}
+
+// DataService interface for tenant-scoped data operations. Implementations
+// apply the caller's access rules: records the caller can't read are left
+// out of results, and writes the caller isn't allowed fail with
+// ErrAccessDenied.
 type DataService interface {
 	FindByID(ctx context.Context, entity, id string) (map[string]interface{}, error)
 	FindMany(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error)
+	Count(ctx context.Context, entity string, filters map[string]interface{}) (int64, error)
 	Create(ctx context.Context, entity string, data map[string]interface{}) (map[string]interface{}, error)
 	Update(ctx context.Context, entity, id string, data map[string]interface{}) (map[string]interface{}, error)
 	Delete(ctx context.Context, entity, id string) error
-	List(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error)
+}
+
+// NoDataService is the DataService of functions run without one. Every
+// operation fails with ErrNoDataService.
+type NoDataService struct{}
+
+func (NoDataService) FindByID(ctx context.Context, entity, id string) (map[string]interface{}, error) {
+	return nil, ErrNoDataService
+}
+
+func (NoDataService) FindMany(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+	return nil, ErrNoDataService
+}
+
+func (NoDataService) Count(ctx context.Context, entity string, filters map[string]interface{}) (int64, error) {
+	return 0, ErrNoDataService
+}
+
+func (NoDataService) Create(ctx context.Context, entity string, data map[string]interface{}) (map[string]interface{}, error) {
+	return nil, ErrNoDataService
+}
+
+func (NoDataService) Update(ctx context.Context, entity, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	return nil, ErrNoDataService
+}
+
+func (NoDataService) Delete(ctx context.Context, entity, id string) error {
+	return ErrNoDataService
 }
@@ -0,0 +1,278 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/retry"
+)
+
+// Config configures a Dispatcher
+type Config struct {
+	// Retry spaces out attempts for each delivery; defaults to
+	// DefaultRetryPolicy
+	Retry retry.Policy
+
+	// DisableAfter is how many failed attempts in a row, across
+	// deliveries, disable a subscription; defaults to 20
+	DisableAfter int
+
+	// PollInterval is how often due deliveries are checked; defaults to 1s
+	PollInterval time.Duration
+
+	// BatchSize is how many due deliveries are attempted per poll;
+	// defaults to 50
+	BatchSize int
+
+	// Lease is how long a claimed delivery is hidden from other workers
+	// while it is attempted; defaults to 1m
+	Lease time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry = DefaultRetryPolicy
+	}
+	if c.DisableAfter <= 0 {
+		c.DisableAfter = 20
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 50
+	}
+	if c.Lease <= 0 {
+		c.Lease = time.Minute
+	}
+	return c
+}
+
+// Dispatcher turns events into deliveries and attempts them
+type Dispatcher struct {
+	store  Store
+	sender *Sender
+	config Config
+	now    func() time.Time
+}
+
+// NewDispatcher creates a dispatcher
+func NewDispatcher(store Store, sender *Sender, config Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		sender: sender,
+		config: config.withDefaults(),
+		now:    time.Now,
+	}
+}
+
+// payload is the JSON body posted to receivers
+type payload struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	TenantID  string                 `json:"tenant_id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// HandleEvent queues a delivery of an event to each of its tenant's matching
+// subscriptions. It is a pubsub.Handler. Delivery IDs derive from the event
+// and subscription, so an event the bus redelivers is not delivered twice.
+func (d *Dispatcher) HandleEvent(ctx context.Context, event *pubsub.Event) error {
+	if event.TenantID == "" {
+		return nil
+	}
+
+	subs, err := d.store.ListSubscriptions(ctx, event.TenantID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload{
+		ID:        event.ID,
+		Event:     event.Name,
+		TenantID:  event.TenantID,
+		Timestamp: event.Timestamp,
+		Data:      event.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	now := d.now().UTC()
+	for _, sub := range subs {
+		if !sub.Active || !sub.Matches(event.Name) {
+			continue
+		}
+
+		delivery := &Delivery{
+			ID:             event.ID + "-" + sub.ID,
+			TenantID:       event.TenantID,
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			Event:          event.Name,
+			Payload:        body,
+			Status:         DeliveryPending,
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := d.store.CreateDelivery(ctx, delivery); err != nil && !errors.Is(err, ErrDuplicate) {
+			return fmt.Errorf("failed to queue delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run attempts due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		attempted, err := d.DeliverDue(ctx)
+		if err != nil {
+			log.Printf("Webhook dispatcher failed: %v", err)
+		}
+
+		// Keep going while full batches are due
+		if err == nil && attempted == d.config.BatchSize {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(d.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// DeliverDue attempts one batch of due deliveries and returns how many were
+// attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimDueDeliveries(ctx, d.now(), d.config.Lease, d.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, delivery := range deliveries {
+		if err := d.attempt(ctx, delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// attempt makes one delivery attempt and records its outcome on the
+// delivery and its subscription
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) error {
+	sub, err := d.store.GetSubscription(ctx, delivery.TenantID, delivery.SubscriptionID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if sub == nil || !sub.Active {
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.UpdatedAt = d.now().UTC()
+		return d.store.UpdateDelivery(ctx, delivery)
+	}
+
+	attempt := d.sender.Send(ctx, Message{
+		URL:    sub.URL,
+		Secret: sub.Secret,
+		ID:     delivery.ID,
+		Event:  delivery.Event,
+		Body:   delivery.Payload,
+	})
+	now := d.now().UTC()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.UpdatedAt = now
+
+	// The subscription may have been changed since it was read, so only its
+	// failure count is updated, in the store
+	reason := ""
+	if !attempt.Succeeded() {
+		reason = fmt.Sprintf("disabled after %d consecutive failed attempts: %v", d.config.DisableAfter, attempt.failure())
+	}
+	sub, err = d.store.RecordAttempt(ctx, sub.TenantID, sub.ID, attempt.Succeeded(), d.config.DisableAfter, reason, now)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	active := sub != nil && sub.Active
+	if sub != nil && sub.DisabledAt != nil && sub.DisabledAt.Equal(now) {
+		log.Printf("Disabled webhook subscription %s for tenant %s: %s", sub.ID, sub.TenantID, sub.DisabledReason)
+	}
+
+	switch {
+	case attempt.Succeeded():
+		delivery.Status = DeliverySucceeded
+		delivery.NextAttemptAt = nil
+	case !active || len(delivery.Attempts) >= d.config.Retry.MaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(d.config.Retry.Backoff(len(delivery.Attempts)))
+		delivery.NextAttemptAt = &next
+	}
+	return d.store.UpdateDelivery(ctx, delivery)
+}
+
+// Redeliver sends a logged delivery's payload again as a new delivery,
+// attempting it immediately. Later attempts, if needed, follow the retry
+// policy.
+func (d *Dispatcher) Redeliver(ctx context.Context, tenantID, deliveryID string) (*Delivery, error) {
+	original, err := d.store.GetDelivery(ctx, tenantID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := d.store.GetSubscription(ctx, tenantID, original.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.Active {
+		return nil, ErrSubscriptionDisabled
+	}
+
+	now := d.now().UTC()
+	delivery := &Delivery{
+		ID:             newID(),
+		TenantID:       tenantID,
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		Event:          original.Event,
+		Payload:        original.Payload,
+		Status:         DeliveryPending,
+		RedeliveryOf:   original.ID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := d.store.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	if err := d.attempt(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return d.store.GetDelivery(ctx, tenantID, delivery.ID)
+}
+
+// newID returns a random identifier
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
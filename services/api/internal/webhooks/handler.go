@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+)
+
+// Handler serves the webhook management API
+type Handler struct {
+	store      Store
+	dispatcher *Dispatcher
+
+	// events are the declared event names subscriptions may use; nil
+	// accepts any name
+	events map[string][]string
+}
+
+// NewHandler creates the management API. events restricts subscriptions
+// to declared event names; pass nil to accept any.
+func NewHandler(store Store, dispatcher *Dispatcher, events map[string][]string) *Handler {
+	return &Handler{store: store, dispatcher: dispatcher, events: events}
+}
+
+// Routes returns the API's routes, to be mounted under /webhooks:
+//
+//	GET    /subscriptions                    list subscriptions
+//	POST   /subscriptions                    create a subscription
+//	GET    /subscriptions/{id}               get a subscription
+//	PATCH  /subscriptions/{id}               change url, events or active
+//	DELETE /subscriptions/{id}               delete a subscription
+//	GET    /subscriptions/{id}/deliveries    delivery log, newest first
+//	GET    /deliveries/{id}                  get a delivery
+//	POST   /deliveries/{id}/redeliver        send a delivery again
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(httputil.RequireTenant)
+
+	r.Get("/subscriptions", h.listSubscriptions)
+	r.Post("/subscriptions", h.createSubscription)
+	r.Get("/subscriptions/{id}", h.getSubscription)
+	r.Patch("/subscriptions/{id}", h.updateSubscription)
+	r.Delete("/subscriptions/{id}", h.deleteSubscription)
+	r.Get("/subscriptions/{id}/deliveries", h.listDeliveries)
+	r.Get("/deliveries/{id}", h.getDelivery)
+	r.Post("/deliveries/{id}/redeliver", h.redeliver)
+
+	return r
+}
+
+// writeStoreError maps store errors to responses
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httputil.WriteError(w, http.StatusNotFound, "Not found")
+	case errors.Is(err, ErrSubscriptionDisabled):
+		httputil.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		httputil.WriteError(w, http.StatusInternalServerError, "Webhook store failed")
+	}
+}
+
+// checkEvents rejects event names the schema does not declare
+func (h *Handler) checkEvents(events []string) error {
+	if h.events == nil {
+		return nil
+	}
+	for _, event := range events {
+		if _, declared := h.events[event]; !declared && event != "*" {
+			return fmt.Errorf("event %s is not declared in the schema", event)
+		}
+	}
+	return nil
+}
+
+type subscriptionRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+func (h *Handler) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.store.ListSubscriptions(r.Context(), r.Header.Get(httputil.TenantHeader))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if subs == nil {
+		subs = []*Subscription{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": subs})
+}
+
+func (h *Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == nil {
+		httputil.WriteError(w, http.StatusBadRequest, "Invalid JSON: url and events are required")
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := GenerateSecret()
+		if err != nil {
+			httputil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		secret = generated
+	}
+
+	now := time.Now().UTC()
+	sub := &Subscription{
+		ID:        newID(),
+		TenantID:  r.Header.Get(httputil.TenantHeader),
+		URL:       *req.URL,
+		Events:    req.Events,
+		Secret:    secret,
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := sub.Validate(); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.checkEvents(sub.Events); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.store.CreateSubscription(r.Context(), sub); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// The secret is only ever returned here
+	httputil.WriteJSON(w, http.StatusCreated, map[string]interface{}{"data": sub, "secret": secret})
+}
+
+func (h *Handler) getSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.store.GetSubscription(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": sub})
+}
+
+func (h *Handler) updateSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.store.GetSubscription(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if req.URL != nil {
+		sub.URL = *req.URL
+	}
+	if req.Events != nil {
+		sub.Events = req.Events
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+		if sub.Active {
+			// Re-enabling starts the failure count afresh
+			sub.ConsecutiveFailures = 0
+			sub.DisabledAt = nil
+			sub.DisabledReason = ""
+		}
+	}
+	if err := sub.Validate(); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.checkEvents(sub.Events); err != nil {
+		httputil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub.UpdatedAt = time.Now().UTC()
+	if err := h.store.UpdateSubscription(r.Context(), sub); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": sub})
+}
+
+func (h *Handler) deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.DeleteSubscription(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]string{"message": "Subscription deleted successfully"})
+}
+
+func (h *Handler) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.Header.Get(httputil.TenantHeader)
+	subscriptionID := chi.URLParam(r, "id")
+
+	// Deliveries outlive their subscription, so only check the tenant owns it
+	// when it still exists
+	if _, err := h.store.GetSubscription(r.Context(), tenantID, subscriptionID); err != nil && !errors.Is(err, ErrNotFound) {
+		writeStoreError(w, err)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			httputil.WriteError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if parsed > 1000 {
+			parsed = 1000
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.store.ListDeliveries(r.Context(), tenantID, subscriptionID, limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*Delivery{}
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": deliveries})
+}
+
+func (h *Handler) getDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.store.GetDelivery(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, map[string]interface{}{"data": delivery})
+}
+
+func (h *Handler) redeliver(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.dispatcher.Redeliver(r.Context(), r.Header.Get(httputil.TenantHeader), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusAccepted, map[string]interface{}{"data": delivery})
+}
@@ -0,0 +1,353 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresSchema creates the subscription and delivery tables. Due
+// deliveries are found through a partial index on next_attempt_at, and the
+// delivery log through an index per subscription.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id                   TEXT PRIMARY KEY,
+	tenant_id            TEXT NOT NULL,
+	url                  TEXT NOT NULL,
+	events               TEXT[] NOT NULL,
+	secret               TEXT NOT NULL,
+	active               BOOLEAN NOT NULL,
+	consecutive_failures INTEGER NOT NULL DEFAULT 0,
+	disabled_at          TIMESTAMPTZ,
+	disabled_reason      TEXT,
+	created_at           TIMESTAMPTZ NOT NULL,
+	updated_at           TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_tenant ON webhook_subscriptions (tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id              TEXT PRIMARY KEY,
+	tenant_id       TEXT NOT NULL,
+	subscription_id TEXT NOT NULL,
+	event_id        TEXT NOT NULL,
+	event           TEXT NOT NULL,
+	payload         JSONB NOT NULL,
+	status          TEXT NOT NULL,
+	attempts        JSONB NOT NULL DEFAULT '[]',
+	next_attempt_at TIMESTAMPTZ,
+	redelivery_of   TEXT,
+	created_at      TIMESTAMPTZ NOT NULL,
+	updated_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_log ON webhook_deliveries (tenant_id, subscription_id, created_at DESC);
+`
+
+const subscriptionColumns = `id, tenant_id, url, events, secret, active, consecutive_failures,
+	disabled_at, disabled_reason, created_at, updated_at`
+
+const deliveryColumns = `id, tenant_id, subscription_id, event_id, event, payload, status, attempts,
+	next_attempt_at, redelivery_of, created_at, updated_at`
+
+// PostgresStore is a Store in Postgres tables, so subscriptions and the
+// delivery log, including failed deliveries, survive restarts. Workers
+// claim due deliveries with SELECT ... FOR UPDATE SKIP LOCKED, so they never
+// attempt the same delivery at once.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store over db. Call Migrate to create the
+// tables.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// OpenPostgresStore connects to the database at url and creates the
+// webhook tables if needed
+func OpenPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhook database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to webhook database: %w", err)
+	}
+	store := NewPostgresStore(db)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Migrate creates the webhook tables and their indexes
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("failed to create webhook tables: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row scanner) (*Subscription, error) {
+	var (
+		sub            Subscription
+		disabledAt     sql.NullTime
+		disabledReason sql.NullString
+	)
+	err := row.Scan(&sub.ID, &sub.TenantID, &sub.URL, pq.Array(&sub.Events), &sub.Secret, &sub.Active,
+		&sub.ConsecutiveFailures, &disabledAt, &disabledReason, &sub.CreatedAt, &sub.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub.DisabledReason = disabledReason.String
+	sub.CreatedAt, sub.UpdatedAt = sub.CreatedAt.UTC(), sub.UpdatedAt.UTC()
+	if disabledAt.Valid {
+		t := disabledAt.Time.UTC()
+		sub.DisabledAt = &t
+	}
+	return &sub, nil
+}
+
+func scanDelivery(row scanner) (*Delivery, error) {
+	var (
+		delivery      Delivery
+		payload       []byte
+		attempts      []byte
+		nextAttemptAt sql.NullTime
+		redeliveryOf  sql.NullString
+	)
+	err := row.Scan(&delivery.ID, &delivery.TenantID, &delivery.SubscriptionID, &delivery.EventID,
+		&delivery.Event, &payload, &delivery.Status, &attempts, &nextAttemptAt, &redeliveryOf,
+		&delivery.CreatedAt, &delivery.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(attempts, &delivery.Attempts); err != nil {
+		return nil, fmt.Errorf("invalid attempts for delivery %s: %w", delivery.ID, err)
+	}
+	delivery.Payload = payload
+	delivery.RedeliveryOf = redeliveryOf.String
+	delivery.CreatedAt, delivery.UpdatedAt = delivery.CreatedAt.UTC(), delivery.UpdatedAt.UTC()
+	if nextAttemptAt.Valid {
+		t := nextAttemptAt.Time.UTC()
+		delivery.NextAttemptAt = &t
+	}
+	return &delivery, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*Delivery, error) {
+	defer rows.Close()
+	var deliveries []*Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// isUniqueViolation reports whether err is a primary key conflict
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// expectRow returns ErrNotFound when an update or delete matched no row
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateSubscription stores a new subscription
+func (s *PostgresStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO webhook_subscriptions (`+subscriptionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		sub.ID, sub.TenantID, sub.URL, pq.Array(sub.Events), sub.Secret, sub.Active,
+		sub.ConsecutiveFailures, sub.DisabledAt, nullString(sub.DisabledReason), sub.CreatedAt, sub.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// GetSubscription returns a tenant's subscription
+func (s *PostgresStore) GetSubscription(ctx context.Context, tenantID, id string) (*Subscription, error) {
+	return scanSubscription(s.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+`
+		FROM webhook_subscriptions WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+}
+
+// ListSubscriptions returns a tenant's subscriptions, oldest first
+func (s *PostgresStore) ListSubscriptions(ctx context.Context, tenantID string) ([]*Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+subscriptionColumns+`
+		FROM webhook_subscriptions WHERE tenant_id = $1 ORDER BY created_at, id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscription replaces a stored subscription
+func (s *PostgresStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	return expectRow(s.db.ExecContext(ctx, `UPDATE webhook_subscriptions
+		SET url = $3, events = $4, secret = $5, active = $6, consecutive_failures = $7,
+			disabled_at = $8, disabled_reason = $9, updated_at = $10
+		WHERE tenant_id = $1 AND id = $2`,
+		sub.TenantID, sub.ID, sub.URL, pq.Array(sub.Events), sub.Secret, sub.Active,
+		sub.ConsecutiveFailures, sub.DisabledAt, nullString(sub.DisabledReason), sub.UpdatedAt))
+}
+
+// RecordAttempt updates a subscription's failure count in a single
+// statement, so concurrent changes to its other fields are kept
+func (s *PostgresStore) RecordAttempt(ctx context.Context, tenantID, id string, succeeded bool, disableAfter int, reason string, now time.Time) (*Subscription, error) {
+	return scanSubscription(s.db.QueryRowContext(ctx, `UPDATE webhook_subscriptions
+		SET consecutive_failures = CASE WHEN $3 THEN 0 ELSE consecutive_failures + 1 END,
+			active = active AND ($3 OR consecutive_failures + 1 < $4),
+			disabled_at = CASE WHEN active AND NOT $3 AND consecutive_failures + 1 >= $4
+				THEN $6 ELSE disabled_at END,
+			disabled_reason = CASE WHEN active AND NOT $3 AND consecutive_failures + 1 >= $4
+				THEN $5 ELSE disabled_reason END,
+			updated_at = $6
+		WHERE tenant_id = $1 AND id = $2
+		RETURNING `+subscriptionColumns, tenantID, id, succeeded, disableAfter, reason, now))
+}
+
+// DeleteSubscription removes a subscription; its delivery log is kept
+func (s *PostgresStore) DeleteSubscription(ctx context.Context, tenantID, id string) error {
+	return expectRow(s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions
+		WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+}
+
+// CreateDelivery stores a new delivery
+func (s *PostgresStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	attempts, err := json.Marshal(attemptsOrEmpty(delivery.Attempts))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		delivery.ID, delivery.TenantID, delivery.SubscriptionID, delivery.EventID, delivery.Event,
+		[]byte(delivery.Payload), delivery.Status, attempts, delivery.NextAttemptAt,
+		nullString(delivery.RedeliveryOf), delivery.CreatedAt, delivery.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// attemptsOrEmpty stores a delivery without attempts as an empty array
+func attemptsOrEmpty(attempts []Attempt) []Attempt {
+	if attempts == nil {
+		return []Attempt{}
+	}
+	return attempts
+}
+
+// GetDelivery returns a tenant's delivery
+func (s *PostgresStore) GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error) {
+	return scanDelivery(s.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+`
+		FROM webhook_deliveries WHERE tenant_id = $1 AND id = $2`, tenantID, id))
+}
+
+// UpdateDelivery replaces a stored delivery's status, attempts and next
+// attempt
+func (s *PostgresStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	attempts, err := json.Marshal(attemptsOrEmpty(delivery.Attempts))
+	if err != nil {
+		return err
+	}
+	return expectRow(s.db.ExecContext(ctx, `UPDATE webhook_deliveries
+		SET status = $3, attempts = $4, next_attempt_at = $5, updated_at = $6
+		WHERE tenant_id = $1 AND id = $2`,
+		delivery.TenantID, delivery.ID, delivery.Status, attempts, delivery.NextAttemptAt, delivery.UpdatedAt))
+}
+
+// ListDeliveries returns a subscription's deliveries, newest first
+func (s *PostgresStore) ListDeliveries(ctx context.Context, tenantID, subscriptionID string, limit int) ([]*Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE tenant_id = $1 AND subscription_id = $2
+		ORDER BY created_at DESC, id DESC LIMIT $3`,
+		tenantID, subscriptionID, sql.NullInt64{Int64: int64(limit), Valid: limit > 0})
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// ClaimDueDeliveries returns pending deliveries due by now, oldest first.
+// Candidates are locked with SKIP LOCKED, so deliveries another worker is
+// claiming are passed over.
+func (s *PostgresStore) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns, now, now.Add(lease), sql.NullInt64{Int64: int64(limit), Valid: limit > 0})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	claimed, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the subquery's order, and the due times it
+	// ordered by were replaced by the lease, so order by creation instead
+	sort.Slice(claimed, func(i, j int) bool {
+		if claimed[i].CreatedAt.Equal(claimed[j].CreatedAt) {
+			return claimed[i].ID < claimed[j].ID
+		}
+		return claimed[i].CreatedAt.Before(claimed[j].CreatedAt)
+	})
+	return claimed, nil
+}
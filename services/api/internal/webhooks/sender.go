@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/retry"
+)
+
+// maxResponseBody bounds how much of a receiver's response is kept in the
+// delivery log
+const maxResponseBody = 1024
+
+// Message is a signed POST to a webhook receiver
+type Message struct {
+	URL    string
+	Secret string // empty sends the message unsigned
+	ID     string // delivery ID, constant across retries; generated if empty
+	Event  string
+	Body   []byte
+}
+
+// Attempt records one try at delivering a message
+type Attempt struct {
+	At           time.Time `json:"at"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+}
+
+// Succeeded reports whether the receiver accepted the message
+func (a Attempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// failure describes why the attempt failed
+func (a Attempt) failure() error {
+	if a.Error != "" {
+		return fmt.Errorf("webhook request failed: %s", a.Error)
+	}
+	return fmt.Errorf("webhook returned status %d", a.StatusCode)
+}
+
+// DefaultRetryPolicy retries for roughly a day before giving up
+var DefaultRetryPolicy = retry.Policy{
+	MaxAttempts:    10,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     6 * time.Hour,
+}
+
+// ErrPrivateAddress is the error for receivers at loopback, private,
+// link-local or other internal addresses, which tenants may not send
+// webhooks to
+var ErrPrivateAddress = errors.New("webhook receiver is not at a public address")
+
+// blockedPrefixes are the internal ranges netip has no predicate for
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // This network
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which reaches IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+}
+
+// publicAddress reports whether webhooks may be sent to addr. Link-local
+// addresses include cloud metadata services such as 169.254.169.254.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublic is a net.Dialer Control function refusing connections to
+// addresses that aren't public. It sees the address being dialed after DNS
+// resolution, so a receiver's host name can't be pointed at an internal
+// address after the subscription was created.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// publicClient returns an HTTP client that only connects to public
+// addresses. It uses no proxy, so the dialer sees the receiver's address.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialPublic,
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Sender posts signed messages to webhook receivers
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender creates a sender. A nil client uses one with a 10s timeout that
+// refuses to connect to internal addresses, including after redirects; pass
+// a client only to reach receivers on a private network.
+func NewSender(client *http.Client) *Sender {
+	if client == nil {
+		client = publicClient()
+	}
+	return &Sender{client: client}
+}
+
+// Send makes one delivery attempt. Transport failures and non-2xx
+// responses are recorded in the attempt rather than returned.
+func (s *Sender) Send(ctx context.Context, msg Message) Attempt {
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+	started := time.Now()
+	attempt := Attempt{At: started.UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BackSaas-Webhook/1.0")
+	if msg.Event != "" {
+		req.Header.Set(HeaderEvent, msg.Event)
+	}
+	setSignatureHeaders(req.Header, msg.Secret, msg.ID, started, msg.Body)
+
+	resp, err := s.client.Do(req)
+	attempt.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	attempt.StatusCode = resp.StatusCode
+	attempt.ResponseBody = string(body)
+	return attempt
+}
+
+// SendWithRetry delivers a message, retrying failed attempts according to
+// policy until one succeeds, the attempts run out or ctx is done. Every
+// attempt is signed afresh with its own timestamp.
+func (s *Sender) SendWithRetry(ctx context.Context, msg Message, policy retry.Policy) ([]Attempt, error) {
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+
+	var attempts []Attempt
+	for {
+		attempt := s.Send(ctx, msg)
+		attempts = append(attempts, attempt)
+		if attempt.Succeeded() {
+			return attempts, nil
+		}
+		if len(attempts) >= policy.MaxAttempts {
+			return attempts, attempt.failure()
+		}
+
+		timer := time.NewTimer(policy.Backoff(len(attempts)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, fmt.Errorf("%w (last attempt: %v)", ctx.Err(), attempt.failure())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Package webhooks delivers platform events to tenants' HTTP endpoints.
+// Tenants subscribe a URL to event names; each matching event becomes a
+// delivery that is signed with the subscription's secret, retried with
+// backoff until the receiver accepts it, and kept in a delivery log.
+// Subscriptions that keep failing are disabled automatically.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown subscriptions and deliveries
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicate is returned when creating a delivery that already exists
+	ErrDuplicate = errors.New("already exists")
+
+	// ErrSubscriptionDisabled is returned when redelivering to a disabled
+	// subscription
+	ErrSubscriptionDisabled = errors.New("subscription is disabled")
+)
+
+// Subscription sends a tenant's events to a URL
+type Subscription struct {
+	ID       string   `json:"id"`
+	TenantID string   `json:"tenant_id"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"` // event names; "*" matches every event
+
+	// Secret signs deliveries; it is only shown when created
+	Secret string `json:"-"`
+
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// Matches reports whether the subscription wants an event
+func (s *Subscription) Matches(event string) bool {
+	for _, name := range s.Events {
+		if name == "*" || name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a subscription's URL and events
+func (s *Subscription) Validate() error {
+	parsed, err := url.Parse(s.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(s.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range s.Events {
+		if event == "" {
+			return fmt.Errorf("event names cannot be empty")
+		}
+	}
+	return nil
+}
+
+// DeliveryStatus is the state of a delivery
+type DeliveryStatus string
+
+// Delivery states
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is one event sent to one subscription, with every attempt made
+type Delivery struct {
+	ID             string          `json:"id"`
+	TenantID       string          `json:"tenant_id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       []Attempt       `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	RedeliveryOf   string          `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Store persists subscriptions and the delivery log
+type Store interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, tenantID, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context, tenantID string) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *Subscription) error
+	DeleteSubscription(ctx context.Context, tenantID, id string) error
+
+	// RecordAttempt updates a subscription's failure count after a delivery
+	// attempt in one step, leaving its other fields alone. Success resets
+	// the count; failure increments it and, once it reaches disableAfter,
+	// disables an active subscription with reason. It returns the updated
+	// subscription.
+	RecordAttempt(ctx context.Context, tenantID, id string, succeeded bool, disableAfter int, reason string, now time.Time) (*Subscription, error)
+
+	// CreateDelivery returns ErrDuplicate if the delivery ID exists
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+
+	// ListDeliveries returns a subscription's deliveries, newest first
+	ListDeliveries(ctx context.Context, tenantID, subscriptionID string, limit int) ([]*Delivery, error)
+
+	// ClaimDueDeliveries returns pending deliveries due by now and pushes
+	// their next attempt back by lease, so concurrent workers skip them
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+}
+
+// MemoryStore is an in-memory Store. Records are copied in and out, so
+// callers never share state with the store.
+type MemoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[string]*Subscription
+	deliveries    map[string]*Delivery
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string]*Delivery),
+	}
+}
+
+func copySubscription(sub *Subscription) *Subscription {
+	copied := *sub
+	copied.Events = append([]string(nil), sub.Events...)
+	if sub.DisabledAt != nil {
+		disabledAt := *sub.DisabledAt
+		copied.DisabledAt = &disabledAt
+	}
+	return &copied
+}
+
+func copyDelivery(delivery *Delivery) *Delivery {
+	copied := *delivery
+	copied.Payload = append(json.RawMessage(nil), delivery.Payload...)
+	copied.Attempts = append([]Attempt(nil), delivery.Attempts...)
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		copied.NextAttemptAt = &next
+	}
+	return &copied
+}
+
+// CreateSubscription stores a new subscription
+func (m *MemoryStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.subscriptions[sub.ID]; exists {
+		return ErrDuplicate
+	}
+	m.subscriptions[sub.ID] = copySubscription(sub)
+	return nil
+}
+
+// GetSubscription returns a tenant's subscription
+func (m *MemoryStore) GetSubscription(ctx context.Context, tenantID, id string) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, exists := m.subscriptions[id]
+	if !exists || sub.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	return copySubscription(sub), nil
+}
+
+// ListSubscriptions returns a tenant's subscriptions, oldest first
+func (m *MemoryStore) ListSubscriptions(ctx context.Context, tenantID string) ([]*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var subs []*Subscription
+	for _, sub := range m.subscriptions {
+		if sub.TenantID == tenantID {
+			subs = append(subs, copySubscription(sub))
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].ID < subs[j].ID
+		}
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs, nil
+}
+
+// UpdateSubscription replaces a stored subscription
+func (m *MemoryStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.subscriptions[sub.ID]
+	if !exists || existing.TenantID != sub.TenantID {
+		return ErrNotFound
+	}
+	m.subscriptions[sub.ID] = copySubscription(sub)
+	return nil
+}
+
+// RecordAttempt updates a subscription's failure count under the store's
+// lock
+func (m *MemoryStore) RecordAttempt(ctx context.Context, tenantID, id string, succeeded bool, disableAfter int, reason string, now time.Time) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, exists := m.subscriptions[id]
+	if !exists || sub.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	if succeeded {
+		sub.ConsecutiveFailures = 0
+	} else {
+		sub.ConsecutiveFailures++
+		if sub.Active && sub.ConsecutiveFailures >= disableAfter {
+			disabledAt := now
+			sub.Active = false
+			sub.DisabledAt = &disabledAt
+			sub.DisabledReason = reason
+		}
+	}
+	sub.UpdatedAt = now
+	return copySubscription(sub), nil
+}
+
+// DeleteSubscription removes a subscription; its delivery log is kept
+func (m *MemoryStore) DeleteSubscription(ctx context.Context, tenantID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, exists := m.subscriptions[id]
+	if !exists || sub.TenantID != tenantID {
+		return ErrNotFound
+	}
+	delete(m.subscriptions, id)
+	return nil
+}
+
+// CreateDelivery stores a new delivery
+func (m *MemoryStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.deliveries[delivery.ID]; exists {
+		return ErrDuplicate
+	}
+	m.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// GetDelivery returns a tenant's delivery
+func (m *MemoryStore) GetDelivery(ctx context.Context, tenantID, id string) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, exists := m.deliveries[id]
+	if !exists || delivery.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	return copyDelivery(delivery), nil
+}
+
+// UpdateDelivery replaces a stored delivery
+func (m *MemoryStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.deliveries[delivery.ID]
+	if !exists || existing.TenantID != delivery.TenantID {
+		return ErrNotFound
+	}
+	m.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// ListDeliveries returns a subscription's deliveries, newest first
+func (m *MemoryStore) ListDeliveries(ctx context.Context, tenantID, subscriptionID string, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []*Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.TenantID == tenantID && delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].ID > deliveries[j].ID
+		}
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// ClaimDueDeliveries returns pending deliveries due by now, oldest first
+func (m *MemoryStore) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Delivery, 0, len(due))
+	leaseUntil := now.Add(lease)
+	for _, delivery := range due {
+		delivery.NextAttemptAt = &leaseUntil
+		claimed = append(claimed, copyDelivery(delivery))
+	}
+	return claimed, nil
+}
@@ -0,0 +1,444 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/httputil"
+	"github.com/backsaas/platform/api/internal/pubsub"
+	"github.com/backsaas/platform/api/internal/retry"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"user.created"}`)
+	now := time.Now()
+
+	signed := func(secret string, timestamp time.Time, body []byte) http.Header {
+		header := http.Header{}
+		setSignatureHeaders(header, secret, "delivery-1", timestamp, body)
+		return header
+	}
+
+	rotated := signed("whsec_new", now, body)
+	rotated.Set(HeaderSignature, Sign("whsec_old", "delivery-1", now, body)+" "+rotated.Get(HeaderSignature))
+
+	testCases := []struct {
+		name     string
+		header   http.Header
+		body     []byte
+		expected error
+	}{
+		{"Valid", signed("whsec_new", now, body), body, nil},
+		{"RotatedSecrets", rotated, body, nil},
+		{"WrongSecret", signed("whsec_old", now, body), body, ErrInvalidSignature},
+		{"TamperedBody", signed("whsec_new", now, body), []byte(`{"event":"user.deleted"}`), ErrInvalidSignature},
+		{"Replayed", signed("whsec_new", now.Add(-time.Hour), body), body, ErrTimestampOutOfRange},
+		{"Unsigned", signed("", now, body), body, ErrMissingSignature},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Verify("whsec_new", tc.header, tc.body, 0); !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+// receiver is a webhook endpoint that verifies signatures
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	status   int
+	received []map[string]interface{}
+	server   *httptest.Server
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		body, _ := io.ReadAll(req.Body)
+		if err := Verify(r.secret, req.Header, body, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		r.received = append(r.received, payload)
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) set(secret string, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secret = secret
+	r.status = status
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// call makes a management API request as tenant-1
+func call(t *testing.T, api http.Handler, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(httputil.TenantHeader, "tenant-1")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	store := NewMemoryStore()
+	// The test receivers listen on loopback, which the default client refuses
+	dispatcher := NewDispatcher(store, NewSender(http.DefaultClient), Config{
+		Retry:        retry.Policy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour},
+		DisableAfter: 4,
+	})
+	clock := time.Now()
+	dispatcher.now = func() time.Time { return clock }
+
+	api := NewHandler(store, dispatcher, map[string][]string{"user.created": {"id"}}).Routes()
+	endpoint := newReceiver(t)
+	ctx := context.Background()
+
+	// Subscriptions are validated against the declared events
+	if status, _ := call(t, api, "POST", "/subscriptions", map[string]interface{}{"url": endpoint.server.URL, "events": []string{"user.deleted"}}); status != http.StatusBadRequest {
+		t.Errorf("Expected undeclared event to be rejected, got %d", status)
+	}
+	status, created := call(t, api, "POST", "/subscriptions", map[string]interface{}{"url": endpoint.server.URL, "events": []string{"user.created"}})
+	if status != http.StatusCreated {
+		t.Fatalf("Failed to create subscription: %d %v", status, created)
+	}
+	secret, _ := created["secret"].(string)
+	subscriptionID := created["data"].(map[string]interface{})["id"].(string)
+	endpoint.set(secret, http.StatusOK)
+
+	publish := func(id string) {
+		event := &pubsub.Event{ID: id, Name: "user.created", TenantID: "tenant-1", Data: map[string]interface{}{"id": id}, Timestamp: clock}
+		if err := dispatcher.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("Failed to handle event: %v", err)
+		}
+	}
+
+	t.Run("SignedDelivery", func(t *testing.T) {
+		publish("evt-1")
+		publish("evt-1") // the bus redelivered it
+		dispatcher.HandleEvent(ctx, &pubsub.Event{ID: "evt-other", Name: "user.created", TenantID: "tenant-2"})
+
+		if attempted, err := dispatcher.DeliverDue(ctx); err != nil || attempted != 1 {
+			t.Fatalf("Expected one delivery attempt, got %d (%v)", attempted, err)
+		}
+		if endpoint.count() != 1 || endpoint.received[0]["id"] != "evt-1" || endpoint.received[0]["event"] != "user.created" {
+			t.Fatalf("Expected receiver to verify one evt-1 delivery, got %v", endpoint.received)
+		}
+	})
+
+	t.Run("RetriesWithBackoff", func(t *testing.T) {
+		endpoint.set(secret, http.StatusServiceUnavailable)
+		publish("evt-2")
+		dispatcher.DeliverDue(ctx)
+
+		delivery, _ := store.GetDelivery(ctx, "tenant-1", "evt-2-"+subscriptionID)
+		if delivery.Status != DeliveryPending || len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("Expected a failed attempt and a pending retry, got %+v", delivery)
+		}
+		if wait := delivery.NextAttemptAt.Sub(clock); wait < 30*time.Second || wait > time.Minute {
+			t.Errorf("Expected retry within the first backoff step, got %v", wait)
+		}
+
+		// Nothing is due until the backoff elapses
+		if attempted, _ := dispatcher.DeliverDue(ctx); attempted != 0 {
+			t.Errorf("Expected no attempts before the backoff elapsed, got %d", attempted)
+		}
+		clock = clock.Add(time.Minute)
+		dispatcher.DeliverDue(ctx)
+		clock = clock.Add(2 * time.Minute)
+		dispatcher.DeliverDue(ctx)
+
+		delivery, _ = store.GetDelivery(ctx, "tenant-1", "evt-2-"+subscriptionID)
+		if delivery.Status != DeliveryFailed || len(delivery.Attempts) != 3 {
+			t.Errorf("Expected delivery to fail after 3 attempts, got %s after %d", delivery.Status, len(delivery.Attempts))
+		}
+	})
+
+	t.Run("AutoDisable", func(t *testing.T) {
+		publish("evt-3")
+		dispatcher.DeliverDue(ctx)
+
+		sub, _ := store.GetSubscription(ctx, "tenant-1", subscriptionID)
+		if sub.Active || sub.ConsecutiveFailures != 4 || sub.DisabledAt == nil {
+			t.Fatalf("Expected subscription disabled after 4 consecutive failures, got %+v", sub)
+		}
+
+		// Disabled subscriptions get no new deliveries
+		publish("evt-4")
+		if _, err := store.GetDelivery(ctx, "tenant-1", "evt-4-"+subscriptionID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected no delivery for a disabled subscription, got %v", err)
+		}
+	})
+
+	t.Run("DeliveryLogAndRedeliver", func(t *testing.T) {
+		status, log := call(t, api, "GET", "/subscriptions/"+subscriptionID+"/deliveries", nil)
+		if status != http.StatusOK || len(log["data"].([]interface{})) != 3 {
+			t.Fatalf("Expected 3 logged deliveries, got %d %v", status, log)
+		}
+
+		failedID := "evt-2-" + subscriptionID
+		if status, _ := call(t, api, "POST", "/deliveries/"+failedID+"/redeliver", nil); status != http.StatusConflict {
+			t.Errorf("Expected redelivery to a disabled subscription to conflict, got %d", status)
+		}
+
+		endpoint.set(secret, http.StatusOK)
+		if status, _ := call(t, api, "PATCH", "/subscriptions/"+subscriptionID, map[string]interface{}{"active": true}); status != http.StatusOK {
+			t.Fatalf("Failed to re-enable subscription: %d", status)
+		}
+
+		status, redelivered := call(t, api, "POST", "/deliveries/"+failedID+"/redeliver", nil)
+		if status != http.StatusAccepted {
+			t.Fatalf("Failed to redeliver: %d %v", status, redelivered)
+		}
+		data := redelivered["data"].(map[string]interface{})
+		if data["status"] != string(DeliverySucceeded) || data["redelivery_of"] != failedID {
+			t.Errorf("Expected a successful redelivery of %s, got %v", failedID, data)
+		}
+		if endpoint.received[len(endpoint.received)-1]["id"] != "evt-2" {
+			t.Errorf("Expected receiver to get evt-2 again, got %v", endpoint.received)
+		}
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/subscriptions/"+subscriptionID, nil)
+		req.Header.Set(httputil.TenantHeader, "tenant-2")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected another tenant to get 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAttemptKeepsConcurrentChanges(t *testing.T) {
+	store := NewMemoryStore()
+	dispatcher := NewDispatcher(store, NewSender(http.DefaultClient), Config{})
+	ctx := context.Background()
+
+	// The subscription's events change while a delivery is in flight
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sub, _ := store.GetSubscription(ctx, "tenant-1", "sub-1")
+		sub.Events = []string{"user.created", "user.updated"}
+		store.UpdateSubscription(ctx, sub)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	now := time.Now().UTC()
+	store.CreateSubscription(ctx, &Subscription{ID: "sub-1", TenantID: "tenant-1", URL: server.URL, Events: []string{"user.created"}, Active: true, CreatedAt: now, UpdatedAt: now})
+	if err := dispatcher.HandleEvent(ctx, &pubsub.Event{ID: "evt-1", Name: "user.created", TenantID: "tenant-1"}); err != nil {
+		t.Fatalf("Failed to handle event: %v", err)
+	}
+	if _, err := dispatcher.DeliverDue(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	sub, _ := store.GetSubscription(ctx, "tenant-1", "sub-1")
+	if len(sub.Events) != 2 || sub.ConsecutiveFailures != 1 {
+		t.Errorf("Expected the concurrent change and one failure to be kept, got %+v", sub)
+	}
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::ffff:10.0.0.1": false,
+		"64:ff9b::a00:1":  false,
+		"255.255.255.255": false,
+	} {
+		if got := publicAddress(netip.MustParseAddr(address)); got != public {
+			t.Errorf("publicAddress(%s): expected %v, got %v", address, public, got)
+		}
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	// A host name resolving to loopback is refused when dialed
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	attempt := NewSender(nil).Send(context.Background(), Message{URL: url, Body: []byte("{}")})
+	if attempt.Succeeded() || !strings.Contains(attempt.Error, ErrPrivateAddress.Error()) || requests != 0 {
+		t.Errorf("Expected the private address to be refused, got %+v after %d requests", attempt, requests)
+	}
+}
+
+// storeFactories returns a constructor for every backend available in this
+// environment
+func storeFactories(t *testing.T) map[string]func(t *testing.T) Store {
+	factories := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+	}
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		factories["postgres"] = func(t *testing.T) Store {
+			db, err := sql.Open("postgres", url)
+			if err != nil || db.Ping() != nil {
+				t.Skip("Database not accessible for testing")
+			}
+			// One connection, so the test schema stays on the search path
+			db.SetMaxOpenConns(1)
+			schema := fmt.Sprintf("webhooks_test_%d", time.Now().UnixNano())
+			if _, err := db.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema); err != nil {
+				t.Fatalf("Failed to create test schema: %v", err)
+			}
+			t.Cleanup(func() {
+				db.Exec("DROP SCHEMA " + schema + " CASCADE")
+				db.Close()
+			})
+			store := NewPostgresStore(db)
+			if err := store.Migrate(context.Background()); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+			return store
+		}
+	}
+	return factories
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := factory(t)
+
+			sub := &Subscription{ID: "sub-1", TenantID: "tenant-1", URL: "https://example.com/hooks", Events: []string{"user.created"},
+				Secret: "secret", Active: true, CreatedAt: start, UpdatedAt: start}
+			if err := store.CreateSubscription(ctx, sub); err != nil {
+				t.Fatalf("Failed to create subscription: %v", err)
+			}
+			if err := store.CreateSubscription(ctx, sub); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("Expected ErrDuplicate, got %v", err)
+			}
+			if _, err := store.GetSubscription(ctx, "tenant-2", "sub-1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected another tenant to get ErrNotFound, got %v", err)
+			}
+
+			// Failures count up to the threshold, then disable it
+			for i := 1; i <= 3; i++ {
+				got, err := store.RecordAttempt(ctx, "tenant-1", "sub-1", false, 3, "too many failures", start.Add(time.Duration(i)*time.Minute))
+				if err != nil {
+					t.Fatalf("Failed to record attempt: %v", err)
+				}
+				if got.ConsecutiveFailures != i || got.Active != (i < 3) {
+					t.Fatalf("After %d failures expected active=%v, got %+v", i, i < 3, got)
+				}
+			}
+			got, _ := store.GetSubscription(ctx, "tenant-1", "sub-1")
+			if got.DisabledAt == nil || !got.DisabledAt.Equal(start.Add(3*time.Minute)) || got.DisabledReason != "too many failures" ||
+				got.Secret != "secret" || len(got.Events) != 1 {
+				t.Errorf("Expected a disabled subscription with its fields kept, got %+v", got)
+			}
+			got, _ = store.RecordAttempt(ctx, "tenant-1", "sub-1", true, 3, "", start.Add(4*time.Minute))
+			if got.ConsecutiveFailures != 0 || got.Active {
+				t.Errorf("Expected success to reset the count but not re-enable, got %+v", got)
+			}
+			if _, err := store.RecordAttempt(ctx, "tenant-1", "missing", true, 3, "", start); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for a missing subscription, got %v", err)
+			}
+
+			// Deliveries are claimed once until their lease expires
+			for i, id := range []string{"d-1", "d-2", "d-3"} {
+				due := start.Add(time.Duration(i) * time.Second)
+				delivery := &Delivery{ID: id, TenantID: "tenant-1", SubscriptionID: "sub-1", EventID: "evt", Event: "user.created",
+					Payload: json.RawMessage(`{"id":"evt"}`), Status: DeliveryPending, NextAttemptAt: &due,
+					CreatedAt: due, UpdatedAt: due}
+				if err := store.CreateDelivery(ctx, delivery); err != nil {
+					t.Fatalf("Failed to create delivery: %v", err)
+				}
+			}
+			if err := store.CreateDelivery(ctx, &Delivery{ID: "d-1", TenantID: "tenant-1", Payload: json.RawMessage(`{}`), CreatedAt: start, UpdatedAt: start}); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("Expected ErrDuplicate, got %v", err)
+			}
+
+			claimed, err := store.ClaimDueDeliveries(ctx, start.Add(time.Second), time.Minute, 10)
+			if err != nil || len(claimed) != 2 || claimed[0].ID != "d-1" || claimed[1].ID != "d-2" {
+				t.Fatalf("Expected d-1 and d-2 claimed, got %v (%v)", claimed, err)
+			}
+			if again, _ := store.ClaimDueDeliveries(ctx, start.Add(2*time.Second), time.Minute, 10); len(again) != 1 || again[0].ID != "d-3" {
+				t.Errorf("Expected only d-3 while the others are leased, got %v", again)
+			}
+
+			delivery := claimed[0]
+			delivery.Status = DeliveryFailed
+			delivery.NextAttemptAt = nil
+			delivery.Attempts = append(delivery.Attempts, Attempt{At: start, StatusCode: 500, DurationMS: 12})
+			if err := store.UpdateDelivery(ctx, delivery); err != nil {
+				t.Fatalf("Failed to update delivery: %v", err)
+			}
+			stored, err := store.GetDelivery(ctx, "tenant-1", "d-1")
+			if err != nil || stored.Status != DeliveryFailed || stored.NextAttemptAt != nil || len(stored.Attempts) != 1 ||
+				stored.Attempts[0].StatusCode != 500 || string(stored.Payload) != `{"id": "evt"}` && string(stored.Payload) != `{"id":"evt"}` {
+				t.Errorf("Unexpected stored delivery %+v (%v)", stored, err)
+			}
+
+			log, err := store.ListDeliveries(ctx, "tenant-1", "sub-1", 2)
+			if err != nil || len(log) != 2 || log[0].ID != "d-3" || log[1].ID != "d-2" {
+				t.Errorf("Expected the newest two deliveries, got %v (%v)", log, err)
+			}
+
+			if err := store.DeleteSubscription(ctx, "tenant-1", "sub-1"); err != nil {
+				t.Fatalf("Failed to delete subscription: %v", err)
+			}
+			if err := store.DeleteSubscription(ctx, "tenant-1", "sub-1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+			}
+			if _, err := store.GetDelivery(ctx, "tenant-1", "d-1"); err != nil {
+				t.Errorf("Expected the delivery log to outlive the subscription, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package functest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/pubsub"
+)
+
+// Event is an event a function published or scheduled
+type Event struct {
+	Name  string                 `json:"name"`
+	Data  map[string]interface{} `json:"data"`
+	Delay string                 `json:"delay,omitempty"` // set for scheduled events
+}
+
+// Email is an email a function queued
+type Email struct {
+	Template string                 `json:"template"`
+	To       string                 `json:"to"`
+	Data     map[string]interface{} `json:"data"`
+}
+
+// Webhook is a webhook a function sent
+type Webhook struct {
+	URL     string                 `json:"url"`
+	Payload map[string]interface{} `json:"payload"`
+	Signed  bool                   `json:"signed"`
+}
+
+// LogEntry is a message a function logged
+type LogEntry struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Error   string                 `json:"error,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// DataService is an in-memory types.DataService holding a case's fixtures
+type DataService struct {
+	mu      sync.Mutex
+	records map[string][]map[string]interface{}
+	nextID  int
+}
+
+// NewDataService creates a data service seeded with records by entity
+func NewDataService(data map[string][]map[string]interface{}) *DataService {
+	s := &DataService{records: make(map[string][]map[string]interface{})}
+	for entity, records := range data {
+		for _, record := range records {
+			s.records[entity] = append(s.records[entity], copyRecord(record))
+		}
+	}
+	return s
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		copied[k] = v
+	}
+	return copied
+}
+
+// matches reports whether a record has every filter's value
+func matches(record, filters map[string]interface{}) bool {
+	for field, value := range filters {
+		if !reflect.DeepEqual(normalize(record[field]), normalize(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindByID returns the entity's record with the given id
+func (s *DataService) FindByID(ctx context.Context, entity, id string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range s.records[entity] {
+		if fmt.Sprint(record["id"]) == id {
+			return copyRecord(record), nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s not found", entity, id)
+}
+
+// FindMany returns the entity's records matching every filter
+func (s *DataService) FindMany(ctx context.Context, entity string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []map[string]interface{}
+	for _, record := range s.records[entity] {
+		if matches(record, filters) {
+			found = append(found, copyRecord(record))
+		}
+	}
+	return found, nil
+}
+
+// Count returns the number of the entity's records matching every filter
+func (s *DataService) Count(ctx context.Context, entity string, filters map[string]interface{}) (int64, error) {
+	found, err := s.FindMany(ctx, entity, filters)
+	return int64(len(found)), err
+}
+
+// Create stores a record, assigning an id when it has none
+func (s *DataService) Create(ctx context.Context, entity string, data map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := copyRecord(data)
+	if _, exists := record["id"]; !exists {
+		s.nextID++
+		record["id"] = fmt.Sprintf("%s-%d", entity, s.nextID)
+	}
+	s.records[entity] = append(s.records[entity], record)
+	return copyRecord(record), nil
+}
+
+// Update merges data into the entity's record with the given id
+func (s *DataService) Update(ctx context.Context, entity, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range s.records[entity] {
+		if fmt.Sprint(record["id"]) == id {
+			for k, v := range data {
+				record[k] = v
+			}
+			return copyRecord(record), nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s not found", entity, id)
+}
+
+// Delete removes the entity's record with the given id
+func (s *DataService) Delete(ctx context.Context, entity, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, record := range s.records[entity] {
+		if fmt.Sprint(record["id"]) == id {
+			s.records[entity] = append(s.records[entity][:i], s.records[entity][i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s not found", entity, id)
+}
+
+// EventService records published events. Like the event bus, it rejects
+// events that don't match Declared, the schema's declared events by name;
+// with Declared nil any event is recorded.
+type EventService struct {
+	Declared map[string][]string
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// Publish validates and records an event
+func (s *EventService) Publish(ctx context.Context, event string, data map[string]interface{}) error {
+	return s.record(Event{Name: event, Data: copyRecord(data)})
+}
+
+// Schedule validates and records an event as if it had been published after
+// delay
+func (s *EventService) Schedule(ctx context.Context, event string, data map[string]interface{}, delay time.Duration) error {
+	return s.record(Event{Name: event, Data: copyRecord(data), Delay: delay.String()})
+}
+
+func (s *EventService) record(event Event) error {
+	if err := pubsub.ValidateEvent(s.Declared, &pubsub.Event{Name: event.Name, Data: event.Data}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the published and scheduled events, oldest first
+func (s *EventService) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// EmailService records queued emails
+type EmailService struct {
+	mu     sync.Mutex
+	emails []Email
+}
+
+// SendTemplatedEmail records an email, returning a fake delivery ID
+func (s *EmailService) SendTemplatedEmail(ctx context.Context, tenantID, template, to string, data map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emails = append(s.emails, Email{Template: template, To: to, Data: copyRecord(data)})
+	return fmt.Sprintf("delivery-%d", len(s.emails)), nil
+}
+
+// Emails returns the queued emails, oldest first
+func (s *EmailService) Emails() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.emails...)
+}
+
+// WebhookService records webhooks instead of sending them, so cases never
+// reach the network
+type WebhookService struct {
+	mu       sync.Mutex
+	webhooks []Webhook
+}
+
+// SendWebhook records a webhook and reports it delivered
+func (s *WebhookService) SendWebhook(ctx context.Context, url, secret, id string, body []byte) (int, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks = append(s.webhooks, Webhook{URL: url, Payload: payload, Signed: secret != ""})
+	return http.StatusOK, nil
+}
+
+// Webhooks returns the sent webhooks, oldest first
+func (s *WebhookService) Webhooks() []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Webhook(nil), s.webhooks...)
+}
+
+// Logger records log messages
+type Logger struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func (l *Logger) log(level, msg string, err error, fields map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := LogEntry{Level: level, Message: msg, Fields: fields}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// Info records an info message
+func (l *Logger) Info(msg string, fields map[string]interface{}) { l.log("info", msg, nil, fields) }
+
+// Warn records a warning
+func (l *Logger) Warn(msg string, fields map[string]interface{}) { l.log("warn", msg, nil, fields) }
+
+// Error records an error
+func (l *Logger) Error(msg string, err error, fields map[string]interface{}) {
+	l.log("error", msg, err, fields)
+}
+
+// Entries returns the logged messages, oldest first
+func (l *Logger) Entries() []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]LogEntry(nil), l.entries...)
+}
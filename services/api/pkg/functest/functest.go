@@ -0,0 +1,181 @@
+// Package functest runs the test cases written next to a schema's
+// platform_functions. Each case gives an input record, optional config
+// overrides and fixture data, and the result, error, events, emails or
+// webhooks the function should produce:
+//
+//	platform_functions:
+//	  validate_user_email:
+//	    entity: users
+//	    type: validation
+//	    field: email
+//	    function: validate_email
+//	    config:
+//	      allowed_domains: ["example.com"]
+//	    tests:
+//	      - name: allowed domain
+//	        record: { email: "ada@example.com" }
+//	        expect: { result: true }
+//	      - name: other domain
+//	        record: { email: "ada@other.com" }
+//	        expect: { error: "domain not allowed" }
+//
+// Cases run against the real function registry. The data, event, email,
+// webhook and logging services functions see are in-memory fakes, so tests
+// never touch a database, the event bus, a mail server or the network.
+package functest
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the part of a schema document the runner reads
+type Schema struct {
+	Functions map[string]*PlatformFunction `yaml:"platform_functions" json:"platform_functions"`
+
+	// Events are the schema's declared events. Events functions publish are
+	// validated against them as the event bus would; without an events
+	// section any event is accepted.
+	Events map[string]*EventDefinition `yaml:"events,omitempty" json:"events,omitempty"`
+}
+
+// EventDefinition is an event declared in a schema's events section
+type EventDefinition struct {
+	Fields []string `yaml:"fields" json:"fields"`
+}
+
+// PlatformFunction binds registry functions to an entity, as declared in a
+// schema's platform_functions section
+type PlatformFunction struct {
+	Entity  string `yaml:"entity" json:"entity"`
+	Type    string `yaml:"type" json:"type"`
+	Trigger string `yaml:"trigger" json:"trigger"`
+
+	// Field and Function are set for validations: the field's value is
+	// passed to the function along with Config
+	Field    string                 `yaml:"field,omitempty" json:"field,omitempty"`
+	Function string                 `yaml:"function,omitempty" json:"function,omitempty"`
+	Config   map[string]interface{} `yaml:"config,omitempty" json:"config,omitempty"`
+
+	// Functions and Events are set for hooks: each function is called in
+	// turn, then each event is published
+	Functions []FunctionCall `yaml:"functions,omitempty" json:"functions,omitempty"`
+	Events    []EventCall    `yaml:"events,omitempty" json:"events,omitempty"`
+
+	// Code is inline JavaScript, which the runner can't execute
+	Code string `yaml:"code,omitempty" json:"code,omitempty"`
+
+	Tests []*Case `yaml:"tests,omitempty" json:"tests,omitempty"`
+}
+
+// FunctionCall is one function a hook calls
+type FunctionCall struct {
+	Function string                 `yaml:"function" json:"function"`
+	Config   map[string]interface{} `yaml:"config" json:"config"`
+}
+
+// EventCall is one event a hook publishes
+type EventCall struct {
+	Event string                 `yaml:"event" json:"event"`
+	Data  map[string]interface{} `yaml:"data" json:"data"`
+}
+
+// Case is one test of a platform function
+type Case struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+
+	// Record is the entity record the function runs for
+	Record map[string]interface{} `yaml:"record" json:"record"`
+
+	// Config overrides keys of the function's config; for hooks it applies
+	// to every function call
+	Config map[string]interface{} `yaml:"config,omitempty" json:"config,omitempty"`
+
+	// Data seeds the fake data service with records by entity
+	Data map[string][]map[string]interface{} `yaml:"data,omitempty" json:"data,omitempty"`
+
+	Expect Expectation `yaml:"expect" json:"expect"`
+}
+
+// Expectation is what a case checks. Without Error, the function must
+// succeed.
+type Expectation struct {
+	// Result is the expected return value; a hook returns a list with one
+	// result per function call. Omit it to not check the result.
+	Result interface{} `yaml:"result,omitempty" json:"result,omitempty"`
+
+	// Error is text the function's error must contain
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+
+	// Events are the names of the events that must be published, in order
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+
+	// Emails are the emails that must be queued, in order
+	Emails []ExpectedEmail `yaml:"emails,omitempty" json:"emails,omitempty"`
+
+	// Webhooks are the URLs webhooks must be sent to, in order
+	Webhooks []string `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+}
+
+// ExpectedEmail is an email a case expects to be queued
+type ExpectedEmail struct {
+	Template string `yaml:"template" json:"template"`
+	To       string `yaml:"to" json:"to"`
+}
+
+// Load parses a schema document. JSON documents parse too.
+func Load(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	for name, fn := range schema.Functions {
+		if fn == nil {
+			return nil, fmt.Errorf("platform function %s is empty", name)
+		}
+		for i, tc := range fn.Tests {
+			if tc == nil || tc.Name == "" {
+				return nil, fmt.Errorf("platform function %s: test %d needs a name", name, i+1)
+			}
+		}
+	}
+	return &schema, nil
+}
+
+// LoadFile reads and parses a schema file
+func LoadFile(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return Load(data)
+}
+
+// declaredEvents returns each declared event's fields, or nil when the
+// schema declares none
+func (s *Schema) declaredEvents() map[string][]string {
+	if len(s.Events) == 0 {
+		return nil
+	}
+	events := make(map[string][]string, len(s.Events))
+	for name, event := range s.Events {
+		if event != nil {
+			events[name] = event.Fields
+		}
+	}
+	return events
+}
+
+// functionNames returns the schema's platform functions, sorted
+func (s *Schema) functionNames() []string {
+	names := make([]string, 0, len(s.Functions))
+	for name := range s.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
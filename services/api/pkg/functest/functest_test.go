@@ -0,0 +1,310 @@
+package functest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+const testSchema = `
+platform_functions:
+  check_birth_date:
+    entity: people
+    type: validation
+    trigger: "before_create,before_update"
+    field: birth_date
+    function: calculate_age
+    tests:
+      - name: past date
+        record: { birth_date: "1990-06-01" }
+        expect: {}
+      - name: future date
+        record: { birth_date: "2999-01-01" }
+        expect: { error: "in the future" }
+      - name: wrong expectation
+        record: { birth_date: "2999-01-01" }
+        expect: { result: 3 }
+
+  welcome_user:
+    entity: users
+    type: hook
+    trigger: after_create
+    functions:
+      - function: welcome
+        config:
+          to_field: email
+    events:
+      - event: user.created
+        data:
+          user_id: "{{id}}"
+          greeting: "Hi {{name || 'there'}}"
+    tests:
+      - name: sends welcome
+        record: { id: "u1", email: "ada@example.com" }
+        expect:
+          result: ["welcomed ada@example.com"]
+          events: [user.created]
+          emails: [{ template: user_welcome, to: ada@example.com }]
+      - name: no email
+        record: { id: "u2" }
+        expect:
+          error: "required parameter to missing"
+          events: []
+          emails: []
+
+  count_teammates:
+    entity: users
+    type: hook
+    trigger: after_create
+    functions:
+      - function: count_users
+        config:
+          filters: { team: "{{team}}" }
+    tests:
+      - name: counts fixtures
+        record: { team: 7 }
+        data:
+          users:
+            - { id: "a", team: 7 }
+            - { id: "b", team: 7 }
+            - { id: "c", team: 8 }
+        expect: { result: [2] }
+      - name: config override
+        record: { team: 7 }
+        config: { filters: { team: 8 } }
+        data:
+          users: [{ id: "c", team: 8 }]
+        expect: { result: [1] }
+
+  provision:
+    entity: tenants
+    type: hook
+    trigger: after_create
+    code: "async function provision() {}"
+    tests:
+      - name: inline code
+        record: {}
+        expect: {}
+`
+
+// newTestRunner returns a runner with test functions added to the registry
+func newTestRunner(t *testing.T) *Runner {
+	runner := NewRunner()
+	type welcomeParams struct {
+		To string `param:"to,required"`
+	}
+	type countParams struct {
+		Filters map[string]interface{} `param:"filters,required"`
+	}
+	err := functions.RegisterFunc(runner.registry, functions.FunctionDefinition{Name: "welcome"}, func(ctx context.Context, execCtx *types.ExecutionContext, p welcomeParams) (string, error) {
+		if _, err := execCtx.EmailService.SendTemplatedEmail(ctx, execCtx.TenantID, "user_welcome", p.To, nil); err != nil {
+			return "", err
+		}
+		return "welcomed " + p.To, nil
+	})
+	if err == nil {
+		err = functions.RegisterFunc(runner.registry, functions.FunctionDefinition{Name: "count_users"}, func(ctx context.Context, execCtx *types.ExecutionContext, p countParams) (int, error) {
+			users, err := execCtx.DataService.FindMany(ctx, "users", p.Filters)
+			return len(users), err
+		})
+	}
+	if err != nil {
+		t.Fatalf("Failed to register test functions: %v", err)
+	}
+	return runner
+}
+
+func TestRun(t *testing.T) {
+	schema, err := Load([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	report, err := newTestRunner(t).Run(context.Background(), schema, "")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	statuses := make(map[string]Status)
+	results := make(map[string]*CaseResult)
+	for _, result := range report.Results {
+		statuses[result.Function+"/"+result.Case] = result.Status
+		results[result.Function+"/"+result.Case] = result
+	}
+	expected := map[string]Status{
+		"check_birth_date/past date":         StatusPassed,
+		"check_birth_date/future date":       StatusPassed,
+		"check_birth_date/wrong expectation": StatusFailed,
+		"welcome_user/sends welcome":         StatusPassed,
+		"welcome_user/no email":              StatusPassed,
+		"count_teammates/counts fixtures":    StatusPassed,
+		"count_teammates/config override":    StatusPassed,
+		"provision/inline code":              StatusError,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		for name, result := range results {
+			t.Logf("%s: %s %s", name, result.Status, result.Message)
+		}
+		t.Fatalf("Expected %v, got %v", expected, statuses)
+	}
+	if report.Total != 8 || report.Passed != 6 || report.Failed != 1 || report.Errors != 1 || report.OK() {
+		t.Errorf("Expected 6 passed, 1 failed and 1 error, got %+v", report)
+	}
+
+	welcome := results["welcome_user/sends welcome"]
+	if len(welcome.Events) != 1 || !reflect.DeepEqual(welcome.Events[0].Data, map[string]interface{}{"user_id": "u1", "greeting": "Hi there"}) {
+		t.Errorf("Expected the event data templated from the record, got %+v", welcome.Events)
+	}
+	if message := results["check_birth_date/wrong expectation"].Message; !strings.Contains(message, "unexpected error") {
+		t.Errorf("Expected the failure explained, got %q", message)
+	}
+
+	t.Run("Filter", func(t *testing.T) {
+		report, err := newTestRunner(t).Run(context.Background(), schema, "welcome_user")
+		if err != nil || report.Total != 2 || !report.OK() {
+			t.Errorf("Expected 2 passing cases, got %+v, %v", report, err)
+		}
+		if _, err := newTestRunner(t).Run(context.Background(), schema, "missing"); err == nil {
+			t.Errorf("Expected an unknown function to fail")
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJSON(&buf); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if decoded["total"] != float64(8) || len(decoded["results"].([]interface{})) != 8 {
+			t.Errorf("Expected 8 results, got %s", buf.String())
+		}
+	})
+
+	t.Run("JUnit", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJUnit(&buf); err != nil {
+			t.Fatalf("WriteJUnit failed: %v", err)
+		}
+		var suites junitSuites
+		if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+			t.Fatalf("Invalid XML: %v\n%s", err, buf.String())
+		}
+		if suites.Tests != 8 || suites.Failures != 1 || suites.Errors != 1 || len(suites.Suites) != 4 {
+			t.Errorf("Expected 4 suites of 8 cases, got %+v", suites)
+		}
+		for _, suite := range suites.Suites {
+			if suite.Name == "check_birth_date" && (suite.Tests != 3 || suite.Failures != 1 || suite.Cases[2].Failure == nil) {
+				t.Errorf("Expected the failure in check_birth_date, got %+v", suite)
+			}
+			if suite.Name == "provision" && suite.Cases[0].Error == nil {
+				t.Errorf("Expected the inline code case to error, got %+v", suite)
+			}
+		}
+	})
+}
+
+func TestRunRecordsWebhooks(t *testing.T) {
+	var received int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer receiver.Close()
+
+	schema, err := Load([]byte(`
+platform_functions:
+  notify_partner:
+    entity: orders
+    type: hook
+    trigger: after_create
+    functions:
+      - function: send_webhook
+        config:
+          url: "` + receiver.URL + `/orders"
+          payload: { order_id: "{{id}}" }
+          secret: whsec_test
+    tests:
+      - name: sends webhook
+        record: { id: "o1" }
+        expect: { webhooks: ["` + receiver.URL + `/orders"], events: [webhook.sent] }
+`))
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	report, err := NewRunner().Run(context.Background(), schema, "")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Expected the case to pass, got %+v", report.Results[0])
+	}
+	webhooks := report.Results[0].Webhooks
+	if len(webhooks) != 1 || webhooks[0].Payload["order_id"] != "o1" || !webhooks[0].Signed {
+		t.Errorf("Expected the signed webhook recorded, got %+v", webhooks)
+	}
+	if n := atomic.LoadInt32(&received); n != 0 {
+		t.Errorf("Expected no request to reach the receiver, got %d", n)
+	}
+}
+
+func TestRunValidatesEvents(t *testing.T) {
+	schema, err := Load([]byte(testSchema + `
+events:
+  user.created:
+    fields: [id, greeting]
+`))
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	report, err := newTestRunner(t).Run(context.Background(), schema, "welcome_user")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	result := report.Results[0]
+	if result.Case != "sends welcome" || result.Status != StatusFailed || !strings.Contains(result.Message, "undeclared fields user_id") {
+		t.Errorf("Expected the undeclared event field to fail the case, got %+v", result)
+	}
+	if len(result.Events) != 0 {
+		t.Errorf("Expected the invalid event not to be recorded, got %+v", result.Events)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if _, err := Load([]byte("platform_functions:\n  f:\n    tests:\n      - record: {}\n")); err == nil {
+		t.Errorf("Expected a case without a name to be rejected")
+	}
+	schema, err := Load([]byte(`{"platform_functions": {"f": {"function": "hash_password", "tests": [{"name": "json"}]}}}`))
+	if err != nil || schema.Functions["f"].Tests[0].Name != "json" {
+		t.Errorf("Expected JSON to load, got %+v, %v", schema, err)
+	}
+}
+
+func TestSystemSchema(t *testing.T) {
+	schema, err := LoadFile("../../system/schema/platform.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load the system schema: %v", err)
+	}
+	report, err := NewRunner().Run(context.Background(), schema, "")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Total == 0 {
+		t.Fatal("Expected the system schema to have function tests")
+	}
+	for _, result := range report.Results {
+		if result.Status != StatusPassed {
+			t.Errorf("%s/%s %s: %s", result.Function, result.Case, result.Status, result.Message)
+		}
+	}
+}
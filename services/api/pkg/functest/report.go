@@ -0,0 +1,163 @@
+package functest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Status is the outcome of a case
+type Status string
+
+// Case outcomes
+const (
+	// StatusPassed cases met every expectation
+	StatusPassed Status = "passed"
+
+	// StatusFailed cases ran but missed an expectation
+	StatusFailed Status = "failed"
+
+	// StatusError cases could not run, such as cases of inline code
+	// functions or of functions the registry doesn't have
+	StatusError Status = "error"
+)
+
+// CaseResult is the outcome of one case, with everything the function did
+type CaseResult struct {
+	Function   string      `json:"function"`
+	Case       string      `json:"case"`
+	Status     Status      `json:"status"`
+	Message    string      `json:"message,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Events     []Event     `json:"events,omitempty"`
+	Emails     []Email     `json:"emails,omitempty"`
+	Webhooks   []Webhook   `json:"webhooks,omitempty"`
+	Logs       []LogEntry  `json:"logs,omitempty"`
+	DurationMS int64       `json:"duration_ms"`
+}
+
+// Report is the outcome of a test run
+type Report struct {
+	Total      int           `json:"total"`
+	Passed     int           `json:"passed"`
+	Failed     int           `json:"failed"`
+	Errors     int           `json:"errors"`
+	DurationMS int64         `json:"duration_ms"`
+	Results    []*CaseResult `json:"results"`
+}
+
+func (r *Report) add(result *CaseResult) {
+	r.Results = append(r.Results, result)
+	r.Total++
+	switch result.Status {
+	case StatusPassed:
+		r.Passed++
+	case StatusFailed:
+		r.Failed++
+	default:
+		r.Errors++
+	}
+}
+
+// OK reports whether every case passed
+func (r *Report) OK() bool {
+	return r.Failed == 0 && r.Errors == 0
+}
+
+// WriteJSON writes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	report := *r
+	if report.Results == nil {
+		report.Results = []*CaseResult{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+}
+
+func seconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per platform
+// function
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{
+		Name:     "platform_functions",
+		Tests:    r.Total,
+		Failures: r.Failed,
+		Errors:   r.Errors,
+		Time:     seconds(r.DurationMS),
+	}
+	index := make(map[string]int)
+	var durations []int64
+	for _, result := range r.Results {
+		i, exists := index[result.Function]
+		if !exists {
+			i = len(suites.Suites)
+			index[result.Function] = i
+			suites.Suites = append(suites.Suites, junitSuite{Name: result.Function})
+			durations = append(durations, 0)
+		}
+		suite := &suites.Suites[i]
+		testCase := junitCase{Name: result.Case, ClassName: result.Function, Time: seconds(result.DurationMS)}
+		switch result.Status {
+		case StatusFailed:
+			testCase.Failure = &junitProblem{Message: result.Message}
+			suite.Failures++
+		case StatusError:
+			testCase.Error = &junitProblem{Message: result.Message}
+			suite.Errors++
+		}
+		suite.Tests++
+		durations[i] += result.DurationMS
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	for i := range suites.Suites {
+		suites.Suites[i].Time = seconds(durations[i])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
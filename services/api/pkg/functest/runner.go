@@ -0,0 +1,250 @@
+package functest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/functions"
+	"github.com/backsaas/platform/api/internal/types"
+)
+
+// TenantID is the tenant cases run as
+const TenantID = "test-tenant"
+
+// Runner runs schema test cases against the function registry
+type Runner struct {
+	registry *functions.FunctionRegistry
+}
+
+// NewRunner creates a runner over the platform's function registry
+func NewRunner() *Runner {
+	return &Runner{registry: functions.InitializeRegistry()}
+}
+
+// Run runs the schema's test cases, or only the cases of the named platform
+// function when function is not empty. Failing cases are reported, not
+// returned as errors.
+func (r *Runner) Run(ctx context.Context, schema *Schema, function string) (*Report, error) {
+	names := schema.functionNames()
+	if function != "" {
+		if _, exists := schema.Functions[function]; !exists {
+			return nil, fmt.Errorf("platform function %s not found", function)
+		}
+		names = []string{function}
+	}
+
+	report := &Report{}
+	started := time.Now()
+	events := schema.declaredEvents()
+	for _, name := range names {
+		fn := schema.Functions[name]
+		for _, tc := range fn.Tests {
+			report.add(r.runCase(ctx, name, fn, tc, events))
+		}
+	}
+	report.DurationMS = time.Since(started).Milliseconds()
+	return report, nil
+}
+
+// runCase runs one case and checks its expectations. Published events are
+// validated against events, the schema's declared events.
+func (r *Runner) runCase(ctx context.Context, name string, fn *PlatformFunction, tc *Case, events map[string][]string) *CaseResult {
+	result := &CaseResult{Function: name, Case: tc.Name}
+	started := time.Now()
+	defer func() { result.DurationMS = time.Since(started).Milliseconds() }()
+
+	data := NewDataService(tc.Data)
+	eventService := &EventService{Declared: events}
+	emails := &EmailService{}
+	webhooks := &WebhookService{}
+	logger := &Logger{}
+	execCtx := &types.ExecutionContext{
+		TenantID:     TenantID,
+		RequestID:    "test-" + name,
+		Entity:       fn.Entity,
+		Operation:    strings.TrimSpace(strings.Split(fn.Trigger, ",")[0]),
+		Logger:       logger,
+		DataService:  data,
+		EventService: eventService,
+		EmailService: emails,
+		Data:         tc.Record,
+
+		WebhookService: webhooks,
+	}
+
+	value, err := r.call(ctx, fn, tc, execCtx)
+	result.Events = eventService.Events()
+	result.Emails = emails.Emails()
+	result.Webhooks = webhooks.Webhooks()
+	result.Logs = logger.Entries()
+	if err != nil {
+		if _, unsupported := err.(unsupportedError); unsupported {
+			result.Status = StatusError
+			result.Message = err.Error()
+			return result
+		}
+		result.Error = err.Error()
+	} else {
+		result.Result = normalize(value)
+	}
+
+	result.Status = StatusPassed
+	if message := check(tc.Expect, result); message != "" {
+		result.Status = StatusFailed
+		result.Message = message
+	}
+	return result
+}
+
+// unsupportedError is returned for cases the runner can't run at all
+type unsupportedError string
+
+func (e unsupportedError) Error() string { return string(e) }
+
+// call runs a platform function for a case's record
+func (r *Runner) call(ctx context.Context, fn *PlatformFunction, tc *Case, execCtx *types.ExecutionContext) (interface{}, error) {
+	switch {
+	case fn.Code != "":
+		return nil, unsupportedError("inline code functions can't be run by the test runner")
+
+	case fn.Function != "":
+		def, exists := r.registry.Get(fn.Function)
+		if !exists {
+			return nil, unsupportedError(fmt.Sprintf("function %s not found", fn.Function))
+		}
+		params, err := functions.CallParams(def, merge(fn.Config, tc.Config), tc.Record)
+		if err != nil {
+			return nil, err
+		}
+		if fn.Field != "" {
+			setFieldParam(def, params, fn.Field, tc.Record[fn.Field])
+		}
+		return r.registry.Execute(ctx, def.Name, params, execCtx)
+
+	case len(fn.Functions) > 0 || len(fn.Events) > 0:
+		results := make([]interface{}, 0, len(fn.Functions))
+		for _, call := range fn.Functions {
+			def, exists := r.registry.Get(call.Function)
+			if !exists {
+				return nil, unsupportedError(fmt.Sprintf("function %s not found", call.Function))
+			}
+			params, err := functions.CallParams(def, merge(call.Config, tc.Config), tc.Record)
+			if err != nil {
+				return nil, err
+			}
+			value, err := r.registry.Execute(ctx, def.Name, params, execCtx)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", call.Function, err)
+			}
+			results = append(results, value)
+		}
+		for _, event := range fn.Events {
+			data, _ := functions.ExpandTemplates(event.Data, tc.Record).(map[string]interface{})
+			if err := execCtx.EventService.Publish(ctx, event.Event, data); err != nil {
+				return nil, err
+			}
+		}
+		return results, nil
+
+	default:
+		return nil, unsupportedError("platform function has no function, functions or code")
+	}
+}
+
+// setFieldParam passes a validated field's value to the param named like
+// the field, or else to the only required param the config left unset
+func setFieldParam(def *functions.FunctionDefinition, params map[string]interface{}, field string, value interface{}) {
+	if _, declared := def.Params[field]; declared {
+		params[field] = value
+		return
+	}
+	var unset []string
+	for name, paramDef := range def.Params {
+		if _, set := params[name]; paramDef.Required && !set {
+			unset = append(unset, name)
+		}
+	}
+	if len(unset) == 1 {
+		params[unset[0]] = value
+	}
+}
+
+// merge returns config with overrides applied
+func merge(config, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(config)+len(overrides))
+	for k, v := range config {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// check compares a case's outcome with its expectations, returning what
+// differs
+func check(expect Expectation, result *CaseResult) string {
+	var problems []string
+	switch {
+	case expect.Error != "" && result.Error == "":
+		problems = append(problems, fmt.Sprintf("expected error containing %q, got none", expect.Error))
+	case expect.Error != "" && !strings.Contains(result.Error, expect.Error):
+		problems = append(problems, fmt.Sprintf("expected error containing %q, got %q", expect.Error, result.Error))
+	case expect.Error == "" && result.Error != "":
+		problems = append(problems, fmt.Sprintf("unexpected error: %s", result.Error))
+	case expect.Result != nil && !reflect.DeepEqual(normalize(expect.Result), result.Result):
+		problems = append(problems, fmt.Sprintf("expected result %s, got %s", encode(expect.Result), encode(result.Result)))
+	}
+
+	if expect.Events != nil {
+		names := make([]string, len(result.Events))
+		for i, event := range result.Events {
+			names[i] = event.Name
+		}
+		if !reflect.DeepEqual(expect.Events, names) && !(len(expect.Events) == 0 && len(names) == 0) {
+			problems = append(problems, fmt.Sprintf("expected events %v, got %v", expect.Events, names))
+		}
+	}
+
+	if expect.Emails != nil {
+		sent := make([]ExpectedEmail, len(result.Emails))
+		for i, email := range result.Emails {
+			sent[i] = ExpectedEmail{Template: email.Template, To: email.To}
+		}
+		if !reflect.DeepEqual(expect.Emails, sent) && !(len(expect.Emails) == 0 && len(sent) == 0) {
+			problems = append(problems, fmt.Sprintf("expected emails %s, got %s", encode(expect.Emails), encode(sent)))
+		}
+	}
+
+	if expect.Webhooks != nil {
+		urls := make([]string, len(result.Webhooks))
+		for i, webhook := range result.Webhooks {
+			urls[i] = webhook.URL
+		}
+		if !reflect.DeepEqual(expect.Webhooks, urls) && !(len(expect.Webhooks) == 0 && len(urls) == 0) {
+			problems = append(problems, fmt.Sprintf("expected webhooks %v, got %v", expect.Webhooks, urls))
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// normalize converts a value to its JSON form, so results compare equal to
+// expectations regardless of Go types
+func normalize(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	json.Unmarshal(encoded, &normalized)
+	return normalized
+}
+
+func encode(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,29 @@
+// Package functions exposes the contract Go functions run against, so
+// services outside this module can supply the data, event and logging
+// services a function's execution context needs.
+package functions
+
+import "github.com/backsaas/platform/api/internal/types"
+
+// ExecutionContext is the context a function runs in
+type ExecutionContext = types.ExecutionContext
+
+// DataService gives functions tenant-scoped, access-checked data operations
+type DataService = types.DataService
+
+// EventService publishes events on behalf of functions
+type EventService = types.EventService
+
+// EmailService queues templated email on behalf of functions
+type EmailService = types.EmailService
+
+// Logger is the structured logger functions write to
+type Logger = types.Logger
+
+// ErrAccessDenied is returned by a DataService for operations the caller's
+// access rules don't allow
+var ErrAccessDenied = types.ErrAccessDenied
+
+// ErrNoDataService is returned by data operations of functions run without
+// a DataService
+var ErrNoDataService = types.ErrNoDataService
@@ -0,0 +1,29 @@
+package functions
+
+import (
+	"context"
+	"time"
+
+	"github.com/backsaas/platform/api/internal/functions/utils"
+)
+
+// The utility functions need no execution context, so other services can
+// call them directly, for example from computed properties.
+
+// FormatCurrency formats an amount in the given ISO 4217 currency, as the
+// format_currency function does
+func FormatCurrency(amount float64, currencyCode string) (string, error) {
+	return utils.FormatCurrency(context.Background(), nil, amount, currencyCode)
+}
+
+// ParseDate parses a date string with a Go layout, as the parse_date
+// function does
+func ParseDate(dateString string, format string) (time.Time, error) {
+	return utils.ParseDate(context.Background(), nil, dateString, format)
+}
+
+// CalculateAge returns the number of whole years since a birth date, as the
+// calculate_age function does
+func CalculateAge(birthDate time.Time) (int, error) {
+	return utils.CalculateAge(context.Background(), nil, birthDate)
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/backsaas/platform/services/gateway/internal/gateway"
 )
@@ -13,6 +17,7 @@ func main() {
 	var (
 		port        = flag.String("port", getEnv("PORT", "8000"), "Gateway port")
 		redisURL    = flag.String("redis-url", getEnv("REDIS_URL", "redis://localhost:6379"), "Redis URL for rate limiting and caching")
+		databaseURL = flag.String("database-url", getEnv("DATABASE_URL", ""), "Postgres URL for durable usage metering")
 		jwtSecret   = flag.String("jwt-secret", getEnv("JWT_SECRET", ""), "JWT secret for token validation")
 		configPath  = flag.String("config", getEnv("GATEWAY_CONFIG", "config/gateway.yaml"), "Gateway configuration file")
 		environment = flag.String("env", getEnv("ENVIRONMENT", "development"), "Environment (development, staging, production)")
@@ -28,6 +33,7 @@ func main() {
 	config := &gateway.Config{
 		Port:        *port,
 		RedisURL:    *redisURL,
+		DatabaseURL: *databaseURL,
 		JWTSecret:   *jwtSecret,
 		ConfigPath:  *configPath,
 		Environment: *environment,
@@ -43,9 +49,26 @@ func main() {
 	log.Printf("Environment: %s", *environment)
 	log.Printf("Config: %s", *configPath)
 
+	// Shut down gracefully on SIGINT and SIGTERM, closing WebSocket
+	// connections and finishing requests in flight
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := gw.Shutdown(ctx); err != nil {
+			log.Printf("Gateway shutdown failed: %v", err)
+		}
+		close(stopped)
+	}()
+
 	if err := gw.Start(); err != nil {
 		log.Fatalf("Gateway failed to start: %v", err)
 	}
+	<-stopped
 }
 
 func getEnv(key, defaultValue string) string {
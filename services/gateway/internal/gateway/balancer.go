@@ -0,0 +1,642 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies
+const (
+	BalanceRoundRobin       = "round_robin"
+	BalanceLeastConnections = "least_connections"
+	BalanceWeighted         = "weighted"
+	BalanceConsistentHash   = "consistent_hash" // by tenant
+)
+
+// retryBudgetWindow is the window retry budgets are counted over
+const retryBudgetWindow = 10 * time.Second
+
+// ringReplicas is the number of points each backend has on the consistent
+// hash ring, per unit of weight
+const ringReplicas = 100
+
+// Backend is one backend server in a pool
+type Backend struct {
+	URL    string
+	target *url.URL
+	weight int
+
+	active atomic.Int64 // proxied requests in flight
+
+	// Guarded by the pool's mutex
+	healthy       bool
+	checkPasses   int // consecutive passed health checks
+	checkFailures int // consecutive failed health checks
+	lastCheck     time.Time
+	errors        int // consecutive failed requests
+	ejections     int
+	ejectedUntil  time.Time
+	lastError     string
+	currentWeight int // smooth weighted round robin
+	breaker       circuitBreaker
+}
+
+// BackendStatus describes a backend's state for health and metrics output
+type BackendStatus struct {
+	URL               string     `json:"url"`
+	Healthy           bool       `json:"healthy"`
+	Ejected           bool       `json:"ejected"`
+	EjectedUntil      *time.Time `json:"ejected_until,omitempty"`
+	Weight            int        `json:"weight"`
+	ActiveConnections int64      `json:"active_connections"`
+	ConsecutiveErrors int        `json:"consecutive_errors"`
+	Circuit           string     `json:"circuit"`
+	LastCheck         *time.Time `json:"last_check,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+}
+
+// PoolStatus describes a backend pool for health and metrics output
+type PoolStatus struct {
+	Strategy string          `json:"strategy"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+// BackendPool balances requests over a route's backends and tracks their
+// health. A backend leaves the rotation when it fails active health checks
+// or is ejected after consecutive failed requests; if every backend is out,
+// requests are spread over all of them rather than refused. Backends with an
+// open circuit are skipped in either case.
+type BackendPool struct {
+	key        string
+	strategy   string
+	healthPath string
+	health     HealthCheckConfig
+	outliers   OutlierDetectionConfig
+	retry      RetryConfig
+	backends   []*Backend
+	ring       []ringPoint
+
+	mu        sync.Mutex
+	next      uint64 // round robin position
+	checking  bool
+	nextCheck time.Time
+
+	// Retry budget for the current window
+	budgetStart    time.Time
+	budgetRequests int
+	budgetRetries  int
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend *Backend
+}
+
+// newBackendPool creates a pool for a backend config
+func newBackendPool(backendConfig *BackendConfig) (*BackendPool, error) {
+	// Routes built in code may not have been through setDefaults
+	config := *backendConfig
+	setBackendDefaults(&config)
+
+	pool := &BackendPool{
+		key:        poolKey(backendConfig),
+		strategy:   config.LoadBalancing,
+		healthPath: config.HealthCheckPath,
+		health:     config.HealthCheck,
+		outliers:   config.OutlierDetection,
+		retry:      config.Retry,
+	}
+
+	for _, raw := range backendURLs(&config) {
+		target, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend URL %q: %w", raw, err)
+		}
+		weight := config.Weights[raw]
+		if weight < 1 {
+			weight = 1
+		}
+		pool.backends = append(pool.backends, &Backend{
+			URL:     raw,
+			target:  target,
+			weight:  weight,
+			healthy: true,
+			breaker: newCircuitBreaker(config.CircuitBreaker),
+		})
+	}
+	if len(pool.backends) == 0 {
+		return nil, fmt.Errorf("backend URL is required")
+	}
+
+	if pool.strategy == BalanceConsistentHash {
+		for _, backend := range pool.backends {
+			for i := 0; i < ringReplicas*backend.weight; i++ {
+				pool.ring = append(pool.ring, ringPoint{hash: hashKey(fmt.Sprintf("%s#%d", backend.URL, i)), backend: backend})
+			}
+		}
+		sort.Slice(pool.ring, func(i, j int) bool { return pool.ring[i].hash < pool.ring[j].hash })
+	}
+	return pool, nil
+}
+
+// Pick selects a backend for a request, avoiding the excluded backends
+// (those a request has already tried) while others are available. The key
+// is used by consistent hashing, so requests with the same key reach the
+// same backend while it stays in the rotation. Pick returns nil when every
+// backend's circuit is open.
+func (p *BackendPool) Pick(key string, exclude ...*Backend) *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var allowed, available, untried []*Backend
+	for _, backend := range p.backends {
+		if !backend.breaker.allows(now) {
+			continue
+		}
+		allowed = append(allowed, backend)
+		if !backend.available(now) {
+			continue
+		}
+		available = append(available, backend)
+		if !containsBackend(exclude, backend) {
+			untried = append(untried, backend)
+		}
+	}
+
+	candidates := untried
+	if len(candidates) == 0 {
+		candidates = available
+	}
+	if len(candidates) == 0 {
+		candidates = allowed
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	backend := p.pick(key, candidates)
+	backend.breaker.acquire(now)
+	return backend
+}
+
+func (p *BackendPool) pick(key string, candidates []*Backend) *Backend {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	switch p.strategy {
+	case BalanceLeastConnections:
+		return p.leastConnections(candidates)
+	case BalanceWeighted:
+		return p.weighted(candidates)
+	case BalanceConsistentHash:
+		if key != "" {
+			return p.hashed(key, candidates)
+		}
+	}
+	return p.roundRobin(candidates)
+}
+
+func (p *BackendPool) roundRobin(candidates []*Backend) *Backend {
+	backend := candidates[p.next%uint64(len(candidates))]
+	p.next++
+	return backend
+}
+
+// leastConnections picks the backend with the fewest requests in flight,
+// starting from the round robin position so ties are spread out
+func (p *BackendPool) leastConnections(candidates []*Backend) *Backend {
+	start := int(p.next % uint64(len(candidates)))
+	p.next++
+
+	var best *Backend
+	for i := range candidates {
+		backend := candidates[(start+i)%len(candidates)]
+		if best == nil || backend.active.Load() < best.active.Load() {
+			best = backend
+		}
+	}
+	return best
+}
+
+// weighted is smooth weighted round robin: each pick, every candidate gains
+// its weight and the one with the most is chosen and set back by the total
+func (p *BackendPool) weighted(candidates []*Backend) *Backend {
+	var best *Backend
+	total := 0
+	for _, backend := range candidates {
+		backend.currentWeight += backend.weight
+		total += backend.weight
+		if best == nil || backend.currentWeight > best.currentWeight {
+			best = backend
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// hashed walks the ring clockwise from the key to the first backend in the
+// rotation, so a backend leaving only moves the keys it served
+func (p *BackendPool) hashed(key string, candidates []*Backend) *Backend {
+	hash := hashKey(key)
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= hash })
+	for i := 0; i < len(p.ring); i++ {
+		backend := p.ring[(start+i)%len(p.ring)].backend
+		for _, candidate := range candidates {
+			if candidate == backend {
+				return backend
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// Acquire counts a request in flight to the backend; the returned function
+// ends it
+func (b *Backend) Acquire() func() {
+	b.active.Add(1)
+	return func() { b.active.Add(-1) }
+}
+
+// available reports whether the backend is in the rotation
+func (b *Backend) available(now time.Time) bool {
+	return b.healthy && !now.Before(b.ejectedUntil)
+}
+
+// ReportResult records the outcome of a request sent to a backend picked
+// from the pool, for outlier detection and the backend's circuit breaker.
+// Connection errors and 5xx responses count as failures.
+func (p *BackendPool) ReportResult(backend *Backend, statusCode int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil && errors.Is(err, context.Canceled) {
+		// The client went away; that says nothing about the backend
+		backend.breaker.release()
+		return
+	}
+	failed := err != nil || statusCode >= 500
+	now := time.Now()
+	backend.breaker.record(now, failed, backend.URL)
+
+	if !failed {
+		backend.errors = 0
+		return
+	}
+	backend.errors++
+	if err != nil {
+		backend.lastError = err.Error()
+	} else {
+		backend.lastError = fmt.Sprintf("status %d", statusCode)
+	}
+
+	if p.outliers.Disabled || backend.errors < p.outliers.ConsecutiveErrors {
+		return
+	}
+	if !now.Before(backend.ejectedUntil) && p.ejected(now) < p.maxEjected() {
+		backend.ejections++
+		backend.ejectedUntil = now.Add(p.outliers.EjectionTime * time.Duration(backend.ejections))
+		backend.errors = 0
+		log.Printf("Backend %s ejected until %s after consecutive failures: %s",
+			backend.URL, backend.ejectedUntil.Format(time.RFC3339), backend.lastError)
+	}
+}
+
+// retryAllowed reports whether the retry budget has room for a retry, and
+// spends it if so. Requests refill the budget.
+func (p *BackendPool) retryAllowed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.budgetRetries >= p.budgetRequests*p.retry.BudgetPercent/100 && p.budgetRetries >= p.retry.BudgetMinRetries {
+		return false
+	}
+	p.budgetRetries++
+	return true
+}
+
+// countRequest counts a request towards the retry budget
+func (p *BackendPool) countRequest() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now := time.Now(); now.Sub(p.budgetStart) >= retryBudgetWindow {
+		p.budgetStart = now
+		p.budgetRequests, p.budgetRetries = 0, 0
+	}
+	p.budgetRequests++
+}
+
+// ejected counts the backends currently ejected
+func (p *BackendPool) ejected(now time.Time) int {
+	count := 0
+	for _, backend := range p.backends {
+		if now.Before(backend.ejectedUntil) {
+			count++
+		}
+	}
+	return count
+}
+
+// maxEjected is the number of backends that may be ejected at once; one
+// backend always may be
+func (p *BackendPool) maxEjected() int {
+	max := len(p.backends) * p.outliers.MaxEjectionPercent / 100
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
+
+// checkDue reports whether active health checks are due, and marks them
+// started if so
+func (p *BackendPool) checkDue(now time.Time) bool {
+	if p.health.Disabled || p.health.Interval <= 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.checking || now.Before(p.nextCheck) {
+		return false
+	}
+	p.checking = true
+	return true
+}
+
+// Check runs an active health check against every backend in the pool
+func (p *BackendPool) Check(ctx context.Context, client *http.Client) {
+	var wg sync.WaitGroup
+	for _, backend := range p.backends {
+		wg.Add(1)
+		go func(backend *Backend) {
+			defer wg.Done()
+			p.recordCheck(backend, p.checkBackend(ctx, client, backend))
+		}(backend)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	p.checking = false
+	p.nextCheck = time.Now().Add(p.health.Interval)
+	p.mu.Unlock()
+}
+
+// checkBackend requests the backend's health check path; any 2xx passes
+func (p *BackendPool) checkBackend(ctx context.Context, client *http.Client, backend *Backend) error {
+	ctx, cancel := context.WithTimeout(ctx, p.health.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(backend.URL, "/")+p.healthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordCheck updates a backend's health with a check result
+func (p *BackendPool) recordCheck(backend *Backend, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backend.lastCheck = time.Now()
+	if err != nil {
+		backend.checkPasses = 0
+		backend.checkFailures++
+		backend.lastError = err.Error()
+		if backend.healthy && backend.checkFailures >= p.health.UnhealthyThreshold {
+			backend.healthy = false
+			log.Printf("Backend %s is unhealthy: %v", backend.URL, err)
+		}
+		return
+	}
+
+	backend.checkFailures = 0
+	backend.checkPasses++
+	if !backend.healthy && backend.checkPasses >= p.health.HealthyThreshold {
+		backend.healthy = true
+		log.Printf("Backend %s is healthy again", backend.URL)
+	}
+}
+
+// Status reports the state of the pool's backends
+func (p *BackendPool) Status() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	status := PoolStatus{Strategy: p.strategy}
+	for _, backend := range p.backends {
+		backendStatus := BackendStatus{
+			URL:               backend.URL,
+			Healthy:           backend.healthy,
+			Ejected:           now.Before(backend.ejectedUntil),
+			Weight:            backend.weight,
+			ActiveConnections: backend.active.Load(),
+			ConsecutiveErrors: backend.errors,
+			Circuit:           backend.breaker.current(now),
+			LastError:         backend.lastError,
+		}
+		if backendStatus.Ejected {
+			until := backend.ejectedUntil
+			backendStatus.EjectedUntil = &until
+		}
+		if !backend.lastCheck.IsZero() {
+			lastCheck := backend.lastCheck
+			backendStatus.LastCheck = &lastCheck
+		}
+		status.Backends = append(status.Backends, backendStatus)
+	}
+	return status
+}
+
+// BackendPools holds a pool for every backend config in use. Routes with the
+// same backend config, such as the routes built for each tenant, share a
+// pool, and a pool outlives reloads that leave its config unchanged.
+type BackendPools struct {
+	client *http.Client
+
+	mu    sync.RWMutex
+	pools map[string]*BackendPool
+}
+
+// NewBackendPools creates an empty set of pools
+func NewBackendPools() *BackendPools {
+	return &BackendPools{
+		client: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		pools: make(map[string]*BackendPool),
+	}
+}
+
+// Pool returns the pool for a backend config, creating it if needed
+func (s *BackendPools) Pool(config *BackendConfig) (*BackendPool, error) {
+	key := poolKey(config)
+
+	s.mu.RLock()
+	pool := s.pools[key]
+	s.mu.RUnlock()
+	if pool != nil {
+		return pool, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pool := s.pools[key]; pool != nil {
+		return pool, nil
+	}
+	pool, err := newBackendPool(config)
+	if err != nil {
+		return nil, err
+	}
+	s.pools[key] = pool
+	return pool, nil
+}
+
+// Sync creates pools for the routes in a config and drops pools no route
+// uses any more
+func (s *BackendPools) Sync(config *Config) {
+	configs := []*BackendConfig{}
+	for i := range config.Routes {
+		if config.Routes[i].Enabled {
+			configs = append(configs, &config.Routes[i].Backend)
+		}
+	}
+	if config.TenantRouting.Enabled {
+		configs = append(configs, &config.TenantRouting.Route.Backend)
+	}
+
+	pools := make(map[string]*BackendPool)
+	for _, backend := range configs {
+		pool, err := s.Pool(backend)
+		if err != nil {
+			log.Printf("Backend pool for %v not created: %v", backendURLs(backend), err)
+			continue
+		}
+		pools[pool.key] = pool
+	}
+
+	s.mu.Lock()
+	s.pools = pools
+	s.mu.Unlock()
+}
+
+// Status reports the state of every pool
+func (s *BackendPools) Status() []PoolStatus {
+	s.mu.RLock()
+	pools := make([]*BackendPool, 0, len(s.pools))
+	for _, pool := range s.pools {
+		pools = append(pools, pool)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i].key < pools[j].key })
+	statuses := make([]PoolStatus, 0, len(pools))
+	for _, pool := range pools {
+		statuses = append(statuses, pool.Status())
+	}
+	return statuses
+}
+
+// RunHealthChecks runs active health checks for every pool on its interval
+// until the context is cancelled
+func (s *BackendPools) RunHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.checkDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDue starts the health checks that are due
+func (s *BackendPools) checkDue(ctx context.Context) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, pool := range s.pools {
+		if pool.checkDue(now) {
+			go pool.Check(ctx, s.client)
+		}
+	}
+}
+
+// backendURLs lists a backend config's URLs, primary URL first
+func backendURLs(config *BackendConfig) []string {
+	var urls []string
+	if config.URL != "" {
+		urls = append(urls, config.URL)
+	}
+	for _, raw := range config.URLs {
+		if !containsString(urls, raw) {
+			urls = append(urls, raw)
+		}
+	}
+	return urls
+}
+
+// poolKey identifies the settings a pool is built from
+func poolKey(config *BackendConfig) string {
+	return fmt.Sprintf("%s|%s|%v|%s|%+v|%+v|%+v|%+v", config.LoadBalancing, strings.Join(backendURLs(config), ","),
+		config.Weights, config.HealthCheckPath, config.HealthCheck, config.OutlierDetection, config.Retry, config.CircuitBreaker)
+}
+
+// hashKey hashes a ring key. FNV alone clusters keys that differ only in
+// their last bytes, so the result goes through a 64-bit finalizer.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func containsBackend(backends []*Backend, backend *Backend) bool {
+	for _, b := range backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,356 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPool(t *testing.T, config BackendConfig) *BackendPool {
+	setBackendDefaults(&config)
+	require.NoError(t, validateBackend(&config))
+	pool, err := newBackendPool(&config)
+	require.NoError(t, err)
+	return pool
+}
+
+// picks counts the backends chosen for n requests
+func picks(pool *BackendPool, n int, key string) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[pool.Pick(key).URL]++
+	}
+	return counts
+}
+
+func TestBackendPoolStrategies(t *testing.T) {
+	urls := []string{"http://a", "http://b", "http://c"}
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{URL: urls[0], URLs: urls[1:]})
+		var order []string
+		for i := 0; i < 6; i++ {
+			order = append(order, pool.Pick("").URL)
+		}
+		assert.Equal(t, []string{"http://a", "http://b", "http://c", "http://a", "http://b", "http://c"}, order)
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{
+			URLs:          urls[:2],
+			LoadBalancing: BalanceWeighted,
+			Weights:       map[string]int{"http://a": 3},
+		})
+		assert.Equal(t, map[string]int{"http://a": 300, "http://b": 100}, picks(pool, 400, ""))
+
+		// Smooth: the light backend isn't starved for a run of picks
+		var order []string
+		for i := 0; i < 4; i++ {
+			order = append(order, pool.Pick("").URL)
+		}
+		assert.Equal(t, []string{"http://a", "http://a", "http://b", "http://a"}, order)
+	})
+
+	t.Run("LeastConnections", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{URLs: urls, LoadBalancing: BalanceLeastConnections})
+		releaseA := pool.backends[0].Acquire()
+		releaseB := pool.backends[1].Acquire()
+		assert.Equal(t, map[string]int{"http://c": 10}, picks(pool, 10, ""))
+
+		releaseA()
+		releaseB()
+		assert.Len(t, picks(pool, 9, ""), 3)
+	})
+
+	t.Run("ConsistentHash", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{URLs: urls, LoadBalancing: BalanceConsistentHash})
+
+		owners := make(map[string]string)
+		used := make(map[string]bool)
+		for i := 0; i < 300; i++ {
+			tenant := fmt.Sprintf("tenant-%d", i)
+			owners[tenant] = pool.Pick(tenant).URL
+			used[owners[tenant]] = true
+			assert.Equal(t, owners[tenant], pool.Pick(tenant).URL)
+		}
+		assert.Len(t, used, 3)
+
+		// Only the tenants on a backend that leaves move
+		pool.backends[0].healthy = false
+		for tenant, owner := range owners {
+			moved := pool.Pick(tenant).URL
+			if owner == "http://a" {
+				assert.NotEqual(t, "http://a", moved)
+			} else {
+				assert.Equal(t, owner, moved, tenant)
+			}
+		}
+
+		// Requests without a tenant are spread round robin
+		assert.Len(t, picks(pool, 4, ""), 2)
+	})
+
+	t.Run("AllUnavailable", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{URLs: urls[:2]})
+		for _, backend := range pool.backends {
+			backend.healthy = false
+		}
+		assert.Len(t, picks(pool, 4, ""), 2)
+	})
+}
+
+func TestBackendPoolOutlierDetection(t *testing.T) {
+	config := BackendConfig{
+		URLs:             []string{"http://a", "http://b", "http://c", "http://d"},
+		OutlierDetection: OutlierDetectionConfig{ConsecutiveErrors: 3, EjectionTime: time.Minute},
+	}
+
+	t.Run("Ejection", func(t *testing.T) {
+		pool := newTestPool(t, config)
+		a := pool.backends[0]
+
+		// A success resets the run of failures
+		pool.ReportResult(a, http.StatusBadGateway, nil)
+		pool.ReportResult(a, http.StatusInternalServerError, nil)
+		pool.ReportResult(a, http.StatusOK, nil)
+		pool.ReportResult(a, http.StatusNotFound, nil)
+		assert.False(t, pool.Status().Backends[0].Ejected)
+
+		pool.ReportResult(a, http.StatusServiceUnavailable, nil)
+		pool.ReportResult(a, 0, errors.New("connection refused"))
+		pool.ReportResult(a, http.StatusInternalServerError, nil)
+		status := pool.Status().Backends[0]
+		assert.True(t, status.Ejected)
+		assert.Equal(t, "status 500", status.LastError)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), *status.EjectedUntil, time.Second)
+		assert.NotContains(t, picks(pool, 12, ""), "http://a")
+
+		// Ejections grow with repeats
+		a.ejectedUntil = time.Now()
+		for i := 0; i < 3; i++ {
+			pool.ReportResult(a, http.StatusInternalServerError, nil)
+		}
+		assert.WithinDuration(t, time.Now().Add(2*time.Minute), *pool.Status().Backends[0].EjectedUntil, time.Second)
+	})
+
+	t.Run("MaxEjectionPercent", func(t *testing.T) {
+		pool := newTestPool(t, config)
+		for _, backend := range pool.backends[:3] {
+			for i := 0; i < 3; i++ {
+				pool.ReportResult(backend, http.StatusInternalServerError, nil)
+			}
+		}
+		ejected := 0
+		for _, backend := range pool.Status().Backends {
+			if backend.Ejected {
+				ejected++
+			}
+		}
+		assert.Equal(t, 2, ejected)
+	})
+
+	t.Run("ClientCancelled", func(t *testing.T) {
+		pool := newTestPool(t, config)
+		for i := 0; i < 5; i++ {
+			pool.ReportResult(pool.backends[0], 0, context.Canceled)
+		}
+		assert.Equal(t, 0, pool.Status().Backends[0].ConsecutiveErrors)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := config
+		disabled.OutlierDetection.Disabled = true
+		pool := newTestPool(t, disabled)
+		for i := 0; i < 5; i++ {
+			pool.ReportResult(pool.backends[0], http.StatusInternalServerError, nil)
+		}
+		assert.False(t, pool.Status().Backends[0].Ejected)
+	})
+}
+
+func TestBackendPoolHealthChecks(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pool := newTestPool(t, BackendConfig{
+		URLs:            []string{server.URL, "http://127.0.0.1:1"},
+		HealthCheckPath: "/healthz",
+		HealthCheck:     HealthCheckConfig{Interval: time.Hour, UnhealthyThreshold: 2, HealthyThreshold: 2},
+	})
+	check := func() {
+		require.True(t, pool.checkDue(time.Now().Add(2*time.Hour)))
+		pool.Check(context.Background(), http.DefaultClient)
+	}
+
+	// Unhealthy after two failed checks
+	check()
+	assert.True(t, pool.Status().Backends[1].Healthy)
+	check()
+	status := pool.Status()
+	assert.True(t, status.Backends[0].Healthy)
+	assert.False(t, status.Backends[1].Healthy)
+	assert.NotNil(t, status.Backends[1].LastCheck)
+	assert.Equal(t, map[string]int{server.URL: 4}, picks(pool, 4, ""))
+
+	// Not due again until the interval has passed
+	assert.False(t, pool.checkDue(time.Now()))
+
+	// Healthy again after two passed checks
+	failing.Store(true)
+	check()
+	check()
+	assert.False(t, pool.Status().Backends[0].Healthy)
+	failing.Store(false)
+	check()
+	assert.False(t, pool.Status().Backends[0].Healthy)
+	check()
+	assert.True(t, pool.Status().Backends[0].Healthy)
+
+	t.Run("Disabled", func(t *testing.T) {
+		pool := newTestPool(t, BackendConfig{URL: server.URL, HealthCheck: HealthCheckConfig{Disabled: true}})
+		assert.False(t, pool.checkDue(time.Now()))
+	})
+}
+
+func TestBackendPools(t *testing.T) {
+	config := &Config{
+		Routes: []RouteConfig{
+			{PathPrefix: "/a", Backend: BackendConfig{URLs: []string{"http://a1", "http://a2"}}, Enabled: true},
+			{PathPrefix: "/b", Backend: BackendConfig{URL: "http://b"}, Enabled: true},
+			{PathPrefix: "/c", Backend: BackendConfig{URL: "http://c"}, Enabled: false},
+		},
+	}
+	setDefaults(config)
+
+	pools := NewBackendPools()
+	pools.Sync(config)
+	require.Len(t, pools.Status(), 2)
+
+	a, err := pools.Pool(&config.Routes[0].Backend)
+	require.NoError(t, err)
+	a.backends[0].healthy = false
+
+	// An unchanged backend keeps its pool and state across a sync
+	pools.Sync(config)
+	same, err := pools.Pool(&config.Routes[0].Backend)
+	require.NoError(t, err)
+	assert.Same(t, a, same)
+
+	config.Routes = config.Routes[:1]
+	config.Routes[0].Backend.LoadBalancing = BalanceLeastConnections
+	pools.Sync(config)
+	status := pools.Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, BalanceLeastConnections, status[0].Strategy)
+	assert.True(t, status[0].Backends[0].Healthy)
+}
+
+func TestBalancingConfigValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  BackendConfig
+		expected string
+	}{
+		{"UnknownStrategy", BackendConfig{URL: "http://a", LoadBalancing: "random"}, "unknown load_balancing strategy"},
+		{"InvalidURL", BackendConfig{URLs: []string{"http://a", "b:80"}}, "invalid backend URL"},
+		{"UnknownWeight", BackendConfig{URL: "http://a", Weights: map[string]int{"http://b": 2}}, "not a backend URL"},
+		{"ZeroWeight", BackendConfig{URL: "http://a", Weights: map[string]int{"http://a": 0}}, "must be at least 1"},
+		{"EjectionPercent", BackendConfig{URL: "http://a", OutlierDetection: OutlierDetectionConfig{MaxEjectionPercent: 150}}, "max_ejection_percent"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBackend(&tc.backend)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expected)
+		})
+	}
+
+	config := &Config{Port: "8000", JWTSecret: "secret", Routes: []RouteConfig{
+		{PathPrefix: "/a", Backend: BackendConfig{URL: "http://a", LoadBalancing: "random"}, Enabled: true},
+	}}
+	err := validateConfig(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "route 0: unknown load_balancing strategy")
+}
+
+func TestProxyLoadBalancing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var failing atomic.Bool
+	served := make(map[string]*atomic.Int64)
+	newBackend := func(name string) *httptest.Server {
+		served[name] = &atomic.Int64{}
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served[name].Add(1)
+			if name == "b" && failing.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			io.WriteString(w, name)
+		}))
+	}
+	a, b := newBackend("a"), newBackend("b")
+	defer a.Close()
+	defer b.Close()
+
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+	route := &RouteConfig{
+		PathPrefix: "/api",
+		Backend: BackendConfig{
+			URLs:             []string{a.URL, b.URL},
+			OutlierDetection: OutlierDetectionConfig{ConsecutiveErrors: 2, EjectionTime: time.Minute},
+		},
+	}
+	router := gin.New()
+	router.NoRoute(func(c *gin.Context) { proxy.ProxyRequest(c, route) })
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func() int {
+		resp, err := http.Get(server.URL + "/api/items")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusOK, get())
+	}
+	assert.Equal(t, int64(2), served["a"].Load())
+	assert.Equal(t, int64(2), served["b"].Load())
+
+	// b fails twice and leaves the rotation
+	failing.Store(true)
+	statuses := map[int]int{}
+	for i := 0; i < 4; i++ {
+		statuses[get()]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 2, http.StatusBadGateway: 2}, statuses)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusOK, get())
+	}
+	assert.Equal(t, int64(4), served["b"].Load())
+
+	status := proxy.Pools().Status()
+	require.Len(t, status, 1)
+	assert.True(t, status[0].Backends[1].Ejected)
+	assert.Equal(t, int64(0), status[0].Backends[0].ActiveConnections)
+}
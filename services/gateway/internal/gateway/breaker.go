@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"log"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// circuitBreaker stops requests to a backend that fails too many of them.
+// It has no lock of its own; the backend's pool guards it.
+type circuitBreaker struct {
+	config CircuitBreakerConfig
+
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // half-open requests in flight
+	successes   int // successful half-open requests
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) circuitBreaker {
+	return circuitBreaker{config: config, state: CircuitClosed}
+}
+
+// current returns the state, moving an open circuit to half-open once its
+// open timeout has passed
+func (b *circuitBreaker) current(now time.Time) string {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state = CircuitHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+	return b.state
+}
+
+// allows reports whether a request may be sent to the backend
+func (b *circuitBreaker) allows(now time.Time) bool {
+	if b.config.Disabled {
+		return true
+	}
+	switch b.current(now) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return b.probes < b.config.HalfOpenRequests
+	}
+	return true
+}
+
+// acquire counts a request sent to the backend; half-open circuits let only
+// a few through at a time
+func (b *circuitBreaker) acquire(now time.Time) {
+	if !b.config.Disabled && b.current(now) == CircuitHalfOpen {
+		b.probes++
+	}
+}
+
+// release ends a request without an outcome, such as one the client
+// abandoned
+func (b *circuitBreaker) release() {
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// record counts a request's outcome and opens or closes the circuit
+func (b *circuitBreaker) record(now time.Time, failed bool, backendURL string) {
+	if b.config.Disabled {
+		return
+	}
+
+	switch b.current(now) {
+	case CircuitHalfOpen:
+		b.release()
+		if failed {
+			b.open(now, backendURL, "a half-open request failed")
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.state = CircuitClosed
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+			log.Printf("Circuit for backend %s closed", backendURL)
+		}
+
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.config.MinRequests && float64(b.failures) >= b.config.FailureRatio*float64(b.requests) {
+			b.open(now, backendURL, "too many requests failed")
+		}
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time, backendURL, reason string) {
+	b.state = CircuitOpen
+	b.openedAt = now
+	b.probes, b.successes = 0, 0
+	log.Printf("Circuit for backend %s opened for %s: %s", backendURL, b.config.OpenTimeout, reason)
+}
@@ -2,7 +2,10 @@ package gateway
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,6 +15,7 @@ import (
 type Config struct {
 	Port        string `yaml:"port"`
 	RedisURL    string `yaml:"redis_url"`
+	DatabaseURL string `yaml:"database_url"` // Postgres for durable usage
 	JWTSecret   string `yaml:"jwt_secret"`
 	ConfigPath  string `yaml:"-"`
 	Environment string `yaml:"environment"`
@@ -22,6 +26,26 @@ type Config struct {
 	Auth        AuthConfig         `yaml:"auth"`
 	Monitoring  MonitoringConfig   `yaml:"monitoring"`
 	Cors        CorsConfig         `yaml:"cors"`
+	
+	// Routes built from the platform's tenant records
+	TenantRouting TenantRoutingConfig `yaml:"tenant_routing"`
+	
+	// Plan quotas and usage metering
+	Quotas      QuotaConfig        `yaml:"quotas"`
+	
+	// Proxied WebSocket connections
+	WebSocket   WebSocketConfig    `yaml:"websocket"`
+	
+	// Hot reload
+	Reload      ReloadConfig       `yaml:"reload"`
+}
+
+// ReloadConfig controls how the config file is reloaded while the gateway
+// runs. SIGHUP always reloads it.
+type ReloadConfig struct {
+	WatchFile        bool          `yaml:"watch_file"`         // Reload when the file changes
+	WatchInterval    time.Duration `yaml:"watch_interval"`     // How often the file is checked. Default: 2s
+	WarningsAsErrors bool          `yaml:"warnings_as_errors"` // Reject configs whose routes conflict or are unreachable
 }
 
 // RouteConfig defines how to route requests to backend services
@@ -37,8 +61,33 @@ type RouteConfig struct {
 	Auth        *AuthConfig   `yaml:"auth,omitempty"`        // Override auth for this route
 	RateLimit   *RateLimitConfig `yaml:"rate_limit,omitempty"` // Override rate limit
 	Transform   *TransformConfig `yaml:"transform,omitempty"`  // Request/response transformation
+	WebSocket   *WebSocketConfig `yaml:"websocket,omitempty"`  // Override WebSocket settings
 	Enabled     bool          `yaml:"enabled"`
 	Description string        `yaml:"description"`
+	
+	// Set on routes built from the tenant registry
+	Tenant      *Tenant       `yaml:"-"`
+}
+
+// TenantRoutingConfig builds a route for each tenant from the tenant records
+// served by the platform API, so tenants and their custom domains need no
+// config edits
+type TenantRoutingConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	RegistryURL string `yaml:"registry_url"` // Platform API serving the tenants entity
+	Entity      string `yaml:"entity"`       // Default: "tenants"
+	Token       string `yaml:"token,omitempty"`
+	
+	// Tenants are served on {slug}.{base_domain} and on their custom domain
+	BaseDomain  string `yaml:"base_domain"`
+	
+	// Tenants are reloaded every refresh_interval; with watch_changes the
+	// entity's change stream is followed in between
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	WatchChanges    bool          `yaml:"watch_changes"`
+	
+	// Template for every tenant's route; its host is set per tenant
+	Route       RouteConfig `yaml:"route"`
 }
 
 // BackendConfig defines the backend service
@@ -47,22 +96,108 @@ type BackendConfig struct {
 	Timeout         time.Duration `yaml:"timeout"`
 	MaxRetries      int           `yaml:"max_retries"`
 	HealthCheckPath string        `yaml:"health_check_path"`
-	LoadBalancing   string        `yaml:"load_balancing"` // round_robin, least_connections, etc.
+	LoadBalancing   string        `yaml:"load_balancing"` // round_robin, least_connections, weighted, consistent_hash
 	
 	// Multiple backend URLs for load balancing
 	URLs []string `yaml:"urls,omitempty"`
+	
+	// Relative weights by URL for weighted load balancing (default 1)
+	Weights map[string]int `yaml:"weights,omitempty"`
+	
+	HealthCheck      HealthCheckConfig      `yaml:"health_check"`
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"`
+	
+	// Retries of failed requests, up to max_retries per request
+	Retry            RetryConfig            `yaml:"retry"`
+	CircuitBreaker   CircuitBreakerConfig   `yaml:"circuit_breaker"`
+}
+
+// RetryConfig defines when a failed request is tried again, on another
+// backend where there is one. Only idempotent methods are retried, after a
+// connection error or a response with a retry_on status.
+type RetryConfig struct {
+	Disabled      bool          `yaml:"disabled"`
+	Methods       []string      `yaml:"methods"`         // Default: GET, HEAD, OPTIONS, PUT, DELETE
+	RetryOn       []int         `yaml:"retry_on"`        // Default: 502, 503, 504
+	PerTryTimeout time.Duration `yaml:"per_try_timeout"` // Time each attempt has for the response headers; default none
+	
+	// Attempts are spaced by exponential backoff with full jitter
+	BackoffBase   time.Duration `yaml:"backoff_base"` // Default: 25ms
+	BackoffMax    time.Duration `yaml:"backoff_max"`  // Default: 1s
+	
+	// Retries are limited to budget_percent of a route's requests in each
+	// 10s window, with budget_min_retries always allowed, so retries can't
+	// multiply the load on a failing backend
+	BudgetPercent    int `yaml:"budget_percent"`     // Default: 20
+	BudgetMinRetries int `yaml:"budget_min_retries"` // Default: 10
+	
+	// Request bodies up to max_buffer_bytes are buffered so they can be sent
+	// again; requests with larger bodies are streamed and not retried
+	MaxBufferBytes int64 `yaml:"max_buffer_bytes"` // Default: 1 MiB
+}
+
+// CircuitBreakerConfig defines each backend's circuit breaker. The circuit
+// opens when failure_ratio of the requests in a window fail, and requests
+// skip the backend for open_timeout. It then lets half_open_requests probe
+// requests through: if they succeed the circuit closes, and if one fails it
+// opens again.
+type CircuitBreakerConfig struct {
+	Disabled         bool          `yaml:"disabled"`
+	FailureRatio     float64       `yaml:"failure_ratio"`      // Default: 0.5
+	MinRequests      int           `yaml:"min_requests"`       // Requests in a window before the ratio counts; default 20
+	Window           time.Duration `yaml:"window"`             // Default: 10s
+	OpenTimeout      time.Duration `yaml:"open_timeout"`       // Default: 30s
+	HalfOpenRequests int           `yaml:"half_open_requests"` // Default: 1
+}
+
+// HealthCheckConfig defines active health checks, which request each
+// backend's health_check_path every interval
+type HealthCheckConfig struct {
+	Disabled           bool          `yaml:"disabled"`
+	Interval           time.Duration `yaml:"interval"`            // Default: 10s
+	Timeout            time.Duration `yaml:"timeout"`             // Default: 2s
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // Failed checks before a backend leaves the rotation; default 3
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // Passed checks before it returns; default 2
+}
+
+// OutlierDetectionConfig defines passive health checking: a backend that
+// fails consecutive_errors proxied requests in a row, with a 5xx response or
+// a connection error, is ejected from the rotation for ejection_time
+type OutlierDetectionConfig struct {
+	Disabled           bool          `yaml:"disabled"`
+	ConsecutiveErrors  int           `yaml:"consecutive_errors"`   // Default: 5
+	EjectionTime       time.Duration `yaml:"ejection_time"`        // Default: 30s, growing with repeated ejections
+	MaxEjectionPercent int           `yaml:"max_ejection_percent"` // Default: 50
 }
 
 // RateLimitConfig defines rate limiting rules
 type RateLimitConfig struct {
 	Enabled     bool          `yaml:"enabled"`
 	RequestsPerMinute int     `yaml:"requests_per_minute"`
-	BurstSize   int           `yaml:"burst_size"`
+	BurstSize   int           `yaml:"burst_size"`   // Requests allowed at once. Default: requests_per_minute
 	KeyStrategy string        `yaml:"key_strategy"` // ip, user, tenant, custom
 	CustomKey   string        `yaml:"custom_key,omitempty"`
+	Algorithm   string        `yaml:"algorithm"`    // gcra or token_bucket. Default: gcra
+	
+	// Open WebSocket connections allowed per key on each gateway instance,
+	// on top of the upgrade request counting as a request; 0 for no limit
+	MaxConnections int        `yaml:"max_connections"`
 	
 	// Different limits for different user types
 	Limits map[string]RateLimit `yaml:"limits,omitempty"`
+	
+	// Further limits every request is held to, such as per IP alongside
+	// per tenant; a request must be within all of them
+	Rules []RateLimitRule `yaml:"rules,omitempty"`
+}
+
+// RateLimitRule is a further limit with its own key. Requests without the
+// rule's key, such as anonymous requests for the user strategy, skip it.
+type RateLimitRule struct {
+	KeyStrategy       string `yaml:"key_strategy"` // ip, user, tenant, custom
+	CustomKey         string `yaml:"custom_key,omitempty"`
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+	BurstSize         int    `yaml:"burst_size"`
 }
 
 type RateLimit struct {
@@ -89,17 +224,49 @@ type AuthConfig struct {
 	BypassPaths  []string `yaml:"bypass_paths,omitempty"`
 }
 
-// TransformConfig defines request/response transformations
+// TransformConfig defines request/response transformations. Header values
+// and body field values may use the templates {{tenant_id}}, {{user_id}},
+// {{user_email}}, {{request_id}} and {{claims.<name>}}.
 type TransformConfig struct {
 	// Request transformations
 	StripPrefix    bool              `yaml:"strip_prefix,omitempty"`    // Strip the path_prefix before forwarding
 	AddHeaders     map[string]string `yaml:"add_headers,omitempty"`
 	RemoveHeaders  []string          `yaml:"remove_headers,omitempty"`
-	RewritePath    string            `yaml:"rewrite_path,omitempty"`
+	RewritePath    string            `yaml:"rewrite_path,omitempty"`    // Replaces the whole path
+	
+	// Regex path rewrite, after strip_prefix: the part of the path matching
+	// path_pattern is replaced by path_replacement, which can use the
+	// pattern's capture groups as $1 or ${name}
+	PathPattern     string `yaml:"path_pattern,omitempty"`
+	PathReplacement string `yaml:"path_replacement,omitempty"`
+	
+	// JSON request bodies: fields are removed, then set, by dot path such
+	// as "meta.source"
+	RemoveBodyFields []string               `yaml:"remove_body_fields,omitempty"`
+	AddBodyFields    map[string]interface{} `yaml:"add_body_fields,omitempty"`
 	
 	// Response transformations
 	AddResponseHeaders    map[string]string `yaml:"add_response_headers,omitempty"`
 	RemoveResponseHeaders []string          `yaml:"remove_response_headers,omitempty"`
+	ResponseEnvelope      *ResponseEnvelopeConfig `yaml:"response_envelope,omitempty"`
+	
+	// Larger bodies are refused with 413 when they'd be transformed, and
+	// responses are passed on unchanged. Default: 1 MiB
+	MaxBodyBytes int64 `yaml:"max_body_bytes,omitempty"`
+	
+	// path_pattern, compiled when the config is validated
+	pathPattern *regexp.Regexp
+}
+
+// ResponseEnvelopeConfig reshapes successful JSON responses for clients
+// that expect another layout, such as legacy clients of an older API
+type ResponseEnvelopeConfig struct {
+	// Fields of the new body, by dot path, each taken from a dot path of the
+	// backend's body, or "." for the whole body
+	Fields map[string]string `yaml:"fields"`
+	
+	// Fields of the new body with fixed values
+	Static map[string]interface{} `yaml:"static,omitempty"`
 }
 
 // MonitoringConfig defines monitoring and observability
@@ -113,9 +280,45 @@ type MonitoringConfig struct {
 	LogFormat   string `yaml:"log_format"` // json, text
 	LogRequests bool   `yaml:"log_requests"`
 	
-	// Tracing
-	TracingEnabled bool   `yaml:"tracing_enabled"`
-	TracingService string `yaml:"tracing_service"`
+	// Metrics: tenants past metrics_max_tenants share the "other" tenant
+	// label, and each metric keeps at most metrics_max_series series
+	MetricsMaxTenants int       `yaml:"metrics_max_tenants"` // Default: 100
+	MetricsMaxSeries  int       `yaml:"metrics_max_series"`  // Default: 10000
+	LatencyBuckets    []float64 `yaml:"latency_buckets"`     // Seconds
+	
+	// Tracing: requests continue the caller's W3C traceparent, or start a
+	// trace, and pass it on to backends
+	TracingEnabled     bool    `yaml:"tracing_enabled"`
+	TracingService     string  `yaml:"tracing_service"`      // Default: backsaas-gateway
+	TracingExporter    string  `yaml:"tracing_exporter"`     // otlp, stdout or memory; default otlp with an endpoint, stdout without
+	TracingEndpoint    string  `yaml:"tracing_endpoint"`     // OTLP/HTTP collector URL
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio"` // Share of new traces recorded; default 1
+}
+
+// QuotaConfig defines what each tenant plan allows. Tenants on a plan
+// without an entry have no quota, but their usage is still metered.
+type QuotaConfig struct {
+	Enabled     bool                 `yaml:"enabled"`
+	DefaultPlan string               `yaml:"default_plan"` // For tenants without a plan. Default: "free"
+	Plans       map[string]PlanQuota `yaml:"plans"`
+	
+	// Daily usage is kept for usage_retention_days
+	UsageRetentionDays int `yaml:"usage_retention_days"` // Default: 400
+}
+
+// PlanQuota is a plan's limits; zero means unlimited
+type PlanQuota struct {
+	RequestsPerMonth int64 `yaml:"requests_per_month" json:"requests_per_month"`
+	StorageBytes     int64 `yaml:"storage_bytes" json:"storage_bytes"`
+	Entities         int64 `yaml:"entities" json:"entities"` // Records across the tenant's entities
+}
+
+// WebSocketConfig defines how proxied WebSocket connections are kept.
+// Connections are closed with a close frame to both sides when no frame
+// has passed either way for idle_timeout, and when the gateway shuts down.
+type WebSocketConfig struct {
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`  // Default: 5m
+	CloseTimeout time.Duration `yaml:"close_timeout"` // Time both sides have to answer a close frame; default 5s
 }
 
 // CorsConfig defines CORS settings
@@ -131,25 +334,43 @@ type CorsConfig struct {
 
 // LoadConfig loads configuration from file and merges with runtime config
 func LoadConfig(configPath string, runtimeConfig *Config) (*Config, error) {
+	data, err := readConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data, runtimeConfig)
+}
+
+// readConfigFile reads the config file, if there is one
+func readConfigFile(configPath string) ([]byte, error) {
+	if configPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, nil
+	}
+	
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return data, nil
+}
+
+// parseConfig merges the contents of a config file with the runtime config
+func parseConfig(data []byte, runtimeConfig *Config) (*Config, error) {
 	// Start with runtime config
 	config := *runtimeConfig
 	
 	// Load from file if it exists
-	if configPath != "" {
-		if _, err := os.Stat(configPath); err == nil {
-			data, err := os.ReadFile(configPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read config file: %w", err)
-			}
-			
-			var fileConfig Config
-			if err := yaml.Unmarshal(data, &fileConfig); err != nil {
-				return nil, fmt.Errorf("failed to parse config file: %w", err)
-			}
-			
-			// Merge file config with runtime config
-			mergeConfigs(&config, &fileConfig)
+	if data != nil {
+		var fileConfig Config
+		if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
+		
+		// Merge file config with runtime config
+		mergeConfigs(&config, &fileConfig)
 	}
 	
 	// Set defaults
@@ -171,9 +392,15 @@ func mergeConfigs(runtime, file *Config) {
 	if file.RedisURL != "" {
 		runtime.RedisURL = file.RedisURL
 	}
+	if file.DatabaseURL != "" {
+		runtime.DatabaseURL = file.DatabaseURL
+	}
 	if file.Environment != "" {
 		runtime.Environment = file.Environment
 	}
+	if file.JWTSecret != "" {
+		runtime.JWTSecret = file.JWTSecret
+	}
 	
 	// Merge complex structures
 	runtime.Routes = file.Routes
@@ -181,6 +408,10 @@ func mergeConfigs(runtime, file *Config) {
 	runtime.Auth = file.Auth
 	runtime.Monitoring = file.Monitoring
 	runtime.Cors = file.Cors
+	runtime.TenantRouting = file.TenantRouting
+	runtime.Quotas = file.Quotas
+	runtime.WebSocket = file.WebSocket
+	runtime.Reload = file.Reload
 }
 
 // setDefaults sets default values for configuration
@@ -203,6 +434,35 @@ func setDefaults(config *Config) {
 	if config.Monitoring.LogFormat == "" {
 		config.Monitoring.LogFormat = "json"
 	}
+	if config.Monitoring.MetricsMaxTenants == 0 {
+		config.Monitoring.MetricsMaxTenants = 100
+	}
+	if config.Monitoring.MetricsMaxSeries == 0 {
+		config.Monitoring.MetricsMaxSeries = 10000
+	}
+	if config.Monitoring.TracingService == "" {
+		config.Monitoring.TracingService = "backsaas-gateway"
+	}
+	if config.Monitoring.TracingExporter == "" {
+		config.Monitoring.TracingExporter = "stdout"
+		if config.Monitoring.TracingEndpoint != "" {
+			config.Monitoring.TracingExporter = "otlp"
+		}
+	}
+	if config.Monitoring.TracingSampleRatio == 0 {
+		config.Monitoring.TracingSampleRatio = 1
+	}
+	
+	// Default quota config
+	if config.Quotas.DefaultPlan == "" {
+		config.Quotas.DefaultPlan = "free"
+	}
+	if config.Quotas.UsageRetentionDays == 0 {
+		config.Quotas.UsageRetentionDays = 400
+	}
+	
+	// Default WebSocket config
+	setWebSocketDefaults(&config.WebSocket)
 	
 	// Default CORS config
 	if config.Cors.Enabled && len(config.Cors.AllowedMethods) == 0 {
@@ -223,7 +483,216 @@ func setDefaults(config *Config) {
 		if config.Routes[i].Backend.HealthCheckPath == "" {
 			config.Routes[i].Backend.HealthCheckPath = "/health"
 		}
+		setBackendDefaults(&config.Routes[i].Backend)
+		if config.Routes[i].WebSocket != nil {
+			setWebSocketDefaults(config.Routes[i].WebSocket)
+		}
+	}
+	
+	// Default tenant routing
+	if config.TenantRouting.Entity == "" {
+		config.TenantRouting.Entity = "tenants"
+	}
+	if config.TenantRouting.RefreshInterval == 0 {
+		config.TenantRouting.RefreshInterval = time.Minute
+	}
+	if config.TenantRouting.Route.Backend.Timeout == 0 {
+		config.TenantRouting.Route.Backend.Timeout = 30 * time.Second
+	}
+	if config.TenantRouting.Route.Backend.MaxRetries == 0 {
+		config.TenantRouting.Route.Backend.MaxRetries = 3
+	}
+	if config.TenantRouting.Route.Backend.HealthCheckPath == "" {
+		config.TenantRouting.Route.Backend.HealthCheckPath = "/health"
+	}
+	setBackendDefaults(&config.TenantRouting.Route.Backend)
+	if config.TenantRouting.Route.WebSocket != nil {
+		setWebSocketDefaults(config.TenantRouting.Route.WebSocket)
+	}
+	
+	// Default reload config
+	if config.Reload.WatchInterval == 0 {
+		config.Reload.WatchInterval = 2 * time.Second
+	}
+}
+
+// setWebSocketDefaults sets the idle and close timeouts of WebSocket
+// connections
+func setWebSocketDefaults(config *WebSocketConfig) {
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 5 * time.Minute
+	}
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = 5 * time.Second
+	}
+}
+
+// setBackendDefaults sets defaults for a backend's load balancing, health
+// checks, retries and circuit breaker
+func setBackendDefaults(backend *BackendConfig) {
+	if backend.LoadBalancing == "" {
+		backend.LoadBalancing = BalanceRoundRobin
+	}
+	
+	check := &backend.HealthCheck
+	if check.Interval == 0 {
+		check.Interval = 10 * time.Second
+	}
+	if check.Timeout == 0 {
+		check.Timeout = 2 * time.Second
+	}
+	if check.UnhealthyThreshold == 0 {
+		check.UnhealthyThreshold = 3
+	}
+	if check.HealthyThreshold == 0 {
+		check.HealthyThreshold = 2
+	}
+	
+	outliers := &backend.OutlierDetection
+	if outliers.ConsecutiveErrors == 0 {
+		outliers.ConsecutiveErrors = 5
+	}
+	if outliers.EjectionTime == 0 {
+		outliers.EjectionTime = 30 * time.Second
+	}
+	if outliers.MaxEjectionPercent == 0 {
+		outliers.MaxEjectionPercent = 50
+	}
+	
+	retry := &backend.Retry
+	if len(retry.Methods) == 0 {
+		retry.Methods = []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE"}
+	}
+	if len(retry.RetryOn) == 0 {
+		retry.RetryOn = []int{502, 503, 504}
+	}
+	if retry.BackoffBase == 0 {
+		retry.BackoffBase = 25 * time.Millisecond
+	}
+	if retry.BackoffMax == 0 {
+		retry.BackoffMax = time.Second
+	}
+	if retry.BudgetPercent == 0 {
+		retry.BudgetPercent = 20
+	}
+	if retry.BudgetMinRetries == 0 {
+		retry.BudgetMinRetries = 10
+	}
+	if retry.MaxBufferBytes == 0 {
+		retry.MaxBufferBytes = 1 << 20
+	}
+	
+	breaker := &backend.CircuitBreaker
+	if breaker.FailureRatio == 0 {
+		breaker.FailureRatio = 0.5
+	}
+	if breaker.MinRequests == 0 {
+		breaker.MinRequests = 20
+	}
+	if breaker.Window == 0 {
+		breaker.Window = 10 * time.Second
+	}
+	if breaker.OpenTimeout == 0 {
+		breaker.OpenTimeout = 30 * time.Second
+	}
+	if breaker.HalfOpenRequests == 0 {
+		breaker.HalfOpenRequests = 1
+	}
+}
+
+// validateBackend checks a backend's load balancing, retry and circuit
+// breaker settings
+func validateBackend(backend *BackendConfig) error {
+	switch backend.LoadBalancing {
+	case "", BalanceRoundRobin, BalanceLeastConnections, BalanceWeighted, BalanceConsistentHash:
+	default:
+		return fmt.Errorf("unknown load_balancing strategy %q", backend.LoadBalancing)
+	}
+	
+	urls := backendURLs(backend)
+	for _, raw := range urls {
+		if target, err := url.Parse(raw); err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("invalid backend URL %q", raw)
+		}
+	}
+	for raw, weight := range backend.Weights {
+		if !containsString(urls, raw) {
+			return fmt.Errorf("weight given for %q, which is not a backend URL", raw)
+		}
+		if weight < 1 {
+			return fmt.Errorf("weight for %q must be at least 1", raw)
+		}
+	}
+	
+	if backend.HealthCheck.Interval < 0 || backend.HealthCheck.Timeout < 0 {
+		return fmt.Errorf("health_check interval and timeout must be positive")
+	}
+	if percent := backend.OutlierDetection.MaxEjectionPercent; percent < 0 || percent > 100 {
+		return fmt.Errorf("outlier_detection: max_ejection_percent must be between 0 and 100")
+	}
+	
+	for _, method := range backend.Retry.Methods {
+		if !idempotentMethods[strings.ToUpper(method)] {
+			return fmt.Errorf("retry: %s is not idempotent and can't be retried", method)
+		}
 	}
+	for _, status := range backend.Retry.RetryOn {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("retry: retry_on status %d is not an error status", status)
+		}
+	}
+	if backend.Retry.PerTryTimeout < 0 || backend.Retry.BackoffBase < 0 || backend.Retry.BackoffMax < 0 {
+		return fmt.Errorf("retry: timeouts and backoff must be positive")
+	}
+	if ratio := backend.CircuitBreaker.FailureRatio; ratio < 0 || ratio > 1 {
+		return fmt.Errorf("circuit_breaker: failure_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// validateRateLimit validates a rate limit config
+func validateRateLimit(config *RateLimitConfig) error {
+	switch config.Algorithm {
+	case "", RateLimitGCRA, RateLimitTokenBucket:
+	default:
+		return fmt.Errorf("rate_limit: unknown algorithm %q", config.Algorithm)
+	}
+	limits := []RateLimit{{RequestsPerMinute: config.RequestsPerMinute, BurstSize: config.BurstSize}}
+	for _, limit := range config.Limits {
+		limits = append(limits, limit)
+	}
+	for i, rule := range config.Rules {
+		switch rule.KeyStrategy {
+		case "ip", "user", "tenant":
+		case "custom":
+			if rule.CustomKey == "" {
+				return fmt.Errorf("rate_limit: rule %d: custom_key is required", i)
+			}
+		default:
+			return fmt.Errorf("rate_limit: rule %d: unknown key_strategy %q", i, rule.KeyStrategy)
+		}
+		if rule.RequestsPerMinute <= 0 {
+			return fmt.Errorf("rate_limit: rule %d: requests_per_minute is required", i)
+		}
+		limits = append(limits, RateLimit{RequestsPerMinute: rule.RequestsPerMinute, BurstSize: rule.BurstSize})
+	}
+	for _, limit := range limits {
+		if limit.RequestsPerMinute < 0 || limit.BurstSize < 0 {
+			return fmt.Errorf("rate_limit: requests_per_minute and burst_size must be positive")
+		}
+	}
+	if config.MaxConnections < 0 {
+		return fmt.Errorf("rate_limit: max_connections must be positive")
+	}
+	return nil
+}
+
+// validateWebSocket validates WebSocket timeouts
+func validateWebSocket(config *WebSocketConfig) error {
+	if config.IdleTimeout < 0 || config.CloseTimeout < 0 {
+		return fmt.Errorf("websocket: idle_timeout and close_timeout must be positive")
+	}
+	return nil
 }
 
 // validateConfig validates the configuration
@@ -245,6 +714,95 @@ func validateConfig(config *Config) error {
 		if route.PathPrefix == "" && route.Host == "" && route.TenantID == "" {
 			return fmt.Errorf("route %d: at least one matching criteria is required", i)
 		}
+		
+		if err := validateBackend(&route.Backend); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		
+		if route.RateLimit != nil {
+			if err := validateRateLimit(route.RateLimit); err != nil {
+				return fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+		
+		if route.WebSocket != nil {
+			if err := validateWebSocket(route.WebSocket); err != nil {
+				return fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+		
+		if route.Transform != nil {
+			if err := validateTransform(route.Transform); err != nil {
+				return fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+	}
+	
+	// Validate rate limits
+	if err := validateRateLimit(&config.RateLimit); err != nil {
+		return err
+	}
+	
+	// Validate WebSocket connections
+	if err := validateWebSocket(&config.WebSocket); err != nil {
+		return err
+	}
+	
+	// Validate tracing
+	if monitoring := config.Monitoring; monitoring.TracingEnabled {
+		switch monitoring.TracingExporter {
+		case "otlp":
+			if _, err := url.ParseRequestURI(monitoring.TracingEndpoint); err != nil {
+				return fmt.Errorf("monitoring: tracing_endpoint must be a URL for the otlp exporter")
+			}
+		case "stdout", "memory":
+		default:
+			return fmt.Errorf("monitoring: unknown tracing_exporter %q", monitoring.TracingExporter)
+		}
+		if monitoring.TracingSampleRatio < 0 || monitoring.TracingSampleRatio > 1 {
+			return fmt.Errorf("monitoring: tracing_sample_ratio must be between 0 and 1")
+		}
+	}
+	
+	// Validate quotas
+	for plan, quota := range config.Quotas.Plans {
+		if quota.RequestsPerMonth < 0 || quota.StorageBytes < 0 || quota.Entities < 0 {
+			return fmt.Errorf("quotas: plan %q limits must be positive", plan)
+		}
+	}
+	if config.Quotas.UsageRetentionDays < 0 {
+		return fmt.Errorf("quotas: usage_retention_days must be positive")
+	}
+	
+	// Validate tenant routing
+	if tenants := config.TenantRouting; tenants.Enabled {
+		if tenants.RegistryURL == "" {
+			return fmt.Errorf("tenant_routing: registry_url is required")
+		}
+		if tenants.Route.Backend.URL == "" && len(tenants.Route.Backend.URLs) == 0 {
+			return fmt.Errorf("tenant_routing: route backend URL is required")
+		}
+		if tenants.RefreshInterval < 0 {
+			return fmt.Errorf("tenant_routing: refresh_interval must be positive")
+		}
+		if err := validateBackend(&tenants.Route.Backend); err != nil {
+			return fmt.Errorf("tenant_routing: %w", err)
+		}
+		if tenants.Route.RateLimit != nil {
+			if err := validateRateLimit(tenants.Route.RateLimit); err != nil {
+				return fmt.Errorf("tenant_routing: %w", err)
+			}
+		}
+		if tenants.Route.WebSocket != nil {
+			if err := validateWebSocket(tenants.Route.WebSocket); err != nil {
+				return fmt.Errorf("tenant_routing: %w", err)
+			}
+		}
+		if tenants.Route.Transform != nil {
+			if err := validateTransform(tenants.Route.Transform); err != nil {
+				return fmt.Errorf("tenant_routing: %w", err)
+			}
+		}
 	}
 	
 	return nil
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,8 +16,9 @@ import (
 
 // Gateway represents the API gateway
 type Gateway struct {
-	config      *Config
+	runtime     *Config // from flags and environment, merged on every reload
 	router      *gin.Engine
+	server      *http.Server
 	redisClient *redis.Client
 	
 	// Middleware components
@@ -25,18 +26,36 @@ type Gateway struct {
 	rateLimit   *RateLimitMiddleware
 	proxy       *ProxyMiddleware
 	monitoring  *MonitoringMiddleware
-	
-	// Route matcher
-	matcher     *RouteMatcher
+	quotas      *QuotaMiddleware
+	usageDB     *PostgresUsageStore // when usage is kept in Postgres
+	
+	// Active config and route matcher, swapped by reloads
+	state       atomic.Pointer[gatewayState]
+	reloadMu    sync.Mutex
+	lastReload  *ReloadResult
+	
+	// Tenant routes, when tenant routing is enabled
+	tenantMu     sync.Mutex
+	tenants      *TenantRegistry
+	tenantRoutes []RouteConfig
+	stopTenants  context.CancelFunc
+	
+	// Background work such as tenant reloads stops on shutdown
+	background     context.Context
+	stopBackground context.CancelFunc
 }
 
 // NewGateway creates a new gateway instance
 func NewGateway(config *Config) (*Gateway, error) {
 	// Load full configuration
-	fullConfig, err := LoadConfig(config.ConfigPath, config)
+	state, warnings, err := loadState(config.ConfigPath, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	for _, warning := range warnings {
+		log.Printf("Route warning: %s", warning)
+	}
+	fullConfig := state.config
 	
 	// Setup Redis client
 	redisClient, err := setupRedis(fullConfig.RedisURL)
@@ -46,9 +65,11 @@ func NewGateway(config *Config) (*Gateway, error) {
 	
 	// Create gateway
 	gateway := &Gateway{
-		config:      fullConfig,
+		runtime:     config,
 		redisClient: redisClient,
 	}
+	gateway.state.Store(state)
+	gateway.background, gateway.stopBackground = context.WithCancel(context.Background())
 	
 	// Initialize components
 	if err := gateway.initializeComponents(); err != nil {
@@ -59,51 +80,75 @@ func NewGateway(config *Config) (*Gateway, error) {
 	if err := gateway.setupRouter(); err != nil {
 		return nil, fmt.Errorf("failed to setup router: %w", err)
 	}
+	gateway.server = &http.Server{
+		Addr:    ":" + fullConfig.Port,
+		Handler: gateway.router,
+	}
 	
 	return gateway, nil
 }
 
 // initializeComponents initializes all gateway components
 func (g *Gateway) initializeComponents() error {
+	config := g.current().config
 	var err error
 	
 	// Initialize auth middleware
-	g.auth, err = NewAuthMiddleware(&g.config.Auth, g.redisClient)
+	g.auth, err = NewAuthMiddleware(&config.Auth, g.redisClient)
 	if err != nil {
 		return fmt.Errorf("failed to initialize auth middleware: %w", err)
 	}
 	
 	// Initialize rate limit middleware
-	g.rateLimit, err = NewRateLimitMiddleware(&g.config.RateLimit, g.redisClient)
+	g.rateLimit, err = NewRateLimitMiddleware(g.redisClient)
 	if err != nil {
 		return fmt.Errorf("failed to initialize rate limit middleware: %w", err)
 	}
 	
+	// Initialize quota middleware; usage is kept in Postgres, or else Redis,
+	// so every gateway instance counts against the same quotas. Only
+	// Postgres keeps the daily aggregates durably enough to bill from.
+	retention := time.Duration(config.Quotas.UsageRetentionDays) * 24 * time.Hour
+	var usage UsageStore = NewMemoryUsageStore()
+	switch {
+	case config.DatabaseURL != "":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		g.usageDB, err = OpenPostgresUsageStore(ctx, config.DatabaseURL, retention)
+		if err != nil {
+			return fmt.Errorf("failed to initialize usage store: %w", err)
+		}
+		usage = g.usageDB
+	case g.redisClient != nil:
+		log.Printf("DATABASE_URL not set, keeping usage in Redis for %s", retention)
+		usage = NewRedisUsageStore(g.redisClient, retention)
+	}
+	g.quotas = NewQuotaMiddleware(usage)
+	
 	// Initialize proxy middleware
 	g.proxy, err = NewProxyMiddleware()
 	if err != nil {
 		return fmt.Errorf("failed to initialize proxy middleware: %w", err)
 	}
+	g.proxy.Pools().Sync(config)
 	
 	// Initialize monitoring middleware
-	g.monitoring, err = NewMonitoringMiddleware(&g.config.Monitoring)
+	g.monitoring, err = NewMonitoringMiddleware(&config.Monitoring)
 	if err != nil {
 		return fmt.Errorf("failed to initialize monitoring middleware: %w", err)
 	}
-	
-	// Initialize route matcher
-	g.matcher, err = NewRouteMatcher(g.config.Routes)
-	if err != nil {
-		return fmt.Errorf("failed to initialize route matcher: %w", err)
-	}
+	g.monitoring.SetBackendStatus(g.proxy.Pools().Status)
+	g.proxy.SetMonitor(g.monitoring)
 	
 	return nil
 }
 
 // setupRouter configures the HTTP router
 func (g *Gateway) setupRouter() error {
+	config := g.current().config
+	
 	// Set gin mode based on environment
-	if g.config.Environment == "production" {
+	if config.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	
@@ -112,35 +157,33 @@ func (g *Gateway) setupRouter() error {
 	// Add recovery middleware
 	g.router.Use(gin.Recovery())
 	
-	// Add monitoring middleware (logging, metrics)
+	// Add monitoring middleware (tracing, logging, metrics)
+	g.router.Use(g.monitoring.Tracing())
 	g.router.Use(g.monitoring.RequestLogger())
 	g.router.Use(g.monitoring.Metrics())
 	
-	// Add CORS middleware if enabled
-	if g.config.Cors.Enabled {
-		g.router.Use(g.corsMiddleware())
-	}
+	// Add CORS middleware (it applies the current CORS settings, which a
+	// reload may enable or disable)
+	g.router.Use(g.corsMiddleware())
 	
 	// Add health check endpoint
-	g.router.GET(g.config.Monitoring.HealthPath, g.healthCheck)
+	g.router.GET(config.Monitoring.HealthPath, g.healthCheck)
 	
 	// Add metrics endpoint
-	if g.config.Monitoring.Enabled {
-		g.router.GET(g.config.Monitoring.MetricsPath, g.monitoring.MetricsHandler())
+	if config.Monitoring.Enabled {
+		g.router.GET(config.Monitoring.MetricsPath, g.monitoring.MetricsHandler())
 	}
 	
+	// Add the gateway's admin endpoints
+	g.setupAdminEndpoints()
+	
 	// Add test endpoints for debugging and testing (BEFORE NoRoute)
-	log.Printf("DEBUG: Environment check - current: '%s', production check: %v", g.config.Environment, g.config.Environment != "production")
-	if g.config.Environment != "production" {
-		log.Printf("Setting up test endpoints (environment: %s)", g.config.Environment)
+	log.Printf("DEBUG: Environment check - current: '%s', production check: %v", config.Environment, config.Environment != "production")
+	if config.Environment != "production" {
+		log.Printf("Setting up test endpoints (environment: %s)", config.Environment)
 		g.setupTestEndpoints()
 	} else {
-		log.Printf("Skipping test endpoints (production environment: %s)", g.config.Environment)
-	}
-	
-	// WebSocket support is integrated into the main proxy handler for development
-	if g.config.Environment == "development" {
-		log.Printf("WebSocket support enabled for development (integrated into proxy handler)")
+		log.Printf("Skipping test endpoints (production environment: %s)", config.Environment)
 	}
 	
 	// Add main proxy handler with middleware chain (this catches all unmatched routes)
@@ -152,14 +195,11 @@ func (g *Gateway) setupRouter() error {
 // proxyHandler creates the main proxy handler with middleware chain
 func (g *Gateway) proxyHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check for WebSocket upgrade first (in development mode)
-		if g.config.Environment == "development" && isWebSocketUpgrade(c.Request) {
-			g.handleWebSocketUpgrade(c)
-			return
-		}
+		// The request uses one config throughout, even if a reload swaps it
+		state := g.current()
 		
 		// Find matching route
-		route, err := g.matcher.Match(c.Request)
+		route, err := state.matcher.Match(c.Request)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "No matching route found",
@@ -171,8 +211,11 @@ func (g *Gateway) proxyHandler() gin.HandlerFunc {
 		// Store route in context for other middleware
 		c.Set("route", route)
 		
+		// Meter the tenant's usage once the response is written
+		defer g.quotas.Meter(c)
+		
 		// Apply route-specific middleware chain
-		middlewares := g.buildMiddlewareChain(route)
+		middlewares := g.buildMiddlewareChain(state.config, route)
 		
 		// Execute middleware chain
 		for _, middleware := range middlewares {
@@ -182,76 +225,106 @@ func (g *Gateway) proxyHandler() gin.HandlerFunc {
 			}
 		}
 		
-		// If we get here, proxy the request
+		// WebSocket connections pass the same middleware as any other request
+		// before the handshake is proxied, and are then held to the rate
+		// limit's open connections for as long as they last
+		if isWebSocketUpgrade(c.Request) {
+			if rateLimitConfig := routeRateLimit(state.config, route); rateLimitConfig.Enabled {
+				release, ok := g.rateLimit.AcquireConnection(c, rateLimitConfig)
+				if !ok {
+					return
+				}
+				defer release()
+			}
+			
+			websocketConfig := &state.config.WebSocket
+			if route.WebSocket != nil {
+				websocketConfig = route.WebSocket
+			}
+			g.proxy.ProxyWebSocket(c, route, websocketConfig)
+			return
+		}
+		
+		// If we get here, proxy the request. Streamed responses such as
+		// server-sent events are flushed to the client as they arrive.
 		g.proxy.ProxyRequest(c, route)
 	}
 }
 
 // buildMiddlewareChain builds the middleware chain for a route
-func (g *Gateway) buildMiddlewareChain(route *RouteConfig) []gin.HandlerFunc {
+func (g *Gateway) buildMiddlewareChain(config *Config, route *RouteConfig) []gin.HandlerFunc {
 	var middlewares []gin.HandlerFunc
 	
-	// 1. Rate limiting (if enabled)
-	rateLimitConfig := &g.config.RateLimit
-	if route.RateLimit != nil {
-		rateLimitConfig = route.RateLimit
-	}
-	if rateLimitConfig.Enabled {
-		middlewares = append(middlewares, g.rateLimit.Handler(rateLimitConfig))
+	// 0. Tenant status (tenant routes only)
+	if route.Tenant != nil {
+		middlewares = append(middlewares, g.tenantStatus(route.Tenant))
 	}
 	
-	// 2. Authentication (if required)
-	authConfig := &g.config.Auth
+	// 1. Authentication (if required)
+	authConfig := &config.Auth
 	if route.Auth != nil {
 		authConfig = route.Auth
 	}
 	if authConfig.Enabled {
 		middlewares = append(middlewares, g.auth.Handler(authConfig))
 	}
+	if route.Tenant != nil {
+		middlewares = append(middlewares, g.tenantMember(route.Tenant))
+	}
+	
+	// 2. Rate limiting (if enabled), after authentication so limits can be
+	// keyed by user and tenant and set by role
+	rateLimitConfig := routeRateLimit(config, route)
+	if rateLimitConfig.Enabled {
+		middlewares = append(middlewares, g.rateLimit.Handler(rateLimitConfig))
+	}
+	
+	// 2b. Plan quotas (once the tenant is known)
+	if config.Quotas.Enabled {
+		quotas := &config.Quotas
+		planFor := func(tenantID string) string {
+			return g.tenantPlan(quotas, route, tenantID)
+		}
+		middlewares = append(middlewares, g.quotas.Handler(quotas, planFor))
+	}
 	
 	// 3. Request transformation (if configured)
 	if route.Transform != nil {
-		middlewares = append(middlewares, g.transformRequest(route.Transform))
+		middlewares = append(middlewares, g.transformRequest(route))
 	}
 	
 	return middlewares
 }
 
-// transformRequest applies request transformations
-func (g *Gateway) transformRequest(transform *TransformConfig) gin.HandlerFunc {
+// routeRateLimit returns the rate limit of a route: its own, or the
+// gateway's
+func routeRateLimit(config *Config, route *RouteConfig) *RateLimitConfig {
+	if route.RateLimit != nil {
+		return route.RateLimit
+	}
+	return &config.RateLimit
+}
+
+// transformRequest applies the route's JSON request body transformations.
+// Paths and headers are transformed as the request is proxied, and
+// responses as they arrive from the backend.
+func (g *Gateway) transformRequest(route *RouteConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Add headers
-		for key, value := range transform.AddHeaders {
-			c.Request.Header.Set(key, value)
-		}
-		
-		// Remove headers
-		for _, header := range transform.RemoveHeaders {
-			c.Request.Header.Del(header)
-		}
-		
-		// Rewrite path
-		if transform.RewritePath != "" {
-			c.Request.URL.Path = transform.RewritePath
+		if !transformRequestBody(c, route.Transform, route) {
+			return
 		}
-		
 		c.Next()
-		
-		// Apply response transformations after proxy
-		for key, value := range transform.AddResponseHeaders {
-			c.Header(key, value)
-		}
-		
-		for _, header := range transform.RemoveResponseHeaders {
-			c.Header(header, "")
-		}
 	}
 }
 
 // corsMiddleware handles CORS
 func (g *Gateway) corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		cors := &g.config.Cors
+		cors := &g.current().config.Cors
+		if !cors.Enabled {
+			c.Next()
+			return
+		}
 		
 		// Set CORS headers
 		if len(cors.AllowedOrigins) > 0 {
@@ -319,7 +392,8 @@ func (g *Gateway) healthCheck(c *gin.Context) {
 		httpStatus = http.StatusServiceUnavailable
 	}
 	
-	c.JSON(httpStatus, gin.H{
+	config := g.current().config
+	response := gin.H{
 		"status":    status,
 		"timestamp": time.Now().UTC(),
 		"version":   "1.0.0",
@@ -327,35 +401,31 @@ func (g *Gateway) healthCheck(c *gin.Context) {
 			"redis":    redisStatus,
 			"backends": backendStatus,
 		},
-		"routes_configured": len(g.config.Routes),
-	})
+		"routes_configured": len(config.Routes),
+	}
+	if config.TenantRouting.Enabled {
+		response["tenant_routes"] = len(g.current().matcher.TenantRoutes())
+	}
+	
+	c.JSON(httpStatus, response)
 }
 
-// checkBackendHealth checks the health of configured backends
+// checkBackendHealth reports the backends in and out of the rotation, as
+// found by active health checks and outlier detection
 func (g *Gateway) checkBackendHealth() gin.H {
 	healthy := []string{}
 	unhealthy := []string{}
 	
-	for _, route := range g.config.Routes {
-		if !route.Enabled {
-			continue
-		}
-		
-		// Check primary backend URL
-		if route.Backend.URL != "" {
-			if g.isBackendHealthy(route.Backend.URL, route.Backend.HealthCheckPath) {
-				healthy = append(healthy, route.Backend.URL)
-			} else {
-				unhealthy = append(unhealthy, route.Backend.URL)
-			}
-		}
-		
-		// Check additional URLs for load balancing
-		for _, url := range route.Backend.URLs {
-			if g.isBackendHealthy(url, route.Backend.HealthCheckPath) {
-				healthy = append(healthy, url)
+	var pools []PoolStatus
+	if g.proxy != nil {
+		pools = g.proxy.Pools().Status()
+	}
+	for _, pool := range pools {
+		for _, backend := range pool.Backends {
+			if backend.Healthy && !backend.Ejected {
+				healthy = append(healthy, backend.URL)
 			} else {
-				unhealthy = append(unhealthy, url)
+				unhealthy = append(unhealthy, backend.URL)
 			}
 		}
 	}
@@ -380,16 +450,72 @@ func (g *Gateway) isBackendHealthy(baseURL, healthPath string) bool {
 
 // Start starts the gateway server
 func (g *Gateway) Start() error {
-	log.Printf("Gateway starting on port %s", g.config.Port)
-	log.Printf("Configured routes: %d", len(g.config.Routes))
+	config := g.current().config
+	log.Printf("Gateway starting on port %s", config.Port)
+	log.Printf("Configured routes: %d", len(config.Routes))
+	
+	// Load tenant routes in the background; requests for tenant hosts get
+	// 404 until the first load completes
+	if config.TenantRouting.Enabled {
+		g.startTenants(&config.TenantRouting)
+	}
+	
+	// Check backend health in the background
+	go g.proxy.Pools().RunHealthChecks(g.background)
 	
-	return g.router.Run(":" + g.config.Port)
+	// Reload the config on SIGHUP and file changes
+	go g.watchReloads(g.background)
+	
+	// Delete usage older than the retention period
+	if g.usageDB != nil {
+		go g.usageDB.RunPruning(g.background, time.Hour)
+	}
+	
+	// Shutdown makes the server return ErrServerClosed
+	if err := g.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 // Shutdown gracefully shuts down the gateway
 func (g *Gateway) Shutdown(ctx context.Context) error {
 	log.Println("Gateway shutting down...")
 	
+	// Stop background work
+	if g.stopBackground != nil {
+		g.stopBackground()
+	}
+	
+	// Close WebSocket connections, which the server no longer tracks once
+	// they're hijacked, then stop taking requests and wait for those in
+	// flight
+	if g.proxy != nil {
+		if err := g.proxy.CloseWebSockets(ctx); err != nil {
+			log.Printf("Failed to close WebSocket connections gracefully: %v", err)
+		}
+	}
+	if g.server != nil {
+		if err := g.server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to finish requests in flight: %v", err)
+			g.server.Close()
+		}
+	}
+	
+	// Send the spans not yet exported
+	if g.monitoring != nil {
+		if err := g.monitoring.Shutdown(ctx); err != nil {
+			log.Printf("Failed to export spans: %v", err)
+		}
+	}
+	
+	// Close the usage database
+	if g.usageDB != nil {
+		if err := g.usageDB.Close(); err != nil {
+			log.Printf("Failed to close usage database: %v", err)
+		}
+	}
+	
 	// Close Redis connection
 	if g.redisClient != nil {
 		return g.redisClient.Close()
@@ -434,65 +560,8 @@ func joinStrings(strs []string, sep string) string {
 	return result
 }
 
-// handleWebSocketUpgrade handles WebSocket upgrade requests by proxying to the appropriate backend
-func (g *Gateway) handleWebSocketUpgrade(c *gin.Context) {
-	// Find matching route for WebSocket
-	route, err := g.matcher.Match(c.Request)
-	if err != nil {
-		log.Printf("No route found for WebSocket request: %s", c.Request.URL.Path)
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-
-	// Parse backend URL
-	backendURL, err := url.Parse(route.Backend.URL)
-	if err != nil {
-		log.Printf("Invalid backend URL for WebSocket: %s", route.Backend.URL)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
-	}
-
-	// Create reverse proxy for WebSocket
-	proxy := httputil.NewSingleHostReverseProxy(backendURL)
-	
-	// Modify the request for WebSocket forwarding
-	proxy.Director = func(req *http.Request) {
-		req.URL.Scheme = "http"
-		req.URL.Host = backendURL.Host
-		
-		// Apply path transformation if configured
-		if route.Transform != nil && route.Transform.RewritePath != "" {
-			if route.Transform.RewritePath == "/" {
-				// Strip the path prefix
-				req.URL.Path = strings.TrimPrefix(req.URL.Path, route.PathPrefix)
-				if req.URL.Path == "" {
-					req.URL.Path = "/"
-				}
-			} else {
-				req.URL.Path = route.Transform.RewritePath
-			}
-		}
-
-		// Add custom headers
-		if route.Transform != nil && route.Transform.AddHeaders != nil {
-			for key, value := range route.Transform.AddHeaders {
-				req.Header.Set(key, value)
-			}
-		}
-
-		// Preserve WebSocket headers
-		req.Header.Set("X-Forwarded-For", c.ClientIP())
-		req.Header.Set("X-Forwarded-Proto", "http")
-		req.Header.Set("X-Forwarded-Host", req.Host)
-	}
-
-	// Handle WebSocket upgrade
-	log.Printf("Proxying WebSocket request: %s -> %s", c.Request.URL.Path, backendURL.String())
-	proxy.ServeHTTP(c.Writer, c.Request)
-}
-
 // isWebSocketUpgrade checks if the request is a WebSocket upgrade request
 func isWebSocketUpgrade(r *http.Request) bool {
-	return strings.ToLower(r.Header.Get("Connection")) == "upgrade" &&
-		strings.ToLower(r.Header.Get("Upgrade")) == "websocket"
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
 }
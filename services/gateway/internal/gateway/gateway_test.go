@@ -69,9 +69,7 @@ func TestHealthCheck(t *testing.T) {
 	
 	// Mock gateway without Redis dependency
 	// Note: redisClient will be nil, which should be handled gracefully
-	gateway := &Gateway{
-		config: config,
-	}
+	gateway := newStateTestGateway(config, nil)
 	
 	// Set gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -99,7 +97,7 @@ func TestCORSMiddleware(t *testing.T) {
 		},
 	}
 	
-	gateway := &Gateway{config: config}
+	gateway := newStateTestGateway(config, nil)
 	
 	// Test CORS middleware
 	middleware := gateway.corsMiddleware()
@@ -213,7 +211,7 @@ func BenchmarkHealthCheck(b *testing.B) {
 		},
 	}
 	
-	gateway := &Gateway{config: config}
+	gateway := newStateTestGateway(config, nil)
 	gin.SetMode(gin.TestMode)
 	
 	b.ResetTimer()
@@ -0,0 +1,379 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OverflowLabel replaces label values past a cardinality limit
+const OverflowLabel = "other"
+
+// DefaultLatencyBuckets are the request latency histogram buckets, in seconds
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsRegistry holds metrics and writes them in the Prometheus text
+// exposition format. Each metric keeps at most maxSeries label combinations;
+// later combinations are counted in one series with every label set to
+// OverflowLabel, so memory stays bounded whatever the traffic.
+type MetricsRegistry struct {
+	maxSeries int
+
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// collector writes one or more metric families
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry(maxSeries int) *MetricsRegistry {
+	if maxSeries <= 0 {
+		maxSeries = 10000
+	}
+	return &MetricsRegistry{maxSeries: maxSeries}
+}
+
+func (r *MetricsRegistry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus writes every metric in the Prometheus text format
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// metricFamily is the name, help and label names shared by a metric's series
+type metricFamily struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (f *metricFamily) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// seriesKey joins label values into a map key
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// overflowValues is the label values of the overflow series
+func overflowValues(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = OverflowLabel
+	}
+	return values
+}
+
+// CounterVec is a counter with labels
+type CounterVec struct {
+	metricFamily
+	maxSeries int
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+// NewCounterVec registers a counter
+func (r *MetricsRegistry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricFamily: metricFamily{name: name, help: help, kind: "counter", labels: labels},
+		maxSeries:    r.maxSeries,
+		series:       make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series with the label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds to the series with the label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seriesKey(values)
+	s := c.series[key]
+	if s == nil {
+		if len(c.series) >= c.maxSeries {
+			values = overflowValues(len(c.labels))
+			key = seriesKey(values)
+			s = c.series[key]
+		}
+		if s == nil {
+			s = &counterSeries{values: append([]string(nil), values...)}
+			c.series[key] = s
+		}
+	}
+	s.value += delta
+}
+
+// Value returns the value of the series with the label values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.series[seriesKey(values)]; s != nil {
+		return s.value
+	}
+	return 0
+}
+
+// Each calls fn with every series' label values and value
+func (c *CounterVec) Each(fn func(values []string, value float64)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.series {
+		fn(s.values, s.value)
+	}
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.values), formatValue(s.value))
+	}
+}
+
+// HistogramVec is a histogram with labels
+type HistogramVec struct {
+	metricFamily
+	buckets   []float64
+	maxSeries int
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds
+func (r *MetricsRegistry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		metricFamily: metricFamily{name: name, help: help, kind: "histogram", labels: labels},
+		buckets:      buckets,
+		maxSeries:    r.maxSeries,
+		series:       make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the series with the label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(values)
+	s := h.series[key]
+	if s == nil {
+		if len(h.series) >= h.maxSeries {
+			values = overflowValues(len(h.labels))
+			key = seriesKey(values)
+			s = h.series[key]
+		}
+		if s == nil {
+			s = &histogramSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets)+1)}
+			h.series[key] = s
+		}
+	}
+
+	s.counts[sort.SearchFloat64s(h.buckets, value)]++
+	s.count++
+	s.sum += value
+}
+
+// Count returns the number of values observed in the series with the label
+// values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.series[seriesKey(values)]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+// Each calls fn with every series' label values, count and sum
+func (h *HistogramVec) Each(fn func(values []string, count uint64, sum float64)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.series {
+		fn(s.values, s.count, s.sum)
+	}
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		values := append(append([]string(nil), s.values...), "")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.values), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.values), s.count)
+	}
+}
+
+// GaugeSample is one series of a gauge computed at scrape time
+type GaugeSample struct {
+	Values []string
+	Value  float64
+}
+
+// gaugeFunc is a gauge whose series are computed when metrics are written
+type gaugeFunc struct {
+	metricFamily
+	collect func() []GaugeSample
+}
+
+// NewGaugeFunc registers a gauge computed by collect on every scrape
+func (r *MetricsRegistry) NewGaugeFunc(name, help string, collect func() []GaugeSample, labels ...string) {
+	r.register(&gaugeFunc{
+		metricFamily: metricFamily{name: name, help: help, kind: "gauge", labels: labels},
+		collect:      collect,
+	})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	for _, sample := range g.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, sample.Values), formatValue(sample.Value))
+	}
+}
+
+// LabelLimiter caps the distinct values of one label. The first max values
+// seen keep their own series; later ones are reported as OverflowLabel.
+type LabelLimiter struct {
+	max int
+
+	mu   sync.RWMutex
+	seen map[string]bool
+}
+
+// NewLabelLimiter creates a limiter allowing max distinct values
+func NewLabelLimiter(max int) *LabelLimiter {
+	return &LabelLimiter{max: max, seen: make(map[string]bool)}
+}
+
+// Value returns the label value to record for a value
+func (l *LabelLimiter) Value(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	l.mu.RLock()
+	seen := l.seen[value]
+	l.mu.RUnlock()
+	if seen {
+		return value
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[value] {
+		return value
+	}
+	if len(l.seen) >= l.max {
+		return OverflowLabel
+	}
+	l.seen[value] = true
+	return value
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
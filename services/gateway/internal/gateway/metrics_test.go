@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, registry *MetricsRegistry) string {
+	var buf bytes.Buffer
+	require.NoError(t, registry.WritePrometheus(&buf))
+	return buf.String()
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	registry := NewMetricsRegistry(3)
+	counter := registry.NewCounterVec("test_total", "A counter.", "name")
+	histogram := registry.NewHistogramVec("test_seconds", "A histogram.", []float64{0.1, 1}, "name")
+	registry.NewGaugeFunc("test_gauge", "A gauge.", func() []GaugeSample {
+		return []GaugeSample{{Values: []string{`a "quoted"\name`}, Value: 2.5}}
+	}, "name")
+
+	counter.Inc("a")
+	counter.Add(2, "a")
+	histogram.Observe(0.05, "a")
+	histogram.Observe(0.1, "a")
+	histogram.Observe(0.5, "a")
+	histogram.Observe(3, "a")
+
+	assert.Equal(t, `# HELP test_total A counter.
+# TYPE test_total counter
+test_total{name="a"} 3
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{name="a",le="0.1"} 2
+test_seconds_bucket{name="a",le="1"} 3
+test_seconds_bucket{name="a",le="+Inf"} 4
+test_seconds_sum{name="a"} 3.65
+test_seconds_count{name="a"} 4
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge{name="a \"quoted\"\\name"} 2.5
+`, scrape(t, registry))
+
+	t.Run("SeriesLimit", func(t *testing.T) {
+		for _, name := range []string{"b", "c", "d", "e"} {
+			counter.Inc(name)
+		}
+		assert.Equal(t, float64(1), counter.Value("b"))
+		assert.Equal(t, float64(0), counter.Value("d"))
+		assert.Equal(t, float64(2), counter.Value(OverflowLabel))
+	})
+}
+
+func TestLabelLimiter(t *testing.T) {
+	limiter := NewLabelLimiter(2)
+	assert.Equal(t, "t1", limiter.Value("t1"))
+	assert.Equal(t, "t2", limiter.Value("t2"))
+	assert.Equal(t, OverflowLabel, limiter.Value("t3"))
+	assert.Equal(t, "t1", limiter.Value("t1"))
+	assert.Equal(t, "", limiter.Value(""))
+}
+
+func TestMonitoringMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	monitoring, err := NewMonitoringMiddleware(&MonitoringConfig{MetricsMaxTenants: 2})
+	require.NoError(t, err)
+	monitoring.SetBackendStatus(func() []PoolStatus {
+		return []PoolStatus{
+			{Backends: []BackendStatus{{URL: "http://a", Healthy: true, Circuit: CircuitClosed, ActiveConnections: 3}}},
+			{Backends: []BackendStatus{{URL: "http://b", Ejected: true, Circuit: CircuitOpen}}},
+		}
+	})
+
+	route := &RouteConfig{Description: "Orders", PathPrefix: "/orders"}
+	router := gin.New()
+	router.Use(monitoring.Metrics())
+	router.GET("/metrics", monitoring.MetricsHandler())
+	router.GET("/orders/:tenant", func(c *gin.Context) {
+		c.Set("route", route)
+		c.Set("tenant_id", c.Param("tenant"))
+		c.Set("backend_url", "http://a")
+		if c.Query("limited") != "" {
+			c.Set("rate_limited", true)
+			c.Status(http.StatusTooManyRequests)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/orders/t1", "/orders/t1", "/orders/t2", "/orders/t3", "/orders/t4?limited=1", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	body := w.Body.String()
+
+	for _, line := range []string{
+		`gateway_request_duration_seconds_count{route="Orders",tenant="t1",status_class="2xx",backend="http://a"} 2`,
+		`gateway_request_duration_seconds_count{route="Orders",tenant="t2",status_class="2xx",backend="http://a"} 1`,
+		// Tenants past the limit share one label value
+		`gateway_request_duration_seconds_count{route="Orders",tenant="other",status_class="2xx",backend="http://a"} 1`,
+		`gateway_request_duration_seconds_count{route="Orders",tenant="other",status_class="4xx",backend="http://a"} 1`,
+		`gateway_request_duration_seconds_count{route="unmatched",tenant="none",status_class="4xx",backend="none"} 1`,
+		`gateway_rate_limit_hits_total{route="Orders",tenant="other"} 1`,
+		`gateway_backend_healthy{backend="http://a"} 1`,
+		`gateway_backend_healthy{backend="http://b"} 0`,
+		`gateway_backend_ejected{backend="http://b"} 1`,
+		`gateway_backend_active_connections{backend="http://a"} 3`,
+		`gateway_backend_circuit_state{backend="http://b",state="open"} 1`,
+		`gateway_backend_circuit_state{backend="http://b",state="closed"} 0`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, `tenant="t3"`)
+	assert.Contains(t, body, "# TYPE gateway_uptime_seconds gauge\n")
+
+	t.Run("JSONSummary", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics?format=json", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var summary struct {
+			Requests struct {
+				Total    int            `json:"total"`
+				ByStatus map[string]int `json:"by_status"`
+				ByTenant map[string]int `json:"by_tenant"`
+			} `json:"requests"`
+			RateLimiting struct {
+				TotalHits int `json:"total_hits"`
+			} `json:"rate_limiting"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+		assert.Equal(t, 7, summary.Requests.Total)
+		assert.Equal(t, 5, summary.Requests.ByStatus["2xx"])
+		assert.Equal(t, map[string]int{"t1": 2, "t2": 1, "other": 2}, summary.Requests.ByTenant)
+		assert.Equal(t, 1, summary.RateLimiting.TotalHits)
+	})
+}
+
+func TestProxyBackendMetrics(t *testing.T) {
+	monitoring, err := NewMonitoringMiddleware(&MonitoringConfig{})
+	require.NoError(t, err)
+
+	bad := newRecordingBackend(t, "bad", always(http.StatusBadGateway))
+	good := newRecordingBackend(t, "good", always(0))
+	route := &RouteConfig{Description: "API", Backend: BackendConfig{
+		URLs:       []string{bad.URL, good.URL},
+		MaxRetries: 1,
+		Retry:      RetryConfig{BackoffBase: time.Millisecond},
+	}}
+	server, proxy := newProxyServer(t, route)
+	proxy.SetMonitor(monitoring)
+
+	status, _ := send(t, "GET", server.URL+"/", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(1), monitoring.backendErrors.Value("API", bad.URL, "status_5xx"))
+	assert.Equal(t, float64(1), monitoring.backendRetries.Value("API", bad.URL))
+
+	down, _ := newProxyServer(t, &RouteConfig{Description: "Down", Backend: BackendConfig{URL: "http://127.0.0.1:1"}})
+	status, _ = send(t, "POST", down.URL+"/", "")
+	assert.Equal(t, http.StatusBadGateway, status)
+}
+
+func TestAdminBackendsEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, strings.Replace(reloadConfigA, `url: "http://service-a"`, `urls: ["http://a1", "http://a2"]
+      load_balancing: least_connections`, 1))
+	g := newReloadTestGateway(t, path)
+
+	admin, err := GenerateToken("u1", "admin@example.com", "system", []string{"platform_admin"}, nil, "secret", time.Hour)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", AdminPath+"/backends", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	g.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Pools []PoolStatus `json:"pools"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Pools, 1)
+	assert.Equal(t, BalanceLeastConnections, body.Pools[0].Strategy)
+	assert.Len(t, body.Pools[0].Backends, 2)
+	assert.Equal(t, CircuitClosed, body.Pools[0].Backends[0].Circuit)
+}
+
+func TestRouteLabel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		route    RouteConfig
+		expected string
+	}{
+		{"Description", RouteConfig{Description: "Orders", PathPrefix: "/orders"}, "Orders"},
+		{"PathPrefix", RouteConfig{PathPrefix: "/orders"}, "/orders"},
+		{"Host", RouteConfig{Host: "api.example.com"}, "api.example.com"},
+		{"Tenant", RouteConfig{Description: "Tenant t1 (acme.backsaas.dev)", Host: "acme.backsaas.dev", Tenant: &Tenant{ID: "t1"}}, "tenant"},
+		{"Unnamed", RouteConfig{}, "unnamed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, routeLabel(&tc.route))
+		})
+	}
+}
@@ -1,68 +1,163 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MonitoringMiddleware handles monitoring, logging, and metrics
 type MonitoringMiddleware struct {
-	config  *MonitoringConfig
-	metrics *Metrics
-}
-
-// Metrics holds various gateway metrics
-type Metrics struct {
-	mu sync.RWMutex
-	
-	// Request metrics
-	TotalRequests     int64
-	RequestsByStatus  map[int]int64
-	RequestsByRoute   map[string]int64
-	RequestsByTenant  map[string]int64
-	
-	// Response time metrics
-	ResponseTimes     []time.Duration
-	AverageResponseTime time.Duration
+	config    *MonitoringConfig
+	registry  *MetricsRegistry
+	startTime time.Time
+	lastRequest atomic.Int64 // Unix nanoseconds
 	
-	// Error metrics
-	TotalErrors       int64
-	ErrorsByType      map[string]int64
+	// Tenant label values are capped to bound the number of series
+	tenants   *LabelLimiter
 	
-	// Rate limiting metrics
-	RateLimitHits     int64
-	RateLimitByTenant map[string]int64
+	requestDuration *HistogramVec
+	rateLimitHits   *CounterVec
+	backendErrors   *CounterVec
+	backendRetries  *CounterVec
 	
-	// Backend metrics
-	BackendRequests   map[string]int64
-	BackendErrors     map[string]int64
-	BackendResponseTimes map[string]time.Duration
+	// Reports backend pool state, when set
+	backendStatus func() []PoolStatus
 	
-	// System metrics
-	StartTime         time.Time
-	LastRequestTime   time.Time
+	// Records spans; nil when tracing is disabled
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+	exporter       sdktrace.SpanExporter
 }
 
 // NewMonitoringMiddleware creates a new monitoring middleware
 func NewMonitoringMiddleware(config *MonitoringConfig) (*MonitoringMiddleware, error) {
-	return &MonitoringMiddleware{
-		config: config,
-		metrics: &Metrics{
-			RequestsByStatus:    make(map[int]int64),
-			RequestsByRoute:     make(map[string]int64),
-			RequestsByTenant:    make(map[string]int64),
-			ErrorsByType:        make(map[string]int64),
-			RateLimitByTenant:   make(map[string]int64),
-			BackendRequests:     make(map[string]int64),
-			BackendErrors:       make(map[string]int64),
-			BackendResponseTimes: make(map[string]time.Duration),
-			StartTime:           time.Now(),
+	buckets := config.LatencyBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	maxTenants := config.MetricsMaxTenants
+	if maxTenants <= 0 {
+		maxTenants = 100
+	}
+	
+	registry := NewMetricsRegistry(config.MetricsMaxSeries)
+	m := &MonitoringMiddleware{
+		config:    config,
+		registry:  registry,
+		startTime: time.Now(),
+		tenants:   NewLabelLimiter(maxTenants),
+		requestDuration: registry.NewHistogramVec("gateway_request_duration_seconds",
+			"Time to handle requests, from arrival to the last byte of the response.",
+			buckets, "route", "tenant", "status_class", "backend"),
+		rateLimitHits: registry.NewCounterVec("gateway_rate_limit_hits_total",
+			"Requests rejected by rate limits.", "route", "tenant"),
+		backendErrors: registry.NewCounterVec("gateway_backend_errors_total",
+			"Failed requests to backends, by reason: connection, timeout, status_5xx or circuit_open.",
+			"route", "backend", "reason"),
+		backendRetries: registry.NewCounterVec("gateway_backend_retries_total",
+			"Requests retried after the backend failed them.", "route", "backend"),
+	}
+	
+	registry.NewGaugeFunc("gateway_uptime_seconds", "Time since the gateway started.", func() []GaugeSample {
+		return []GaugeSample{{Value: time.Since(m.startTime).Seconds()}}
+	})
+	registry.NewGaugeFunc("gateway_backend_healthy",
+		"Whether the backend passes active health checks (1) or not (0).",
+		func() []GaugeSample { return m.backendSamples(func(b BackendStatus) float64 { return boolValue(b.Healthy) }) },
+		"backend")
+	registry.NewGaugeFunc("gateway_backend_ejected",
+		"Whether outlier detection has ejected the backend (1) or not (0).",
+		func() []GaugeSample { return m.backendSamples(func(b BackendStatus) float64 { return boolValue(b.Ejected) }) },
+		"backend")
+	registry.NewGaugeFunc("gateway_backend_active_connections",
+		"Requests in flight to the backend.",
+		func() []GaugeSample {
+			return m.backendSamples(func(b BackendStatus) float64 { return float64(b.ActiveConnections) })
 		},
-	}, nil
+		"backend")
+	registry.NewGaugeFunc("gateway_backend_circuit_state",
+		"The state of the backend's circuit breaker: 1 for the current state, 0 for the others.",
+		m.circuitSamples, "backend", "state")
+	
+	if config.TracingEnabled {
+		provider, exporter, err := newTracerProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		m.tracerProvider = provider
+		m.tracer = provider.Tracer(tracerName)
+		m.exporter = exporter
+	}
+	
+	return m, nil
+}
+
+// Tracing returns middleware that records a server span for each request,
+// continuing the caller's trace from its traceparent header. The proxy
+// records each backend attempt as a child span and passes it on in the
+// backend request's traceparent.
+func (m *MonitoringMiddleware) Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.tracer == nil {
+			c.Next()
+			return
+		}
+		
+		ctx := traceContext.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := m.tracer.Start(ctx, c.Request.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.host", c.Request.Host),
+			attribute.String("http.target", c.Request.URL.RequestURI()),
+			attribute.String("client.address", c.ClientIP()),
+		)
+		c.Request = c.Request.WithContext(ctx)
+		
+		c.Next()
+		
+		route := "unmatched"
+		if r, exists := c.Get("route"); exists {
+			route = routeLabel(r.(*RouteConfig))
+		}
+		span.SetName(c.Request.Method + " " + route)
+		span.SetAttributes(attribute.String("gateway.route", route))
+		if tenantID := c.GetString("tenant_id"); tenantID != "" {
+			span.SetAttributes(attribute.String("tenant.id", tenantID))
+		}
+		if userID := c.GetString("user_id"); userID != "" {
+			span.SetAttributes(attribute.String("user.id", userID))
+		}
+		
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// Tracer returns the tracer, or nil when tracing is disabled
+func (m *MonitoringMiddleware) Tracer() trace.Tracer {
+	return m.tracer
+}
+
+// Shutdown exports the spans not yet sent
+func (m *MonitoringMiddleware) Shutdown(ctx context.Context) error {
+	if m.tracerProvider == nil {
+		return nil
+	}
+	return m.tracerProvider.Shutdown(ctx)
 }
 
 // RequestLogger returns middleware for request logging
@@ -132,7 +227,12 @@ func (m *MonitoringMiddleware) RequestLogger() gin.HandlerFunc {
 			"tenant_id":    tenantID,
 			"route":        routeDescription,
 			"upstream_url": upstreamURL,
-			"request_id":   c.GetHeader("X-Request-ID"),
+			"request_id":   requestID(c),
+		}
+		
+		// Correlate the log line with the request's trace
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			logEntry["trace_id"] = sc.TraceID().String()
 		}
 		
 		// Add error info if present
@@ -146,9 +246,6 @@ func (m *MonitoringMiddleware) RequestLogger() gin.HandlerFunc {
 		} else {
 			m.logText(logEntry)
 		}
-		
-		// Update metrics
-		m.updateMetrics(statusCode, latency, tenantID, routeDescription)
 	}
 }
 
@@ -161,150 +258,240 @@ func (m *MonitoringMiddleware) Metrics() gin.HandlerFunc {
 		
 		// Update metrics after request processing
 		latency := time.Since(start)
-		statusCode := c.Writer.Status()
 		
-		tenantID := ""
-		if tid, exists := c.Get("tenant_id"); exists {
-			tenantID = tid.(string)
+		route := "unmatched"
+		if r, exists := c.Get("route"); exists {
+			route = routeLabel(r.(*RouteConfig))
 		}
-		
-		routeDescription := ""
-		if route, exists := c.Get("route"); exists {
-			routeDescription = route.(*RouteConfig).Description
+		tenant := m.tenantLabel(c.GetString("tenant_id"))
+		backend := c.GetString("backend_url")
+		if backend == "" {
+			backend = "none"
 		}
 		
-		m.updateMetrics(statusCode, latency, tenantID, routeDescription)
+		m.lastRequest.Store(time.Now().UnixNano())
+		m.requestDuration.Observe(latency.Seconds(), route, tenant, statusClass(c.Writer.Status()), backend)
+		if c.GetBool("rate_limited") {
+			m.RecordRateLimitHit(route, c.GetString("tenant_id"))
+		}
 	}
 }
 
-// MetricsHandler returns HTTP handler for metrics endpoint
+// MetricsHandler returns HTTP handler for metrics endpoint, in the
+// Prometheus text format. With ?format=json it returns a JSON summary for
+// dashboards instead.
 func (m *MonitoringMiddleware) MetricsHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		m.metrics.mu.RLock()
-		defer m.metrics.mu.RUnlock()
-		
-		// Calculate uptime
-		uptime := time.Since(m.metrics.StartTime)
-		
-		// Calculate average response time
-		avgResponseTime := m.calculateAverageResponseTime()
-		
-		// Build metrics response
-		metrics := gin.H{
-			"gateway": gin.H{
-				"uptime_seconds":        uptime.Seconds(),
-				"start_time":           m.metrics.StartTime.Format(time.RFC3339),
-				"last_request_time":    m.metrics.LastRequestTime.Format(time.RFC3339),
-			},
-			"requests": gin.H{
-				"total":                m.metrics.TotalRequests,
-				"by_status":           m.metrics.RequestsByStatus,
-				"by_route":            m.metrics.RequestsByRoute,
-				"by_tenant":           m.metrics.RequestsByTenant,
-				"average_response_time_ms": avgResponseTime.Milliseconds(),
-			},
-			"errors": gin.H{
-				"total":     m.metrics.TotalErrors,
-				"by_type":   m.metrics.ErrorsByType,
-			},
-			"rate_limiting": gin.H{
-				"total_hits":  m.metrics.RateLimitHits,
-				"by_tenant":   m.metrics.RateLimitByTenant,
-			},
-			"backends": gin.H{
-				"requests":       m.metrics.BackendRequests,
-				"errors":         m.metrics.BackendErrors,
-				"response_times": m.formatBackendResponseTimes(),
-			},
+		if c.Query("format") == "json" {
+			c.JSON(http.StatusOK, m.Summary())
+			return
 		}
 		
-		c.JSON(http.StatusOK, metrics)
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := m.registry.WritePrometheus(c.Writer); err != nil {
+			c.Error(err)
+		}
 	}
 }
 
-// updateMetrics updates internal metrics
-func (m *MonitoringMiddleware) updateMetrics(statusCode int, latency time.Duration, tenantID, route string) {
-	m.metrics.mu.Lock()
-	defer m.metrics.mu.Unlock()
+// Summary totals the metrics by route, tenant, status class and backend
+func (m *MonitoringMiddleware) Summary() gin.H {
+	var total, errors uint64
+	var totalSeconds float64
+	byStatus := map[string]uint64{}
+	byRoute := map[string]uint64{}
+	byTenant := map[string]uint64{}
+	errorsByType := map[string]uint64{}
+	backendRequests := map[string]uint64{}
+	backendSeconds := map[string]float64{}
+	m.requestDuration.Each(func(values []string, count uint64, sum float64) {
+		route, tenant, class, backend := values[0], values[1], values[2], values[3]
+		total += count
+		totalSeconds += sum
+		byStatus[class] += count
+		byRoute[route] += count
+		if tenant != "none" {
+			byTenant[tenant] += count
+		}
+		if class == "4xx" || class == "5xx" {
+			errors += count
+			if class == "4xx" {
+				errorsByType["client_error"] += count
+			} else {
+				errorsByType["server_error"] += count
+			}
+		}
+		if backend != "none" {
+			backendRequests[backend] += count
+			backendSeconds[backend] += sum
+		}
+	})
 	
-	// Update request metrics
-	m.metrics.TotalRequests++
-	m.metrics.RequestsByStatus[statusCode]++
-	m.metrics.LastRequestTime = time.Now()
+	var rateLimitHits float64
+	rateLimitByTenant := map[string]float64{}
+	m.rateLimitHits.Each(func(values []string, value float64) {
+		rateLimitHits += value
+		if values[1] != "none" {
+			rateLimitByTenant[values[1]] += value
+		}
+	})
+	backendErrors := map[string]float64{}
+	m.backendErrors.Each(func(values []string, value float64) {
+		backendErrors[values[1]] += value
+	})
 	
-	if route != "" {
-		m.metrics.RequestsByRoute[route]++
+	// Averages in milliseconds
+	average := func(seconds float64, count uint64) int64 {
+		if count == 0 {
+			return 0
+		}
+		return int64(seconds / float64(count) * 1000)
 	}
-	
-	if tenantID != "" {
-		m.metrics.RequestsByTenant[tenantID]++
+	responseTimes := map[string]int64{}
+	for backend, count := range backendRequests {
+		responseTimes[backend] = average(backendSeconds[backend], count)
 	}
 	
-	// Update response time metrics
-	m.metrics.ResponseTimes = append(m.metrics.ResponseTimes, latency)
-	
-	// Keep only last 1000 response times to prevent memory growth
-	if len(m.metrics.ResponseTimes) > 1000 {
-		m.metrics.ResponseTimes = m.metrics.ResponseTimes[len(m.metrics.ResponseTimes)-1000:]
+	lastRequest := ""
+	if last := m.lastRequest.Load(); last > 0 {
+		lastRequest = time.Unix(0, last).UTC().Format(time.RFC3339)
 	}
 	
-	// Update error metrics
-	if statusCode >= 400 {
-		m.metrics.TotalErrors++
-		
-		errorType := "client_error"
-		if statusCode >= 500 {
-			errorType = "server_error"
-		}
-		m.metrics.ErrorsByType[errorType]++
+	return gin.H{
+		"gateway": gin.H{
+			"uptime_seconds":    time.Since(m.startTime).Seconds(),
+			"start_time":        m.startTime.UTC().Format(time.RFC3339),
+			"last_request_time": lastRequest,
+		},
+		"requests": gin.H{
+			"total":                    total,
+			"by_status":                byStatus,
+			"by_route":                 byRoute,
+			"by_tenant":                byTenant,
+			"average_response_time_ms": average(totalSeconds, total),
+		},
+		"errors": gin.H{
+			"total":   errors,
+			"by_type": errorsByType,
+		},
+		"rate_limiting": gin.H{
+			"total_hits": rateLimitHits,
+			"by_tenant":  rateLimitByTenant,
+		},
+		"backends": gin.H{
+			"requests":       backendRequests,
+			"errors":         backendErrors,
+			"response_times": responseTimes,
+		},
 	}
 }
 
+// Registry returns the registry the gateway's metrics are kept in
+func (m *MonitoringMiddleware) Registry() *MetricsRegistry {
+	return m.registry
+}
+
+// SetBackendStatus sets the source of backend pool state for the backend
+// gauges
+func (m *MonitoringMiddleware) SetBackendStatus(status func() []PoolStatus) {
+	m.backendStatus = status
+}
+
 // RecordRateLimitHit records a rate limit hit
-func (m *MonitoringMiddleware) RecordRateLimitHit(tenantID string) {
-	m.metrics.mu.Lock()
-	defer m.metrics.mu.Unlock()
-	
-	m.metrics.RateLimitHits++
-	if tenantID != "" {
-		m.metrics.RateLimitByTenant[tenantID]++
+func (m *MonitoringMiddleware) RecordRateLimitHit(route, tenantID string) {
+	m.rateLimitHits.Inc(route, m.tenantLabel(tenantID))
+}
+
+// RecordBackendError records a failed request to a backend
+func (m *MonitoringMiddleware) RecordBackendError(route, backendURL, reason string) {
+	m.backendErrors.Inc(route, backendURL, reason)
+}
+
+// RecordRetry records a request retried after a backend failed it
+func (m *MonitoringMiddleware) RecordRetry(route, backendURL string) {
+	m.backendRetries.Inc(route, backendURL)
+}
+
+// tenantLabel returns the tenant label value, "none" for requests without
+// a tenant
+func (m *MonitoringMiddleware) tenantLabel(tenantID string) string {
+	if tenantID == "" {
+		return "none"
 	}
+	return m.tenants.Value(tenantID)
 }
 
-// RecordBackendRequest records a backend request
-func (m *MonitoringMiddleware) RecordBackendRequest(backendURL string, latency time.Duration, success bool) {
-	m.metrics.mu.Lock()
-	defer m.metrics.mu.Unlock()
-	
-	m.metrics.BackendRequests[backendURL]++
-	m.metrics.BackendResponseTimes[backendURL] = latency
-	
-	if !success {
-		m.metrics.BackendErrors[backendURL]++
+// backendSamples returns one sample per backend. A backend in several
+// pools is reported once, with the values of the first pool listing it.
+func (m *MonitoringMiddleware) backendSamples(value func(BackendStatus) float64) []GaugeSample {
+	if m.backendStatus == nil {
+		return nil
+	}
+	var samples []GaugeSample
+	seen := make(map[string]bool)
+	for _, pool := range m.backendStatus() {
+		for _, backend := range pool.Backends {
+			if seen[backend.URL] {
+				continue
+			}
+			seen[backend.URL] = true
+			samples = append(samples, GaugeSample{Values: []string{backend.URL}, Value: value(backend)})
+		}
 	}
+	return samples
 }
 
-// calculateAverageResponseTime calculates average response time
-func (m *MonitoringMiddleware) calculateAverageResponseTime() time.Duration {
-	if len(m.metrics.ResponseTimes) == 0 {
-		return 0
+// circuitSamples returns a sample per backend and circuit state
+func (m *MonitoringMiddleware) circuitSamples() []GaugeSample {
+	if m.backendStatus == nil {
+		return nil
 	}
-	
-	var total time.Duration
-	for _, rt := range m.metrics.ResponseTimes {
-		total += rt
+	var samples []GaugeSample
+	seen := make(map[string]bool)
+	for _, pool := range m.backendStatus() {
+		for _, backend := range pool.Backends {
+			if seen[backend.URL] {
+				continue
+			}
+			seen[backend.URL] = true
+			for _, state := range []string{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+				samples = append(samples, GaugeSample{Values: []string{backend.URL, state}, Value: boolValue(backend.Circuit == state)})
+			}
+		}
 	}
-	
-	return total / time.Duration(len(m.metrics.ResponseTimes))
+	return samples
+}
+
+// routeLabel names a route in metrics. Tenant routes are built one per
+// tenant, so they share the "tenant" label; the tenant label tells them apart.
+func routeLabel(route *RouteConfig) string {
+	switch {
+	case route.Tenant != nil:
+		return "tenant"
+	case route.Description != "":
+		return route.Description
+	case route.PathPrefix != "":
+		return route.PathPrefix
+	case route.Host != "":
+		return route.Host
+	}
+	return "unnamed"
 }
 
-// formatBackendResponseTimes formats backend response times for JSON
-func (m *MonitoringMiddleware) formatBackendResponseTimes() map[string]int64 {
-	formatted := make(map[string]int64)
-	for backend, duration := range m.metrics.BackendResponseTimes {
-		formatted[backend] = duration.Milliseconds()
+// statusClass returns a status code's class, such as "2xx"
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "unknown"
 	}
-	return formatted
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 // logJSON logs in JSON format
@@ -325,74 +512,3 @@ func (m *MonitoringMiddleware) logText(entry map[string]interface{}) {
 		entry["user_agent"],
 	)
 }
-
-// GetMetrics returns current metrics (for external monitoring systems)
-func (m *MonitoringMiddleware) GetMetrics() *Metrics {
-	m.metrics.mu.RLock()
-	defer m.metrics.mu.RUnlock()
-	
-	// Return a copy to prevent concurrent access issues
-	metricsCopy := &Metrics{
-		TotalRequests:       m.metrics.TotalRequests,
-		RequestsByStatus:    make(map[int]int64),
-		RequestsByRoute:     make(map[string]int64),
-		RequestsByTenant:    make(map[string]int64),
-		TotalErrors:         m.metrics.TotalErrors,
-		ErrorsByType:        make(map[string]int64),
-		RateLimitHits:       m.metrics.RateLimitHits,
-		RateLimitByTenant:   make(map[string]int64),
-		BackendRequests:     make(map[string]int64),
-		BackendErrors:       make(map[string]int64),
-		BackendResponseTimes: make(map[string]time.Duration),
-		StartTime:           m.metrics.StartTime,
-		LastRequestTime:     m.metrics.LastRequestTime,
-	}
-	
-	// Copy maps
-	for k, v := range m.metrics.RequestsByStatus {
-		metricsCopy.RequestsByStatus[k] = v
-	}
-	for k, v := range m.metrics.RequestsByRoute {
-		metricsCopy.RequestsByRoute[k] = v
-	}
-	for k, v := range m.metrics.RequestsByTenant {
-		metricsCopy.RequestsByTenant[k] = v
-	}
-	for k, v := range m.metrics.ErrorsByType {
-		metricsCopy.ErrorsByType[k] = v
-	}
-	for k, v := range m.metrics.RateLimitByTenant {
-		metricsCopy.RateLimitByTenant[k] = v
-	}
-	for k, v := range m.metrics.BackendRequests {
-		metricsCopy.BackendRequests[k] = v
-	}
-	for k, v := range m.metrics.BackendErrors {
-		metricsCopy.BackendErrors[k] = v
-	}
-	for k, v := range m.metrics.BackendResponseTimes {
-		metricsCopy.BackendResponseTimes[k] = v
-	}
-	
-	return metricsCopy
-}
-
-// ResetMetrics resets all metrics (useful for testing)
-func (m *MonitoringMiddleware) ResetMetrics() {
-	m.metrics.mu.Lock()
-	defer m.metrics.mu.Unlock()
-	
-	m.metrics.TotalRequests = 0
-	m.metrics.RequestsByStatus = make(map[int]int64)
-	m.metrics.RequestsByRoute = make(map[string]int64)
-	m.metrics.RequestsByTenant = make(map[string]int64)
-	m.metrics.ResponseTimes = []time.Duration{}
-	m.metrics.TotalErrors = 0
-	m.metrics.ErrorsByType = make(map[string]int64)
-	m.metrics.RateLimitHits = 0
-	m.metrics.RateLimitByTenant = make(map[string]int64)
-	m.metrics.BackendRequests = make(map[string]int64)
-	m.metrics.BackendErrors = make(map[string]int64)
-	m.metrics.BackendResponseTimes = make(map[string]time.Duration)
-	m.metrics.StartTime = time.Now()
-}
@@ -1,20 +1,33 @@
 package gateway
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ProxyMiddleware handles request proxying to backend services
 type ProxyMiddleware struct {
-	client *http.Client
+	client     *http.Client
+	pools      *BackendPools
+	monitor    BackendMonitor
+	websockets *webSocketTunnels
+}
+
+// BackendMonitor is told about failed and retried backend requests
+type BackendMonitor interface {
+	RecordBackendError(route, backendURL, reason string)
+	RecordRetry(route, backendURL string)
 }
 
 // NewProxyMiddleware creates a new proxy middleware
@@ -28,16 +41,33 @@ func NewProxyMiddleware() (*ProxyMiddleware, error) {
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
+		pools:      NewBackendPools(),
+		websockets: newWebSocketTunnels(),
 	}, nil
 }
 
-// ProxyRequest proxies the request to the backend service
+// SetMonitor sets the monitor told about backend failures
+func (p *ProxyMiddleware) SetMonitor(monitor BackendMonitor) {
+	p.monitor = monitor
+}
+
+// Pools returns the backend pools requests are balanced over
+func (p *ProxyMiddleware) Pools() *BackendPools {
+	return p.pools
+}
+
+// ProxyRequest proxies the request to the backend service. Responses of
+// unknown length, such as chunked responses and server-sent events, are
+// flushed to the client as each part arrives.
 func (p *ProxyMiddleware) ProxyRequest(c *gin.Context, route *RouteConfig) {
-	// Select backend URL (for load balancing)
-	backendURL := p.selectBackendURL(route)
-	
-	// Parse backend URL
-	target, err := url.Parse(backendURL)
+	p.serve(c, route, nil)
+}
+
+// serve proxies the request, letting upgrade take over a backend's 101
+// response before it's copied to the client
+func (p *ProxyMiddleware) serve(c *gin.Context, route *RouteConfig, upgrade func(resp *http.Response) error) {
+	// Backends are picked from the route's pool for each attempt
+	pool, err := p.pools.Pool(&route.Backend)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Invalid backend URL",
@@ -45,56 +75,63 @@ func (p *ProxyMiddleware) ProxyRequest(c *gin.Context, route *RouteConfig) {
 		return
 	}
 	
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(target)
-	
-	// Customize the proxy director
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		p.modifyRequest(req, route, c)
-	}
-	
-	// Customize error handler
-	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
-		p.handleProxyError(c, err, route)
+	// The route timeout covers every attempt until the response headers
+	// arrive. It cancels this request's context only, so concurrent requests
+	// on other routes keep their own timeouts.
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	defer cancel(nil)
+	transport := &retryTransport{
+		transport: p.client.Transport,
+		pool:      pool,
+		route:     route,
+		c:         c,
+		key:       p.balanceKey(c, route),
+		monitor:   p.monitor,
 	}
-	
-	// Customize response modifier
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		return p.modifyResponse(resp, route, c)
-	}
-	
-	// Set timeout for this specific route
 	if route.Backend.Timeout > 0 {
-		p.client.Timeout = route.Backend.Timeout
+		transport.timer = time.AfterFunc(route.Backend.Timeout, func() { cancel(errBackendTimeout) })
+		defer transport.timer.Stop()
+	}
+	defer transport.done()
+	
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Director: func(req *http.Request) {
+			if _, ok := req.Header["User-Agent"]; !ok {
+				// Don't let the backend client add its default User-Agent
+				req.Header.Set("User-Agent", "")
+			}
+			p.modifyRequest(req, route, c)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			p.handleProxyError(c, err, route)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if err := p.modifyResponse(resp, route, c); err != nil {
+				return err
+			}
+			if upgrade != nil && resp.StatusCode == http.StatusSwitchingProtocols {
+				return upgrade(resp)
+			}
+			return nil
+		},
 	}
 	
 	// Proxy the request
-	proxy.ServeHTTP(c.Writer, c.Request)
+	proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
 }
 
-// selectBackendURL selects a backend URL for load balancing
-func (p *ProxyMiddleware) selectBackendURL(route *RouteConfig) string {
-	// If only one URL, return it
-	if route.Backend.URL != "" && len(route.Backend.URLs) == 0 {
-		return route.Backend.URL
-	}
-	
-	// If multiple URLs, implement load balancing
-	urls := route.Backend.URLs
-	if route.Backend.URL != "" {
-		urls = append([]string{route.Backend.URL}, urls...)
+// balanceKey returns the key consistent hashing balances on: the tenant
+func (p *ProxyMiddleware) balanceKey(c *gin.Context, route *RouteConfig) string {
+	if route.Tenant != nil {
+		return route.Tenant.ID
 	}
-	
-	if len(urls) == 0 {
-		return ""
+	if tenantID, exists := c.Get("tenant_id"); exists {
+		if id, ok := tenantID.(string); ok && id != "" {
+			return id
+		}
 	}
-	
-	// Simple round-robin for now
-	// In production, you'd want more sophisticated load balancing
-	index := int(time.Now().UnixNano()) % len(urls)
-	return urls[index]
+	return c.GetHeader("X-Tenant-ID")
 }
 
 // modifyRequest modifies the outgoing request
@@ -132,6 +169,15 @@ func (p *ProxyMiddleware) modifyRequest(req *http.Request, route *RouteConfig, c
 		c.Set("transformed_path", transformedPath)
 	}
 	
+	// Rewrite the path with the route's rewrite_path or path_pattern
+	if route.Transform != nil {
+		if rewritten := route.Transform.rewritePath(req.URL.Path); rewritten != req.URL.Path {
+			req.URL.Path = rewritten
+			req.URL.RawPath = ""
+			c.Set("transformed_path", rewritten)
+		}
+	}
+	
 	// Apply header transformations from route configuration
 	if route.Transform != nil {
 		// Remove headers first
@@ -139,9 +185,19 @@ func (p *ProxyMiddleware) modifyRequest(req *http.Request, route *RouteConfig, c
 			req.Header.Del(headerName)
 		}
 		
-		// Add headers
+		// Add headers, filling in their templates. A header whose templates
+		// have no value is removed rather than left to the client.
 		for headerName, headerValue := range route.Transform.AddHeaders {
-			req.Header.Set(headerName, headerValue)
+			if value := renderTemplate(headerValue, c, route); value != "" {
+				req.Header.Set(headerName, value)
+			} else {
+				req.Header.Del(headerName)
+			}
+		}
+		
+		// Responses are reshaped as plain JSON
+		if route.Transform.ResponseEnvelope != nil {
+			req.Header.Del("Accept-Encoding")
 		}
 	}
 	
@@ -159,6 +215,11 @@ func (p *ProxyMiddleware) modifyRequest(req *http.Request, route *RouteConfig, c
 		req.Header.Set("X-Tenant-ID", tenantID.(string))
 	}
 	
+	// Tenant routes serve exactly one tenant, whatever the client sent
+	if route.Tenant != nil {
+		req.Header.Set("X-Tenant-ID", route.Tenant.ID)
+	}
+	
 	if userRoles, exists := c.Get("user_roles"); exists {
 		roles := userRoles.([]string)
 		req.Header.Set("X-User-Roles", strings.Join(roles, ","))
@@ -169,13 +230,15 @@ func (p *ProxyMiddleware) modifyRequest(req *http.Request, route *RouteConfig, c
 		req.Header.Set("X-Request-ID", requestID)
 	} else {
 		// Generate request ID if not present
-		requestID = p.generateRequestID()
+		requestID = generateRequestID(c.Request.Context())
 		req.Header.Set("X-Request-ID", requestID)
 		c.Header("X-Request-ID", requestID)
+		c.Set("request_id", requestID)
 	}
 	
 	// Remove hop-by-hop headers
 	p.removeHopByHopHeaders(req.Header)
+	p.keepUpgrade(req.Header, c.Request.Header)
 	
 	// Apply route-specific transformations (already applied by transform middleware)
 	// This is where you could add additional backend-specific modifications
@@ -196,7 +259,16 @@ func (p *ProxyMiddleware) modifyResponse(resp *http.Response, route *RouteConfig
 	resp.Header.Del("X-Powered-By")
 	
 	// Remove hop-by-hop headers
+	upgraded := resp.Header.Clone()
 	p.removeHopByHopHeaders(resp.Header)
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		p.keepUpgrade(resp.Header, upgraded)
+	}
+	
+	// Apply the route's response transformations
+	if route.Transform != nil {
+		transformResponse(resp, route.Transform, c, route)
+	}
 	
 	return nil
 }
@@ -210,7 +282,16 @@ func (p *ProxyMiddleware) handleProxyError(c *gin.Context, err error, route *Rou
 	var statusCode int
 	var message string
 	
-	if strings.Contains(err.Error(), "timeout") {
+	code := "BACKEND_ERROR"
+	if errors.Is(err, errWebSocketsClosed) {
+		statusCode = http.StatusServiceUnavailable
+		message = "Gateway is shutting down"
+		code = "SHUTTING_DOWN"
+	} else if errors.Is(err, errCircuitOpen) {
+		statusCode = http.StatusServiceUnavailable
+		message = "Backend service unavailable"
+		code = "CIRCUIT_OPEN"
+	} else if errors.Is(err, errBackendTimeout) || errors.Is(err, errTryTimeout) || strings.Contains(err.Error(), "timeout") {
 		statusCode = http.StatusGatewayTimeout
 		message = "Backend service timeout"
 	} else if strings.Contains(err.Error(), "connection refused") {
@@ -221,26 +302,13 @@ func (p *ProxyMiddleware) handleProxyError(c *gin.Context, err error, route *Rou
 		message = "Backend service error"
 	}
 	
-	// Check if we should retry with another backend
-	if p.shouldRetry(route, err) {
-		// Implement retry logic here
-		// For now, just return error
-	}
-	
 	c.JSON(statusCode, gin.H{
 		"error":   "Gateway Error",
 		"message": message,
-		"code":    "BACKEND_ERROR",
+		"code":    code,
 	})
 }
 
-// shouldRetry determines if request should be retried
-func (p *ProxyMiddleware) shouldRetry(route *RouteConfig, err error) bool {
-	// Implement retry logic based on error type and route configuration
-	// For now, return false
-	return false
-}
-
 // removeHopByHopHeaders removes headers that shouldn't be forwarded
 func (p *ProxyMiddleware) removeHopByHopHeaders(headers http.Header) {
 	hopByHopHeaders := []string{
@@ -259,6 +327,28 @@ func (p *ProxyMiddleware) removeHopByHopHeaders(headers http.Header) {
 	}
 }
 
+// keepUpgrade restores a protocol upgrade removed with the other hop-by-hop
+// headers. The reverse proxy switches protocols only when the request and the
+// backend's 101 response both name the upgrade.
+func (p *ProxyMiddleware) keepUpgrade(headers, original http.Header) {
+	if upgrade := original.Get("Upgrade"); upgrade != "" && headerHasToken(original, "Connection", "upgrade") {
+		headers.Set("Connection", "Upgrade")
+		headers.Set("Upgrade", upgrade)
+	}
+}
+
+// headerHasToken reports whether a comma-separated header lists a token
+func headerHasToken(headers http.Header, name, token string) bool {
+	for _, value := range headers.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // getScheme determines the request scheme
 func (p *ProxyMiddleware) getScheme(c *gin.Context) string {
 	if c.Request.TLS != nil {
@@ -273,11 +363,24 @@ func (p *ProxyMiddleware) getScheme(c *gin.Context) string {
 	return "http"
 }
 
-// generateRequestID generates a unique request ID
-func (p *ProxyMiddleware) generateRequestID() string {
-	// Simple request ID generation
-	// In production, use a more robust method (UUID, etc.)
-	return fmt.Sprintf("req_%d", time.Now().UnixNano())
+// generateRequestID generates a unique request ID: the trace ID of a traced
+// request, so logs and traces can be joined, or 16 random bytes in hex
+func generateRequestID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceID().String()
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// requestID returns the request's ID, as sent by the client or generated by
+// the proxy
+func requestID(c *gin.Context) string {
+	if id := c.GetHeader("X-Request-ID"); id != "" {
+		return id
+	}
+	return c.GetString("request_id")
 }
 
 // HealthCheckBackend checks if a backend is healthy
@@ -298,11 +401,28 @@ func (p *ProxyMiddleware) HealthCheckBackend(backendURL, healthPath string) erro
 	return nil
 }
 
-// ProxyWebSocket handles WebSocket proxying (for real-time features)
-func (p *ProxyMiddleware) ProxyWebSocket(c *gin.Context, route *RouteConfig) {
-	// WebSocket proxy implementation would go here
-	// This is more complex and would require gorilla/websocket or similar
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "WebSocket proxying not yet implemented",
+// ProxyWebSocket proxies a WebSocket handshake to the backend. Once the
+// backend switches protocols, frames are passed both ways until either side
+// closes the connection, it has been idle for the config's idle timeout, or
+// the gateway shuts down.
+func (p *ProxyMiddleware) ProxyWebSocket(c *gin.Context, route *RouteConfig, config *WebSocketConfig) {
+	if !isWebSocketUpgrade(c.Request) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Expected a WebSocket upgrade request",
+		})
+		return
+	}
+	
+	var tunnel *webSocketTunnel
+	p.serve(c, route, func(resp *http.Response) error {
+		var err error
+		tunnel, err = p.upgradeWebSocket(resp, *config)
+		return err
 	})
+	
+	// The reverse proxy returns once the client's connection has closed
+	if tunnel != nil {
+		tunnel.close()
+		<-tunnel.done
+	}
 }
@@ -1,8 +1,12 @@
 package gateway
 
 import (
+	"bufio"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -464,3 +468,119 @@ func TestProxyMiddleware_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// newProxyTestGateway serves every request through ProxyWebSocket or
+// ProxyRequest, like the gateway's proxy handler
+func newProxyTestGateway(t *testing.T, backendURL string) *httptest.Server {
+	server, _ := newWebSocketTestGateway(t, backendURL, &WebSocketConfig{})
+	return server
+}
+
+// newWebSocketTestGateway is newProxyTestGateway with WebSocket settings,
+// also returning the proxy
+func newWebSocketTestGateway(t *testing.T, backendURL string, websocket *WebSocketConfig) (*httptest.Server, *ProxyMiddleware) {
+	gin.SetMode(gin.TestMode)
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+
+	route := &RouteConfig{PathPrefix: "/api", Backend: BackendConfig{URL: backendURL}}
+	router := gin.New()
+	router.NoRoute(func(c *gin.Context) {
+		c.Set("tenant_id", "tenant456")
+		if isWebSocketUpgrade(c.Request) {
+			proxy.ProxyWebSocket(c, route, websocket)
+			return
+		}
+		proxy.ProxyRequest(c, route)
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, proxy
+}
+
+func TestProxyMiddleware_WebSocket(t *testing.T) {
+	// The backend completes the upgrade and echoes messages back, prefixed
+	// with the tenant the gateway forwarded
+	backend := newWebSocketBackend(t, func(r *http.Request, message string) string {
+		return r.Header.Get("X-Tenant-ID") + ":" + message
+	})
+	server := newProxyTestGateway(t, backend.URL)
+
+	conn, reader, resp := dialWebSocket(t, server.URL, "/api/items/_changes", nil)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+
+	// The tunnel stays open for several exchanges
+	for _, message := range []string{"hello", "again"} {
+		writeTestFrame(t, conn, 0x1, []byte(message), true)
+		opcode, payload := readTestFrame(t, reader)
+		assert.Equal(t, byte(0x1), opcode)
+		assert.Equal(t, "tenant456:"+message, string(payload))
+	}
+}
+
+func TestProxyMiddleware_WebSocketRequiresUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/items/_changes", nil)
+	proxy.ProxyWebSocket(c, &RouteConfig{Backend: BackendConfig{URL: "http://backend:8080"}}, &WebSocketConfig{})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProxyMiddleware_StreamsServerSentEvents(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\ndata: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "id: 2\ndata: second\n\n")
+	}))
+	defer backend.Close()
+	defer close(release)
+	server := newProxyTestGateway(t, backend.URL)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + "/api/items/_changes")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// The first event arrives while the backend is still holding the stream open
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []string{"id: 1\n", "data: first\n"} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, expected, line)
+	}
+}
+
+func TestProxyMiddleware_StreamsChunkedResponses(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"id\":1}\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "{\"id\":2}\n")
+	}))
+	defer backend.Close()
+	defer close(release)
+	server := newProxyTestGateway(t, backend.URL)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + "/api/items/export")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+	// The first chunk arrives while the backend is still writing the rest
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "{\"id\":1}\n", line)
+}
@@ -0,0 +1,311 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota response headers, set on requests of tenants whose plan limits
+// requests per month
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"
+	QuotaRemainingHeader = "X-Quota-Remaining"
+	QuotaResetHeader     = "X-Quota-Reset"
+)
+
+// Context keys marking a request for metering
+const (
+	quotaTenantKey   = "quota_tenant"
+	quotaRejectedKey = "quota_rejected"
+)
+
+// QuotaMiddleware enforces the quotas of tenant plans and meters each
+// tenant's usage per day
+type QuotaMiddleware struct {
+	store UsageStore
+	now   func() time.Time
+}
+
+// NewQuotaMiddleware creates a quota middleware keeping usage in store
+func NewQuotaMiddleware(store UsageStore) *QuotaMiddleware {
+	return &QuotaMiddleware{store: store, now: time.Now}
+}
+
+// Handler enforces the quota of the plan of the request's tenant; requests
+// without a tenant pass. Once a tenant's reported storage or entities reach
+// its plan's limits, writes are refused with 403; once its month's requests
+// do, every request is refused with 429 until the next month. Requests are
+// let through when the usage store can't be reached.
+func (q *QuotaMiddleware) Handler(config *QuotaConfig, planFor func(tenantID string) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := c.GetString("tenant_id")
+		if tenantID == "" {
+			c.Next()
+			return
+		}
+		quota := config.Plans[planFor(tenantID)]
+		ctx := c.Request.Context()
+
+		if code, message := q.checkResources(ctx, c.Request.Method, tenantID, quota); code != "" {
+			c.Set(quotaTenantKey, tenantID)
+			c.Set(quotaRejectedKey, true)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Quota exceeded",
+				"message": message,
+				"code":    code,
+			})
+			return
+		}
+
+		now := q.now()
+		count, counted, err := q.store.CountRequest(ctx, tenantID, now, quota.RequestsPerMonth)
+		if err != nil {
+			log.Printf("Failed to count request of tenant %s against its quota, allowing it: %v", tenantID, err)
+			c.Next()
+			return
+		}
+		c.Set(quotaTenantKey, tenantID)
+
+		if quota.RequestsPerMonth > 0 {
+			reset := startOfMonth(now).AddDate(0, 1, 0)
+			c.Header(QuotaLimitHeader, strconv.FormatInt(quota.RequestsPerMonth, 10))
+			c.Header(QuotaRemainingHeader, strconv.FormatInt(quota.RequestsPerMonth-count, 10))
+			c.Header(QuotaResetHeader, strconv.FormatInt(reset.Unix(), 10))
+
+			if !counted {
+				retryAfter := int64(reset.Sub(now).Seconds()) + 1
+				c.Set(quotaRejectedKey, true)
+				c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+					"error":       "Quota exceeded",
+					"message":     "This workspace has used the requests its plan allows this month.",
+					"code":        "QUOTA_EXCEEDED",
+					"retry_after": retryAfter,
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// checkResources returns an error code and message when the request is a
+// write the tenant's storage or entities quota doesn't leave room for.
+// Only creates (POST) are held to the entities quota.
+func (q *QuotaMiddleware) checkResources(ctx context.Context, method, tenantID string, quota PlanQuota) (string, string) {
+	creates := method == http.MethodPost
+	writes := creates || method == http.MethodPut || method == http.MethodPatch
+	if !writes || (quota.StorageBytes == 0 && (quota.Entities == 0 || !creates)) {
+		return "", ""
+	}
+
+	resources, err := q.store.Resources(ctx, tenantID)
+	if err != nil {
+		log.Printf("Failed to read resources of tenant %s, allowing the write: %v", tenantID, err)
+		return "", ""
+	}
+	if quota.StorageBytes > 0 && resources.StorageBytes >= quota.StorageBytes {
+		return "STORAGE_QUOTA_EXCEEDED", "This workspace has used the storage its plan allows."
+	}
+	if creates && quota.Entities > 0 && resources.Entities >= quota.Entities {
+		return "ENTITY_QUOTA_EXCEEDED", "This workspace has reached the number of records its plan allows."
+	}
+	return "", ""
+}
+
+// Meter adds a request to its tenant's daily usage once the response has
+// been written. Only requests that reached the quota check are metered.
+func (q *QuotaMiddleware) Meter(c *gin.Context) {
+	if q == nil {
+		return
+	}
+	tenantID := c.GetString(quotaTenantKey)
+	if tenantID == "" {
+		return
+	}
+
+	var usage DailyUsage
+	if c.GetBool(quotaRejectedKey) {
+		usage.Rejected = 1
+	} else {
+		usage.Requests = 1
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			usage.Errors = 1
+		}
+		if c.Request.ContentLength > 0 {
+			usage.BytesIn = c.Request.ContentLength
+		}
+		if size := c.Writer.Size(); size > 0 {
+			usage.BytesOut = int64(size)
+		}
+	}
+
+	// The client may be gone by now, so the request's context isn't used
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := q.store.Record(ctx, tenantID, q.now(), usage); err != nil {
+		log.Printf("Failed to record usage of tenant %s: %v", tenantID, err)
+	}
+}
+
+// UsageReport is a tenant's usage and remaining quota for a month.
+// Storage and entities are the latest reported, whatever the month.
+type UsageReport struct {
+	TenantID  string         `json:"tenant_id"`
+	Plan      string         `json:"plan"`
+	Month     string         `json:"month"` // YYYY-MM, UTC
+	Quota     PlanQuota      `json:"quota"` // Zero means unlimited
+	Usage     QuotaUsage     `json:"usage"`
+	Remaining QuotaRemaining `json:"remaining"`
+	ResetsAt  time.Time      `json:"resets_at"`
+
+	// When the platform last reported storage and entities
+	ResourcesReportedAt *time.Time `json:"resources_reported_at,omitempty"`
+
+	Daily []DailyUsage `json:"daily"`
+}
+
+// QuotaUsage is what a tenant has used of each quota
+type QuotaUsage struct {
+	Requests     int64 `json:"requests"`
+	StorageBytes int64 `json:"storage_bytes"`
+	Entities     int64 `json:"entities"`
+}
+
+// QuotaRemaining is what a tenant has left of each quota; nil means the
+// plan doesn't limit it
+type QuotaRemaining struct {
+	Requests     *int64 `json:"requests"`
+	StorageBytes *int64 `json:"storage_bytes"`
+	Entities     *int64 `json:"entities"`
+}
+
+// Report builds the tenant's usage report for the month of month
+func (q *QuotaMiddleware) Report(ctx context.Context, config *QuotaConfig, tenantID, plan string, month time.Time) (*UsageReport, error) {
+	start := startOfMonth(month)
+	end := start.AddDate(0, 1, -1)
+	if now := q.now(); end.After(now) {
+		end = now
+	}
+
+	requests, err := q.store.MonthRequests(ctx, tenantID, start)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := q.store.Resources(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	daily := []DailyUsage{}
+	if !start.After(end) {
+		if daily, err = q.store.Daily(ctx, tenantID, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	quota := config.Plans[plan]
+	report := &UsageReport{
+		TenantID: tenantID,
+		Plan:     plan,
+		Month:    start.Format(usageMonthLayout),
+		Quota:    quota,
+		Usage: QuotaUsage{
+			Requests:     requests,
+			StorageBytes: resources.StorageBytes,
+			Entities:     resources.Entities,
+		},
+		Remaining: QuotaRemaining{
+			Requests:     remainingQuota(quota.RequestsPerMonth, requests),
+			StorageBytes: remainingQuota(quota.StorageBytes, resources.StorageBytes),
+			Entities:     remainingQuota(quota.Entities, resources.Entities),
+		},
+		ResetsAt: start.AddDate(0, 1, 0),
+		Daily:    daily,
+	}
+	if !resources.UpdatedAt.IsZero() {
+		report.ResourcesReportedAt = &resources.UpdatedAt
+	}
+	return report, nil
+}
+
+// remainingQuota returns what is left of limit, or nil when there's no limit
+func remainingQuota(limit, used int64) *int64 {
+	if limit == 0 {
+		return nil
+	}
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// tenantPlan returns the plan of the tenant: that of the route's tenant,
+// else that of the tenant's record, else the default plan
+func (g *Gateway) tenantPlan(config *QuotaConfig, route *RouteConfig, tenantID string) string {
+	var tenant *Tenant
+	if route != nil && route.Tenant != nil && route.Tenant.ID == tenantID {
+		tenant = route.Tenant
+	} else {
+		g.tenantMu.Lock()
+		tenants := g.tenants
+		g.tenantMu.Unlock()
+		if tenants != nil {
+			tenant = tenants.Tenant(tenantID)
+		}
+	}
+	if tenant != nil && tenant.Plan != "" {
+		return tenant.Plan
+	}
+	return config.DefaultPlan
+}
+
+// handleUsage reports a tenant's usage and remaining quota for the current
+// month, or for the month given as ?month=YYYY-MM
+func (g *Gateway) handleUsage(c *gin.Context) {
+	month := time.Now().UTC()
+	if value := c.Query("month"); value != "" {
+		parsed, err := time.Parse(usageMonthLayout, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be given as YYYY-MM"})
+			return
+		}
+		month = parsed
+	}
+
+	config := &g.current().config.Quotas
+	tenantID := c.Param("tenant")
+	report, err := g.quotas.Report(c.Request.Context(), config, tenantID, g.tenantPlan(config, nil, tenantID), month)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to read usage", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// handleReportResources records the storage and entities a tenant uses, as
+// reported by the platform
+func (g *Gateway) handleReportResources(c *gin.Context) {
+	var resources ResourceUsage
+	if err := c.ShouldBindJSON(&resources); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource usage", "message": err.Error()})
+		return
+	}
+	if resources.StorageBytes < 0 || resources.Entities < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource usage", "message": "storage_bytes and entities must be positive"})
+		return
+	}
+	resources.UpdatedAt = time.Now().UTC()
+
+	if err := g.quotas.store.SetResources(c.Request.Context(), c.Param("tenant"), resources); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to record resource usage", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resources)
+}
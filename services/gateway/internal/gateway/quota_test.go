@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const quotaConfig = `
+port: "8000"
+auth:
+  enabled: true
+  required: true
+  header_name: "Authorization"
+  jwt_secret: "secret"
+quotas:
+  enabled: true
+  plans:
+    free:
+      requests_per_month: 2
+      storage_bytes: 1000
+      entities: 10
+    pro:
+      requests_per_month: 0
+routes:
+  - description: "API"
+    path_prefix: "/api"
+    backend:
+      url: "BACKEND"
+    enabled: true
+`
+
+func TestQuotas(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(backend.Close)
+
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, strings.Replace(quotaConfig, "BACKEND", backend.URL, 1))
+	g := newReloadTestGateway(t, path)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	g.quotas.now = func() time.Time { return now }
+
+	// Tenant t-pro's plan comes from its tenant record
+	g.tenants = NewTenantRegistry(&TenantRoutingConfig{}, nil)
+	g.tenants.apply(&tenantChange{Action: "created", ID: "t-pro", Data: map[string]interface{}{"id": "t-pro", "plan": "pro"}})
+
+	token := func(tenantID string, roles ...string) string {
+		token, err := GenerateToken("u1", "user@example.com", tenantID, roles, nil, "secret", time.Hour)
+		require.NoError(t, err)
+		return token
+	}
+	admin := token("system", "platform_admin")
+	request := func(method, path, tenantToken, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tenantToken)
+		g.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("RequestsPerMonth", func(t *testing.T) {
+		free := token("t-free")
+
+		w := request("GET", "/api/items", free, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get(QuotaLimitHeader))
+		assert.Equal(t, "1", w.Header().Get(QuotaRemainingHeader))
+		assert.Equal(t, "1793491200", w.Header().Get(QuotaResetHeader)) // 2026-11-01
+
+		w = request("POST", "/api/fail", free, `{"name":"x"}`)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "0", w.Header().Get(QuotaRemainingHeader))
+
+		w = request("GET", "/api/items", free, "")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "QUOTA_EXCEEDED")
+		assert.Equal(t, "1166401", w.Header().Get("Retry-After"))
+
+		// Other tenants have their own quota, and the pro plan has none
+		assert.Equal(t, http.StatusOK, request("GET", "/api/items", token("t-other"), "").Code)
+		for i := 0; i < 3; i++ {
+			w = request("GET", "/api/items", token("t-pro"), "")
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get(QuotaLimitHeader))
+		}
+
+		// The quota resets with the month
+		now = now.AddDate(0, 1, 0)
+		defer func() { now = now.AddDate(0, -1, 0) }()
+		assert.Equal(t, http.StatusOK, request("GET", "/api/items", free, "").Code)
+	})
+
+	t.Run("Resources", func(t *testing.T) {
+		tenant := token("t-full")
+		w := request("PUT", AdminPath+"/usage/t-full/resources", admin, `{"storage_bytes": 100, "entities": 10}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// At the entities quota, only creates are refused
+		w = request("POST", "/api/items", tenant, "{}")
+		require.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "ENTITY_QUOTA_EXCEEDED")
+		assert.Equal(t, http.StatusOK, request("PUT", "/api/items/1", tenant, "{}").Code)
+
+		// At the storage quota, every write is refused
+		w = request("PUT", AdminPath+"/usage/t-full/resources", admin, `{"storage_bytes": 1000, "entities": 1}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = request("PUT", "/api/items/1", tenant, "{}")
+		require.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "STORAGE_QUOTA_EXCEEDED")
+
+		w = request("PUT", AdminPath+"/usage/t-full/resources", admin, `{"storage_bytes": -1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		w := request("GET", AdminPath+"/usage/t-free", admin, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report UsageReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, "free", report.Plan)
+		assert.Equal(t, "2026-10", report.Month)
+		assert.Equal(t, int64(2), report.Usage.Requests)
+		require.NotNil(t, report.Remaining.Requests)
+		assert.Equal(t, int64(0), *report.Remaining.Requests)
+		assert.Equal(t, int64(1000), *report.Remaining.StorageBytes)
+		assert.Nil(t, report.ResourcesReportedAt)
+		require.Len(t, report.Daily, 1)
+		assert.Equal(t, DailyUsage{Date: "2026-10-18", Requests: 2, Errors: 1, Rejected: 1, BytesIn: 12, BytesOut: 2}, report.Daily[0])
+
+		w = request("GET", AdminPath+"/usage/t-full", admin, "")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, int64(1000), report.Usage.StorageBytes)
+		assert.Equal(t, int64(0), *report.Remaining.StorageBytes)
+		assert.NotNil(t, report.ResourcesReportedAt)
+
+		// Unlimited quotas have nothing remaining to report
+		w = request("GET", AdminPath+"/usage/t-pro", admin, "")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, "pro", report.Plan)
+		assert.Equal(t, int64(3), report.Usage.Requests)
+		assert.Nil(t, report.Remaining.Requests)
+
+		w = request("GET", AdminPath+"/usage/t-free?month=2026-09", admin, "")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, int64(0), report.Usage.Requests)
+		assert.Empty(t, report.Daily)
+
+		assert.Equal(t, http.StatusBadRequest, request("GET", AdminPath+"/usage/t-free?month=october", admin, "").Code)
+		assert.Equal(t, http.StatusForbidden, request("GET", AdminPath+"/usage/t-free", token("t-free"), "").Code)
+	})
+}
+
+func TestMemoryUsageStore(t *testing.T) {
+	testUsageStore(t, NewMemoryUsageStore())
+}
+
+func TestPostgresUsageStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil || db.Ping() != nil {
+		t.Skip("Database not accessible for testing")
+	}
+	// One connection, so the test schema stays on the search path
+	db.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("gateway_usage_test_%d", time.Now().UnixNano())
+	_, err = db.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+
+	ctx := context.Background()
+	store := NewPostgresUsageStore(db, 30*24*time.Hour)
+	require.NoError(t, store.Migrate(ctx))
+	testUsageStore(t, store)
+
+	// Resources are replaced, not added to
+	updated := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetResources(ctx, "t1", ResourceUsage{StorageBytes: 5, Entities: 1, UpdatedAt: updated}))
+	require.NoError(t, store.SetResources(ctx, "t1", ResourceUsage{StorageBytes: 7, Entities: 2, UpdatedAt: updated}))
+	resources, err := store.Resources(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, ResourceUsage{StorageBytes: 7, Entities: 2, UpdatedAt: updated}, resources)
+
+	// Days that ended more than the retention period ago are pruned
+	require.NoError(t, store.Prune(ctx, time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)))
+	daily, err := store.Daily(ctx, "t1", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []DailyUsage{{Date: "2026-02-02", Rejected: 1}}, daily)
+}
+
+// testUsageStore checks the UsageStore contract against store
+func testUsageStore(t *testing.T, store UsageStore) {
+	ctx := context.Background()
+	day := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+
+	count, counted, err := store.CountRequest(ctx, "t1", day, 1)
+	require.NoError(t, err)
+	assert.True(t, counted)
+	assert.Equal(t, int64(1), count)
+	count, counted, _ = store.CountRequest(ctx, "t1", day, 1)
+	assert.False(t, counted)
+	assert.Equal(t, int64(1), count)
+	_, counted, _ = store.CountRequest(ctx, "t1", day.Add(time.Hour), 1)
+	assert.True(t, counted, "February has its own count")
+
+	require.NoError(t, store.Record(ctx, "t1", day, DailyUsage{Requests: 1, BytesOut: 10}))
+	require.NoError(t, store.Record(ctx, "t1", day, DailyUsage{Requests: 1, Errors: 1}))
+	require.NoError(t, store.Record(ctx, "t1", day.AddDate(0, 0, 2), DailyUsage{Rejected: 1}))
+
+	daily, err := store.Daily(ctx, "t1", day.AddDate(0, 0, -1), day.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, []DailyUsage{
+		{Date: "2026-01-31", Requests: 2, Errors: 1, BytesOut: 10},
+		{Date: "2026-02-02", Rejected: 1},
+	}, daily)
+}
+
+func TestQuotaConfigValidation(t *testing.T) {
+	config := &Config{Port: "8080", JWTSecret: "secret"}
+	setDefaults(config)
+	assert.Equal(t, "free", config.Quotas.DefaultPlan)
+	assert.Equal(t, 400, config.Quotas.UsageRetentionDays)
+
+	config.Quotas.Plans = map[string]PlanQuota{"free": {RequestsPerMonth: -1}}
+	assert.Error(t, validateConfig(config))
+}
@@ -1,10 +1,13 @@
 package gateway
 
 import (
+	"container/list"
 	"context"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,112 +15,178 @@ import (
 	"golang.org/x/time/rate"
 )
 
-// RateLimitMiddleware handles rate limiting
+// Rate limiting algorithms. Both allow burst_size requests at once and
+// requests_per_minute on average; GCRA keeps one timestamp per key, the
+// token bucket a token count and a timestamp.
+const (
+	RateLimitGCRA        = "gcra"
+	RateLimitTokenBucket = "token_bucket"
+)
+
+// localLimiterCapacity is how many keys the local limiters used when Redis
+// can't be reached keep; the least recently used are dropped beyond it
+const localLimiterCapacity = 10000
+
+// RateLimitMiddleware handles rate limiting. Limits are kept in Redis, so
+// every gateway instance shares them; when Redis can't be reached, each
+// instance limits requests on its own.
 type RateLimitMiddleware struct {
 	redisClient *redis.Client
-	limiters    map[string]*rate.Limiter // In-memory limiters for fallback
+	local       *localLimiters
+	now         func() time.Time
+
+	// Open WebSocket connections by key
+	connMu      sync.Mutex
+	connections map[string]int
 }
 
-// NewRateLimitMiddleware creates a new rate limit middleware
-func NewRateLimitMiddleware(config *RateLimitConfig, redisClient *redis.Client) (*RateLimitMiddleware, error) {
+// NewRateLimitMiddleware creates a new rate limit middleware; limits are given
+// per route to Handler
+func NewRateLimitMiddleware(redisClient *redis.Client) (*RateLimitMiddleware, error) {
 	return &RateLimitMiddleware{
 		redisClient: redisClient,
-		limiters:    make(map[string]*rate.Limiter),
+		local:       newLocalLimiters(localLimiterCapacity),
+		now:         time.Now,
+		connections: make(map[string]int),
 	}, nil
 }
 
-// Handler returns the rate limit middleware handler
+// rateLimitCheck is one limit a request is held to
+type rateLimitCheck struct {
+	key   string
+	limit RateLimit
+}
+
+// rateLimitResult is the outcome of one limit for a request
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int           // Requests that could be made now
+	retryAfter time.Duration // Until a request would be allowed, when denied
+	resetAfter time.Duration // Until the full burst is available again
+}
+
+// Handler returns the rate limit middleware handler. A request is held to
+// the config's limit and to each of its rules, and is allowed only when it
+// is within all of them; a denied request uses up none of them.
 func (r *RateLimitMiddleware) Handler(config *RateLimitConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !config.Enabled {
 			c.Next()
 			return
 		}
-		
-		// Generate rate limit key
-		key := r.generateKey(c, config)
-		
-		// Get rate limit for this key
-		limit := r.getLimitForKey(c, config)
-		
-		// Check rate limit using Redis
-		allowed, remaining, resetTime, err := r.checkRateLimit(key, limit.RequestsPerMinute, limit.BurstSize)
+
+		checks := r.checksFor(c, config)
+		if len(checks) == 0 {
+			c.Next()
+			return
+		}
+
+		results, err := r.allowRedis(c.Request.Context(), config.Algorithm, checks)
 		if err != nil {
-			// Fallback to in-memory rate limiting
-			allowed = r.checkInMemoryRateLimit(key, limit.RequestsPerMinute, limit.BurstSize)
-			if !allowed {
-				r.sendRateLimitResponse(c, 0, 0, time.Now().Add(time.Minute))
-				return
-			}
-		} else {
-			// Set rate limit headers
-			c.Header("X-RateLimit-Limit", strconv.Itoa(limit.RequestsPerMinute))
-			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-			c.Header("X-RateLimit-Reset", strconv.FormatInt(resetTime.Unix(), 10))
-			
-			if !allowed {
-				r.sendRateLimitResponse(c, limit.RequestsPerMinute, remaining, resetTime)
-				return
+			results = r.local.allow(checks, r.now())
+		}
+
+		// The headers describe the limit closest to denying the request, or
+		// the one denying it for longest
+		allowed := true
+		tightest := 0
+		for i, result := range results {
+			switch {
+			case !result.allowed && (allowed || result.retryAfter > results[tightest].retryAfter):
+				allowed = false
+				tightest = i
+			case allowed && result.remaining < results[tightest].remaining:
+				tightest = i
 			}
 		}
-		
+		setRateLimitHeaders(c, checks[tightest].limit, results[tightest])
+
+		if !allowed {
+			r.sendRateLimitResponse(c, results[tightest].retryAfter)
+			return
+		}
+
 		c.Next()
 	}
 }
 
-// generateKey generates a rate limit key based on the strategy
+// checksFor returns the limits the request is held to: the config's own
+// limit, and each rule whose key the request has
+func (r *RateLimitMiddleware) checksFor(c *gin.Context, config *RateLimitConfig) []rateLimitCheck {
+	var checks []rateLimitCheck
+
+	if limit := r.getLimitForKey(c, config); limit.RequestsPerMinute > 0 {
+		checks = append(checks, rateLimitCheck{key: r.generateKey(c, config), limit: limit})
+	}
+
+	for i, rule := range config.Rules {
+		key := rateLimitKey(c, rule.KeyStrategy, rule.CustomKey)
+		if key == "" || rule.RequestsPerMinute <= 0 {
+			continue
+		}
+		checks = append(checks, rateLimitCheck{
+			key:   fmt.Sprintf("ratelimit:rule%d:%s", i, key),
+			limit: RateLimit{RequestsPerMinute: rule.RequestsPerMinute, BurstSize: rule.BurstSize},
+		})
+	}
+	return checks
+}
+
+// generateKey generates a rate limit key based on the strategy; requests
+// without the strategy's key are limited by IP
 func (r *RateLimitMiddleware) generateKey(c *gin.Context, config *RateLimitConfig) string {
-	switch config.KeyStrategy {
-	case "ip":
-		return "ratelimit:ip:" + c.ClientIP()
+	if key := rateLimitKey(c, config.KeyStrategy, config.CustomKey); key != "" {
+		return "ratelimit:" + key
+	}
+	return "ratelimit:ip:" + c.ClientIP()
+}
+
+// rateLimitKey returns the request's key for a key strategy, or "" when the
+// request has none, such as an anonymous request for the user strategy
+func rateLimitKey(c *gin.Context, strategy, customKey string) string {
+	switch strategy {
 	case "user":
-		if userID, exists := c.Get("user_id"); exists {
-			return "ratelimit:user:" + userID.(string)
+		if userID := c.GetString("user_id"); userID != "" {
+			return "user:" + userID
 		}
-		// Fallback to IP if no user
-		return "ratelimit:ip:" + c.ClientIP()
 	case "tenant":
-		if tenantID, exists := c.Get("tenant_id"); exists {
-			return "ratelimit:tenant:" + tenantID.(string)
+		if tenantID := c.GetString("tenant_id"); tenantID != "" {
+			return "tenant:" + tenantID
 		}
-		// Fallback to IP if no tenant
-		return "ratelimit:ip:" + c.ClientIP()
 	case "custom":
-		if config.CustomKey != "" {
-			// Extract custom key from headers, query params, etc.
-			if customValue := c.GetHeader(config.CustomKey); customValue != "" {
-				return "ratelimit:custom:" + customValue
-			}
-			if customValue := c.Query(config.CustomKey); customValue != "" {
-				return "ratelimit:custom:" + customValue
-			}
+		if customKey == "" {
+			return ""
+		}
+		// Extract custom key from headers, query params, etc.
+		if customValue := c.GetHeader(customKey); customValue != "" {
+			return "custom:" + customValue
+		}
+		if customValue := c.Query(customKey); customValue != "" {
+			return "custom:" + customValue
 		}
-		// Fallback to IP
-		return "ratelimit:ip:" + c.ClientIP()
 	default:
-		return "ratelimit:ip:" + c.ClientIP()
+		return "ip:" + c.ClientIP()
 	}
+	return ""
 }
 
 // getLimitForKey gets the appropriate rate limit for the request
 func (r *RateLimitMiddleware) getLimitForKey(c *gin.Context, config *RateLimitConfig) RateLimit {
 	// Check if user has specific limits based on roles/scopes
 	if userRoles, exists := c.Get("user_roles"); exists {
-		roles := userRoles.([]string)
+		roles, _ := userRoles.([]string)
 		for _, role := range roles {
 			if limit, ok := config.Limits[role]; ok {
 				return limit
 			}
 		}
 	}
-	
+
 	// Check tenant-specific limits
-	if tenantID, exists := c.Get("tenant_id"); exists {
-		if limit, ok := config.Limits[tenantID.(string)]; ok {
-			return limit
-		}
+	if limit, ok := config.Limits[c.GetString("tenant_id")]; ok {
+		return limit
 	}
-	
+
 	// Default limit
 	return RateLimit{
 		RequestsPerMinute: config.RequestsPerMinute,
@@ -125,82 +194,314 @@ func (r *RateLimitMiddleware) getLimitForKey(c *gin.Context, config *RateLimitCo
 	}
 }
 
-// checkRateLimit checks rate limit using Redis sliding window
-func (r *RateLimitMiddleware) checkRateLimit(key string, requestsPerMinute, burstSize int) (bool, int, time.Time, error) {
-	ctx := context.Background()
-	now := time.Now()
-	window := time.Minute
-	
-	// Use Redis sorted sets for sliding window rate limiting
-	pipe := r.redisClient.Pipeline()
-	
-	// Remove old entries outside the window
-	pipe.ZRemRangeByScore(ctx, key, "0", strconv.FormatInt(now.Add(-window).UnixNano(), 10))
-	
-	// Count current requests in window
-	pipe.ZCard(ctx, key)
-	
-	// Add current request
-	pipe.ZAdd(ctx, key, redis.Z{
-		Score:  float64(now.UnixNano()),
-		Member: fmt.Sprintf("%d", now.UnixNano()),
-	})
-	
-	// Set expiration
-	pipe.Expire(ctx, key, window+time.Second)
-	
-	results, err := pipe.Exec(ctx)
+// burst returns the requests allowed at once, which defaults to a minute's
+// worth
+func (l RateLimit) burst() int {
+	if l.BurstSize > 0 {
+		return l.BurstSize
+	}
+	return l.RequestsPerMinute
+}
+
+// interval returns the time one request's allowance takes to replenish
+func (l RateLimit) interval() time.Duration {
+	return time.Minute / time.Duration(l.RequestsPerMinute)
+}
+
+// gcraScript applies the generic cell rate algorithm to each key in KEYS,
+// whose emission interval and burst, in microseconds and requests, are in
+// ARGV. Each key holds its theoretical arrival time (TAT): the request is
+// allowed when now is no earlier than TAT + interval - burst * interval,
+// and only then are the keys' TATs advanced. For each key it returns
+// allowed (0 or 1), remaining, retry after and reset after (microseconds).
+// Timestamps are written with string.format, as Redis would otherwise
+// round them to 14 digits.
+var gcraScript = redis.NewScript(`
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+local allowed = 1
+local tats = {}
+local results = {}
+for i, key in ipairs(KEYS) do
+	local interval = tonumber(ARGV[i * 2 - 1])
+	local burst = tonumber(ARGV[i * 2])
+	local tat = tonumber(redis.call('GET', key) or now)
+	if tat < now then
+		tat = now
+	end
+	local allow_at = tat + interval - burst * interval
+	if now < allow_at then
+		allowed = 0
+		table.insert(results, {0, 0, allow_at - now, tat - now})
+	else
+		tats[i] = tat + interval
+		table.insert(results, {1, math.floor((now - allow_at) / interval), 0, tats[i] - now})
+	end
+end
+
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		redis.call('SET', key, string.format('%.0f', tats[i]), 'PX', math.ceil((tats[i] - now) / 1000))
+	end
+end
+
+local flat = {}
+for _, result in ipairs(results) do
+	for _, value in ipairs(result) do
+		table.insert(flat, value)
+	end
+end
+return flat
+`)
+
+// tokenBucketScript applies a token bucket to each key in KEYS, whose
+// refill interval per token and capacity, in microseconds and tokens, are
+// in ARGV. Each key holds its tokens and when they were counted; a request
+// takes a token from every bucket, and only when each has one. It returns
+// the same values as gcraScript.
+var tokenBucketScript = redis.NewScript(`
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+local allowed = 1
+local tokens = {}
+local results = {}
+for i, key in ipairs(KEYS) do
+	local interval = tonumber(ARGV[i * 2 - 1])
+	local capacity = tonumber(ARGV[i * 2])
+	local state = redis.call('HMGET', key, 'tokens', 'at')
+	local available = tonumber(state[1]) or capacity
+	local at = tonumber(state[2]) or now
+	available = math.min(capacity, available + math.max(0, now - at) / interval)
+	tokens[i] = available
+	if available < 1 then
+		allowed = 0
+		table.insert(results, {0, 0, math.ceil((1 - available) * interval), math.ceil((capacity - available) * interval)})
+	else
+		table.insert(results, {1, math.floor(available - 1), 0, math.ceil((capacity - available + 1) * interval)})
+	end
+end
+
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		local interval = tonumber(ARGV[i * 2 - 1])
+		local capacity = tonumber(ARGV[i * 2])
+		local left = tokens[i] - 1
+		redis.call('HSET', key, 'tokens', left, 'at', string.format('%.0f', now))
+		redis.call('PEXPIRE', key, math.ceil((capacity - left) * interval / 1000) + 1000)
+	end
+end
+
+local flat = {}
+for _, result in ipairs(results) do
+	for _, value in ipairs(result) do
+		table.insert(flat, value)
+	end
+end
+return flat
+`)
+
+// allowRedis checks every limit in one atomic script, taking the time from
+// Redis so gateway instances agree on it
+func (r *RateLimitMiddleware) allowRedis(ctx context.Context, algorithm string, checks []rateLimitCheck) ([]rateLimitResult, error) {
+	if r.redisClient == nil {
+		return nil, fmt.Errorf("redis is not configured")
+	}
+
+	script, suffix := gcraScript, ":gcra"
+	if algorithm == RateLimitTokenBucket {
+		script, suffix = tokenBucketScript, ":tb"
+	}
+	keys := make([]string, len(checks))
+	args := make([]interface{}, 0, len(checks)*2)
+	for i, check := range checks {
+		keys[i] = check.key + suffix
+		args = append(args, check.limit.interval().Microseconds(), check.limit.burst())
+	}
+
+	values, err := script.Run(ctx, r.redisClient, keys, args...).Int64Slice()
 	if err != nil {
-		return false, 0, time.Time{}, err
-	}
-	
-	// Get current count (before adding new request)
-	currentCount := results[1].(*redis.IntCmd).Val()
-	
-	// Check if within limit
-	allowed := currentCount < int64(requestsPerMinute)
-	remaining := int(int64(requestsPerMinute) - currentCount - 1)
-	if remaining < 0 {
-		remaining = 0
-	}
-	
-	resetTime := now.Add(window)
-	
-	return allowed, remaining, resetTime, nil
-}
-
-// checkInMemoryRateLimit fallback rate limiting using in-memory limiters
-func (r *RateLimitMiddleware) checkInMemoryRateLimit(key string, requestsPerMinute, burstSize int) bool {
-	// Get or create limiter for this key
-	limiter, exists := r.limiters[key]
-	if !exists {
-		// Create new limiter
-		limit := rate.Limit(float64(requestsPerMinute) / 60.0) // Convert per-minute to per-second
-		limiter = rate.NewLimiter(limit, burstSize)
-		r.limiters[key] = limiter
-	}
-	
-	return limiter.Allow()
+		return nil, err
+	}
+	if len(values) != len(checks)*4 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+
+	results := make([]rateLimitResult, len(checks))
+	for i := range results {
+		v := values[i*4 : i*4+4]
+		results[i] = rateLimitResult{
+			allowed:    v[0] == 1,
+			remaining:  int(v[1]),
+			retryAfter: time.Duration(v[2]) * time.Microsecond,
+			resetAfter: time.Duration(v[3]) * time.Microsecond,
+		}
+	}
+	return results, nil
+}
+
+// setRateLimitHeaders sets the RateLimit headers of the IETF draft for a
+// limit: RateLimit-Limit is its burst, RateLimit-Remaining the requests
+// that could be made now and RateLimit-Reset the seconds until the full
+// burst is available again
+func setRateLimitHeaders(c *gin.Context, limit RateLimit, result rateLimitResult) {
+	c.Header("RateLimit-Limit", strconv.Itoa(limit.burst()))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.remaining))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.resetAfter), 10))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=60;burst=%d", limit.RequestsPerMinute, limit.burst()))
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
 }
 
 // sendRateLimitResponse sends rate limit exceeded response
-func (r *RateLimitMiddleware) sendRateLimitResponse(c *gin.Context, limit, remaining int, resetTime time.Time) {
-	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-	c.Header("X-RateLimit-Reset", strconv.FormatInt(resetTime.Unix(), 10))
-	c.Header("Retry-After", strconv.FormatInt(int64(time.Until(resetTime).Seconds()), 10))
-	
+func (r *RateLimitMiddleware) sendRateLimitResponse(c *gin.Context, retryAfter time.Duration) {
+	seconds := ceilSeconds(retryAfter)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+
+	c.Set("rate_limited", true)
 	c.JSON(http.StatusTooManyRequests, gin.H{
-		"error":   "Rate limit exceeded",
-		"message": "Too many requests. Please try again later.",
-		"retry_after": int64(time.Until(resetTime).Seconds()),
+		"error":       "Rate limit exceeded",
+		"message":     "Too many requests. Please try again later.",
+		"retry_after": seconds,
 	})
 	c.Abort()
 }
 
-// CleanupLimiters periodically cleans up unused in-memory limiters
+// AcquireConnection counts an open WebSocket connection against the config's
+// max_connections for the request's key, and returns the function that
+// releases it when the connection closes. Connections are counted by each
+// gateway instance. A request over the limit is refused with 429.
+func (r *RateLimitMiddleware) AcquireConnection(c *gin.Context, config *RateLimitConfig) (func(), bool) {
+	if config.MaxConnections <= 0 {
+		return func() {}, true
+	}
+	key := r.generateKey(c, config)
+
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+	if r.connections[key] >= config.MaxConnections {
+		c.Set("rate_limited", true)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Connection limit exceeded",
+			"message": fmt.Sprintf("At most %d connections may be open at once.", config.MaxConnections),
+			"code":    "CONNECTION_LIMIT_EXCEEDED",
+		})
+		return nil, false
+	}
+	r.connections[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.connMu.Lock()
+			defer r.connMu.Unlock()
+			if r.connections[key]--; r.connections[key] <= 0 {
+				delete(r.connections, key)
+			}
+		})
+	}, true
+}
+
+// CleanupLimiters drops the local limiters whose burst has fully
+// replenished; a new limiter for their key would behave the same
 func (r *RateLimitMiddleware) CleanupLimiters() {
-	// This should be called periodically to prevent memory leaks
-	// In a production system, you might want to use a more sophisticated cleanup strategy
-	r.limiters = make(map[string]*rate.Limiter)
+	r.local.cleanup(r.now())
+}
+
+// localLimiters are token buckets kept in memory for when Redis can't be
+// reached, up to a number of keys beyond which the least recently used are
+// dropped
+type localLimiters struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // of *localLimiter, most recently used first
+}
+
+type localLimiter struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+func newLocalLimiters(capacity int) *localLimiters {
+	return &localLimiters{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the key's limiter, set to limit
+func (l *localLimiters) get(key string, limit RateLimit, now time.Time) *rate.Limiter {
+	every := rate.Every(limit.interval())
+	if element, ok := l.entries[key]; ok {
+		l.order.MoveToFront(element)
+		limiter := element.Value.(*localLimiter).limiter
+		if limiter.Limit() != every {
+			limiter.SetLimitAt(now, every)
+		}
+		if limiter.Burst() != limit.burst() {
+			limiter.SetBurstAt(now, limit.burst())
+		}
+		return limiter
+	}
+
+	limiter := rate.NewLimiter(every, limit.burst())
+	l.entries[key] = l.order.PushFront(&localLimiter{key: key, limiter: limiter})
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*localLimiter).key)
+	}
+	return limiter
+}
+
+// allow checks every limit, taking a token from each only when all of them
+// have one
+func (l *localLimiters) allow(checks []rateLimitCheck, now time.Time) []rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiters := make([]*rate.Limiter, len(checks))
+	results := make([]rateLimitResult, len(checks))
+	allowed := true
+	for i, check := range checks {
+		limiters[i] = l.get(check.key, check.limit, now)
+		tokens := limiters[i].TokensAt(now)
+		results[i].allowed = tokens >= 1
+		if !results[i].allowed {
+			allowed = false
+			results[i].retryAfter = time.Duration((1 - tokens) * float64(check.limit.interval()))
+		}
+	}
+
+	for i, check := range checks {
+		if allowed {
+			limiters[i].AllowN(now, 1)
+		}
+		tokens := limiters[i].TokensAt(now)
+		results[i].remaining = int(math.Max(0, math.Floor(tokens)))
+		results[i].resetAfter = time.Duration((float64(check.limit.burst()) - tokens) * float64(check.limit.interval()))
+	}
+	return results
+}
+
+// cleanup drops the limiters whose burst has fully replenished
+func (l *localLimiters) cleanup(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, element := range l.entries {
+		limiter := element.Value.(*localLimiter).limiter
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			l.order.Remove(element)
+			delete(l.entries, key)
+		}
+	}
 }
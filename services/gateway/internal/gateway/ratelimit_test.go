@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalLimiters(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := RateLimit{RequestsPerMinute: 60, BurstSize: 3}
+	check := []rateLimitCheck{{key: "a", limit: limit}}
+
+	t.Run("Burst", func(t *testing.T) {
+		limiters := newLocalLimiters(10)
+		for i := 2; i >= 0; i-- {
+			result := limiters.allow(check, now)[0]
+			require.True(t, result.allowed)
+			assert.Equal(t, i, result.remaining)
+		}
+
+		result := limiters.allow(check, now)[0]
+		assert.False(t, result.allowed)
+		assert.Equal(t, time.Second, result.retryAfter)
+		assert.Equal(t, 3*time.Second, result.resetAfter)
+
+		// One request's allowance comes back every second
+		assert.True(t, limiters.allow(check, now.Add(time.Second))[0].allowed)
+		assert.False(t, limiters.allow(check, now.Add(time.Second))[0].allowed)
+	})
+
+	t.Run("AllLimits", func(t *testing.T) {
+		limiters := newLocalLimiters(10)
+		checks := []rateLimitCheck{
+			{key: "ip", limit: RateLimit{RequestsPerMinute: 60, BurstSize: 5}},
+			{key: "tenant", limit: RateLimit{RequestsPerMinute: 60, BurstSize: 1}},
+		}
+		results := limiters.allow(checks, now)
+		assert.True(t, results[0].allowed && results[1].allowed)
+
+		// The tenant limit denies the request, so the IP limit isn't used up
+		results = limiters.allow(checks, now)
+		assert.True(t, results[0].allowed)
+		assert.False(t, results[1].allowed)
+		assert.Equal(t, 4, results[0].remaining)
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		limiters := newLocalLimiters(2)
+		limiters.allow([]rateLimitCheck{{key: "a", limit: limit}}, now)
+		limiters.allow([]rateLimitCheck{{key: "b", limit: limit}}, now)
+		limiters.allow([]rateLimitCheck{{key: "a", limit: limit}}, now)
+		limiters.allow([]rateLimitCheck{{key: "c", limit: limit}}, now)
+
+		assert.Contains(t, limiters.entries, "a")
+		assert.NotContains(t, limiters.entries, "b", "the least recently used key is dropped")
+		assert.Contains(t, limiters.entries, "c")
+		assert.Equal(t, 2, limiters.order.Len())
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		limiters := newLocalLimiters(10)
+		limiters.allow([]rateLimitCheck{{key: "a", limit: limit}}, now)
+		limiters.allow([]rateLimitCheck{{key: "b", limit: limit}}, now.Add(2*time.Second))
+
+		limiters.cleanup(now.Add(2 * time.Second))
+		assert.NotContains(t, limiters.entries, "a", "a's burst has replenished")
+		assert.Contains(t, limiters.entries, "b")
+	})
+
+	t.Run("LimitChange", func(t *testing.T) {
+		limiters := newLocalLimiters(10)
+		limiters.allow(check, now)
+		result := limiters.allow([]rateLimitCheck{{key: "a", limit: RateLimit{RequestsPerMinute: 60, BurstSize: 10}}}, now)
+		assert.True(t, result[0].allowed)
+		assert.Equal(t, 10, limiters.entries["a"].Value.(*localLimiter).limiter.Burst())
+	})
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter, err := NewRateLimitMiddleware(nil)
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	config := &RateLimitConfig{
+		Enabled:           true,
+		RequestsPerMinute: 120,
+		BurstSize:         3,
+		KeyStrategy:       "tenant",
+		Limits:            map[string]RateLimit{"admin": {RequestsPerMinute: 0}},
+		Rules:             []RateLimitRule{{KeyStrategy: "ip", RequestsPerMinute: 60, BurstSize: 2}},
+	}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if tenant := c.GetHeader("X-Tenant"); tenant != "" {
+			c.Set("tenant_id", tenant)
+		}
+		if role := c.GetHeader("X-Role"); role != "" {
+			c.Set("user_roles", []string{role})
+		}
+	}, limiter.Handler(config))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(ip, tenant, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-Tenant", tenant)
+		req.Header.Set("X-Role", role)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The per-IP rule is the tighter limit, so the headers describe it
+	w := send("10.0.0.1", "t1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "60;w=60;burst=2", w.Header().Get("RateLimit-Policy"))
+
+	require.Equal(t, http.StatusOK, send("10.0.0.1", "t1", "").Code)
+	w = send("10.0.0.1", "t1", "")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	// The tenant limit is shared by every IP
+	w = send("10.0.0.2", "t1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.3", "t1", "").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.3", "t2", "").Code)
+
+	// A role with no limit is held to the rules only
+	require.Equal(t, http.StatusOK, send("10.0.0.4", "t1", "admin").Code)
+	require.Equal(t, http.StatusOK, send("10.0.0.4", "t1", "admin").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.4", "t1", "admin").Code)
+}
+
+func TestRateLimitConfigValidation(t *testing.T) {
+	for name, config := range map[string]RateLimitConfig{
+		"UnknownAlgorithm":  {Algorithm: "sliding_window"},
+		"NegativeBurst":     {RequestsPerMinute: 10, BurstSize: -1},
+		"RuleWithoutRate":   {Rules: []RateLimitRule{{KeyStrategy: "ip"}}},
+		"RuleUnknownKey":    {Rules: []RateLimitRule{{KeyStrategy: "country", RequestsPerMinute: 10}}},
+		"RuleWithoutCustom": {Rules: []RateLimitRule{{KeyStrategy: "custom", RequestsPerMinute: 10}}},
+	} {
+		config := config
+		assert.Error(t, validateRateLimit(&config), name)
+	}
+
+	assert.NoError(t, validateRateLimit(&RateLimitConfig{
+		Algorithm:         RateLimitTokenBucket,
+		RequestsPerMinute: 100,
+		Rules:             []RateLimitRule{{KeyStrategy: "tenant", RequestsPerMinute: 1000, BurstSize: 100}},
+	}))
+}
@@ -0,0 +1,297 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reload triggers
+const (
+	ReloadSignal = "signal"
+	ReloadFile   = "file"
+	ReloadAPI    = "api"
+)
+
+// AdminPath prefixes the gateway's own admin endpoints
+const AdminPath = "/_gateway"
+
+// gatewayState is the reloadable part of the gateway: the config and the
+// route matcher built from it. Requests read it once and use it throughout,
+// so a reload never mixes old and new settings in one request.
+type gatewayState struct {
+	config   *Config
+	matcher  *RouteMatcher
+	hash     string // SHA-256 of the config file
+	loadedAt time.Time
+}
+
+// ReloadResult describes a reload attempt
+type ReloadResult struct {
+	Trigger    string    `json:"trigger"`
+	At         time.Time `json:"at"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"` // of the config that was tried
+	Warnings   []string  `json:"warnings,omitempty"`
+
+	// Settings that changed but only take effect on restart
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// loadState reads, parses and validates the config file
+func loadState(configPath string, runtime *Config) (*gatewayState, []string, error) {
+	data, err := readConfigFile(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(data)
+	state := &gatewayState{hash: hex.EncodeToString(sum[:]), loadedAt: time.Now().UTC()}
+
+	state.config, err = parseConfig(data, runtime)
+	if err != nil {
+		return state, nil, err
+	}
+
+	state.matcher, err = NewRouteMatcher(state.config.Routes)
+	if err != nil {
+		return state, nil, fmt.Errorf("failed to initialize route matcher: %w", err)
+	}
+
+	warnings := state.matcher.ValidateRoutes()
+	if len(warnings) > 0 && state.config.Reload.WarningsAsErrors {
+		return state, warnings, fmt.Errorf("route validation failed: %s", strings.Join(warnings, "; "))
+	}
+	return state, warnings, nil
+}
+
+// current returns the active config and route matcher
+func (g *Gateway) current() *gatewayState {
+	return g.state.Load()
+}
+
+// Reload loads the config file again and, if it is valid, switches to it.
+// The active config stays in place when it isn't.
+func (g *Gateway) Reload(trigger string) *ReloadResult {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	result := &ReloadResult{Trigger: trigger, At: time.Now().UTC()}
+	defer func() { g.lastReload = result }()
+
+	// A missing file would otherwise reload as an empty config
+	if _, err := os.Stat(g.runtime.ConfigPath); err != nil {
+		result.Error = fmt.Sprintf("config file unavailable: %v", err)
+		log.Printf("Config reload (%s) failed, keeping the active config: %s", trigger, result.Error)
+		return result
+	}
+
+	state, warnings, err := loadState(g.runtime.ConfigPath, g.runtime)
+	if state != nil {
+		result.ConfigHash = state.hash
+	}
+	result.Warnings = warnings
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("Config reload (%s) failed, keeping the active config: %v", trigger, err)
+		return result
+	}
+
+	old := g.current()
+	result.RestartRequired = restartRequired(old.config, state.config)
+
+	// Tenant routes carry over to the new matcher
+	g.tenantMu.Lock()
+	state.matcher.SetTenantRoutes(g.tenantRoutes)
+	g.state.Store(state)
+	g.tenantMu.Unlock()
+	if g.proxy != nil {
+		g.proxy.Pools().Sync(state.config)
+	}
+
+	if !reflect.DeepEqual(old.config.TenantRouting, state.config.TenantRouting) && g.background != nil {
+		g.startTenants(&state.config.TenantRouting)
+	}
+
+	result.Success = true
+	log.Printf("Config reloaded (%s): %d routes, hash %s", trigger, len(state.config.Routes), state.hash[:12])
+	for _, setting := range result.RestartRequired {
+		log.Printf("Config reload: %s changed and takes effect on restart", setting)
+	}
+	return result
+}
+
+// restartRequired lists the settings that differ between two configs but
+// are only read at startup
+func restartRequired(old, new *Config) []string {
+	var settings []string
+	if old.Port != new.Port {
+		settings = append(settings, "port")
+	}
+	if old.RedisURL != new.RedisURL {
+		settings = append(settings, "redis_url")
+	}
+	if old.DatabaseURL != new.DatabaseURL {
+		settings = append(settings, "database_url")
+	}
+	if old.Environment != new.Environment {
+		settings = append(settings, "environment")
+	}
+	if !reflect.DeepEqual(old.Monitoring, new.Monitoring) {
+		settings = append(settings, "monitoring")
+	}
+	if old.Quotas.UsageRetentionDays != new.Quotas.UsageRetentionDays {
+		settings = append(settings, "quotas.usage_retention_days")
+	}
+	if old.Reload.WatchFile != new.Reload.WatchFile || old.Reload.WatchInterval != new.Reload.WatchInterval {
+		settings = append(settings, "reload.watch_file")
+	}
+	return settings
+}
+
+// setTenantRoutes passes routes from the tenant registry to the active
+// matcher, and keeps them for matchers built by later reloads
+func (g *Gateway) setTenantRoutes(routes []RouteConfig) {
+	g.tenantMu.Lock()
+	defer g.tenantMu.Unlock()
+	g.tenantRoutes = routes
+	g.current().matcher.SetTenantRoutes(routes)
+}
+
+// startTenants starts a tenant registry for the config, stopping the one
+// running before. Tenant routes built by the old registry are served until
+// the new one has loaded.
+func (g *Gateway) startTenants(config *TenantRoutingConfig) {
+	g.tenantMu.Lock()
+	if g.stopTenants != nil {
+		g.stopTenants()
+		g.stopTenants = nil
+	}
+	g.tenants = nil
+	if config.Enabled {
+		ctx, cancel := context.WithCancel(g.background)
+		g.tenants = NewTenantRegistry(config, g.setTenantRoutes)
+		g.stopTenants = cancel
+		go g.tenants.Run(ctx)
+		log.Printf("Tenant routing enabled (registry: %s)", config.RegistryURL)
+	}
+	g.tenantMu.Unlock()
+
+	if !config.Enabled {
+		g.setTenantRoutes(nil)
+	}
+}
+
+// watchReloads reloads the config on SIGHUP and, when configured, when the
+// config file changes
+func (g *Gateway) watchReloads(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var ticks <-chan time.Time
+	reload := g.current().config.Reload
+	if reload.WatchFile && g.runtime.ConfigPath != "" {
+		ticker := time.NewTicker(reload.WatchInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	// The file is reloaded when its contents change, and tried once per
+	// change, so a broken file isn't reloaded again until it is edited
+	seen := g.current().hash
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			result := g.Reload(ReloadSignal)
+			if result.ConfigHash != "" {
+				seen = result.ConfigHash
+			}
+		case <-ticks:
+			data, err := readConfigFile(g.runtime.ConfigPath)
+			if err != nil || data == nil {
+				continue
+			}
+			sum := sha256.Sum256(data)
+			if hash := hex.EncodeToString(sum[:]); hash != seen {
+				seen = hash
+				g.Reload(ReloadFile)
+			}
+		}
+	}
+}
+
+// setupAdminEndpoints adds the gateway's admin endpoints, which need a
+// platform admin token:
+//
+//	GET  /_gateway/config                  active config hash and last reload result
+//	POST /_gateway/reload                  reload the config file
+//	GET  /_gateway/backends                backend pools and the state of each backend
+//	GET  /_gateway/usage/:tenant           a tenant's usage and remaining quota
+//	PUT  /_gateway/usage/:tenant/resources report a tenant's storage and entities
+func (g *Gateway) setupAdminEndpoints() {
+	admin := g.router.Group(AdminPath)
+	admin.Use(g.adminAuth)
+	admin.GET("/config", g.handleConfigStatus)
+	admin.POST("/reload", g.handleReload)
+	admin.GET("/backends", g.handleBackends)
+	admin.GET("/usage/:tenant", g.handleUsage)
+	admin.PUT("/usage/:tenant/resources", g.handleReportResources)
+}
+
+// adminAuth checks admin tokens against the active config's JWT secret, so
+// a reload that rotates jwt_secret applies to the admin endpoints at once
+func (g *Gateway) adminAuth(c *gin.Context) {
+	g.auth.Handler(&AuthConfig{
+		Enabled:       true,
+		Required:      true,
+		HeaderName:    "Authorization",
+		JWTSecret:     g.current().config.JWTSecret,
+		RequiredRoles: []string{"platform_admin"},
+	})(c)
+}
+
+// handleConfigStatus reports the active config and the last reload
+func (g *Gateway) handleConfigStatus(c *gin.Context) {
+	state := g.current()
+
+	g.reloadMu.Lock()
+	lastReload := g.lastReload
+	g.reloadMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"config_hash":   state.hash,
+		"loaded_at":     state.loadedAt,
+		"routes":        len(state.config.Routes),
+		"tenant_routes": len(state.matcher.TenantRoutes()),
+		"last_reload":   lastReload,
+	})
+}
+
+// handleBackends reports the state of every backend pool
+func (g *Gateway) handleBackends(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"pools": g.proxy.Pools().Status()})
+}
+
+// handleReload reloads the config file
+func (g *Gateway) handleReload(c *gin.Context) {
+	result := g.Reload(ReloadAPI)
+	if !result.Success {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
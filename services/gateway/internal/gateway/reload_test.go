@@ -0,0 +1,273 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadConfigA = `
+port: "8000"
+routes:
+  - description: "Service A"
+    path_prefix: "/a"
+    backend:
+      url: "http://service-a"
+    enabled: true
+`
+
+const reloadConfigB = `
+port: "8000"
+routes:
+  - description: "Service B"
+    path_prefix: "/b"
+    backend:
+      url: "http://service-b"
+    enabled: true
+`
+
+// newStateTestGateway creates a gateway whose state is config and matcher,
+// without loading a config file
+func newStateTestGateway(config *Config, matcher *RouteMatcher) *Gateway {
+	g := &Gateway{}
+	g.state.Store(&gatewayState{config: config, matcher: matcher})
+	return g
+}
+
+// newReloadTestGateway creates a gateway from a config file without the
+// Redis connection NewGateway needs
+func newReloadTestGateway(t *testing.T, configPath string) *Gateway {
+	gin.SetMode(gin.TestMode)
+	runtime := &Config{Port: "8000", JWTSecret: "secret", ConfigPath: configPath, Environment: "test"}
+	state, _, err := loadState(configPath, runtime)
+	require.NoError(t, err)
+
+	g := &Gateway{runtime: runtime}
+	g.state.Store(state)
+	g.background, g.stopBackground = context.WithCancel(context.Background())
+	t.Cleanup(g.stopBackground)
+	require.NoError(t, g.initializeComponents())
+	require.NoError(t, g.setupRouter())
+	return g
+}
+
+func writeConfig(t *testing.T, path, contents string) {
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
+
+// matchedBackend returns the backend the active config routes path to
+func matchedBackend(g *Gateway, path string) string {
+	return stateBackend(g.current(), path)
+}
+
+func stateBackend(state *gatewayState, path string) string {
+	route, err := state.matcher.Match(hostRequest("example.com", path))
+	if err != nil {
+		return ""
+	}
+	return route.Backend.URL
+}
+
+func TestGatewayReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, reloadConfigA)
+	g := newReloadTestGateway(t, path)
+	initialHash := g.current().hash
+	require.Equal(t, "http://service-a", matchedBackend(g, "/a"))
+
+	t.Run("Success", func(t *testing.T) {
+		writeConfig(t, path, reloadConfigB)
+		result := g.Reload(ReloadAPI)
+		require.True(t, result.Success, result.Error)
+		assert.NotEqual(t, initialHash, result.ConfigHash)
+		assert.Equal(t, result.ConfigHash, g.current().hash)
+		assert.Equal(t, "http://service-b", matchedBackend(g, "/b"))
+		assert.Equal(t, "", matchedBackend(g, "/a"))
+	})
+
+	failures := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{"InvalidYAML", "routes: [", "failed to parse config file"},
+		{"InvalidRoute", "routes:\n  - path_prefix: \"/c\"\n    enabled: true\n", "backend URL is required"},
+		{"WarningsAsErrors", reloadConfigB + `
+  - description: "Service B2"
+    path_prefix: "/b/v2"
+    backend:
+      url: "http://service-b2"
+    enabled: true
+reload:
+  warnings_as_errors: true
+`, "route validation failed"},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			active := g.current()
+			writeConfig(t, path, tc.contents)
+			result := g.Reload(ReloadAPI)
+			assert.False(t, result.Success)
+			assert.Contains(t, result.Error, tc.expected)
+			assert.Same(t, active, g.current())
+			assert.Equal(t, "http://service-b", matchedBackend(g, "/b"))
+		})
+	}
+
+	t.Run("MissingFile", func(t *testing.T) {
+		require.NoError(t, os.Remove(path))
+		result := g.Reload(ReloadSignal)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Error, "config file unavailable")
+		assert.Equal(t, "http://service-b", matchedBackend(g, "/b"))
+	})
+
+	t.Run("RestartRequired", func(t *testing.T) {
+		writeConfig(t, path, strings.Replace(reloadConfigB, `port: "8000"`, `port: "9000"`, 1))
+		result := g.Reload(ReloadAPI)
+		require.True(t, result.Success, result.Error)
+		assert.Equal(t, []string{"port"}, result.RestartRequired)
+	})
+
+	t.Run("TenantRoutesCarryOver", func(t *testing.T) {
+		g.setTenantRoutes([]RouteConfig{{Host: "acme.backsaas.dev", Backend: BackendConfig{URL: "http://tenants"}, Enabled: true, Tenant: &Tenant{ID: "t1"}}})
+		writeConfig(t, path, reloadConfigA)
+		require.True(t, g.Reload(ReloadAPI).Success)
+
+		route, err := g.current().matcher.Match(hostRequest("acme.backsaas.dev", "/a"))
+		require.NoError(t, err)
+		assert.Equal(t, "http://tenants", route.Backend.URL)
+	})
+}
+
+func TestGatewayReloadConcurrentRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, reloadConfigA)
+	g := newReloadTestGateway(t, path)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Each request sees one whole config or the other
+				state := g.current()
+				a, b := stateBackend(state, "/a"), stateBackend(state, "/b")
+				if (a == "") == (b == "") {
+					t.Errorf("Request saw a mix of configs: %q, %q", a, b)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		contents := reloadConfigA
+		if i%2 == 0 {
+			contents = reloadConfigB
+		}
+		writeConfig(t, path, contents)
+		require.True(t, g.Reload(ReloadAPI).Success)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestGatewayReloadWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, reloadConfigA+"reload:\n  watch_file: true\n  watch_interval: 10ms\n")
+	g := newReloadTestGateway(t, path)
+	go g.watchReloads(g.background)
+
+	writeConfig(t, path, reloadConfigB+"reload:\n  watch_file: true\n  watch_interval: 10ms\n")
+	require.Eventually(t, func() bool { return matchedBackend(g, "/b") == "http://service-b" }, time.Second, 10*time.Millisecond)
+
+	// A broken edit is tried once and the active config is kept
+	writeConfig(t, path, "routes: [")
+	require.Eventually(t, func() bool {
+		g.reloadMu.Lock()
+		defer g.reloadMu.Unlock()
+		return g.lastReload != nil && !g.lastReload.Success && g.lastReload.Trigger == ReloadFile
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "http://service-b", matchedBackend(g, "/b"))
+}
+
+func TestGatewayAdminEndpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, reloadConfigA)
+	g := newReloadTestGateway(t, path)
+
+	admin, err := GenerateToken("u1", "admin@example.com", "system", []string{"platform_admin"}, nil, "secret", time.Hour)
+	require.NoError(t, err)
+	member, err := GenerateToken("u2", "member@example.com", "t1", []string{"member"}, nil, "secret", time.Hour)
+	require.NoError(t, err)
+
+	request := func(method, path, token string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		g.router.ServeHTTP(w, req)
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	status, _ := request("GET", AdminPath+"/config", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = request("GET", AdminPath+"/config", member)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, body := request("GET", AdminPath+"/config", admin)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, g.current().hash, body["config_hash"])
+	assert.Nil(t, body["last_reload"])
+
+	writeConfig(t, path, reloadConfigB)
+	status, body = request("POST", AdminPath+"/reload", admin)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, body["success"])
+	assert.Equal(t, "api", body["trigger"])
+
+	writeConfig(t, path, "routes: [")
+	status, body = request("POST", AdminPath+"/reload", admin)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, false, body["success"])
+
+	status, body = request("GET", AdminPath+"/config", admin)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, g.current().hash, body["config_hash"])
+	lastReload := body["last_reload"].(map[string]interface{})
+	assert.Equal(t, false, lastReload["success"])
+	assert.NotEqual(t, g.current().hash, lastReload["config_hash"])
+
+	// A reload that rotates the secret applies to admin tokens at once
+	writeConfig(t, path, reloadConfigB+"jwt_secret: \"rotated\"\n")
+	status, _ = request("POST", AdminPath+"/reload", admin)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = request("GET", AdminPath+"/config", admin)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	rotated, err := GenerateToken("u1", "admin@example.com", "system", []string{"platform_admin"}, nil, "rotated", time.Hour)
+	require.NoError(t, err)
+	status, _ = request("GET", AdminPath+"/config", rotated)
+	assert.Equal(t, http.StatusOK, status)
+}
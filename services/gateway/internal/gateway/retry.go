@@ -0,0 +1,322 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// errBackendTimeout: the route's timeout passed before the backend's
+	// response headers arrived
+	errBackendTimeout = errors.New("backend timeout")
+
+	// errTryTimeout: one attempt's per-try timeout passed
+	errTryTimeout = errors.New("backend attempt timeout")
+
+	// errCircuitOpen: every backend of the route has an open circuit
+	errCircuitOpen = errors.New("circuit open for every backend")
+)
+
+// idempotentMethods are the methods a retry policy may retry
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryTransport sends a proxied request to a backend picked from the
+// route's pool, and tries it again on another backend when the route's retry
+// policy allows. The reverse proxy writes only the response of the last
+// attempt, so a failed attempt never reaches the client.
+type retryTransport struct {
+	transport http.RoundTripper
+	pool      *BackendPool
+	route     *RouteConfig
+	c         *gin.Context
+	key       string // consistent hashing key
+	timer     *time.Timer
+	monitor   BackendMonitor
+
+	release func()
+	cancel  context.CancelCauseFunc
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.pool.countRequest()
+	retry := &t.route.Backend.Retry
+
+	attempts := 1
+	if t.retryable(req) {
+		attempts += t.route.Backend.MaxRetries
+	}
+
+	// Bodies are buffered so they can be sent again, up to a limit
+	var body []byte
+	if attempts > 1 && req.Body != nil && req.Body != http.NoBody {
+		limit := retry.MaxBufferBytes
+		if limit <= 0 {
+			limit = 1 << 20
+		}
+		if req.ContentLength > limit {
+			attempts = 1
+		} else {
+			buffered, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read request body: %w", err)
+			}
+			if int64(len(buffered)) > limit {
+				// Too large to send again: stream what was read and the rest
+				attempts = 1
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buffered), req.Body), req.Body}
+			} else {
+				req.Body.Close()
+				body = buffered
+			}
+		}
+	}
+
+	var tried []*Backend
+	for attempt := 1; ; attempt++ {
+		backend := t.pool.Pick(t.key, tried...)
+		if backend == nil {
+			t.recordError("none", errCircuitOpen, 0)
+			return nil, errCircuitOpen
+		}
+		tried = append(tried, backend)
+
+		resp, err := t.try(req, backend, body, attempt)
+		failed := err != nil || containsInt(retry.RetryOn, resp.StatusCode)
+		if !failed || attempt >= attempts || req.Context().Err() != nil || !t.pool.retryAllowed() {
+			if t.timer != nil {
+				// The response has started; the route timeout doesn't cut
+				// off streamed bodies
+				t.timer.Stop()
+			}
+			t.c.Set("backend_url", backend.URL)
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		t.done()
+		t.c.Set("retries", attempt)
+		if t.monitor != nil {
+			t.monitor.RecordRetry(routeLabel(t.route), backend.URL)
+		}
+
+		if err := sleepContext(req.Context(), backoff(retry, attempt)); err != nil {
+			return nil, timeoutCause(req.Context(), err)
+		}
+	}
+}
+
+// try sends one attempt to a backend and reports its outcome to the pool.
+// A traced request records the attempt as a client span, which the backend
+// receives as the parent in its traceparent header.
+func (t *retryTransport) try(req *http.Request, backend *Backend, body []byte, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	t.cancel = cancel
+	if timeout := t.route.Backend.Retry.PerTryTimeout; timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { cancel(errTryTimeout) })
+		defer timer.Stop()
+	}
+
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("server.address", backend.URL),
+		attribute.String("gateway.route", routeLabel(t.route)),
+	)
+	if attempt > 1 {
+		span.SetAttributes(attribute.Int("http.resend_count", attempt-1))
+	}
+
+	out := req.Clone(ctx)
+	rewriteURL(out.URL, backend.target)
+	traceContext.Inject(ctx, propagation.HeaderCarrier(out.Header))
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	t.release = backend.Acquire()
+	resp, err := t.transport.RoundTrip(out)
+	if err != nil {
+		err = timeoutCause(ctx, err)
+	}
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+		span.SetAttributes(attribute.Int("http.status_code", statusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if statusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+	t.pool.ReportResult(backend, statusCode, err)
+	t.recordError(backend.URL, err, statusCode)
+	return resp, err
+}
+
+// recordError tells the monitor about a failed attempt
+func (t *retryTransport) recordError(backendURL string, err error, statusCode int) {
+	if t.monitor == nil {
+		return
+	}
+	reason := ""
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		reason = "circuit_open"
+	case errors.Is(err, errBackendTimeout) || errors.Is(err, errTryTimeout):
+		reason = "timeout"
+	case errors.Is(err, context.Canceled):
+		// The client went away
+	case err != nil:
+		reason = "connection"
+	case statusCode >= 500:
+		reason = "status_5xx"
+	}
+	if reason != "" {
+		t.monitor.RecordBackendError(routeLabel(t.route), backendURL, reason)
+	}
+}
+
+// done ends the attempt in flight to the current backend
+func (t *retryTransport) done() {
+	if t.release != nil {
+		t.release()
+		t.release = nil
+	}
+	if t.cancel != nil {
+		t.cancel(nil)
+		t.cancel = nil
+	}
+}
+
+// retryable reports whether the route's retry policy covers a request
+func (t *retryTransport) retryable(req *http.Request) bool {
+	retry := &t.route.Backend.Retry
+	if retry.Disabled || t.route.Backend.MaxRetries <= 0 || req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	methods := retry.Methods
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE"}
+	}
+	for _, method := range methods {
+		if strings.EqualFold(method, req.Method) && idempotentMethods[req.Method] {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the attempt after the given one:
+// exponential, capped, with full jitter
+func backoff(retry *RetryConfig, attempt int) time.Duration {
+	base, max := retry.BackoffBase, retry.BackoffMax
+	if base <= 0 {
+		return 0
+	}
+	wait := base << (attempt - 1)
+	if wait <= 0 || (max > 0 && wait > max) {
+		wait = max
+	}
+	return time.Duration(rand.Int63n(int64(wait) + 1))
+}
+
+// sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// timeoutCause replaces a cancellation error with the timeout that caused
+// it, so timeouts are told apart from clients going away
+func timeoutCause(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, errBackendTimeout) || errors.Is(cause, errTryTimeout) {
+		return fmt.Errorf("%w: %v", cause, err)
+	}
+	return err
+}
+
+// rewriteURL points a request URL at a backend, joining the backend's path
+// and query with the request's as httputil.NewSingleHostReverseProxy does
+func rewriteURL(u, target *url.URL) {
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	u.Path, u.RawPath = joinURLPath(target, u)
+	if target.RawQuery == "" || u.RawQuery == "" {
+		u.RawQuery = target.RawQuery + u.RawQuery
+	} else {
+		u.RawQuery = target.RawQuery + "&" + u.RawQuery
+	}
+}
+
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	apath, bpath := a.EscapedPath(), b.EscapedPath()
+	aslash, bslash := strings.HasSuffix(apath, "/"), strings.HasPrefix(bpath, "/")
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash, bslash := strings.HasSuffix(a, "/"), strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
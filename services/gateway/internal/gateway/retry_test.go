@@ -0,0 +1,360 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProxyServer serves every request through ProxyRequest for the route
+func newProxyServer(t *testing.T, route *RouteConfig) (*httptest.Server, *ProxyMiddleware) {
+	gin.SetMode(gin.TestMode)
+	setBackendDefaults(&route.Backend)
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.NoRoute(func(c *gin.Context) { proxy.ProxyRequest(c, route) })
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, proxy
+}
+
+// recordingBackend answers with its name, or with the status fail returns
+type recordingBackend struct {
+	*httptest.Server
+	requests atomic.Int64
+	mu       sync.Mutex
+	bodies   []string
+}
+
+func newRecordingBackend(t *testing.T, name string, fail func() int) *recordingBackend {
+	backend := &recordingBackend{}
+	backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backend.requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		backend.mu.Lock()
+		backend.bodies = append(backend.bodies, string(body))
+		backend.mu.Unlock()
+		if status := fail(); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func always(status int) func() int { return func() int { return status } }
+
+func send(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestProxyRetries(t *testing.T) {
+	retry := RetryConfig{BackoffBase: time.Millisecond, BackoffMax: 5 * time.Millisecond}
+
+	t.Run("IdempotentMethods", func(t *testing.T) {
+		bad := newRecordingBackend(t, "bad", always(http.StatusServiceUnavailable))
+		good := newRecordingBackend(t, "good", always(0))
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URLs:             []string{bad.URL, good.URL},
+			MaxRetries:       2,
+			Retry:            retry,
+			OutlierDetection: OutlierDetectionConfig{Disabled: true},
+		}})
+
+		for i := 0; i < 4; i++ {
+			status, body := send(t, "GET", server.URL+"/items", "")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "good", body)
+		}
+		assert.Equal(t, int64(2), bad.requests.Load())
+
+		// PUT bodies are buffered and sent again
+		status, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"x"}`)
+		assert.Equal(t, http.StatusOK, status)
+
+		// POST is never retried
+		statuses := map[int]int{}
+		for i := 0; i < 2; i++ {
+			status, _ := send(t, "POST", server.URL+"/items", `{"name":"y"}`)
+			statuses[status]++
+		}
+		assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusServiceUnavailable: 1}, statuses)
+
+		bad.mu.Lock()
+		good.mu.Lock()
+		defer bad.mu.Unlock()
+		defer good.mu.Unlock()
+		assert.Contains(t, bad.bodies, `{"name":"x"}`)
+		assert.Contains(t, good.bodies, `{"name":"x"}`)
+	})
+
+	t.Run("RetryOn", func(t *testing.T) {
+		var calls atomic.Int64
+		flaky := newRecordingBackend(t, "flaky", func() int {
+			if calls.Add(1)%2 == 1 {
+				return http.StatusInternalServerError
+			}
+			return 0
+		})
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URL:        flaky.URL,
+			MaxRetries: 1,
+			Retry:      RetryConfig{RetryOn: []int{500}, BackoffBase: time.Millisecond},
+		}})
+
+		status, body := send(t, "GET", server.URL+"/", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "flaky", body)
+		assert.Equal(t, int64(2), flaky.requests.Load())
+	})
+
+	t.Run("ConnectionErrors", func(t *testing.T) {
+		good := newRecordingBackend(t, "good", always(0))
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URLs:       []string{"http://127.0.0.1:1", good.URL},
+			MaxRetries: 1,
+			Retry:      retry,
+		}})
+		for i := 0; i < 2; i++ {
+			status, body := send(t, "GET", server.URL+"/", "")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "good", body)
+		}
+	})
+
+	t.Run("BodyOverBufferLimit", func(t *testing.T) {
+		bad := newRecordingBackend(t, "bad", always(http.StatusServiceUnavailable))
+		good := newRecordingBackend(t, "good", always(0))
+		limited := retry
+		limited.MaxBufferBytes = 8
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URLs:       []string{bad.URL, good.URL},
+			MaxRetries: 1,
+			Retry:      limited,
+		}})
+
+		status, _ := send(t, "PUT", server.URL+"/", strings.Repeat("x", 64))
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		bad.mu.Lock()
+		defer bad.mu.Unlock()
+		assert.Equal(t, []string{strings.Repeat("x", 64)}, bad.bodies)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		bad := newRecordingBackend(t, "bad", always(http.StatusBadGateway))
+		disabled := retry
+		disabled.Disabled = true
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{URL: bad.URL, MaxRetries: 3, Retry: disabled}})
+		status, _ := send(t, "GET", server.URL+"/", "")
+		assert.Equal(t, http.StatusBadGateway, status)
+		assert.Equal(t, int64(1), bad.requests.Load())
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	pool := newTestPool(t, BackendConfig{URL: "http://a", Retry: RetryConfig{BudgetPercent: 20, BudgetMinRetries: 1}})
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		pool.countRequest()
+	}
+	for i := 0; i < 10; i++ {
+		if pool.retryAllowed() {
+			allowed++
+		}
+	}
+	assert.Equal(t, 4, allowed)
+
+	// The minimum applies to a quiet route
+	pool.budgetStart = time.Time{}
+	pool.countRequest()
+	assert.True(t, pool.retryAllowed())
+	assert.False(t, pool.retryAllowed())
+}
+
+func TestBackoff(t *testing.T) {
+	retry := &RetryConfig{BackoffBase: 10 * time.Millisecond, BackoffMax: 50 * time.Millisecond}
+	for attempt := 1; attempt < 10; attempt++ {
+		limit := 10 * time.Millisecond << (attempt - 1)
+		if limit > 50*time.Millisecond {
+			limit = 50 * time.Millisecond
+		}
+		for i := 0; i < 20; i++ {
+			wait := backoff(retry, attempt)
+			assert.True(t, wait >= 0 && wait <= limit, "attempt %d waited %s", attempt, wait)
+		}
+	}
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			io.WriteString(w, "slow")
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	t.Run("RouteTimeout", func(t *testing.T) {
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{URL: slow.URL, Timeout: 50 * time.Millisecond}})
+		patient, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{URL: slow.URL, Timeout: time.Second}})
+
+		// Each route keeps its own timeout while both are in flight
+		var wg sync.WaitGroup
+		results := make([]int, 2)
+		for i, url := range []string{server.URL, patient.URL} {
+			wg.Add(1)
+			go func(i int, url string) {
+				defer wg.Done()
+				results[i], _ = send(t, "POST", url+"/", "")
+			}(i, url)
+		}
+		wg.Wait()
+		assert.Equal(t, []int{http.StatusGatewayTimeout, http.StatusOK}, results)
+	})
+
+	t.Run("PerTryTimeout", func(t *testing.T) {
+		fast := newRecordingBackend(t, "fast", always(0))
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URLs:       []string{slow.URL, fast.URL},
+			Timeout:    time.Second,
+			MaxRetries: 1,
+			Retry:      RetryConfig{PerTryTimeout: 50 * time.Millisecond, BackoffBase: time.Millisecond},
+		}})
+		for i := 0; i < 2; i++ {
+			status, body := send(t, "GET", server.URL+"/", "")
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "fast", body)
+		}
+	})
+
+	t.Run("StreamsOutlastTimeout", func(t *testing.T) {
+		stream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "data: %d\n\n", i)
+				w.(http.Flusher).Flush()
+				time.Sleep(40 * time.Millisecond)
+			}
+		}))
+		defer stream.Close()
+
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{URL: stream.URL, Timeout: 50 * time.Millisecond}})
+		status, body := send(t, "GET", server.URL+"/", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\n", body)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	config := BackendConfig{
+		URL:              "http://a",
+		OutlierDetection: OutlierDetectionConfig{Disabled: true},
+		CircuitBreaker:   CircuitBreakerConfig{MinRequests: 4, FailureRatio: 0.5, OpenTimeout: 50 * time.Millisecond, HalfOpenRequests: 2},
+	}
+	pool := newTestPool(t, config)
+	a := pool.backends[0]
+	circuit := func() string { return pool.Status().Backends[0].Circuit }
+
+	// Closed until enough requests fail
+	for _, status := range []int{200, 500, 200} {
+		require.Same(t, a, pool.Pick(""))
+		pool.ReportResult(a, status, nil)
+	}
+	assert.Equal(t, CircuitClosed, circuit())
+	require.Same(t, a, pool.Pick(""))
+	pool.ReportResult(a, 502, nil)
+	assert.Equal(t, CircuitOpen, circuit())
+	assert.Nil(t, pool.Pick(""))
+
+	// Half-open lets a limited number of probes through
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, circuit())
+	require.Same(t, a, pool.Pick(""))
+	require.Same(t, a, pool.Pick(""))
+	assert.Nil(t, pool.Pick(""))
+
+	// A failed probe opens it again
+	pool.ReportResult(a, 0, fmt.Errorf("connection refused"))
+	assert.Equal(t, CircuitOpen, circuit())
+
+	// Successful probes close it
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		require.Same(t, a, pool.Pick(""))
+		pool.ReportResult(a, 200, nil)
+	}
+	assert.Equal(t, CircuitClosed, circuit())
+
+	t.Run("OtherBackendsServe", func(t *testing.T) {
+		multi := config
+		multi.URL = ""
+		multi.URLs = []string{"http://a", "http://b"}
+		pool := newTestPool(t, multi)
+		for i := 0; i < 4; i++ {
+			pool.ReportResult(pool.backends[0], 500, nil)
+		}
+		assert.Equal(t, map[string]int{"http://b": 4}, picks(pool, 4, ""))
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		bad := newRecordingBackend(t, "bad", always(http.StatusInternalServerError))
+		server, _ := newProxyServer(t, &RouteConfig{Backend: BackendConfig{
+			URL:              bad.URL,
+			OutlierDetection: OutlierDetectionConfig{Disabled: true},
+			CircuitBreaker:   CircuitBreakerConfig{MinRequests: 2, OpenTimeout: time.Minute},
+		}})
+		for i := 0; i < 2; i++ {
+			status, _ := send(t, "POST", server.URL+"/", "")
+			assert.Equal(t, http.StatusInternalServerError, status)
+		}
+
+		status, body := send(t, "POST", server.URL+"/", "")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &response))
+		assert.Equal(t, "CIRCUIT_OPEN", response["code"])
+		assert.Equal(t, int64(2), bad.requests.Load())
+	})
+}
+
+func TestRetryConfigValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  BackendConfig
+		expected string
+	}{
+		{"NonIdempotentMethod", BackendConfig{URL: "http://a", Retry: RetryConfig{Methods: []string{"GET", "POST"}}}, "POST is not idempotent"},
+		{"RetryOnSuccess", BackendConfig{URL: "http://a", Retry: RetryConfig{RetryOn: []int{200}}}, "not an error status"},
+		{"FailureRatio", BackendConfig{URL: "http://a", CircuitBreaker: CircuitBreakerConfig{FailureRatio: 2}}, "failure_ratio"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBackend(&tc.backend)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
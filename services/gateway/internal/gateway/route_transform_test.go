@@ -1,6 +1,13 @@
 package gateway
 
 import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -395,3 +402,207 @@ func TestRouteMatchingLogic(t *testing.T) {
 		})
 	}
 }
+
+const transformConfig = `
+port: "8000"
+auth:
+  enabled: true
+  required: true
+  header_name: "Authorization"
+  jwt_secret: "secret"
+routes:
+  - description: "Posts"
+    path_prefix: "/v1"
+    backend:
+      url: "BACKEND"
+    enabled: true
+    transform:
+      path_pattern: "^/v1/users/(?P<user>[^/]+)/posts/([0-9]+)$"
+      path_replacement: "/api/users/${user}/posts/$2"
+      add_headers:
+        X-Tenant: "{{tenant_id}}"
+        X-Caller: "user-{{user_id}}"
+        X-Plan: "{{claims.plan}}"
+      remove_body_fields: ["tenant_id", "meta.internal"]
+      add_body_fields:
+        tenant_id: "{{tenant_id}}"
+        meta.source: "gateway"
+        meta.version: 2
+      add_response_headers:
+        X-Served-For: "{{tenant_id}}"
+      remove_response_headers: ["X-Backend-Secret"]
+      max_body_bytes: 200
+  - description: "Legacy"
+    path_prefix: "/legacy"
+    backend:
+      url: "BACKEND"
+    enabled: true
+    transform:
+      response_envelope:
+        fields:
+          result: "data.items"
+          paging.total: "meta.total"
+        static:
+          success: true
+`
+
+// transformEcho is what the transform test backend saw of a request
+type transformEcho struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+func TestRouteTransforms(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Backend-Secret", "internal")
+		w.Header().Set("ETag", `"v1"`)
+		switch {
+		case r.URL.Path == "/legacy/items":
+			w.Write([]byte(`{"data":{"items":[{"id":1,"name":"<a&b>"}]},"meta":{"total":12345678901234567}}`))
+		case r.URL.Path == "/legacy/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"failed"}`))
+		default:
+			body, _ := io.ReadAll(r.Body)
+			echo := transformEcho{Path: r.URL.Path, Headers: map[string]string{}, Body: string(body)}
+			for _, name := range []string{"X-Tenant", "X-Caller", "X-Plan", "Content-Type"} {
+				echo.Headers[name] = r.Header.Get(name)
+			}
+			json.NewEncoder(w).Encode(echo)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, strings.ReplaceAll(transformConfig, "BACKEND", backend.URL))
+	g := newReloadTestGateway(t, path)
+	token, err := GenerateToken("u1", "user@example.com", "t1", nil, nil, "secret", time.Hour)
+	require.NoError(t, err)
+
+	request := func(method, path, contentType, body string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		g.router.ServeHTTP(w, req)
+		return w
+	}
+	echoed := func(t *testing.T, w *httptest.ResponseRecorder) transformEcho {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var echo transformEcho
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &echo))
+		return echo
+	}
+
+	t.Run("Request", func(t *testing.T) {
+		w := request("POST", "/v1/users/u1/posts/42", "application/json",
+			`{"title":"x","tenant_id":"spoofed","meta":{"internal":true,"tags":["a"]}}`,
+			"X-Tenant", "spoofed", "X-Plan", "spoofed")
+		echo := echoed(t, w)
+
+		assert.Equal(t, "/api/users/u1/posts/42", echo.Path)
+		assert.Equal(t, "t1", echo.Headers["X-Tenant"])
+		assert.Equal(t, "user-u1", echo.Headers["X-Caller"])
+		assert.Empty(t, echo.Headers["X-Plan"], "a template without a value removes the header")
+		assert.JSONEq(t, `{"title":"x","tenant_id":"t1","meta":{"tags":["a"],"source":"gateway","version":2}}`, echo.Body)
+
+		assert.Equal(t, "t1", w.Header().Get("X-Served-For"))
+		assert.Empty(t, w.Header().Get("X-Backend-Secret"))
+	})
+
+	t.Run("Unmatched", func(t *testing.T) {
+		// Paths the pattern doesn't match and bodies that aren't JSON pass
+		// unchanged
+		echo := echoed(t, request("POST", "/v1/other", "text/plain", "tenant_id=x"))
+		assert.Equal(t, "/v1/other", echo.Path)
+		assert.Equal(t, "tenant_id=x", echo.Body)
+
+		echo = echoed(t, request("GET", "/v1/users/u1/posts/latest", "", ""))
+		assert.Equal(t, "/v1/users/u1/posts/latest", echo.Path)
+	})
+
+	t.Run("InvalidBody", func(t *testing.T) {
+		w := request("POST", "/v1/users/u1/posts/1", "application/json", `[1, 2]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_JSON_BODY")
+
+		w = request("POST", "/v1/users/u1/posts/1", "application/json", `{"title":"`+strings.Repeat("x", 200)+`"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "BODY_TOO_LARGE")
+	})
+
+	t.Run("ResponseEnvelope", func(t *testing.T) {
+		w := request("GET", "/legacy/items", "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		expected := `{"paging":{"total":12345678901234567},"result":[{"id":1,"name":"<a&b>"}],"success":true}`
+		assert.Equal(t, expected, w.Body.String())
+		assert.Equal(t, strconv.Itoa(len(expected)), w.Header().Get("Content-Length"))
+		assert.Empty(t, w.Header().Get("ETag"))
+
+		// Failed responses pass unchanged
+		w = request("GET", "/legacy/fail", "", "")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, `{"error":"failed"}`, w.Body.String())
+	})
+}
+
+func TestTransformValidation(t *testing.T) {
+	for name, transform := range map[string]TransformConfig{
+		"RelativeRewritePath":   {RewritePath: "api"},
+		"RewritePathAndPattern": {RewritePath: "/api", PathPattern: "^/v1"},
+		"InvalidPattern":        {PathPattern: "^/v1/(", PathReplacement: "/"},
+		"MissingGroup":          {PathPattern: "^/v1/(.*)$", PathReplacement: "/api/$2"},
+		"MissingNamedGroup":     {PathPattern: "^/v1/(?P<rest>.*)$", PathReplacement: "/api/${path}"},
+		"ReplacementOnly":       {PathReplacement: "/api"},
+		"UnknownTemplate":       {AddHeaders: map[string]string{"X-Org": "{{org_id}}"}},
+		"UnknownResponseTemplate": {AddResponseHeaders: map[string]string{"X-Org": "{{claims.}}"}},
+		"EmptyBodyFieldPath":    {RemoveBodyFields: []string{"meta..internal"}},
+		"BodyFieldTemplate":     {AddBodyFields: map[string]interface{}{"org": "{{org}}"}},
+		"EmptyEnvelope":         {ResponseEnvelope: &ResponseEnvelopeConfig{}},
+		"InvalidEnvelopeSource": {ResponseEnvelope: &ResponseEnvelopeConfig{Fields: map[string]string{"result": "data."}}},
+		"NegativeMaxBody":       {MaxBodyBytes: -1},
+	} {
+		transform := transform
+		assert.Error(t, validateTransform(&transform), name)
+	}
+
+	transform := &TransformConfig{
+		PathPattern:      "^/v1/(?P<rest>.*)$",
+		PathReplacement:  "/api/v2/${rest}",
+		AddHeaders:       map[string]string{"X-Tenant": "{{ tenant_id }}", "X-Role": "{{claims.role}}"},
+		AddBodyFields:    map[string]interface{}{"meta.by": "{{user_id}}", "meta.count": 1},
+		ResponseEnvelope: &ResponseEnvelopeConfig{Fields: map[string]string{"data": "."}},
+	}
+	require.NoError(t, validateTransform(transform))
+	assert.NotNil(t, transform.pathPattern)
+	assert.Equal(t, "/api/v2/items/1", transform.rewritePath("/v1/items/1"))
+
+	// Invalid transforms are rejected when the config loads
+	config := &Config{Port: "8080", JWTSecret: "secret", Routes: []RouteConfig{{
+		PathPrefix: "/v1",
+		Backend:    BackendConfig{URL: "http://service:8080"},
+		Transform:  &TransformConfig{PathPattern: "^/v1/(.*)$", PathReplacement: "/$3"},
+	}}}
+	setDefaults(config)
+	assert.Error(t, validateConfig(config))
+}
+
+func TestTransformRewritePath(t *testing.T) {
+	// Routes built in code are rewritten without being validated first
+	transform := &TransformConfig{PathPattern: "^/shop/([^/]+)", PathReplacement: "/stores/$1/catalog"}
+	assert.Equal(t, "/stores/s1/catalog/items", transform.rewritePath("/shop/s1/items"))
+	assert.Equal(t, "/other", transform.rewritePath("/other"))
+
+	transform = &TransformConfig{PathPattern: "^/v1", PathReplacement: ""}
+	assert.Equal(t, "/items", transform.rewritePath("/v1/items"))
+	assert.Equal(t, "/", (&TransformConfig{PathPattern: "^/v1$"}).rewritePath("/v1"))
+
+	assert.Equal(t, "/fixed", (&TransformConfig{RewritePath: "/fixed"}).rewritePath("/anything"))
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // RouteMatcher handles route matching logic
@@ -13,6 +15,11 @@ type RouteMatcher struct {
 	
 	// Compiled regex patterns for performance
 	pathPatterns map[int]*regexp.Regexp
+	
+	// Routes built from tenant records, indexed by host. They are replaced
+	// while requests are being matched.
+	tenantMu     sync.RWMutex
+	tenantRoutes map[string]*RouteConfig
 }
 
 // NewRouteMatcher creates a new route matcher
@@ -55,6 +62,14 @@ func (rm *RouteMatcher) Match(req *http.Request) (*RouteConfig, error) {
 		}
 	}
 	
+	// A tenant's own host wins over configured routes, unless one of them
+	// names that exact host
+	if route := rm.matchTenant(req); route != nil && rm.calculateMatchScore(req, route, -1) > 0 {
+		if bestMatch == nil || bestMatch.Host == "" || strings.HasPrefix(bestMatch.Host, "*.") {
+			bestMatch = route
+		}
+	}
+	
 	if bestMatch == nil {
 		return nil, fmt.Errorf("no matching route found for %s %s", req.Method, req.URL.Path)
 	}
@@ -62,6 +77,44 @@ func (rm *RouteMatcher) Match(req *http.Request) (*RouteConfig, error) {
 	return bestMatch, nil
 }
 
+// matchTenant returns the tenant route for the request's host, if any
+func (rm *RouteMatcher) matchTenant(req *http.Request) *RouteConfig {
+	host := strings.ToLower(req.Host)
+	if colonIndex := strings.Index(host, ":"); colonIndex != -1 {
+		host = host[:colonIndex]
+	}
+	
+	rm.tenantMu.RLock()
+	defer rm.tenantMu.RUnlock()
+	return rm.tenantRoutes[host]
+}
+
+// SetTenantRoutes replaces the routes built from tenant records. Each route
+// matches one host exactly.
+func (rm *RouteMatcher) SetTenantRoutes(routes []RouteConfig) {
+	byHost := make(map[string]*RouteConfig, len(routes))
+	for i := range routes {
+		byHost[strings.ToLower(routes[i].Host)] = &routes[i]
+	}
+	
+	rm.tenantMu.Lock()
+	defer rm.tenantMu.Unlock()
+	rm.tenantRoutes = byHost
+}
+
+// TenantRoutes returns the routes built from tenant records
+func (rm *RouteMatcher) TenantRoutes() []RouteConfig {
+	rm.tenantMu.RLock()
+	defer rm.tenantMu.RUnlock()
+	
+	routes := make([]RouteConfig, 0, len(rm.tenantRoutes))
+	for _, route := range rm.tenantRoutes {
+		routes = append(routes, *route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+	return routes
+}
+
 // calculateMatchScore calculates how well a route matches the request
 func (rm *RouteMatcher) calculateMatchScore(req *http.Request, route *RouteConfig, routeIndex int) int {
 	score := 0
@@ -122,6 +175,10 @@ func (rm *RouteMatcher) matchHost(requestHost, routeHost string) bool {
 		requestHost = requestHost[:colonIndex]
 	}
 	
+	// Host names are case-insensitive
+	requestHost = strings.ToLower(requestHost)
+	routeHost = strings.ToLower(routeHost)
+	
 	// Exact match
 	if requestHost == routeHost {
 		return true
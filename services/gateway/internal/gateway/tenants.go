@@ -0,0 +1,433 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant statuses. Only active tenants are proxied.
+const (
+	TenantActive    = "active"
+	TenantSuspended = "suspended"
+)
+
+// Tenant is the part of a tenant record the gateway routes on
+type Tenant struct {
+	ID     string `json:"id"`
+	Slug   string `json:"slug,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Status string `json:"status,omitempty"`
+	Plan   string `json:"plan,omitempty"`
+}
+
+// Active reports whether the tenant's traffic should be proxied. Records
+// without a status are treated as active.
+func (t *Tenant) Active() bool {
+	return t.Status == "" || t.Status == TenantActive
+}
+
+// tenantFromRecord reads a tenant from a record of the tenants entity, which
+// is keyed by id in the system schema and by tenant_id in older schemas
+func tenantFromRecord(record map[string]interface{}) *Tenant {
+	str := func(name string) string {
+		value, _ := record[name].(string)
+		return value
+	}
+
+	tenant := &Tenant{
+		ID:     str("id"),
+		Slug:   strings.ToLower(str("slug")),
+		Domain: strings.ToLower(strings.TrimSuffix(str("domain"), ".")),
+		Status: str("status"),
+		Plan:   str("plan"),
+	}
+	if tenant.ID == "" {
+		tenant.ID = str("tenant_id")
+	}
+	if tenant.ID == "" {
+		return nil
+	}
+	return tenant
+}
+
+// tenantChange is a message on the tenants entity's change stream
+type tenantChange struct {
+	Sequence int64                  `json:"sequence"`
+	Action   string                 `json:"action"` // created, updated or deleted
+	ID       string                 `json:"id"`
+	Data     map[string]interface{} `json:"data"`
+}
+
+// TenantRegistry keeps the gateway's tenant routes in step with the tenant
+// records in the platform API. It reloads every tenant periodically and, when
+// configured, follows the entity's change stream in between so new tenants,
+// domains and suspensions take effect within moments.
+type TenantRegistry struct {
+	config   *TenantRoutingConfig
+	client   *http.Client // for reloads
+	stream   *http.Client // for the change stream, which has no deadline
+	onChange func(routes []RouteConfig)
+
+	// retryDelay is how long to wait before reconnecting the change stream
+	retryDelay time.Duration
+
+	mu       sync.Mutex
+	tenants  map[string]*Tenant
+	sequence int64 // last change seen on the stream
+	loaded   bool
+}
+
+// NewTenantRegistry creates a registry that passes the tenant routes to
+// onChange whenever they change
+func NewTenantRegistry(config *TenantRoutingConfig, onChange func(routes []RouteConfig)) *TenantRegistry {
+	return &TenantRegistry{
+		config:     config,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		stream:     &http.Client{},
+		onChange:   onChange,
+		retryDelay: 5 * time.Second,
+		tenants:    make(map[string]*Tenant),
+	}
+}
+
+// Run loads the tenants and keeps them current until ctx is cancelled
+func (r *TenantRegistry) Run(ctx context.Context) {
+	if err := r.Refresh(ctx); err != nil {
+		log.Printf("Failed to load tenants: %v", err)
+	}
+
+	if r.config.WatchChanges {
+		go r.watch(ctx)
+	}
+
+	ticker := time.NewTicker(r.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("Failed to reload tenants: %v", err)
+			}
+		}
+	}
+}
+
+// Refresh reloads every tenant from the registry. The current routes are
+// kept when the registry can't be reached.
+func (r *TenantRegistry) Refresh(ctx context.Context) error {
+	const pageSize = 1000
+
+	tenants := make(map[string]*Tenant)
+	for offset := 0; ; offset += pageSize {
+		endpoint := fmt.Sprintf("%s/api/%s?limit=%d&offset=%d", r.baseURL(), url.PathEscape(r.config.Entity), pageSize, offset)
+		req, err := r.newRequest(ctx, endpoint)
+		if err != nil {
+			return err
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to list tenants: %w", err)
+		}
+		var page struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		err = decodeRegistryResponse(resp, &page)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range page.Data {
+			if tenant := tenantFromRecord(record); tenant != nil {
+				tenants[tenant.ID] = tenant
+			}
+		}
+		if len(page.Data) < pageSize {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenants = tenants
+	r.loaded = true
+	r.publish()
+	return nil
+}
+
+// watch follows the change stream, reconnecting from the last change seen
+// whenever it drops
+func (r *TenantRegistry) watch(ctx context.Context) {
+	for {
+		err := r.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Tenant change stream ended, reconnecting in %s: %v", r.retryDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.retryDelay):
+		}
+	}
+}
+
+// follow applies changes from one connection to the change stream
+func (r *TenantRegistry) follow(ctx context.Context) error {
+	endpoint := fmt.Sprintf("%s/api/%s/_changes", r.baseURL(), url.PathEscape(r.config.Entity))
+	r.mu.Lock()
+	if r.sequence > 0 {
+		endpoint += "?since=" + strconv.FormatInt(r.sequence, 10)
+	}
+	r.mu.Unlock()
+
+	req, err := r.newRequest(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := r.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to open change stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("change stream returned status %d", resp.StatusCode)
+	}
+
+	// Server-sent events: data lines up to a blank line make one message;
+	// comments (keep-alives) and the id and event fields are ignored since
+	// the change itself carries them
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				r.applyMessage(data.String())
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("change stream closed")
+}
+
+// applyMessage applies one change stream message
+func (r *TenantRegistry) applyMessage(message string) {
+	var change tenantChange
+	if err := json.Unmarshal([]byte(message), &change); err != nil {
+		log.Printf("Ignoring malformed tenant change: %v", err)
+		return
+	}
+	r.apply(&change)
+}
+
+// apply updates the routes for one tenant change
+func (r *TenantRegistry) apply(change *tenantChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if change.Sequence > r.sequence {
+		r.sequence = change.Sequence
+	}
+
+	switch change.Action {
+	case "deleted":
+		delete(r.tenants, change.ID)
+	case "created", "updated":
+		tenant := tenantFromRecord(change.Data)
+		if tenant == nil {
+			return
+		}
+		if existing, ok := r.tenants[tenant.ID]; ok && *existing == *tenant {
+			return
+		}
+		r.tenants[tenant.ID] = tenant
+	default:
+		return
+	}
+	if r.loaded {
+		r.publish()
+	}
+}
+
+// Tenant returns the tenant with the ID, or nil when there is none
+func (r *TenantRegistry) Tenant(id string) *Tenant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tenant, ok := r.tenants[id]; ok {
+		copy := *tenant
+		return &copy
+	}
+	return nil
+}
+
+// Routes returns a route for every host a tenant is served on: its slug
+// under the base domain and its custom domain. When two tenants claim the
+// same host, the one with the lower ID keeps it.
+func (r *TenantRegistry) Routes() []RouteConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.routes()
+}
+
+func (r *TenantRegistry) routes() []RouteConfig {
+	ids := make([]string, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var routes []RouteConfig
+	claimed := make(map[string]string)
+	for _, id := range ids {
+		tenant := *r.tenants[id]
+
+		var hosts []string
+		if tenant.Slug != "" && r.config.BaseDomain != "" {
+			hosts = append(hosts, tenant.Slug+"."+r.config.BaseDomain)
+		}
+		if tenant.Domain != "" {
+			hosts = append(hosts, tenant.Domain)
+		}
+
+		for _, host := range hosts {
+			if owner, taken := claimed[host]; taken {
+				if owner != tenant.ID {
+					log.Printf("Tenant %s claims host %s, which is already routed to tenant %s", tenant.ID, host, owner)
+				}
+				continue
+			}
+			claimed[host] = tenant.ID
+
+			route := r.config.Route
+			route.Host = host
+			route.TenantID = ""
+			route.Tenant = &tenant
+			route.Enabled = true
+			route.Description = fmt.Sprintf("Tenant %s (%s)", tenant.ID, host)
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// publish passes the current routes on; callers hold r.mu
+func (r *TenantRegistry) publish() {
+	if r.onChange != nil {
+		r.onChange(r.routes())
+	}
+}
+
+func (r *TenantRegistry) baseURL() string {
+	return strings.TrimSuffix(r.config.RegistryURL, "/")
+}
+
+func (r *TenantRegistry) newRequest(ctx context.Context, endpoint string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant registry URL: %w", err)
+	}
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+	return req, nil
+}
+
+// decodeRegistryResponse decodes a successful registry response into v
+func decodeRegistryResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tenant registry returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode tenants: %w", err)
+	}
+	return nil
+}
+
+// tenantStatus blocks requests for tenants that aren't active. Suspended
+// tenants get 423 Locked; tenants being removed or deactivated get 403.
+// Requests for active tenants carry the tenant's ID from here on, so
+// tenant-keyed rate limits apply to anonymous requests too.
+func (g *Gateway) tenantStatus(tenant *Tenant) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenant.Active() {
+			c.Set("tenant_id", tenant.ID)
+			c.Next()
+			return
+		}
+
+		status, code, message := http.StatusForbidden, "TENANT_UNAVAILABLE", "This workspace is not available."
+		if tenant.Status == TenantSuspended {
+			status, code, message = http.StatusLocked, "TENANT_SUSPENDED", "This workspace has been suspended. Contact its owner or support to restore access."
+		}
+
+		if strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.Data(status, "text/html; charset=utf-8", []byte(tenantBlockedPage(status, message)))
+			c.Abort()
+			return
+		}
+		c.AbortWithStatusJSON(status, gin.H{
+			"error":   http.StatusText(status),
+			"message": message,
+			"code":    code,
+		})
+	}
+}
+
+// tenantMember rejects users authenticated for another tenant
+func (g *Gateway) tenantMember(tenant *Tenant) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenantID := c.GetString("tenant_id"); tenantID != "" && tenantID != tenant.ID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Tenant mismatch",
+				"message": "The token was issued for another tenant",
+				"code":    "TENANT_MISMATCH",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// tenantBlockedPage renders the page browsers get for blocked tenants
+func tenantBlockedPage(status int, message string) string {
+	title := html.EscapeString(fmt.Sprintf("%d %s", status, http.StatusText(status)))
+	return `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>` + title + `</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 4em;">
+<h1>` + title + `</h1>
+<p>` + html.EscapeString(message) + `</p>
+</body>
+</html>
+`
+}
@@ -0,0 +1,313 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTenantRegistry serves tenant records and a change stream the way the
+// platform API does
+type fakeTenantRegistry struct {
+	mu      sync.Mutex
+	records []map[string]interface{}
+	changes chan string
+	since   chan string
+}
+
+func newFakeTenantRegistry(records ...map[string]interface{}) *fakeTenantRegistry {
+	return &fakeTenantRegistry{records: records, changes: make(chan string, 10), since: make(chan string, 10)}
+}
+
+func (f *fakeTenantRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/tenants":
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": f.records})
+	case "/api/tenants/_changes":
+		f.since <- r.URL.Query().Get("since")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case message, ok := <-f.changes:
+				if !ok {
+					return
+				}
+				fmt.Fprint(w, message)
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func tenantRoutingConfig(registryURL, backendURL string) *TenantRoutingConfig {
+	return &TenantRoutingConfig{
+		Enabled:         true,
+		RegistryURL:     registryURL,
+		Entity:          "tenants",
+		Token:           "registry-token",
+		BaseDomain:      "backsaas.dev",
+		RefreshInterval: time.Hour,
+		Route: RouteConfig{
+			Backend: BackendConfig{URL: backendURL},
+		},
+	}
+}
+
+func hostRequest(host, path string) *http.Request {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Host = host
+	return req
+}
+
+func TestTenantRegistry(t *testing.T) {
+	fake := newFakeTenantRegistry(
+		map[string]interface{}{"id": "t1", "slug": "acme", "domain": "app.acme.com", "status": "active"},
+		map[string]interface{}{"tenant_id": "t2", "slug": "globex", "status": "suspended"},
+		map[string]interface{}{"id": "t3", "slug": "initech", "domain": "app.acme.com"},
+		map[string]interface{}{"name": "no id"},
+	)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	matcher, err := NewRouteMatcher([]RouteConfig{
+		{Description: "Tenant UI", Host: "*.backsaas.dev", PathPrefix: "/", Backend: BackendConfig{URL: "http://tenant-ui"}, Enabled: true},
+		{Description: "Landing Page", PathPrefix: "/", Backend: BackendConfig{URL: "http://landing"}, Enabled: true},
+	})
+	require.NoError(t, err)
+
+	registry := NewTenantRegistry(tenantRoutingConfig(server.URL, "http://tenants"), matcher.SetTenantRoutes)
+	require.NoError(t, registry.Refresh(context.Background()))
+
+	t.Run("Routes", func(t *testing.T) {
+		hosts := []string{}
+		for _, route := range matcher.TenantRoutes() {
+			hosts = append(hosts, route.Host+"="+route.Tenant.ID)
+		}
+		// t3's custom domain is already t1's
+		assert.Equal(t, []string{"acme.backsaas.dev=t1", "app.acme.com=t1", "globex.backsaas.dev=t2", "initech.backsaas.dev=t3"}, hosts)
+	})
+
+	t.Run("Match", func(t *testing.T) {
+		testCases := []struct {
+			host     string
+			tenantID string
+			backend  string
+		}{
+			{"acme.backsaas.dev", "t1", "http://tenants"},
+			{"ACME.backsaas.dev:443", "t1", "http://tenants"},
+			{"app.acme.com", "t1", "http://tenants"},
+			{"globex.backsaas.dev", "t2", "http://tenants"},
+			{"unknown.backsaas.dev", "", "http://tenant-ui"},
+			{"example.com", "", "http://landing"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.host, func(t *testing.T) {
+				route, err := matcher.Match(hostRequest(tc.host, "/dashboard"))
+				require.NoError(t, err)
+				assert.Equal(t, tc.backend, route.Backend.URL)
+				if tc.tenantID == "" {
+					assert.Nil(t, route.Tenant)
+				} else {
+					require.NotNil(t, route.Tenant)
+					assert.Equal(t, tc.tenantID, route.Tenant.ID)
+				}
+			})
+		}
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		registry.apply(&tenantChange{Sequence: 1, Action: "updated", ID: "t1", Data: map[string]interface{}{"id": "t1", "slug": "acme", "status": "suspended"}})
+		route, err := matcher.Match(hostRequest("acme.backsaas.dev", "/"))
+		require.NoError(t, err)
+		assert.Equal(t, TenantSuspended, route.Tenant.Status)
+
+		// The custom domain passes to the next claimant
+		route, err = matcher.Match(hostRequest("app.acme.com", "/"))
+		require.NoError(t, err)
+		assert.Equal(t, "t3", route.Tenant.ID)
+
+		registry.apply(&tenantChange{Sequence: 2, Action: "deleted", ID: "t3"})
+		route, err = matcher.Match(hostRequest("initech.backsaas.dev", "/"))
+		require.NoError(t, err)
+		assert.Nil(t, route.Tenant)
+	})
+
+	t.Run("FailedRefreshKeepsRoutes", func(t *testing.T) {
+		before := len(matcher.TenantRoutes())
+		broken := NewTenantRegistry(tenantRoutingConfig(server.URL, "http://tenants"), matcher.SetTenantRoutes)
+		broken.config.Token = "wrong"
+		assert.Error(t, broken.Refresh(context.Background()))
+		assert.Len(t, matcher.TenantRoutes(), before)
+	})
+}
+
+func TestTenantRegistryWatch(t *testing.T) {
+	fake := newFakeTenantRegistry(map[string]interface{}{"id": "t1", "slug": "acme"})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	matcher, err := NewRouteMatcher(nil)
+	require.NoError(t, err)
+	config := tenantRoutingConfig(server.URL, "http://tenants")
+	config.WatchChanges = true
+	registry := NewTenantRegistry(config, matcher.SetTenantRoutes)
+	registry.retryDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.Run(ctx)
+
+	assert.Equal(t, "", <-fake.since)
+	require.Eventually(t, func() bool { return len(matcher.TenantRoutes()) == 1 }, time.Second, 10*time.Millisecond)
+
+	fake.changes <- ": keep-alive\n\n"
+	fake.changes <- "id: 7\nevent: created\ndata: {\"sequence\": 7, \"action\": \"created\", \"id\": \"t2\", \"data\": {\"id\": \"t2\", \"slug\": \"globex\", \"domain\": \"globex.io\"}}\n\n"
+	require.Eventually(t, func() bool { return len(matcher.TenantRoutes()) == 3 }, time.Second, 10*time.Millisecond)
+
+	// A dropped stream resumes after the last change
+	close(fake.changes)
+	assert.Equal(t, "7", <-fake.since)
+}
+
+func TestTenantRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Tenant", r.Header.Get("X-Tenant-ID"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	matcher, err := NewRouteMatcher(nil)
+	require.NoError(t, err)
+	config := tenantRoutingConfig("http://registry", backend.URL)
+	registry := NewTenantRegistry(config, matcher.SetTenantRoutes)
+	registry.tenants = map[string]*Tenant{
+		"t1": {ID: "t1", Slug: "acme", Status: TenantActive},
+		"t2": {ID: "t2", Slug: "globex", Status: TenantSuspended},
+		"t3": {ID: "t3", Slug: "initech", Status: "deleting"},
+	}
+	matcher.SetTenantRoutes(registry.Routes())
+
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+	auth, err := NewAuthMiddleware(&AuthConfig{}, nil)
+	require.NoError(t, err)
+	g := newStateTestGateway(&Config{}, matcher)
+	g.proxy, g.auth = proxy, auth
+	router := gin.New()
+	router.NoRoute(g.proxyHandler())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	serve := func(host, accept, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", server.URL+"/dashboard", nil)
+		req.Host = host
+		req.Header.Set("X-Tenant-ID", "spoofed")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		w := httptest.NewRecorder()
+		w.Code = resp.StatusCode
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		io.Copy(w.Body, resp.Body)
+		return w
+	}
+
+	t.Run("Active", func(t *testing.T) {
+		w := serve("acme.backsaas.dev", "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "t1", w.Header().Get("X-Seen-Tenant"))
+	})
+
+	t.Run("Suspended", func(t *testing.T) {
+		w := serve("globex.backsaas.dev", "application/json", "")
+		assert.Equal(t, http.StatusLocked, w.Code)
+		assert.Contains(t, w.Body.String(), "TENANT_SUSPENDED")
+
+		w = serve("globex.backsaas.dev", "text/html,application/xhtml+xml", "")
+		assert.Equal(t, http.StatusLocked, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.True(t, strings.Contains(w.Body.String(), "<h1>423 Locked</h1>"))
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		w := serve("initech.backsaas.dev", "", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "TENANT_UNAVAILABLE")
+	})
+
+	t.Run("OtherTenantsToken", func(t *testing.T) {
+		config.Route.Auth = &AuthConfig{Enabled: true, Required: true, HeaderName: "Authorization", JWTSecret: "secret"}
+		defer func() { config.Route.Auth = nil }()
+		matcher.SetTenantRoutes(registry.Routes())
+		defer matcher.SetTenantRoutes(registry.Routes())
+
+		other, err := GenerateToken("u1", "u1@example.com", "t2", nil, nil, "secret", time.Hour)
+		require.NoError(t, err)
+		w := serve("acme.backsaas.dev", "", other)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "TENANT_MISMATCH")
+
+		own, err := GenerateToken("u1", "u1@example.com", "t1", nil, nil, "secret", time.Hour)
+		require.NoError(t, err)
+		w = serve("acme.backsaas.dev", "", own)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "t1", w.Header().Get("X-Seen-Tenant"))
+	})
+
+	t.Run("UnknownHost", func(t *testing.T) {
+		w := serve("unknown.backsaas.dev", "", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestTenantRoutingConfig(t *testing.T) {
+	config := &Config{
+		Port:          "8000",
+		JWTSecret:     "secret",
+		TenantRouting: TenantRoutingConfig{Enabled: true, Route: RouteConfig{Backend: BackendConfig{URL: "http://tenant-ui"}}},
+	}
+	setDefaults(config)
+	assert.Equal(t, "tenants", config.TenantRouting.Entity)
+	assert.Equal(t, time.Minute, config.TenantRouting.RefreshInterval)
+	assert.EqualError(t, validateConfig(config), "tenant_routing: registry_url is required")
+
+	config.TenantRouting.RegistryURL = "http://platform-api:8080"
+	assert.NoError(t, validateConfig(config))
+
+	config.TenantRouting.Route.Backend.URL = ""
+	assert.EqualError(t, validateConfig(config), "tenant_routing: route backend URL is required")
+}
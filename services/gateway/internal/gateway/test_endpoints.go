@@ -69,8 +69,8 @@ func (g *Gateway) handleEcho(c *gin.Context) {
 
 	// Try to match the route (for debugging)
 	var routeInfo *RouteInfo
-	if g.matcher != nil {
-		if route, err := g.matcher.Match(c.Request); err == nil {
+	if matcher := g.current().matcher; matcher != nil {
+		if route, err := matcher.Match(c.Request); err == nil {
 			routeInfo = &RouteInfo{
 				Description: route.Description,
 				PathPrefix:  route.PathPrefix,
@@ -112,12 +112,13 @@ func (g *Gateway) handleRouteTest(c *gin.Context) {
 	testReq.Host = c.Request.Host
 
 	// Try to match the route
-	if g.matcher == nil {
+	matcher := g.current().matcher
+	if matcher == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "route matcher not initialized"})
 		return
 	}
 
-	route, err := g.matcher.Match(testReq)
+	route, err := matcher.Match(testReq)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"path":  testPath,
@@ -144,7 +145,7 @@ func (g *Gateway) handleGatewayHealth(c *gin.Context) {
 		"status":    "healthy",
 		"timestamp": time.Now().Format(time.RFC3339),
 		"version":   "1.0.0",
-		"routes":    len(g.config.Routes),
+		"routes":    len(g.current().config.Routes),
 	}
 
 	// Test Redis connection if available
@@ -162,8 +163,9 @@ func (g *Gateway) handleGatewayHealth(c *gin.Context) {
 
 // handleRouteList returns all configured routes
 func (g *Gateway) handleRouteList(c *gin.Context) {
-	routes := make([]RouteInfo, len(g.config.Routes))
-	for i, route := range g.config.Routes {
+	config := g.current().config
+	routes := make([]RouteInfo, len(config.Routes))
+	for i, route := range config.Routes {
 		routes[i] = RouteInfo{
 			Description: route.Description,
 			PathPrefix:  route.PathPrefix,
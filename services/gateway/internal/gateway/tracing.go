@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// tracerName is the instrumentation scope of the gateway's spans
+const tracerName = "github.com/backsaas/platform/services/gateway/internal/gateway"
+
+// traceContext reads and writes W3C traceparent and tracestate headers
+var traceContext = propagation.TraceContext{}
+
+// newTracerProvider creates the tracer provider for a validated monitoring
+// config, and returns the exporter its spans go to. The memory exporter,
+// for tests, receives each span as it ends; the others get them in batches.
+func newTracerProvider(config *MonitoringConfig) (*sdktrace.TracerProvider, sdktrace.SpanExporter, error) {
+	var processor sdktrace.SpanProcessor
+	var exporter sdktrace.SpanExporter
+	switch config.TracingExporter {
+	case "otlp":
+		otlp, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(strings.TrimSuffix(config.TracingEndpoint, "/")+"/v1/traces"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = otlp
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case "", "stdout":
+		stdout, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = stdout
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case "memory":
+		exporter = tracetest.NewInMemoryExporter()
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q", config.TracingExporter)
+	}
+
+	ratio := config.TracingSampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.TracingService))),
+	)
+	return provider, exporter, nil
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceparentHeader carries a request's W3C trace context
+const traceparentHeader = "traceparent"
+
+// traceBackend records the traceparent of each request it gets
+type traceBackend struct {
+	*httptest.Server
+	mu           sync.Mutex
+	traceparents []string
+}
+
+func newTraceBackend(t *testing.T, status int) *traceBackend {
+	backend := &traceBackend{}
+	backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backend.mu.Lock()
+		backend.traceparents = append(backend.traceparents, r.Header.Get(traceparentHeader))
+		backend.mu.Unlock()
+		w.Header().Set("X-Request-ID-Seen", r.Header.Get("X-Request-ID"))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func (b *traceBackend) received() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.traceparents...)
+}
+
+func TestGatewayTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := &MonitoringConfig{TracingEnabled: true, TracingService: "gateway", TracingExporter: "memory"}
+	monitoring, err := NewMonitoringMiddleware(config)
+	require.NoError(t, err)
+	exporter := monitoring.exporter.(*tracetest.InMemoryExporter)
+
+	bad := newTraceBackend(t, http.StatusBadGateway)
+	good := newTraceBackend(t, http.StatusOK)
+	route := &RouteConfig{Description: "API", Backend: BackendConfig{
+		URLs:       []string{bad.URL, good.URL},
+		MaxRetries: 1,
+		Retry:      RetryConfig{BackoffBase: time.Millisecond},
+	}}
+	setBackendDefaults(&route.Backend)
+	proxy, err := NewProxyMiddleware()
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(monitoring.Tracing())
+	router.NoRoute(func(c *gin.Context) {
+		if c.Request.URL.Path == "/missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Set("route", route)
+		c.Set("tenant_id", "t1")
+		proxy.ProxyRequest(c, route)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	t.Run("ContinuesTrace", func(t *testing.T) {
+		exporter.Reset()
+		req, _ := http.NewRequest("GET", server.URL+"/orders", nil)
+		req.Header.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// The request ID is the trace ID, so logs and traces can be joined
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", resp.Header.Get("X-Request-ID"))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 3)
+		server, failed, succeeded := spans[2], spans[0], spans[1]
+		service, _ := server.Resource.Set().Value("service.name")
+		traceID := server.SpanContext.TraceID()
+		assert.Equal(t, "GET API", server.Name)
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+		assert.Equal(t, "gateway", service.AsString())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+		assert.Equal(t, "t1", spanAttribute(server, "tenant.id").AsString())
+		assert.Equal(t, int64(http.StatusOK), spanAttribute(server, "http.status_code").AsInt64())
+
+		for _, span := range []tracetest.SpanStub{failed, succeeded} {
+			assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+			assert.Equal(t, traceID, span.SpanContext.TraceID())
+			assert.Equal(t, server.SpanContext.SpanID(), span.Parent.SpanID())
+		}
+		assert.Equal(t, bad.URL, spanAttribute(failed, "server.address").AsString())
+		assert.Equal(t, codes.Error, failed.Status.Code)
+		assert.Equal(t, good.URL, spanAttribute(succeeded, "server.address").AsString())
+		assert.Equal(t, int64(1), spanAttribute(succeeded, "http.resend_count").AsInt64())
+
+		// Each backend sees its own attempt's span as the parent
+		require.Len(t, bad.received(), 1)
+		require.Len(t, good.received(), 1)
+		assert.Equal(t, "00-"+traceID.String()+"-"+failed.SpanContext.SpanID().String()+"-01", bad.received()[0])
+		assert.Equal(t, "00-"+traceID.String()+"-"+succeeded.SpanContext.SpanID().String()+"-01", good.received()[0])
+	})
+
+	t.Run("StartsTrace", func(t *testing.T) {
+		exporter.Reset()
+		status, _ := send(t, "GET", server.URL+"/missing", "")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "GET unmatched", spans[0].Name)
+		assert.False(t, spans[0].Parent.IsValid())
+		assert.True(t, spans[0].SpanContext.TraceID().IsValid())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		monitoring, err := NewMonitoringMiddleware(&MonitoringConfig{})
+		require.NoError(t, err)
+		assert.Nil(t, monitoring.Tracer())
+		assert.NoError(t, monitoring.Shutdown(context.Background()))
+
+		backend := newTraceBackend(t, http.StatusOK)
+		untraced := &RouteConfig{Backend: BackendConfig{URL: backend.URL}}
+		server, _ := newProxyServer(t, untraced)
+
+		// The caller's traceparent is passed through unchanged
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, backend.received())
+		assert.Regexp(t, "^[0-9a-f]{32}$", resp.Header.Get("X-Request-ID"))
+	})
+}
+
+// spanAttribute returns the value of a span's attribute
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	attributes := attribute.NewSet(span.Attributes...)
+	value, _ := attributes.Value(key)
+	return value
+}
+
+func TestTracingConfigValidation(t *testing.T) {
+	valid := func() *Config {
+		config := &Config{Port: "8080", JWTSecret: "secret"}
+		config.Monitoring.TracingEnabled = true
+		setDefaults(config)
+		return config
+	}
+
+	config := valid()
+	require.NoError(t, validateConfig(config))
+	assert.Equal(t, "stdout", config.Monitoring.TracingExporter)
+	assert.Equal(t, "backsaas-gateway", config.Monitoring.TracingService)
+	assert.Equal(t, float64(1), config.Monitoring.TracingSampleRatio)
+
+	config = &Config{Port: "8080", JWTSecret: "secret"}
+	config.Monitoring.TracingEndpoint = "http://otel-collector:4318"
+	setDefaults(config)
+	assert.Equal(t, "otlp", config.Monitoring.TracingExporter)
+
+	for name, mutate := range map[string]func(*MonitoringConfig){
+		"UnknownExporter":  func(m *MonitoringConfig) { m.TracingExporter = "zipkin" },
+		"OTLPWithoutURL":   func(m *MonitoringConfig) { m.TracingExporter = "otlp" },
+		"SampleRatioAbove": func(m *MonitoringConfig) { m.TracingSampleRatio = 1.5 },
+	} {
+		config := valid()
+		mutate(&config.Monitoring)
+		assert.Error(t, validateConfig(config), name)
+	}
+}
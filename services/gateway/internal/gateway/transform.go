@@ -0,0 +1,446 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultMaxTransformBytes is the largest body transformed when a route
+// doesn't set max_body_bytes
+const defaultMaxTransformBytes = 1 << 20
+
+// templatePattern matches a template such as {{tenant_id}}
+var templatePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// templateVariables are the templates available besides claims.<name>
+var templateVariables = map[string]bool{
+	"tenant_id":  true,
+	"user_id":    true,
+	"user_email": true,
+	"request_id": true,
+}
+
+// replacementGroup matches a capture group reference in a path replacement
+var replacementGroup = regexp.MustCompile(`\$(\{[^}]*\}|[A-Za-z0-9_]+)`)
+
+// validateTransform checks a route's transformations and compiles its path
+// pattern
+func validateTransform(transform *TransformConfig) error {
+	if transform.RewritePath != "" && !strings.HasPrefix(transform.RewritePath, "/") {
+		return fmt.Errorf("transform: rewrite_path must start with /")
+	}
+	if transform.PathPattern != "" {
+		if transform.RewritePath != "" {
+			return fmt.Errorf("transform: rewrite_path and path_pattern can't both be set")
+		}
+		pattern, err := regexp.Compile(transform.PathPattern)
+		if err != nil {
+			return fmt.Errorf("transform: invalid path_pattern: %w", err)
+		}
+		if err := validateReplacement(pattern, transform.PathReplacement); err != nil {
+			return err
+		}
+		transform.pathPattern = pattern
+	} else if transform.PathReplacement != "" {
+		return fmt.Errorf("transform: path_replacement needs a path_pattern")
+	}
+
+	for name, value := range transform.AddHeaders {
+		if err := validateTemplate(value); err != nil {
+			return fmt.Errorf("transform: add_headers %s: %w", name, err)
+		}
+	}
+	for name, value := range transform.AddResponseHeaders {
+		if err := validateTemplate(value); err != nil {
+			return fmt.Errorf("transform: add_response_headers %s: %w", name, err)
+		}
+	}
+
+	for _, path := range transform.RemoveBodyFields {
+		if !validFieldPath(path) {
+			return fmt.Errorf("transform: invalid remove_body_fields path %q", path)
+		}
+	}
+	for path, value := range transform.AddBodyFields {
+		if !validFieldPath(path) {
+			return fmt.Errorf("transform: invalid add_body_fields path %q", path)
+		}
+		if text, ok := value.(string); ok {
+			if err := validateTemplate(text); err != nil {
+				return fmt.Errorf("transform: add_body_fields %s: %w", path, err)
+			}
+		}
+	}
+
+	if envelope := transform.ResponseEnvelope; envelope != nil {
+		if len(envelope.Fields) == 0 && len(envelope.Static) == 0 {
+			return fmt.Errorf("transform: response_envelope needs fields or static fields")
+		}
+		for path, source := range envelope.Fields {
+			if !validFieldPath(path) || (source != "." && !validFieldPath(source)) {
+				return fmt.Errorf("transform: invalid response_envelope field %q: %q", path, source)
+			}
+		}
+		for path := range envelope.Static {
+			if !validFieldPath(path) {
+				return fmt.Errorf("transform: invalid response_envelope static field %q", path)
+			}
+		}
+	}
+
+	if transform.MaxBodyBytes < 0 {
+		return fmt.Errorf("transform: max_body_bytes must be positive")
+	}
+	return nil
+}
+
+// validateReplacement checks that a path replacement refers only to
+// capture groups its pattern has
+func validateReplacement(pattern *regexp.Regexp, replacement string) error {
+	for _, match := range replacementGroup.FindAllStringSubmatch(replacement, -1) {
+		group := strings.Trim(match[1], "{}")
+		if n, err := strconv.Atoi(group); err == nil {
+			if n > pattern.NumSubexp() {
+				return fmt.Errorf("transform: path_replacement refers to group $%d, but path_pattern has %d", n, pattern.NumSubexp())
+			}
+		} else if pattern.SubexpIndex(group) < 0 {
+			return fmt.Errorf("transform: path_replacement refers to group %q, which path_pattern doesn't name", group)
+		}
+	}
+	return nil
+}
+
+// validateTemplate checks that a value uses only known templates
+func validateTemplate(value string) error {
+	for _, match := range templatePattern.FindAllStringSubmatch(value, -1) {
+		name := match[1]
+		if !templateVariables[name] && !(strings.HasPrefix(name, "claims.") && len(name) > len("claims.")) {
+			return fmt.Errorf("unknown template {{%s}}", name)
+		}
+	}
+	return nil
+}
+
+// validFieldPath reports whether a dot path has no empty parts
+func validFieldPath(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// renderTemplate fills a value's templates from the request. Templates
+// without a value, such as {{user_id}} on an anonymous request, are empty.
+func renderTemplate(value string, c *gin.Context, route *RouteConfig) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	return templatePattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := templatePattern.FindStringSubmatch(match)[1]
+		switch name {
+		case "tenant_id":
+			if route.Tenant != nil {
+				return route.Tenant.ID
+			}
+			return c.GetString("tenant_id")
+		case "user_id":
+			return c.GetString("user_id")
+		case "user_email":
+			return c.GetString("user_email")
+		case "request_id":
+			return requestID(c)
+		}
+		claims, _ := c.Get("jwt_claims")
+		if claims, ok := claims.(jwt.MapClaims); ok {
+			if claim, ok := claims[strings.TrimPrefix(name, "claims.")]; ok && claim != nil {
+				return fmt.Sprint(claim)
+			}
+		}
+		return ""
+	})
+}
+
+// rewritePath applies the route's rewrite_path or path_pattern to a path
+func (t *TransformConfig) rewritePath(path string) string {
+	if t.RewritePath != "" {
+		return t.RewritePath
+	}
+	if t.PathPattern == "" {
+		return path
+	}
+
+	pattern := t.pathPattern
+	if pattern == nil {
+		// Routes that weren't validated, such as those built in code
+		var err error
+		if pattern, err = regexp.Compile(t.PathPattern); err != nil {
+			return path
+		}
+	}
+	if !pattern.MatchString(path) {
+		return path
+	}
+	path = pattern.ReplaceAllString(path, t.PathReplacement)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// maxBodyBytes returns the largest body the route transforms
+func (t *TransformConfig) maxBodyBytes() int64 {
+	if t.MaxBodyBytes > 0 {
+		return t.MaxBodyBytes
+	}
+	return defaultMaxTransformBytes
+}
+
+// isJSON reports whether a Content-Type is JSON
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// transformRequestBody removes and sets the route's body fields in a JSON
+// request body. Bodies too large to transform are refused with 413, and
+// bodies that aren't JSON objects with 400.
+func transformRequestBody(c *gin.Context, transform *TransformConfig, route *RouteConfig) bool {
+	req := c.Request
+	if len(transform.RemoveBodyFields) == 0 && len(transform.AddBodyFields) == 0 {
+		return true
+	}
+	if req.Body == nil || req.Body == http.NoBody || !isJSON(req.Header.Get("Content-Type")) {
+		return true
+	}
+
+	limit := transform.maxBodyBytes()
+	data, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	req.Body.Close()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+		return false
+	}
+	if int64(len(data)) > limit {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "Request body too large",
+			"message": fmt.Sprintf("Request bodies on this route may be at most %d bytes.", limit),
+			"code":    "BODY_TOO_LARGE",
+		})
+		return false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		setRequestBody(req, data)
+		return true
+	}
+
+	body, err := decodeJSONObject(data)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": "The request body must be a JSON object.",
+			"code":    "INVALID_JSON_BODY",
+		})
+		return false
+	}
+	for _, path := range transform.RemoveBodyFields {
+		removeField(body, path)
+	}
+	for path, value := range transform.AddBodyFields {
+		if text, ok := value.(string); ok {
+			value = renderTemplate(text, c, route)
+		}
+		setField(body, path, value)
+	}
+
+	data, err = encodeJSON(body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+		return false
+	}
+	setRequestBody(req, data)
+	return true
+}
+
+// setRequestBody replaces a request's body
+func setRequestBody(req *http.Request, data []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+}
+
+// transformResponse applies the route's response header changes and
+// response envelope to the backend's response
+func transformResponse(resp *http.Response, transform *TransformConfig, c *gin.Context, route *RouteConfig) {
+	for _, name := range transform.RemoveResponseHeaders {
+		resp.Header.Del(name)
+	}
+	for name, value := range transform.AddResponseHeaders {
+		if value = renderTemplate(value, c, route); value != "" {
+			resp.Header.Set(name, value)
+		}
+	}
+
+	if transform.ResponseEnvelope != nil {
+		if err := applyEnvelope(resp, transform); err != nil {
+			log.Printf("Response of route %s passed on without its envelope: %v", routeLabel(route), err)
+		}
+	}
+}
+
+// applyEnvelope reshapes a successful JSON response. Other responses, and
+// those too large to transform, pass unchanged.
+func applyEnvelope(resp *http.Response, transform *TransformConfig) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if !isJSON(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return fmt.Errorf("response is %s encoded", encoding)
+	}
+
+	limit := transform.maxBodyBytes()
+	if resp.ContentLength > limit {
+		return fmt.Errorf("response of %d bytes is over the %d byte limit", resp.ContentLength, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > limit {
+		// Pass on what was read and the rest
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return fmt.Errorf("response is over the %d byte limit", limit)
+	}
+	resp.Body.Close()
+	setResponseBody(resp, data)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return fmt.Errorf("invalid JSON response: %w", err)
+	}
+
+	envelope := make(map[string]interface{})
+	for path, source := range transform.ResponseEnvelope.Fields {
+		if value, ok := getField(body, source); ok {
+			setField(envelope, path, value)
+		}
+	}
+	for path, value := range transform.ResponseEnvelope.Static {
+		setField(envelope, path, value)
+	}
+
+	data, err = encodeJSON(envelope)
+	if err != nil {
+		return err
+	}
+	setResponseBody(resp, data)
+
+	// The backend's validator no longer describes the body
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// setResponseBody replaces a response's body
+func setResponseBody(resp *http.Response, data []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	resp.TransferEncoding = nil
+}
+
+// decodeJSONObject decodes a JSON object, keeping numbers as written
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	if body == nil || decoder.More() {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	return body, nil
+}
+
+// encodeJSON encodes a value without escaping HTML characters
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// getField returns the value at a dot path, or the whole document for "."
+func getField(doc interface{}, path string) (interface{}, bool) {
+	if path == "." {
+		return doc, true
+	}
+	for _, part := range strings.Split(path, ".") {
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setField sets the value at a dot path, creating the objects on the way
+// and replacing values that aren't objects
+func setField(object map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := object[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			object[part] = child
+		}
+		object = child
+	}
+	object[parts[len(parts)-1]] = value
+}
+
+// removeField removes the value at a dot path, if there is one
+func removeField(object map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := object[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = child
+	}
+	delete(object, parts[len(parts)-1])
+}
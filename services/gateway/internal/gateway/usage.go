@@ -0,0 +1,322 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Usage periods are calendar days and months in UTC
+const (
+	usageDayLayout   = "2006-01-02"
+	usageMonthLayout = "2006-01"
+)
+
+// DailyUsage is a tenant's metered usage for one day
+type DailyUsage struct {
+	Date     string `json:"date"`      // YYYY-MM-DD, UTC
+	Requests int64  `json:"requests"`  // Requests counted against the quota
+	Errors   int64  `json:"errors"`    // Counted requests that failed with a 5xx
+	Rejected int64  `json:"rejected"`  // Requests refused for exceeding a quota
+	BytesIn  int64  `json:"bytes_in"`  // Request bodies
+	BytesOut int64  `json:"bytes_out"` // Response bodies
+}
+
+// add adds other's counts to u
+func (u *DailyUsage) add(other DailyUsage) {
+	u.Requests += other.Requests
+	u.Errors += other.Errors
+	u.Rejected += other.Rejected
+	u.BytesIn += other.BytesIn
+	u.BytesOut += other.BytesOut
+}
+
+// ResourceUsage is what a tenant stores, as last reported by the platform.
+// The gateway doesn't see stored data, so it can't meter this itself.
+type ResourceUsage struct {
+	StorageBytes int64     `json:"storage_bytes"`
+	Entities     int64     `json:"entities"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UsageStore keeps each tenant's monthly request count, its usage per day
+// and its reported resources
+type UsageStore interface {
+	// CountRequest counts a request in the tenant's month unless the month
+	// already has limit requests; a limit of 0 means no limit. It returns
+	// the month's count and whether the request was counted.
+	CountRequest(ctx context.Context, tenantID string, at time.Time, limit int64) (int64, bool, error)
+
+	// MonthRequests returns the requests counted in the month of at
+	MonthRequests(ctx context.Context, tenantID string, at time.Time) (int64, error)
+
+	// Record adds usage to the tenant's day
+	Record(ctx context.Context, tenantID string, at time.Time, usage DailyUsage) error
+
+	// Daily returns the tenant's usage for the days from from to to, both
+	// included, skipping days without usage
+	Daily(ctx context.Context, tenantID string, from, to time.Time) ([]DailyUsage, error)
+
+	// SetResources replaces the tenant's reported resources
+	SetResources(ctx context.Context, tenantID string, resources ResourceUsage) error
+
+	// Resources returns the tenant's reported resources
+	Resources(ctx context.Context, tenantID string) (ResourceUsage, error)
+}
+
+// usageDays returns the UTC days from from to to, both included
+func usageDays(from, to time.Time) []string {
+	from, to = startOfDay(from), startOfDay(to)
+	var days []string
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(usageDayLayout))
+	}
+	return days
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// RedisUsageStore keeps usage in Redis, shared by every gateway instance:
+//
+//	quota:requests:{tenant}:{YYYY-MM}  monthly request count
+//	usage:daily:{tenant}:{YYYY-MM-DD}  hash of the day's DailyUsage counts
+//	usage:resources:{tenant}           hash of the reported ResourceUsage
+//
+// Counts expire once they are older than the retention period.
+type RedisUsageStore struct {
+	client    *redis.Client
+	retention time.Duration
+}
+
+// NewRedisUsageStore creates a store keeping usage for retention
+func NewRedisUsageStore(client *redis.Client, retention time.Duration) *RedisUsageStore {
+	return &RedisUsageStore{client: client, retention: retention}
+}
+
+// countRequestScript increments the month's count unless that takes it past
+// the limit (ARGV[1], 0 for none), and sets the count to expire at ARGV[2]
+var countRequestScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+local limit = tonumber(ARGV[1])
+if limit > 0 and count > limit then
+	redis.call('DECR', KEYS[1])
+	return {count - 1, 0}
+end
+return {count, 1}
+`)
+
+func (s *RedisUsageStore) monthKey(tenantID string, at time.Time) string {
+	return "quota:requests:" + tenantID + ":" + at.UTC().Format(usageMonthLayout)
+}
+
+func (s *RedisUsageStore) dayKey(tenantID, day string) string {
+	return "usage:daily:" + tenantID + ":" + day
+}
+
+// CountRequest implements UsageStore
+func (s *RedisUsageStore) CountRequest(ctx context.Context, tenantID string, at time.Time, limit int64) (int64, bool, error) {
+	expireAt := startOfMonth(at).AddDate(0, 1, 0).Add(s.retention)
+	result, err := countRequestScript.Run(ctx, s.client, []string{s.monthKey(tenantID, at)}, limit, expireAt.Unix()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result) != 2 {
+		return 0, false, fmt.Errorf("unexpected quota script result %v", result)
+	}
+	return result[0], result[1] == 1, nil
+}
+
+// MonthRequests implements UsageStore
+func (s *RedisUsageStore) MonthRequests(ctx context.Context, tenantID string, at time.Time) (int64, error) {
+	count, err := s.client.Get(ctx, s.monthKey(tenantID, at)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+// Record implements UsageStore
+func (s *RedisUsageStore) Record(ctx context.Context, tenantID string, at time.Time, usage DailyUsage) error {
+	key := s.dayKey(tenantID, at.UTC().Format(usageDayLayout))
+	pipe := s.client.Pipeline()
+	for field, value := range usageFields(usage) {
+		if value != 0 {
+			pipe.HIncrBy(ctx, key, field, value)
+		}
+	}
+	pipe.ExpireAt(ctx, key, startOfDay(at).AddDate(0, 0, 1).Add(s.retention))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Daily implements UsageStore
+func (s *RedisUsageStore) Daily(ctx context.Context, tenantID string, from, to time.Time) ([]DailyUsage, error) {
+	days := usageDays(from, to)
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(days))
+	for i, day := range days {
+		cmds[i] = pipe.HGetAll(ctx, s.dayKey(tenantID, day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	usage := []DailyUsage{}
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		values := make(map[string]int64, len(fields))
+		for field, value := range fields {
+			values[field], _ = strconv.ParseInt(value, 10, 64)
+		}
+		usage = append(usage, usageFromFields(days[i], values))
+	}
+	return usage, nil
+}
+
+// SetResources implements UsageStore
+func (s *RedisUsageStore) SetResources(ctx context.Context, tenantID string, resources ResourceUsage) error {
+	return s.client.HSet(ctx, "usage:resources:"+tenantID,
+		"storage_bytes", resources.StorageBytes,
+		"entities", resources.Entities,
+		"updated_at", resources.UpdatedAt.UTC().Format(time.RFC3339),
+	).Err()
+}
+
+// Resources implements UsageStore
+func (s *RedisUsageStore) Resources(ctx context.Context, tenantID string) (ResourceUsage, error) {
+	fields, err := s.client.HGetAll(ctx, "usage:resources:"+tenantID).Result()
+	if err != nil {
+		return ResourceUsage{}, err
+	}
+	var resources ResourceUsage
+	resources.StorageBytes, _ = strconv.ParseInt(fields["storage_bytes"], 10, 64)
+	resources.Entities, _ = strconv.ParseInt(fields["entities"], 10, 64)
+	resources.UpdatedAt, _ = time.Parse(time.RFC3339, fields["updated_at"])
+	return resources, nil
+}
+
+// usageFields maps a day's counts to the hash fields they are stored in
+func usageFields(usage DailyUsage) map[string]int64 {
+	return map[string]int64{
+		"requests":  usage.Requests,
+		"errors":    usage.Errors,
+		"rejected":  usage.Rejected,
+		"bytes_in":  usage.BytesIn,
+		"bytes_out": usage.BytesOut,
+	}
+}
+
+func usageFromFields(day string, fields map[string]int64) DailyUsage {
+	return DailyUsage{
+		Date:     day,
+		Requests: fields["requests"],
+		Errors:   fields["errors"],
+		Rejected: fields["rejected"],
+		BytesIn:  fields["bytes_in"],
+		BytesOut: fields["bytes_out"],
+	}
+}
+
+// MemoryUsageStore keeps usage in memory, for tests and gateways without
+// Redis. Usage isn't shared between instances and is lost on restart.
+type MemoryUsageStore struct {
+	mu        sync.Mutex
+	months    map[string]int64
+	days      map[string]map[string]*DailyUsage // tenant, then day
+	resources map[string]ResourceUsage
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{
+		months:    make(map[string]int64),
+		days:      make(map[string]map[string]*DailyUsage),
+		resources: make(map[string]ResourceUsage),
+	}
+}
+
+func (s *MemoryUsageStore) monthKey(tenantID string, at time.Time) string {
+	return tenantID + ":" + at.UTC().Format(usageMonthLayout)
+}
+
+// CountRequest implements UsageStore
+func (s *MemoryUsageStore) CountRequest(ctx context.Context, tenantID string, at time.Time, limit int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.monthKey(tenantID, at)
+	if limit > 0 && s.months[key] >= limit {
+		return s.months[key], false, nil
+	}
+	s.months[key]++
+	return s.months[key], true, nil
+}
+
+// MonthRequests implements UsageStore
+func (s *MemoryUsageStore) MonthRequests(ctx context.Context, tenantID string, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.months[s.monthKey(tenantID, at)], nil
+}
+
+// Record implements UsageStore
+func (s *MemoryUsageStore) Record(ctx context.Context, tenantID string, at time.Time, usage DailyUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	days := s.days[tenantID]
+	if days == nil {
+		days = make(map[string]*DailyUsage)
+		s.days[tenantID] = days
+	}
+	day := at.UTC().Format(usageDayLayout)
+	if days[day] == nil {
+		days[day] = &DailyUsage{Date: day}
+	}
+	days[day].add(usage)
+	return nil
+}
+
+// Daily implements UsageStore
+func (s *MemoryUsageStore) Daily(ctx context.Context, tenantID string, from, to time.Time) ([]DailyUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := []DailyUsage{}
+	for _, day := range usageDays(from, to) {
+		if recorded := s.days[tenantID][day]; recorded != nil {
+			usage = append(usage, *recorded)
+		}
+	}
+	return usage, nil
+}
+
+// SetResources implements UsageStore
+func (s *MemoryUsageStore) SetResources(ctx context.Context, tenantID string, resources ResourceUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources[tenantID] = resources
+	return nil
+}
+
+// Resources implements UsageStore
+func (s *MemoryUsageStore) Resources(ctx context.Context, tenantID string) (ResourceUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resources[tenantID], nil
+}
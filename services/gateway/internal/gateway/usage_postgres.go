@@ -0,0 +1,222 @@
+package gateway
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresUsageSchema creates the usage tables. Days and months are keyed
+// by their first day in UTC.
+const postgresUsageSchema = `
+CREATE TABLE IF NOT EXISTS gateway_usage_monthly (
+	tenant_id TEXT NOT NULL,
+	month     DATE NOT NULL,
+	requests  BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, month)
+);
+CREATE TABLE IF NOT EXISTS gateway_usage_daily (
+	tenant_id TEXT NOT NULL,
+	day       DATE NOT NULL,
+	requests  BIGINT NOT NULL DEFAULT 0,
+	errors    BIGINT NOT NULL DEFAULT 0,
+	rejected  BIGINT NOT NULL DEFAULT 0,
+	bytes_in  BIGINT NOT NULL DEFAULT 0,
+	bytes_out BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, day)
+);
+CREATE TABLE IF NOT EXISTS gateway_tenant_resources (
+	tenant_id     TEXT PRIMARY KEY,
+	storage_bytes BIGINT NOT NULL,
+	entities      BIGINT NOT NULL,
+	updated_at    TIMESTAMPTZ NOT NULL
+);
+`
+
+// PostgresUsageStore keeps usage in Postgres, so daily aggregates survive
+// Redis restarts and evictions and can be billed from. Every gateway
+// instance shares the tables; counts are kept with atomic upserts.
+type PostgresUsageStore struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+// NewPostgresUsageStore creates a store over db keeping usage for
+// retention. Call Migrate to create the tables.
+func NewPostgresUsageStore(db *sql.DB, retention time.Duration) *PostgresUsageStore {
+	return &PostgresUsageStore{db: db, retention: retention}
+}
+
+// OpenPostgresUsageStore connects to the database at url and creates the
+// usage tables if needed
+func OpenPostgresUsageStore(ctx context.Context, url string, retention time.Duration) (*PostgresUsageStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to usage database: %w", err)
+	}
+	store := NewPostgresUsageStore(db, retention)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Migrate creates the usage tables
+func (s *PostgresUsageStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, postgresUsageSchema); err != nil {
+		return fmt.Errorf("failed to create usage tables: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *PostgresUsageStore) Close() error {
+	return s.db.Close()
+}
+
+// CountRequest implements UsageStore. The upsert only increments while the
+// month is under the limit, so concurrent gateways can't exceed it.
+func (s *PostgresUsageStore) CountRequest(ctx context.Context, tenantID string, at time.Time, limit int64) (int64, bool, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO gateway_usage_monthly (tenant_id, month, requests) VALUES ($1, $2, 1)
+		ON CONFLICT (tenant_id, month) DO UPDATE SET requests = gateway_usage_monthly.requests + 1
+		WHERE $3 = 0 OR gateway_usage_monthly.requests < $3
+		RETURNING requests`,
+		tenantID, usageMonth(at), limit).Scan(&count)
+	if err == sql.ErrNoRows {
+		count, err = s.MonthRequests(ctx, tenantID, at)
+		return count, false, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return count, true, nil
+}
+
+// MonthRequests implements UsageStore
+func (s *PostgresUsageStore) MonthRequests(ctx context.Context, tenantID string, at time.Time) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT requests FROM gateway_usage_monthly WHERE tenant_id = $1 AND month = $2`,
+		tenantID, usageMonth(at)).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return count, err
+}
+
+// Record implements UsageStore
+func (s *PostgresUsageStore) Record(ctx context.Context, tenantID string, at time.Time, usage DailyUsage) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO gateway_usage_daily (tenant_id, day, requests, errors, rejected, bytes_in, bytes_out)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant_id, day) DO UPDATE SET
+			requests  = gateway_usage_daily.requests + EXCLUDED.requests,
+			errors    = gateway_usage_daily.errors + EXCLUDED.errors,
+			rejected  = gateway_usage_daily.rejected + EXCLUDED.rejected,
+			bytes_in  = gateway_usage_daily.bytes_in + EXCLUDED.bytes_in,
+			bytes_out = gateway_usage_daily.bytes_out + EXCLUDED.bytes_out`,
+		tenantID, usageDay(at), usage.Requests, usage.Errors, usage.Rejected, usage.BytesIn, usage.BytesOut)
+	return err
+}
+
+// Daily implements UsageStore
+func (s *PostgresUsageStore) Daily(ctx context.Context, tenantID string, from, to time.Time) ([]DailyUsage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD'), requests, errors, rejected, bytes_in, bytes_out
+		FROM gateway_usage_daily
+		WHERE tenant_id = $1 AND day BETWEEN $2 AND $3
+		ORDER BY day`,
+		tenantID, usageDay(from), usageDay(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []DailyUsage{}
+	for rows.Next() {
+		var day DailyUsage
+		if err := rows.Scan(&day.Date, &day.Requests, &day.Errors, &day.Rejected, &day.BytesIn, &day.BytesOut); err != nil {
+			return nil, err
+		}
+		usage = append(usage, day)
+	}
+	return usage, rows.Err()
+}
+
+// SetResources implements UsageStore
+func (s *PostgresUsageStore) SetResources(ctx context.Context, tenantID string, resources ResourceUsage) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO gateway_tenant_resources (tenant_id, storage_bytes, entities, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			storage_bytes = EXCLUDED.storage_bytes,
+			entities      = EXCLUDED.entities,
+			updated_at    = EXCLUDED.updated_at`,
+		tenantID, resources.StorageBytes, resources.Entities, resources.UpdatedAt.UTC())
+	return err
+}
+
+// Resources implements UsageStore
+func (s *PostgresUsageStore) Resources(ctx context.Context, tenantID string) (ResourceUsage, error) {
+	var resources ResourceUsage
+	err := s.db.QueryRowContext(ctx,
+		`SELECT storage_bytes, entities, updated_at FROM gateway_tenant_resources WHERE tenant_id = $1`,
+		tenantID).Scan(&resources.StorageBytes, &resources.Entities, &resources.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ResourceUsage{}, nil
+	}
+	resources.UpdatedAt = resources.UpdatedAt.UTC()
+	return resources, err
+}
+
+// usageDay and usageMonth return the DATE keys of at's day and month
+func usageDay(at time.Time) string {
+	return at.UTC().Format(usageDayLayout)
+}
+
+func usageMonth(at time.Time) string {
+	return startOfMonth(at).Format(usageDayLayout)
+}
+
+// Prune deletes the days and months that ended longer than the retention
+// period before now. A retention of 0 keeps usage forever.
+func (s *PostgresUsageStore) Prune(ctx context.Context, now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-s.retention)
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM gateway_usage_daily WHERE day < $1`, usageDay(cutoff.AddDate(0, 0, -1))); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM gateway_usage_monthly WHERE month < $1`, usageMonth(cutoff.AddDate(0, -1, 0)))
+	return err
+}
+
+// RunPruning prunes expired usage every interval until ctx is done
+func (s *PostgresUsageStore) RunPruning(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Prune(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to prune usage: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket close codes the gateway sends when it closes a connection
+const (
+	wsCloseNormal    = 1000 // The connection was idle
+	wsCloseGoingAway = 1001 // The gateway is shutting down
+)
+
+const wsOpClose = 0x8
+
+// errWebSocketsClosed: the gateway is shutting down and takes no new
+// WebSocket connections
+var errWebSocketsClosed = errors.New("gateway is shutting down")
+
+// wsFrameHeader is a frame's header as read from the wire, forwarded as is
+type wsFrameHeader struct {
+	raw    []byte
+	opcode byte
+	length uint64 // Payload length
+}
+
+// readFrameHeader reads the header of the next frame. Payloads aren't
+// unmasked: frames pass through the gateway unchanged.
+func readFrameHeader(r *bufio.Reader) (wsFrameHeader, error) {
+	var header wsFrameHeader
+	raw := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return header, err
+	}
+	header.opcode = raw[0] & 0x0f
+
+	extended := 0
+	switch length := raw[1] & 0x7f; length {
+	case 126:
+		extended = 2
+	case 127:
+		extended = 8
+	default:
+		header.length = uint64(length)
+	}
+	masked := raw[1]&0x80 != 0
+	rest := extended
+	if masked {
+		rest += 4
+	}
+	raw = raw[:2+rest]
+	if _, err := io.ReadFull(r, raw[2:]); err != nil {
+		return header, err
+	}
+	switch extended {
+	case 2:
+		header.length = uint64(binary.BigEndian.Uint16(raw[2:4]))
+	case 8:
+		header.length = binary.BigEndian.Uint64(raw[2:10])
+	}
+	header.raw = raw
+	return header, nil
+}
+
+// closeFrame builds a close frame. Frames the gateway sends to a backend
+// are masked, as a client's must be.
+func closeFrame(code int, reason string, masked bool) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	frame := []byte{0x80 | wsOpClose, byte(len(payload))}
+	if masked {
+		var key [4]byte
+		rand.Read(key[:])
+		frame[1] |= 0x80
+		frame = append(frame, key[:]...)
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return append(frame, payload...)
+}
+
+// wsEndpoint is one side of a tunnel. Frames are written whole under mu, so
+// the gateway's own close frame never lands inside a forwarded one.
+type wsEndpoint struct {
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	mu     sync.Mutex
+	masked bool // Frames written to it are masked: it's the backend
+
+	// Set once it has answered the gateway's close frame
+	closed atomic.Bool
+}
+
+func (e *wsEndpoint) writeClose(code int, reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if conn, ok := e.conn.(net.Conn); ok {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+	}
+	e.conn.Write(closeFrame(code, reason, e.masked))
+}
+
+// webSocketTunnel pumps frames between a client and a backend once the
+// backend has switched protocols. The reverse proxy copies between the
+// client's connection and one end of a pipe; the tunnel reads frames from
+// the other end and from the backend and passes each on whole.
+type webSocketTunnel struct {
+	client  *wsEndpoint
+	backend *wsEndpoint
+	config  WebSocketConfig
+
+	lastFrame atomic.Int64 // Unix nanoseconds
+	closing   atomic.Bool
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newWebSocketTunnel starts pumping frames between the backend's connection
+// and the returned connection, which the reverse proxy copies to the client
+func newWebSocketTunnel(backend io.ReadWriteCloser, config WebSocketConfig) (*webSocketTunnel, io.ReadWriteCloser) {
+	proxySide, tunnelSide := net.Pipe()
+	t := &webSocketTunnel{
+		client:  &wsEndpoint{conn: tunnelSide, reader: bufio.NewReader(tunnelSide)},
+		backend: &wsEndpoint{conn: backend, reader: bufio.NewReader(backend), masked: true},
+		config:  config,
+		done:    make(chan struct{}),
+	}
+	t.lastFrame.Store(time.Now().UnixNano())
+	if config.IdleTimeout > 0 {
+		go t.watchIdle()
+	}
+
+	var pumps sync.WaitGroup
+	pumps.Add(2)
+	go func() {
+		defer pumps.Done()
+		t.pump(t.client, t.backend)
+	}()
+	go func() {
+		defer pumps.Done()
+		t.pump(t.backend, t.client)
+	}()
+	go func() {
+		pumps.Wait()
+		close(t.done)
+	}()
+	return t, proxySide
+}
+
+// pump passes frames from src to dst until either side's connection ends.
+// Once the gateway has sent its close frames, frames are no longer passed
+// on, and the tunnel closes when both sides have answered.
+func (t *webSocketTunnel) pump(src, dst *wsEndpoint) {
+	defer t.close()
+	for {
+		header, err := readFrameHeader(src.reader)
+		if err != nil {
+			return
+		}
+		t.lastFrame.Store(time.Now().UnixNano())
+
+		if t.closing.Load() {
+			if _, err := io.CopyN(io.Discard, src.reader, int64(header.length)); err != nil {
+				return
+			}
+			if header.opcode == wsOpClose {
+				src.closed.Store(true)
+				if dst.closed.Load() {
+					return
+				}
+			}
+			continue
+		}
+
+		dst.mu.Lock()
+		_, err = dst.conn.Write(header.raw)
+		if err == nil {
+			_, err = io.CopyN(dst.conn, src.reader, int64(header.length))
+		}
+		dst.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watchIdle closes the tunnel once no frame has passed for the idle timeout
+func (t *webSocketTunnel) watchIdle() {
+	timer := time.NewTimer(t.config.IdleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-timer.C:
+		}
+		idle := time.Since(time.Unix(0, t.lastFrame.Load()))
+		if idle < t.config.IdleTimeout {
+			timer.Reset(t.config.IdleTimeout - idle)
+			continue
+		}
+		t.shutdown(wsCloseNormal, "idle timeout")
+		return
+	}
+}
+
+// shutdown sends both sides a close frame, and closes the tunnel when they
+// have answered or the close timeout has passed. A close frame waits for a
+// frame being passed on to that side to finish.
+func (t *webSocketTunnel) shutdown(code int, reason string) {
+	if !t.closing.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(t.config.CloseTimeout, t.close)
+	t.client.writeClose(code, reason)
+	t.backend.writeClose(code, reason)
+}
+
+// close closes both connections, ending the pumps and the reverse proxy's
+// copy to the client
+func (t *webSocketTunnel) close() {
+	t.closeOnce.Do(func() {
+		t.client.conn.Close()
+		t.backend.conn.Close()
+	})
+}
+
+// webSocketTunnels tracks open tunnels so they can be closed on shutdown
+type webSocketTunnels struct {
+	mu      sync.Mutex
+	open    map[*webSocketTunnel]struct{}
+	stopped bool
+}
+
+func newWebSocketTunnels() *webSocketTunnels {
+	return &webSocketTunnels{open: make(map[*webSocketTunnel]struct{})}
+}
+
+// add tracks a tunnel until it's done
+func (w *webSocketTunnels) add(t *webSocketTunnel) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return errWebSocketsClosed
+	}
+	w.open[t] = struct{}{}
+	go func() {
+		<-t.done
+		w.mu.Lock()
+		delete(w.open, t)
+		w.mu.Unlock()
+	}()
+	return nil
+}
+
+// count returns the number of open tunnels
+func (w *webSocketTunnels) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.open)
+}
+
+// closeAll stops new tunnels, sends every open one's sides a close frame
+// and waits for them to close. Tunnels still open when ctx is done are
+// closed without waiting for the close handshake.
+func (w *webSocketTunnels) closeAll(ctx context.Context) error {
+	w.mu.Lock()
+	w.stopped = true
+	tunnels := make([]*webSocketTunnel, 0, len(w.open))
+	for t := range w.open {
+		tunnels = append(tunnels, t)
+	}
+	w.mu.Unlock()
+
+	for _, t := range tunnels {
+		go t.shutdown(wsCloseGoingAway, "gateway shutting down")
+	}
+	for _, t := range tunnels {
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+			for _, t := range tunnels {
+				t.close()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// upgradeWebSocket replaces the body of the backend's 101 response, its
+// connection, with a tunnel passing frames to the client
+func (p *ProxyMiddleware) upgradeWebSocket(resp *http.Response, config WebSocketConfig) (*webSocketTunnel, error) {
+	backend, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil, errors.New("backend switched protocols without a writable connection")
+	}
+	tunnel, proxySide := newWebSocketTunnel(backend, config)
+	if err := p.websockets.add(tunnel); err != nil {
+		tunnel.close()
+		return nil, err
+	}
+	resp.Body = proxySide
+	return tunnel, nil
+}
+
+// CloseWebSockets sends every proxied WebSocket connection a going away
+// close frame and waits for them to close, or for ctx to be done. The HTTP
+// server doesn't track connections once they're hijacked, so the gateway
+// closes them itself on shutdown.
+func (p *ProxyMiddleware) CloseWebSockets(ctx context.Context) error {
+	return p.websockets.closeAll(ctx)
+}
+
+// OpenWebSockets returns the number of proxied WebSocket connections open
+func (p *ProxyMiddleware) OpenWebSockets() int {
+	return p.websockets.count()
+}
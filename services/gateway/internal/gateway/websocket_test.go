@@ -0,0 +1,343 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFrame writes a final frame; clients mask theirs
+func writeTestFrame(t *testing.T, w io.Writer, opcode byte, payload []byte, masked bool) {
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if masked {
+		key := []byte{1, 2, 3, 4}
+		frame = append(frame, key...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	require.NoError(t, err)
+}
+
+// readTestFrame reads a frame and unmasks its payload
+func readTestFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	header, err := readFrameHeader(r)
+	require.NoError(t, err)
+	payload := make([]byte, header.length)
+	_, err = io.ReadFull(r, payload)
+	require.NoError(t, err)
+	if header.raw[1]&0x80 != 0 {
+		key := header.raw[len(header.raw)-4:]
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return header.opcode, payload
+}
+
+// closeStatus returns a close frame's status code and reason
+func closeStatus(payload []byte) (int, string) {
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
+
+// webSocketBackend is a WebSocket backend reporting the payloads of the
+// close frames it receives on closes
+type webSocketBackend struct {
+	*httptest.Server
+	closes chan []byte
+}
+
+// newWebSocketBackend completes WebSocket upgrades, answers messages with
+// reply and answers a close frame with its own
+func newWebSocketBackend(t *testing.T, reply func(r *http.Request, message string) string) *webSocketBackend {
+	backend := &webSocketBackend{closes: make(chan []byte, 10)}
+	backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocketUpgrade(r) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		for {
+			header, err := readFrameHeader(rw.Reader)
+			if err != nil {
+				return
+			}
+			payload := make([]byte, header.length)
+			if _, err := io.ReadFull(rw, payload); err != nil {
+				return
+			}
+			key := header.raw[len(header.raw)-4:]
+			for i := range payload {
+				payload[i] ^= key[i%4]
+			}
+			if header.opcode == wsOpClose {
+				backend.closes <- payload
+				conn.Write(append([]byte{0x80 | wsOpClose, byte(len(payload))}, payload...))
+				return
+			}
+			writeTestFrame(t, conn, header.opcode, []byte(reply(r, string(payload))), false)
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// dialWebSocket sends a WebSocket handshake for path to a server
+func dialWebSocket(t *testing.T, serverURL, path string, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest("GET", "http://gateway"+path, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	require.NoError(t, req.Write(conn))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	require.NoError(t, err)
+	return conn, reader, resp
+}
+
+// expectClosed reads the gateway's close frame, answers it, and checks the
+// connection then ends
+func expectClosed(t *testing.T, conn net.Conn, reader *bufio.Reader, code int, reason string) {
+	opcode, payload := readTestFrame(t, reader)
+	require.Equal(t, byte(wsOpClose), opcode)
+	gotCode, gotReason := closeStatus(payload)
+	assert.Equal(t, code, gotCode)
+	assert.Equal(t, reason, gotReason)
+
+	writeTestFrame(t, conn, wsOpClose, payload, true)
+	_, err := reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWebSocketTunnel(t *testing.T) {
+	echo := func(r *http.Request, message string) string { return message }
+
+	t.Run("Frames", func(t *testing.T) {
+		backend := newWebSocketBackend(t, echo)
+		server, _ := newWebSocketTestGateway(t, backend.URL, &WebSocketConfig{})
+		conn, reader, resp := dialWebSocket(t, server.URL, "/api/socket", nil)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		// Frames with 7, 16 and 64 bit lengths pass through whole
+		for _, size := range []int{5, 1000, 70000} {
+			message := strings.Repeat("x", size)
+			writeTestFrame(t, conn, 0x1, []byte(message), true)
+			opcode, payload := readTestFrame(t, reader)
+			assert.Equal(t, byte(0x1), opcode)
+			assert.Equal(t, message, string(payload))
+		}
+
+		// The client's close frame reaches the backend, whose answer ends
+		// the connection
+		writeTestFrame(t, conn, wsOpClose, []byte{0x03, 0xe8}, true)
+		opcode, _ := readTestFrame(t, reader)
+		assert.Equal(t, byte(wsOpClose), opcode)
+		assert.Equal(t, []byte{0x03, 0xe8}, <-backend.closes)
+	})
+
+	t.Run("IdleTimeout", func(t *testing.T) {
+		backend := newWebSocketBackend(t, echo)
+		server, proxy := newWebSocketTestGateway(t, backend.URL, &WebSocketConfig{
+			IdleTimeout:  200 * time.Millisecond,
+			CloseTimeout: time.Second,
+		})
+		conn, reader, resp := dialWebSocket(t, server.URL, "/api/socket", nil)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		// Traffic keeps the connection open past the idle timeout
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+			writeTestFrame(t, conn, 0x1, []byte("ping"), true)
+			readTestFrame(t, reader)
+		}
+
+		expectClosed(t, conn, reader, wsCloseNormal, "idle timeout")
+		assert.Greater(t, time.Since(start), 400*time.Millisecond)
+		code, reason := closeStatus(<-backend.closes)
+		assert.Equal(t, wsCloseNormal, code)
+		assert.Equal(t, "idle timeout", reason)
+		assert.Eventually(t, func() bool { return proxy.OpenWebSockets() == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		backend := newWebSocketBackend(t, echo)
+		server, proxy := newWebSocketTestGateway(t, backend.URL, &WebSocketConfig{CloseTimeout: 5 * time.Second})
+		conn, reader, resp := dialWebSocket(t, server.URL, "/api/socket", nil)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		require.Equal(t, 1, proxy.OpenWebSockets())
+
+		closed := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			closed <- proxy.CloseWebSockets(ctx)
+		}()
+
+		// Shutdown waits for both sides to answer the close frame
+		expectClosed(t, conn, reader, wsCloseGoingAway, "gateway shutting down")
+		code, _ := closeStatus(<-backend.closes)
+		assert.Equal(t, wsCloseGoingAway, code)
+		require.NoError(t, <-closed)
+		assert.Eventually(t, func() bool { return proxy.OpenWebSockets() == 0 }, time.Second, 10*time.Millisecond)
+
+		// No connections are taken once the gateway is shutting down
+		_, _, resp = dialWebSocket(t, server.URL, "/api/socket", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("ShutdownTimeout", func(t *testing.T) {
+		// The backend ignores close frames
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+			rw.Flush()
+			io.Copy(io.Discard, rw)
+		}))
+		t.Cleanup(backend.Close)
+		server, proxy := newWebSocketTestGateway(t, backend.URL, &WebSocketConfig{CloseTimeout: time.Minute})
+		conn, reader, resp := dialWebSocket(t, server.URL, "/api/socket", nil)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		// Connections whose sides don't answer are cut off when the context
+		// is done
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, proxy.CloseWebSockets(ctx), context.DeadlineExceeded)
+
+		opcode, _ := readTestFrame(t, reader)
+		assert.Equal(t, byte(wsOpClose), opcode)
+		_, err := reader.ReadByte()
+		assert.ErrorIs(t, err, io.EOF)
+		conn.Close()
+		assert.Eventually(t, func() bool { return proxy.OpenWebSockets() == 0 }, time.Second, 10*time.Millisecond)
+	})
+}
+
+const websocketConfig = `
+port: "8000"
+auth:
+  enabled: true
+  required: true
+  header_name: "Authorization"
+  query_param: "access_token"
+  jwt_secret: "secret"
+rate_limit:
+  enabled: true
+  requests_per_minute: 600
+  key_strategy: "user"
+  max_connections: 1
+websocket:
+  idle_timeout: 1m
+routes:
+  - description: "Realtime"
+    path_prefix: "/realtime"
+    backend:
+      url: "BACKEND"
+    enabled: true
+`
+
+func TestGatewayWebSocket(t *testing.T) {
+	backend := newWebSocketBackend(t, func(r *http.Request, message string) string {
+		return r.Header.Get("X-User-ID") + ":" + message
+	})
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig(t, path, strings.Replace(websocketConfig, "BACKEND", backend.URL, 1))
+	g := newReloadTestGateway(t, path)
+	server := httptest.NewServer(g.router)
+	t.Cleanup(server.Close)
+
+	token := func(userID string) string {
+		token, err := GenerateToken(userID, userID+"@example.com", "t1", nil, nil, "secret", time.Hour)
+		require.NoError(t, err)
+		return token
+	}
+
+	// The handshake is authenticated like any request; browsers, which
+	// can't set headers on it, can send the token as a query parameter
+	_, _, resp := dialWebSocket(t, server.URL, "/realtime", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, reader, resp := dialWebSocket(t, server.URL, "/realtime?access_token="+token("u1"), nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	writeTestFrame(t, conn, 0x1, []byte("hello"), true)
+	_, payload := readTestFrame(t, reader)
+	assert.Equal(t, "u1:hello", string(payload))
+
+	// Each user may have one connection open at once
+	_, _, resp = dialWebSocket(t, server.URL, "/realtime", http.Header{"Authorization": {"Bearer " + token("u1")}})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "CONNECTION_LIMIT_EXCEEDED")
+
+	_, _, resp = dialWebSocket(t, server.URL, "/realtime?access_token="+token("u2"), nil)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// Closing the connection releases it
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		_, _, resp := dialWebSocket(t, server.URL, fmt.Sprintf("/realtime?access_token=%s", token("u1")), nil)
+		return resp.StatusCode == http.StatusSwitchingProtocols
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestWebSocketConfigValidation(t *testing.T) {
+	config := &Config{Port: "8080", JWTSecret: "secret"}
+	setDefaults(config)
+	assert.Equal(t, 5*time.Minute, config.WebSocket.IdleTimeout)
+	assert.Equal(t, 5*time.Second, config.WebSocket.CloseTimeout)
+	require.NoError(t, validateConfig(config))
+
+	config.WebSocket.IdleTimeout = -time.Second
+	assert.Error(t, validateConfig(config))
+
+	assert.Error(t, validateRateLimit(&RateLimitConfig{MaxConnections: -1}))
+}
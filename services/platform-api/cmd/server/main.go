@@ -14,8 +14,14 @@ func main() {
 		tenantID     = flag.String("tenant-id", "", "Tenant ID (required)")
 		schemaSource = flag.String("schema-source", "file", "Schema source: 'file' or 'registry'")
 		schemaPath   = flag.String("schema-path", "", "Schema file path or tenant ID for registry")
-		databaseURL  = flag.String("database-url", "", "Database connection URL")
+		storage      = flag.String("storage", "", "Storage driver: 'postgres', 'sqlite' or 'memory'")
+		databaseURL  = flag.String("database-url", "", "Database connection URL or SQLite file path")
+		redisURL     = flag.String("redis-url", "", "Redis URL of the event bus (optional)")
+		jobsURL      = flag.String("jobs-url", "", "Job API URL async hooks are enqueued with (optional)")
+		gatewayURL   = flag.String("gateway-url", "", "Gateway URL resource usage is reported to (optional)")
 		port         = flag.String("port", "8080", "Server port")
+		traceExport  = flag.String("tracing-exporter", "", "Span exporter: 'otlp', 'stdout' or 'none'")
+		otlpEndpoint = flag.String("otlp-endpoint", "", "OTLP/HTTP collector URL for the otlp exporter")
 	)
 	flag.Parse()
 
@@ -32,9 +38,30 @@ func main() {
 	if *schemaPath == "" {
 		*schemaPath = os.Getenv("SCHEMA_PATH")
 	}
+	if *storage == "" {
+		*storage = os.Getenv("STORAGE_DRIVER")
+		if *storage == "" {
+			*storage = api.StorageDriverPostgres
+		}
+	}
 	if *databaseURL == "" {
 		*databaseURL = os.Getenv("DATABASE_URL")
 	}
+	if *redisURL == "" {
+		*redisURL = os.Getenv("REDIS_URL")
+	}
+	if *jobsURL == "" {
+		*jobsURL = os.Getenv("JOBS_URL")
+	}
+	if *gatewayURL == "" {
+		*gatewayURL = os.Getenv("GATEWAY_URL")
+	}
+	if *traceExport == "" {
+		*traceExport = os.Getenv("TRACING_EXPORTER")
+	}
+	if *otlpEndpoint == "" {
+		*otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
 	if *port == "" {
 		*port = os.Getenv("PORT")
 		if *port == "" {
@@ -49,17 +76,27 @@ func main() {
 	if *schemaPath == "" {
 		log.Fatal("schema-path is required (use flag or SCHEMA_PATH env var)")
 	}
-	if *databaseURL == "" {
+	if *databaseURL == "" && *storage == api.StorageDriverPostgres {
 		log.Fatal("database-url is required (use flag or DATABASE_URL env var)")
 	}
 
 	// Create API engine configuration
 	config := &api.Config{
-		TenantID:     *tenantID,
-		SchemaSource: *schemaSource,
-		SchemaPath:   *schemaPath,
-		DatabaseURL:  *databaseURL,
-		Port:         *port,
+		TenantID:      *tenantID,
+		SchemaSource:  *schemaSource,
+		SchemaPath:    *schemaPath,
+		StorageDriver: *storage,
+		DatabaseURL:   *databaseURL,
+		RedisURL:      *redisURL,
+		JobsURL:       *jobsURL,
+		GatewayURL:    *gatewayURL,
+		GatewaySecret: os.Getenv("GATEWAY_JWT_SECRET"),
+		Port:          *port,
+		Tracing: api.TracingConfig{
+			ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+			Exporter:    *traceExport,
+			Endpoint:    *otlpEndpoint,
+		},
 	}
 
 	// Create and start API engine
@@ -72,6 +109,7 @@ func main() {
 	log.Printf("  Tenant ID: %s", *tenantID)
 	log.Printf("  Schema Source: %s", *schemaSource)
 	log.Printf("  Schema Path: %s", *schemaPath)
+	log.Printf("  Storage: %s", *storage)
 	log.Printf("  Port: %s", *port)
 
 	if err := engine.Start(*port); err != nil {
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/backsaas/platform/services/platform-api/internal/expr"
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// Headers the gateway sets on proxied requests after authenticating them
+const (
+	HeaderTenantID  = "X-Tenant-ID"
+	HeaderUserID    = "X-User-ID"
+	HeaderUserRoles = "X-User-Roles"
+)
+
+// memberRole is held by every caller authenticated to a tenant; rules that
+// can only be decided with a membership query fall back to it
+const memberRole = "tenant_member"
+
+// Principal is the caller access rules are evaluated for
+type Principal struct {
+	UserID   string
+	TenantID string
+	Roles    []string // as granted; see accessChecker.roles for inherited roles
+}
+
+// Anonymous reports whether the request carried no caller identity
+func (p Principal) Anonymous() bool {
+	return p.UserID == "" && len(p.Roles) == 0
+}
+
+// principalFromRequest reads the caller from the gateway's identity headers
+func principalFromRequest(c *gin.Context) Principal {
+	principal := Principal{
+		UserID:   c.GetHeader(HeaderUserID),
+		TenantID: c.GetHeader(HeaderTenantID),
+	}
+	for _, role := range strings.Split(c.GetHeader(HeaderUserRoles), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			principal.Roles = append(principal.Roles, role)
+		}
+	}
+	return principal
+}
+
+// errSubquery marks rules that query other tables and so can't be evaluated
+// against a single record
+var errSubquery = errors.New("rule needs a subquery")
+
+// accessChecker evaluates a schema's access rules against records. Rules
+// use the schema's SQL-like syntax:
+//
+//	current_user.id = resource.user_id OR current_user.id = resource.id
+//	tenant_admin AND tenant_id = resource.tenant_id
+//
+// Bare names refer to the record's fields, or to rules named in
+// access_rules.rules. A named rule that needs a subquery is met when the
+// caller holds the role of the same name. Write rules may also refer to
+// field, the name of each field being written.
+type accessChecker struct {
+	named    map[string]*expr.Expression // nil for rules that need a subquery
+	read     map[string][]accessCheck    // by entity
+	write    map[string][]accessCheck    // by entity
+	remove   map[string][]accessCheck    // by entity
+	inherits map[string][]string
+}
+
+// accessCheck is one entry of an entity's access list; either role or rule
+// is set
+type accessCheck struct {
+	role string
+	rule *expr.Expression
+}
+
+// newAccessChecker compiles the schema's named rules and every entity's
+// read, write and delete rules
+func newAccessChecker(schemaObj *schema.Schema) (*accessChecker, error) {
+	a := &accessChecker{
+		named:    make(map[string]*expr.Expression),
+		read:     make(map[string][]accessCheck),
+		write:    make(map[string][]accessCheck),
+		remove:   make(map[string][]accessCheck),
+		inherits: make(map[string][]string),
+	}
+
+	if schemaObj.AccessRules != nil {
+		for name, rule := range schemaObj.AccessRules.Rules {
+			compiled, err := compileAccessRule(rule)
+			if err != nil && !errors.Is(err, errSubquery) {
+				return nil, fmt.Errorf("access rule %s: %w", name, err)
+			}
+			a.named[name] = compiled
+		}
+		for name, role := range schemaObj.AccessRules.Roles {
+			if role != nil {
+				a.inherits[name] = role.Inherits
+			}
+		}
+	}
+
+	for entityName, entity := range schemaObj.Entities {
+		if entity.Access == nil {
+			continue
+		}
+		for _, list := range []struct {
+			kind   string
+			rules  []schema.AccessRule
+			checks map[string][]accessCheck
+		}{
+			{"read", entity.Access.Read, a.read},
+			{"write", entity.Access.Write, a.write},
+			{"delete", entity.Access.Delete, a.remove},
+		} {
+			if len(list.rules) == 0 {
+				continue
+			}
+			checks := make([]accessCheck, 0, len(list.rules))
+			for _, rule := range list.rules {
+				if rule.Rule == "" {
+					checks = append(checks, accessCheck{role: rule.Role})
+					continue
+				}
+				compiled, err := compileAccessRule(rule.Rule)
+				if err != nil {
+					return nil, fmt.Errorf("entity %s %s rule %q: %w", entityName, list.kind, rule.Rule, err)
+				}
+				checks = append(checks, accessCheck{rule: compiled})
+			}
+			list.checks[entityName] = checks
+		}
+	}
+
+	return a, nil
+}
+
+// restricted reports whether an entity declares read rules at all
+func (a *accessChecker) restricted(entityName string) bool {
+	return len(a.read[entityName]) > 0
+}
+
+// canRead reports whether a caller may read a record. Entities without read
+// rules are readable by everyone in the tenant.
+func (a *accessChecker) canRead(entityName string, principal Principal, record map[string]interface{}) bool {
+	return a.allowed(a.read[entityName], principal, record, nil)
+}
+
+// canWrite reports whether a caller may write fields of a record. A rule
+// must hold for every field written. Entities without write rules are
+// writable by everyone in the tenant.
+func (a *accessChecker) canWrite(entityName string, principal Principal, record map[string]interface{}, fields []string) bool {
+	return a.allowed(a.write[entityName], principal, record, fields)
+}
+
+// canDelete reports whether a caller may delete a record. Entities without
+// delete rules can be deleted by everyone in the tenant.
+func (a *accessChecker) canDelete(entityName string, principal Principal, record map[string]interface{}) bool {
+	return a.allowed(a.remove[entityName], principal, record, nil)
+}
+
+// allowed reports whether any check of an access list passes. Rules are
+// evaluated once per field when fields are given.
+func (a *accessChecker) allowed(checks []accessCheck, principal Principal, record map[string]interface{}, fields []string) bool {
+	if len(checks) == 0 {
+		return true
+	}
+
+	roles := a.roles(principal)
+	for _, check := range checks {
+		if check.role != "" {
+			if roles[check.role] {
+				return true
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			if a.eval(check.rule, principal, roles, record, "", map[string]bool{}) {
+				return true
+			}
+			continue
+		}
+		passed := true
+		for _, field := range fields {
+			if !a.eval(check.rule, principal, roles, record, field, map[string]bool{}) {
+				passed = false
+				break
+			}
+		}
+		if passed {
+			return true
+		}
+	}
+	return false
+}
+
+// roles returns every role a caller holds, including inherited ones
+func (a *accessChecker) roles(principal Principal) map[string]bool {
+	held := make(map[string]bool)
+	var grant func(role string)
+	grant = func(role string) {
+		if held[role] {
+			return
+		}
+		held[role] = true
+		for _, inherited := range a.inherits[role] {
+			grant(inherited)
+		}
+	}
+
+	for _, role := range principal.Roles {
+		grant(role)
+	}
+	if principal.TenantID != "" && !principal.Anonymous() {
+		grant(memberRole)
+	}
+	return held
+}
+
+// eval evaluates a compiled rule for a record, and for the field being
+// written when field is set. Named rules the rule refers to are evaluated
+// first; visiting guards against rules that refer to each other.
+func (a *accessChecker) eval(rule *expr.Expression, principal Principal, roles map[string]bool, record map[string]interface{}, field string, visiting map[string]bool) bool {
+	roleList := make([]interface{}, 0, len(roles))
+	for role := range roles {
+		roleList = append(roleList, role)
+	}
+
+	env := make(map[string]interface{}, len(record)+2)
+	for key, value := range record {
+		env[key] = value
+	}
+	env["resource"] = record
+	if field != "" {
+		env["field"] = field
+	}
+	env["current_user"] = map[string]interface{}{
+		"id":        principal.UserID,
+		"tenant_id": principal.TenantID,
+		"role":      roleList,
+		"roles":     roleList,
+	}
+
+	for _, name := range rule.Fields() {
+		named, exists := a.named[name]
+		if !exists {
+			continue
+		}
+		switch {
+		case visiting[name]:
+			env[name] = false
+		case named == nil:
+			env[name] = roles[name]
+		default:
+			visiting[name] = true
+			env[name] = a.eval(named, principal, roles, record, field, visiting)
+			delete(visiting, name)
+		}
+	}
+
+	result, err := rule.Eval(env)
+	if err != nil {
+		log.Printf("Access rule %q failed: %v", rule, err)
+		return false
+	}
+	return result == true
+}
+
+// compileAccessRule translates a rule into the expression language: AND, OR
+// and NOT become &&, || and !, = becomes ==, and "x IN (a, b)" or
+// "x IN [a, b]" becomes in(x, a, b)
+func compileAccessRule(rule string) (*expr.Expression, error) {
+	tokens, err := accessRuleTokens(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch strings.ToUpper(token) {
+		case "SELECT":
+			return nil, errSubquery
+		case "AND":
+			out = append(out, "&&")
+		case "OR":
+			out = append(out, "||")
+		case "NOT":
+			out = append(out, "!")
+		case "IN":
+			if len(out) == 0 || i+1 >= len(tokens) || (tokens[i+1] != "(" && tokens[i+1] != "[") {
+				return nil, fmt.Errorf("IN needs a value and a list")
+			}
+			operand := out[len(out)-1]
+			out = append(out[:len(out)-1], "in", "(", operand, ",")
+			i++ // the list's opening bracket
+		case "=":
+			out = append(out, "==")
+		case "]":
+			out = append(out, ")")
+		default:
+			out = append(out, token)
+		}
+	}
+
+	return expr.Compile(strings.Join(out, " "))
+}
+
+// accessRuleTokens splits a rule into names, literals and operators
+func accessRuleTokens(rule string) ([]string, error) {
+	src := []rune(rule)
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, string(src[i:end+1]))
+			i = end + 1
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(src[i]) || unicode.IsDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, string(src[start:i]))
+		case strings.ContainsRune("!<>=", c) && i+1 < len(src) && src[i+1] == '=':
+			tokens = append(tokens, string(src[i:i+2]))
+			i += 2
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+func TestCompileAccessRule(t *testing.T) {
+	testCases := []struct {
+		rule     string
+		expected string
+	}{
+		{"self", "self"},
+		{"current_user.id = resource.user_id OR current_user.id = resource.id", "current_user.id == resource.user_id || current_user.id == resource.id"},
+		{"tenant_admin AND tenant_id = resource.tenant_id", "tenant_admin && tenant_id == resource.tenant_id"},
+		{"current_user.role IN ('admin', 'owner')", "in ( current_user.role , 'admin' , 'owner' )"},
+		{"NOT (status != 'archived')", "! ( status != 'archived' )"},
+		{"field IN ['name', 'updated_at']", "in ( field , 'name' , 'updated_at' )"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rule, func(t *testing.T) {
+			compiled, err := compileAccessRule(tc.rule)
+			if err != nil {
+				t.Fatalf("Failed to compile: %v", err)
+			}
+			if compiled.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, compiled.String())
+			}
+		})
+	}
+
+	if _, err := compileAccessRule("current_user.id IN (SELECT user_id FROM members)"); err != errSubquery {
+		t.Errorf("Expected errSubquery, got %v", err)
+	}
+	if _, err := compileAccessRule("status = 'open"); err == nil {
+		t.Error("Expected unterminated string to fail")
+	}
+}
+
+func TestAccessChecker(t *testing.T) {
+	schemaObj := &schema.Schema{
+		Entities: map[string]*schema.Entity{
+			"notes": {Access: &schema.EntityAccess{Read: []schema.AccessRule{
+				{Role: "admin"},
+				{Rule: "self"},
+			}}},
+			"projects": {Access: &schema.EntityAccess{Read: []schema.AccessRule{
+				{Rule: "tenant_developer AND tenant_id = resource.tenant_id"},
+			}}},
+			"posts": {Access: &schema.EntityAccess{Read: []schema.AccessRule{
+				{Rule: "tenant_member AND status = 'published'"},
+			}}},
+			"public": {},
+		},
+		AccessRules: &schema.AccessRules{
+			Rules: map[string]string{
+				"self":             "current_user.id = resource.user_id OR current_user.id = resource.id",
+				"tenant_member":    "current_user.id IN (SELECT user_id FROM tenant_memberships WHERE tenant_id = resource.tenant_id)",
+				"tenant_developer": "current_user.id IN (SELECT user_id FROM tenant_memberships WHERE role IN ('owner', 'developer'))",
+			},
+			Roles: map[string]*schema.Role{
+				"tenant_owner":     {Inherits: []string{"tenant_developer"}},
+				"tenant_developer": {Inherits: []string{"tenant_viewer"}},
+			},
+		},
+	}
+
+	checker, err := newAccessChecker(schemaObj)
+	if err != nil {
+		t.Fatalf("Failed to compile access rules: %v", err)
+	}
+
+	alice := Principal{UserID: "alice", TenantID: "acme"}
+	owner := Principal{UserID: "olga", TenantID: "acme", Roles: []string{"tenant_owner"}}
+	admin := Principal{UserID: "root", Roles: []string{"admin"}}
+
+	testCases := []struct {
+		name      string
+		entity    string
+		principal Principal
+		record    map[string]interface{}
+		expected  bool
+	}{
+		{"OwnRecord", "notes", alice, map[string]interface{}{"user_id": "alice"}, true},
+		{"OtherRecord", "notes", alice, map[string]interface{}{"user_id": "bob"}, false},
+		{"AdminRole", "notes", admin, map[string]interface{}{"user_id": "bob"}, true},
+		{"InheritedRole", "projects", owner, map[string]interface{}{"tenant_id": "acme"}, true},
+		{"MissingRole", "projects", alice, map[string]interface{}{"tenant_id": "acme"}, false},
+		{"MemberPublished", "posts", alice, map[string]interface{}{"status": "published"}, true},
+		{"MemberDraft", "posts", alice, map[string]interface{}{"status": "draft"}, false},
+		{"AnonymousMember", "posts", Principal{TenantID: "acme"}, map[string]interface{}{"status": "published"}, false},
+		{"Unrestricted", "public", Principal{}, map[string]interface{}{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if allowed := checker.canRead(tc.entity, tc.principal, tc.record); allowed != tc.expected {
+				t.Errorf("Expected canRead %v, got %v", tc.expected, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// Change stream tuning
+const (
+	changeBatchSize         = 100
+	changePollInterval      = time.Second // picks up changes made by other processes
+	changeHeartbeatInterval = 15 * time.Second
+)
+
+// Change is a message on an entity's change stream
+type Change struct {
+	Sequence  int64                  `json:"sequence"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event,omitempty"`
+	Data      map[string]interface{} `json:"data"` // the record; as it was before deletion for deletes
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+func newChange(event *OutboxEvent) *Change {
+	return &Change{
+		Sequence:  event.Sequence,
+		Action:    event.Action,
+		Entity:    event.AggregateType,
+		ID:        event.AggregateID,
+		Event:     event.Event,
+		Data:      event.Record,
+		Timestamp: event.CreatedAt,
+	}
+}
+
+// changeNotifier wakes change streams when a change may have been recorded
+type changeNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{ch: make(chan struct{})}
+}
+
+// wait returns a channel that is closed by the next notify
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+// notify wakes every stream waiting for changes
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// changeSink writes change stream messages to a client
+type changeSink interface {
+	send(change *Change) error
+	ping() error
+}
+
+// streamChanges handles GET /api/{entity}/_changes. Changes are read from the
+// outbox, the log the relay feeds the event bus from, so a stream can resume
+// from the sequence of the last change it received: SSE clients send it as
+// Last-Event-ID when they reconnect, and any client can pass ?since=. Without
+// either the stream starts with the next change. Requests with an Upgrade:
+// websocket header get a WebSocket carrying one JSON Change per message.
+func (e *Engine) streamChanges(entityName string, entity *schema.Entity) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFromRequest(c)
+		if principal.TenantID == "" {
+			principal.TenantID = e.tenantID
+		}
+		if principal.TenantID != e.tenantID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tenant mismatch"})
+			return
+		}
+		if e.access.restricted(entityName) && principal.Anonymous() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		after, err := e.changeCursor(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			e.serveChangesWebSocket(c, entityName, principal, after)
+			return
+		}
+		e.serveChangesSSE(c, entityName, principal, after)
+	}
+}
+
+// changeCursor returns the sequence a stream resumes after
+func (e *Engine) changeCursor(c *gin.Context) (int64, error) {
+	cursor := c.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = c.Query("since")
+	}
+	if cursor == "" {
+		return e.store.LastOutboxSequence()
+	}
+
+	after, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || after < 0 {
+		return 0, fmt.Errorf("invalid change sequence %q", cursor)
+	}
+	return after, nil
+}
+
+// serveChangesSSE streams changes as server-sent events
+func (e *Engine) serveChangesSSE(c *gin.Context, entityName string, principal Principal, after int64) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	if err := e.pumpChanges(c.Request.Context(), entityName, principal, after, sseSink{c.Writer}); err != nil {
+		log.Printf("Change stream for %s ended: %v", entityName, err)
+	}
+}
+
+type sseSink struct {
+	w gin.ResponseWriter
+}
+
+func (s sseSink) send(change *Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to encode change %d: %w", change.Sequence, err)
+	}
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", change.Sequence, change.Action, data); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+func (s sseSink) ping() error {
+	if _, err := io.WriteString(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// serveChangesWebSocket streams changes over a WebSocket
+func (e *Engine) serveChangesWebSocket(c *gin.Context, entityName string, principal Principal, after int64) {
+	server := websocket.Server{
+		// Browsers' origins are checked by the gateway's CORS policy
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			ctx, cancel := context.WithCancel(c.Request.Context())
+			defer cancel()
+
+			// Clients have nothing to say; reading answers their pings and
+			// notices when they close the connection
+			go func() {
+				io.Copy(io.Discard, conn)
+				cancel()
+			}()
+
+			if err := e.pumpChanges(ctx, entityName, principal, after, websocketSink{conn}); err != nil {
+				log.Printf("Change stream for %s ended: %v", entityName, err)
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+type websocketSink struct {
+	conn *websocket.Conn
+}
+
+func (s websocketSink) send(change *Change) error {
+	return websocket.JSON.Send(s.conn, change)
+}
+
+func (s websocketSink) ping() error {
+	s.conn.PayloadType = websocket.PingFrame
+	defer func() { s.conn.PayloadType = websocket.TextFrame }()
+	_, err := s.conn.Write(nil)
+	return err
+}
+
+// pumpChanges sends the changes to an entity recorded after a sequence that
+// the caller may read, until ctx is cancelled or the client goes away. It can
+// move past every sequence it reads because writeOutbox commits a tenant's
+// changes in sequence order.
+func (e *Engine) pumpChanges(ctx context.Context, entityName string, principal Principal, after int64, sink changeSink) error {
+	heartbeat := time.NewTicker(changeHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// Take the wake-up channel before reading so no change slips between
+		wake := e.changes.wait()
+
+		events, err := e.store.OutboxEventsAfter(entityName, after, changeBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			after = event.Sequence
+			if !e.access.canRead(entityName, principal, event.Record) {
+				continue
+			}
+			if err := sink.send(newChange(event)); err != nil {
+				return err
+			}
+		}
+		if len(events) == changeBatchSize {
+			continue
+		}
+
+		poll := time.NewTimer(changePollInterval)
+		select {
+		case <-ctx.Done():
+			poll.Stop()
+			return nil
+		case <-wake:
+		case <-poll.C:
+		case <-heartbeat.C:
+			if err := sink.ping(); err != nil {
+				poll.Stop()
+				return err
+			}
+		}
+		poll.Stop()
+	}
+}
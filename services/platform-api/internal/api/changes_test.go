@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The test schema requires UUIDs for keys and tenant IDs
+const (
+	changesTenant = "6f1c2a4e-0000-4000-8000-000000000000"
+	user1         = "6f1c2a4e-0000-4000-8000-000000000001"
+	user2         = "6f1c2a4e-0000-4000-8000-000000000002"
+	user3         = "6f1c2a4e-0000-4000-8000-000000000003"
+)
+
+func newChangesTestEngine(t *testing.T) (*Engine, *httptest.Server) {
+	engine, err := NewEngine(&Config{
+		TenantID:      changesTenant,
+		SchemaSource:  "file",
+		SchemaPath:    "../../testdata/test-schema.yaml",
+		StorageDriver: StorageDriverMemory,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	server := httptest.NewServer(engine.router)
+	t.Cleanup(server.Close)
+	return engine, server
+}
+
+// createUser creates a user through the API so change streams are notified
+func createUser(t *testing.T, server *httptest.Server, id, name string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    id,
+		"email": name + "@example.com",
+		"name":  name,
+	})
+	resp, err := http.Post(server.URL+"/api/users", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 creating user, got %d", resp.StatusCode)
+	}
+}
+
+// readSSE reads server-sent events until it has n of them
+func readSSE(t *testing.T, reader *bufio.Reader, n int) []map[string]string {
+	var events []map[string]string
+	event := map[string]string{}
+	for len(events) < n {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if len(event) > 0 {
+				events = append(events, event)
+				event = map[string]string{}
+			}
+		case strings.HasPrefix(line, ":"):
+		default:
+			field, value, _ := strings.Cut(line, ": ")
+			event[field] = value
+		}
+	}
+	return events
+}
+
+func openChangeStream(t *testing.T, server *httptest.Server, path string, headers map[string]string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open change stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChangeStreamSSE(t *testing.T) {
+	_, server := newChangesTestEngine(t)
+	createUser(t, server, user1, "Ada")
+	createUser(t, server, user2, "Grace")
+
+	t.Run("ReplaysAndFiltersByAccessRules", func(t *testing.T) {
+		resp := openChangeStream(t, server, "/api/users/_changes?since=0", map[string]string{
+			HeaderUserID:   user2,
+			HeaderTenantID: changesTenant,
+		})
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		// u1's record is hidden by the "self" rule
+		reader := bufio.NewReader(resp.Body)
+		events := readSSE(t, reader, 1)
+		var change Change
+		if err := json.Unmarshal([]byte(events[0]["data"]), &change); err != nil {
+			t.Fatalf("Failed to decode change: %v", err)
+		}
+		if events[0]["event"] != ActionCreated || change.ID != user2 || change.Data["name"] != "Grace" || change.Event != "user.created" {
+			t.Errorf("Expected u2's created change, got %v", events[0])
+		}
+		if events[0]["id"] != "2" {
+			t.Errorf("Expected event id 2, got %s", events[0]["id"])
+		}
+
+		// Live changes follow the replay
+		createUser(t, server, user3, "Linus")
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/users/"+user2, strings.NewReader(`{"email":"grace@example.com","name":"Grace H"}`))
+		req.Header.Set("Content-Type", "application/json")
+		updated, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to update user: %v", err)
+		}
+		updated.Body.Close()
+		if updated.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 updating user, got %d", updated.StatusCode)
+		}
+		events = readSSE(t, reader, 1)
+		if events[0]["event"] != ActionUpdated || events[0]["id"] != "4" {
+			t.Errorf("Expected u2's updated change with id 4, got %v", events[0])
+		}
+	})
+
+	t.Run("ResumesFromLastEventID", func(t *testing.T) {
+		resp := openChangeStream(t, server, "/api/users/_changes", map[string]string{
+			HeaderUserRoles: "admin",
+			"Last-Event-ID": "2",
+		})
+		events := readSSE(t, bufio.NewReader(resp.Body), 2)
+		if events[0]["id"] != "3" || events[1]["id"] != "4" {
+			t.Errorf("Expected changes 3 and 4, got %v", events)
+		}
+	})
+
+	t.Run("Rejections", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			path     string
+			headers  map[string]string
+			expected int
+		}{
+			{"OtherTenant", "/api/users/_changes", map[string]string{HeaderUserID: user1, HeaderTenantID: "tenant-b"}, http.StatusForbidden},
+			{"Anonymous", "/api/users/_changes", nil, http.StatusUnauthorized},
+			{"InvalidCursor", "/api/users/_changes?since=abc", map[string]string{HeaderUserID: user1}, http.StatusBadRequest},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				resp := openChangeStream(t, server, tc.path, tc.headers)
+				if resp.StatusCode != tc.expected {
+					t.Errorf("Expected %d, got %d", tc.expected, resp.StatusCode)
+				}
+			})
+		}
+	})
+
+	t.Run("GetByIDStillRoutes", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/users/" + user1)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 200, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestChangeStreamWebSocket(t *testing.T) {
+	_, server := newChangesTestEngine(t)
+	createUser(t, server, user1, "Ada")
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/api/users/_changes?since=0", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to configure WebSocket: %v", err)
+	}
+	config.Header.Set(HeaderUserRoles, "admin")
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to dial change stream: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var change Change
+	if err := websocket.JSON.Receive(conn, &change); err != nil {
+		t.Fatalf("Failed to receive change: %v", err)
+	}
+	if change.Sequence != 1 || change.Action != ActionCreated || change.ID != user1 {
+		t.Errorf("Expected u1's created change, got %+v", change)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/users/"+user1, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 deleting user, got %d", resp.StatusCode)
+	}
+	if err := websocket.JSON.Receive(conn, &change); err != nil {
+		t.Fatalf("Failed to receive change: %v", err)
+	}
+	if change.Action != ActionDeleted || change.Data["name"] != "Ada" {
+		t.Errorf("Expected u1's deleted change with its last state, got %+v", change)
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/backsaas/platform/api/pkg/functions"
+	"github.com/backsaas/platform/services/platform-api/internal/expr"
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// ComputedFunc derives a property value from a record. Functions are
+// referenced from schemas with computed.function.
+type ComputedFunc func(record map[string]interface{}) (interface{}, error)
+
+var (
+	computedFunctionsMu sync.RWMutex
+	computedFunctions   = make(map[string]ComputedFunc)
+)
+
+// RegisterComputedFunction makes a Go function available to computed
+// properties under the given name
+func RegisterComputedFunction(name string, fn ComputedFunc) error {
+	computedFunctionsMu.Lock()
+	defer computedFunctionsMu.Unlock()
+
+	if _, exists := computedFunctions[name]; exists {
+		return fmt.Errorf("computed function %s already registered", name)
+	}
+	computedFunctions[name] = fn
+	return nil
+}
+
+func lookupComputedFunction(name string) (ComputedFunc, bool) {
+	computedFunctionsMu.RLock()
+	defer computedFunctionsMu.RUnlock()
+
+	fn, exists := computedFunctions[name]
+	return fn, exists
+}
+
+var (
+	utilityFunctionsOnce sync.Once
+	utilityFunctionsErr  error
+)
+
+// registerUtilityFunctions makes the platform's utility functions callable
+// from computed expressions. They're registered before the schema loads,
+// since expressions are parsed when it does:
+//
+//	format_currency(price, "USD")
+//	parse_date(signed_on, "02/01/2006")
+//	calculate_age(birth_date)
+func registerUtilityFunctions() error {
+	utilityFunctionsOnce.Do(func() {
+		for _, fn := range []struct {
+			name             string
+			minArgs, maxArgs int
+			call             expr.Func
+		}{
+			{"format_currency", 2, 2, formatCurrency},
+			{"parse_date", 1, 2, parseDate},
+			{"calculate_age", 1, 1, calculateAge},
+		} {
+			if err := expr.Register(fn.name, fn.minArgs, fn.maxArgs, fn.call); err != nil {
+				utilityFunctionsErr = err
+				return
+			}
+		}
+	})
+	return utilityFunctionsErr
+}
+
+// formatCurrency formats an amount, which may be a decimal string, in an
+// ISO 4217 currency
+func formatCurrency(args []interface{}) (interface{}, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	amount, ok := toFloat64(args[0])
+	if str, isString := args[0].(string); isString {
+		var err error
+		amount, err = strconv.ParseFloat(str, 64)
+		ok = err == nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("amount must be a number, got %T", args[0])
+	}
+	currency, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("currency must be a string, got %T", args[1])
+	}
+	return functions.FormatCurrency(amount, currency)
+}
+
+// parseDate parses a date string with a Go layout, defaulting to
+// "2006-01-02". Dates are returned as the API represents them: without a
+// time of day as "2006-01-02", otherwise as RFC3339.
+func parseDate(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	dateString, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("date must be a string, got %T", args[0])
+	}
+	format := ""
+	if len(args) == 2 {
+		if format, ok = args[1].(string); !ok {
+			return nil, fmt.Errorf("format must be a string, got %T", args[1])
+		}
+	}
+
+	parsed, err := functions.ParseDate(dateString, format)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Equal(parsed.Truncate(24 * time.Hour)) {
+		return parsed.Format(dateLayout), nil
+	}
+	return parsed.UTC().Format(time.RFC3339), nil
+}
+
+// calculateAge returns the whole years since a date or date-time
+func calculateAge(args []interface{}) (interface{}, error) {
+	var birthDate time.Time
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		birthDate = v
+	case string:
+		var err error
+		if birthDate, err = time.Parse(time.RFC3339, v); err != nil {
+			if birthDate, err = time.Parse(dateLayout, v); err != nil {
+				return nil, fmt.Errorf("invalid birth date %q", v)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("birth date must be a date, got %T", v)
+	}
+
+	age, err := functions.CalculateAge(birthDate)
+	if err != nil {
+		return nil, err
+	}
+	return float64(age), nil
+}
+
+// checkComputedFunctions verifies that every computed function a schema
+// references has been registered
+func checkComputedFunctions(schemaObj *schema.Schema) error {
+	for entityName, entity := range schemaObj.Entities {
+		for propName, propDef := range entity.Schema.Properties {
+			if propDef.Computed == nil || propDef.Computed.Function == "" {
+				continue
+			}
+			if _, exists := lookupComputedFunction(propDef.Computed.Function); !exists {
+				return fmt.Errorf("entity %s property %s references unregistered computed function %s",
+					entityName, propName, propDef.Computed.Function)
+			}
+		}
+	}
+	return nil
+}
+
+// evaluateComputed evaluates a computed property against a record
+func evaluateComputed(computed *schema.ComputedDefinition, record map[string]interface{}) (interface{}, error) {
+	if computed.Function != "" {
+		fn, exists := lookupComputedFunction(computed.Function)
+		if !exists {
+			return nil, fmt.Errorf("computed function %s is not registered", computed.Function)
+		}
+		return fn(record)
+	}
+
+	expression, err := expr.Compile(computed.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return expression.Eval(record)
+}
+
+// computedProperties returns the entity's computed property names in a
+// stable order, selecting stored or virtual ones
+func computedProperties(entity *schema.Entity, stored bool) []string {
+	var names []string
+	for propName, propDef := range entity.Schema.Properties {
+		if propDef.Computed != nil && propDef.Computed.Stored == stored {
+			names = append(names, propName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stripComputed removes computed properties from write data so stored values
+// always come from their definition
+func stripComputed(entity *schema.Entity, data map[string]interface{}) {
+	for propName, propDef := range entity.Schema.Properties {
+		if propDef.Computed != nil {
+			delete(data, propName)
+		}
+	}
+}
+
+// computeStoredFields evaluates the stored computed properties of a record in
+// place; values are persisted, so they can be filtered and sorted on
+func computeStoredFields(entity *schema.Entity, record map[string]interface{}) error {
+	for _, propName := range computedProperties(entity, true) {
+		value, err := evaluateComputed(entity.Schema.Properties[propName].Computed, record)
+		if err != nil {
+			return fmt.Errorf("failed to compute %s: %w", propName, err)
+		}
+		record[propName] = value
+	}
+	return nil
+}
+
+// computeStoredUpdate recomputes the stored computed properties for an
+// update from the existing record merged with the update data, adding the
+// results to updateData
+func computeStoredUpdate(entity *schema.Entity, existing, updateData map[string]interface{}) error {
+	stored := computedProperties(entity, true)
+	if len(stored) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(existing)+len(updateData))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range updateData {
+		merged[k] = v
+	}
+
+	if err := computeStoredFields(entity, merged); err != nil {
+		return err
+	}
+	for _, propName := range stored {
+		updateData[propName] = merged[propName]
+	}
+	return nil
+}
+
+// computeVirtualFields adds the virtual computed properties to a record read
+// from storage. A property that fails to evaluate reads as null.
+func computeVirtualFields(entity *schema.Entity, record map[string]interface{}) {
+	for _, propName := range computedProperties(entity, false) {
+		value, err := evaluateComputed(entity.Schema.Properties[propName].Computed, record)
+		if err != nil {
+			log.Printf("Failed to compute %s: %v", propName, err)
+			value = nil
+		}
+		record[propName] = value
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
+)
+
+func computedTestEntity() *schema.Entity {
+	return &schema.Entity{
+		Key: "order_id",
+		Schema: schema.EntitySchema{
+			Type:     "object",
+			Required: []string{"order_id"},
+			Properties: map[string]*schema.PropertyDefinition{
+				"order_id":   {Type: "string"},
+				"first_name": {Type: "string"},
+				"last_name":  {Type: "string"},
+				"price":      {Type: "number"},
+				"quantity":   {Type: "integer"},
+				"customer": {
+					Type:     "string",
+					Computed: &schema.ComputedDefinition{Expression: `concat(first_name, " ", last_name)`},
+				},
+				"total": {
+					Type:     "number",
+					Computed: &schema.ComputedDefinition{Expression: "price * quantity", Stored: true},
+				},
+				"initials": {
+					Type:     "string",
+					Computed: &schema.ComputedDefinition{Function: "test_initials"},
+				},
+			},
+		},
+	}
+}
+
+func init() {
+	RegisterComputedFunction("test_initials", func(record map[string]interface{}) (interface{}, error) {
+		first, _ := record["first_name"].(string)
+		last, _ := record["last_name"].(string)
+		if first == "" || last == "" {
+			return nil, nil
+		}
+		return first[:1] + last[:1], nil
+	})
+}
+
+func TestComputedProperties(t *testing.T) {
+	entity := computedTestEntity()
+	store := NewMemoryStore("tenant")
+	store.EnsureTablesExist(&schema.Schema{Entities: map[string]*schema.Entity{"orders": entity}})
+
+	t.Run("VirtualPropertiesHaveNoColumn", func(t *testing.T) {
+		for _, col := range entityColumns(entity) {
+			if col == "customer" || col == "initials" {
+				t.Errorf("Virtual property %s should not be a column", col)
+			}
+		}
+	})
+
+	t.Run("ComputedOnWriteAndRead", func(t *testing.T) {
+		created, err := store.InsertEntity("orders", entity, map[string]interface{}{
+			"order_id":   "order-1",
+			"first_name": "Ada",
+			"last_name":  "Lovelace",
+			"price":      2.5,
+			"quantity":   4,
+			"total":      1000, // ignored, stored values come from the expression
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert entity: %v", err)
+		}
+		if created["total"] != 10.0 {
+			t.Errorf("Expected stored total 10, got %v", created["total"])
+		}
+		if created["customer"] != "Ada Lovelace" {
+			t.Errorf("Expected virtual customer 'Ada Lovelace', got %v", created["customer"])
+		}
+		if created["initials"] != "AL" {
+			t.Errorf("Expected initials from Go function 'AL', got %v", created["initials"])
+		}
+
+		updated, err := store.UpdateEntity("orders", entity, "order-1", map[string]interface{}{"quantity": 10})
+		if err != nil {
+			t.Fatalf("Failed to update entity: %v", err)
+		}
+		if updated["total"] != 25.0 {
+			t.Errorf("Expected total recomputed from the stored price to be 25, got %v", updated["total"])
+		}
+	})
+
+	t.Run("StoredPropertiesAreFilterableAndSortable", func(t *testing.T) {
+		for i, quantity := range []int{1, 3, 2} {
+			_, err := store.InsertEntity("orders", entity, map[string]interface{}{
+				"order_id": strings.Repeat("x", i+1),
+				"price":    1.0,
+				"quantity": quantity,
+			})
+			if err != nil {
+				t.Fatalf("Failed to insert entity: %v", err)
+			}
+		}
+
+		results, err := store.QueryEntities("orders", entity, nil, 3, 0, "total DESC")
+		if err != nil {
+			t.Fatalf("Failed to sort by stored property: %v", err)
+		}
+		if len(results) != 3 || results[0]["total"] != 25.0 || results[1]["total"] != 3.0 || results[2]["total"] != 2.0 {
+			t.Errorf("Unexpected ordering by total: %v", results)
+		}
+
+		results, err = store.QueryEntities("orders", entity, map[string]interface{}{"total": "3"}, 10, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to filter by stored property: %v", err)
+		}
+		if len(results) != 1 || results[0]["order_id"] != "xx" {
+			t.Errorf("Expected filter on total to match xx, got %v", results)
+		}
+
+		if _, err := store.QueryEntities("orders", entity, map[string]interface{}{"customer": "x"}, 10, 0, ""); !errors.Is(err, ErrInvalidIdentifier) {
+			t.Errorf("Expected virtual property filter to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("ReadOnlyInPayloads", func(t *testing.T) {
+		err := ValidateEntityData(entity, map[string]interface{}{
+			"order_id": "order-2",
+			"customer": "Someone",
+			"total":    1,
+		})
+		var validationErr *jsonschema.ValidationError
+		if !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 {
+			t.Fatalf("Expected two read-only violations, got %v", err)
+		}
+		for _, violation := range validationErr.Violations {
+			if violation.Message != "is read-only" {
+				t.Errorf("Expected read-only violation, got %v", violation)
+			}
+		}
+	})
+
+	t.Run("UnregisteredFunction", func(t *testing.T) {
+		broken := computedTestEntity()
+		broken.Schema.Properties["initials"].Computed.Function = "missing_function"
+		err := checkComputedFunctions(&schema.Schema{Entities: map[string]*schema.Entity{"orders": broken}})
+		if err == nil {
+			t.Error("Expected error for unregistered computed function")
+		}
+	})
+}
+
+const utilityFunctionsSchema = `version: 1
+service:
+  name: "computed-test"
+entities:
+  members:
+    key: id
+    schema:
+      type: object
+      required: [id]
+      properties:
+        id: { type: string }
+        fee: { type: number }
+        joined: { type: string }
+        birth_date: { type: string, format: date }
+        fee_display:
+          type: string
+          computed: { expression: 'format_currency(fee, "EUR")' }
+        joined_on:
+          type: string
+          format: date
+          computed: { expression: 'parse_date(joined, "02/01/2006")', stored: true }
+        age:
+          type: integer
+          computed: { expression: "calculate_age(birth_date)" }
+`
+
+func TestComputedUtilityFunctions(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := os.WriteFile(schemaPath, []byte(utilityFunctionsSchema), 0o644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	engine, err := NewEngine(&Config{
+		TenantID:      "tenant",
+		SchemaSource:  "file",
+		SchemaPath:    schemaPath,
+		StorageDriver: StorageDriverMemory,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	server := httptest.NewServer(engine.router)
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":         "member-1",
+		"fee":        1234.5,
+		"joined":     "31/12/2020",
+		"birth_date": "2000-01-01",
+	})
+	resp, err := http.Post(server.URL+"/api/members", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create member: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 creating member, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	created := result.Data
+	if created["fee_display"] != "€1,234.50" {
+		t.Errorf("Expected fee_display '€1,234.50', got %v", created["fee_display"])
+	}
+	if created["joined_on"] != "2020-12-31" {
+		t.Errorf("Expected joined_on '2020-12-31', got %v", created["joined_on"])
+	}
+	if expected := float64(time.Now().Year() - 2000); created["age"] != expected {
+		t.Errorf("Expected age %v, got %v", expected, created["age"])
+	}
+}
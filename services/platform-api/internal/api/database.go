@@ -1,20 +1,36 @@
 package api
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"reflect"
 	"strings"
-	"time"
 
 	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
 )
 
-// DatabaseOperations handles all database-related operations
+// sqlExecutor is the subset of *sql.DB and *sql.Tx used by DatabaseOperations
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// DatabaseOperations handles all database-related operations. It is the
+// database/sql implementation of Store and backs both Postgres and SQLite.
 type DatabaseOperations struct {
 	db       *sql.DB
+	tx       *sql.Tx
 	tenantID string
+	dialect  *dialect
+
+	// ctx is the request context queries run with, set by WithContext;
+	// queries are traced when it is set
+	ctx context.Context
+
+	// events are the schema's declared events, set by EnsureTablesExist
+	events map[string]*schema.Event
 }
 
 // NewDatabaseOperations creates a new database operations handler
@@ -22,26 +38,104 @@ func NewDatabaseOperations(db *sql.DB, tenantID string) *DatabaseOperations {
 	return &DatabaseOperations{
 		db:       db,
 		tenantID: tenantID,
+		dialect:  postgresDialect,
+	}
+}
+
+// conn returns the active transaction, or the database outside of one,
+// traced when the handler is bound to a request context
+func (d *DatabaseOperations) conn() sqlExecutor {
+	if d.ctx != nil {
+		var conn contextExecutor = d.db
+		if d.tx != nil {
+			conn = d.tx
+		}
+		return tracedConn{conn: conn, ctx: d.ctx, system: d.sqlDialect().name}
+	}
+	if d.tx != nil {
+		return d.tx
+	}
+	return d.db
+}
+
+// sqlDialect returns the handler's dialect, defaulting to PostgreSQL
+func (d *DatabaseOperations) sqlDialect() *dialect {
+	if d.dialect == nil {
+		return postgresDialect
+	}
+	return d.dialect
+}
+
+// queryBuilder creates a query builder for an entity in this handler's dialect
+func (d *DatabaseOperations) queryBuilder(entityName string, entity *schema.Entity) *queryBuilder {
+	return newQueryBuilder(d.sqlDialect(), entityName, entity, d.getEntityColumns(entity))
+}
+
+// WithTransaction runs fn inside a database transaction
+func (d *DatabaseOperations) WithTransaction(fn func(tx Store) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+
+	txOps := &DatabaseOperations{
+		db:       d.db,
+		tx:       tx,
+		tenantID: d.tenantID,
+		dialect:  d.dialect,
+		events:   d.events,
+		ctx:      d.ctx,
+	}
+
+	if err := fn(txOps); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
-// EnsureTablesExist creates tables for all entities in the schema if they don't exist
+// EnsureTablesExist creates tables for all entities in the schema, and the
+// event outbox, if they don't exist
 func (d *DatabaseOperations) EnsureTablesExist(schemaObj *schema.Schema) error {
 	for entityName, entity := range schemaObj.Entities {
 		if err := d.createTableIfNotExists(entityName, entity); err != nil {
 			return fmt.Errorf("failed to create table for entity %s: %w", entityName, err)
 		}
 	}
+	
+	if err := d.createOutboxTable(); err != nil {
+		return err
+	}
+	d.events = schemaObj.Events
+	
 	return nil
 }
 
 // createTableIfNotExists creates a table for an entity if it doesn't exist
 func (d *DatabaseOperations) createTableIfNotExists(entityName string, entity *schema.Entity) error {
 	// Build CREATE TABLE statement
-	sqlQuery := d.buildCreateTableSQL(entityName, entity)
+	sqlQuery, err := d.buildCreateTableSQL(entityName, entity)
+	if err != nil {
+		return err
+	}
 	
 	// Execute the statement
-	_, err := d.db.Exec(sqlQuery)
+	_, err = d.conn().Exec(sqlQuery)
 	if err != nil {
 		return fmt.Errorf("failed to execute CREATE TABLE: %w", err)
 	}
@@ -50,22 +144,23 @@ func (d *DatabaseOperations) createTableIfNotExists(entityName string, entity *s
 }
 
 // buildCreateTableSQL generates a CREATE TABLE SQL statement from entity schema
-func (d *DatabaseOperations) buildCreateTableSQL(entityName string, entity *schema.Entity) string {
+func (d *DatabaseOperations) buildCreateTableSQL(entityName string, entity *schema.Entity) (string, error) {
 	var columns []string
 	
 	// Add primary key column (entity key)
-	keyColumn := fmt.Sprintf("%s VARCHAR(255) PRIMARY KEY", entity.Key)
+	keyColumn := fmt.Sprintf("%s VARCHAR(255) PRIMARY KEY", quoteIdentifier(entity.Key))
 	columns = append(columns, keyColumn)
 	
 	// Add tenant_id column for multi-tenancy only if not already defined in schema
 	if _, exists := entity.Schema.Properties["tenant_id"]; !exists {
-		columns = append(columns, "tenant_id VARCHAR(255) NOT NULL")
+		columns = append(columns, quoteIdentifier("tenant_id")+" VARCHAR(255) NOT NULL")
 	}
 	
 	// Add columns for each property in sorted order for consistency
 	var propNames []string
-	for propName := range entity.Schema.Properties {
-		if propName != entity.Key {
+	for propName, propDef := range entity.Schema.Properties {
+		// Virtual computed properties are evaluated on read and have no column
+		if propName != entity.Key && !propDef.Virtual() {
 			propNames = append(propNames, propName)
 		}
 	}
@@ -80,17 +175,27 @@ func (d *DatabaseOperations) buildCreateTableSQL(entityName string, entity *sche
 	}
 	
 	for _, propName := range propNames {
+		// tenant_id holds the platform's tenant identifier whatever format
+		// the schema declares for it
+		if propName == "tenant_id" {
+			columns = append(columns, quoteIdentifier("tenant_id")+" VARCHAR(255) NOT NULL")
+			continue
+		}
+		
 		propDef := entity.Schema.Properties[propName]
-		columnDef := d.propertyToColumnDefinition(propName, propDef)
+		columnDef, err := d.propertyToColumnDefinition(propName, propDef)
+		if err != nil {
+			return "", err
+		}
 		columns = append(columns, columnDef)
 	}
 	
 	// Add audit columns only if not already defined in schema
 	if _, exists := entity.Schema.Properties["created_at"]; !exists {
-		columns = append(columns, "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP")
+		columns = append(columns, quoteIdentifier("created_at")+" "+d.sqlDialect().timestampType+" DEFAULT CURRENT_TIMESTAMP")
 	}
 	if _, exists := entity.Schema.Properties["updated_at"]; !exists {
-		columns = append(columns, "updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP")
+		columns = append(columns, quoteIdentifier("updated_at")+" "+d.sqlDialect().timestampType+" DEFAULT CURRENT_TIMESTAMP")
 	}
 	
 	// Build the complete SQL
@@ -98,130 +203,86 @@ func (d *DatabaseOperations) buildCreateTableSQL(entityName string, entity *sche
 		CREATE TABLE IF NOT EXISTS %s (
 			%s
 		)`,
-		entityName,
+		quoteIdentifier(entityName),
 		strings.Join(columns, ",\n\t\t\t"),
 	)
 	
-	return sqlQuery
+	return sqlQuery, nil
 }
 
 // propertyToColumnDefinition converts a schema property to a SQL column definition
-func (d *DatabaseOperations) propertyToColumnDefinition(propName string, propDef *schema.PropertyDefinition) string {
-	var sqlType string
+func (d *DatabaseOperations) propertyToColumnDefinition(propName string, propDef *schema.PropertyDefinition) (string, error) {
 	var constraints []string
 	
-	// Map JSON schema types to PostgreSQL types
-	switch propDef.Type {
-	case "string":
-		if propDef.Format == "email" {
-			sqlType = "VARCHAR(255)"
-		} else if propDef.Format == "uri" {
-			sqlType = "TEXT"
-		} else if propDef.MaxLength > 0 {
-			sqlType = fmt.Sprintf("VARCHAR(%d)", propDef.MaxLength)
-		} else {
-			sqlType = "TEXT"
-		}
-	case "integer":
-		sqlType = "INTEGER"
-	case "number":
-		sqlType = "DECIMAL"
-	case "boolean":
-		sqlType = "BOOLEAN"
-	case "array":
-		sqlType = "JSONB"
-	case "object":
-		sqlType = "JSONB"
-	default:
-		sqlType = "TEXT"
-	}
+	// Map JSON schema types to SQL types
+	sqlType := columnType(d.sqlDialect(), propDef)
 	
 	// Add constraints
 	if propDef.Default != nil {
-		constraints = append(constraints, fmt.Sprintf("DEFAULT '%v'", propDef.Default))
+		literal, err := defaultLiteral(propDef)
+		if err != nil {
+			return "", fmt.Errorf("invalid default for property %s: %w", propName, err)
+		}
+		constraints = append(constraints, "DEFAULT "+literal)
+	}
+	
+	// Enforce enum, range and pattern in the database as well as the API
+	check, err := columnCheck(d.sqlDialect(), propName, propDef)
+	if err != nil {
+		return "", fmt.Errorf("invalid constraint for property %s: %w", propName, err)
+	}
+	if check != "" {
+		constraints = append(constraints, check)
 	}
 	
 	// Build column definition
-	columnDef := fmt.Sprintf("%s %s", propName, sqlType)
+	columnDef := fmt.Sprintf("%s %s", quoteIdentifier(propName), sqlType)
 	if len(constraints) > 0 {
 		columnDef += " " + strings.Join(constraints, " ")
 	}
 	
-	return columnDef
+	return columnDef, nil
 }
 
-// InsertEntity inserts a new entity into the database
+// InsertEntity inserts a new entity into the database, recording the
+// change in the outbox in the same transaction
 func (d *DatabaseOperations) InsertEntity(entityName string, entity *schema.Entity, data map[string]interface{}) (map[string]interface{}, error) {
-	// Create a copy of the data to avoid mutating the original map
-	insertData := make(map[string]interface{})
-	for k, v := range data {
-		insertData[k] = v
-	}
-	
-	// Add audit fields - truncate to microsecond precision to match PostgreSQL
-	now := time.Now().Truncate(time.Microsecond)
-	
-	// Add audit fields only if not already provided and not defined in schema
-	if _, exists := insertData["created_at"]; !exists && entity.Schema.Properties["created_at"] == nil {
-		insertData["created_at"] = now
-	}
-	if _, exists := insertData["updated_at"]; !exists {
-		insertData["updated_at"] = now
-	}
-	
-	// Add tenant_id only if not already provided and not defined in schema
-	if _, exists := insertData["tenant_id"]; !exists {
-		insertData["tenant_id"] = d.tenantID
-	} else {
-		// If tenant_id is provided, ensure it matches the current tenant for security
-		insertData["tenant_id"] = d.tenantID
+	var result map[string]interface{}
+	err := d.withOutbox(func(d *DatabaseOperations) error {
+		var err error
+		if result, err = d.insertEntity(entityName, entity, data); err != nil {
+			return err
+		}
+		return d.writeOutbox(entityName, entity, ActionCreated, result)
+	})
+	if err != nil {
+		return nil, err
 	}
-	
-	// Generate ID if not provided
-	if insertData[entity.Key] == nil {
-		insertData[entity.Key] = d.generateID()
+	return result, nil
+}
+
+// insertEntity inserts a new entity and returns the stored record
+func (d *DatabaseOperations) insertEntity(entityName string, entity *schema.Entity, data map[string]interface{}) (map[string]interface{}, error) {
+	// Fill in tenant, key, audit fields, defaults and stored computed
+	// properties on a copy of the data
+	insertData, err := prepareInsertData(entity, data, d.tenantID)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Serialize complex types (arrays, objects) to JSON for PostgreSQL
-	for key, value := range insertData {
-		if propDef, exists := entity.Schema.Properties[key]; exists {
-			if propDef.Type == "array" || propDef.Type == "object" {
-				if value != nil {
-					jsonBytes, err := json.Marshal(value)
-					if err != nil {
-						return nil, fmt.Errorf("failed to serialize %s: %w", key, err)
-					}
-					insertData[key] = string(jsonBytes)
-				}
-			}
-		}
+	// Convert timestamps, UUIDs and JSON values to their column types
+	if err := encodeRecord(entity, insertData); err != nil {
+		return nil, err
 	}
 	
-	// Get expected column order to ensure consistent insertion
-	expectedColumns := d.getEntityColumns(entity)
-	columns := make([]string, 0, len(expectedColumns))
-	placeholders := make([]string, 0, len(expectedColumns))
-	values := make([]interface{}, 0, len(expectedColumns))
-	
-	i := 1
-	for _, col := range expectedColumns {
-		if value, exists := insertData[col]; exists {
-			columns = append(columns, col)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, value)
-			i++
-		}
+	// Build the insert using only schema columns
+	sqlQuery, values, err := d.queryBuilder(entityName, entity).buildInsert(insertData)
+	if err != nil {
+		return nil, err
 	}
 	
-	sqlQuery := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
-		entityName,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-	)
-	
 	// Execute the insert
-	row := d.db.QueryRow(sqlQuery, values...)
+	row := d.conn().QueryRow(sqlQuery, values...)
 	
 	// Convert result back to map
 	result, err := d.rowToMap(row, entity)
@@ -232,75 +293,62 @@ func (d *DatabaseOperations) InsertEntity(entityName string, entity *schema.Enti
 	return result, nil
 }
 
-// UpdateEntity updates an existing entity in the database
+// UpdateEntity updates an existing entity in the database, recording the
+// change in the outbox in the same transaction
 func (d *DatabaseOperations) UpdateEntity(entityName string, entity *schema.Entity, id string, data map[string]interface{}) (map[string]interface{}, error) {
-	// Create a copy to avoid mutating the original
-	updateData := make(map[string]interface{})
-	for k, v := range data {
-		updateData[k] = v
-	}
-	
-	// Add audit fields - truncate to microsecond precision to match PostgreSQL
-	// Only add updated_at if it's not already in the data
-	if _, exists := updateData["updated_at"]; !exists {
-		updateData["updated_at"] = time.Now().Truncate(time.Microsecond)
-	}
-	
-	// Remove key and tenant_id from update data
-	delete(updateData, entity.Key)
-	delete(updateData, "tenant_id")
-	delete(updateData, "created_at") // Don't allow updating created_at
-	
-	if len(updateData) == 0 {
-		return nil, fmt.Errorf("no fields to update")
-	}
-	
-	// Serialize complex types (arrays, objects) to JSON for PostgreSQL
-	for key, value := range updateData {
-		if propDef, exists := entity.Schema.Properties[key]; exists {
-			if propDef.Type == "array" || propDef.Type == "object" {
-				if value != nil {
-					jsonBytes, err := json.Marshal(value)
-					if err != nil {
-						return nil, fmt.Errorf("failed to serialize %s: %w", key, err)
-					}
-					updateData[key] = string(jsonBytes)
-				}
-			}
+	var result map[string]interface{}
+	err := d.withOutbox(func(d *DatabaseOperations) error {
+		var err error
+		if result, err = d.updateEntity(entityName, entity, id, data); err != nil {
+			return err
 		}
+		return d.writeOutbox(entityName, entity, ActionUpdated, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateEntity updates an entity by key and returns the stored record
+func (d *DatabaseOperations) updateEntity(entityName string, entity *schema.Entity, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	// Stamp updated_at and strip immutable fields on a copy of the data
+	updateData, err := prepareUpdateData(entity, data)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Build UPDATE statement
-	setParts := make([]string, 0, len(updateData))
-	values := make([]interface{}, 0, len(updateData)+2)
-	
-	i := 1
-	for key, value := range updateData {
-		setParts = append(setParts, fmt.Sprintf("%s = $%d", key, i))
-		values = append(values, value)
-		i++
+	// Stored computed properties are recomputed from the current record;
+	// UpdateEntity runs in a transaction, so it is read and written atomically
+	if len(computedProperties(entity, true)) > 0 {
+		existing, err := d.GetEntity(entityName, entity, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := computeStoredUpdate(entity, existing, updateData); err != nil {
+			return nil, err
+		}
 	}
 	
-	// Add WHERE clause parameters
-	values = append(values, id, d.tenantID)
+	// Convert timestamps, UUIDs and JSON values to their column types
+	if err := encodeRecord(entity, updateData); err != nil {
+		return nil, err
+	}
 	
-	sqlQuery := fmt.Sprintf(
-		"UPDATE %s SET %s WHERE %s = $%d AND tenant_id = $%d RETURNING *",
-		entityName,
-		strings.Join(setParts, ", "),
-		entity.Key,
-		i,
-		i+1,
-	)
+	// Build UPDATE statement, rejecting fields that are not in the schema
+	sqlQuery, values, err := d.queryBuilder(entityName, entity).buildUpdate(d.tenantID, id, updateData)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Execute the update
-	row := d.db.QueryRow(sqlQuery, values...)
+	row := d.conn().QueryRow(sqlQuery, values...)
 	
 	// Convert result back to map
 	result, err := d.rowToMap(row, entity)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("entity not found")
+			return nil, ErrEntityNotFound
 		}
 		return nil, fmt.Errorf("failed to update entity: %w", err)
 	}
@@ -310,39 +358,14 @@ func (d *DatabaseOperations) UpdateEntity(entityName string, entity *schema.Enti
 
 // QueryEntities retrieves entities with optional filtering, pagination, and sorting
 func (d *DatabaseOperations) QueryEntities(entityName string, entity *schema.Entity, filters map[string]interface{}, limit, offset int, orderBy string) ([]map[string]interface{}, error) {
-	// Build base query
-	query := fmt.Sprintf("SELECT * FROM %s WHERE tenant_id = $1", entityName)
-	args := []interface{}{d.tenantID}
-	argIndex := 2
-	
-	// Add filters
-	for key, value := range filters {
-		query += fmt.Sprintf(" AND %s = $%d", key, argIndex)
-		args = append(args, value)
-		argIndex++
-	}
-	
-	// Add ordering
-	if orderBy != "" {
-		query += fmt.Sprintf(" ORDER BY %s", orderBy)
-	} else {
-		query += " ORDER BY created_at DESC"
-	}
-	
-	// Add pagination
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d", argIndex)
-		args = append(args, limit)
-		argIndex++
-	}
-	
-	if offset > 0 {
-		query += fmt.Sprintf(" OFFSET $%d", argIndex)
-		args = append(args, offset)
+	// Build the query; filter and order_by fields must exist in the schema
+	query, args, err := d.queryBuilder(entityName, entity).buildSelect(d.tenantID, filters, limit, offset, orderBy)
+	if err != nil {
+		return nil, err
 	}
 	
 	// Execute query
-	rows, err := d.db.Query(query, args...)
+	rows, err := d.conn().Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query entities: %w", err)
 	}
@@ -359,14 +382,14 @@ func (d *DatabaseOperations) QueryEntities(entityName string, entity *schema.Ent
 
 // GetEntity retrieves a single entity by ID
 func (d *DatabaseOperations) GetEntity(entityName string, entity *schema.Entity, id string) (map[string]interface{}, error) {
-	query := fmt.Sprintf("SELECT * FROM %s WHERE %s = $1 AND tenant_id = $2", entityName, entity.Key)
+	query, args := d.queryBuilder(entityName, entity).buildGet(d.tenantID, id)
 	
-	row := d.db.QueryRow(query, id, d.tenantID)
+	row := d.conn().QueryRow(query, args...)
 	
 	result, err := d.rowToMap(row, entity)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("entity not found")
+			return nil, ErrEntityNotFound
 		}
 		return nil, fmt.Errorf("failed to get entity: %w", err)
 	}
@@ -374,11 +397,27 @@ func (d *DatabaseOperations) GetEntity(entityName string, entity *schema.Entity,
 	return result, nil
 }
 
-// DeleteEntity deletes an entity by ID
+// DeleteEntity deletes an entity by ID, recording the change in the
+// outbox in the same transaction
 func (d *DatabaseOperations) DeleteEntity(entityName string, entity *schema.Entity, id string) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND tenant_id = $2", entityName, entity.Key)
+	return d.withOutbox(func(d *DatabaseOperations) error {
+		// The change records the record as it was before deletion
+		existing, err := d.GetEntity(entityName, entity, id)
+		if err != nil {
+			return err
+		}
+		if err := d.deleteEntity(entityName, entity, id); err != nil {
+			return err
+		}
+		return d.writeOutbox(entityName, entity, ActionDeleted, existing)
+	})
+}
+
+// deleteEntity deletes an entity by key
+func (d *DatabaseOperations) deleteEntity(entityName string, entity *schema.Entity, id string) error {
+	query, args := d.queryBuilder(entityName, entity).buildDelete(d.tenantID, id)
 	
-	result, err := d.db.Exec(query, id, d.tenantID)
+	result, err := d.conn().Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to delete entity: %w", err)
 	}
@@ -389,7 +428,7 @@ func (d *DatabaseOperations) DeleteEntity(entityName string, entity *schema.Enti
 	}
 	
 	if rowsAffected == 0 {
-		return fmt.Errorf("entity not found")
+		return ErrEntityNotFound
 	}
 	
 	return nil
@@ -417,33 +456,9 @@ func (d *DatabaseOperations) rowToMap(row *sql.Row, entity *schema.Entity) (map[
 	// Convert to map
 	result := make(map[string]interface{})
 	for i, col := range columns {
-		val := values[i]
-		
-		// Convert []byte to string for text fields
-		if b, ok := val.([]byte); ok {
-			val = string(b)
-		}
-		
-		// Normalize timestamp fields to match Go's timezone format
-		if t, ok := val.(time.Time); ok && (col == "created_at" || col == "updated_at") {
-			// Ensure timezone is in UTC and truncate to microsecond precision
-			val = t.UTC().Truncate(time.Microsecond)
-		}
-		
-		// Deserialize JSON fields back to Go types
-		if propDef, exists := entity.Schema.Properties[col]; exists {
-			if propDef.Type == "array" || propDef.Type == "object" {
-				if strVal, ok := val.(string); ok && strVal != "" {
-					var jsonVal interface{}
-					if err := json.Unmarshal([]byte(strVal), &jsonVal); err == nil {
-						val = jsonVal
-					}
-				}
-			}
-		}
-		
-		result[col] = val
+		result[col] = decodeColumnValue(col, values[i], entity)
 	}
+	computeVirtualFields(entity, result)
 	
 	return result, nil
 }
@@ -476,33 +491,9 @@ func (d *DatabaseOperations) rowsToMaps(rows *sql.Rows, entity *schema.Entity) (
 		// Convert to map
 		result := make(map[string]interface{})
 		for i, col := range columns {
-			val := values[i]
-			
-			// Convert []byte to string for text fields
-			if b, ok := val.([]byte); ok {
-				val = string(b)
-			}
-			
-			// Normalize timestamp fields to match Go's timezone format
-			if t, ok := val.(time.Time); ok && (col == "created_at" || col == "updated_at") {
-				// Ensure timezone is in UTC and truncate to microsecond precision
-				val = t.UTC().Truncate(time.Microsecond)
-			}
-			
-			// Deserialize JSON fields back to Go types
-			if propDef, exists := entity.Schema.Properties[col]; exists {
-				if propDef.Type == "array" || propDef.Type == "object" {
-					if strVal, ok := val.(string); ok && strVal != "" {
-						var jsonVal interface{}
-						if err := json.Unmarshal([]byte(strVal), &jsonVal); err == nil {
-							val = jsonVal
-						}
-					}
-				}
-			}
-			
-			result[col] = val
+			result[col] = decodeColumnValue(col, values[i], entity)
 		}
+		computeVirtualFields(entity, result)
 		
 		results = append(results, result)
 	}
@@ -512,6 +503,11 @@ func (d *DatabaseOperations) rowsToMaps(rows *sql.Rows, entity *schema.Entity) (
 
 // getEntityColumns returns the expected column names for an entity in the same order as table creation
 func (d *DatabaseOperations) getEntityColumns(entity *schema.Entity) []string {
+	return entityColumns(entity)
+}
+
+// entityColumns returns the column names every store keeps for an entity
+func entityColumns(entity *schema.Entity) []string {
 	columns := []string{entity.Key}
 	
 	// Add tenant_id only if not already defined in schema properties
@@ -521,8 +517,8 @@ func (d *DatabaseOperations) getEntityColumns(entity *schema.Entity) []string {
 	
 	// Get property names in sorted order for consistency
 	var propNames []string
-	for propName := range entity.Schema.Properties {
-		if propName != entity.Key {
+	for propName, propDef := range entity.Schema.Properties {
+		if propName != entity.Key && !propDef.Virtual() {
 			propNames = append(propNames, propName)
 		}
 	}
@@ -550,122 +546,24 @@ func (d *DatabaseOperations) getEntityColumns(entity *schema.Entity) []string {
 	return columns
 }
 
-// generateID generates a unique ID for an entity
-func (d *DatabaseOperations) generateID() string {
-	// Simple UUID-like ID generation
-	// In production, you might want to use a proper UUID library
-	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Unix())
-}
-
 // ValidateEntityData validates entity data against the schema
 func (d *DatabaseOperations) ValidateEntityData(entity *schema.Entity, data map[string]interface{}) error {
-	// Check required fields
-	for _, requiredField := range entity.Schema.Required {
-		if _, exists := data[requiredField]; !exists {
-			return fmt.Errorf("required field '%s' is missing", requiredField)
-		}
-	}
-	
-	// Validate each property
-	for propName, value := range data {
-		// Skip system fields
-		if propName == "tenant_id" || propName == "created_at" || propName == "updated_at" {
-			continue
-		}
-		
-		propDef, exists := entity.Schema.Properties[propName]
-		if !exists {
-			return fmt.Errorf("unknown property '%s'", propName)
-		}
-		
-		if err := d.validateProperty(propName, value, propDef); err != nil {
-			return err
-		}
-	}
-	
-	return nil
+	return ValidateEntityData(entity, data)
 }
 
-// validateProperty validates a single property value against its definition
-func (d *DatabaseOperations) validateProperty(propName string, value interface{}, propDef *schema.PropertyDefinition) error {
-	if value == nil {
-		return nil // Allow null values for optional fields
-	}
-	
-	// Type validation
-	switch propDef.Type {
-	case "string":
-		if _, ok := value.(string); !ok {
-			return fmt.Errorf("property '%s' must be a string", propName)
-		}
-		
-		str := value.(string)
-		
-		// Length validation
-		if propDef.MinLength > 0 && len(str) < propDef.MinLength {
-			return fmt.Errorf("property '%s' must be at least %d characters", propName, propDef.MinLength)
-		}
-		if propDef.MaxLength > 0 && len(str) > propDef.MaxLength {
-			return fmt.Errorf("property '%s' must be at most %d characters", propName, propDef.MaxLength)
-		}
-		
-		// Enum validation
-		if len(propDef.Enum) > 0 {
-			valid := false
-			for _, enumValue := range propDef.Enum {
-				if str == enumValue {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				return fmt.Errorf("property '%s' must be one of: %v", propName, propDef.Enum)
-			}
-		}
-		
-	case "integer":
-		// Check if it's a number that can be converted to int
-		switch v := value.(type) {
-		case int, int32, int64:
-			// Already an integer
-		case float64:
-			if v != float64(int64(v)) {
-				return fmt.Errorf("property '%s' must be an integer", propName)
-			}
-		default:
-			return fmt.Errorf("property '%s' must be an integer", propName)
-		}
-		
-	case "number":
-		if !isNumeric(value) {
-			return fmt.Errorf("property '%s' must be a number", propName)
-		}
-		
-	case "boolean":
-		if _, ok := value.(bool); !ok {
-			return fmt.Errorf("property '%s' must be a boolean", propName)
-		}
-		
-	case "array":
-		if reflect.TypeOf(value).Kind() != reflect.Slice {
-			return fmt.Errorf("property '%s' must be an array", propName)
-		}
-		
-	case "object":
-		if reflect.TypeOf(value).Kind() != reflect.Map {
-			return fmt.Errorf("property '%s' must be an object", propName)
-		}
-	}
-	
-	return nil
-}
+// systemFields are managed by the stores, so clients may send any value
+var systemFields = []string{"tenant_id", "created_at", "updated_at"}
 
-// isNumeric checks if a value is numeric
-func isNumeric(value interface{}) bool {
-	switch value.(type) {
-	case int, int32, int64, float32, float64:
-		return true
-	default:
-		return false
-	}
+// ValidateEntityData validates entity data against the schema independently
+// of the store it will be written to. It returns a *jsonschema.ValidationError
+// listing every violation, located by JSON pointer.
+func ValidateEntityData(entity *schema.Entity, data map[string]interface{}) error {
+	entitySchema := entity.Schema.JSONSchema()
+	if entitySchema.Properties == nil {
+		entitySchema.Properties = make(map[string]*jsonschema.Schema)
+	}
+	for _, field := range systemFields {
+		entitySchema.Properties[field] = nil
+	}
+	return entitySchema.Validate(data)
 }
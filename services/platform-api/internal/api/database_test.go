@@ -2,10 +2,13 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
 	_ "github.com/lib/pq"
 )
 
@@ -56,8 +59,8 @@ func TestDatabaseOperations(t *testing.T) {
 						},
 						"age": {
 							Type:    "integer",
-							Minimum: 0,
-							Maximum: 150,
+							Minimum: floatPtr(0),
+							Maximum: floatPtr(150),
 						},
 						"active": {
 							Type:    "boolean",
@@ -284,6 +287,11 @@ func TestDatabaseOperations(t *testing.T) {
 	})
 }
 
+// floatPtr returns a pointer for optional numeric schema keywords
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
 func TestPropertyToColumnDefinition(t *testing.T) {
 	dbOps := &DatabaseOperations{}
 
@@ -300,7 +308,7 @@ func TestPropertyToColumnDefinition(t *testing.T) {
 				Type:      "string",
 				MaxLength: 100,
 			},
-			expected: "name VARCHAR(100)",
+			expected: `"name" VARCHAR(100)`,
 		},
 		{
 			name:     "Email property",
@@ -309,7 +317,7 @@ func TestPropertyToColumnDefinition(t *testing.T) {
 				Type:   "string",
 				Format: "email",
 			},
-			expected: "email VARCHAR(255)",
+			expected: `"email" VARCHAR(255)`,
 		},
 		{
 			name:     "Integer property",
@@ -317,7 +325,7 @@ func TestPropertyToColumnDefinition(t *testing.T) {
 			propDef: &schema.PropertyDefinition{
 				Type: "integer",
 			},
-			expected: "age INTEGER",
+			expected: `"age" INTEGER`,
 		},
 		{
 			name:     "Boolean property with default",
@@ -326,7 +334,7 @@ func TestPropertyToColumnDefinition(t *testing.T) {
 				Type:    "boolean",
 				Default: true,
 			},
-			expected: "active BOOLEAN DEFAULT 'true'",
+			expected: `"active" BOOLEAN DEFAULT TRUE`,
 		},
 		{
 			name:     "JSON property",
@@ -334,13 +342,73 @@ func TestPropertyToColumnDefinition(t *testing.T) {
 			propDef: &schema.PropertyDefinition{
 				Type: "object",
 			},
-			expected: "metadata JSONB",
+			expected: `"metadata" JSONB`,
+		},
+		{
+			name:     "String default is escaped",
+			propName: "status",
+			propDef: &schema.PropertyDefinition{
+				Type:    "string",
+				Default: "it's'); DROP TABLE users; --",
+			},
+			expected: `"status" TEXT DEFAULT 'it''s''); DROP TABLE users; --'`,
+		},
+		{
+			name:     "Date-time property",
+			propName: "closed_at",
+			propDef: &schema.PropertyDefinition{
+				Type:   "string",
+				Format: "date-time",
+			},
+			expected: `"closed_at" TIMESTAMPTZ`,
+		},
+		{
+			name:     "UUID property",
+			propName: "owner_id",
+			propDef: &schema.PropertyDefinition{
+				Type:   "string",
+				Format: "uuid",
+			},
+			expected: `"owner_id" UUID`,
+		},
+		{
+			name:     "Decimal with precision and range",
+			propName: "amount",
+			propDef: &schema.PropertyDefinition{
+				Type:      "number",
+				Precision: 12,
+				Scale:     2,
+				Minimum:   floatPtr(0),
+				Maximum:   floatPtr(1000000),
+			},
+			expected: `"amount" NUMERIC(12,2) CHECK ("amount" >= 0 AND "amount" <= 1000000)`,
+		},
+		{
+			name:     "Enum property",
+			propName: "stage",
+			propDef: &schema.PropertyDefinition{
+				Type: "string",
+				Enum: []string{"lead", "won"},
+			},
+			expected: `"stage" TEXT CHECK ("stage" IN ('lead', 'won'))`,
+		},
+		{
+			name:     "Pattern left to the validator",
+			propName: "slug",
+			propDef: &schema.PropertyDefinition{
+				Type:    "string",
+				Pattern: "^[a-z0-9-]{3,40}$",
+			},
+			expected: `"slug" TEXT`,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := dbOps.propertyToColumnDefinition(tc.propName, tc.propDef)
+			result, err := dbOps.propertyToColumnDefinition(tc.propName, tc.propDef)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			if result != tc.expected {
 				t.Errorf("Expected '%s', got '%s'", tc.expected, result)
 			}
@@ -843,3 +911,48 @@ func TestCRMSchemaFieldMapping(t *testing.T) {
 		db.Exec("DROP TABLE IF EXISTS contacts")
 	})
 }
+
+func TestValidateEntityDataReportsAllViolations(t *testing.T) {
+	entity := &schema.Entity{
+		Key: "user_id",
+		Schema: schema.EntitySchema{
+			Type:     "object",
+			Required: []string{"user_id", "email"},
+			Properties: map[string]*schema.PropertyDefinition{
+				"user_id": {Type: "string"},
+				"email":   {Type: "string", Format: "email"},
+				"age":     {Type: "integer", Minimum: floatPtr(0)},
+				"address": {
+					Type:     "object",
+					Required: []string{"city"},
+					Properties: map[string]*schema.PropertyDefinition{
+						"city": {Type: "string"},
+						"zip":  {Type: "string", Pattern: `^[0-9]{5}$`},
+					},
+				},
+			},
+		},
+	}
+
+	err := ValidateEntityData(entity, map[string]interface{}{
+		"user_id":   "user123",
+		"tenant_id": "tenant",
+		"age":       -1,
+		"address":   map[string]interface{}{"zip": "ABCDE"},
+		"nickname":  "unknown",
+	})
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected *jsonschema.ValidationError, got %v", err)
+	}
+
+	var paths []string
+	for _, violation := range validationErr.Violations {
+		paths = append(paths, violation.Path)
+	}
+	expected := []string{"/email", "/address/city", "/address/zip", "/age", "/nickname"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected violations at %v, got %v", expected, validationErr.Violations)
+	}
+}
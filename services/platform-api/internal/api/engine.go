@@ -1,41 +1,65 @@
 package api
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 	"github.com/backsaas/platform/services/platform-api/internal/admin"
 	"github.com/backsaas/platform/services/platform-api/internal/auth"
 	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
 )
 
 // Engine represents the generic schema-driven API engine
 type Engine struct {
 	schema          *schema.Schema
-	db              *sql.DB
-	dbOps           *DatabaseOperations
+	schemaPath      string // schema file, empty when loaded from the registry
+	store           Store
 	tenantID        string
 	router          *gin.Engine
 	authService     *admin.AuthService
 	userAuthService *auth.UserAuthService
+	relay           *OutboxRelay   // nil when no event bus is configured
+	usage           *UsageReporter // nil when no gateway is configured
+	access          *accessChecker
+	changes         *changeNotifier
+	tracer          trace.Tracer             // nil when tracing is off
+	tracerProvider  *sdktrace.TracerProvider // nil when tracing is off
+	jobs            JobQueue                 // nil when no job API is configured
 }
 
 // Config holds configuration for the API engine
 type Config struct {
-	TenantID     string
-	SchemaSource string // "file" or "registry"
-	SchemaPath   string // file path or tenant ID for registry
-	DatabaseURL  string
-	Port         string
+	TenantID      string
+	SchemaSource  string // "file" or "registry"
+	SchemaPath    string // file path or tenant ID for registry
+	StorageDriver string // "postgres" (default), "sqlite" or "memory"
+	DatabaseURL   string // connection URL for postgres, file path for sqlite
+	RedisURL      string // event bus the outbox relay publishes to; empty disables the relay
+	JobsURL       string // job API async hooks are enqueued with; empty leaves them unrun
+	GatewayURL    string // gateway resource usage is reported to; empty disables reports
+	GatewaySecret string // gateway JWT secret the usage reports are signed with
+	Port          string
+	
+	// Tracing configures span export; the service name defaults to the
+	// schema's service name
+	Tracing TracingConfig
 }
 
 // NewEngine creates a new API engine instance
 func NewEngine(config *Config) (*Engine, error) {
+	// Computed expressions may call the platform's utility functions
+	if err := registerUtilityFunctions(); err != nil {
+		return nil, fmt.Errorf("failed to register utility functions: %w", err)
+	}
+	
 	// Load schema
 	var schemaObj *schema.Schema
 	var err error
@@ -47,8 +71,10 @@ func NewEngine(config *Config) (*Engine, error) {
 	}
 	loader := schema.NewLoader(basePath)
 	
+	var schemaPath string
 	switch config.SchemaSource {
 	case "file":
+		schemaPath = config.SchemaPath
 		schemaObj, err = loader.LoadFromFile(config.SchemaPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load schema from file: %w", err)
@@ -62,14 +88,35 @@ func NewEngine(config *Config) (*Engine, error) {
 		return nil, fmt.Errorf("invalid schema source: %s", config.SchemaSource)
 	}
 	
-	// Connect to database
-	db, err := sql.Open("postgres", config.DatabaseURL)
+	// Computed properties may reference Go functions registered by the host
+	if err := checkComputedFunctions(schemaObj); err != nil {
+		return nil, err
+	}
+	
+	access, err := newAccessChecker(schemaObj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("invalid access rules: %w", err)
 	}
 	
-	// Create database operations handler
-	dbOps := NewDatabaseOperations(db, config.TenantID)
+	// Open the configured storage backend
+	store, err := OpenStore(config.StorageDriver, config.DatabaseURL, config.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Trace requests, queries and function executions
+	tracingConfig := config.Tracing
+	if tracingConfig.ServiceName == "" {
+		tracingConfig.ServiceName = schemaObj.Service.Name
+	}
+	tracerProvider, err := newTracerProvider(tracingConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	var tracer trace.Tracer
+	if tracerProvider != nil {
+		tracer = tracerProvider.Tracer(tracerName)
+	}
 	
 	// Create admin auth service
 	authService := admin.NewAuthService()
@@ -80,18 +127,51 @@ func NewEngine(config *Config) (*Engine, error) {
 	// Create engine
 	engine := &Engine{
 		schema:          schemaObj,
-		db:              db,
-		dbOps:           dbOps,
+		schemaPath:      schemaPath,
+		store:           store,
 		tenantID:        config.TenantID,
 		authService:     authService,
 		userAuthService: userAuthService,
+		access:          access,
+		changes:         newChangeNotifier(),
+		tracer:          tracer,
+		tracerProvider:  tracerProvider,
 	}
 	
 	// Ensure database tables exist for all entities
-	if err := dbOps.EnsureTablesExist(schemaObj); err != nil {
+	if err := store.EnsureTablesExist(schemaObj); err != nil {
 		return nil, fmt.Errorf("failed to ensure database tables exist: %w", err)
 	}
 	
+	// Relay outbox events to the event bus
+	if config.RedisURL != "" {
+		publisher, err := NewRedisPublisher(config.RedisURL, DefaultEventStream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure event bus: %w", err)
+		}
+		engine.relay = NewOutboxRelay(store, publisher, RelayConfig{})
+	}
+	
+	// Run async hooks as jobs
+	if config.JobsURL != "" {
+		engine.jobs = NewHTTPJobQueue(config.JobsURL)
+	} else if hasAsyncHooks(schemaObj) {
+		log.Printf("JOBS_URL not set, async hooks will not run")
+	}
+	
+	// Report storage and entities to the gateway's quota checks
+	if config.GatewayURL != "" {
+		if config.GatewaySecret == "" {
+			return nil, fmt.Errorf("a gateway secret is required to report usage to %s", config.GatewayURL)
+		}
+		engine.usage = NewUsageReporter(store, schemaObj, config.TenantID, UsageReporterConfig{
+			GatewayURL: config.GatewayURL,
+			Secret:     config.GatewaySecret,
+		})
+	} else {
+		log.Printf("GATEWAY_URL not set, resource usage will not be reported")
+	}
+	
 	// Setup router
 	if err := engine.setupRouter(); err != nil {
 		return nil, fmt.Errorf("failed to setup router: %w", err)
@@ -108,6 +188,7 @@ func (e *Engine) setupRouter() error {
 	e.router = gin.Default()
 	
 	// Add middleware
+	e.router.Use(e.tracingMiddleware())
 	e.router.Use(e.tenantMiddleware())
 	e.router.Use(e.loggingMiddleware())
 	
@@ -142,6 +223,9 @@ func (e *Engine) setupEntityRoutes(group *gin.RouterGroup, entityName string, en
 	// POST /api/{entity} - Create entity
 	entityGroup.POST("", e.createEntity(entityName, entity))
 	
+	// GET /api/{entity}/_changes - Stream changes (SSE or WebSocket)
+	entityGroup.GET("/_changes", e.streamChanges(entityName, entity))
+	
 	// GET /api/{entity}/{id} - Get entity by ID
 	entityGroup.GET("/:id", e.getEntity(entityName, entity))
 	
@@ -197,6 +281,13 @@ func (e *Engine) setupUserAuthRoutes() {
 	
 	// GET /api/platform/health/tests - Get system test results
 	healthGroup.GET("/tests", e.GetSystemHealthTests)
+	
+	// Function testing routes (admin authentication required)
+	functionGroup := e.router.Group("/api/platform/functions")
+	functionGroup.Use(e.authService.AuthMiddleware())
+	
+	// POST /api/platform/functions/test - Run platform function test cases
+	functionGroup.POST("/test", e.RunFunctionTests)
 }
 
 // tenantMiddleware adds tenant context to requests
@@ -241,12 +332,6 @@ func (e *Engine) getSchema(c *gin.Context) {
 // listEntities handles GET /api/{entity}
 func (e *Engine) listEntities(entityName string, entity *schema.Entity) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Execute before_read hooks
-		if err := e.executeHooks("before_read", entityName, nil, c); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		
 		// Parse query parameters for filtering, pagination, sorting
 		filters := make(map[string]interface{})
 		for key, values := range c.Request.URL.Query() {
@@ -272,18 +357,16 @@ func (e *Engine) listEntities(entityName string, entity *schema.Entity) gin.Hand
 		orderBy := c.Query("order_by")
 		
 		// Query entities using database operations
-		results, err := e.dbOps.QueryEntities(entityName, entity, filters, limit, offset, orderBy)
+		results, err := e.storeFor(c.Request.Context()).QueryEntities(entityName, entity, filters, limit, offset, orderBy)
 		if err != nil {
+			if errors.Is(err, ErrInvalidIdentifier) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
 			return
 		}
 		
-		// Execute after_read hooks
-		if err := e.executeHooks("after_read", entityName, results, c); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		
 		c.JSON(http.StatusOK, gin.H{
 			"data": results,
 			"meta": gin.H{
@@ -306,8 +389,8 @@ func (e *Engine) createEntity(entityName string, entity *schema.Entity) gin.Hand
 		data["tenant_id"] = e.tenantID
 		
 		// Validate data against schema
-		if err := e.dbOps.ValidateEntityData(entity, data); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ValidateEntityData(entity, data); err != nil {
+			respondValidationError(c, err)
 			return
 		}
 		
@@ -317,25 +400,16 @@ func (e *Engine) createEntity(entityName string, entity *schema.Entity) gin.Hand
 			return
 		}
 		
-		// Execute before_create hooks
-		if err := e.executeHooks("before_create", entityName, data, c); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		
 		// Insert into database
-		result, err := e.dbOps.InsertEntity(entityName, entity, data)
+		result, err := e.storeFor(c.Request.Context()).InsertEntity(entityName, entity, data)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create entity"})
 			return
 		}
+		e.changes.notify()
 		
-		// Execute after_create hooks (async)
-		go func() {
-			if err := e.executeHooks("after_create", entityName, result, c); err != nil {
-				log.Printf("after_create hook failed: %v", err)
-			}
-		}()
+		// Enqueue hooks now the record is committed
+		e.runHooks(c, entityName, result, "before_create", "after_create")
 		
 		c.JSON(http.StatusCreated, gin.H{
 			"data": result,
@@ -348,9 +422,9 @@ func (e *Engine) getEntity(entityName string, entity *schema.Entity) gin.Handler
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		
-		result, err := e.dbOps.GetEntity(entityName, entity, id)
+		result, err := e.storeFor(c.Request.Context()).GetEntity(entityName, entity, id)
 		if err != nil {
-			if err.Error() == "entity not found" {
+			if errors.Is(err, ErrEntityNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
 				return
 			}
@@ -380,8 +454,8 @@ func (e *Engine) updateEntity(entityName string, entity *schema.Entity) gin.Hand
 		data[entity.Key] = id
 		
 		// Validate data against schema
-		if err := e.dbOps.ValidateEntityData(entity, data); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ValidateEntityData(entity, data); err != nil {
+			respondValidationError(c, err)
 			return
 		}
 		
@@ -391,29 +465,24 @@ func (e *Engine) updateEntity(entityName string, entity *schema.Entity) gin.Hand
 			return
 		}
 		
-		// Execute before_update hooks
-		if err := e.executeHooks("before_update", entityName, data, c); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		
 		// Update in database
-		result, err := e.dbOps.UpdateEntity(entityName, entity, id, data)
+		result, err := e.storeFor(c.Request.Context()).UpdateEntity(entityName, entity, id, data)
 		if err != nil {
-			if err.Error() == "entity not found" {
+			if errors.Is(err, ErrEntityNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
 				return
 			}
+			if errors.Is(err, ErrInvalidIdentifier) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update entity"})
 			return
 		}
+		e.changes.notify()
 		
-		// Execute after_update hooks (async)
-		go func() {
-			if err := e.executeHooks("after_update", entityName, result, c); err != nil {
-				log.Printf("after_update hook failed: %v", err)
-			}
-		}()
+		// Enqueue hooks now the change is committed
+		e.runHooks(c, entityName, result, "before_update", "after_update")
 		
 		c.JSON(http.StatusOK, gin.H{
 			"data": result,
@@ -426,29 +495,20 @@ func (e *Engine) deleteEntity(entityName string, entity *schema.Entity) gin.Hand
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		
-		// Execute before_delete hooks
-		if err := e.executeHooks("before_delete", entityName, map[string]interface{}{entity.Key: id}, c); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-		
 		// Delete from database
-		err := e.dbOps.DeleteEntity(entityName, entity, id)
+		err := e.storeFor(c.Request.Context()).DeleteEntity(entityName, entity, id)
 		if err != nil {
-			if err.Error() == "entity not found" {
+			if errors.Is(err, ErrEntityNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
 				return
 			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete entity"})
 			return
 		}
+		e.changes.notify()
 		
-		// Execute after_delete hooks (async)
-		go func() {
-			if err := e.executeHooks("after_delete", entityName, map[string]interface{}{entity.Key: id}, c); err != nil {
-				log.Printf("after_delete hook failed: %v", err)
-			}
-		}()
+		// Enqueue hooks now the delete is committed
+		e.runHooks(c, entityName, map[string]interface{}{entity.Key: id}, "before_delete", "after_delete")
 		
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Entity deleted successfully",
@@ -456,16 +516,43 @@ func (e *Engine) deleteEntity(entityName string, entity *schema.Entity) gin.Hand
 	}
 }
 
+// respondValidationError writes a 400 listing every schema violation
+func respondValidationError(c *gin.Context, err error) {
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Validation failed",
+			"violations": validationErr.Violations,
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
 // Start starts the HTTP server
 func (e *Engine) Start(port string) error {
 	log.Printf("Starting API server on port %s for tenant: %s", port, e.tenantID)
+	if e.relay != nil {
+		go e.relay.Run(context.Background())
+	}
+	if e.usage != nil {
+		go e.usage.Run(context.Background())
+	}
 	return e.router.Run(":" + port)
 }
 
 // Helper methods for hooks and validation functions
-func (e *Engine) executeHooks(trigger, entityName string, data interface{}, c *gin.Context) error {
-	// TODO: Implement hook execution system
-	return nil
+
+// runHooks enqueues the entity's hooks for triggers once a write has
+// committed, before_* hooks included: hooks run as jobs, so none runs for a
+// write that fails. The schema loader rejects synchronous hooks.
+func (e *Engine) runHooks(c *gin.Context, entityName string, record map[string]interface{}, triggers ...string) {
+	ctx := c.Request.Context()
+	go func() {
+		if err := e.enqueueHooks(ctx, entityName, record, triggers...); err != nil {
+			log.Printf("Failed to enqueue hooks: %v", err)
+		}
+	}()
 }
 
 func (e *Engine) executeValidationFunctions(entityName, trigger string, data map[string]interface{}, c *gin.Context) error {
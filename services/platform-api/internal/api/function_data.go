@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/backsaas/platform/api/pkg/functions"
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// FunctionDataService is the DataService Go functions use to read and write
+// the engine's entities. It is scoped to the engine's tenant and applies the
+// schema's access rules for the principal the function runs for: records the
+// principal can't read are left out of results or reported as not found, and
+// writes its write or delete rules don't allow fail with
+// functions.ErrAccessDenied.
+type FunctionDataService struct {
+	engine    *Engine
+	principal Principal
+}
+
+var _ functions.DataService = (*FunctionDataService)(nil)
+
+// FunctionData returns a data service acting for principal
+func (e *Engine) FunctionData(principal Principal) *FunctionDataService {
+	return &FunctionDataService{engine: e, principal: principal}
+}
+
+// entity looks up an entity of the schema
+func (s *FunctionDataService) entity(ctx context.Context, entityName string) (*schema.Entity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entity, exists := s.engine.schema.Entities[entityName]
+	if !exists {
+		return nil, fmt.Errorf("unknown entity %s", entityName)
+	}
+	return entity, nil
+}
+
+// get returns a record the principal can read
+func (s *FunctionDataService) get(ctx context.Context, entityName string, entity *schema.Entity, id string) (map[string]interface{}, error) {
+	record, err := s.engine.storeFor(ctx).GetEntity(entityName, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.engine.access.canRead(entityName, s.principal, record) {
+		return nil, ErrEntityNotFound
+	}
+	return record, nil
+}
+
+// FindByID returns a record by key
+func (s *FunctionDataService) FindByID(ctx context.Context, entityName, id string) (map[string]interface{}, error) {
+	entity, err := s.entity(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, entityName, entity, id)
+}
+
+// FindMany returns the readable records matching every filter
+func (s *FunctionDataService) FindMany(ctx context.Context, entityName string, filters map[string]interface{}) ([]map[string]interface{}, error) {
+	entity, err := s.entity(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.engine.storeFor(ctx).QueryEntities(entityName, entity, filters, 0, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	readable := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		if s.engine.access.canRead(entityName, s.principal, record) {
+			readable = append(readable, record)
+		}
+	}
+	return readable, nil
+}
+
+// Count returns the number of readable records matching every filter
+func (s *FunctionDataService) Count(ctx context.Context, entityName string, filters map[string]interface{}) (int64, error) {
+	records, err := s.FindMany(ctx, entityName, filters)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
+}
+
+// Create validates and inserts a record
+func (s *FunctionDataService) Create(ctx context.Context, entityName string, data map[string]interface{}) (map[string]interface{}, error) {
+	entity, err := s.entity(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(map[string]interface{}, len(data)+1)
+	for field, value := range data {
+		record[field] = value
+	}
+	record["tenant_id"] = s.engine.tenantID
+	if !s.engine.access.canWrite(entityName, s.principal, record, writtenFields(data, "tenant_id")) {
+		return nil, fmt.Errorf("create %s: %w", entityName, functions.ErrAccessDenied)
+	}
+	if err := ValidateEntityData(entity, record); err != nil {
+		return nil, err
+	}
+
+	result, err := s.engine.storeFor(ctx).InsertEntity(entityName, entity, record)
+	if err != nil {
+		return nil, err
+	}
+	s.engine.changes.notify()
+	return result, nil
+}
+
+// Update changes the given fields of a record. Write rules are evaluated
+// against the stored record, so a function can't grant itself access by
+// changing the fields the rules look at.
+func (s *FunctionDataService) Update(ctx context.Context, entityName, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	entity, err := s.entity(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.get(ctx, entityName, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.engine.access.canWrite(entityName, s.principal, existing, writtenFields(data, "tenant_id", entity.Key)) {
+		return nil, fmt.Errorf("update %s %s: %w", entityName, id, functions.ErrAccessDenied)
+	}
+
+	update := make(map[string]interface{}, len(data)+2)
+	for field, value := range data {
+		update[field] = value
+	}
+	update["tenant_id"] = s.engine.tenantID
+	update[entity.Key] = id
+
+	merged := make(map[string]interface{}, len(existing)+len(update))
+	for field, value := range existing {
+		merged[field] = value
+	}
+	for field, value := range update {
+		merged[field] = value
+	}
+	if err := ValidateEntityData(entity, merged); err != nil {
+		return nil, err
+	}
+
+	result, err := s.engine.storeFor(ctx).UpdateEntity(entityName, entity, id, update)
+	if err != nil {
+		return nil, err
+	}
+	s.engine.changes.notify()
+	return result, nil
+}
+
+// Delete deletes a record by key
+func (s *FunctionDataService) Delete(ctx context.Context, entityName, id string) error {
+	entity, err := s.entity(ctx, entityName)
+	if err != nil {
+		return err
+	}
+	existing, err := s.get(ctx, entityName, entity, id)
+	if err != nil {
+		return err
+	}
+	if !s.engine.access.canDelete(entityName, s.principal, existing) {
+		return fmt.Errorf("delete %s %s: %w", entityName, id, functions.ErrAccessDenied)
+	}
+
+	if err := s.engine.storeFor(ctx).DeleteEntity(entityName, entity, id); err != nil {
+		return err
+	}
+	s.engine.changes.notify()
+	return nil
+}
+
+// writtenFields returns the sorted fields of data, leaving out the fields
+// the service sets itself
+func writtenFields(data map[string]interface{}, managed ...string) []string {
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		skip := false
+		for _, name := range managed {
+			if field == name {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/backsaas/platform/api/pkg/functions"
+)
+
+func TestFunctionData(t *testing.T) {
+	engine, _ := newChangesTestEngine(t)
+	ctx := context.Background()
+
+	admin := engine.FunctionData(Principal{UserID: "root", TenantID: changesTenant, Roles: []string{"admin"}})
+	for _, id := range []string{user1, user2} {
+		if _, err := admin.Create(ctx, "users", map[string]interface{}{"id": id, "email": id[len(id)-1:] + "@example.com"}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	alice := engine.FunctionData(Principal{UserID: user1, TenantID: changesTenant})
+
+	t.Run("Reads", func(t *testing.T) {
+		if count, err := admin.Count(ctx, "users", nil); err != nil || count != 2 {
+			t.Errorf("Expected the admin to see 2 users, got %d, %v", count, err)
+		}
+		users, err := alice.FindMany(ctx, "users", nil)
+		if err != nil || len(users) != 1 || users[0]["id"] != user1 {
+			t.Errorf("Expected alice to see only herself, got %v, %v", users, err)
+		}
+		if _, err := alice.FindByID(ctx, "users", user2); !errors.Is(err, ErrEntityNotFound) {
+			t.Errorf("Expected an unreadable user to be not found, got %v", err)
+		}
+		if _, err := alice.FindMany(ctx, "invoices", nil); err == nil {
+			t.Errorf("Expected an unknown entity to fail")
+		}
+	})
+
+	t.Run("Writes", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			write func() error
+			err   error
+		}{
+			{"UpdateOwnName", func() error {
+				_, err := alice.Update(ctx, "users", user1, map[string]interface{}{"name": "Alice"})
+				return err
+			}, nil},
+			{"UpdateOwnEmail", func() error {
+				_, err := alice.Update(ctx, "users", user1, map[string]interface{}{"email": "new@example.com"})
+				return err
+			}, functions.ErrAccessDenied},
+			{"UpdateOther", func() error {
+				_, err := alice.Update(ctx, "users", user2, map[string]interface{}{"name": "Bob"})
+				return err
+			}, ErrEntityNotFound},
+			{"Create", func() error {
+				_, err := alice.Create(ctx, "users", map[string]interface{}{"id": user3, "email": "c@example.com"})
+				return err
+			}, functions.ErrAccessDenied},
+			{"DeleteOwn", func() error {
+				return alice.Delete(ctx, "users", user1)
+			}, functions.ErrAccessDenied},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				if err := tc.write(); !errors.Is(err, tc.err) {
+					t.Errorf("Expected %v, got %v", tc.err, err)
+				}
+			})
+		}
+
+		user, err := admin.FindByID(ctx, "users", user1)
+		if err != nil || user["name"] != "Alice" || user["email"] != "1@example.com" {
+			t.Errorf("Expected only the name updated, got %v, %v", user, err)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		if _, err := admin.Update(ctx, "users", user1, map[string]interface{}{"status": "retired"}); err == nil {
+			t.Errorf("Expected an invalid status to be rejected")
+		}
+		if _, err := admin.Create(ctx, "users", map[string]interface{}{"id": user3}); err == nil {
+			t.Errorf("Expected a user without an email to be rejected")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := admin.Delete(ctx, "users", user2); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if count, _ := admin.Count(ctx, "users", nil); count != 1 {
+			t.Errorf("Expected 1 user left, got %d", count)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/backsaas/platform/api/pkg/functest"
+	"github.com/gin-gonic/gin"
+)
+
+// maxFunctionTestBody bounds the schema a function test request may post
+const maxFunctionTestBody = 4 << 20
+
+// RunFunctionTests handles POST /api/platform/functions/test. It runs the
+// test cases of the posted schema's platform_functions (YAML or JSON), or of
+// the engine's own schema file when the body is empty. ?function= runs one
+// platform function's cases and ?format=junit returns JUnit XML instead of
+// JSON. The response is 200 when every case passed and 422 otherwise.
+func (e *Engine) RunFunctionTests(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "junit" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or junit"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxFunctionTestBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if len(body) > maxFunctionTestBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Schema is too large"})
+		return
+	}
+
+	var testSchema *functest.Schema
+	switch {
+	case len(bytes.TrimSpace(body)) > 0:
+		testSchema, err = functest.Load(body)
+	case e.schemaPath != "":
+		testSchema, err = functest.LoadFile(e.schemaPath)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post a schema to test; this engine's schema was not loaded from a file"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema", "details": err.Error()})
+		return
+	}
+
+	report, err := functest.NewRunner().Run(c.Request.Context(), testSchema, c.Query("function"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusUnprocessableEntity
+	}
+	var buf bytes.Buffer
+	contentType := "application/json"
+	if format == "junit" {
+		contentType = "application/xml"
+		err = report.WriteJUnit(&buf)
+	} else {
+		err = report.WriteJSON(&buf)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write report"})
+		return
+	}
+	c.Data(status, contentType, buf.Bytes())
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const functionTestSchema = `
+platform_functions:
+  check_birth_date:
+    entity: people
+    type: validation
+    field: birth_date
+    function: calculate_age
+    tests:
+      - name: future date
+        record: { birth_date: "2999-01-01" }
+        expect: { error: "in the future" }
+  check_join_date:
+    entity: people
+    type: validation
+    field: joined_on
+    function: calculate_age
+    tests:
+      - name: missing date
+        record: {}
+        expect: {}
+`
+
+func TestRunFunctionTests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schemaPath := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := os.WriteFile(schemaPath, []byte(functionTestSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		schemaPath  string
+		query       string
+		body        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"PostedSchema", "", "?function=check_birth_date", functionTestSchema, http.StatusOK, "application/json", `"passed": 1`},
+		{"FailingCase", "", "", functionTestSchema, http.StatusUnprocessableEntity, "application/json", `"failed": 1`},
+		{"EngineSchema", schemaPath, "?function=check_birth_date", "", http.StatusOK, "application/json", `"total": 1`},
+		{"JUnit", schemaPath, "?format=junit", "", http.StatusUnprocessableEntity, "application/xml", `<testsuite name="check_join_date" tests="1" failures="1"`},
+		{"NoSchema", "", "", "", http.StatusBadRequest, "application/json", "Post a schema"},
+		{"InvalidSchema", "", "", "platform_functions: [", http.StatusBadRequest, "application/json", "Invalid schema"},
+		{"UnknownFunction", "", "?function=missing", functionTestSchema, http.StatusNotFound, "application/json", "not found"},
+		{"InvalidFormat", "", "?format=xml", functionTestSchema, http.StatusBadRequest, "application/json", "format"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &Engine{schemaPath: tc.schemaPath}
+			router := gin.New()
+			router.POST("/api/platform/functions/test", engine.RunFunctionTests)
+
+			req := httptest.NewRequest("POST", "/api/platform/functions/test"+tc.query, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), tc.contentType) {
+				t.Errorf("Expected %s, got %s", tc.contentType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tc.contains) {
+				t.Errorf("Expected the response to contain %q, got %s", tc.contains, w.Body.String())
+			}
+			if tc.contentType == "application/json" && !json.Valid(w.Body.Bytes()) {
+				t.Errorf("Expected valid JSON, got %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// JobQueue enqueues jobs for the platform's job workers
+type JobQueue interface {
+	Enqueue(ctx context.Context, tenantID, kind string, payload map[string]interface{}) error
+}
+
+// HTTPJobQueue enqueues jobs through the API service's job API
+type HTTPJobQueue struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPJobQueue creates a queue for the job API at url, such as
+// http://api:8080/jobs
+func NewHTTPJobQueue(url string) *HTTPJobQueue {
+	return &HTTPJobQueue{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enqueue schedules a job to run as soon as a worker is free
+func (q *HTTPJobQueue) Enqueue(ctx context.Context, tenantID, kind string, payload map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"kind": kind, "payload": payload})
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.url+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-ID", tenantID)
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("failed to enqueue %s job: %s %s", kind, resp.Status, failure.Error)
+	}
+	return nil
+}
+
+// hookJobKind is the job kind the API's workers run async hooks as
+const hookJobKind = "hook"
+
+// hooksFor returns the names of the entity's hooks for trigger, sorted so
+// they run in a stable order
+func hooksFor(s *schema.Schema, trigger, entityName string) []string {
+	var names []string
+	for name, function := range s.Functions {
+		if function.Type != "hook" || function.Entity != entityName {
+			continue
+		}
+		for _, t := range strings.Split(function.Trigger, ",") {
+			if strings.TrimSpace(t) == trigger {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasAsyncHooks reports whether the schema declares hooks for job workers
+func hasAsyncHooks(s *schema.Schema) bool {
+	for _, function := range s.Functions {
+		if function.Type == "hook" && function.Async {
+			return true
+		}
+	}
+	return false
+}
+
+// hookPayload is the job payload that runs hook for record
+func hookPayload(name string, hook *schema.Function, record map[string]interface{}) map[string]interface{} {
+	functions := make([]interface{}, len(hook.Functions))
+	for i, call := range hook.Functions {
+		functions[i] = map[string]interface{}{"function": call.Function, "config": call.Config}
+	}
+	events := make([]interface{}, len(hook.Events))
+	for i, event := range hook.Events {
+		events[i] = map[string]interface{}{"event": event.Event, "data": event.Data}
+	}
+	payload := map[string]interface{}{
+		"hook":      name,
+		"functions": functions,
+		"events":    events,
+		"record":    record,
+	}
+	if hook.Code != "" {
+		payload["code"] = hook.Code
+	}
+	return payload
+}
+
+// enqueueHooks enqueues a job for each async hook of the entity for the
+// triggers, in order. The jobs outlive the request, so they are enqueued
+// without its deadline.
+func (e *Engine) enqueueHooks(ctx context.Context, entityName string, record map[string]interface{}, triggers ...string) error {
+	if e.jobs == nil {
+		return nil
+	}
+	var errs []error
+	for _, trigger := range triggers {
+		for _, name := range hooksFor(e.schema, trigger, entityName) {
+			hook := e.schema.Functions[name]
+			if !hook.Async {
+				continue
+			}
+			err := e.jobs.Enqueue(context.WithoutCancel(ctx), e.tenantID, hookJobKind, hookPayload(name, hook, record))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+func TestAsyncHooksEnqueueJobs(t *testing.T) {
+	type request struct {
+		tenant string
+		body   map[string]interface{}
+	}
+	received := make(chan request, 10)
+	jobAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- request{tenant: r.Header.Get("X-Tenant-ID"), body: body}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer jobAPI.Close()
+
+	engine, server := newChangesTestEngine(t)
+	engine.jobs = NewHTTPJobQueue(jobAPI.URL + "/jobs")
+	engine.schema.Functions = map[string]*schema.Function{
+		"setup_new_user": {
+			Entity:    "users",
+			Type:      "hook",
+			Trigger:   "after_create",
+			Async:     true,
+			Functions: []schema.FunctionCall{{Function: "send_email", Config: map[string]interface{}{"to_field": "email"}}},
+			Events:    []schema.EventCall{{Event: "user.created", Data: map[string]interface{}{"user_id": "{{id}}"}}},
+		},
+		"prepare_user": {Entity: "users", Type: "hook", Trigger: "before_create", Async: true, Functions: []schema.FunctionCall{{Function: "audit"}}},
+		"audit_user":   {Entity: "users", Type: "hook", Trigger: "after_create", Functions: []schema.FunctionCall{{Function: "audit"}}},
+		"on_update":    {Entity: "users", Type: "hook", Trigger: "after_update", Async: true, Code: "async function f() {}"},
+	}
+
+	createUser(t, server, user1, "ada")
+
+	// before_create hooks are enqueued once the record is committed, ahead
+	// of the after_create ones
+	select {
+	case req := <-received:
+		payload, _ := req.body["payload"].(map[string]interface{})
+		record, _ := payload["record"].(map[string]interface{})
+		if payload["hook"] != "prepare_user" || record["id"] != user1 {
+			t.Errorf("Expected the before_create hook with the created record first, got %+v", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the before_create hook to be enqueued")
+	}
+	select {
+	case req := <-received:
+		if req.tenant != changesTenant || req.body["kind"] != "hook" {
+			t.Errorf("Expected a hook job for the tenant, got %+v", req)
+		}
+		payload, _ := req.body["payload"].(map[string]interface{})
+		record, _ := payload["record"].(map[string]interface{})
+		functions, _ := payload["functions"].([]interface{})
+		events, _ := payload["events"].([]interface{})
+		if payload["hook"] != "setup_new_user" || record["email"] != "ada@example.com" || len(functions) != 1 || len(events) != 1 {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the async hook to be enqueued")
+	}
+	select {
+	case req := <-received:
+		t.Errorf("Expected only the async create hooks to be enqueued, got %+v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A failed write enqueues nothing
+	body, _ := json.Marshal(map[string]interface{}{"id": user1, "email": "ada@example.com", "name": "ada"})
+	resp, err := http.Post(server.URL+"/api/users", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to post user: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		t.Fatal("Expected creating a duplicate user to fail")
+	}
+	select {
+	case req := <-received:
+		t.Errorf("Expected no hooks for a failed create, got %+v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHTTPJobQueueRejected(t *testing.T) {
+	jobAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "kind must be event, function or hook"}`))
+	}))
+	defer jobAPI.Close()
+
+	err := NewHTTPJobQueue(jobAPI.URL).Enqueue(context.Background(), "t1", hookJobKind, map[string]interface{}{})
+	if err == nil {
+		t.Fatal("Expected a rejected job to fail")
+	}
+}
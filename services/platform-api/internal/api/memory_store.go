@@ -0,0 +1,406 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// memoryTables maps entity name to records keyed by tenant and entity key
+type memoryTables map[string]map[string]map[string]interface{}
+
+// memoryBackend holds the data shared by every tenant's MemoryStore
+type memoryBackend struct {
+	mu     sync.Mutex
+	tables memoryTables
+
+	// outboxSequence numbers outbox rows across tenants, like a database
+	// sequence it is never rolled back
+	outboxSequence int64
+}
+
+// MemoryStore is an in-memory Store for fast tests. Records are kept encoded
+// the same way the SQL stores bind them and decoded on every read, so callers
+// see identical types and can never mutate stored data.
+type MemoryStore struct {
+	backend  *memoryBackend
+	tenantID string
+
+	// tables is the working copy while the store is inside a transaction
+	tables memoryTables
+
+	// events are the schema's declared events, set by EnsureTablesExist
+	events map[string]*schema.Event
+}
+
+// NewMemoryStore creates an empty in-memory store for a tenant
+func NewMemoryStore(tenantID string) *MemoryStore {
+	return &MemoryStore{
+		backend:  &memoryBackend{tables: make(memoryTables)},
+		tenantID: tenantID,
+	}
+}
+
+// ForTenant returns a store for another tenant sharing the same data
+func (m *MemoryStore) ForTenant(tenantID string) *MemoryStore {
+	return &MemoryStore{
+		backend:  m.backend,
+		tenantID: tenantID,
+		events:   m.events,
+	}
+}
+
+// lock acquires the backend lock unless the store is inside a transaction,
+// which already holds it, and returns the tables to operate on
+func (m *MemoryStore) lock() (memoryTables, func()) {
+	if m.tables != nil {
+		return m.tables, func() {}
+	}
+	m.backend.mu.Lock()
+	return m.backend.tables, m.backend.mu.Unlock
+}
+
+// recordKey scopes an entity key to the store's tenant
+func (m *MemoryStore) recordKey(id string) string {
+	return m.tenantID + "\x00" + id
+}
+
+// EnsureTablesExist creates an empty table for every entity in the schema
+// and for the event outbox
+func (m *MemoryStore) EnsureTablesExist(schemaObj *schema.Schema) error {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	for entityName := range schemaObj.Entities {
+		if _, exists := tables[entityName]; !exists {
+			tables[entityName] = make(map[string]map[string]interface{})
+		}
+	}
+	if _, exists := tables[outboxTable]; !exists {
+		tables[outboxTable] = make(map[string]map[string]interface{})
+	}
+	m.events = schemaObj.Events
+	return nil
+}
+
+// table returns the records for an entity
+func (m *MemoryStore) table(tables memoryTables, entityName string) (map[string]map[string]interface{}, error) {
+	table, exists := tables[entityName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", entityName)
+	}
+	return table, nil
+}
+
+// InsertEntity inserts a new entity
+func (m *MemoryStore) InsertEntity(entityName string, entity *schema.Entity, data map[string]interface{}) (map[string]interface{}, error) {
+	insertData, err := prepareInsertData(entity, data, m.tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only schema columns, as the SQL stores do
+	record := make(map[string]interface{})
+	for _, col := range entityColumns(entity) {
+		if value, exists := insertData[col]; exists {
+			record[col] = value
+		} else {
+			record[col] = nil
+		}
+	}
+
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprint(record[entity.Key])
+	if _, exists := table[m.recordKey(id)]; exists {
+		return nil, fmt.Errorf("failed to insert entity: duplicate key %s", id)
+	}
+
+	if err := encodeRecord(entity, record); err != nil {
+		return nil, err
+	}
+
+	// The outbox row is written under the same lock, so both land together
+	result := decodeRecord(record, entity)
+	if err := m.writeOutbox(tables, entityName, entity, ActionCreated, result); err != nil {
+		return nil, err
+	}
+	table[m.recordKey(id)] = record
+
+	return result, nil
+}
+
+// UpdateEntity updates an existing entity
+func (m *MemoryStore) UpdateEntity(entityName string, entity *schema.Entity, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	updateData, err := prepareUpdateData(entity, data)
+	if err != nil {
+		return nil, err
+	}
+
+	qb := newQueryBuilder(postgresDialect, entityName, entity, entityColumns(entity))
+	for key := range updateData {
+		if _, err := qb.column(key); err != nil {
+			return nil, err
+		}
+	}
+
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, exists := table[m.recordKey(id)]
+	if !exists {
+		return nil, ErrEntityNotFound
+	}
+
+	if err := computeStoredUpdate(entity, decodeRecord(existing, entity), updateData); err != nil {
+		return nil, err
+	}
+	if err := encodeRecord(entity, updateData); err != nil {
+		return nil, err
+	}
+
+	// Records are never mutated in place so transaction snapshots stay valid
+	record := make(map[string]interface{}, len(existing))
+	for k, v := range existing {
+		record[k] = v
+	}
+	for k, v := range updateData {
+		record[k] = v
+	}
+
+	result := decodeRecord(record, entity)
+	if err := m.writeOutbox(tables, entityName, entity, ActionUpdated, result); err != nil {
+		return nil, err
+	}
+	table[m.recordKey(id)] = record
+
+	return result, nil
+}
+
+// QueryEntities retrieves entities with optional filtering, pagination, and sorting
+func (m *MemoryStore) QueryEntities(entityName string, entity *schema.Entity, filters map[string]interface{}, limit, offset int, orderBy string) ([]map[string]interface{}, error) {
+	qb := newQueryBuilder(postgresDialect, entityName, entity, entityColumns(entity))
+
+	for key := range filters {
+		if _, err := qb.column(key); err != nil {
+			return nil, err
+		}
+	}
+
+	var terms []orderTerm
+	if orderBy != "" {
+		parsed, err := qb.parseOrderBy(orderBy)
+		if err != nil {
+			return nil, err
+		}
+		terms = parsed
+	} else if qb.allowed["created_at"] {
+		terms = []orderTerm{{column: "created_at", desc: true}}
+	}
+
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []map[string]interface{}
+	for _, record := range table {
+		if record["tenant_id"] != m.tenantID || !matchesFilters(decodeRecord(record, entity), filters) {
+			continue
+		}
+		matches = append(matches, record)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, term := range terms {
+			cmp := compareValues(matches[i][term.column], matches[j][term.column])
+			if cmp == 0 {
+				continue
+			}
+			if term.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return fmt.Sprint(matches[i][entity.Key]) < fmt.Sprint(matches[j][entity.Key])
+	})
+
+	if offset > 0 {
+		if offset >= len(matches) {
+			matches = nil
+		} else {
+			matches = matches[offset:]
+		}
+	}
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	var results []map[string]interface{}
+	for _, record := range matches {
+		results = append(results, decodeRecord(record, entity))
+	}
+
+	return results, nil
+}
+
+// GetEntity retrieves a single entity by ID
+func (m *MemoryStore) GetEntity(entityName string, entity *schema.Entity, id string) (map[string]interface{}, error) {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	record, exists := table[m.recordKey(id)]
+	if !exists {
+		return nil, ErrEntityNotFound
+	}
+
+	return decodeRecord(record, entity), nil
+}
+
+// DeleteEntity deletes an entity by ID
+func (m *MemoryStore) DeleteEntity(entityName string, entity *schema.Entity, id string) error {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, entityName)
+	if err != nil {
+		return err
+	}
+
+	existing, exists := table[m.recordKey(id)]
+	if !exists {
+		return ErrEntityNotFound
+	}
+	if err := m.writeOutbox(tables, entityName, entity, ActionDeleted, decodeRecord(existing, entity)); err != nil {
+		return err
+	}
+	delete(table, m.recordKey(id))
+
+	return nil
+}
+
+// WithTransaction runs fn against a snapshot of the data and publishes the
+// snapshot only if fn succeeds. Transactions are serialized.
+func (m *MemoryStore) WithTransaction(fn func(tx Store) error) error {
+	if m.tables != nil {
+		return fn(m)
+	}
+
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+
+	snapshot := make(memoryTables, len(m.backend.tables))
+	for entityName, table := range m.backend.tables {
+		copied := make(map[string]map[string]interface{}, len(table))
+		for key, record := range table {
+			copied[key] = record
+		}
+		snapshot[entityName] = copied
+	}
+
+	txStore := &MemoryStore{
+		backend:  m.backend,
+		tenantID: m.tenantID,
+		tables:   snapshot,
+		events:   m.events,
+	}
+
+	if err := fn(txStore); err != nil {
+		return err
+	}
+
+	m.backend.tables = snapshot
+	return nil
+}
+
+// decodeRecord converts a stored record to its API representation. JSON
+// columns are stored serialized, so decoding also yields a deep copy.
+func decodeRecord(record map[string]interface{}, entity *schema.Entity) map[string]interface{} {
+	result := make(map[string]interface{}, len(record))
+	for col, val := range record {
+		result[col] = decodeColumnValue(col, val, entity)
+	}
+	computeVirtualFields(entity, result)
+	return result
+}
+
+// matchesFilters reports whether a record equals every filter value. Values
+// are compared by their string form because list filters arrive as query
+// strings, matching how the SQL stores coerce them.
+func matchesFilters(record map[string]interface{}, filters map[string]interface{}) bool {
+	for key, value := range filters {
+		if fmt.Sprint(record[key]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues orders two column values, sorting nulls first
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if af, ok := toFloat64(a); ok {
+		if bf, ok := toFloat64(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			return at.Compare(bt)
+		}
+	}
+
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0
+			case !ab:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,452 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// outboxTable records every change to an entity. Changes that emit a declared
+// event wait there until the relay publishes them; all changes feed the
+// change streams. The loader reserves names starting with "_", so it never
+// clashes with an entity.
+const outboxTable = "_outbox"
+
+// Change actions recorded in the outbox
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// OutboxEvent is a change recorded in the same transaction as the change
+// itself
+type OutboxEvent struct {
+	// Sequence orders events; events for one aggregate are published in
+	// sequence order, and change streams resume from a sequence
+	Sequence int64
+
+	// ID identifies the event and is its idempotency key: an event that is
+	// published more than once always carries the same ID
+	ID string
+
+	TenantID      string
+	Event         string                 // e.g. "user.created"; empty when the schema declares none
+	Action        string                 // ActionCreated, ActionUpdated or ActionDeleted
+	AggregateType string                 // entity name
+	AggregateID   string                 // entity key
+	Data          map[string]interface{} // the declared event fields
+	Record        map[string]interface{} // the whole record; as it was before deletion for deletes
+	Attempts      int                    // failed publish attempts so far
+	CreatedAt     time.Time
+}
+
+// AggregateKey identifies the record an event belongs to
+func (e *OutboxEvent) AggregateKey() string {
+	return e.AggregateType + "/" + e.AggregateID
+}
+
+// OutboxStore reads and settles the events recorded for a tenant
+type OutboxStore interface {
+	// PendingOutboxEvents returns up to limit unpublished events in
+	// sequence order
+	PendingOutboxEvents(limit int) ([]*OutboxEvent, error)
+
+	// MarkOutboxEventPublished records that an event was published
+	MarkOutboxEventPublished(id string) error
+
+	// MarkOutboxEventFailed records a failed publish attempt
+	MarkOutboxEventFailed(id string, cause error) error
+
+	// OutboxEventsAfter returns up to limit changes to an entity recorded
+	// after the given sequence, in sequence order, whether or not they emit
+	// an event
+	OutboxEventsAfter(aggregateType string, after int64, limit int) ([]*OutboxEvent, error)
+
+	// LastOutboxSequence returns the sequence of the tenant's latest change,
+	// or 0 when nothing has been recorded
+	LastOutboxSequence() (int64, error)
+}
+
+// changeEventName returns the event declared in the schema for a change to
+// an entity, or "" when none is declared. Events are named after the
+// singular entity name ("users" emits "user.created"), or after the entity
+// name itself.
+func changeEventName(events map[string]*schema.Event, entityName, action string) string {
+	for _, name := range []string{singularize(entityName), entityName} {
+		if _, declared := events[name+"."+action]; declared {
+			return name + "." + action
+		}
+	}
+	return ""
+}
+
+// singularize turns a plural entity name into its singular form
+func singularize(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// newOutboxEvent builds the outbox entry for a change to a record. When the
+// schema declares an event for the change, the event data carries exactly the
+// fields the schema declares, so consumers can validate it.
+func newOutboxEvent(events map[string]*schema.Event, tenantID, entityName string, entity *schema.Entity, action string, record map[string]interface{}) *OutboxEvent {
+	name := changeEventName(events, entityName, action)
+	data := make(map[string]interface{})
+	if name != "" {
+		for _, field := range events[name].Fields {
+			data[field] = record[field]
+		}
+	}
+
+	return &OutboxEvent{
+		ID:            generateID(),
+		TenantID:      tenantID,
+		Event:         name,
+		Action:        action,
+		AggregateType: entityName,
+		AggregateID:   fmt.Sprint(record[entity.Key]),
+		Data:          data,
+		Record:        record,
+		CreatedAt:     time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+// publishedAt returns when an event counts as published at the time it is
+// recorded: changes without a declared event have nothing to publish
+func (e *OutboxEvent) publishedAt() interface{} {
+	if e.Event == "" {
+		return e.CreatedAt
+	}
+	return nil
+}
+
+// createOutboxTable creates the outbox table and its indexes
+func (d *DatabaseOperations) createOutboxTable() error {
+	sqlDialect := d.sqlDialect()
+	statements := []string{
+		fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			"sequence" %s,
+			"id" VARCHAR(64) NOT NULL UNIQUE,
+			"tenant_id" VARCHAR(255) NOT NULL,
+			"event" VARCHAR(255) NOT NULL,
+			"action" VARCHAR(16) NOT NULL,
+			"aggregate_type" VARCHAR(255) NOT NULL,
+			"aggregate_id" VARCHAR(255) NOT NULL,
+			"payload" %s NOT NULL,
+			"record" %s NOT NULL,
+			"attempts" INTEGER NOT NULL DEFAULT 0,
+			"last_error" TEXT,
+			"created_at" %s NOT NULL,
+			"published_at" %s
+		)`, quoteIdentifier(outboxTable), sqlDialect.serialKey, sqlDialect.jsonType, sqlDialect.jsonType, sqlDialect.timestampType, sqlDialect.timestampType),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s ("tenant_id", "published_at", "sequence")`,
+			quoteIdentifier(outboxTable+"_pending"), quoteIdentifier(outboxTable)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s ("tenant_id", "aggregate_type", "sequence")`,
+			quoteIdentifier(outboxTable+"_changes"), quoteIdentifier(outboxTable)),
+	}
+
+	for _, statement := range statements {
+		if _, err := d.conn().Exec(statement); err != nil {
+			return fmt.Errorf("failed to create outbox table: %w", err)
+		}
+	}
+	return nil
+}
+
+// withOutbox runs fn in a transaction, so a change and its outbox row are
+// committed together
+func (d *DatabaseOperations) withOutbox(fn func(d *DatabaseOperations) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+	return d.WithTransaction(func(tx Store) error {
+		return fn(tx.(*DatabaseOperations))
+	})
+}
+
+// writeOutbox records a change in the outbox
+func (d *DatabaseOperations) writeOutbox(entityName string, entity *schema.Entity, action string, record map[string]interface{}) error {
+	event := newOutboxEvent(d.events, d.tenantID, entityName, entity, action, record)
+	payload, recordJSON, err := encodeOutboxEvent(event)
+	if err != nil {
+		return err
+	}
+
+	// Change streams advance past every sequence they read, so a sequence
+	// committed after a later one would be skipped. Holding a lock on the
+	// tenant's outbox until the transaction ends makes its changes commit in
+	// sequence order. SQLite already allows a single writer.
+	if d.sqlDialect() == postgresDialect {
+		if _, err := d.conn().Exec(`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, outboxTable+":"+d.tenantID); err != nil {
+			return fmt.Errorf("failed to lock outbox: %w", err)
+		}
+	}
+
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`INSERT INTO %s ("id", "tenant_id", "event", "action", "aggregate_type", "aggregate_id", "payload", "record", "created_at", "published_at") VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s)`,
+		quoteIdentifier(outboxTable), p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8), p(9), p(10))
+	_, err = d.conn().Exec(query, event.ID, event.TenantID, event.Event, event.Action, event.AggregateType, event.AggregateID,
+		string(payload), string(recordJSON), event.CreatedAt, event.publishedAt())
+	if err != nil {
+		return fmt.Errorf("failed to record %s %s change: %w", entityName, action, err)
+	}
+	return nil
+}
+
+// encodeOutboxEvent encodes an event's data and record for storage
+func encodeOutboxEvent(event *OutboxEvent) (payload, record []byte, err error) {
+	if payload, err = json.Marshal(event.Data); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s event: %w", event.Event, err)
+	}
+	if record, err = json.Marshal(event.Record); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s record: %w", event.AggregateType, err)
+	}
+	return payload, record, nil
+}
+
+// outboxColumns are the columns scanOutboxEvents reads, in order
+const outboxColumns = `"sequence", "id", "tenant_id", "event", "action", "aggregate_type", "aggregate_id", "payload", "record", "attempts", "created_at"`
+
+// PendingOutboxEvents returns the tenant's unpublished events in sequence order
+func (d *DatabaseOperations) PendingOutboxEvents(limit int) ([]*OutboxEvent, error) {
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE "tenant_id" = %s AND "published_at" IS NULL ORDER BY "sequence" LIMIT %s`,
+		outboxColumns, quoteIdentifier(outboxTable), p(1), p(2))
+	return d.queryOutbox(query, d.tenantID, limit)
+}
+
+// OutboxEventsAfter returns the tenant's changes to an entity recorded after
+// the given sequence
+func (d *DatabaseOperations) OutboxEventsAfter(aggregateType string, after int64, limit int) ([]*OutboxEvent, error) {
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE "tenant_id" = %s AND "aggregate_type" = %s AND "sequence" > %s ORDER BY "sequence" LIMIT %s`,
+		outboxColumns, quoteIdentifier(outboxTable), p(1), p(2), p(3), p(4))
+	return d.queryOutbox(query, d.tenantID, aggregateType, after, limit)
+}
+
+// LastOutboxSequence returns the sequence of the tenant's latest change
+func (d *DatabaseOperations) LastOutboxSequence() (int64, error) {
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`SELECT COALESCE(MAX("sequence"), 0) FROM %s WHERE "tenant_id" = %s`, quoteIdentifier(outboxTable), p(1))
+	var sequence int64
+	if err := d.conn().QueryRow(query, d.tenantID).Scan(&sequence); err != nil {
+		return 0, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	return sequence, nil
+}
+
+// queryOutbox runs a query selecting outboxColumns
+func (d *DatabaseOperations) queryOutbox(query string, args ...interface{}) ([]*OutboxEvent, error) {
+	rows, err := d.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		var payload, record []byte
+		err := rows.Scan(&event.Sequence, &event.ID, &event.TenantID, &event.Event, &event.Action,
+			&event.AggregateType, &event.AggregateID, &payload, &record, &event.Attempts, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read outbox event: %w", err)
+		}
+		if err := decodeOutboxEvent(&event, payload, record); err != nil {
+			return nil, err
+		}
+		event.CreatedAt = event.CreatedAt.UTC()
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+// decodeOutboxEvent decodes stored event data and record into an event
+func decodeOutboxEvent(event *OutboxEvent, payload, record []byte) error {
+	if err := json.Unmarshal(payload, &event.Data); err != nil {
+		return fmt.Errorf("failed to decode outbox event %s: %w", event.ID, err)
+	}
+	if err := json.Unmarshal(record, &event.Record); err != nil {
+		return fmt.Errorf("failed to decode outbox event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+// MarkOutboxEventPublished records that an event was published
+func (d *DatabaseOperations) MarkOutboxEventPublished(id string) error {
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`UPDATE %s SET "published_at" = %s WHERE "id" = %s AND "tenant_id" = %s`,
+		quoteIdentifier(outboxTable), p(1), p(2), p(3))
+	if _, err := d.conn().Exec(query, time.Now().UTC(), id, d.tenantID); err != nil {
+		return fmt.Errorf("failed to mark outbox event %s published: %w", id, err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt
+func (d *DatabaseOperations) MarkOutboxEventFailed(id string, cause error) error {
+	p := d.sqlDialect().placeholder
+	query := fmt.Sprintf(`UPDATE %s SET "attempts" = "attempts" + 1, "last_error" = %s WHERE "id" = %s AND "tenant_id" = %s`,
+		quoteIdentifier(outboxTable), p(1), p(2), p(3))
+	if _, err := d.conn().Exec(query, cause.Error(), id, d.tenantID); err != nil {
+		return fmt.Errorf("failed to record outbox event %s failure: %w", id, err)
+	}
+	return nil
+}
+
+// writeOutbox records a change in the outbox of the tables the change was
+// made in
+func (m *MemoryStore) writeOutbox(tables memoryTables, entityName string, entity *schema.Entity, action string, record map[string]interface{}) error {
+	event := newOutboxEvent(m.events, m.tenantID, entityName, entity, action, record)
+	payload, recordJSON, err := encodeOutboxEvent(event)
+	if err != nil {
+		return err
+	}
+
+	m.backend.outboxSequence++
+	tables[outboxTable][event.ID] = map[string]interface{}{
+		"sequence":       m.backend.outboxSequence,
+		"id":             event.ID,
+		"tenant_id":      event.TenantID,
+		"event":          event.Event,
+		"action":         event.Action,
+		"aggregate_type": event.AggregateType,
+		"aggregate_id":   event.AggregateID,
+		"payload":        payload,
+		"record":         recordJSON,
+		"attempts":       0,
+		"last_error":     nil,
+		"created_at":     event.CreatedAt,
+		"published_at":   event.publishedAt(),
+	}
+	return nil
+}
+
+// PendingOutboxEvents returns the tenant's unpublished events in sequence order
+func (m *MemoryStore) PendingOutboxEvents(limit int) ([]*OutboxEvent, error) {
+	return m.selectOutbox(limit, func(row map[string]interface{}) bool {
+		return row["published_at"] == nil
+	})
+}
+
+// OutboxEventsAfter returns the tenant's changes to an entity recorded after
+// the given sequence
+func (m *MemoryStore) OutboxEventsAfter(aggregateType string, after int64, limit int) ([]*OutboxEvent, error) {
+	return m.selectOutbox(limit, func(row map[string]interface{}) bool {
+		return row["aggregate_type"] == aggregateType && row["sequence"].(int64) > after
+	})
+}
+
+// LastOutboxSequence returns the sequence of the tenant's latest change
+func (m *MemoryStore) LastOutboxSequence() (int64, error) {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, outboxTable)
+	if err != nil {
+		return 0, err
+	}
+
+	var last int64
+	for _, row := range table {
+		if row["tenant_id"] == m.tenantID && row["sequence"].(int64) > last {
+			last = row["sequence"].(int64)
+		}
+	}
+	return last, nil
+}
+
+// selectOutbox returns up to limit of the tenant's outbox rows matching a
+// predicate, in sequence order
+func (m *MemoryStore) selectOutbox(limit int, match func(row map[string]interface{}) bool) ([]*OutboxEvent, error) {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, outboxTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*OutboxEvent
+	for _, row := range table {
+		if row["tenant_id"] != m.tenantID || !match(row) {
+			continue
+		}
+		event := &OutboxEvent{
+			Sequence:      row["sequence"].(int64),
+			ID:            row["id"].(string),
+			TenantID:      row["tenant_id"].(string),
+			Event:         row["event"].(string),
+			Action:        row["action"].(string),
+			AggregateType: row["aggregate_type"].(string),
+			AggregateID:   row["aggregate_id"].(string),
+			Attempts:      row["attempts"].(int),
+			CreatedAt:     row["created_at"].(time.Time),
+		}
+		if err := decodeOutboxEvent(event, row["payload"].([]byte), row["record"].([]byte)); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Sequence < events[j].Sequence })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// MarkOutboxEventPublished records that an event was published
+func (m *MemoryStore) MarkOutboxEventPublished(id string) error {
+	return m.updateOutboxRow(id, func(row map[string]interface{}) {
+		row["published_at"] = time.Now().UTC()
+	})
+}
+
+// MarkOutboxEventFailed records a failed publish attempt
+func (m *MemoryStore) MarkOutboxEventFailed(id string, cause error) error {
+	return m.updateOutboxRow(id, func(row map[string]interface{}) {
+		row["attempts"] = row["attempts"].(int) + 1
+		row["last_error"] = cause.Error()
+	})
+}
+
+// updateOutboxRow replaces one of the tenant's outbox rows with an updated copy
+func (m *MemoryStore) updateOutboxRow(id string, update func(row map[string]interface{})) error {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	table, err := m.table(tables, outboxTable)
+	if err != nil {
+		return err
+	}
+
+	existing, exists := table[id]
+	if !exists || existing["tenant_id"] != m.tenantID {
+		return fmt.Errorf("outbox event %s not found", id)
+	}
+
+	// Rows are never mutated in place so transaction snapshots stay valid
+	row := make(map[string]interface{}, len(existing))
+	for k, v := range existing {
+		row[k] = v
+	}
+	update(row)
+	table[id] = row
+	return nil
+}
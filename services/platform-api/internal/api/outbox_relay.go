@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Publisher delivers outbox events to the event bus
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, event *OutboxEvent) error
+
+// Publish calls f(ctx, event)
+func (f PublisherFunc) Publish(ctx context.Context, event *OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// RelayConfig configures an OutboxRelay
+type RelayConfig struct {
+	// BatchSize is how many pending events are read per pass; defaults to 100
+	BatchSize int
+
+	// PollInterval is how long the relay waits between passes that found
+	// nothing more to publish; defaults to 1s
+	PollInterval time.Duration
+}
+
+// OutboxRelay publishes the events recorded in a store's outbox. Delivery is
+// at least once: an event is marked published only after the publisher
+// accepts it, so a crash in between publishes it again under the same ID.
+// Events for one aggregate are published in the order they were recorded;
+// when one fails, later events for that aggregate wait for the next pass.
+// Run a single relay per tenant database to keep that ordering.
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher Publisher
+	config    RelayConfig
+}
+
+// NewOutboxRelay creates a relay from a store's outbox to a publisher
+func NewOutboxRelay(store OutboxStore, publisher Publisher, config RelayConfig) *OutboxRelay {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		config:    config,
+	}
+}
+
+// Run relays events until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		// Keep draining while full batches are being published
+		if err == nil && published == r.config.BatchSize {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(r.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending events and returns how many were
+// published
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	events, err := r.store.PendingOutboxEvents(r.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	blocked := make(map[string]bool)
+	for _, event := range events {
+		if blocked[event.AggregateKey()] {
+			continue
+		}
+
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			// Hold back the aggregate's later events to keep their order
+			blocked[event.AggregateKey()] = true
+			log.Printf("Failed to publish %s event %s (attempt %d): %v", event.Event, event.ID, event.Attempts+1, err)
+			if err := r.store.MarkOutboxEventFailed(event.ID, err); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := r.store.MarkOutboxEventPublished(event.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+// DefaultEventStream is the Redis stream platform events are published to
+const DefaultEventStream = "backsaas:events"
+
+// RedisPublisher appends outbox events to a Redis stream in the format the
+// services' event bus consumes
+type RedisPublisher struct {
+	client *redis.Client
+	stream string
+}
+
+// NewRedisPublisher creates a publisher for a Redis URL. An empty stream
+// selects DefaultEventStream.
+func NewRedisPublisher(redisURL, stream string) (*RedisPublisher, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	if stream == "" {
+		stream = DefaultEventStream
+	}
+	return &RedisPublisher{
+		client: redis.NewClient(opts),
+		stream: stream,
+	}, nil
+}
+
+// Publish appends an event to the stream. The outbox event ID is sent as the
+// event ID so consumers can discard duplicates.
+func (p *RedisPublisher) Publish(ctx context.Context, event *OutboxEvent) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":        event.ID,
+		"name":      event.Event,
+		"tenant_id": event.TenantID,
+		"data":      event.Data,
+		"timestamp": event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		Values: map[string]interface{}{"event": payload},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection
+func (p *RedisPublisher) Close() error {
+	return p.client.Close()
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+func outboxTestSchema() *schema.Schema {
+	testSchema := storeTestSchema()
+	testSchema.Events = map[string]*schema.Event{
+		"store_item.created":  {Fields: []string{"item_id", "name"}},
+		"store_items.updated": {Fields: []string{"item_id", "quantity"}},
+		"store_item.deleted":  {Fields: []string{"item_id", "name"}},
+	}
+	return testSchema
+}
+
+func TestChangeEventName(t *testing.T) {
+	events := map[string]*schema.Event{
+		"user.created":              {},
+		"policy.updated":            {},
+		"address.deleted":           {},
+		"store_items.updated":       {},
+		"tenant_membership.created": {},
+	}
+
+	testCases := []struct {
+		entity   string
+		action   string
+		expected string
+	}{
+		{"users", ActionCreated, "user.created"},
+		{"users", ActionDeleted, ""},
+		{"policies", ActionUpdated, "policy.updated"},
+		{"addresses", ActionDeleted, "address.deleted"},
+		{"store_items", ActionUpdated, "store_items.updated"},
+		{"tenant_memberships", ActionCreated, "tenant_membership.created"},
+	}
+
+	for _, tc := range testCases {
+		if name := changeEventName(events, tc.entity, tc.action); name != tc.expected {
+			t.Errorf("Expected %s %s to emit %q, got %q", tc.entity, tc.action, tc.expected, name)
+		}
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	testSchema := outboxTestSchema()
+	entity := testSchema.Entities["store_items"]
+
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store, _ := factory(t)
+			if err := store.EnsureTablesExist(testSchema); err != nil {
+				t.Fatalf("Failed to create tables: %v", err)
+			}
+
+			t.Run("RecordsChangesInOrder", func(t *testing.T) {
+				if _, err := store.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "a", "name": "A", "quantity": 1}); err != nil {
+					t.Fatalf("Failed to insert entity: %v", err)
+				}
+				if _, err := store.UpdateEntity("store_items", entity, "a", map[string]interface{}{"quantity": 2}); err != nil {
+					t.Fatalf("Failed to update entity: %v", err)
+				}
+				if err := store.DeleteEntity("store_items", entity, "a"); err != nil {
+					t.Fatalf("Failed to delete entity: %v", err)
+				}
+
+				events, err := store.PendingOutboxEvents(10)
+				if err != nil {
+					t.Fatalf("Failed to read outbox: %v", err)
+				}
+				if len(events) != 3 {
+					t.Fatalf("Expected 3 events, got %d", len(events))
+				}
+
+				expected := []struct {
+					name string
+					data map[string]interface{}
+				}{
+					{"store_item.created", map[string]interface{}{"item_id": "a", "name": "A"}},
+					{"store_items.updated", map[string]interface{}{"item_id": "a", "quantity": 2.0}},
+					{"store_item.deleted", map[string]interface{}{"item_id": "a", "name": "A"}},
+				}
+				for i, event := range events {
+					if event.Event != expected[i].name || !reflect.DeepEqual(event.Data, expected[i].data) {
+						t.Errorf("Event %d: expected %s %v, got %s %v", i, expected[i].name, expected[i].data, event.Event, event.Data)
+					}
+					if event.TenantID != "tenant-a" || event.AggregateKey() != "store_items/a" || event.ID == "" {
+						t.Errorf("Event %d: unexpected envelope %+v", i, event)
+					}
+					if i > 0 && event.Sequence <= events[i-1].Sequence {
+						t.Errorf("Event %d: sequence %d not after %d", i, event.Sequence, events[i-1].Sequence)
+					}
+				}
+
+				for _, event := range events {
+					if err := store.MarkOutboxEventPublished(event.ID); err != nil {
+						t.Fatalf("Failed to mark event published: %v", err)
+					}
+				}
+			})
+
+			t.Run("RolledBackChangesRecordNothing", func(t *testing.T) {
+				rollback := errors.New("rollback")
+				err := store.WithTransaction(func(tx Store) error {
+					if _, err := tx.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "b", "name": "B"}); err != nil {
+						return err
+					}
+					return rollback
+				})
+				if !errors.Is(err, rollback) {
+					t.Fatalf("Expected rollback error, got %v", err)
+				}
+
+				events, err := store.PendingOutboxEvents(10)
+				if err != nil {
+					t.Fatalf("Failed to read outbox: %v", err)
+				}
+				if len(events) != 0 {
+					t.Errorf("Expected no events after rollback, got %d", len(events))
+				}
+			})
+
+			t.Run("CommitsInSequenceOrder", func(t *testing.T) {
+				after, err := store.LastOutboxSequence()
+				if err != nil {
+					t.Fatalf("Failed to read last sequence: %v", err)
+				}
+
+				locked := make(chan struct{})
+				release := make(chan struct{})
+				first := make(chan error, 1)
+				go func() {
+					first <- store.WithTransaction(func(tx Store) error {
+						if _, err := tx.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "c", "name": "C"}); err != nil {
+							return err
+						}
+						close(locked)
+						<-release
+						return nil
+					})
+				}()
+				<-locked
+
+				second := make(chan error, 1)
+				go func() {
+					_, err := store.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "d", "name": "D"})
+					second <- err
+				}()
+
+				select {
+				case err := <-second:
+					close(release)
+					<-first
+					t.Fatalf("Later change committed before an earlier one: %v", err)
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(release)
+				if err := <-first; err != nil {
+					t.Fatalf("Failed to commit first change: %v", err)
+				}
+				if err := <-second; err != nil {
+					t.Fatalf("Failed to commit second change: %v", err)
+				}
+
+				events, err := store.OutboxEventsAfter("store_items", after, 10)
+				if err != nil {
+					t.Fatalf("Failed to read outbox: %v", err)
+				}
+				if len(events) != 2 || events[0].Data["item_id"] != "c" || events[1].Data["item_id"] != "d" {
+					t.Fatalf("Expected c then d, got %+v", events)
+				}
+			})
+		})
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	testSchema := outboxTestSchema()
+	entity := testSchema.Entities["store_items"]
+	store := NewMemoryStore("tenant-a")
+	if err := store.EnsureTablesExist(testSchema); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	store.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "a", "name": "A"})
+	store.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "b", "name": "B"})
+	store.UpdateEntity("store_items", entity, "a", map[string]interface{}{"quantity": 5})
+
+	var published []*OutboxEvent
+	failures := map[string]int{"a": 1}
+	publisher := PublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+		if failures[event.AggregateID] > 0 {
+			failures[event.AggregateID]--
+			return errors.New("bus unavailable")
+		}
+		published = append(published, event)
+		return nil
+	})
+	relay := NewOutboxRelay(store, publisher, RelayConfig{})
+
+	// a's first event fails, so its update is held back while b proceeds
+	count, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Relay failed: %v", err)
+	}
+	if count != 1 || len(published) != 1 || published[0].AggregateID != "b" {
+		t.Fatalf("Expected only b to be published, got %d events", count)
+	}
+
+	pending, _ := store.PendingOutboxEvents(10)
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[1].Attempts != 0 {
+		t.Fatalf("Expected a's events pending with one failed attempt, got %+v", pending)
+	}
+	firstID := pending[0].ID
+
+	// The retry publishes a's events in order under their original IDs
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("Relay failed: %v", err)
+	}
+	if len(published) != 3 {
+		t.Fatalf("Expected 3 published events, got %d", len(published))
+	}
+	if published[1].ID != firstID || published[1].Event != "store_item.created" || published[2].Event != "store_items.updated" {
+		t.Errorf("Expected a's created then updated events, got %s then %s", published[1].Event, published[2].Event)
+	}
+
+	if pending, _ := store.PendingOutboxEvents(10); len(pending) != 0 {
+		t.Errorf("Expected outbox to be drained, got %d pending", len(pending))
+	}
+}
@@ -0,0 +1,392 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// ErrInvalidIdentifier is returned when a query references a column that is
+// not part of the entity schema
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// identifierPattern matches the identifiers we are willing to put into SQL
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// quoteIdentifier quotes a SQL identifier, doubling any embedded quotes
+func quoteIdentifier(name string) string {
+	if end := strings.IndexRune(name, 0); end > -1 {
+		name = name[:end]
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes a SQL string literal. Backslashes switch the literal to
+// the escape string syntax so the result is safe regardless of the server's
+// standard_conforming_strings setting. SQL strings can't hold NUL bytes, so
+// values containing one are rejected.
+func quoteLiteral(value string) (string, error) {
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf("%q contains a NUL byte", value)
+	}
+	value = strings.ReplaceAll(value, `'`, `''`)
+	if strings.Contains(value, `\`) {
+		return `E'` + strings.ReplaceAll(value, `\`, `\\`) + `'`, nil
+	}
+	return `'` + value + `'`, nil
+}
+
+// defaultLiteral renders a property default as a SQL literal. DDL statements
+// cannot take bind parameters, so the value is type-checked against the
+// property definition and escaped instead of being formatted blindly.
+func defaultLiteral(propDef *schema.PropertyDefinition) (string, error) {
+	value := propDef.Default
+
+	switch propDef.Type {
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("default %v is not a boolean", value)
+		}
+		if b {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+
+	case "integer":
+		n, ok := toInt64(value)
+		if !ok {
+			return "", fmt.Errorf("default %v is not a 64-bit integer", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+
+	case "number":
+		f, ok := toFloat64(value)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("default %v is not a number", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case "array", "object":
+		jsonBytes, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("default %v is not valid JSON: %w", value, err)
+		}
+		return quoteLiteral(string(jsonBytes))
+
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("default %v is not a string", value)
+		}
+		return quoteLiteral(s)
+	}
+}
+
+// toInt64 converts the numeric types produced by YAML and JSON decoding to
+// an int64, failing for fractions and values out of range
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	f, ok := toFloat64(value)
+	// float64(math.MaxInt64) rounds up to 2^63, which int64 can't hold
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toFloat64 converts the numeric types produced by YAML and JSON decoding
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// queryBuilder builds SQL statements for a single entity. Every identifier it
+// emits must exist in the entity schema and is quoted, and every value is
+// passed as a bind parameter.
+type queryBuilder struct {
+	dialect *dialect
+	table   string
+	key     string
+	columns []string
+	allowed map[string]bool
+}
+
+// orderTerm is a single validated ORDER BY column
+type orderTerm struct {
+	column string
+	desc   bool
+}
+
+// newQueryBuilder creates a query builder for an entity
+func newQueryBuilder(d *dialect, entityName string, entity *schema.Entity, columns []string) *queryBuilder {
+	allowed := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		allowed[col] = true
+	}
+
+	return &queryBuilder{
+		dialect: d,
+		table:   quoteIdentifier(entityName),
+		key:     entity.Key,
+		columns: columns,
+		allowed: allowed,
+	}
+}
+
+// param returns the bind parameter placeholder for the nth argument
+func (qb *queryBuilder) param(n int) string {
+	return qb.dialect.placeholder(n)
+}
+
+// column validates a column name against the entity schema and quotes it
+func (qb *queryBuilder) column(name string) (string, error) {
+	if !qb.allowed[name] || !identifierPattern.MatchString(name) {
+		return "", fmt.Errorf("%w: unknown field %q", ErrInvalidIdentifier, name)
+	}
+	return quoteIdentifier(name), nil
+}
+
+// columnList returns the quoted list of all entity columns
+func (qb *queryBuilder) columnList() string {
+	quoted := make([]string, len(qb.columns))
+	for i, col := range qb.columns {
+		quoted[i] = quoteIdentifier(col)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// parseOrderBy parses an order specification such as "name ASC, created_at DESC"
+func (qb *queryBuilder) parseOrderBy(spec string) ([]orderTerm, error) {
+	var terms []orderTerm
+
+	for _, term := range strings.Split(spec, ",") {
+		fields := strings.Fields(term)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%w: invalid order_by %q", ErrInvalidIdentifier, spec)
+		}
+
+		if _, err := qb.column(fields[0]); err != nil {
+			return nil, err
+		}
+
+		desc := false
+		if len(fields) == 2 {
+			switch strings.ToUpper(fields[1]) {
+			case "ASC":
+			case "DESC":
+				desc = true
+			default:
+				return nil, fmt.Errorf("%w: invalid sort direction %q", ErrInvalidIdentifier, fields[1])
+			}
+		}
+
+		terms = append(terms, orderTerm{column: fields[0], desc: desc})
+	}
+
+	return terms, nil
+}
+
+// orderBy renders a validated order specification as SQL
+func (qb *queryBuilder) orderBy(spec string) (string, error) {
+	terms, err := qb.parseOrderBy(spec)
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		direction := "ASC"
+		if term.desc {
+			direction = "DESC"
+		}
+		parts[i] = quoteIdentifier(term.column) + " " + direction
+	}
+
+	return strings.Join(parts, ", "), nil
+}
+
+// buildSelect builds a tenant-scoped SELECT with filters, ordering and pagination
+func (qb *queryBuilder) buildSelect(tenantID string, filters map[string]interface{}, limit, offset int, orderBy string) (string, []interface{}, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", qb.columnList(), qb.table, quoteIdentifier("tenant_id"), qb.param(1))
+	args := []interface{}{tenantID}
+
+	// Sort filter keys so the generated SQL is deterministic
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		col, err := qb.column(key)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, filters[key])
+		query += fmt.Sprintf(" AND %s = %s", col, qb.param(len(args)))
+	}
+
+	if orderBy != "" {
+		order, err := qb.orderBy(orderBy)
+		if err != nil {
+			return "", nil, err
+		}
+		query += " ORDER BY " + order
+	} else if qb.allowed["created_at"] {
+		query += " ORDER BY " + quoteIdentifier("created_at") + " DESC"
+	}
+
+	if limit > 0 {
+		args = append(args, limit)
+		query += " LIMIT " + qb.param(len(args))
+	}
+
+	if offset > 0 {
+		args = append(args, offset)
+		query += " OFFSET " + qb.param(len(args))
+	}
+
+	return query, args, nil
+}
+
+// buildInsert builds an INSERT for the columns present in data, in schema order
+func (qb *queryBuilder) buildInsert(data map[string]interface{}) (string, []interface{}, error) {
+	columns := make([]string, 0, len(qb.columns))
+	placeholders := make([]string, 0, len(qb.columns))
+	values := make([]interface{}, 0, len(qb.columns))
+
+	for _, col := range qb.columns {
+		if value, exists := data[col]; exists {
+			values = append(values, value)
+			columns = append(columns, quoteIdentifier(col))
+			placeholders = append(placeholders, qb.param(len(values)))
+		}
+	}
+
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("no fields to insert")
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+		qb.table,
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "),
+		qb.columnList(),
+	)
+
+	return query, values, nil
+}
+
+// buildUpdate builds a tenant-scoped UPDATE by entity key
+func (qb *queryBuilder) buildUpdate(tenantID, id string, data map[string]interface{}) (string, []interface{}, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	setParts := make([]string, 0, len(keys))
+	values := make([]interface{}, 0, len(keys)+2)
+
+	for _, key := range keys {
+		col, err := qb.column(key)
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, data[key])
+		setParts = append(setParts, fmt.Sprintf("%s = %s", col, qb.param(len(values))))
+	}
+
+	values = append(values, id, tenantID)
+
+	query := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s = %s AND %s = %s RETURNING %s",
+		qb.table,
+		strings.Join(setParts, ", "),
+		quoteIdentifier(qb.key),
+		qb.param(len(values)-1),
+		quoteIdentifier("tenant_id"),
+		qb.param(len(values)),
+		qb.columnList(),
+	)
+
+	return query, values, nil
+}
+
+// buildGet builds a tenant-scoped SELECT by entity key
+func (qb *queryBuilder) buildGet(tenantID, id string) (string, []interface{}) {
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s = %s AND %s = %s",
+		qb.columnList(),
+		qb.table,
+		quoteIdentifier(qb.key),
+		qb.param(1),
+		quoteIdentifier("tenant_id"),
+		qb.param(2),
+	)
+	return query, []interface{}{id, tenantID}
+}
+
+// buildUsage builds a query counting a tenant's records and the bytes their
+// values take as text
+func (qb *queryBuilder) buildUsage(tenantID string) (string, []interface{}) {
+	sizes := make([]string, len(qb.columns))
+	for i, column := range qb.columns {
+		text := fmt.Sprintf("CAST(%s AS TEXT)", quoteIdentifier(column))
+		sizes[i] = fmt.Sprintf("COALESCE(%s, 0)", fmt.Sprintf(qb.dialect.byteLength, text))
+	}
+	query := fmt.Sprintf(
+		"SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM %s WHERE %s = %s",
+		strings.Join(sizes, " + "),
+		qb.table,
+		quoteIdentifier("tenant_id"),
+		qb.param(1),
+	)
+	return query, []interface{}{tenantID}
+}
+
+// buildDelete builds a tenant-scoped DELETE by entity key
+func (qb *queryBuilder) buildDelete(tenantID, id string) (string, []interface{}) {
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE %s = %s AND %s = %s",
+		qb.table,
+		quoteIdentifier(qb.key),
+		qb.param(1),
+		quoteIdentifier("tenant_id"),
+		qb.param(2),
+	)
+	return query, []interface{}{id, tenantID}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// injectionAttempts are seeds shared by the fuzz targets below
+var injectionAttempts = []string{
+	"name",
+	"name ASC",
+	"email DESC, name",
+	"name; DROP TABLE users; --",
+	"name ASC; DELETE FROM users",
+	"1=1 OR name",
+	`name" OR "1"="1`,
+	"name' OR '1'='1",
+	"(SELECT password FROM admins)",
+	"name /* comment */",
+	"name\x00",
+	"tenant_id = tenant_id OR tenant_id",
+	"CASE WHEN 1=1 THEN name ELSE email END",
+	"",
+}
+
+func queryBuilderTestEntity() *schema.Entity {
+	return &schema.Entity{
+		Key: "user_id",
+		Schema: schema.EntitySchema{
+			Type: "object",
+			Properties: map[string]*schema.PropertyDefinition{
+				"user_id": {Type: "string"},
+				"email":   {Type: "string", Format: "email"},
+				"name":    {Type: "string"},
+				"age":     {Type: "integer"},
+			},
+		},
+	}
+}
+
+func newTestQueryBuilder() *queryBuilder {
+	entity := queryBuilderTestEntity()
+	return newQueryBuilder(postgresDialect, "users", entity, entityColumns(entity))
+}
+
+// unquoteLiteral reverses quoteLiteral, failing if the literal would
+// terminate early or contains unescaped quotes
+func unquoteLiteral(t *testing.T, literal string) string {
+	escaped := strings.HasPrefix(literal, "E'")
+	if escaped {
+		literal = literal[1:]
+	}
+	if len(literal) < 2 || literal[0] != '\'' || literal[len(literal)-1] != '\'' {
+		t.Fatalf("literal %q is not quoted", literal)
+	}
+
+	var out strings.Builder
+	body := literal[1 : len(literal)-1]
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\'':
+			if i+1 >= len(body) || body[i+1] != '\'' {
+				t.Fatalf("literal %q contains an unescaped quote at %d", literal, i)
+			}
+			out.WriteByte('\'')
+			i++
+		case escaped && body[i] == '\\':
+			if i+1 >= len(body) || body[i+1] != '\\' {
+				t.Fatalf("literal %q contains an unescaped backslash at %d", literal, i)
+			}
+			out.WriteByte('\\')
+			i++
+		default:
+			out.WriteByte(body[i])
+		}
+	}
+	return out.String()
+}
+
+func TestQueryBuilderRejectsInjection(t *testing.T) {
+	qb := newTestQueryBuilder()
+
+	for _, attempt := range injectionAttempts[3:] {
+		t.Run("filter/"+attempt, func(t *testing.T) {
+			_, _, err := qb.buildSelect("tenant", map[string]interface{}{attempt: "x"}, 10, 0, "")
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Errorf("Expected ErrInvalidIdentifier for filter %q, got %v", attempt, err)
+			}
+		})
+
+		t.Run("order_by/"+attempt, func(t *testing.T) {
+			_, _, err := qb.buildSelect("tenant", nil, 10, 0, attempt)
+			if attempt == "" {
+				return
+			}
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Errorf("Expected ErrInvalidIdentifier for order_by %q, got %v", attempt, err)
+			}
+		})
+
+		t.Run("update/"+attempt, func(t *testing.T) {
+			_, _, err := qb.buildUpdate("tenant", "id", map[string]interface{}{attempt: "x"})
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Errorf("Expected ErrInvalidIdentifier for update field %q, got %v", attempt, err)
+			}
+		})
+	}
+}
+
+func TestQueryBuilderSelect(t *testing.T) {
+	qb := newTestQueryBuilder()
+
+	query, args, err := qb.buildSelect("tenant", map[string]interface{}{"name": "Bob", "email": "b@example.com"}, 10, 5, "name DESC, age")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `SELECT "user_id", "tenant_id", "age", "email", "name", "created_at", "updated_at" FROM "users"` +
+		` WHERE "tenant_id" = $1 AND "email" = $2 AND "name" = $3 ORDER BY "name" DESC, "age" ASC LIMIT $4 OFFSET $5`
+	if query != expected {
+		t.Errorf("Expected query\n%s\ngot\n%s", expected, query)
+	}
+
+	if len(args) != 5 || args[0] != "tenant" || args[1] != "b@example.com" || args[2] != "Bob" || args[3] != 10 || args[4] != 5 {
+		t.Errorf("Unexpected args: %v", args)
+	}
+}
+
+func TestDefaultLiteral(t *testing.T) {
+	testCases := []struct {
+		name      string
+		propDef   *schema.PropertyDefinition
+		expected  string
+		expectErr bool
+	}{
+		{"Boolean", &schema.PropertyDefinition{Type: "boolean", Default: false}, "FALSE", false},
+		{"Integer", &schema.PropertyDefinition{Type: "integer", Default: 42}, "42", false},
+		{"Number", &schema.PropertyDefinition{Type: "number", Default: 1.5}, "1.5", false},
+		{"String", &schema.PropertyDefinition{Type: "string", Default: "o'neil"}, "'o''neil'", false},
+		{"Backslash", &schema.PropertyDefinition{Type: "string", Default: `a\'b`}, `E'a\\''b'`, false},
+		{"Object", &schema.PropertyDefinition{Type: "object", Default: map[string]interface{}{"k": "v'"}}, `'{"k":"v''"}'`, false},
+		{"Boolean mismatch", &schema.PropertyDefinition{Type: "boolean", Default: "true; DROP TABLE x"}, "", true},
+		{"Integer mismatch", &schema.PropertyDefinition{Type: "integer", Default: "1); DROP TABLE x; --"}, "", true},
+		{"Fractional integer", &schema.PropertyDefinition{Type: "integer", Default: 1.5}, "", true},
+		{"Largest integer", &schema.PropertyDefinition{Type: "integer", Default: int64(math.MaxInt64)}, "9223372036854775807", false},
+		{"Integer overflow", &schema.PropertyDefinition{Type: "integer", Default: 1e19}, "", true},
+		{"Integer overflow at 2^63", &schema.PropertyDefinition{Type: "integer", Default: float64(math.MaxInt64)}, "", true},
+		{"NUL byte", &schema.PropertyDefinition{Type: "string", Default: "a\x00b"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := defaultLiteral(tc.propDef)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func FuzzQueryBuilderFilterKey(f *testing.F) {
+	for _, seed := range injectionAttempts {
+		f.Add(seed)
+	}
+
+	qb := newTestQueryBuilder()
+
+	f.Fuzz(func(t *testing.T, key string) {
+		query, args, err := qb.buildSelect("tenant", map[string]interface{}{key: "value"}, 0, 0, "")
+		if err != nil {
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Fatalf("Unexpected error type for %q: %v", key, err)
+			}
+			return
+		}
+
+		if !qb.allowed[key] {
+			t.Fatalf("Filter key %q is not a schema column but was accepted", key)
+		}
+		if !strings.Contains(query, ` AND "`+key+`" = $2`) {
+			t.Fatalf("Filter key %q was not quoted in %s", key, query)
+		}
+		if len(args) != 2 || args[1] != "value" {
+			t.Fatalf("Filter value was not parameterized: %v", args)
+		}
+	})
+}
+
+func FuzzQueryBuilderOrderBy(f *testing.F) {
+	for _, seed := range injectionAttempts {
+		f.Add(seed)
+	}
+
+	qb := newTestQueryBuilder()
+	term := regexp.MustCompile(`^"([a-z_]+)" (ASC|DESC)$`)
+
+	f.Fuzz(func(t *testing.T, orderBy string) {
+		query, _, err := qb.buildSelect("tenant", nil, 0, 0, orderBy)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Fatalf("Unexpected error type for %q: %v", orderBy, err)
+			}
+			return
+		}
+
+		_, order, found := strings.Cut(query, " ORDER BY ")
+		if !found {
+			t.Fatalf("Query has no ORDER BY clause: %s", query)
+		}
+
+		for _, part := range strings.Split(order, ", ") {
+			match := term.FindStringSubmatch(part)
+			if match == nil {
+				t.Fatalf("order_by %q produced unexpected SQL %q", orderBy, order)
+			}
+			if !qb.allowed[match[1]] {
+				t.Fatalf("order_by %q produced non-schema column %q", orderBy, match[1])
+			}
+		}
+	})
+}
+
+func FuzzQuoteIdentifier(f *testing.F) {
+	for _, seed := range injectionAttempts {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		quoted := quoteIdentifier(name)
+		if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+			t.Fatalf("Identifier %q is not quoted: %s", name, quoted)
+		}
+
+		inner := quoted[1 : len(quoted)-1]
+		if strings.ContainsRune(inner, 0) {
+			t.Fatalf("Quoted identifier contains NUL: %q", quoted)
+		}
+		if strings.Contains(strings.ReplaceAll(inner, `""`, ""), `"`) {
+			t.Fatalf("Quoted identifier %q contains an unescaped quote", quoted)
+		}
+	})
+}
+
+func FuzzDefaultLiteral(f *testing.F) {
+	for _, seed := range injectionAttempts {
+		f.Add(seed)
+	}
+	f.Add(`\'; DROP TABLE users; --`)
+
+	f.Fuzz(func(t *testing.T, value string) {
+		literal, err := defaultLiteral(&schema.PropertyDefinition{Type: "string", Default: value})
+		if strings.ContainsRune(value, 0) {
+			if err == nil {
+				t.Fatalf("Expected an error for %q, got %s", value, literal)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", value, err)
+		}
+
+		if got := unquoteLiteral(t, literal); got != value {
+			t.Fatalf("Literal %s does not round-trip: expected %q, got %q", literal, value, got)
+		}
+	})
+}
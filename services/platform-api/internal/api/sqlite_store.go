@@ -0,0 +1,40 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Pure Go SQLite driver, so the embedded store needs no cgo toolchain
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDriverName is the database/sql driver the SQLite store opens
+const sqliteDriverName = "sqlite"
+
+// NewSQLiteStore opens an embedded SQLite database at path for local
+// development without Docker. Use ":memory:" for a throwaway database.
+func NewSQLiteStore(path, tenantID string) (*DatabaseOperations, error) {
+	if path == "" {
+		path = "backsaas.db"
+	}
+
+	db, err := sql.Open(sqliteDriverName, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer; serializing connections avoids
+	// SQLITE_BUSY errors and keeps ":memory:" databases on one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure sqlite database: %w", err)
+	}
+
+	return &DatabaseOperations{
+		db:       db,
+		tenantID: tenantID,
+		dialect:  sqliteDialect,
+	}, nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+// Storage drivers supported by OpenStore
+const (
+	StorageDriverPostgres = "postgres"
+	StorageDriverSQLite   = "sqlite"
+	StorageDriverMemory   = "memory"
+)
+
+// ErrEntityNotFound is returned when an entity does not exist for the tenant
+var ErrEntityNotFound = errors.New("entity not found")
+
+// Store is the tenant-scoped storage contract behind the generated entity API
+type Store interface {
+	// EnsureTablesExist creates storage for every entity in the schema and
+	// for the event outbox. From then on, every insert, update and delete is
+	// recorded in the outbox in the same transaction.
+	EnsureTablesExist(schemaObj *schema.Schema) error
+
+	// InsertEntity inserts a new entity and returns the stored record
+	InsertEntity(entityName string, entity *schema.Entity, data map[string]interface{}) (map[string]interface{}, error)
+
+	// UpdateEntity updates an entity by key and returns the stored record
+	UpdateEntity(entityName string, entity *schema.Entity, id string, data map[string]interface{}) (map[string]interface{}, error)
+
+	// QueryEntities retrieves entities with filtering, pagination and sorting
+	QueryEntities(entityName string, entity *schema.Entity, filters map[string]interface{}, limit, offset int, orderBy string) ([]map[string]interface{}, error)
+
+	// GetEntity retrieves a single entity by key
+	GetEntity(entityName string, entity *schema.Entity, id string) (map[string]interface{}, error)
+
+	// DeleteEntity deletes an entity by key
+	DeleteEntity(entityName string, entity *schema.Entity, id string) error
+
+	// OutboxStore gives the outbox relay and change streams access to
+	// recorded changes
+	OutboxStore
+
+	// Usage counts the tenant's records across the schema's entities and
+	// the bytes their values take, for the usage reporter
+	Usage(schemaObj *schema.Schema) (ResourceUsage, error)
+
+	// WithTransaction runs fn against a store bound to a single transaction.
+	// The transaction commits if fn returns nil and rolls back otherwise.
+	// Calling it on a store that is already in a transaction reuses it.
+	WithTransaction(fn func(tx Store) error) error
+}
+
+// OpenStore opens a tenant-scoped store for the given driver. The dsn is a
+// connection URL for postgres, a file path for sqlite and ignored for memory.
+func OpenStore(driver, dsn, tenantID string) (Store, error) {
+	switch driver {
+	case "", StorageDriverPostgres:
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return NewDatabaseOperations(db, tenantID), nil
+	case StorageDriverSQLite:
+		return NewSQLiteStore(dsn, tenantID)
+	case StorageDriverMemory:
+		return NewMemoryStore(tenantID), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %s", driver)
+	}
+}
+
+// dialect captures the SQL differences between the database/sql backends
+type dialect struct {
+	name          string
+	jsonType      string
+	timestampType string
+	uuidType      string
+	serialKey     string // auto-incrementing integer primary key
+	byteLength    string // format for the size in bytes of a text expression
+	placeholder   func(n int) string
+}
+
+var postgresDialect = &dialect{
+	name:          StorageDriverPostgres,
+	jsonType:      "JSONB",
+	timestampType: "TIMESTAMPTZ",
+	uuidType:      "UUID",
+	serialKey:     "BIGSERIAL PRIMARY KEY",
+	byteLength:    "OCTET_LENGTH(%s)",
+	placeholder:   func(n int) string { return fmt.Sprintf("$%d", n) },
+}
+
+var sqliteDialect = &dialect{
+	name:          StorageDriverSQLite,
+	jsonType:      "TEXT",
+	timestampType: "TIMESTAMP",
+	uuidType:      "TEXT",
+	serialKey:     "INTEGER PRIMARY KEY AUTOINCREMENT",
+	byteLength:    "LENGTH(CAST(%s AS BLOB))",
+	placeholder:   func(n int) string { return fmt.Sprintf("?%d", n) },
+}
+
+// prepareInsertData copies data and fills in the tenant, key, audit fields,
+// schema defaults and stored computed properties that every store applies
+// on insert
+func prepareInsertData(entity *schema.Entity, data map[string]interface{}, tenantID string) (map[string]interface{}, error) {
+	insertData := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		insertData[k] = v
+	}
+	stripComputed(entity, insertData)
+
+	// Add audit fields - truncate to microsecond precision to match PostgreSQL
+	now := time.Now().Truncate(time.Microsecond)
+
+	// Add audit fields only if not already provided and not defined in schema
+	if _, exists := insertData["created_at"]; !exists && entity.Schema.Properties["created_at"] == nil {
+		insertData["created_at"] = now
+	}
+	if _, exists := insertData["updated_at"]; !exists {
+		insertData["updated_at"] = now
+	}
+
+	// Always scope the record to the current tenant, whatever the caller sent
+	insertData["tenant_id"] = tenantID
+
+	// Generate ID if not provided
+	if insertData[entity.Key] == nil {
+		insertData[entity.Key] = generateID()
+	}
+
+	// Bind schema defaults for omitted properties instead of relying on DDL
+	for propName, propDef := range entity.Schema.Properties {
+		if _, exists := insertData[propName]; !exists && propDef.Default != nil {
+			insertData[propName] = propDef.Default
+		}
+	}
+
+	if err := computeStoredFields(entity, insertData); err != nil {
+		return nil, err
+	}
+
+	return insertData, nil
+}
+
+// prepareUpdateData copies data, stamps updated_at and strips the fields
+// that may never change after insert
+func prepareUpdateData(entity *schema.Entity, data map[string]interface{}) (map[string]interface{}, error) {
+	updateData := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		updateData[k] = v
+	}
+
+	// Only add updated_at if it's not already in the data
+	if _, exists := updateData["updated_at"]; !exists {
+		updateData["updated_at"] = time.Now().Truncate(time.Microsecond)
+	}
+
+	// Remove key and tenant_id from update data
+	delete(updateData, entity.Key)
+	delete(updateData, "tenant_id")
+	delete(updateData, "created_at") // Don't allow updating created_at
+	stripComputed(entity, updateData)
+
+	if len(updateData) == 0 {
+		return nil, fmt.Errorf("no fields to update")
+	}
+
+	return updateData, nil
+}
+
+// generateID generates a random (version 4) UUID for an entity, so keys
+// declared with format: uuid are always valid
+func generateID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand only fails if the OS entropy source is unavailable
+		return fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Unix())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+func storeTestSchema() *schema.Schema {
+	return &schema.Schema{
+		Version: 1,
+		Service: schema.ServiceConfig{Name: "store-test"},
+		Entities: map[string]*schema.Entity{
+			"store_items": {
+				Key: "item_id",
+				Schema: schema.EntitySchema{
+					Type:     "object",
+					Required: []string{"item_id", "name"},
+					Properties: map[string]*schema.PropertyDefinition{
+						"item_id":  {Type: "string"},
+						"name":     {Type: "string", MaxLength: 100},
+						"quantity": {Type: "integer"},
+						"active":   {Type: "boolean", Default: true},
+						"tags":     {Type: "array"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// storeFactories returns a constructor for every store available in this
+// environment; each constructor returns stores for two tenants sharing data
+func storeFactories(t *testing.T) map[string]func(t *testing.T) (Store, Store) {
+	factories := map[string]func(t *testing.T) (Store, Store){
+		StorageDriverMemory: func(t *testing.T) (Store, Store) {
+			store := NewMemoryStore("tenant-a")
+			return store, store.ForTenant("tenant-b")
+		},
+	}
+
+	if dbURL := os.Getenv("TEST_DATABASE_URL"); dbURL != "" {
+		factories[StorageDriverPostgres] = func(t *testing.T) (Store, Store) {
+			db, err := sql.Open("postgres", dbURL)
+			if err != nil || db.Ping() != nil {
+				t.Skip("Database not accessible for testing")
+			}
+			db.Exec("DROP TABLE IF EXISTS store_items, _outbox")
+			t.Cleanup(func() {
+				db.Exec("DROP TABLE IF EXISTS store_items, _outbox")
+				db.Close()
+			})
+			return NewDatabaseOperations(db, "tenant-a"), NewDatabaseOperations(db, "tenant-b")
+		}
+	}
+
+	factories[StorageDriverSQLite] = func(t *testing.T) (Store, Store) {
+		storeA, err := NewSQLiteStore(":memory:", "tenant-a")
+		if err != nil {
+			t.Fatalf("Failed to open sqlite store: %v", err)
+		}
+		t.Cleanup(func() { storeA.db.Close() })
+		storeB := &DatabaseOperations{db: storeA.db, tenantID: "tenant-b", dialect: sqliteDialect}
+		return storeA, storeB
+	}
+
+	return factories
+}
+
+func TestStoreContract(t *testing.T) {
+	testSchema := storeTestSchema()
+	entity := testSchema.Entities["store_items"]
+
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store, otherTenant := factory(t)
+
+			if err := store.EnsureTablesExist(testSchema); err != nil {
+				t.Fatalf("Failed to create tables: %v", err)
+			}
+
+			t.Run("CRUD", func(t *testing.T) {
+				created, err := store.InsertEntity("store_items", entity, map[string]interface{}{
+					"item_id":  "item-1",
+					"name":     "Widget",
+					"quantity": 3,
+					"tags":     []interface{}{"a", "b"},
+				})
+				if err != nil {
+					t.Fatalf("Failed to insert entity: %v", err)
+				}
+				if created["tenant_id"] != "tenant-a" {
+					t.Errorf("Expected tenant_id 'tenant-a', got %v", created["tenant_id"])
+				}
+				if created["active"] != true {
+					t.Errorf("Expected default active=true, got %v", created["active"])
+				}
+				if tags, ok := created["tags"].([]interface{}); !ok || len(tags) != 2 {
+					t.Errorf("Expected tags to round-trip as an array, got %v", created["tags"])
+				}
+
+				updated, err := store.UpdateEntity("store_items", entity, "item-1", map[string]interface{}{"name": "Gadget"})
+				if err != nil {
+					t.Fatalf("Failed to update entity: %v", err)
+				}
+				if updated["name"] != "Gadget" {
+					t.Errorf("Expected name 'Gadget', got %v", updated["name"])
+				}
+
+				retrieved, err := store.GetEntity("store_items", entity, "item-1")
+				if err != nil {
+					t.Fatalf("Failed to get entity: %v", err)
+				}
+				if retrieved["name"] != "Gadget" {
+					t.Errorf("Expected retrieved name 'Gadget', got %v", retrieved["name"])
+				}
+
+				if err := store.DeleteEntity("store_items", entity, "item-1"); err != nil {
+					t.Fatalf("Failed to delete entity: %v", err)
+				}
+				if _, err := store.GetEntity("store_items", entity, "item-1"); !errors.Is(err, ErrEntityNotFound) {
+					t.Errorf("Expected ErrEntityNotFound after delete, got %v", err)
+				}
+			})
+
+			t.Run("QueryFilterOrderAndPaginate", func(t *testing.T) {
+				for i := 1; i <= 5; i++ {
+					_, err := store.InsertEntity("store_items", entity, map[string]interface{}{
+						"item_id":  fmt.Sprintf("query-%d", i),
+						"name":     fmt.Sprintf("Item %d", i),
+						"quantity": i,
+						"active":   i%2 == 0,
+					})
+					if err != nil {
+						t.Fatalf("Failed to insert entity: %v", err)
+					}
+				}
+
+				results, err := store.QueryEntities("store_items", entity, nil, 2, 1, "quantity DESC")
+				if err != nil {
+					t.Fatalf("Failed to query entities: %v", err)
+				}
+				if len(results) != 2 || results[0]["item_id"] != "query-4" || results[1]["item_id"] != "query-3" {
+					t.Errorf("Unexpected ordering or pagination: %v", results)
+				}
+
+				results, err = store.QueryEntities("store_items", entity, map[string]interface{}{"name": "Item 2"}, 10, 0, "")
+				if err != nil {
+					t.Fatalf("Failed to query entities: %v", err)
+				}
+				if len(results) != 1 || results[0]["item_id"] != "query-2" {
+					t.Errorf("Expected filter to match query-2, got %v", results)
+				}
+
+				_, err = store.QueryEntities("store_items", entity, map[string]interface{}{"name; DROP TABLE store_items": "x"}, 10, 0, "")
+				if !errors.Is(err, ErrInvalidIdentifier) {
+					t.Errorf("Expected ErrInvalidIdentifier for unknown filter, got %v", err)
+				}
+			})
+
+			t.Run("TenantIsolation", func(t *testing.T) {
+				if _, err := otherTenant.GetEntity("store_items", entity, "query-1"); !errors.Is(err, ErrEntityNotFound) {
+					t.Errorf("Expected other tenant to get ErrEntityNotFound, got %v", err)
+				}
+
+				results, err := otherTenant.QueryEntities("store_items", entity, nil, 10, 0, "")
+				if err != nil {
+					t.Fatalf("Failed to query entities: %v", err)
+				}
+				if len(results) != 0 {
+					t.Errorf("Expected other tenant to see no records, got %d", len(results))
+				}
+			})
+
+			t.Run("Transactions", func(t *testing.T) {
+				errRollback := errors.New("rollback")
+				err := store.WithTransaction(func(tx Store) error {
+					if _, err := tx.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "tx-1", "name": "Rolled back"}); err != nil {
+						return err
+					}
+					if _, err := tx.GetEntity("store_items", entity, "tx-1"); err != nil {
+						return err
+					}
+					return errRollback
+				})
+				if !errors.Is(err, errRollback) {
+					t.Fatalf("Expected rollback error, got %v", err)
+				}
+				if _, err := store.GetEntity("store_items", entity, "tx-1"); !errors.Is(err, ErrEntityNotFound) {
+					t.Errorf("Expected rolled back insert to be absent, got %v", err)
+				}
+
+				err = store.WithTransaction(func(tx Store) error {
+					_, err := tx.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "tx-2", "name": "Committed"})
+					return err
+				})
+				if err != nil {
+					t.Fatalf("Failed to commit transaction: %v", err)
+				}
+				if _, err := store.GetEntity("store_items", entity, "tx-2"); err != nil {
+					t.Errorf("Expected committed insert to be visible, got %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	store, err := OpenStore(StorageDriverMemory, "", "tenant")
+	if err != nil {
+		t.Fatalf("Failed to open memory store: %v", err)
+	}
+	if _, ok := store.(*MemoryStore); !ok {
+		t.Errorf("Expected *MemoryStore, got %T", store)
+	}
+
+	if _, err := OpenStore("mongo", "", "tenant"); err == nil {
+		t.Error("Expected error for unsupported storage driver")
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the engine's spans
+const tracerName = "github.com/backsaas/platform/services/platform-api/internal/api"
+
+// traceContext reads and writes W3C traceparent headers
+var traceContext = propagation.TraceContext{}
+
+// TracingConfig configures span export
+type TracingConfig struct {
+	// ServiceName is reported with every span
+	ServiceName string
+
+	// Exporter is "otlp", "stdout" or "none"
+	Exporter string
+
+	// Endpoint is the OTLP/HTTP collector's base URL; spans are posted to
+	// its /v1/traces path
+	Endpoint string
+
+	// SampleRatio is the fraction of new traces recorded; traces continued
+	// from a caller follow the caller's decision. Zero records every trace.
+	SampleRatio float64
+
+	// SpanExporter overrides Exporter, for exporters built by the caller
+	// such as tracetest's in-memory exporter
+	SpanExporter sdktrace.SpanExporter
+}
+
+// newTracerProvider creates a tracer provider from a config. It returns
+// nil, which traces nothing, when the exporter is "none" or empty.
+func newTracerProvider(config TracingConfig) (*sdktrace.TracerProvider, error) {
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1")
+	}
+
+	exporter := config.SpanExporter
+	if exporter == nil {
+		var err error
+		switch strings.ToLower(config.Exporter) {
+		case "", "none":
+			return nil, nil
+		case "otlp":
+			if config.Endpoint == "" {
+				return nil, fmt.Errorf("the otlp exporter needs an endpoint")
+			}
+			exporter, err = otlptracehttp.New(context.Background(),
+				otlptracehttp.WithEndpointURL(strings.TrimSuffix(config.Endpoint, "/")+"/v1/traces"))
+		case "stdout":
+			exporter, err = stdouttrace.New()
+		default:
+			return nil, fmt.Errorf("unknown exporter %q", config.Exporter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ratio := config.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+	), nil
+}
+
+// tracingMiddleware starts a server span for each request, continuing the
+// caller's trace from its traceparent header. Handlers find the span in the
+// request's context, so store queries and function executions they run are
+// traced as its children.
+func (e *Engine) tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if e.tracer == nil {
+			c.Next()
+			return
+		}
+
+		name := c.Request.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		ctx := traceContext.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := e.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.String("http.target", c.Request.URL.RequestURI()),
+			attribute.String("tenant.id", e.tenantID),
+		)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// contextStore is implemented by stores that can bind to a request's
+// context, so their queries are traced as part of the request
+type contextStore interface {
+	WithContext(ctx context.Context) Store
+}
+
+// storeFor returns the engine's store bound to ctx when it supports that
+func (e *Engine) storeFor(ctx context.Context) Store {
+	if store, ok := e.store.(contextStore); ok && trace.SpanContextFromContext(ctx).IsValid() {
+		return store.WithContext(ctx)
+	}
+	return e.store
+}
+
+// WithContext returns a copy of the store whose queries run with ctx and
+// are traced as children of the span in it
+func (d *DatabaseOperations) WithContext(ctx context.Context) Store {
+	bound := *d
+	bound.ctx = ctx
+	return &bound
+}
+
+// contextExecutor is the context-aware subset of *sql.DB and *sql.Tx
+type contextExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracedConn runs each statement with a context and records it as a span
+type tracedConn struct {
+	conn   contextExecutor
+	ctx    context.Context
+	system string
+}
+
+func (t tracedConn) start(query string) trace.Span {
+	operation := strings.ToUpper(strings.Fields(query + " ")[0])
+	tracer := trace.SpanFromContext(t.ctx).TracerProvider().Tracer(tracerName)
+	_, span := tracer.Start(t.ctx, operation, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("db.system", t.system),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", query),
+	)
+	return span
+}
+
+// endSpan ends a statement's span, marking it failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Exec implements sqlExecutor
+func (t tracedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := t.start(query)
+	result, err := t.conn.ExecContext(t.ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+// Query implements sqlExecutor. The span covers the query, not reading
+// its rows.
+func (t tracedConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	span := t.start(query)
+	rows, err := t.conn.QueryContext(t.ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// QueryRow implements sqlExecutor
+func (t tracedConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	span := t.start(query)
+	row := t.conn.QueryRowContext(t.ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
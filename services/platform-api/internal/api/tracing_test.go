@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	engine, err := NewEngine(&Config{
+		TenantID:      "tenant-a",
+		SchemaSource:  "file",
+		SchemaPath:    "../../testdata/test-schema.yaml",
+		StorageDriver: StorageDriverMemory,
+		Tracing:       TracingConfig{SpanExporter: exporter},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	engine.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	spans := exportedSpans(t, engine, exporter)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	service, _ := span.Resource.Set().Value("service.name")
+	if span.Name != "GET /api/users" || span.SpanKind != trace.SpanKindServer || service.AsString() != "test-api" {
+		t.Errorf("Unexpected span %+v", span)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the span to continue the caller's trace, got trace %s parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	if spanAttribute(span, "http.status_code").AsInt64() != http.StatusOK || spanAttribute(span, "tenant.id").AsString() != "tenant-a" {
+		t.Errorf("Unexpected attributes %v", span.Attributes)
+	}
+
+	t.Run("NewTrace", func(t *testing.T) {
+		exporter.Reset()
+		engine.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+		spans := exportedSpans(t, engine, exporter)
+		if len(spans) != 1 || spans[0].Parent.IsValid() || spans[0].Name != "GET" {
+			t.Errorf("Expected one root span named after the method, got %+v", spans)
+		}
+	})
+}
+
+func TestTracedQueries(t *testing.T) {
+	db, err := sql.Open(stubDriverName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request", trace.WithSpanKind(trace.SpanKindServer))
+	store := NewDatabaseOperations(db, "tenant-a").WithContext(ctx).(*DatabaseOperations)
+
+	if _, err := store.conn().Exec(`UPDATE "items" SET "name" = $1`, "x"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := store.conn().Query(`SELECT "id" FROM "items"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, err := store.conn().Exec("fail"); err == nil {
+		t.Fatal("Expected the stub driver to fail")
+	}
+	err = store.WithTransaction(func(tx Store) error {
+		_, err := tx.(*DatabaseOperations).conn().Exec(`INSERT INTO "items" VALUES ($1)`, "a")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 5 {
+		t.Fatalf("Expected 5 spans, got %d", len(spans))
+	}
+	for i, name := range []string{"UPDATE", "SELECT", "FAIL", "INSERT"} {
+		span := spans[i]
+		if span.Name != name || span.SpanKind != trace.SpanKindClient || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected a %s child span of the request, got %+v", name, span)
+		}
+		if system := spanAttribute(span, "db.system").AsString(); system != StorageDriverPostgres {
+			t.Errorf("Expected db.system postgres, got %v", system)
+		}
+	}
+	if statement := spanAttribute(spans[0], "db.statement").AsString(); statement != `UPDATE "items" SET "name" = $1` {
+		t.Errorf("Unexpected statement %v", statement)
+	}
+	if spans[2].Status.Code != codes.Error || spans[1].Status.Code == codes.Error {
+		t.Errorf("Expected only the failed statement marked as an error")
+	}
+
+	t.Run("Untraced", func(t *testing.T) {
+		engine := &Engine{store: NewDatabaseOperations(db, "tenant-a")}
+		if _, ok := engine.storeFor(context.Background()).(*DatabaseOperations).conn().(tracedConn); ok {
+			t.Error("Expected queries without a span in the context to run untraced")
+		}
+		if _, ok := engine.storeFor(ctx).(*DatabaseOperations).conn().(tracedConn); !ok {
+			t.Error("Expected queries with a span in the context to be traced")
+		}
+	})
+}
+
+// exportedSpans flushes the engine's batched spans and returns them
+func exportedSpans(t *testing.T, engine *Engine, exporter *tracetest.InMemoryExporter) tracetest.SpanStubs {
+	if err := engine.tracerProvider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush spans: %v", err)
+	}
+	return exporter.GetSpans()
+}
+
+// spanAttribute returns the value of a span's attribute
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	attributes := attribute.NewSet(span.Attributes...)
+	value, _ := attributes.Value(key)
+	return value
+}
+
+// stubDriverName is a database/sql driver that accepts every statement
+// except "fail" and returns no rows
+const stubDriverName = "tracing-stub"
+
+func init() {
+	sql.Register(stubDriverName, stubDriver{})
+}
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.TrimSpace(query) == "fail" {
+		return nil, errors.New("stub: statement failed")
+	}
+	return stubStmt{}, nil
+}
+func (stubConn) Close() error              { return nil }
+func (stubConn) Begin() (driver.Tx, error) { return stubTx{}, nil }
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubStmt struct{}
+
+func (stubStmt) Close() error                               { return nil }
+func (stubStmt) NumInput() int                              { return -1 }
+func (stubStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (stubStmt) Query([]driver.Value) (driver.Rows, error)  { return stubRows{}, nil }
+
+type stubRows struct{}
+
+func (stubRows) Columns() []string         { return []string{"id"} }
+func (stubRows) Close() error              { return nil }
+func (stubRows) Next([]driver.Value) error { return io.EOF }
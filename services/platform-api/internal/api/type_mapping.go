@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// dateLayout is the wire format for properties declared with format: date
+const dateLayout = "2006-01-02"
+
+// columnType maps a schema property to its SQL column type
+func columnType(d *dialect, propDef *schema.PropertyDefinition) string {
+	switch propDef.Type {
+	case "string":
+		switch propDef.Format {
+		case "date-time":
+			return d.timestampType
+		case "date":
+			return "DATE"
+		case "uuid":
+			return d.uuidType
+		case "email":
+			return "VARCHAR(255)"
+		case "uri":
+			return "TEXT"
+		}
+		if propDef.MaxLength > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", propDef.MaxLength)
+		}
+		return "TEXT"
+	case "integer":
+		// Fall back to BIGINT when the declared range does not fit in INTEGER
+		if (propDef.Minimum != nil && *propDef.Minimum < math.MinInt32) ||
+			(propDef.Maximum != nil && *propDef.Maximum > math.MaxInt32) {
+			return "BIGINT"
+		}
+		return "INTEGER"
+	case "number":
+		if propDef.Precision > 0 {
+			return fmt.Sprintf("NUMERIC(%d,%d)", propDef.Precision, propDef.Scale)
+		}
+		return "NUMERIC"
+	case "boolean":
+		return "BOOLEAN"
+	case "array", "object":
+		return d.jsonType
+	default:
+		return "TEXT"
+	}
+}
+
+// columnCheck builds the CHECK constraint expression enforcing a property's
+// enum, minimum and maximum, or "" when it has none. Patterns are enforced
+// only by the API's validator: database regexes are POSIX rather than the
+// RE2 syntax the validator uses, so the two checks could disagree.
+func columnCheck(d *dialect, propName string, propDef *schema.PropertyDefinition) (string, error) {
+	col := quoteIdentifier(propName)
+	var conditions []string
+
+	if len(propDef.Enum) > 0 {
+		values := make([]string, len(propDef.Enum))
+		for i, value := range propDef.Enum {
+			literal, err := quoteLiteral(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid enum value: %w", err)
+			}
+			values[i] = literal
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", col, strings.Join(values, ", ")))
+	}
+
+	if propDef.Type == "integer" || propDef.Type == "number" {
+		if propDef.Minimum != nil {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s", col, strconv.FormatFloat(*propDef.Minimum, 'f', -1, 64)))
+		}
+		if propDef.Maximum != nil {
+			conditions = append(conditions, fmt.Sprintf("%s <= %s", col, strconv.FormatFloat(*propDef.Maximum, 'f', -1, 64)))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "CHECK (" + strings.Join(conditions, " AND ") + ")", nil
+}
+
+// encodeValue converts an API value into the value bound for its column.
+// Timestamps are parsed so the database stores an instant rather than text,
+// and arrays and objects are serialized to JSON.
+func encodeValue(propDef *schema.PropertyDefinition, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch propDef.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		switch propDef.Format {
+		case "date-time":
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date-time %q: expected RFC3339", str)
+			}
+			return t.UTC().Truncate(time.Microsecond), nil
+		case "date":
+			if _, err := time.Parse(dateLayout, str); err != nil {
+				return nil, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", str)
+			}
+		case "uuid":
+			return strings.ToLower(str), nil
+		}
+		return str, nil
+	case "array", "object":
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+		jsonBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(jsonBytes), nil
+	default:
+		return value, nil
+	}
+}
+
+// encodeRecord encodes every schema property present in data in place
+func encodeRecord(entity *schema.Entity, data map[string]interface{}) error {
+	for key, value := range data {
+		propDef, exists := entity.Schema.Properties[key]
+		if !exists {
+			continue
+		}
+		encoded, err := encodeValue(propDef, value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		data[key] = encoded
+	}
+	return nil
+}
+
+// jsonNumberPattern matches the numbers JSON can carry, which excludes
+// NUMERIC's NaN and Infinity
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// decodeValue converts a stored column value back to its API type using the
+// property definition: RFC3339 timestamps, native numbers and booleans,
+// json.Number for NUMERIC text, and decoded JSON for arrays and objects
+func decodeValue(propDef *schema.PropertyDefinition, value interface{}) interface{} {
+	// Drivers return text, NUMERIC and UUID columns as bytes
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if value == nil {
+		return nil
+	}
+
+	switch propDef.Type {
+	case "string":
+		switch propDef.Format {
+		case "date-time":
+			if t, ok := value.(time.Time); ok {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		case "date":
+			if t, ok := value.(time.Time); ok {
+				return t.Format(dateLayout)
+			}
+		}
+		if t, ok := value.(time.Time); ok {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+		return value
+	case "integer":
+		switch v := value.(type) {
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+		default:
+			if f, ok := toFloat64(v); ok {
+				return int64(f)
+			}
+		}
+		return value
+	case "number":
+		switch v := value.(type) {
+		case string:
+			// NUMERIC columns come back as text; keep every digit rather
+			// than rounding to a float64
+			if jsonNumberPattern.MatchString(v) {
+				return json.Number(v)
+			}
+		default:
+			if f, ok := toFloat64(v); ok {
+				return f
+			}
+		}
+		return value
+	case "boolean":
+		// SQLite has no boolean type and returns 0/1 integers
+		if i, ok := value.(int64); ok {
+			return i != 0
+		}
+		return value
+	case "array", "object":
+		if str, ok := value.(string); ok && str != "" {
+			var jsonVal interface{}
+			if err := json.Unmarshal([]byte(str), &jsonVal); err == nil {
+				return jsonVal
+			}
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// decodeColumnValue converts a scanned column value back to the Go type the
+// API returns for it
+func decodeColumnValue(col string, val interface{}, entity *schema.Entity) interface{} {
+	if propDef, exists := entity.Schema.Properties[col]; exists {
+		return decodeValue(propDef, val)
+	}
+
+	// Convert []byte to string for text fields
+	if b, ok := val.([]byte); ok {
+		val = string(b)
+	}
+
+	// Normalize timestamp fields to match Go's timezone format
+	if t, ok := val.(time.Time); ok && (col == "created_at" || col == "updated_at") {
+		// Ensure timezone is in UTC and truncate to microsecond precision
+		val = t.UTC().Truncate(time.Microsecond)
+	}
+
+	return val
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+func TestEncodeValue(t *testing.T) {
+	testCases := []struct {
+		name      string
+		propDef   *schema.PropertyDefinition
+		value     interface{}
+		expected  interface{}
+		expectErr bool
+	}{
+		{
+			name:     "Date-time is parsed to UTC",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "date-time"},
+			value:    "2024-03-01T10:30:00+02:00",
+			expected: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "Invalid date-time",
+			propDef:   &schema.PropertyDefinition{Type: "string", Format: "date-time"},
+			value:     "yesterday",
+			expectErr: true,
+		},
+		{
+			name:     "Date is kept as text",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "date"},
+			value:    "2024-03-01",
+			expected: "2024-03-01",
+		},
+		{
+			name:      "Invalid date",
+			propDef:   &schema.PropertyDefinition{Type: "string", Format: "date"},
+			value:     "03/01/2024",
+			expectErr: true,
+		},
+		{
+			name:     "UUID is lowercased",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "uuid"},
+			value:    "6F9619FF-8B86-D011-B42D-00C04FC964FF",
+			expected: "6f9619ff-8b86-d011-b42d-00c04fc964ff",
+		},
+		{
+			name:     "Array is serialized",
+			propDef:  &schema.PropertyDefinition{Type: "array"},
+			value:    []interface{}{"a", 1.5},
+			expected: `["a",1.5]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := encodeValue(tc.propDef, tc.value)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, got %#v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		propDef  *schema.PropertyDefinition
+		value    interface{}
+		expected interface{}
+	}{
+		{
+			name:     "Timestamp becomes RFC3339",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "date-time"},
+			value:    time.Date(2024, 3, 1, 10, 30, 0, 500000000, time.FixedZone("CET", 3600)),
+			expected: "2024-03-01T09:30:00.5Z",
+		},
+		{
+			name:     "Date becomes YYYY-MM-DD",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "date"},
+			value:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: "2024-03-01",
+		},
+		{
+			name:     "UUID bytes become text",
+			propDef:  &schema.PropertyDefinition{Type: "string", Format: "uuid"},
+			value:    []byte("6f9619ff-8b86-d011-b42d-00c04fc964ff"),
+			expected: "6f9619ff-8b86-d011-b42d-00c04fc964ff",
+		},
+		{
+			name:     "NUMERIC bytes keep their digits",
+			propDef:  &schema.PropertyDefinition{Type: "number", Precision: 10, Scale: 2},
+			value:    []byte("12.50"),
+			expected: json.Number("12.50"),
+		},
+		{
+			name:     "NUMERIC beyond float64 precision",
+			propDef:  &schema.PropertyDefinition{Type: "number", Precision: 20, Scale: 2},
+			value:    []byte("123456789012345678.91"),
+			expected: json.Number("123456789012345678.91"),
+		},
+		{
+			name:     "NUMERIC NaN stays text",
+			propDef:  &schema.PropertyDefinition{Type: "number"},
+			value:    []byte("NaN"),
+			expected: "NaN",
+		},
+		{
+			name:     "JSON float becomes an integer",
+			propDef:  &schema.PropertyDefinition{Type: "integer"},
+			value:    float64(42),
+			expected: int64(42),
+		},
+		{
+			name:     "SQLite boolean",
+			propDef:  &schema.PropertyDefinition{Type: "boolean"},
+			value:    int64(1),
+			expected: true,
+		},
+		{
+			name:     "JSON object",
+			propDef:  &schema.PropertyDefinition{Type: "object"},
+			value:    []byte(`{"source":"web"}`),
+			expected: map[string]interface{}{"source": "web"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := decodeValue(tc.propDef, tc.value)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, got %#v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	entity := &schema.Entity{
+		Key: "deal_id",
+		Schema: schema.EntitySchema{
+			Type: "object",
+			Properties: map[string]*schema.PropertyDefinition{
+				"deal_id":   {Type: "string"},
+				"amount":    {Type: "number", Precision: 12, Scale: 2},
+				"seats":     {Type: "integer"},
+				"closes_at": {Type: "string", Format: "date-time"},
+			},
+		},
+	}
+	store := NewMemoryStore("tenant")
+	store.EnsureTablesExist(&schema.Schema{Entities: map[string]*schema.Entity{"deals": entity}})
+
+	created, err := store.InsertEntity("deals", entity, map[string]interface{}{
+		"deal_id":   "deal-1",
+		"amount":    1250.5,
+		"seats":     float64(10),
+		"closes_at": "2024-06-30T17:00:00-04:00",
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entity: %v", err)
+	}
+
+	body, err := json.Marshal(created)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+
+	if decoded["closes_at"] != "2024-06-30T21:00:00Z" {
+		t.Errorf("Expected RFC3339 UTC timestamp, got %v", decoded["closes_at"])
+	}
+	if decoded["amount"] != 1250.5 {
+		t.Errorf("Expected native number 1250.5, got %#v", decoded["amount"])
+	}
+	if decoded["seats"] != float64(10) {
+		t.Errorf("Expected native number 10, got %#v", decoded["seats"])
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// ResourceUsage is what a tenant stores: its records across every entity
+// and the bytes their values take. Storage counts the values as text, not
+// the indexes or page overhead of the database holding them, so tenants
+// sharing tables are measured alike.
+type ResourceUsage struct {
+	StorageBytes int64 `json:"storage_bytes"`
+	Entities     int64 `json:"entities"`
+}
+
+// Usage counts the tenant's records and their size in every entity table
+func (d *DatabaseOperations) Usage(schemaObj *schema.Schema) (ResourceUsage, error) {
+	var usage ResourceUsage
+	for entityName, entity := range schemaObj.Entities {
+		query, args := d.queryBuilder(entityName, entity).buildUsage(d.tenantID)
+
+		var count, size int64
+		if err := d.conn().QueryRow(query, args...).Scan(&count, &size); err != nil {
+			return ResourceUsage{}, fmt.Errorf("failed to measure %s: %w", entityName, err)
+		}
+		usage.Entities += count
+		usage.StorageBytes += size
+	}
+	return usage, nil
+}
+
+// Usage counts the tenant's records and the size of their values as the
+// SQL stores would hold them
+func (m *MemoryStore) Usage(schemaObj *schema.Schema) (ResourceUsage, error) {
+	tables, unlock := m.lock()
+	defer unlock()
+
+	var usage ResourceUsage
+	for entityName := range schemaObj.Entities {
+		table, err := m.table(tables, entityName)
+		if err != nil {
+			return ResourceUsage{}, err
+		}
+		for _, record := range table {
+			if record["tenant_id"] != m.tenantID {
+				continue
+			}
+			usage.Entities++
+			for _, value := range record {
+				usage.StorageBytes += valueSize(value)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// valueSize returns the length of an encoded value as text
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case time.Time:
+		return int64(len(v.Format(time.RFC3339Nano)))
+	default:
+		return int64(len(fmt.Sprint(v)))
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/backsaas/platform/services/platform-api/internal/schema"
+)
+
+// UsageReporterConfig configures how a tenant's resource usage reaches the
+// gateway
+type UsageReporterConfig struct {
+	// GatewayURL is the gateway's base URL, such as http://gateway:8000
+	GatewayURL string
+
+	// Secret is the gateway's JWT secret; reports carry a short-lived
+	// platform_admin token signed with it
+	Secret string
+
+	// Interval is how often usage is reported; defaults to 5m
+	Interval time.Duration
+}
+
+// UsageReporter measures a tenant's storage and entity count and reports
+// them to the gateway with PUT /_gateway/usage/:tenant/resources, where
+// they are checked against the tenant's plan quotas. The gateway keeps the
+// latest report, so a missed one is made up for by the next.
+type UsageReporter struct {
+	store    Store
+	schema   *schema.Schema
+	tenantID string
+	config   UsageReporterConfig
+	client   *http.Client
+}
+
+// NewUsageReporter creates a reporter for the tenant's usage in store
+func NewUsageReporter(store Store, schemaObj *schema.Schema, tenantID string, config UsageReporterConfig) *UsageReporter {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	config.GatewayURL = strings.TrimSuffix(config.GatewayURL, "/")
+	return &UsageReporter{
+		store:    store,
+		schema:   schemaObj,
+		tenantID: tenantID,
+		config:   config,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run reports usage now and then every interval until ctx is cancelled
+func (r *UsageReporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Report(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Usage report failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report measures the tenant's usage and sends it to the gateway
+func (r *UsageReporter) Report(ctx context.Context) error {
+	usage, err := r.store.Usage(r.schema)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+	token, err := r.token()
+	if err != nil {
+		return err
+	}
+
+	endpoint := r.config.GatewayURL + "/_gateway/usage/" + url.PathEscape(r.tenantID) + "/resources"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to report usage: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("failed to report usage: %s %s %s", resp.Status, failure.Error, failure.Message)
+	}
+	return nil
+}
+
+// token signs a platform_admin token for the gateway's admin endpoints
+func (r *UsageReporter) token() (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       "platform-api",
+		"tenant_id": r.tenantID,
+		"roles":     []string{"platform_admin"},
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Minute).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(r.config.Secret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign usage report token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestStoreUsage(t *testing.T) {
+	testSchema := storeTestSchema()
+	entity := testSchema.Entities["store_items"]
+
+	for name, factory := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store, otherTenant := factory(t)
+			if err := store.EnsureTablesExist(testSchema); err != nil {
+				t.Fatalf("Failed to create tables: %v", err)
+			}
+
+			usage, err := store.Usage(testSchema)
+			if err != nil {
+				t.Fatalf("Failed to measure usage: %v", err)
+			}
+			if usage != (ResourceUsage{}) {
+				t.Errorf("Expected no usage for an empty store, got %+v", usage)
+			}
+
+			for _, id := range []string{"item-1", "item-2"} {
+				if _, err := store.InsertEntity("store_items", entity, map[string]interface{}{"item_id": id, "name": "Widget"}); err != nil {
+					t.Fatalf("Failed to insert entity: %v", err)
+				}
+			}
+			if _, err := otherTenant.InsertEntity("store_items", entity, map[string]interface{}{"item_id": "item-3", "name": "Gadget"}); err != nil {
+				t.Fatalf("Failed to insert entity: %v", err)
+			}
+
+			usage, err = store.Usage(testSchema)
+			if err != nil {
+				t.Fatalf("Failed to measure usage: %v", err)
+			}
+			if usage.Entities != 2 {
+				t.Errorf("Expected 2 entities, got %d", usage.Entities)
+			}
+			if usage.StorageBytes <= 0 {
+				t.Errorf("Expected stored bytes, got %d", usage.StorageBytes)
+			}
+
+			other, err := otherTenant.Usage(testSchema)
+			if err != nil {
+				t.Fatalf("Failed to measure usage: %v", err)
+			}
+			if other.Entities != 1 || other.StorageBytes >= usage.StorageBytes {
+				t.Errorf("Expected the other tenant to be measured alone, got %+v", other)
+			}
+		})
+	}
+}
+
+func TestUsageReporter(t *testing.T) {
+	type report struct {
+		method, path string
+		roles        []interface{}
+		usage        ResourceUsage
+	}
+	received := make(chan report, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := report{method: r.Method, path: r.URL.Path}
+		bearer := r.Header.Get("Authorization")
+		token, err := jwt.Parse(bearer[len("Bearer "):], func(*jwt.Token) (interface{}, error) {
+			return []byte("gateway-secret"), nil
+		})
+		if err == nil {
+			got.roles, _ = token.Claims.(jwt.MapClaims)["roles"].([]interface{})
+		}
+		json.NewDecoder(r.Body).Decode(&got.usage)
+		received <- got
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	testSchema := storeTestSchema()
+	store := NewMemoryStore("acme")
+	if err := store.EnsureTablesExist(testSchema); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	if _, err := store.InsertEntity("store_items", testSchema.Entities["store_items"], map[string]interface{}{"item_id": "item-1", "name": "Widget"}); err != nil {
+		t.Fatalf("Failed to insert entity: %v", err)
+	}
+
+	reporter := NewUsageReporter(store, testSchema, "acme", UsageReporterConfig{GatewayURL: gateway.URL + "/", Secret: "gateway-secret"})
+	if err := reporter.Report(context.Background()); err != nil {
+		t.Fatalf("Failed to report usage: %v", err)
+	}
+
+	got := <-received
+	if got.method != http.MethodPut || got.path != "/_gateway/usage/acme/resources" {
+		t.Errorf("Expected PUT /_gateway/usage/acme/resources, got %s %s", got.method, got.path)
+	}
+	if len(got.roles) != 1 || got.roles[0] != "platform_admin" {
+		t.Errorf("Expected a platform_admin token signed with the gateway secret, got roles %v", got.roles)
+	}
+	if got.usage.Entities != 1 || got.usage.StorageBytes <= 0 {
+		t.Errorf("Expected the store's usage to be reported, got %+v", got.usage)
+	}
+}
+
+func TestUsageReporterRejected(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "Invalid token"}`))
+	}))
+	defer gateway.Close()
+
+	testSchema := storeTestSchema()
+	store := NewMemoryStore("acme")
+	if err := store.EnsureTablesExist(testSchema); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	reporter := NewUsageReporter(store, testSchema, "acme", UsageReporterConfig{GatewayURL: gateway.URL, Secret: "wrong"})
+	if err := reporter.Report(context.Background()); err == nil {
+		t.Error("Expected a rejected report to fail")
+	}
+}
@@ -0,0 +1,337 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrDivisionByZero is returned when an expression divides by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+type node interface {
+	eval(record map[string]interface{}) (interface{}, error)
+	walk(visit func(node))
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) { return n.value, nil }
+func (n *literalNode) walk(visit func(node))                            { visit(n) }
+
+// fieldNode reads a record field; nested object fields are separated by dots
+type fieldNode struct {
+	path []string
+}
+
+func (n *fieldNode) eval(record map[string]interface{}) (interface{}, error) {
+	var value interface{} = record
+	for _, name := range n.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = object[name]
+	}
+	return value, nil
+}
+
+func (n *fieldNode) walk(visit func(node)) { visit(n) }
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(record map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(record)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(value), nil
+	}
+	if value == nil {
+		return nil, nil
+	}
+	f, ok := toFloat64(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %T", value)
+	}
+	return -f, nil
+}
+
+func (n *unaryNode) walk(visit func(node)) {
+	visit(n)
+	n.operand.walk(visit)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(record map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// Boolean operators short-circuit
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(record)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(record)
+		return truthy(right), err
+	}
+
+	right, err := n.right.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	// + concatenates when either side is a string
+	if n.op == "+" {
+		_, leftIsString := left.(string)
+		_, rightIsString := right.(string)
+		if leftIsString || rightIsString {
+			return toString(left) + toString(right), nil
+		}
+	}
+
+	l, lok := toFloat64(left)
+	r, rok := toFloat64(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s needs numbers, got %T and %T", n.op, left, right)
+	}
+
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return math.Mod(l, r), nil
+	default:
+		return nil, fmt.Errorf("unknown operator %s", n.op)
+	}
+}
+
+func (n *binaryNode) walk(visit func(node)) {
+	visit(n)
+	n.left.walk(visit)
+	n.right.walk(visit)
+}
+
+func equal(left, right interface{}) bool {
+	if l, ok := toFloat64(left); ok {
+		r, ok := toFloat64(right)
+		return ok && l == r
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compare(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	var cmp int
+	if l, ok := toFloat64(left); ok {
+		r, ok := toFloat64(right)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T with %T", left, right)
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	} else if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T with %T", left, right)
+		}
+		cmp = strings.Compare(l, r)
+	} else {
+		return nil, fmt.Errorf("cannot compare %T values", left)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   builtin
+	args []node
+}
+
+func (n *callNode) eval(record map[string]interface{}) (interface{}, error) {
+	// if only evaluates the branch it returns
+	if n.name == "if" {
+		cond, err := n.args[0].eval(record)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return n.args[1].eval(record)
+		}
+		return n.args[2].eval(record)
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	result, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return result, nil
+}
+
+func (n *callNode) walk(visit func(node)) {
+	visit(n)
+	for _, arg := range n.args {
+		arg.walk(visit)
+	}
+}
+
+// builtin is a function callable from expressions; maxArgs of -1 means
+// the function is variadic
+type builtin struct {
+	minArgs, maxArgs int
+	call             func(args []interface{}) (interface{}, error)
+}
+
+// builtinsMu guards builtins, which Register adds to
+var builtinsMu sync.RWMutex
+
+var builtins = map[string]builtin{
+	"concat": {1, -1, func(args []interface{}) (interface{}, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(toString(arg))
+		}
+		return b.String(), nil
+	}},
+	"coalesce": {1, -1, func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}},
+	"if": {3, 3, nil}, // evaluated lazily by callNode
+	// in reports whether its first argument equals any of the others; a
+	// list matches when any of its elements does
+	"in": {1, -1, func(args []interface{}) (interface{}, error) {
+		values := []interface{}{args[0]}
+		if list, ok := args[0].([]interface{}); ok {
+			values = list
+		}
+		for _, value := range values {
+			for _, candidate := range args[1:] {
+				if equal(value, candidate) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}},
+	"upper": {1, 1, stringFunc(strings.ToUpper)},
+	"lower": {1, 1, stringFunc(strings.ToLower)},
+	"trim":  {1, 1, stringFunc(strings.TrimSpace)},
+	"length": {1, 1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return float64(utf8.RuneCountInString(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		default:
+			return nil, fmt.Errorf("cannot take length of %T", v)
+		}
+	}},
+	"round": {1, 2, func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		value, ok := toFloat64(args[0])
+		if !ok {
+			return nil, fmt.Errorf("cannot round %T", args[0])
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			if digits, ok = toFloat64(args[1]); !ok {
+				return nil, fmt.Errorf("digits must be a number")
+			}
+		}
+		scale := math.Pow(10, digits)
+		return math.Round(value*scale) / scale, nil
+	}},
+}
+
+// stringFunc adapts a string transformation, passing null through
+func stringFunc(fn func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(toString(args[0])), nil
+	}
+}
@@ -0,0 +1,172 @@
+// Package expr implements the small expression language used by computed
+// properties. Expressions reference record fields by name (nested fields with
+// dots), combine them with arithmetic, comparison and boolean operators, and
+// call built-in functions and those the host adds with Register:
+//
+//	concat(first_name, " ", last_name)
+//	round(price * quantity * (1 - discount), 2)
+//	if(status == "active", "Active", "Inactive")
+//	in(status, "active", "pending")
+//
+// Null propagates through arithmetic, so a computed value is null whenever
+// a field it depends on is missing.
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Expression is a parsed expression
+type Expression struct {
+	source string
+	root   node
+	fields []string
+}
+
+// Parse parses an expression
+func Parse(source string) (*Expression, error) {
+	p := &parser{lexer: newLexer(source)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", p.token, p.token.pos)
+	}
+
+	expression := &Expression{source: source, root: root}
+	seen := make(map[string]bool)
+	root.walk(func(n node) {
+		if f, ok := n.(*fieldNode); ok && !seen[f.path[0]] {
+			seen[f.path[0]] = true
+			expression.fields = append(expression.fields, f.path[0])
+		}
+	})
+	return expression, nil
+}
+
+// parsed caches expressions by source, since the same computed properties
+// are evaluated for every record
+var parsed sync.Map
+
+// Compile returns the parsed expression for source, parsing it only once
+func Compile(source string) (*Expression, error) {
+	if cached, ok := parsed.Load(source); ok {
+		return cached.(*Expression), nil
+	}
+	expression, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Store(source, expression)
+	return expression, nil
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Fields returns the top-level record fields the expression reads
+func (e *Expression) Fields() []string {
+	return e.fields
+}
+
+// Eval evaluates the expression against a record
+func (e *Expression) Eval(record map[string]interface{}) (interface{}, error) {
+	return e.root.eval(record)
+}
+
+// Functions lists the built-in and registered function names
+func Functions() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Func is a function callable from expressions. It receives its evaluated
+// arguments, null ones as nil.
+type Func func(args []interface{}) (interface{}, error)
+
+// Register makes a function callable from expressions that are parsed
+// afterwards; maxArgs of -1 means the function is variadic
+func Register(name string, minArgs, maxArgs int, fn Func) error {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	if _, exists := builtins[name]; exists {
+		return fmt.Errorf("function %s already registered", name)
+	}
+	builtins[name] = builtin{minArgs, maxArgs, fn}
+	return nil
+}
+
+func lookupFunction(name string) (builtin, bool) {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	fn, exists := builtins[name]
+	return fn, exists
+}
+
+// truthy reports whether a value counts as true in a condition
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	default:
+		if f, ok := toFloat64(v); ok {
+			return f != 0
+		}
+		return true
+	}
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
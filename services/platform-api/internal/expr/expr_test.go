@@ -0,0 +1,136 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	record := map[string]interface{}{
+		"first_name": "Ada",
+		"last_name":  "Lovelace",
+		"price":      19.99,
+		"quantity":   int64(3),
+		"discount":   0.1,
+		"amount":     json.Number("12.50"), // NUMERIC columns decode to json.Number
+		"status":     "active",
+		"tags":       []interface{}{"a", "b"},
+		"address":    map[string]interface{}{"city": "London"},
+	}
+
+	testCases := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{`concat(first_name, " ", last_name)`, "Ada Lovelace"},
+		{`first_name + " " + last_name`, "Ada Lovelace"},
+		{`round(price * quantity * (1 - discount), 2)`, 53.97},
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`-quantity + 1`, -2.0},
+		{`10 % 4`, 2.0},
+		{`if(status == "active", "Active", "Inactive")`, "Active"},
+		{`status != 'active' || quantity >= 3`, true},
+		{`!(price > 20) && length(tags) == 2`, true},
+		{`upper(address.city)`, "LONDON"},
+		{`"#" + quantity`, "#3"},
+		{`missing * 2`, nil},
+		{`missing > 2`, nil},
+		{`coalesce(missing, address.zip, "n/a")`, "n/a"},
+		{`trim("  x  ")`, "x"},
+		{`lower(null)`, nil},
+		{`in(status, "pending", "active")`, true},
+		{`in(tags, "c", "b")`, true},
+		{`in(quantity, 1, 2)`, false},
+		{`amount * 2`, 25.0},
+		{`amount == 12.5`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expression, func(t *testing.T) {
+			expression, err := Parse(tc.expression)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			result, err := expression.Eval(record)
+			if err != nil {
+				t.Fatalf("Failed to evaluate: %v", err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, got %#v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	record := map[string]interface{}{"count": 0.0, "name": "x"}
+
+	expression, _ := Parse("10 / count")
+	if _, err := expression.Eval(record); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("Expected ErrDivisionByZero, got %v", err)
+	}
+
+	expression, _ = Parse("name * 2")
+	if _, err := expression.Eval(record); err == nil {
+		t.Error("Expected error multiplying a string")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"unknown_fn(1)",
+		"round()",
+		"if(1, 2)",
+		`"unterminated`,
+		"a # b",
+		"1 2",
+	} {
+		if _, err := Parse(source); err == nil {
+			t.Errorf("Expected parse error for %q", source)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	expression, err := Parse(`concat(first_name, " ", last_name, address.city, first_name)`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	expected := []string{"first_name", "last_name", "address"}
+	if !reflect.DeepEqual(expression.Fields(), expected) {
+		t.Errorf("Expected fields %v, got %v", expected, expression.Fields())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	err := Register("test_double", 1, 1, func(args []interface{}) (interface{}, error) {
+		if value, ok := toFloat64(args[0]); ok {
+			return value * 2, nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+	if err := Register("concat", 1, -1, nil); err == nil {
+		t.Error("Expected registering a built-in name to fail")
+	}
+
+	expression, err := Parse("test_double(price) + 1")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	result, err := expression.Eval(map[string]interface{}{"price": 2.5})
+	if err != nil || result != 6.0 {
+		t.Errorf("Expected 6, got %v (%v)", result, err)
+	}
+	if _, err := Parse("test_double(1, 2)"); err == nil {
+		t.Error("Expected an argument count error")
+	}
+}
@@ -0,0 +1,282 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type lexer struct {
+	src []rune
+	pos int
+}
+
+func newLexer(source string) *lexer {
+	return &lexer{src: []rune(source)}
+}
+
+// operators lists multi-character operators before their prefixes
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!"}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokenLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokenRParen, text: ")", pos: start}, nil
+	case c == ',':
+		l.pos++
+		return token{kind: tokenComma, text: ",", pos: start}, nil
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case unicode.IsDigit(c):
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		text := string(l.src[start:l.pos])
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, fmt.Errorf("invalid number %q at offset %d", text, start)
+		}
+		return token{kind: tokenNumber, text: text, value: value, pos: start}, nil
+	case c == '_' || unicode.IsLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || l.src[l.pos] == '.' || unicode.IsLetter(l.src[l.pos]) || unicode.IsDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenIdent, text: string(l.src[start:l.pos]), pos: start}, nil
+	}
+
+	rest := string(l.src[l.pos:])
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len([]rune(op))
+			return token{kind: tokenOperator, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("unexpected character %q at offset %d", c, start)
+}
+
+func (l *lexer) lexString(quote rune) (token, error) {
+	start := l.pos
+	l.pos++
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch c {
+		case quote:
+			return token{kind: tokenString, text: string(l.src[start:l.pos]), value: b.String(), pos: start}, nil
+		case '\\':
+			if l.pos >= len(l.src) {
+				break
+			}
+			escaped := l.src[l.pos]
+			l.pos++
+			switch escaped {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			default:
+				b.WriteRune(escaped)
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return token{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// parser is a recursive descent parser. Precedence from lowest to highest:
+// ||, &&, comparison, + -, * / %, unary ! -
+type parser struct {
+	lexer *lexer
+	token token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = t
+	return nil
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	if p.token.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if p.token.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseExpression() (node, error) {
+	return p.parseBinary(0)
+}
+
+// binaryLevels groups binary operators by precedence
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator(binaryLevels[level]...) {
+		op := p.token.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("!", "-") {
+		op := p.token.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.token
+	switch t.kind {
+	case tokenNumber, tokenString:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &literalNode{value: t.value}, nil
+	case tokenLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.token.kind != tokenRParen {
+			return nil, fmt.Errorf("expected \")\" at offset %d, got %s", p.token.pos, p.token)
+		}
+		return inner, p.advance()
+	case tokenIdent:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.token.kind == tokenLParen {
+			return p.parseCall(t)
+		}
+		return &fieldNode{path: strings.Split(t.text, ".")}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+	}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, exists := lookupFunction(name.text)
+	if !exists {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	call := &callNode{name: name.text, fn: fn}
+	for p.token.kind != tokenRParen {
+		if len(call.args) > 0 {
+			if p.token.kind != tokenComma {
+				return nil, fmt.Errorf("expected \",\" at offset %d, got %s", p.token.pos, p.token)
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s: %d", name.text, len(call.args))
+	}
+	return call, p.advance()
+}
@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"strconv"
+
+	"github.com/backsaas/platform/services/platform-api/pkg/jsonschema"
+)
+
+// JSONSchema converts the entity schema to a validator schema. Entities are
+// closed: properties that are not declared are rejected.
+func (s *EntitySchema) JSONSchema() *jsonschema.Schema {
+	closed := false
+	return &jsonschema.Schema{
+		Type:                 s.Type,
+		Properties:           convertProperties(s.Properties),
+		Required:             s.Required,
+		AdditionalProperties: &closed,
+	}
+}
+
+// JSONSchema converts the property definition to a validator schema
+func (p *PropertyDefinition) JSONSchema() *jsonschema.Schema {
+	if p == nil {
+		return nil
+	}
+
+	var enum []interface{}
+	for _, value := range p.Enum {
+		enum = append(enum, enumValue(p.Type, value))
+	}
+
+	return &jsonschema.Schema{
+		Type:                 p.Type,
+		Format:               p.Format,
+		Pattern:              p.Pattern,
+		Enum:                 enum,
+		MinLength:            p.MinLength,
+		MaxLength:            p.MaxLength,
+		Minimum:              p.Minimum,
+		Maximum:              p.Maximum,
+		Items:                p.Items.JSONSchema(),
+		MinItems:             p.MinItems,
+		MaxItems:             p.MaxItems,
+		Properties:           convertProperties(p.Properties),
+		Required:             p.Required,
+		AdditionalProperties: p.AdditionalProperties,
+		ReadOnly:             p.Computed != nil,
+	}
+}
+
+func convertProperties(properties map[string]*PropertyDefinition) map[string]*jsonschema.Schema {
+	if len(properties) == 0 {
+		return nil
+	}
+	converted := make(map[string]*jsonschema.Schema, len(properties))
+	for name, propDef := range properties {
+		converted[name] = propDef.JSONSchema()
+	}
+	return converted
+}
+
+// enumValue converts an enum entry, which YAML loads as text, to the type of
+// the property so numeric and boolean enums compare against JSON values
+func enumValue(propType, value string) interface{} {
+	switch propType {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/backsaas/platform/services/platform-api/internal/expr"
 	"gopkg.in/yaml.v3"
 )
 
@@ -46,12 +49,39 @@ type PropertyDefinition struct {
 	Format      string      `yaml:"format,omitempty"`
 	Pattern     string      `yaml:"pattern,omitempty"`
 	Enum        []string    `yaml:"enum,omitempty"`
-	Items       interface{} `yaml:"items,omitempty"`
 	MaxLength   int         `yaml:"maxLength,omitempty"`
 	MinLength   int         `yaml:"minLength,omitempty"`
-	Minimum     int         `yaml:"minimum,omitempty"`
-	Maximum     int         `yaml:"maximum,omitempty"`
+	Minimum     *float64    `yaml:"minimum,omitempty"`
+	Maximum     *float64    `yaml:"maximum,omitempty"`
+	Precision   int         `yaml:"precision,omitempty"` // total digits for NUMERIC columns
+	Scale       int         `yaml:"scale,omitempty"`     // digits after the decimal point
 	Default     interface{} `yaml:"default,omitempty"`
+
+	// Array properties
+	Items    *PropertyDefinition `yaml:"items,omitempty"`
+	MinItems int                 `yaml:"minItems,omitempty"`
+	MaxItems int                 `yaml:"maxItems,omitempty"`
+
+	// Nested object properties
+	Properties           map[string]*PropertyDefinition `yaml:"properties,omitempty"`
+	Required             []string                       `yaml:"required,omitempty"`
+	AdditionalProperties *bool                          `yaml:"additionalProperties,omitempty"`
+
+	// Computed marks a property derived from the rest of the record
+	Computed *ComputedDefinition `yaml:"computed,omitempty"`
+}
+
+// ComputedDefinition derives a property value from an expression or from a
+// Go function registered with the API engine
+type ComputedDefinition struct {
+	Expression string `yaml:"expression,omitempty"`
+	Function   string `yaml:"function,omitempty"`
+	Stored     bool   `yaml:"stored,omitempty"` // evaluate on write and persist, instead of on every read
+}
+
+// Virtual reports whether the property is computed on read and has no column
+func (p *PropertyDefinition) Virtual() bool {
+	return p.Computed != nil && !p.Computed.Stored
 }
 
 // EntityAccess defines access control rules for an entity
@@ -77,6 +107,7 @@ type Function struct {
 	Config    map[string]interface{} `yaml:"config,omitempty"`
 	Functions []FunctionCall         `yaml:"functions,omitempty"`
 	Events    []EventCall            `yaml:"events,omitempty"`
+	Code      string                 `yaml:"code,omitempty"`
 	Async     bool                   `yaml:"async,omitempty"`
 }
 
@@ -136,6 +167,9 @@ type Index struct {
 	Unique bool     `yaml:"unique,omitempty"`
 }
 
+// identifierPattern restricts entity and property names to safe SQL identifiers
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
 // Loader handles schema loading from various sources
 type Loader struct {
 	basePath string
@@ -211,13 +245,81 @@ func (l *Loader) validateSchema(schema *Schema) error {
 				return fmt.Errorf("function %s references unknown entity %s", functionName, function.Entity)
 			}
 		}
+		if function.Type == "hook" {
+			if err := l.validateHook(function); err != nil {
+				return fmt.Errorf("function %s: %w", functionName, err)
+			}
+		}
+		if err := l.validateHookEvents(schema, function); err != nil {
+			return fmt.Errorf("function %s: %w", functionName, err)
+		}
 	}
 	
 	return nil
 }
 
+// hookTriggers are the writes hooks can run for
+var hookTriggers = map[string]bool{
+	"before_create": true, "after_create": true,
+	"before_update": true, "after_update": true,
+	"before_delete": true, "after_delete": true,
+}
+
+// validateHook checks that a hook can run. Hooks run as jobs once the write
+// that triggered them commits, so they must be async and triggered by a
+// write; before_* hooks are enqueued with the after_* ones.
+func (l *Loader) validateHook(function *Function) error {
+	if !function.Async {
+		return fmt.Errorf("hooks run as jobs and must be declared async: true")
+	}
+	for _, trigger := range strings.Split(function.Trigger, ",") {
+		if !hookTriggers[strings.TrimSpace(trigger)] {
+			return fmt.Errorf("hooks can't be triggered by %q", strings.TrimSpace(trigger))
+		}
+	}
+	return nil
+}
+
+// validateHookEvents checks that the events a hook publishes are declared
+// and that their data carries exactly the declared fields, as the event bus
+// requires of published events. Schemas without an events section aren't
+// checked.
+func (l *Loader) validateHookEvents(schema *Schema, function *Function) error {
+	if schema.Events == nil {
+		return nil
+	}
+	for _, call := range function.Events {
+		event, declared := schema.Events[call.Event]
+		if !declared || event == nil {
+			return fmt.Errorf("event %s is not declared in the schema", call.Event)
+		}
+		fields := make(map[string]bool, len(event.Fields))
+		for _, field := range event.Fields {
+			fields[field] = true
+			if _, exists := call.Data[field]; !exists {
+				return fmt.Errorf("event %s is missing field %s", call.Event, field)
+			}
+		}
+		for field := range call.Data {
+			if !fields[field] {
+				return fmt.Errorf("event %s has undeclared field %s", call.Event, field)
+			}
+		}
+	}
+	return nil
+}
+
 // validateEntity validates a single entity definition
 func (l *Loader) validateEntity(name string, entity *Entity) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("entity name %q is not a valid identifier", name)
+	}
+	
+	// Platform tables such as the event outbox live alongside entity tables
+	if strings.HasPrefix(name, "_") {
+		return fmt.Errorf("entity name %q is reserved: names starting with '_' are used by the platform", name)
+	}
+	
 	if entity.Key == "" {
 		return fmt.Errorf("entity key is required")
 	}
@@ -230,6 +332,18 @@ func (l *Loader) validateEntity(name string, entity *Entity) error {
 		return fmt.Errorf("entity must have at least one property")
 	}
 	
+	// Validate property names can be used as column names
+	for propName := range entity.Schema.Properties {
+		if !identifierPattern.MatchString(propName) {
+			return fmt.Errorf("property name %q is not a valid identifier", propName)
+		}
+	}
+	
+	// Validate property definitions with the same rules used for payloads
+	if err := entity.Schema.JSONSchema().CheckDefinition(); err != nil {
+		return err
+	}
+	
 	// Validate key field exists in properties
 	if _, exists := entity.Schema.Properties[entity.Key]; !exists {
 		return fmt.Errorf("key field %s not found in properties", entity.Key)
@@ -242,5 +356,64 @@ func (l *Loader) validateEntity(name string, entity *Entity) error {
 		}
 	}
 	
+	// Validate computed properties
+	for propName, propDef := range entity.Schema.Properties {
+		if propDef.Computed == nil {
+			continue
+		}
+		if err := l.validateComputed(propName, propDef, entity); err != nil {
+			return fmt.Errorf("computed property %s: %w", propName, err)
+		}
+	}
+	
+	return nil
+}
+
+// validateComputed validates a computed property definition. Expressions may
+// only read plain properties and system fields, so evaluation order never
+// matters.
+func (l *Loader) validateComputed(propName string, propDef *PropertyDefinition, entity *Entity) error {
+	computed := propDef.Computed
+	
+	if (computed.Expression == "") == (computed.Function == "") {
+		return fmt.Errorf("exactly one of expression or function is required")
+	}
+	
+	if propName == entity.Key {
+		return fmt.Errorf("the entity key cannot be computed")
+	}
+	
+	if propDef.Default != nil {
+		return fmt.Errorf("computed properties cannot have a default")
+	}
+	
+	for _, required := range entity.Schema.Required {
+		if required == propName {
+			return fmt.Errorf("computed properties cannot be required")
+		}
+	}
+	
+	if computed.Expression == "" {
+		return nil
+	}
+	
+	expression, err := expr.Parse(computed.Expression)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	
+	for _, field := range expression.Fields() {
+		if field == "tenant_id" || field == "created_at" || field == "updated_at" {
+			continue
+		}
+		dependency, exists := entity.Schema.Properties[field]
+		if !exists {
+			return fmt.Errorf("expression references unknown property %s", field)
+		}
+		if dependency.Computed != nil {
+			return fmt.Errorf("expression references computed property %s", field)
+		}
+	}
+	
 	return nil
 }
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -161,6 +162,50 @@ entities: {}
 		if err == nil {
 			t.Error("Expected error for schema without entities")
 		}
+
+		// Test hook publishing data its event doesn't declare
+		invalidHookEvent := `
+version: 1
+service:
+  name: "test"
+entities:
+  users:
+    key: id
+    schema:
+      type: object
+      properties:
+        id: { type: string }
+platform_functions:
+  welcome:
+    entity: users
+    type: hook
+    trigger: after_create
+    async: true
+    events:
+      - event: user.created
+        data: { user_id: "{{id}}" }
+events:
+  user.created:
+    fields: [id]
+`
+		_, err = loader.LoadFromBytes([]byte(invalidHookEvent))
+		if err == nil || !strings.Contains(err.Error(), "user.created") {
+			t.Errorf("Expected error for hook event with undeclared fields, got %v", err)
+		}
+
+		// Test synchronous hook, which nothing would run
+		syncHook := strings.Replace(strings.Replace(invalidHookEvent, "user_id:", "id:", 1), "    async: true\n", "", 1)
+		_, err = loader.LoadFromBytes([]byte(syncHook))
+		if err == nil || !strings.Contains(err.Error(), "async") {
+			t.Errorf("Expected error for synchronous hook, got %v", err)
+		}
+
+		// Test hook triggered by a read
+		readHook := strings.Replace(strings.Replace(invalidHookEvent, "user_id:", "id:", 1), "trigger: after_create", "trigger: after_read", 1)
+		_, err = loader.LoadFromBytes([]byte(readHook))
+		if err == nil || !strings.Contains(err.Error(), "after_read") {
+			t.Errorf("Expected error for hook triggered by a read, got %v", err)
+		}
 	})
 	
 	t.Run("EntityValidation", func(t *testing.T) {
@@ -214,6 +259,104 @@ entities:
 		if err == nil {
 			t.Error("Expected error for entity where key field doesn't exist")
 		}
+
+		// Test property name that is not a safe SQL identifier
+		invalidEntity4 := `
+version: 1
+service:
+  name: "test"
+entities:
+  test:
+    key: id
+    schema:
+      type: object
+      properties:
+        id: { type: string }
+        "name; DROP TABLE test": { type: string }
+`
+		_, err = loader.LoadFromBytes([]byte(invalidEntity4))
+		if err == nil {
+			t.Error("Expected error for property name that is not a valid identifier")
+		}
+
+		// Test entity name reserved for platform tables
+		reservedEntity := `
+version: 1
+service:
+  name: "test"
+entities:
+  _outbox:
+    key: id
+    schema:
+      type: object
+      properties:
+        id: { type: string }
+`
+		_, err = loader.LoadFromBytes([]byte(reservedEntity))
+		if err == nil {
+			t.Error("Expected error for entity name starting with '_'")
+		}
+
+		// Test property definitions the validator cannot enforce
+		invalidEntity5 := `
+version: 1
+service:
+  name: "test"
+entities:
+  test:
+    key: id
+    schema:
+      type: object
+      properties:
+        id: { type: string }
+        code: { type: string, pattern: "[a-z" }
+        address:
+          type: object
+          properties:
+            zip: { type: string, format: "postcode" }
+`
+		_, err = loader.LoadFromBytes([]byte(invalidEntity5))
+		if err == nil {
+			t.Fatal("Expected error for invalid pattern and unknown format")
+		}
+		for _, path := range []string{"/properties/code/pattern", "/properties/address/properties/zip/format"} {
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("Expected error to mention %s, got %v", path, err)
+			}
+		}
+
+		// Test computed properties
+		computedEntity := `
+version: 1
+service:
+  name: "test"
+entities:
+  test:
+    key: id
+    schema:
+      type: object
+      properties:
+        id: { type: string }
+        first_name: { type: string }
+        last_name: { type: string }
+        full_name:
+          type: string
+          computed: { expression: 'concat(first_name, " ", last_name)' }
+`
+		if _, err = loader.LoadFromBytes([]byte(computedEntity)); err != nil {
+			t.Errorf("Expected computed property to load, got %v", err)
+		}
+		
+		for name, computed := range map[string]string{
+			"unknown property":      `{ expression: "concat(first_name, nickname)" }`,
+			"syntax error":          `{ expression: "concat(first_name" }`,
+			"expression and function": `{ expression: "first_name", function: "full_name" }`,
+		} {
+			invalidComputed := strings.Replace(computedEntity, `{ expression: 'concat(first_name, " ", last_name)' }`, computed, 1)
+			if _, err = loader.LoadFromBytes([]byte(invalidComputed)); err == nil {
+				t.Errorf("Expected error for computed property with %s", name)
+			}
+		}
 	})
 	
 	t.Run("FunctionValidation", func(t *testing.T) {
@@ -0,0 +1,455 @@
+// Package jsonschema validates values against the JSON Schema subset used by
+// BackSaas entity definitions. It depends only on the standard library so the
+// CLI can check schemas with exactly the rules the platform API enforces.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Types lists the supported values of Schema.Type
+var Types = []string{"string", "integer", "number", "boolean", "array", "object"}
+
+// Formats lists the supported values of Schema.Format for strings
+var Formats = []string{"email", "hostname", "uri", "date-time", "date", "uuid", "ipv4", "ipv6"}
+
+// Schema is a JSON Schema node. Zero values mean "no constraint".
+type Schema struct {
+	Type      string
+	Format    string
+	Pattern   string
+	Enum      []interface{}
+	MinLength int
+	MaxLength int
+	Minimum   *float64
+	Maximum   *float64
+
+	// Array constraints
+	Items    *Schema
+	MinItems int
+	MaxItems int
+
+	// Object constraints
+	Properties map[string]*Schema
+	Required   []string
+
+	// AdditionalProperties rejects undeclared object keys when set to false
+	AdditionalProperties *bool
+
+	// ReadOnly rejects the property when it is present in an object
+	ReadOnly bool
+}
+
+// Violation is a single validation failure located by a JSON pointer
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports every violation found in a value
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error joins the violations into one message
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		if v.Path == "" {
+			messages[i] = v.Message
+		} else {
+			messages[i] = v.Path + ": " + v.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks value against the schema and returns a *ValidationError
+// listing every violation, or nil when the value is valid
+func (s *Schema) Validate(value interface{}) error {
+	var violations []Violation
+	s.validate(value, "", &violations)
+	return newValidationError(violations)
+}
+
+// CheckDefinition checks that the schema itself is well formed: known types
+// and formats, compilable patterns and consistent bounds. Violation paths
+// point into the schema rather than into a value.
+func (s *Schema) CheckDefinition() error {
+	var violations []Violation
+	s.checkDefinition("", &violations)
+	return newValidationError(violations)
+}
+
+func newValidationError(violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// Pointer appends a reference token to a JSON pointer, escaping it per RFC 6901
+func Pointer(path string, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return path + "/" + token
+}
+
+func (s *Schema) validate(value interface{}, path string, violations *[]Violation) {
+	// A missing constraint or a null value is always accepted; required
+	// checks the presence of object keys separately
+	if s == nil || value == nil {
+		return
+	}
+
+	report := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			report("must be a string")
+			return
+		}
+		s.validateString(str, report)
+	case "integer":
+		n, ok := toFloat64(value)
+		if !ok || n != float64(int64(n)) {
+			report("must be an integer")
+			return
+		}
+		s.validateNumber(n, report)
+	case "number":
+		n, ok := toFloat64(value)
+		if !ok {
+			report("must be a number")
+			return
+		}
+		s.validateNumber(n, report)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("must be a boolean")
+			return
+		}
+	case "array":
+		items, ok := toSlice(value)
+		if !ok {
+			report("must be an array")
+			return
+		}
+		if s.MinItems > 0 && len(items) < s.MinItems {
+			report("must have at least %d items", s.MinItems)
+		}
+		if s.MaxItems > 0 && len(items) > s.MaxItems {
+			report("must have at most %d items", s.MaxItems)
+		}
+		for i, item := range items {
+			s.Items.validate(item, Pointer(path, fmt.Sprint(i)), violations)
+		}
+	case "object":
+		object, ok := toObject(value)
+		if !ok {
+			report("must be an object")
+			return
+		}
+		s.validateObject(object, path, violations)
+	}
+
+	if len(s.Enum) > 0 && !s.enumContains(value) {
+		report("must be one of: %s", formatEnum(s.Enum))
+	}
+}
+
+func (s *Schema) validateString(str string, report func(string, ...interface{})) {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength > 0 && length < s.MinLength {
+		report("must be at least %d characters", s.MinLength)
+	}
+	if s.MaxLength > 0 && length > s.MaxLength {
+		report("must be at most %d characters", s.MaxLength)
+	}
+
+	if s.Pattern != "" {
+		re, err := compilePattern(s.Pattern)
+		if err != nil {
+			report("cannot be checked against invalid pattern %q", s.Pattern)
+		} else if !re.MatchString(str) {
+			report("must match pattern %q", s.Pattern)
+		}
+	}
+
+	if s.Format != "" && !validFormat(s.Format, str) {
+		report("must be a valid %s", s.Format)
+	}
+}
+
+func (s *Schema) validateNumber(n float64, report func(string, ...interface{})) {
+	if s.Minimum != nil && n < *s.Minimum {
+		report("must be greater than or equal to %v", *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		report("must be less than or equal to %v", *s.Maximum)
+	}
+}
+
+func (s *Schema) validateObject(object map[string]interface{}, path string, violations *[]Violation) {
+	for _, name := range s.Required {
+		if _, exists := object[name]; !exists {
+			*violations = append(*violations, Violation{Path: Pointer(path, name), Message: "is required"})
+		}
+	}
+
+	// Visit keys in order so violations are reported deterministically
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propSchema, declared := s.Properties[key]
+		if !declared {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*violations = append(*violations, Violation{Path: Pointer(path, key), Message: "is not a known property"})
+			}
+			continue
+		}
+		if propSchema != nil && propSchema.ReadOnly {
+			*violations = append(*violations, Violation{Path: Pointer(path, key), Message: "is read-only"})
+			continue
+		}
+		propSchema.validate(object[key], Pointer(path, key), violations)
+	}
+}
+
+func (s *Schema) enumContains(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if a, ok := toFloat64(allowed); ok {
+			if v, ok := toFloat64(value); ok && a == v {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *Schema) checkDefinition(path string, violations *[]Violation) {
+	if s == nil {
+		return
+	}
+
+	report := func(keyword, format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Path: Pointer(path, keyword), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !contains(Types, s.Type) {
+		report("type", "unsupported type %q", s.Type)
+	}
+	if s.Format != "" {
+		if s.Type != "string" {
+			report("format", "format only applies to strings")
+		} else if !contains(Formats, s.Format) {
+			report("format", "unsupported format %q", s.Format)
+		}
+	}
+	if s.Pattern != "" {
+		if _, err := compilePattern(s.Pattern); err != nil {
+			report("pattern", "invalid pattern: %v", err)
+		}
+	}
+	if s.MinLength < 0 || s.MaxLength < 0 || (s.MaxLength > 0 && s.MinLength > s.MaxLength) {
+		report("maxLength", "must be non-negative and not less than minLength")
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		report("maximum", "must not be less than minimum")
+	}
+	if s.MinItems < 0 || s.MaxItems < 0 || (s.MaxItems > 0 && s.MinItems > s.MaxItems) {
+		report("maxItems", "must be non-negative and not less than minItems")
+	}
+	for i, value := range s.Enum {
+		var enumViolations []Violation
+		s.withoutEnum().validate(value, "", &enumViolations)
+		if len(enumViolations) > 0 {
+			report("enum", "value %d (%v) %s", i, value, enumViolations[0].Message)
+		}
+	}
+
+	if s.Items != nil {
+		s.Items.checkDefinition(Pointer(path, "items"), violations)
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.Properties[name].checkDefinition(Pointer(Pointer(path, "properties"), name), violations)
+	}
+
+	if len(s.Properties) > 0 {
+		for _, name := range s.Required {
+			if _, exists := s.Properties[name]; !exists {
+				report("required", "required property %q is not declared", name)
+			}
+		}
+	}
+}
+
+// withoutEnum returns a copy of the schema that ignores its enum, used to
+// check the enum values themselves
+func (s *Schema) withoutEnum() *Schema {
+	copied := *s
+	copied.Enum = nil
+	return &copied
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnamePattern = regexp.MustCompile(`^(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)(?:\.(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?))*$`)
+)
+
+// validFormat reports whether str satisfies a format. Unknown formats are
+// accepted, as JSON Schema treats them as annotations.
+func validFormat(format, str string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(str)
+		return err == nil && addr.Address == str
+	case "hostname":
+		return len(str) <= 253 && hostnamePattern.MatchString(str)
+	case "uri":
+		u, err := url.Parse(str)
+		return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, str)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", str)
+		return err == nil
+	case "uuid":
+		return uuidPattern.MatchString(str)
+	case "ipv4":
+		ip := net.ParseIP(str)
+		return ip != nil && ip.To4() != nil && !strings.Contains(str, ":")
+	case "ipv6":
+		ip := net.ParseIP(str)
+		return ip != nil && strings.Contains(str, ":")
+	default:
+		return true
+	}
+}
+
+// patternCache holds compiled patterns, which are reused on every request
+var patternCache sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toSlice(value interface{}) ([]interface{}, bool) {
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+func toObject(value interface{}) (map[string]interface{}, bool) {
+	if object, ok := value.(map[string]interface{}); ok {
+		return object, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	object := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		object[iter.Key().String()] = iter.Value().Interface()
+	}
+	return object, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
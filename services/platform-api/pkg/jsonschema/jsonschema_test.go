@@ -0,0 +1,258 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schema   *Schema
+		value    interface{}
+		expected []Violation
+	}{
+		{
+			name:   "Valid string",
+			schema: &Schema{Type: "string", MinLength: 2, MaxLength: 5, Pattern: `^[a-z]+$`},
+			value:  "abc",
+		},
+		{
+			name:   "Length counts characters",
+			schema: &Schema{Type: "string", MaxLength: 3},
+			value:  "äöü",
+		},
+		{
+			name:     "Pattern mismatch",
+			schema:   &Schema{Type: "string", Pattern: `^[a-z]+$`},
+			value:    "ABC",
+			expected: []Violation{{Path: "", Message: `must match pattern "^[a-z]+$"`}},
+		},
+		{
+			name:   "Null is accepted",
+			schema: &Schema{Type: "string"},
+			value:  nil,
+		},
+		{
+			name:     "Wrong type stops further checks",
+			schema:   &Schema{Type: "string", MinLength: 10},
+			value:    42.0,
+			expected: []Violation{{Path: "", Message: "must be a string"}},
+		},
+		{
+			name:     "Integer rejects fractions",
+			schema:   &Schema{Type: "integer"},
+			value:    1.5,
+			expected: []Violation{{Path: "", Message: "must be an integer"}},
+		},
+		{
+			name:   "Integer accepts json.Number",
+			schema: &Schema{Type: "integer", Minimum: floatPtr(1)},
+			value:  json.Number("3"),
+		},
+		{
+			name:     "Number bounds",
+			schema:   &Schema{Type: "number", Minimum: floatPtr(0), Maximum: floatPtr(1)},
+			value:    1.5,
+			expected: []Violation{{Path: "", Message: "must be less than or equal to 1"}},
+		},
+		{
+			name:     "Enum",
+			schema:   &Schema{Type: "string", Enum: []interface{}{"lead", "customer"}},
+			value:    "partner",
+			expected: []Violation{{Path: "", Message: "must be one of: lead, customer"}},
+		},
+		{
+			name:   "Numeric enum compares values",
+			schema: &Schema{Type: "integer", Enum: []interface{}{1.0, 2.0}},
+			value:  2,
+		},
+		{
+			name: "Array items",
+			schema: &Schema{
+				Type:     "array",
+				MaxItems: 2,
+				Items:    &Schema{Type: "string", Format: "email"},
+			},
+			value: []interface{}{"a@example.com", "not-an-email", "c@example.com"},
+			expected: []Violation{
+				{Path: "", Message: "must have at most 2 items"},
+				{Path: "/1", Message: "must be a valid email"},
+			},
+		},
+		{
+			name: "Nested objects",
+			schema: &Schema{
+				Type:     "object",
+				Required: []string{"address"},
+				Properties: map[string]*Schema{
+					"address": {
+						Type:     "object",
+						Required: []string{"city", "zip"},
+						Properties: map[string]*Schema{
+							"city": {Type: "string"},
+							"zip":  {Type: "string", Pattern: `^[0-9]{5}$`},
+							"geo": {
+								Type: "object",
+								Properties: map[string]*Schema{
+									"lat": {Type: "number", Minimum: floatPtr(-90), Maximum: floatPtr(90)},
+								},
+							},
+						},
+					},
+				},
+			},
+			value: map[string]interface{}{
+				"address": map[string]interface{}{
+					"zip": "1234",
+					"geo": map[string]interface{}{"lat": 91.0},
+				},
+			},
+			expected: []Violation{
+				{Path: "/address/city", Message: "is required"},
+				{Path: "/address/geo/lat", Message: "must be less than or equal to 90"},
+				{Path: "/address/zip", Message: `must match pattern "^[0-9]{5}$"`},
+			},
+		},
+		{
+			name: "Closed object rejects unknown keys",
+			schema: &Schema{
+				Type:                 "object",
+				Properties:           map[string]*Schema{"a/b": {Type: "boolean"}},
+				AdditionalProperties: new(bool),
+			},
+			value: map[string]interface{}{"a/b": "yes", "extra": 1},
+			expected: []Violation{
+				{Path: "/a~1b", Message: "must be a boolean"},
+				{Path: "/extra", Message: "is not a known property"},
+			},
+		},
+		{
+			name: "Read-only properties are rejected",
+			schema: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"name":      {Type: "string"},
+					"full_name": {Type: "string", ReadOnly: true},
+				},
+			},
+			value:    map[string]interface{}{"name": "Ada", "full_name": "Ada Lovelace"},
+			expected: []Violation{{Path: "/full_name", Message: "is read-only"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.schema.Validate(tc.value)
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected *ValidationError, got %v", err)
+			}
+			if len(validationErr.Violations) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, validationErr.Violations)
+			}
+			for i, violation := range validationErr.Violations {
+				if violation != tc.expected[i] {
+					t.Errorf("Expected %v, got %v", tc.expected[i], violation)
+				}
+			}
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	testCases := []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{"email", []string{"user@example.com", "first.last+tag@sub.example.org"}, []string{"user", "User <user@example.com>", "@example.com"}},
+		{"hostname", []string{"example.com", "api-1.internal", "localhost"}, []string{"-bad.com", "under_score.com", "a..b"}},
+		{"uri", []string{"https://example.com/path?q=1", "mailto:user@example.com"}, []string{"/relative/path", "example.com"}},
+		{"date-time", []string{"2024-03-01T10:30:00Z", "2024-03-01T10:30:00.123+02:00"}, []string{"2024-03-01", "2024-03-01 10:30:00"}},
+		{"date", []string{"2024-02-29"}, []string{"2023-02-29", "03/01/2024"}},
+		{"uuid", []string{"6f9619ff-8b86-d011-b42d-00c04fc964ff"}, []string{"6f9619ff8b86d011b42d00c04fc964ff"}},
+		{"ipv4", []string{"192.168.0.1"}, []string{"::1", "256.0.0.1"}},
+		{"ipv6", []string{"::1"}, []string{"192.168.0.1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			for _, value := range tc.valid {
+				if !validFormat(tc.format, value) {
+					t.Errorf("Expected %q to be a valid %s", value, tc.format)
+				}
+			}
+			for _, value := range tc.invalid {
+				if validFormat(tc.format, value) {
+					t.Errorf("Expected %q to be an invalid %s", value, tc.format)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDefinition(t *testing.T) {
+	valid := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"email":  {Type: "string", Format: "email"},
+			"status": {Type: "string", Enum: []interface{}{"active", "inactive"}},
+			"tags":   {Type: "array", Items: &Schema{Type: "string"}},
+		},
+		Required: []string{"email"},
+	}
+	if err := valid.CheckDefinition(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":  {Type: "string", Pattern: "[a-z"},
+			"count": {Type: "integer", Minimum: floatPtr(10), Maximum: floatPtr(1)},
+			"kind":  {Type: "integer", Enum: []interface{}{"one"}},
+			"tags":  {Type: "array", Items: &Schema{Type: "text"}},
+			"zip":   {Type: "string", Format: "postcode"},
+		},
+		Required: []string{"missing"},
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(invalid.CheckDefinition(), &validationErr) {
+		t.Fatal("Expected *ValidationError for invalid definition")
+	}
+
+	expected := []string{
+		"/required",
+		"/properties/code/pattern",
+		"/properties/count/maximum",
+		"/properties/kind/enum",
+		"/properties/tags/items/type",
+		"/properties/zip/format",
+	}
+	found := make(map[string]bool)
+	for _, violation := range validationErr.Violations {
+		found[violation.Path] = true
+	}
+	for _, path := range expected {
+		if !found[path] {
+			t.Errorf("Expected a violation at %s, got %v", path, validationErr.Violations)
+		}
+	}
+	if len(validationErr.Violations) != len(expected) {
+		t.Errorf("Expected %d violations, got %v", len(expected), validationErr.Violations)
+	}
+}